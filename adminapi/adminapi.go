@@ -0,0 +1,411 @@
+// Package adminapi provides Fiber handlers for operator endpoints that
+// manage tenants. Destructive endpoints take two calls: the first describes
+// what would be removed and returns a short-lived confirmation token, and
+// only a second call echoing that token changes anything.
+//
+// The handlers do not authenticate callers. Mount them on a group that does:
+//
+//	api := adminapi.New(adminapi.Config{
+//		Store:  store,
+//		Secret: []byte(os.Getenv("ADMIN_TOKEN_SECRET")),
+//	})
+//	api.Register(app.Group("/api", requireOperator))
+package adminapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+// ConfirmationHeader carries the token from the first call on the second
+const ConfirmationHeader = "X-Confirmation-Token"
+
+// Actions of DELETE /tenants/:schema, chosen with the action query param
+const (
+	// ActionDeactivate marks the tenant inactive in the registry and keeps
+	// its data
+	ActionDeactivate = "deactivate"
+
+	// ActionDrop drops the tenant schema with all its data and soft-deletes
+	// the registry record, if there is one
+	ActionDrop = "drop"
+)
+
+// Store is the part of tenantstore.TenantStore the admin API uses, so
+// handlers can be tested against a fake
+type Store interface {
+	CreateTenants(ctx context.Context, specs []tenantstore.TenantSpec, opts tenantstore.BatchOptions) (tenantstore.BatchReport, error)
+	LookupTenant(ctx context.Context, tenantSchema string) (*tenantstore.Tenant, error)
+	RowCounts(ctx context.Context, tenantSchema string) (map[string]int64, error)
+	FindTenantByUnique(ctx context.Context, model interface{}, column string, value interface{}, opts ...tenantstore.FindOptions) (string, error)
+	DropTenant(ctx context.Context, tenantSchema string, opts tenantstore.DropOptions) (*tenantstore.Plan, error)
+	DeactivateTenant(ctx context.Context, tenantSchema string) error
+	SoftDeleteTenant(ctx context.Context, tenantSchema string) error
+	ExportWarmState() ([]byte, error)
+	ImportWarmState(ctx context.Context, data []byte, warm bool) error
+}
+
+// Config configures the admin API
+type Config struct {
+	// Store manages the tenants (required), usually a
+	// *tenantstore.TenantStore
+	Store Store
+
+	// Secret signs confirmation tokens (required). Instances sharing it
+	// accept each other's tokens.
+	Secret []byte
+
+	// Optional: How long confirmation tokens are valid (defaults to 5 minutes)
+	TokenTTL time.Duration
+
+	// Optional: Models GET /tenants/search looks values up in, by the name
+	// used in its model query param, such as {"users": &User{}}. The endpoint
+	// is only registered when set.
+	Searchable map[string]interface{}
+
+	// Optional: Authorizes searches on top of the router's authentication,
+	// such as for a support role. Returning an error rejects the search.
+	AuthorizeSearch func(c *fiber.Ctx) error
+
+	// Optional: How long a search may take per tenant (defaults to
+	// tenantstore.DefaultFindTenantTimeout)
+	SearchTimeout time.Duration
+}
+
+// API serves the admin endpoints
+type API struct {
+	store  Store
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+
+	searchable      map[string]interface{}
+	authorizeSearch func(c *fiber.Ctx) error
+	searchTimeout   time.Duration
+
+	// used holds the nonces of consumed tokens until they expire. Replays
+	// are only detected by the instance that consumed the token.
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// New creates the admin API
+func New(config Config) *API {
+	if config.Store == nil {
+		panic("TenantStore is required")
+	}
+	if len(config.Secret) == 0 {
+		panic("Secret is required")
+	}
+
+	ttl := config.TokenTTL
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+
+	return &API{
+		store:  config.Store,
+		secret: config.Secret,
+		ttl:    ttl,
+		now:    time.Now,
+		used:   make(map[string]time.Time),
+
+		searchable:      config.Searchable,
+		authorizeSearch: config.AuthorizeSearch,
+		searchTimeout:   config.SearchTimeout,
+	}
+}
+
+// Register adds the endpoints to router:
+//
+//	POST   /tenants[?concurrency=N&stop_on_error=true]
+//	DELETE /tenants/:schema[?action=deactivate|drop]
+//	GET    /tenants/search?model=M&column=C&value=V (with Config.Searchable)
+//	GET    /warm-state
+//	POST   /warm-state[?warm=true]
+func (a *API) Register(router fiber.Router) {
+	router.Post("/tenants", a.CreateTenants)
+	router.Delete("/tenants/:schema", a.DeleteTenant)
+	router.Get("/warm-state", a.ExportWarmState)
+	router.Post("/warm-state", a.ImportWarmState)
+	if len(a.searchable) > 0 {
+		router.Get("/tenants/search", a.SearchTenants)
+	}
+}
+
+// CreateTenants provisions the tenants listed in the JSON or YAML body, in
+// the format of tenantstore.ReadTenantSpecs, with store.CreateTenants. It
+// responds 200 with the report when every tenant was created and 207 when
+// some failed or were skipped. The concurrency and stop_on_error query
+// params set the BatchOptions.
+func (a *API) CreateTenants(c *fiber.Ctx) error {
+	specs, err := tenantstore.ReadTenantSpecs(bytes.NewReader(c.Body()))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if len(specs) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "No tenants listed")
+	}
+
+	report, err := a.store.CreateTenants(c.UserContext(), specs, tenantstore.BatchOptions{
+		Concurrency: c.QueryInt("concurrency"),
+		StopOnError: c.QueryBool("stop_on_error"),
+	})
+	if err != nil {
+		if errors.Is(err, tenantstore.ErrInvalidBatch) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return storeError(err)
+	}
+
+	status := fiber.StatusOK
+	if report.Count(tenantstore.BatchCreated) < len(report.Results) {
+		status = fiber.StatusMultiStatus
+	}
+	return c.Status(status).JSON(report)
+}
+
+// SearchTenants finds the tenant with a row of a Config.Searchable model
+// whose column equals value, such as the tenant of a user's email, with
+// store.FindTenantByUnique. It responds 200 with the tenant, 404 when no
+// tenant has the value and 503 when no tenant matched but some could not be
+// searched within SearchTimeout.
+func (a *API) SearchTenants(c *fiber.Ctx) error {
+	if a.authorizeSearch != nil {
+		if err := a.authorizeSearch(c); err != nil {
+			return err
+		}
+	}
+
+	name, column, value := c.Query("model"), c.Query("column"), c.Query("value")
+	model, ok := a.searchable[name]
+	if !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "Model is not searchable")
+	}
+	if column == "" || value == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Column and value are required")
+	}
+
+	schema, err := a.store.FindTenantByUnique(c.UserContext(), model, column, value, tenantstore.FindOptions{
+		TenantTimeout: a.searchTimeout,
+	})
+	var failures tenantstore.TenantErrors
+	switch {
+	case err == nil:
+		return c.JSON(fiber.Map{"tenant": schema})
+	case errors.Is(err, tenantstore.ErrUnknownColumn):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.As(err, &failures):
+		return fiber.NewError(fiber.StatusServiceUnavailable, fmt.Sprintf("No tenant found, but %d tenant(s) could not be searched", len(failures)))
+	}
+	return storeError(err)
+}
+
+// ExportWarmState responds with the recently used tenants of this process,
+// from store.ExportWarmState, for the process replacing it during a rollout
+func (a *API) ExportWarmState(c *fiber.Ctx) error {
+	state, err := a.store.ExportWarmState()
+	if err != nil {
+		return storeError(err)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(state)
+}
+
+// ImportWarmState reads the body served by ExportWarmState of another
+// process with store.ImportWarmState, dialing the most recently used
+// tenants first when the warm query param is true. It responds 204.
+func (a *API) ImportWarmState(c *fiber.Ctx) error {
+	err := a.store.ImportWarmState(c.UserContext(), c.Body(), c.QueryBool("warm"))
+	if errors.Is(err, tenantstore.ErrInvalidWarmState) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return storeError(err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// confirmation is the signed content of a confirmation token
+type confirmation struct {
+	Schema  string           `json:"schema"`
+	Action  string           `json:"action"`
+	Rows    map[string]int64 `json:"rows"`
+	Expires int64            `json:"exp"`
+	Nonce   string           `json:"nonce"`
+}
+
+// DeleteTenant deactivates or drops a tenant in two phases. Without the
+// ConfirmationHeader it responds 202 with the tenant's row counts, the
+// planned actions and a confirmation token. With the token it performs the
+// action the token was issued for.
+func (a *API) DeleteTenant(c *fiber.Ctx) error {
+	schema := c.Params("schema")
+	action := c.Query("action", ActionDeactivate)
+	if action != ActionDeactivate && action != ActionDrop {
+		return fiber.NewError(fiber.StatusBadRequest, "Action must be deactivate or drop")
+	}
+
+	token := c.Get(ConfirmationHeader)
+	if token == "" {
+		return a.requestConfirmation(c, schema, action)
+	}
+
+	if err := a.consume(token, schema, action); err != nil {
+		return err
+	}
+
+	ctx := c.UserContext()
+	switch action {
+	case ActionDrop:
+		plan, err := a.store.DropTenant(ctx, schema, tenantstore.DropOptions{Cascade: true})
+		if err != nil {
+			return storeError(err)
+		}
+		err = a.store.SoftDeleteTenant(ctx, schema)
+		if err != nil && !errors.Is(err, tenantstore.ErrRegistryDisabled) && !errors.Is(err, tenantstore.ErrTenantNotFound) {
+			return storeError(err)
+		}
+		return c.JSON(fiber.Map{"schema": schema, "action": action, "plan": plan})
+
+	default:
+		if err := a.store.DeactivateTenant(ctx, schema); err != nil {
+			return storeError(err)
+		}
+		return c.JSON(fiber.Map{"schema": schema, "action": action})
+	}
+}
+
+// requestConfirmation describes what the action would remove and issues a
+// token for it
+func (a *API) requestConfirmation(c *fiber.Ctx, schema, action string) error {
+	ctx := c.UserContext()
+	response := fiber.Map{"schema": schema, "action": action}
+
+	if action == ActionDeactivate {
+		// Deactivation needs a registry record to flip
+		if _, err := a.store.LookupTenant(ctx, schema); err != nil {
+			return storeError(err)
+		}
+	}
+
+	rows, err := a.store.RowCounts(ctx, schema)
+	if err != nil {
+		return storeError(err)
+	}
+	response["rows"] = rows
+
+	if action == ActionDrop {
+		plan, err := a.store.DropTenant(ctx, schema, tenantstore.DropOptions{Cascade: true, DryRun: true})
+		if err != nil {
+			return storeError(err)
+		}
+		response["plan"] = plan
+	}
+
+	token, expires, err := a.issue(schema, action, rows)
+	if err != nil {
+		return err
+	}
+	response["confirmation_token"] = token
+	response["expires_at"] = expires
+
+	return c.Status(fiber.StatusAccepted).JSON(response)
+}
+
+// issue signs a confirmation token for action on schema
+func (a *API) issue(schema, action string, rows map[string]int64) (string, time.Time, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", time.Time{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to create confirmation token")
+	}
+
+	expires := a.now().Add(a.ttl).Truncate(time.Second)
+	payload, err := json.Marshal(confirmation{
+		Schema:  schema,
+		Action:  action,
+		Rows:    rows,
+		Expires: expires.Unix(),
+		Nonce:   hex.EncodeToString(nonce),
+	})
+	if err != nil {
+		return "", time.Time{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to create confirmation token")
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + a.sign(encoded), expires, nil
+}
+
+// consume verifies a token for action on schema and marks it used
+func (a *API) consume(token, schema, action string) error {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(a.sign(encoded))) {
+		return fiber.NewError(fiber.StatusForbidden, "Invalid confirmation token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return fiber.NewError(fiber.StatusForbidden, "Invalid confirmation token")
+	}
+	var claims confirmation
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return fiber.NewError(fiber.StatusForbidden, "Invalid confirmation token")
+	}
+
+	if claims.Schema != schema || claims.Action != action {
+		return fiber.NewError(fiber.StatusForbidden, "Confirmation token was issued for another tenant or action")
+	}
+
+	now := a.now()
+	expires := time.Unix(claims.Expires, 0)
+	if !now.Before(expires) {
+		return fiber.NewError(fiber.StatusForbidden, "Confirmation token expired")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for nonce, exp := range a.used {
+		if !now.Before(exp) {
+			delete(a.used, nonce)
+		}
+	}
+	if _, replayed := a.used[claims.Nonce]; replayed {
+		return fiber.NewError(fiber.StatusConflict, "Confirmation token already used")
+	}
+	a.used[claims.Nonce] = expires
+	return nil
+}
+
+// sign computes the base64 encoded HMAC of a token payload
+func (a *API) sign(encoded string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// storeError maps store errors to responses
+func storeError(err error) error {
+	switch {
+	case errors.Is(err, tenantstore.ErrSchemaNotFound), errors.Is(err, tenantstore.ErrTenantNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Tenant not found")
+	case errors.Is(err, tenantstore.ErrRegistryDisabled):
+		return fiber.NewError(fiber.StatusConflict, "Deactivation requires the tenant registry")
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+}
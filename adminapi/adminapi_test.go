@@ -0,0 +1,407 @@
+package adminapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore/tenantstoretest"
+)
+
+type note struct {
+	ID   uint `gorm:"primaryKey"`
+	Body string
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	tenantstoretest.Stop()
+	os.Exit(code)
+}
+
+func getTestDSN(t *testing.T) string {
+	t.Helper()
+
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		dsn = tenantstoretest.StartPostgres(t)
+	}
+	return tenantstoretest.NewDatabase(t, dsn)
+}
+
+// newTokenTestAPI returns an API for token tests, which never touch the store
+func newTokenTestAPI() *API {
+	return New(Config{Store: &tenantstore.TenantStore{}, Secret: []byte("secret"), TokenTTL: time.Minute})
+}
+
+func expectStatus(t *testing.T, err error, status int) {
+	t.Helper()
+
+	var fiberErr *fiber.Error
+	if !errors.As(err, &fiberErr) || fiberErr.Code != status {
+		t.Fatalf("Expected status %d, got %v", status, err)
+	}
+}
+
+func TestConfirmationTokenExpiry(t *testing.T) {
+	api := newTokenTestAPI()
+	now := time.Now()
+	api.now = func() time.Time { return now }
+
+	token, _, err := api.issue("acme", ActionDrop, map[string]int64{"notes": 2})
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	err = api.consume(token, "acme", ActionDrop)
+	expectStatus(t, err, fiber.StatusForbidden)
+	if !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("Expected an expiry error, got %v", err)
+	}
+}
+
+func TestConfirmationTokenTampering(t *testing.T) {
+	api := newTokenTestAPI()
+
+	token, _, err := api.issue("acme", ActionDeactivate, nil)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+
+	// Rewrite the payload to target another tenant and action
+	encoded, signature, _ := strings.Cut(token, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(encoded)
+	var claims confirmation
+	json.Unmarshal(payload, &claims)
+	claims.Schema, claims.Action = "globex", ActionDrop
+	payload, _ = json.Marshal(claims)
+	forged := base64.RawURLEncoding.EncodeToString(payload) + "." + signature
+
+	expectStatus(t, api.consume(forged, "globex", ActionDrop), fiber.StatusForbidden)
+
+	// Tokens from another secret are rejected too
+	other := New(Config{Store: &tenantstore.TenantStore{}, Secret: []byte("other")})
+	expectStatus(t, other.consume(token, "acme", ActionDeactivate), fiber.StatusForbidden)
+
+	// A valid token only confirms what it was issued for
+	expectStatus(t, api.consume(token, "acme", ActionDrop), fiber.StatusForbidden)
+	expectStatus(t, api.consume(token, "globex", ActionDeactivate), fiber.StatusForbidden)
+	expectStatus(t, api.consume("garbage", "acme", ActionDeactivate), fiber.StatusForbidden)
+}
+
+func TestConfirmationTokenReplay(t *testing.T) {
+	api := newTokenTestAPI()
+	now := time.Now()
+	api.now = func() time.Time { return now }
+
+	token, _, err := api.issue("acme", ActionDeactivate, nil)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+
+	if err := api.consume(token, "acme", ActionDeactivate); err != nil {
+		t.Fatalf("Expected the first use to succeed, got %v", err)
+	}
+	expectStatus(t, api.consume(token, "acme", ActionDeactivate), fiber.StatusConflict)
+
+	// Used nonces are forgotten once their token expires
+	now = now.Add(2 * time.Minute)
+	fresh, _, _ := api.issue("acme", ActionDeactivate, nil)
+	if err := api.consume(fresh, "acme", ActionDeactivate); err != nil {
+		t.Fatalf("Expected a new token to succeed, got %v", err)
+	}
+	if len(api.used) != 1 {
+		t.Fatalf("Expected expired nonces to be pruned, got %d", len(api.used))
+	}
+}
+
+func TestDeleteTenantTwoPhase(t *testing.T) {
+	config := tenantstore.DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&note{}}
+	config.EnableRegistry = true
+
+	store, err := tenantstore.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for _, schema := range []string{"acme", "globex"} {
+		if err := store.RegisterTenant(ctx, &tenantstore.Tenant{Schema: schema, Name: schema, Active: true}); err != nil {
+			t.Fatalf("Failed to register tenant: %v", err)
+		}
+		db, err := store.GetTenantDB(ctx, schema)
+		if err != nil {
+			t.Fatalf("Failed to create tenant: %v", err)
+		}
+		db.Create(&[]note{{Body: "a"}, {Body: "b"}})
+	}
+
+	app := fiber.New()
+	New(Config{Store: store, Secret: []byte("secret")}).Register(app.Group("/api"))
+
+	call := func(path, token string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("DELETE", path, nil)
+		if token != "" {
+			req.Header.Set(ConfirmationHeader, token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	// The first call changes nothing and describes the tenant
+	status, body := call("/api/tenants/acme?action=drop", "")
+	if status != fiber.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", status)
+	}
+	rows, _ := body["rows"].(map[string]interface{})
+	if rows["notes"] != float64(2) || body["plan"] == nil {
+		t.Fatalf("Expected row counts and the drop plan, got %v", body)
+	}
+	token, _ := body["confirmation_token"].(string)
+
+	if _, err := store.RowCounts(ctx, "acme"); err != nil {
+		t.Fatalf("Expected the schema to survive the first call: %v", err)
+	}
+
+	// The token does not confirm dropping another tenant
+	if status, _ := call("/api/tenants/globex?action=drop", token); status != fiber.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d", status)
+	}
+
+	if status, _ := call("/api/tenants/acme?action=drop", token); status != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if _, err := store.RowCounts(ctx, "acme"); !errors.Is(err, tenantstore.ErrSchemaNotFound) {
+		t.Fatalf("Expected the schema to be dropped, got %v", err)
+	}
+	if status, _ := call("/api/tenants/acme?action=drop", token); status != fiber.StatusConflict {
+		t.Fatalf("Expected status 409 on replay, got %d", status)
+	}
+
+	// Deactivation keeps the data
+	_, body = call("/api/tenants/globex", "")
+	token, _ = body["confirmation_token"].(string)
+	if status, _ := call("/api/tenants/globex", token); status != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if active, _ := store.IsTenantActive(ctx, "globex"); active {
+		t.Fatal("Expected globex to be deactivated")
+	}
+	if counts, err := store.RowCounts(ctx, "globex"); err != nil || counts["notes"] != 2 {
+		t.Fatalf("Expected globex's rows to be kept, got %v (%v)", counts, err)
+	}
+
+	if status, _ := call("/api/tenants/missing", ""); status != fiber.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", status)
+	}
+}
+
+func TestCreateTenantsRejectsBadBody(t *testing.T) {
+	app := fiber.New()
+	newTokenTestAPI().Register(app.Group("/api"))
+
+	for _, body := range []string{`{"tenants": [{"schema": "acme", "active": false}]}`, `{"tenants": []}`} {
+		resp, err := app.Test(httptest.NewRequest("POST", "/api/tenants", strings.NewReader(body)))
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Fatalf("Expected status 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+}
+
+func TestCreateTenantsBatch(t *testing.T) {
+	config := tenantstore.DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&note{}}
+	config.EnableRegistry = true
+
+	store, err := tenantstore.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	app := fiber.New()
+	New(Config{Store: store, Secret: []byte("secret")}).Register(app.Group("/api"))
+
+	body := `{"tenants": [
+		{"schema": "initech", "plan": "pro", "seed": {"notes": [{"id": 1, "body": "hello"}]}},
+		{"schema": "broken", "seed": {"missing_table": [{"id": 1}]}},
+		{"schema": "hooli"}
+	]}`
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/tenants?concurrency=2", strings.NewReader(body)))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d", resp.StatusCode)
+	}
+
+	var report tenantstore.BatchReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	statuses := make([]string, len(report.Results))
+	for i, result := range report.Results {
+		statuses[i] = result.Schema + "=" + result.Status
+	}
+	if got := strings.Join(statuses, ","); got != "initech=created,broken=failed,hooli=created" {
+		t.Fatalf("Unexpected results %s", got)
+	}
+
+	ctx := context.Background()
+	if counts, err := store.RowCounts(ctx, "initech"); err != nil || counts["notes"] != 1 {
+		t.Fatalf("Expected initech seeded, got %v (%v)", counts, err)
+	}
+	if _, err := store.LookupTenant(ctx, "broken"); !errors.Is(err, tenantstore.ErrTenantNotFound) {
+		t.Fatalf("Expected broken to be rolled back, got %v", err)
+	}
+}
+
+func TestSearchTenantsRequests(t *testing.T) {
+	app := fiber.New()
+	New(Config{
+		Store:      &tenantstore.TenantStore{},
+		Secret:     []byte("secret"),
+		Searchable: map[string]interface{}{"notes": &note{}},
+		AuthorizeSearch: func(c *fiber.Ctx) error {
+			if c.Get("X-Role") != "support" {
+				return fiber.ErrForbidden
+			}
+			return nil
+		},
+	}).Register(app.Group("/api"))
+
+	tests := []struct {
+		query, role string
+		status      int
+	}{
+		{"model=notes&column=body&value=hello", "", fiber.StatusForbidden},
+		{"model=users&column=email&value=jane@x.com", "support", fiber.StatusBadRequest},
+		{"model=notes&column=body", "support", fiber.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/tenants/search?"+tt.query, nil)
+		req.Header.Set("X-Role", tt.role)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Fatalf("Expected status %d for %s, got %d", tt.status, tt.query, resp.StatusCode)
+		}
+	}
+
+	// Without searchable models the endpoint does not exist, leaving only
+	// DELETE /tenants/:schema on the path
+	app = fiber.New()
+	newTokenTestAPI().Register(app.Group("/api"))
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/tenants/search?model=notes", nil))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusMethodNotAllowed {
+		t.Fatalf("Expected status 405, got %d", resp.StatusCode)
+	}
+}
+
+func TestSearchTenants(t *testing.T) {
+	config := tenantstore.DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&note{}}
+
+	store, err := tenantstore.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for _, schema := range []string{"initech", "hooli", "globex"} {
+		db, err := store.GetTenantDB(ctx, schema)
+		if err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+		db.Create(&note{Body: "hello from " + schema})
+	}
+
+	app := fiber.New()
+	New(Config{
+		Store:         store,
+		Secret:        []byte("secret"),
+		Searchable:    map[string]interface{}{"notes": &note{}},
+		SearchTimeout: time.Second,
+	}).Register(app.Group("/api"))
+
+	search := func(column, value string) (int, map[string]string) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/tenants/search?model=notes&column="+column+"&value="+value, nil), -1)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		var body map[string]string
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	if status, body := search("body", "hello+from+hooli"); status != fiber.StatusOK || body["tenant"] != "hooli" {
+		t.Fatalf("Expected hooli, got %d %v", status, body)
+	}
+	if status, _ := search("body", "hello"); status != fiber.StatusNotFound {
+		t.Fatalf("Expected 404, got %d", status)
+	}
+	if status, _ := search("secret", "x"); status != fiber.StatusBadRequest {
+		t.Fatalf("Expected 400 for an unknown column, got %d", status)
+	}
+}
+
+func TestWarmStateHandoff(t *testing.T) {
+	// The old process serves its state, the new one imports it
+	old, next := fiber.New(), fiber.New()
+	newTokenTestAPI().Register(old.Group("/api"))
+	newTokenTestAPI().Register(next.Group("/api"))
+
+	resp, err := old.Test(httptest.NewRequest("GET", "/api/warm-state", nil))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	var state struct {
+		Version int               `json:"version"`
+		Tenants []json.RawMessage `json:"tenants"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil || resp.StatusCode != fiber.StatusOK || state.Version != 1 {
+		t.Fatalf("Expected the warm state, got %d %+v (%v)", resp.StatusCode, state, err)
+	}
+
+	body, _ := json.Marshal(state)
+	resp, err = next.Test(httptest.NewRequest("POST", "/api/warm-state", strings.NewReader(string(body))))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", resp.StatusCode)
+	}
+
+	resp, err = next.Test(httptest.NewRequest("POST", "/api/warm-state?warm=true", strings.NewReader(`{"version": 7}`)))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,24 @@
+// Command fmt-tenant manages tenant schemas from the command line.
+//
+// Usage:
+//
+//	fmt-tenant [--dsn DSN] [--output table|json] <command> [arguments]
+//
+// Run fmt-tenant without arguments for the list of commands. The DSN defaults
+// to the DATABASE_URL environment variable.
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantcli"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := tenantcli.Run(ctx, os.Args[1:], tenantcli.Options{})
+	stop()
+	os.Exit(code)
+}
@@ -0,0 +1,49 @@
+// Command tenantsafe-lint reports GetMasterDB calls in packages marked
+// tenant-scoped with //tenantsafe:scoped, where handlers must use the tenant
+// database of the request.
+//
+// Usage:
+//
+//	tenantsafe-lint [packages]
+//
+// Packages are directories, or dir/... for every package below dir, and
+// default to ./... It prints one line per call, like go vet, and exits with
+// 1 when it reported any and 2 when a package could not be parsed.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantsafe/lint"
+)
+
+func main() {
+	patterns := os.Args[1:]
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	dirs, err := lint.Dirs(patterns)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	code := 0
+	for _, dir := range dirs {
+		diagnostics, err := lint.CheckDir(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 2
+			continue
+		}
+		for _, diagnostic := range diagnostics {
+			fmt.Fprintln(os.Stderr, diagnostic)
+			if code == 0 {
+				code = 1
+			}
+		}
+	}
+	os.Exit(code)
+}
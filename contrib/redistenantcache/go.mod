@@ -0,0 +1,11 @@
+module github.com/1Nelsonel/fiber-multitenant/contrib/redistenantcache
+
+go 1.21
+
+require (
+	github.com/1Nelsonel/fiber-multitenant v0.0.0
+	github.com/alicebob/miniredis/v2 v2.31.0
+	github.com/redis/go-redis/v9 v9.3.0
+)
+
+replace github.com/1Nelsonel/fiber-multitenant => ../..
@@ -0,0 +1,97 @@
+// Package redistenantcache implements tenantcache.Cache on Redis, so every
+// replica of an application shares the tenant store's registry cache and
+// sees invalidations at once.
+//
+// It is a separate module, so applications that keep the in-memory cache do
+// not depend on a Redis client.
+//
+// Example usage:
+//
+//	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//
+//	config := tenantstore.DefaultConfig(dsn)
+//	config.EnableRegistry = true
+//	config.Cache = redistenantcache.New(client, redistenantcache.Options{Prefix: "billing"})
+//	store, err := tenantstore.New(config)
+package redistenantcache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantcache"
+)
+
+// Options configures New
+type Options struct {
+	// Optional: Prefix of every key, followed by a colon, to separate
+	// applications sharing a Redis server
+	Prefix string
+}
+
+// Cache is a tenantcache.Cache stored in Redis
+type Cache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+var _ tenantcache.Cache = (*Cache)(nil)
+
+// New returns a cache storing keys in client, which may be a single node,
+// Sentinel or Cluster client
+func New(client redis.UniversalClient, opts ...Options) *Cache {
+	if client == nil {
+		panic("redistenantcache requires a client")
+	}
+	cache := &Cache{client: client}
+	if len(opts) > 0 && opts[0].Prefix != "" {
+		cache.prefix = opts[0].Prefix + ":"
+	}
+	return cache
+}
+
+// Get returns the value of key
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores value under key, without expiry for a TTL of zero or less
+func (c *Cache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	return c.client.Set(ctx, c.prefix+key, value, ttl).Err()
+}
+
+// Delete removes keys. On a Cluster client, keys are deleted one by one, as
+// they may live in different slots.
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefix + key
+	}
+
+	if _, ok := c.client.(*redis.ClusterClient); ok {
+		_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range prefixed {
+				pipe.Del(ctx, key)
+			}
+			return nil
+		})
+		return err
+	}
+	return c.client.Del(ctx, prefixed...).Err()
+}
@@ -0,0 +1,71 @@
+package redistenantcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantcache"
+	"github.com/1Nelsonel/fiber-multitenant/tenantcache/tenantcachetest"
+)
+
+// fastForwardCache expires keys by advancing miniredis' clock
+type fastForwardCache struct {
+	*Cache
+	server *miniredis.Miniredis
+}
+
+func (c fastForwardCache) Advance(d time.Duration) {
+	c.server.FastForward(d)
+}
+
+func newTestCache(t *testing.T, opts ...Options) (*Cache, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client, opts...), server
+}
+
+func TestCache(t *testing.T) {
+	tenantcachetest.Run(t, func(t *testing.T) tenantcache.Cache {
+		cache, server := newTestCache(t)
+		return fastForwardCache{Cache: cache, server: server}
+	})
+}
+
+func TestPrefix(t *testing.T) {
+	ctx := context.Background()
+	cache, server := newTestCache(t, Options{Prefix: "billing"})
+
+	if err := cache.Set(ctx, "mt:registry:acme", []byte("null"), time.Minute); err != nil {
+		t.Fatalf("Failed to set: %v", err)
+	}
+	if !server.Exists("billing:mt:registry:acme") {
+		t.Fatalf("Expected the prefixed key, got %v", server.Keys())
+	}
+	if ttl := server.TTL("billing:mt:registry:acme"); ttl != time.Minute {
+		t.Fatalf("Expected a TTL of a minute, got %v", ttl)
+	}
+
+	if err := cache.Delete(ctx, "mt:registry:acme"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if server.Exists("billing:mt:registry:acme") {
+		t.Fatal("Expected the prefixed key to be deleted")
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	cache, server := newTestCache(t)
+	server.Close()
+
+	// The store treats errors as misses and reads the database
+	if _, ok, err := cache.Get(context.Background(), "acme"); ok || err == nil {
+		t.Fatalf("Expected an error from an unreachable server, got %v (%v)", ok, err)
+	}
+}
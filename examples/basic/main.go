@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"log"
+	"os"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,6 +14,8 @@ import (
 	// Import the fiber-multitenant packages
 	// Replace with actual import path when published
 	"github.com/1Nelsonel/fiber-multitenant/middleware"
+	"github.com/1Nelsonel/fiber-multitenant/query"
+	"github.com/1Nelsonel/fiber-multitenant/tenantctx"
 	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
 )
 
@@ -54,9 +59,22 @@ func main() {
 	}
 	defer store.Close()
 
+	// `go run main.go stats tenant1` prints the stats without the server
+	if len(os.Args) == 3 && os.Args[1] == "stats" {
+		stats, err := PostStats(tenantctx.With(context.Background(), os.Args[2]), store)
+		if err != nil {
+			log.Fatalf("Failed to get stats: %v", err)
+		}
+		json.NewEncoder(os.Stdout).Encode(stats)
+		return
+	}
+
 	// Create Fiber app
+	// Database errors returned by handlers reach clients without table,
+	// constraint or connection details
 	app := fiber.New(fiber.Config{
-		AppName: "Multitenant Demo v1.0",
+		AppName:      "Multitenant Demo v1.0",
+		ErrorHandler: middleware.SanitizeErrors(middleware.DefaultErrorHandler),
 	})
 
 	// Add request logger
@@ -73,7 +91,7 @@ func main() {
 	}))
 
 	// Routes
-	setupRoutes(app)
+	setupRoutes(app, store)
 
 	// Start server
 	log.Println("Starting server on :3000")
@@ -83,7 +101,7 @@ func main() {
 	log.Fatal(app.Listen(":3000"))
 }
 
-func setupRoutes(app *fiber.App) {
+func setupRoutes(app *fiber.App, store *tenantstore.TenantStore) {
 	api := app.Group("/api")
 
 	// User routes
@@ -95,6 +113,14 @@ func setupRoutes(app *fiber.App) {
 
 	// Post routes
 	api.Get("/posts", getPosts)
+	api.Get("/posts/stats", func(c *fiber.Ctx) error {
+		// The middleware put the tenant and its DB on the user context
+		stats, err := PostStats(c.UserContext(), store)
+		if err != nil {
+			return err
+		}
+		return c.JSON(stats)
+	})
 	api.Get("/posts/:id", getPost)
 	api.Post("/posts", createPost)
 	api.Put("/posts/:id", updatePost)
@@ -110,23 +136,46 @@ func setupRoutes(app *fiber.App) {
 	})
 }
 
+// Stats summarizes a tenant's posts
+type Stats struct {
+	Tenant  string `json:"tenant"`
+	Posts   int64  `json:"posts"`
+	Authors int64  `json:"authors"`
+}
+
+// PostStats is service code shared by the HTTP handler and the stats
+// command. It only needs a context carrying the tenant.
+func PostStats(ctx context.Context, store tenantctx.Store) (*Stats, error) {
+	db, err := tenantctx.DB(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+	stats.Tenant, _ = tenantctx.Tenant(ctx)
+	if err := db.Model(&Post{}).Count(&stats.Posts).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&Post{}).Distinct("user_id").Count(&stats.Authors).Error; err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
 // User Handlers
 func getUsers(c *fiber.Ctx) error {
 	db := middleware.GetTenantDB(c)
 
+	// ?page=2&per_page=50&sort=-created_at
 	var users []User
-	result := db.Find(&users)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": result.Error.Error(),
-		})
+	page, err := query.Paginate(c, db, &users,
+		query.Sortable("name", "email", "created_at"),
+		query.DefaultSort("name"))
+	if err != nil {
+		return err
 	}
 
-	return c.JSON(fiber.Map{
-		"tenant": middleware.GetTenant(c),
-		"count":  len(users),
-		"users":  users,
-	})
+	return c.JSON(page)
 }
 
 func getUser(c *fiber.Ctx) error {
@@ -136,9 +185,7 @@ func getUser(c *fiber.Ctx) error {
 	var user User
 	result := db.First(&user, id)
 	if result.Error != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found",
-		})
+		return result.Error
 	}
 
 	return c.JSON(user)
@@ -156,9 +203,7 @@ func createUser(c *fiber.Ctx) error {
 
 	result := db.Create(user)
 	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": result.Error.Error(),
-		})
+		return result.Error
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(user)
@@ -171,9 +216,7 @@ func updateUser(c *fiber.Ctx) error {
 	var user User
 	result := db.First(&user, id)
 	if result.Error != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found",
-		})
+		return result.Error
 	}
 
 	updates := new(User)
@@ -183,7 +226,9 @@ func updateUser(c *fiber.Ctx) error {
 		})
 	}
 
-	db.Model(&user).Updates(updates)
+	if err := db.Model(&user).Updates(updates).Error; err != nil {
+		return err
+	}
 
 	return c.JSON(user)
 }
@@ -194,9 +239,7 @@ func deleteUser(c *fiber.Ctx) error {
 
 	result := db.Delete(&User{}, id)
 	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": result.Error.Error(),
-		})
+		return result.Error
 	}
 
 	if result.RowsAffected == 0 {
@@ -215,9 +258,7 @@ func getPosts(c *fiber.Ctx) error {
 	var posts []Post
 	result := db.Preload("User").Find(&posts)
 	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": result.Error.Error(),
-		})
+		return result.Error
 	}
 
 	return c.JSON(fiber.Map{
@@ -234,9 +275,7 @@ func getPost(c *fiber.Ctx) error {
 	var post Post
 	result := db.Preload("User").First(&post, id)
 	if result.Error != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Post not found",
-		})
+		return result.Error
 	}
 
 	return c.JSON(post)
@@ -254,9 +293,7 @@ func createPost(c *fiber.Ctx) error {
 
 	result := db.Create(post)
 	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": result.Error.Error(),
-		})
+		return result.Error
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(post)
@@ -269,9 +306,7 @@ func updatePost(c *fiber.Ctx) error {
 	var post Post
 	result := db.First(&post, id)
 	if result.Error != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Post not found",
-		})
+		return result.Error
 	}
 
 	updates := new(Post)
@@ -281,7 +316,9 @@ func updatePost(c *fiber.Ctx) error {
 		})
 	}
 
-	db.Model(&post).Updates(updates)
+	if err := db.Model(&post).Updates(updates).Error; err != nil {
+		return err
+	}
 
 	return c.JSON(post)
 }
@@ -292,9 +329,7 @@ func deletePost(c *fiber.Ctx) error {
 
 	result := db.Delete(&Post{}, id)
 	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": result.Error.Error(),
-		})
+		return result.Error
 	}
 
 	if result.RowsAffected == 0 {
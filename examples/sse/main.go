@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+// Order model - will be created in each tenant's schema
+type Order struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Total     float64   `json:"total"`
+}
+
+// dashboard is the payload of each streamed event
+type dashboard struct {
+	Orders  int64     `json:"orders"`
+	Revenue float64   `json:"revenue"`
+	At      time.Time `json:"at"`
+}
+
+func main() {
+	// Update this DSN with your PostgreSQL credentials
+	dsn := "host=localhost user=postgres password=postgres dbname=multitenant_demo port=5432 sslmode=disable"
+
+	config := tenantstore.DefaultConfig(dsn)
+	config.AutoMigrate = true
+	config.Models = []interface{}{&Order{}}
+
+	store, err := tenantstore.New(config)
+	if err != nil {
+		log.Fatalf("Failed to create tenant store: %v", err)
+	}
+	defer store.Close()
+
+	app := fiber.New()
+	app.Use(middleware.New(middleware.Config{
+		Store:    store,
+		Resolver: middleware.HeaderResolver("X-Tenant-ID"),
+	}))
+
+	app.Post("/orders", func(c *fiber.Ctx) error {
+		order := new(Order)
+		if err := c.BodyParser(order); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+		if err := middleware.GetTenantDB(c).Create(order).Error; err != nil {
+			return err
+		}
+		return c.Status(fiber.StatusCreated).JSON(order)
+	})
+
+	// Streams the tenant's order totals every two seconds
+	app.Get("/dashboard/stream", func(c *fiber.Ctx) error {
+		// Resolve the session now: c is reused once the handler returns,
+		// while the stream writer below keeps running
+		db, release := middleware.LongLivedDB(c, store)
+		if db == nil {
+			return fiber.NewError(fiber.StatusServiceUnavailable, "Tenant database unavailable")
+		}
+
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set(fiber.HeaderConnection, "keep-alive")
+
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			defer release()
+
+			ticker := time.NewTicker(2 * time.Second)
+			defer ticker.Stop()
+
+			for {
+				var snapshot dashboard
+				err := db.Model(&Order{}).
+					Select("COUNT(*) AS orders, COALESCE(SUM(total), 0) AS revenue").
+					Scan(&snapshot).Error
+				if err != nil {
+					log.Printf("Dashboard query failed: %v", err)
+					return
+				}
+				snapshot.At = time.Now()
+
+				data, _ := json.Marshal(snapshot)
+				fmt.Fprintf(w, "data: %s\n\n", data)
+
+				// Flush fails once the client has disconnected
+				if err := w.Flush(); err != nil {
+					return
+				}
+				<-ticker.C
+			}
+		})
+		return nil
+	})
+
+	log.Println("Server starting on :3000")
+	log.Println("Stream:       curl -N -H 'X-Tenant-ID: acme' localhost:3000/dashboard/stream")
+	log.Println("Create order: curl -H 'X-Tenant-ID: acme' -H 'Content-Type: application/json' -d '{\"total\": 42}' localhost:3000/orders")
+	log.Fatal(app.Listen(":3000"))
+}
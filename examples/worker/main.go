@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/worker"
+)
+
+// Payment model - will be created in each tenant's schema
+type Payment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	EventID   string    `gorm:"uniqueIndex" json:"event_id"`
+	Amount    int64     `json:"amount"`
+	Currency  string    `json:"currency"`
+}
+
+// Job is a unit of work received from a queue, e.g. a webhook event
+type Job struct {
+	Tenant  string
+	Payload []byte
+}
+
+// webhookEvent is the payload of a payment webhook
+type webhookEvent struct {
+	ID       string `json:"id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func main() {
+	// Update this DSN with your PostgreSQL credentials
+	dsn := "host=localhost user=postgres password=postgres dbname=multitenant_demo port=5432 sslmode=disable"
+
+	config := tenantstore.DefaultConfig(dsn)
+	config.AutoMigrate = true
+	config.Models = []interface{}{&Payment{}}
+
+	store, err := tenantstore.New(config)
+	if err != nil {
+		log.Fatalf("Failed to create tenant store: %v", err)
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// In production jobs come from a queue consumer; here we enqueue a few
+	jobs := make(chan Job)
+	go func() {
+		defer close(jobs)
+		for _, job := range []Job{
+			{Tenant: "acme", Payload: []byte(`{"id":"evt_1","amount":2500,"currency":"usd"}`)},
+			{Tenant: "globex", Payload: []byte(`{"id":"evt_2","amount":990,"currency":"eur"}`)},
+			{Tenant: "acme", Payload: []byte(`not json`)},
+		} {
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Consume jobs, each inside its tenant's schema
+	for job := range jobs {
+		err := worker.Run(ctx, store, job.Tenant, func(ctx context.Context, db *gorm.DB) error {
+			return handlePayment(db, job.Payload)
+		})
+
+		var tenantErr *worker.TenantError
+		switch {
+		case err == nil:
+			log.Printf("Processed job for %s", job.Tenant)
+		case worker.IsPermanent(err):
+			log.Printf("Dropping job for %s: %v", job.Tenant, err)
+		case errors.As(err, &tenantErr):
+			log.Printf("Job for %s failed after %d attempts: %v", tenantErr.Tenant, tenantErr.Attempts, tenantErr.Err)
+		}
+	}
+
+	// Nightly-style job across every tenant
+	err = worker.FanOut(ctx, store, func(ctx context.Context, db *gorm.DB) error {
+		var total int64
+		if err := db.Model(&Payment{}).Select("COALESCE(SUM(amount), 0)").Scan(&total).Error; err != nil {
+			return err
+		}
+		log.Printf("Tenant %s has processed %d in payments", worker.Tenant(ctx), total)
+		return nil
+	}, worker.FanOutOptions{Concurrency: 4, ContinueOnError: true})
+	if err != nil {
+		log.Printf("Report failed for some tenants: %v", err)
+	}
+}
+
+// handlePayment stores a payment webhook. Malformed payloads are permanent
+// failures and are not retried.
+func handlePayment(db *gorm.DB, payload []byte) error {
+	var event webhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return worker.Permanent(err)
+	}
+
+	return db.Where(Payment{EventID: event.ID}).
+		Attrs(Payment{Amount: event.Amount, Currency: event.Currency}).
+		FirstOrCreate(&Payment{}).Error
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+func TestEnforceActive(t *testing.T) {
+	store := &countingTenantStore{Store: tenanttest.NewStore(t)}
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:          store,
+		Resolver:       HeaderResolver("X-Tenant-ID"),
+		EnforceActive:  true,
+		InactiveStatus: fiber.StatusGone,
+	}))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+
+	request := func() int {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("X-Tenant-ID", "tenant1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	store.Deactivate("tenant1")
+	if status := request(); status != fiber.StatusGone {
+		t.Fatalf("Expected status 410 for inactive tenant, got %d", status)
+	}
+	if store.calls != 0 {
+		t.Fatalf("Expected store not to be called for inactive tenant, got %d calls", store.calls)
+	}
+
+	store.Activate("tenant1")
+	if status := request(); status != fiber.StatusOK {
+		t.Fatalf("Expected status 200 after reactivation, got %d", status)
+	}
+}
+
+func TestEnforceActiveRequiresChecker(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected panic when the store cannot report tenant activity")
+		}
+	}()
+
+	New(Config{
+		Store:         struct{ TenantStore }{tenanttest.NewStore(t)},
+		EnforceActive: true,
+	})
+}
+
+// environmentStore maps tenant IDs to schemas of a staging environment, as
+// tenantstore.TenantStore does with Config.Environment set
+type environmentStore struct {
+	*tenanttest.Store
+}
+
+func (s environmentStore) SchemaName(tenant string) (string, error) {
+	return tenant + "__staging", nil
+}
+
+func TestEnforceActiveLooksUpSchema(t *testing.T) {
+	store := environmentStore{tenanttest.NewStore(t)}
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:         store,
+		Resolver:      HeaderResolver("X-Tenant-ID"),
+		EnforceActive: true,
+	}))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+
+	request := func() int {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("X-Tenant-ID", "acme")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	store.Deactivate("acme")
+	if status := request(); status != fiber.StatusOK {
+		t.Fatalf("Expected the tenant ID not to be looked up, got %d", status)
+	}
+	store.Deactivate("acme__staging")
+	if status := request(); status != fiber.StatusForbidden {
+		t.Fatalf("Expected status 403 for an inactive schema, got %d", status)
+	}
+}
+
+func TestEnforceActiveWithEnvironment(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	config := tenantstore.DefaultConfig(dsn)
+	config.EnableRegistry = true
+	config.Environment = "staging"
+	store, err := tenantstore.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	tenant := fmt.Sprintf("env_active_%d", time.Now().UnixNano())
+	schema, err := store.SchemaName(tenant)
+	if err != nil {
+		t.Fatalf("Failed to map tenant: %v", err)
+	}
+	if err := store.RegisterTenant(ctx, &tenantstore.Tenant{Schema: schema, Name: tenant, Active: true, Settings: tenantstore.TenantSettings{"feature.beta": "true"}}); err != nil {
+		t.Fatalf("Failed to register tenant: %v", err)
+	}
+	defer store.DropTenant(ctx, schema, tenantstore.DropOptions{Cascade: true})
+	defer store.GetMasterDB().Where("schema = ?", schema).Delete(&tenantstore.Tenant{})
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:         store,
+		Resolver:      HeaderResolver("X-Tenant-ID"),
+		EnforceActive: true,
+		Features:      NewSettingsFeatureProvider(SettingsFeatureConfig{Settings: store}),
+	}))
+	app.Get("/test", RequireFeature("beta"), func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-Tenant-ID", tenant)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200 for a registered tenant in %s, got %d", schema, resp.StatusCode)
+	}
+}
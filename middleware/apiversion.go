@@ -0,0 +1,272 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultVersionHeader is the request header clients choose an older API
+// version with
+const DefaultVersionHeader = "Accept-Version"
+
+// DefaultVersionCacheTTL is how long APIVersion caches a tenant's pinned
+// version when CacheTTL is zero
+const DefaultVersionCacheTTL = 30 * time.Second
+
+var (
+	errVersionUnavailable = fiber.NewError(fiber.StatusServiceUnavailable, "API version unavailable")
+	errVersionInvalid     = fiber.NewError(fiber.StatusBadRequest, "Accept-Version is not a valid version")
+	errVersionTooNew      = fiber.NewError(fiber.StatusBadRequest, "Accept-Version is newer than the tenant's API version")
+)
+
+type apiVersionKey struct{}
+
+// APIVersionConfig configures APIVersion
+type APIVersionConfig struct {
+	// Optional: Version of tenants without a pinned version. Without it
+	// they get no version and fail every RequireVersion.
+	Default string
+
+	// Optional: Request header clients choose a version with (defaults to
+	// DefaultVersionHeader)
+	Header string
+
+	// Optional: How long pinned versions are cached per tenant (defaults to
+	// DefaultVersionCacheTTL, negative disables the cache)
+	CacheTTL time.Duration
+
+	// Optional: Locals key the tenant middleware stores the tenant under
+	ContextKey string
+}
+
+// APIVersion resolves the API version of each request from the version the
+// tenant is pinned to, such as tenantstore.TenantStore.TenantAPIVersion.
+// Clients may ask for an older version with the Accept-Version header;
+// versions newer than the pinned one, or that do not parse, get 400.
+// Handlers read the version with GetAPIVersion and routes are limited to
+// versions with RequireVersion. Pinned versions are cached, so a tenant
+// moved to a new version gets it within CacheTTL. Mount it after New;
+// requests without a tenant pass through.
+//
+//	app.Use(middleware.New(cfg), middleware.APIVersion(store.TenantAPIVersion))
+//	app.Get("/invoices", middleware.RequireVersion(">=2"), listInvoicesV2)
+func APIVersion(versionFor func(ctx context.Context, tenant string) (string, error), config ...APIVersionConfig) fiber.Handler {
+	if versionFor == nil {
+		panic("APIVersion requires versionFor")
+	}
+	var cfg APIVersionConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Header == "" {
+		cfg.Header = DefaultVersionHeader
+	}
+	if cfg.CacheTTL == 0 {
+		cfg.CacheTTL = DefaultVersionCacheTTL
+	}
+	if cfg.Default != "" {
+		if _, err := parseVersion(cfg.Default); err != nil {
+			panic(fmt.Sprintf("APIVersion: invalid default version: %v", err))
+		}
+	}
+
+	versions := &versionCache{ttl: cfg.CacheTTL, entries: make(map[string]versionCacheEntry)}
+
+	return func(c *fiber.Ctx) error {
+		tenant := GetTenant(c, cfg.ContextKey)
+		if tenant == "" {
+			return c.Next()
+		}
+
+		pinned, ok := versions.get(tenant)
+		if !ok {
+			version, err := versionFor(c.UserContext(), tenant)
+			if err != nil {
+				return errVersionUnavailable
+			}
+			if version == "" {
+				version = cfg.Default
+			}
+			if version != "" {
+				if pinned, err = parseVersion(version); err != nil {
+					return errVersionUnavailable
+				}
+			}
+			versions.set(tenant, pinned)
+		}
+		if pinned.raw == "" {
+			return c.Next()
+		}
+
+		version := pinned
+		if requested := c.Get(cfg.Header); requested != "" {
+			v, err := parseVersion(strings.Clone(requested))
+			if err != nil {
+				return errVersionInvalid
+			}
+			if v.compare(pinned) > 0 {
+				return errVersionTooNew
+			}
+			version = v
+		}
+
+		c.Locals(apiVersionKey{}, version)
+		return c.Next()
+	}
+}
+
+// GetAPIVersion returns the API version APIVersion resolved for the request,
+// as the tenant's pinned version or the client's Accept-Version, or "" when
+// there is none
+func GetAPIVersion(c *fiber.Ctx) string {
+	version, _ := c.Locals(apiVersionKey{}).(apiVersion)
+	return version.raw
+}
+
+// RequireVersion returns a handler that responds 404 to requests whose API
+// version does not satisfy every constraint, as if the route did not exist.
+// Constraints are a version after one of the operators >=, >, <=, <, = or
+// none, which means =, such as ">=2" or "<2.1". Versions are compared as
+// semantic versions, with missing minor and patch numbers read as 0. It
+// panics on constraints that do not parse.
+//
+//	app.Get("/reports", middleware.RequireVersion(">=2", "<3"), reportsV2)
+func RequireVersion(constraints ...string) fiber.Handler {
+	parsed := make([]versionConstraint, len(constraints))
+	for i, constraint := range constraints {
+		var err error
+		if parsed[i], err = parseConstraint(constraint); err != nil {
+			panic(fmt.Sprintf("RequireVersion: %v", err))
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		version, ok := c.Locals(apiVersionKey{}).(apiVersion)
+		if !ok {
+			return fiber.ErrNotFound
+		}
+		for _, constraint := range parsed {
+			if !constraint.allows(version) {
+				return fiber.ErrNotFound
+			}
+		}
+		return c.Next()
+	}
+}
+
+// apiVersion is a parsed major.minor.patch version, keeping the text it was
+// parsed from
+type apiVersion struct {
+	raw   string
+	parts [3]int
+}
+
+// parseVersion parses versions such as "2", "2.1" or "v2.1.3"
+func parseVersion(s string) (apiVersion, error) {
+	version := apiVersion{raw: s}
+	fields := strings.Split(strings.TrimPrefix(strings.TrimSpace(s), "v"), ".")
+	if len(fields) > len(version.parts) {
+		return version, fmt.Errorf("invalid version %q", s)
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return version, fmt.Errorf("invalid version %q", s)
+		}
+		version.parts[i] = n
+	}
+	return version, nil
+}
+
+func (v apiVersion) compare(other apiVersion) int {
+	for i := range v.parts {
+		if v.parts[i] != other.parts[i] {
+			if v.parts[i] < other.parts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+type versionConstraint struct {
+	op      string
+	version apiVersion
+}
+
+func parseConstraint(s string) (versionConstraint, error) {
+	s = strings.TrimSpace(s)
+	op := "="
+	for _, candidate := range []string{">=", "<=", "==", ">", "<", "="} {
+		if strings.HasPrefix(s, candidate) {
+			op = candidate
+			s = s[len(candidate):]
+			break
+		}
+	}
+	version, err := parseVersion(s)
+	return versionConstraint{op: op, version: version}, err
+}
+
+func (c versionConstraint) allows(v apiVersion) bool {
+	cmp := v.compare(c.version)
+	switch c.op {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	default:
+		return cmp == 0
+	}
+}
+
+// versionCache keeps the pinned version of each tenant, including tenants
+// without one, for a TTL
+type versionCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]versionCacheEntry
+}
+
+type versionCacheEntry struct {
+	version apiVersion
+	expires time.Time
+}
+
+func (vc *versionCache) get(tenant string) (apiVersion, bool) {
+	if vc.ttl <= 0 {
+		return apiVersion{}, false
+	}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	entry, ok := vc.entries[tenant]
+	if !ok || time.Now().After(entry.expires) {
+		return apiVersion{}, false
+	}
+	return entry.version, true
+}
+
+func (vc *versionCache) set(tenant string, version apiVersion) {
+	if vc.ttl <= 0 {
+		return
+	}
+
+	// Tenants resolved from requests point into reused buffers
+	vc.mu.Lock()
+	vc.entries[strings.Clone(tenant)] = versionCacheEntry{version: version, expires: time.Now().Add(vc.ttl)}
+	vc.mu.Unlock()
+}
@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+// pinnedVersions is a registry of pinned versions
+type pinnedVersions struct {
+	mu       sync.Mutex
+	versions map[string]string
+	lookups  int
+}
+
+func (p *pinnedVersions) versionFor(ctx context.Context, tenant string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lookups++
+	if tenant == "broken" {
+		return "", errors.New("registry down")
+	}
+	return p.versions[tenant], nil
+}
+
+func (p *pinnedVersions) set(tenant, version string) {
+	p.mu.Lock()
+	p.versions[tenant] = version
+	p.mu.Unlock()
+}
+
+func newVersionApp(t *testing.T, registry *pinnedVersions, config ...APIVersionConfig) *fiber.App {
+	t.Helper()
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:    tenanttest.NewStore(t),
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+	app.Use(APIVersion(registry.versionFor, config...))
+	app.Get("/version", func(c *fiber.Ctx) error {
+		return c.SendString(GetAPIVersion(c))
+	})
+	app.Get("/reports", RequireVersion(">=2", "<3"), func(c *fiber.Ctx) error {
+		return c.SendString("reports")
+	})
+	return app
+}
+
+func requestVersion(t *testing.T, app *fiber.App, path, tenant, accept string) (int, string) {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("X-Tenant-ID", tenant)
+	if accept != "" {
+		req.Header.Set(DefaultVersionHeader, accept)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestAPIVersionHeaderOverride(t *testing.T) {
+	registry := &pinnedVersions{versions: map[string]string{"tenant_a": "2.1"}}
+	app := newVersionApp(t, registry)
+
+	tests := []struct {
+		accept string
+		status int
+		body   string
+	}{
+		{"", fiber.StatusOK, "2.1"},
+		{"1", fiber.StatusOK, "1"},
+		{"2.1.0", fiber.StatusOK, "2.1.0"},
+		{"v2", fiber.StatusOK, "v2"},
+		{"2.2", fiber.StatusBadRequest, ""},
+		{"3", fiber.StatusBadRequest, ""},
+		{"two", fiber.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		status, body := requestVersion(t, app, "/version", "tenant_a", tt.accept)
+		if status != tt.status || (tt.status == fiber.StatusOK && body != tt.body) {
+			t.Fatalf("Accept-Version %q: expected %d %q, got %d %q", tt.accept, tt.status, tt.body, status, body)
+		}
+	}
+
+	if status, _ := requestVersion(t, app, "/version", "broken", ""); status != fiber.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 when the version cannot be read, got %d", status)
+	}
+}
+
+func TestAPIVersionDefaultAndCache(t *testing.T) {
+	registry := &pinnedVersions{versions: map[string]string{}}
+	app := newVersionApp(t, registry, APIVersionConfig{Default: "1", CacheTTL: 50 * time.Millisecond})
+
+	if _, body := requestVersion(t, app, "/version", "tenant_a", ""); body != "1" {
+		t.Fatalf("Expected the default version, got %q", body)
+	}
+
+	// Bumps take effect once the cached version expires
+	registry.set("tenant_a", "2")
+	if _, body := requestVersion(t, app, "/version", "tenant_a", ""); body != "1" {
+		t.Fatalf("Expected the cached version, got %q", body)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, body := requestVersion(t, app, "/version", "tenant_a", ""); body != "2" {
+		t.Fatalf("Expected the bumped version, got %q", body)
+	}
+	if registry.lookups != 2 {
+		t.Fatalf("Expected 2 lookups, got %d", registry.lookups)
+	}
+}
+
+func TestRequireVersion(t *testing.T) {
+	registry := &pinnedVersions{versions: map[string]string{"tenant_a": "2.4", "tenant_b": "1.9", "tenant_c": "3"}}
+	app := newVersionApp(t, registry)
+
+	tests := []struct {
+		tenant, accept string
+		status         int
+	}{
+		{"tenant_a", "", fiber.StatusOK},
+		{"tenant_a", "1.9", fiber.StatusNotFound},
+		{"tenant_b", "", fiber.StatusNotFound},
+		{"tenant_c", "", fiber.StatusNotFound},
+		{"tenant_c", "2.10", fiber.StatusOK},
+		{"tenant_d", "", fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if status, _ := requestVersion(t, app, "/reports", tt.tenant, tt.accept); status != tt.status {
+			t.Fatalf("%s with Accept-Version %q: expected %d, got %d", tt.tenant, tt.accept, tt.status, status)
+		}
+	}
+}
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		constraint, version string
+		allowed             bool
+	}{
+		{">=2", "2.0.0", true},
+		{">=2", "1.99", false},
+		{">2", "2.0.1", true},
+		{"<2.1", "2.0.9", true},
+		{"<=2.1", "2.1", true},
+		{"2", "2.0", true},
+		{"==2", "2.1", false},
+		{"=1.2.3", "v1.2.3", true},
+	}
+	for _, tt := range tests {
+		constraint, err := parseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.constraint, err)
+		}
+		version, err := parseVersion(tt.version)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.version, err)
+		}
+		if constraint.allows(version) != tt.allowed {
+			t.Fatalf("Expected %q allows %q to be %v", tt.constraint, tt.version, tt.allowed)
+		}
+	}
+
+	for _, invalid := range []string{">=", "~2", "2.x", "1.2.3.4"} {
+		if _, err := parseConstraint(invalid); err == nil {
+			t.Fatalf("Expected error for %q", invalid)
+		}
+	}
+}
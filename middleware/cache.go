@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// UntenantedCacheKey prefixes cache keys for requests without a resolved tenant
+const UntenantedCacheKey = "_untenanted"
+
+// CacheTenantHeader is the response header TenantCacheGuard uses to record
+// which tenant a cached response belongs to
+const CacheTenantHeader = "X-Cache-Tenant"
+
+// TenantCacheKeyGenerator returns a key generator for Fiber's cache
+// middleware (cache.Config.KeyGenerator) that prefixes the request path with
+// the resolved tenant, so tenants never share cache entries.
+func TenantCacheKeyGenerator(contextKey ...string) func(*fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		tenant := GetTenant(c, contextKey...)
+		if tenant == "" {
+			tenant = UntenantedCacheKey
+		}
+		return tenant + ":" + utils.CopyString(c.Path())
+	}
+}
+
+// TenantCacheGuard refuses to serve cached responses that were stored for a
+// different tenant. Register it after the tenant middleware and before Fiber's
+// cache middleware, and enable cache.Config.StoreResponseHeaders so the
+// recorded tenant is cached together with the response.
+func TenantCacheGuard(contextKey ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tenant := GetTenant(c, contextKey...)
+		if tenant == "" {
+			tenant = UntenantedCacheKey
+		}
+
+		// Cache misses store this header; cache hits overwrite it with the
+		// value recorded when the response was cached
+		c.Set(CacheTenantHeader, tenant)
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		stored := string(c.Response().Header.Peek(CacheTenantHeader))
+		c.Response().Header.Del(CacheTenantHeader)
+
+		if stored != tenant {
+			c.Response().ResetBody()
+			return fiber.NewError(fiber.StatusInternalServerError, "Cached response belongs to another tenant")
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cache"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+// newCacheTestApp returns an app whose /profile body names the tenant and
+// counts handler executions
+func newCacheTestApp(t *testing.T, cacheConfig cache.Config) (*fiber.App, *int) {
+	calls := 0
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:    tenanttest.NewStore(t),
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+	app.Use(TenantCacheGuard())
+	app.Use(cache.New(cacheConfig))
+
+	app.Get("/profile", func(c *fiber.Ctx) error {
+		calls++
+		return c.SendString("profile of " + GetTenant(c))
+	})
+
+	return app, &calls
+}
+
+func getCacheTestProfile(t *testing.T, app *fiber.App, tenant string) (int, string) {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/profile", nil)
+	req.Header.Set("X-Tenant-ID", tenant)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+
+	if resp.Header.Get(CacheTenantHeader) != "" {
+		t.Fatal("Expected internal cache tenant header to be stripped")
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestTenantCacheKeyGenerator(t *testing.T) {
+	app, calls := newCacheTestApp(t, cache.Config{
+		Expiration:           time.Minute,
+		KeyGenerator:         TenantCacheKeyGenerator(),
+		StoreResponseHeaders: true,
+	})
+
+	if _, body := getCacheTestProfile(t, app, "tenantA"); body != "profile of tenantA" {
+		t.Fatalf("Unexpected body for tenantA: %s", body)
+	}
+
+	// Tenant B must not receive tenant A's cached body
+	if _, body := getCacheTestProfile(t, app, "tenantB"); body != "profile of tenantB" {
+		t.Fatalf("Expected tenantB's own body, got: %s", body)
+	}
+
+	// Tenant A is served from its own cache entry
+	if _, body := getCacheTestProfile(t, app, "tenantA"); body != "profile of tenantA" {
+		t.Fatalf("Unexpected cached body for tenantA: %s", body)
+	}
+
+	if *calls != 2 {
+		t.Fatalf("Expected 2 handler executions, got %d", *calls)
+	}
+}
+
+func TestTenantCacheKeyGeneratorUntenanted(t *testing.T) {
+	app := fiber.New()
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString(TenantCacheKeyGenerator()(c))
+	})
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/test", nil))
+	body, _ := io.ReadAll(resp.Body)
+
+	if string(body) != UntenantedCacheKey+":/test" {
+		t.Fatalf("Expected untenanted key, got '%s'", string(body))
+	}
+}
+
+func TestTenantCacheGuardBlocksPoisonedEntry(t *testing.T) {
+	// Path-only keys share entries across tenants
+	app, _ := newCacheTestApp(t, cache.Config{
+		Expiration:           time.Minute,
+		StoreResponseHeaders: true,
+	})
+
+	if status, _ := getCacheTestProfile(t, app, "tenantA"); status != fiber.StatusOK {
+		t.Fatalf("Expected status 200 for tenantA, got %d", status)
+	}
+
+	status, body := getCacheTestProfile(t, app, "tenantB")
+	if status != fiber.StatusInternalServerError {
+		t.Fatalf("Expected guard to reject poisoned entry, got %d", status)
+	}
+
+	if body == "profile of tenantA" {
+		t.Fatal("Tenant A's cached body was served to tenant B")
+	}
+}
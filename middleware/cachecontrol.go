@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultCacheVary is the request header CacheControl adds to Vary unless
+// CacheControlConfig overrides it
+const DefaultCacheVary = "X-Tenant-ID"
+
+// SurrogateKeyHeader lists the purge keys of a response for CDNs such as
+// Fastly
+const SurrogateKeyHeader = "Surrogate-Key"
+
+// DefaultCacheSettingPrefix prefixes the tenant settings read by
+// SettingsCachePolicy, as in "cache.max_age"
+const DefaultCacheSettingPrefix = "cache."
+
+// DefaultCachePolicyTTL is how long SettingsCachePolicy caches a tenant's
+// policy when CacheTTL is zero
+const DefaultCachePolicyTTL = 30 * time.Second
+
+// CachePolicy is how browsers and CDNs may cache a tenant's responses. The
+// zero value lets them store responses but revalidate each use.
+type CachePolicy struct {
+	// NoStore forbids caching entirely; the other fields are ignored
+	NoStore bool
+
+	// Private keeps responses out of shared caches such as CDNs
+	Private bool
+
+	// MaxAge is how long responses are fresh, SharedMaxAge overrides it for
+	// shared caches
+	MaxAge       time.Duration
+	SharedMaxAge time.Duration
+
+	// StaleWhileRevalidate is how long stale responses may be served while
+	// the cache refetches them
+	StaleWhileRevalidate time.Duration
+}
+
+// String returns the policy as a Cache-Control value
+func (p CachePolicy) String() string {
+	if p.NoStore {
+		return "no-store"
+	}
+
+	directives := []string{"public"}
+	if p.Private {
+		directives[0] = "private"
+	}
+	if p.MaxAge <= 0 && (p.Private || p.SharedMaxAge <= 0) {
+		return strings.Join(append(directives, "no-cache"), ", ")
+	}
+	directives = append(directives, "max-age="+seconds(p.MaxAge))
+	if !p.Private && p.SharedMaxAge > 0 {
+		directives = append(directives, "s-maxage="+seconds(p.SharedMaxAge))
+	}
+	if p.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+seconds(p.StaleWhileRevalidate))
+	}
+	return strings.Join(directives, ", ")
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(max(d, 0)/time.Second), 10)
+}
+
+// CacheControlConfig configures CacheControl
+type CacheControlConfig struct {
+	// Optional: Request headers the tenant is resolved from, added to Vary
+	// (defaults to DefaultCacheVary). Use "Host" with SubdomainResolver.
+	Vary []string
+}
+
+// CacheControl returns middleware setting the caching headers of tenant
+// responses from policyFor: Cache-Control from the tenant's policy, Vary on
+// the headers the tenant is resolved from and a Surrogate-Key of
+// PurgeKeyFor(tenant, "") for CDN purges. Vary is set on every response, so
+// a CDN never serves one tenant's response to another. Error responses get
+// no-store, and handlers that set Cache-Control themselves keep it. Mount it
+// after New; policyFor runs after the handler and may be a
+// SettingsCachePolicy's PolicyFor.
+//
+//	policies := middleware.NewSettingsCachePolicy(middleware.SettingsCachePolicyConfig{Settings: store})
+//	app.Use(middleware.New(cfg), middleware.CacheControl(policies.PolicyFor))
+func CacheControl(policyFor func(ctx context.Context, tenant string) CachePolicy, config ...CacheControlConfig) fiber.Handler {
+	if policyFor == nil {
+		panic("CacheControl requires policyFor")
+	}
+	var cfg CacheControlConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if len(cfg.Vary) == 0 {
+		cfg.Vary = []string{DefaultCacheVary}
+	}
+
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		c.Vary(cfg.Vary...)
+
+		tenant := GetTenant(c)
+		if tenant == "" {
+			return err
+		}
+		appendSurrogateKey(c, PurgeKeyFor(tenant, ""))
+
+		if len(c.Response().Header.Peek(fiber.HeaderCacheControl)) > 0 {
+			return err
+		}
+		if err != nil || c.Response().StatusCode() >= fiber.StatusBadRequest {
+			c.Set(fiber.HeaderCacheControl, "no-store")
+			return err
+		}
+		c.Set(fiber.HeaderCacheControl, policyFor(c.UserContext(), tenant).String())
+		return nil
+	}
+}
+
+// PurgeKeyFor returns the surrogate key of a tenant's resource, such as
+// "tenant-acme-products", or of all the tenant's responses for an empty
+// resource. Purge it at the CDN after changing the resource. Characters
+// other than letters, digits, '_' and '.' are escaped, so keys of
+// different tenants never collide.
+func PurgeKeyFor(tenant, resource string) string {
+	key := "tenant-" + escapeSurrogateKey(tenant)
+	if resource != "" {
+		key += "-" + escapeSurrogateKey(resource)
+	}
+	return key
+}
+
+// AddSurrogateKey tags the response with PurgeKeyFor the request's tenant
+// and the resource, so purging that key drops it from the CDN
+func AddSurrogateKey(c *fiber.Ctx, resource string) {
+	if tenant := GetTenant(c); tenant != "" {
+		appendSurrogateKey(c, PurgeKeyFor(tenant, resource))
+	}
+}
+
+// appendSurrogateKey adds the key to the space-separated Surrogate-Key
+// header unless it is there
+func appendSurrogateKey(c *fiber.Ctx, key string) {
+	keys := string(c.Response().Header.Peek(SurrogateKeyHeader))
+	for _, existing := range strings.Fields(keys) {
+		if existing == key {
+			return
+		}
+	}
+	if keys != "" {
+		key = keys + " " + key
+	}
+	c.Set(SurrogateKeyHeader, key)
+}
+
+func escapeSurrogateKey(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '_', ch == '.':
+			b.WriteByte(ch)
+		default:
+			// '-' separates the tenant from the resource
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// SettingsCachePolicyConfig configures NewSettingsCachePolicy
+type SettingsCachePolicyConfig struct {
+	// Settings returns the tenant settings policies are read from
+	// (required). A SchemaNamer is asked with the tenant's schema.
+	Settings TenantSettingsSource
+
+	// Optional: Prefix of the settings (defaults to
+	// DefaultCacheSettingPrefix)
+	Prefix string
+
+	// Optional: Policy of tenants without settings
+	Default CachePolicy
+
+	// Optional: How long policies are cached per tenant (defaults to
+	// DefaultCachePolicyTTL, negative disables the cache)
+	CacheTTL time.Duration
+}
+
+// SettingsCachePolicy reads cache policies from tenant settings named Prefix
+// plus no_store and private, parsed with strconv.ParseBool, and max_age,
+// s_maxage and stale_while_revalidate, parsed with time.ParseDuration.
+// Settings that are missing or do not parse keep the default's value.
+// Tenants whose settings cannot be read get no-store.
+type SettingsCachePolicy struct {
+	cfg SettingsCachePolicyConfig
+
+	mu    sync.Mutex
+	cache map[string]cachePolicyEntry
+}
+
+type cachePolicyEntry struct {
+	policy  CachePolicy
+	expires time.Time
+}
+
+// NewSettingsCachePolicy returns a policy source for cfg
+func NewSettingsCachePolicy(cfg SettingsCachePolicyConfig) *SettingsCachePolicy {
+	if cfg.Settings == nil {
+		panic("SettingsCachePolicy requires Settings")
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultCacheSettingPrefix
+	}
+	if cfg.CacheTTL == 0 {
+		cfg.CacheTTL = DefaultCachePolicyTTL
+	}
+	return &SettingsCachePolicy{cfg: cfg, cache: make(map[string]cachePolicyEntry)}
+}
+
+// PolicyFor returns the tenant's policy
+func (p *SettingsCachePolicy) PolicyFor(ctx context.Context, tenant string) CachePolicy {
+	if p.cfg.CacheTTL > 0 {
+		p.mu.Lock()
+		entry, ok := p.cache[tenant]
+		p.mu.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.policy
+		}
+	}
+
+	schema, err := schemaFor(p.cfg.Settings, tenant)
+	if err != nil {
+		return CachePolicy{NoStore: true}
+	}
+	settings, err := p.cfg.Settings.TenantSettings(ctx, schema)
+	if err != nil {
+		return CachePolicy{NoStore: true}
+	}
+
+	policy := p.cfg.Default
+	setBool := func(name string, field *bool) {
+		if v, err := strconv.ParseBool(settings[p.cfg.Prefix+name]); err == nil {
+			*field = v
+		}
+	}
+	setDuration := func(name string, field *time.Duration) {
+		if v, err := time.ParseDuration(settings[p.cfg.Prefix+name]); err == nil && v >= 0 {
+			*field = v
+		}
+	}
+	setBool("no_store", &policy.NoStore)
+	setBool("private", &policy.Private)
+	setDuration("max_age", &policy.MaxAge)
+	setDuration("s_maxage", &policy.SharedMaxAge)
+	setDuration("stale_while_revalidate", &policy.StaleWhileRevalidate)
+
+	if p.cfg.CacheTTL > 0 {
+		// Tenants resolved from requests point into reused buffers
+		p.mu.Lock()
+		p.cache[strings.Clone(tenant)] = cachePolicyEntry{policy: policy, expires: time.Now().Add(p.cfg.CacheTTL)}
+		p.mu.Unlock()
+	}
+	return policy
+}
+
+// Invalidate drops the tenant's cached policy, such as after its settings
+// changed
+func (p *SettingsCachePolicy) Invalidate(tenant string) {
+	p.mu.Lock()
+	delete(p.cache, tenant)
+	p.mu.Unlock()
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+func TestCacheControl(t *testing.T) {
+	store := tenanttest.NewStore(t)
+	store.SetSettings("catalog", map[string]string{"cache.max_age": "5m", "cache.s_maxage": "1h"})
+	store.SetSettings("strict", map[string]string{"cache.no_store": "true"})
+	policies := NewSettingsCachePolicy(SettingsCachePolicyConfig{Settings: store})
+
+	app := fiber.New()
+	app.Get("/health", CacheControl(policies.PolicyFor), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	app.Use(New(Config{
+		Store:    store,
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}), CacheControl(policies.PolicyFor))
+	app.Get("/products", func(c *fiber.Ctx) error {
+		AddSurrogateKey(c, "products")
+		return c.SendString("products")
+	})
+	app.Get("/broken", func(c *fiber.Ctx) error {
+		return fiber.ErrServiceUnavailable
+	})
+	app.Get("/own", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "private, max-age=10")
+		return c.SendString("own")
+	})
+
+	request := func(tenant, path string) http.Header {
+		req := httptest.NewRequest("GET", path, nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant-ID", tenant)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		if resp.Header.Get(fiber.HeaderVary) != "X-Tenant-ID" {
+			t.Fatalf("Expected Vary: X-Tenant-ID on %s for %q, got %q", path, tenant, resp.Header.Get(fiber.HeaderVary))
+		}
+		return resp.Header
+	}
+
+	header := request("catalog", "/products")
+	if got := header.Get(fiber.HeaderCacheControl); got != "public, max-age=300, s-maxage=3600" {
+		t.Fatalf("Expected the catalog policy, got %q", got)
+	}
+	if got := header.Get(SurrogateKeyHeader); got != "tenant-catalog-products tenant-catalog" {
+		t.Fatalf("Expected the resource and tenant surrogate keys, got %q", got)
+	}
+
+	header = request("strict", "/products")
+	if got := header.Get(fiber.HeaderCacheControl); got != "no-store" {
+		t.Fatalf("Expected no-store for strict, got %q", got)
+	}
+	if got := header.Get(SurrogateKeyHeader); got != "tenant-strict-products tenant-strict" {
+		t.Fatalf("Expected the surrogate keys of strict, got %q", got)
+	}
+
+	// Errors are never cached, handlers keep their own header
+	if got := request("catalog", "/broken").Get(fiber.HeaderCacheControl); got != "no-store" {
+		t.Fatalf("Expected no-store for an error, got %q", got)
+	}
+	if got := request("catalog", "/own").Get(fiber.HeaderCacheControl); got != "private, max-age=10" {
+		t.Fatalf("Expected the handler's Cache-Control, got %q", got)
+	}
+
+	// Requests without a tenant only get Vary
+	if header := request("", "/health"); header.Get(fiber.HeaderCacheControl) != "" || header.Get(SurrogateKeyHeader) != "" {
+		t.Fatalf("Expected no caching headers without a tenant, got %v", header)
+	}
+
+	// Policies are cached until invalidated
+	store.SetSettings("catalog", map[string]string{"cache.private": "true", "cache.max_age": "1m"})
+	if got := request("catalog", "/products").Get(fiber.HeaderCacheControl); got != "public, max-age=300, s-maxage=3600" {
+		t.Fatalf("Expected the cached policy, got %q", got)
+	}
+	policies.Invalidate("catalog")
+	if got := request("catalog", "/products").Get(fiber.HeaderCacheControl); got != "private, max-age=60" {
+		t.Fatalf("Expected the new policy after Invalidate, got %q", got)
+	}
+}
+
+func TestCachePolicyString(t *testing.T) {
+	tests := []struct {
+		policy CachePolicy
+		want   string
+	}{
+		{CachePolicy{}, "public, no-cache"},
+		{CachePolicy{NoStore: true, MaxAge: time.Hour}, "no-store"},
+		{CachePolicy{Private: true}, "private, no-cache"},
+		{CachePolicy{Private: true, MaxAge: time.Minute, SharedMaxAge: time.Hour}, "private, max-age=60"},
+		{CachePolicy{SharedMaxAge: time.Hour}, "public, max-age=0, s-maxage=3600"},
+		{CachePolicy{MaxAge: time.Minute, StaleWhileRevalidate: 30 * time.Second}, "public, max-age=60, stale-while-revalidate=30"},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.String(); got != tt.want {
+			t.Fatalf("Expected %q for %+v, got %q", tt.want, tt.policy, got)
+		}
+	}
+}
+
+func TestPurgeKeyFor(t *testing.T) {
+	if got := PurgeKeyFor("acme", ""); got != "tenant-acme" {
+		t.Fatalf("Expected tenant-acme, got %s", got)
+	}
+	if got := PurgeKeyFor("acme", "products"); got != "tenant-acme-products" {
+		t.Fatalf("Expected tenant-acme-products, got %s", got)
+	}
+
+	// Separators inside names cannot forge another tenant's key
+	if a, b := PurgeKeyFor("a-b", "c"), PurgeKeyFor("a", "b-c"); a == b {
+		t.Fatalf("Expected distinct keys, got %s twice", a)
+	}
+	if got := PurgeKeyFor("ac me", "x"); got != "tenant-ac%20me-x" {
+		t.Fatalf("Expected spaces escaped, got %s", got)
+	}
+}
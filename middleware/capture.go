@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// CapturedStatement is a SQL statement run on the tenant DB of a request
+// with CaptureSQL enabled
+type CapturedStatement struct {
+	// SQL has the driver's placeholders; Args are their values
+	SQL      string        `json:"sql"`
+	Args     []interface{} `json:"args,omitempty"`
+	Rows     int64         `json:"rows"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+type sqlCaptureKey struct{}
+
+// sqlCapture collects the statements of one request
+type sqlCapture struct {
+	db *gorm.DB
+
+	mu         sync.Mutex
+	statements []CapturedStatement
+}
+
+// CaptureSQL turns on collecting the SQL that handlers run on the request's
+// tenant DB, for features such as a query log shown to customers. Statements
+// are recorded as they run, without extra queries, and read with CapturedSQL.
+// It swaps the request's tenant DB for a session with a recording logger, so
+// the cached connection used by other requests is untouched; DBs taken from
+// GetTenantDB or Provide before the call are not captured. Call it with false
+// to stop capturing and restore the previous DB.
+//
+//	app.Get("/orders", func(c *fiber.Ctx) error {
+//		middleware.CaptureSQL(c, true)
+//		defer func() { logQueries(middleware.CapturedSQL(c)) }()
+//		// ...
+//	})
+func CaptureSQL(c *fiber.Ctx, enable bool) {
+	capture, capturing := c.Locals(sqlCaptureKey{}).(*sqlCapture)
+
+	if !enable {
+		if capturing && capture.db != nil {
+			c.Locals(TenantDBKey, capture.db)
+			capture.db = nil
+		}
+		return
+	}
+	if capturing && capture.db != nil {
+		return
+	}
+
+	db := GetTenantDB(c)
+	if db == nil {
+		return
+	}
+
+	if !capturing {
+		capture = &sqlCapture{}
+		c.Locals(sqlCaptureKey{}, capture)
+	}
+	capture.db = db
+	c.Locals(TenantDBKey, db.Session(&gorm.Session{
+		Logger: &captureLogger{Interface: db.Logger, capture: capture},
+	}))
+}
+
+// CapturedSQL returns the statements recorded since CaptureSQL was enabled
+// for the request, in the order they finished
+func CapturedSQL(c *fiber.Ctx) []CapturedStatement {
+	capture, ok := c.Locals(sqlCaptureKey{}).(*sqlCapture)
+	if !ok {
+		return nil
+	}
+
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	return append([]CapturedStatement(nil), capture.statements...)
+}
+
+// captureLogger records every traced statement and passes it on to the
+// session's logger
+type captureLogger struct {
+	logger.Interface
+	capture *sqlCapture
+
+	// pending holds the statement seen by ParamsFilter during Trace
+	pending CapturedStatement
+}
+
+func (l *captureLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &captureLogger{Interface: l.Interface.LogMode(level), capture: l.capture}
+}
+
+// ParamsFilter is called by GORM while rendering the statement for Trace,
+// with the SQL and its arguments before they are inlined
+func (l *captureLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	l.pending.SQL = sql
+	l.pending.Args = append([]interface{}(nil), params...)
+
+	if filter, ok := l.Interface.(gorm.ParamsFilter); ok {
+		return filter.ParamsFilter(ctx, sql, params...)
+	}
+	return sql, params
+}
+
+func (l *captureLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	l.capture.mu.Lock()
+	l.pending = CapturedStatement{}
+	sql, rows := fc()
+
+	statement := l.pending
+	if statement.SQL == "" {
+		statement.SQL = sql
+	}
+	statement.Rows = rows
+	statement.Duration = time.Since(begin)
+	if err != nil {
+		statement.Error = err.Error()
+	}
+	l.capture.statements = append(l.capture.statements, statement)
+	l.capture.mu.Unlock()
+
+	l.Interface.Trace(ctx, begin, func() (string, int64) { return sql, rows }, err)
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+func TestCaptureSQL(t *testing.T) {
+	store := tenanttest.NewStore(t, &txTestItem{})
+
+	var captured []CapturedStatement
+	app := fiber.New()
+	app.Use(New(Config{Store: store, Resolver: HeaderResolver("X-Tenant-ID")}))
+	app.Use(func(c *fiber.Ctx) error {
+		if c.Query("capture") != "" {
+			CaptureSQL(c, true)
+		}
+		err := c.Next()
+		captured = CapturedSQL(c)
+		return err
+	})
+	app.Get("/", func(c *fiber.Ctx) error {
+		db := GetTenantDB(c)
+		if err := db.Create(&txTestItem{Name: "captured"}).Error; err != nil {
+			return err
+		}
+		var items []txTestItem
+		return db.Where("name = ?", "captured").Find(&items).Error
+	})
+
+	do := func(path string) {
+		t.Helper()
+
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Tenant-ID", "tenant1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+	}
+
+	do("/?capture=1")
+	if len(captured) != 2 {
+		t.Fatalf("Expected 2 captured statements, got %+v", captured)
+	}
+	if !strings.HasPrefix(captured[0].SQL, "INSERT INTO") || captured[0].Rows != 1 {
+		t.Fatalf("Expected the insert first, got %+v", captured[0])
+	}
+	if !strings.HasPrefix(captured[1].SQL, "SELECT") || !strings.Contains(captured[1].SQL, "?") {
+		t.Fatalf("Expected the select with a placeholder second, got %+v", captured[1])
+	}
+	if len(captured[1].Args) != 1 || captured[1].Args[0] != "captured" {
+		t.Fatalf("Expected the select argument, got %v", captured[1].Args)
+	}
+
+	// Requests without capture see neither the statements nor the logger
+	do("/")
+	if captured != nil {
+		t.Fatalf("Expected nothing captured without CaptureSQL, got %+v", captured)
+	}
+
+	db, err := store.GetTenantDB(context.Background(), "tenant1")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	if _, ok := db.Logger.(*captureLogger); ok {
+		t.Fatal("Expected the cached connection to keep its logger")
+	}
+}
+
+func TestCaptureSQLDisable(t *testing.T) {
+	store := tenanttest.NewStore(t, &txTestItem{})
+
+	app := fiber.New()
+	app.Use(New(Config{Store: store, Resolver: HeaderResolver("X-Tenant-ID")}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		original := GetTenantDB(c)
+
+		CaptureSQL(c, true)
+		if err := GetTenantDB(c).Find(&[]txTestItem{}).Error; err != nil {
+			return err
+		}
+
+		CaptureSQL(c, false)
+		if GetTenantDB(c) != original {
+			t.Errorf("Expected disabling to restore the tenant DB")
+		}
+		if err := GetTenantDB(c).Find(&[]txTestItem{}).Error; err != nil {
+			return err
+		}
+
+		if statements := CapturedSQL(c); len(statements) != 1 {
+			t.Errorf("Expected 1 statement captured while enabled, got %+v", statements)
+		}
+		return nil
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+}
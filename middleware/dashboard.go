@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Page sizes of DashboardHandler unless DashboardConfig overrides them
+const (
+	DefaultDashboardPerPage    = 50
+	DefaultDashboardMaxPerPage = 200
+)
+
+// Registry statuses reported by DashboardHandler
+const (
+	DashboardStatusActive       = "active"
+	DashboardStatusInactive     = "inactive"
+	DashboardStatusUnregistered = "unregistered"
+	DashboardStatusUnknown      = "unknown"
+)
+
+// DashboardStore reports the connection pools a store holds, keyed by
+// schema, such as tenantstore.TenantStore. Stores implementing
+// TenantActivityChecker, TenantExistenceChecker and SchemaNamer also add
+// registry status and map tenants to schemas.
+type DashboardStore interface {
+	ConnectionStats() map[string]sql.DBStats
+}
+
+// DashboardConfig configures DashboardHandler
+type DashboardConfig struct {
+	// Authorize rejects requests not allowed to see the dashboard by
+	// returning an error, such as fiber.ErrForbidden (required)
+	Authorize func(c *fiber.Ctx) error
+
+	// Optional: Default page size, and the largest one clients may ask for
+	// (default to DefaultDashboardPerPage and DefaultDashboardMaxPerPage)
+	PerPage    int
+	MaxPerPage int
+}
+
+// Dashboard is the document served by DashboardHandler
+type Dashboard struct {
+	Tenants     []DashboardTenant `json:"tenants"`
+	Total       int               `json:"total"`
+	Page        int               `json:"page"`
+	PerPage     int               `json:"per_page"`
+	GeneratedAt time.Time         `json:"generated_at"`
+}
+
+// DashboardTenant merges what is known about one tenant. Requests is nil
+// without traffic in the metrics window and Connection nil without a cached
+// pool.
+type DashboardTenant struct {
+	Tenant     string               `json:"tenant,omitempty"`
+	Schema     string               `json:"schema"`
+	Status     string               `json:"status,omitempty"`
+	Requests   *DashboardRequests   `json:"requests,omitempty"`
+	Connection *DashboardConnection `json:"connection,omitempty"`
+}
+
+// DashboardRequests are TenantRequestStats with the latency in milliseconds
+type DashboardRequests struct {
+	Count       uint64  `json:"count"`
+	RequestRate float64 `json:"request_rate"`
+	ErrorRate   float64 `json:"error_rate"`
+	P95Ms       float64 `json:"p95_ms"`
+}
+
+// DashboardConnection summarizes a tenant's connection pool
+type DashboardConnection struct {
+	Open           int     `json:"open"`
+	InUse          int     `json:"in_use"`
+	Idle           int     `json:"idle"`
+	WaitCount      int64   `json:"wait_count"`
+	WaitDurationMs float64 `json:"wait_duration_ms"`
+}
+
+// DashboardHandler returns a handler serving per-tenant health as one JSON
+// Dashboard, for an internal dashboard polling it: request and error rates
+// and p95 latency from metrics, connection pool stats from the store and
+// the registry status. Everything but the registry status comes from
+// memory, and that only for the tenants of the page, so it is cheap to poll
+// every few seconds. metrics may be nil. Requests choose tenants with
+// ?tenant=a,b and pages with ?page=2&per_page=50. Mount it outside the
+// tenant middleware.
+//
+//	app.Get("/internal/tenants", middleware.DashboardHandler(store, metrics, middleware.DashboardConfig{
+//		Authorize: requireOperator,
+//	}))
+func DashboardHandler(store DashboardStore, metrics *TenantMetrics, cfg DashboardConfig) fiber.Handler {
+	if cfg.Authorize == nil {
+		panic("DashboardHandler requires Authorize")
+	}
+	if cfg.PerPage <= 0 {
+		cfg.PerPage = DefaultDashboardPerPage
+	}
+	if cfg.MaxPerPage <= 0 {
+		cfg.MaxPerPage = DefaultDashboardMaxPerPage
+	}
+	namer, _ := store.(SchemaNamer)
+	activity, _ := store.(TenantActivityChecker)
+	existence, _ := store.(TenantExistenceChecker)
+
+	return func(c *fiber.Ctx) error {
+		if err := cfg.Authorize(c); err != nil {
+			return err
+		}
+
+		page, perPage := 1, cfg.PerPage
+		if v := c.Query("page"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return fiber.NewError(fiber.StatusBadRequest, "page must be a positive integer")
+			}
+			page = n
+		}
+		if v := c.Query("per_page"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return fiber.NewError(fiber.StatusBadRequest, "per_page must be a positive integer")
+			}
+			perPage = min(n, cfg.MaxPerPage)
+		}
+
+		var only map[string]bool
+		if v := c.Query("tenant"); v != "" {
+			only = make(map[string]bool)
+			for _, tenant := range strings.Split(v, ",") {
+				if tenant = strings.TrimSpace(tenant); tenant != "" {
+					only[tenant] = true
+				}
+			}
+		}
+
+		// Merge by schema: metrics know tenants, the store knows schemas
+		entries := make(map[string]*DashboardTenant)
+		if metrics != nil {
+			for _, stats := range metrics.Snapshot() {
+				schema := stats.Tenant
+				if namer != nil && stats.Tenant != OverflowTenant {
+					if mapped, err := namer.SchemaName(stats.Tenant); err == nil {
+						schema = mapped
+					}
+				}
+				if only != nil && !only[stats.Tenant] && !only[schema] {
+					continue
+				}
+				entries[schema] = &DashboardTenant{
+					Tenant: stats.Tenant,
+					Schema: schema,
+					Requests: &DashboardRequests{
+						Count:       stats.Requests,
+						RequestRate: stats.RequestRate,
+						ErrorRate:   stats.ErrorRate,
+						P95Ms:       milliseconds(stats.P95),
+					},
+				}
+			}
+		}
+		for schema, stats := range store.ConnectionStats() {
+			entry, ok := entries[schema]
+			if !ok {
+				if only != nil && !only[schema] {
+					continue
+				}
+				entry = &DashboardTenant{Schema: schema}
+				entries[schema] = entry
+			}
+			entry.Connection = &DashboardConnection{
+				Open:           stats.OpenConnections,
+				InUse:          stats.InUse,
+				Idle:           stats.Idle,
+				WaitCount:      stats.WaitCount,
+				WaitDurationMs: milliseconds(stats.WaitDuration),
+			}
+		}
+
+		tenants := make([]DashboardTenant, 0, len(entries))
+		for _, entry := range entries {
+			tenants = append(tenants, *entry)
+		}
+		sort.Slice(tenants, func(i, j int) bool { return tenants[i].Schema < tenants[j].Schema })
+
+		dashboard := Dashboard{
+			Total:       len(tenants),
+			Page:        page,
+			PerPage:     perPage,
+			GeneratedAt: time.Now().UTC(),
+		}
+		start := min((page-1)*perPage, len(tenants))
+		dashboard.Tenants = tenants[start:min(start+perPage, len(tenants))]
+
+		if activity != nil {
+			ctx := c.UserContext()
+			for i := range dashboard.Tenants {
+				entry := &dashboard.Tenants[i]
+				if entry.Tenant == OverflowTenant {
+					continue
+				}
+				entry.Status = registryStatus(ctx, activity, existence, entry.Schema)
+			}
+		}
+		return c.JSON(dashboard)
+	}
+}
+
+// registryStatus returns the dashboard status of a schema; lookup failures
+// are reported as unknown rather than failing the dashboard
+func registryStatus(ctx context.Context, activity TenantActivityChecker, existence TenantExistenceChecker, schema string) string {
+	active, err := activity.IsTenantActive(ctx, schema)
+	switch {
+	case err != nil:
+		return DashboardStatusUnknown
+	case active:
+		return DashboardStatusActive
+	case existence == nil:
+		return DashboardStatusInactive
+	}
+	if exists, err := existence.TenantExists(ctx, schema); err != nil {
+		return DashboardStatusUnknown
+	} else if exists {
+		return DashboardStatusInactive
+	}
+	return DashboardStatusUnregistered
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
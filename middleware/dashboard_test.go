@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+// The store serves the dashboard's connection stats and registry status
+var (
+	_ DashboardStore         = (*tenantstore.TenantStore)(nil)
+	_ TenantExistenceChecker = (*tenantstore.TenantStore)(nil)
+)
+
+// dashboardStore holds fixed pools and registry records, with schemas
+// named "s_" plus the tenant
+type dashboardStore struct {
+	pools  map[string]sql.DBStats
+	active map[string]bool
+}
+
+func (s dashboardStore) ConnectionStats() map[string]sql.DBStats {
+	return s.pools
+}
+
+func (s dashboardStore) SchemaName(tenant string) (string, error) {
+	return "s_" + tenant, nil
+}
+
+func (s dashboardStore) IsTenantActive(ctx context.Context, tenantSchema string) (bool, error) {
+	return s.active[tenantSchema], nil
+}
+
+func (s dashboardStore) TenantExists(ctx context.Context, tenantSchema string) (bool, error) {
+	_, ok := s.active[tenantSchema]
+	return ok, nil
+}
+
+func getDashboard(t *testing.T, app *fiber.App, target string) (int, Dashboard) {
+	t.Helper()
+
+	resp, err := app.Test(httptest.NewRequest("GET", target, nil))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	var dashboard Dashboard
+	if resp.StatusCode == fiber.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&dashboard); err != nil {
+			t.Fatalf("Failed to decode dashboard: %v", err)
+		}
+	}
+	return resp.StatusCode, dashboard
+}
+
+func TestDashboardHandlerMerge(t *testing.T) {
+	metrics := NewTenantMetrics(MetricsConfig{})
+	metrics.Observe("busy", 20*time.Millisecond, false)
+	metrics.Observe("busy", 20*time.Millisecond, true)
+	metrics.Observe("cold", 3*time.Millisecond, false)
+
+	store := dashboardStore{
+		pools: map[string]sql.DBStats{
+			"s_busy": {OpenConnections: 3, InUse: 1, Idle: 2},
+			"s_idle": {OpenConnections: 1, Idle: 1},
+		},
+		active: map[string]bool{"s_busy": true, "s_cold": false},
+	}
+
+	app := fiber.New()
+	app.Get("/dashboard", DashboardHandler(store, metrics, DashboardConfig{
+		Authorize: func(c *fiber.Ctx) error { return nil },
+	}))
+
+	status, dashboard := getDashboard(t, app, "/dashboard")
+	if status != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if dashboard.Total != 3 || len(dashboard.Tenants) != 3 {
+		t.Fatalf("Expected 3 tenants, got %+v", dashboard)
+	}
+	busy, cold, idle := dashboard.Tenants[0], dashboard.Tenants[1], dashboard.Tenants[2]
+
+	// Metrics and a cached connection
+	if busy.Tenant != "busy" || busy.Schema != "s_busy" || busy.Status != DashboardStatusActive {
+		t.Fatalf("Expected busy to be active, got %+v", busy)
+	}
+	if busy.Requests == nil || busy.Requests.Count != 2 || busy.Requests.ErrorRate != 0.5 || busy.Requests.P95Ms != 25 {
+		t.Fatalf("Expected the request stats of busy, got %+v", busy.Requests)
+	}
+	if busy.Connection == nil || busy.Connection.Open != 3 || busy.Connection.InUse != 1 {
+		t.Fatalf("Expected the pool of busy, got %+v", busy.Connection)
+	}
+
+	// Metrics but no cached connection
+	if cold.Schema != "s_cold" || cold.Requests == nil || cold.Connection != nil || cold.Status != DashboardStatusInactive {
+		t.Fatalf("Expected cold with requests and no connection, got %+v", cold)
+	}
+
+	// A cached connection but no metrics
+	if idle.Schema != "s_idle" || idle.Tenant != "" || idle.Requests != nil || idle.Connection == nil || idle.Connection.Idle != 1 {
+		t.Fatalf("Expected idle with a connection and no requests, got %+v", idle)
+	}
+	if idle.Status != DashboardStatusUnregistered {
+		t.Fatalf("Expected idle to be unregistered, got %s", idle.Status)
+	}
+}
+
+func TestDashboardHandlerFilterAndPages(t *testing.T) {
+	store := dashboardStore{pools: map[string]sql.DBStats{
+		"s_a": {}, "s_b": {}, "s_c": {}, "s_d": {}, "s_e": {},
+	}}
+
+	app := fiber.New()
+	app.Get("/dashboard", DashboardHandler(store, nil, DashboardConfig{
+		Authorize:  func(c *fiber.Ctx) error { return nil },
+		PerPage:    2,
+		MaxPerPage: 3,
+	}))
+
+	_, dashboard := getDashboard(t, app, "/dashboard?page=3")
+	if dashboard.Total != 5 || len(dashboard.Tenants) != 1 || dashboard.Tenants[0].Schema != "s_e" {
+		t.Fatalf("Expected the last of 5 tenants on page 3, got %+v", dashboard)
+	}
+
+	_, dashboard = getDashboard(t, app, "/dashboard?per_page=10")
+	if dashboard.PerPage != 3 || len(dashboard.Tenants) != 3 {
+		t.Fatalf("Expected per_page capped at 3, got %+v", dashboard)
+	}
+
+	_, dashboard = getDashboard(t, app, "/dashboard?tenant=s_b,s_d")
+	if dashboard.Total != 2 || dashboard.Tenants[0].Schema != "s_b" || dashboard.Tenants[1].Schema != "s_d" {
+		t.Fatalf("Expected only s_b and s_d, got %+v", dashboard)
+	}
+
+	_, dashboard = getDashboard(t, app, "/dashboard?page=9")
+	if dashboard.Total != 5 || dashboard.Tenants == nil || len(dashboard.Tenants) != 0 {
+		t.Fatalf("Expected an empty page past the end, got %+v", dashboard)
+	}
+
+	if status, _ := getDashboard(t, app, "/dashboard?page=0"); status != fiber.StatusBadRequest {
+		t.Fatalf("Expected status 400 for page 0, got %d", status)
+	}
+}
+
+func TestDashboardHandlerAuthorize(t *testing.T) {
+	app := fiber.New()
+	app.Get("/dashboard", DashboardHandler(dashboardStore{}, nil, DashboardConfig{
+		Authorize: func(c *fiber.Ctx) error {
+			if c.Get("X-Operator") == "" {
+				return fiber.ErrForbidden
+			}
+			return nil
+		},
+	}))
+
+	if status, _ := getDashboard(t, app, "/dashboard"); status != fiber.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d", status)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic without Authorize")
+		}
+	}()
+	DashboardHandler(dashboardStore{}, nil, DashboardConfig{})
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Error codes of SanitizeDBError
+const (
+	// ErrorCodeRecordNotFound is used for gorm.ErrRecordNotFound
+	ErrorCodeRecordNotFound = "RECORD_NOT_FOUND"
+
+	// ErrorCodeRecordConflict is used for unique violations
+	ErrorCodeRecordConflict = "RECORD_CONFLICT"
+
+	// ErrorCodeInvalidReference is used for foreign key violations
+	ErrorCodeInvalidReference = "INVALID_REFERENCE"
+
+	// ErrorCodeInvalidRecord is used for values the columns reject, such as
+	// NULL in NOT NULL columns, CHECK violations and too long strings
+	ErrorCodeInvalidRecord = "INVALID_RECORD"
+
+	// ErrorCodeInternal is used for every other error
+	ErrorCodeInternal = "INTERNAL_ERROR"
+)
+
+// invalidRecordStates are the SQLSTATEs of values the columns reject
+var invalidRecordStates = map[string]bool{
+	"23502": true, // not_null_violation
+	"23514": true, // check_violation
+	"22001": true, // string_data_right_truncation
+	"22003": true, // numeric_value_out_of_range
+	"22P02": true, // invalid_text_representation
+}
+
+// SanitizeDBError classifies an error of GORM or the PostgreSQL driver into
+// a status, an error code and a message safe to show clients, without the
+// table, constraint or connection details of err:
+//
+//	gorm.ErrRecordNotFound         404 RECORD_NOT_FOUND
+//	unique violation (23505)       409 RECORD_CONFLICT
+//	foreign key violation (23503)  422 INVALID_REFERENCE
+//	not null, check, bad value     422 INVALID_RECORD
+//	anything else                  500 INTERNAL_ERROR
+//
+// GORM's translated errors, gorm.ErrDuplicatedKey and
+// gorm.ErrForeignKeyViolated, are classified like their SQLSTATEs. Log err
+// itself server-side; SanitizeErrors does both.
+func SanitizeDBError(err error) (status int, code string, publicMsg string) {
+	var pgErr *pgconn.PgError
+	state := ""
+	if errors.As(err, &pgErr) {
+		state = pgErr.Code
+	}
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fiber.StatusNotFound, ErrorCodeRecordNotFound, "Record not found"
+	case state == "23505" || errors.Is(err, gorm.ErrDuplicatedKey):
+		return fiber.StatusConflict, ErrorCodeRecordConflict, "Record already exists"
+	case state == "23503" || errors.Is(err, gorm.ErrForeignKeyViolated):
+		return fiber.StatusUnprocessableEntity, ErrorCodeInvalidReference, "Record references a missing record or is still referenced"
+	case invalidRecordStates[state]:
+		return fiber.StatusUnprocessableEntity, ErrorCodeInvalidRecord, "Record has invalid values"
+	}
+	return fiber.StatusInternalServerError, ErrorCodeInternal, "Internal server error"
+}
+
+// SanitizeErrors wraps an error handler, such as DefaultErrorHandler or
+// fiber.DefaultErrorHandler, so handlers can return GORM and driver errors
+// as they are. Clients get the classification of SanitizeDBError as an
+// *Error, and the full error is logged with the route and tenant, except
+// for records not found. Errors meant for clients, *fiber.Error and the
+// middleware's *Error below 500, pass through; the messages of the
+// middleware's 5xx errors are replaced with the status text. Use it as the
+// app's error handler, and as Config.ErrorHandler for the middleware's own
+// errors:
+//
+//	app := fiber.New(fiber.Config{
+//		ErrorHandler: middleware.SanitizeErrors(middleware.DefaultErrorHandler),
+//	})
+func SanitizeErrors(next fiber.ErrorHandler) fiber.ErrorHandler {
+	if next == nil {
+		panic("SanitizeErrors requires an error handler")
+	}
+	return func(c *fiber.Ctx, err error) error {
+		var mwErr *Error
+		if errors.As(err, &mwErr) {
+			if mwErr.Status < fiber.StatusInternalServerError {
+				return next(c, err)
+			}
+			logDBError(c, err)
+			return next(c, &Error{Code: mwErr.Code, Status: mwErr.Status, Err: fiber.NewError(mwErr.Status, utils.StatusMessage(mwErr.Status))})
+		}
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			return next(c, err)
+		}
+
+		status, code, message := SanitizeDBError(err)
+		if status != fiber.StatusNotFound {
+			logDBError(c, err)
+		}
+		return next(c, &Error{Code: code, Status: status, Err: fiber.NewError(status, message)})
+	}
+}
+
+// logDBError logs an error hidden from the client
+func logDBError(c *fiber.Ctx, err error) {
+	tenant := GetTenant(c)
+	if tenant == "" {
+		tenant = "-"
+	}
+	log.Printf("ERROR %s %s for tenant %s: %v", c.Method(), c.Path(), tenant, err)
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+func TestSanitizeDBError(t *testing.T) {
+	pgErr := func(code string) error {
+		return &pgconn.PgError{Code: code, Message: "violates constraint", ConstraintName: "users_email_key", TableName: "users"}
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"Record not found", gorm.ErrRecordNotFound, fiber.StatusNotFound, ErrorCodeRecordNotFound},
+		{"Wrapped record not found", fmt.Errorf("load user: %w", gorm.ErrRecordNotFound), fiber.StatusNotFound, ErrorCodeRecordNotFound},
+		{"Unique violation", pgErr("23505"), fiber.StatusConflict, ErrorCodeRecordConflict},
+		{"Wrapped unique violation", fmt.Errorf("create user: %w", pgErr("23505")), fiber.StatusConflict, ErrorCodeRecordConflict},
+		{"Translated duplicated key", gorm.ErrDuplicatedKey, fiber.StatusConflict, ErrorCodeRecordConflict},
+		{"Foreign key violation", pgErr("23503"), fiber.StatusUnprocessableEntity, ErrorCodeInvalidReference},
+		{"Translated foreign key violation", gorm.ErrForeignKeyViolated, fiber.StatusUnprocessableEntity, ErrorCodeInvalidReference},
+		{"Not null violation", pgErr("23502"), fiber.StatusUnprocessableEntity, ErrorCodeInvalidRecord},
+		{"Check violation", pgErr("23514"), fiber.StatusUnprocessableEntity, ErrorCodeInvalidRecord},
+		{"String too long", pgErr("22001"), fiber.StatusUnprocessableEntity, ErrorCodeInvalidRecord},
+		{"Invalid text representation", pgErr("22P02"), fiber.StatusUnprocessableEntity, ErrorCodeInvalidRecord},
+		{"Undefined table", pgErr("42P01"), fiber.StatusInternalServerError, ErrorCodeInternal},
+		{"Serialization failure", pgErr("40001"), fiber.StatusInternalServerError, ErrorCodeInternal},
+		{"Connection failure", errors.New("failed to connect to host=db.internal user=app"), fiber.StatusInternalServerError, ErrorCodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code, message := SanitizeDBError(tt.err)
+			if status != tt.status || code != tt.code {
+				t.Fatalf("Expected %d %s, got %d %s", tt.status, tt.code, status, code)
+			}
+			for _, leak := range []string{"users", "constraint", "host="} {
+				if strings.Contains(message, leak) {
+					t.Fatalf("Expected no %q in the public message, got %q", leak, message)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeErrors(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	store := tenanttest.NewStore(t)
+	app := fiber.New(fiber.Config{ErrorHandler: SanitizeErrors(DefaultErrorHandler)})
+	app.Use(New(Config{
+		Store:        store,
+		Resolver:     HeaderResolver("X-Tenant-ID"),
+		ErrorHandler: SanitizeErrors(DefaultErrorHandler),
+	}))
+	app.Get("/conflict", func(c *fiber.Ctx) error {
+		return fmt.Errorf("create user: %w", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"})
+	})
+	app.Get("/missing", func(c *fiber.Ctx) error {
+		return gorm.ErrRecordNotFound
+	})
+	app.Get("/forbidden", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusForbidden, "Only admins may do this")
+	})
+
+	request := func(tenant, path string) (int, ErrorResponse) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Tenant-ID", tenant)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var response ErrorResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatalf("Expected the error envelope, got %s", body)
+		}
+		return resp.StatusCode, response
+	}
+
+	status, response := request("tenant1", "/conflict")
+	if status != fiber.StatusConflict || response.Code != ErrorCodeRecordConflict || strings.Contains(response.Message, "users_email_key") {
+		t.Fatalf("Expected a sanitized 409, got %d %+v", status, response)
+	}
+	if !strings.Contains(logs.String(), "GET /conflict for tenant tenant1") || !strings.Contains(logs.String(), "23505") {
+		t.Fatalf("Expected the full error logged with the tenant, got %q", logs.String())
+	}
+
+	logs.Reset()
+	if status, response = request("tenant1", "/missing"); status != fiber.StatusNotFound || response.Code != ErrorCodeRecordNotFound {
+		t.Fatalf("Expected 404, got %d %+v", status, response)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("Expected records not found not to be logged, got %q", logs.String())
+	}
+
+	// Errors meant for clients keep their message
+	if status, response = request("tenant1", "/forbidden"); status != fiber.StatusForbidden || response.Message != "Only admins may do this" {
+		t.Fatalf("Expected the handler's 403, got %d %+v", status, response)
+	}
+	if status, response = request("", "/forbidden"); status != fiber.StatusBadRequest || response.Code != ErrorCodeTenantResolutionFailed {
+		t.Fatalf("Expected the middleware's 400, got %d %+v", status, response)
+	}
+}
+
+func TestSanitizeErrorsHidesStoreDetails(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	store := &failingTenantStore{Store: tenanttest.NewStore(t), err: errors.New("dial tcp 10.0.0.5:5432: password authentication failed for user app")}
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:        store,
+		Resolver:     HeaderResolver("X-Tenant-ID"),
+		ErrorHandler: SanitizeErrors(DefaultErrorHandler),
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusServiceUnavailable || strings.Contains(string(body), "10.0.0.5") || !strings.Contains(string(body), ErrorCodeTenantDBUnavailable) {
+		t.Fatalf("Expected a 503 without connection details, got %d: %s", resp.StatusCode, body)
+	}
+	if !strings.Contains(logs.String(), "10.0.0.5") {
+		t.Fatalf("Expected the full error in the log, got %q", logs.String())
+	}
+}
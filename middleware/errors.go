@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Error codes of the error envelope. They are stable, so clients can branch
+// on them and handlers can reuse them for their own tenant errors.
+const (
+	// ErrorCodeTenantNotFound is used when the store does not know the tenant
+	ErrorCodeTenantNotFound = "TENANT_NOT_FOUND"
+
+	// ErrorCodeTenantSuspended is used for inactive tenants with EnforceActive
+	ErrorCodeTenantSuspended = "TENANT_SUSPENDED"
+
+	// ErrorCodeTenantResolutionFailed is used when no tenant can be resolved
+	// from the request, or RewriteTenant, VerifyTenantAccess or
+	// OnTenantResolved reject it
+	ErrorCodeTenantResolutionFailed = "TENANT_RESOLUTION_FAILED"
+
+	// ErrorCodeTenantResolutionTimeout is used when the resolver takes
+	// longer than ResolveTimeout
+	ErrorCodeTenantResolutionTimeout = "TENANT_RESOLUTION_TIMEOUT"
+
+	// ErrorCodeTenantResolutionThrottled is used when ResolutionGuard
+	// refuses a request before the tenant is looked up
+	ErrorCodeTenantResolutionThrottled = "TENANT_RESOLUTION_THROTTLED"
+
+	// ErrorCodeTenantDBUnavailable is used when the tenant database or its
+	// status cannot be reached
+	ErrorCodeTenantDBUnavailable = "TENANT_DB_UNAVAILABLE"
+
+	// ErrorCodePlanLimitExceeded is used by PlanLimits for rejected requests
+	ErrorCodePlanLimitExceeded = "PLAN_LIMIT_EXCEEDED"
+
+	// ErrorCodePlanLimitsUnavailable is used by PlanLimits when the limits
+	// or usage cannot be read
+	ErrorCodePlanLimitsUnavailable = "PLAN_LIMITS_UNAVAILABLE"
+)
+
+var (
+	errTenantStatusUnavailable = fiber.NewError(fiber.StatusServiceUnavailable, "Tenant status unavailable")
+	errTenantNotFound          = fiber.NewError(fiber.StatusNotFound, "Tenant not found")
+)
+
+// ErrorResponse is the JSON body of middleware errors
+type ErrorResponse struct {
+	Code      string `json:"code" example:"TENANT_NOT_FOUND" enums:"TENANT_NOT_FOUND,TENANT_SUSPENDED,TENANT_RESOLUTION_FAILED,TENANT_RESOLUTION_TIMEOUT,TENANT_RESOLUTION_THROTTLED,TENANT_DB_UNAVAILABLE,PLAN_LIMIT_EXCEEDED,PLAN_LIMITS_UNAVAILABLE,RECORD_NOT_FOUND,RECORD_CONFLICT,INVALID_REFERENCE,INVALID_RECORD,INTERNAL_ERROR"`
+	Message   string `json:"message" example:"Tenant not found"`
+	Tenant    string `json:"tenant,omitempty" example:"acme"`
+	RequestID string `json:"request_id,omitempty" example:"3f0b6c1e-9a57-4d0c-8d5e-2f1f9b0c7a41"`
+}
+
+// NewErrorResponse returns the envelope for an error of the current request,
+// filling in the tenant, if resolved, and the request ID set by Fiber's
+// requestid middleware
+func NewErrorResponse(c *fiber.Ctx, code, message string) ErrorResponse {
+	return ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Tenant:    GetTenant(c),
+		RequestID: requestID(c),
+	}
+}
+
+// Error is passed to error handlers for failures of the middleware. It
+// carries the envelope code and the HTTP status, and unwraps to the
+// resolver's or store's error.
+type Error struct {
+	Code   string
+	Status int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError wraps err with code. Errors carrying a status keep it, and
+// others get status.
+func newError(code string, status int, err error) *Error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+	}
+	if code == ErrorCodeTenantDBUnavailable && status == fiber.StatusNotFound {
+		code = ErrorCodeTenantNotFound
+	}
+	return &Error{Code: code, Status: status, Err: err}
+}
+
+// ErrorPage is the data of error templates. html/template escapes every
+// field, so tenants taken from hostile hosts or headers cannot inject markup.
+type ErrorPage struct {
+	Status     int
+	StatusText string
+	ErrorResponse
+}
+
+// DefaultErrorTemplate is the page DefaultErrorHandler shows browsers
+var DefaultErrorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Status}} {{.StatusText}}</title>
+</head>
+<body>
+<h1>{{.StatusText}}</h1>
+<p>{{.Message}}</p>
+{{- if .Tenant}}
+<p>Tenant: {{.Tenant}}</p>
+{{- end}}
+<p><small>{{.Code}}{{if .RequestID}} &middot; Request {{.RequestID}}{{end}}</small></p>
+</body>
+</html>
+`))
+
+// DefaultErrorHandler responds with an ErrorResponse, using the code and
+// status of an *Error and 500 with the code INTERNAL_ERROR otherwise. The
+// body is negotiated from the Accept header: JSON when it is missing or
+// accepts JSON first, DefaultErrorTemplate for browsers asking for HTML,
+// and plain text otherwise.
+func DefaultErrorHandler(c *fiber.Ctx, err error) error {
+	return negotiateError(c, err, DefaultErrorTemplate)
+}
+
+// ErrorHandlerWithTemplate returns DefaultErrorHandler with tmpl as the HTML
+// page, executed with an ErrorPage. Config.ErrorTemplate sets it up.
+func ErrorHandlerWithTemplate(tmpl *template.Template) func(c *fiber.Ctx, err error) error {
+	if tmpl == nil {
+		panic("ErrorHandlerWithTemplate requires a template")
+	}
+	return func(c *fiber.Ctx, err error) error {
+		return negotiateError(c, err, tmpl)
+	}
+}
+
+func negotiateError(c *fiber.Ctx, err error, tmpl *template.Template) error {
+	code, status := ErrorCodeInternal, fiber.StatusInternalServerError
+	var mwErr *Error
+	if errors.As(err, &mwErr) {
+		code, status = mwErr.Code, mwErr.Status
+	} else {
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		}
+	}
+	response := NewErrorResponse(c, code, err.Error())
+
+	c.Vary(fiber.HeaderAccept)
+	c.Status(status)
+
+	switch c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextHTML, fiber.MIMETextPlain) {
+	case fiber.MIMEApplicationJSON:
+		return c.JSON(response)
+	case fiber.MIMETextHTML:
+		var page bytes.Buffer
+		err := tmpl.Execute(&page, ErrorPage{Status: status, StatusText: utils.StatusMessage(status), ErrorResponse: response})
+		if err == nil {
+			c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+			return c.Send(page.Bytes())
+		}
+	}
+
+	// Browsers show text/plain as is, so it needs no escaping
+	return c.SendString(response.Code + ": " + response.Message + "\n")
+}
+
+// legacyErrorHandler responds with the body used before the envelope: the
+// given error name, the message and the fiber error's status or 400
+func legacyErrorHandler(name string, status int) func(c *fiber.Ctx, err error) error {
+	return func(c *fiber.Ctx, err error) error {
+		status := status
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error":   name,
+			"message": err.Error(),
+		})
+	}
+}
+
+// requestID returns the ID set by Fiber's requestid middleware, or the
+// request's X-Request-ID header
+func requestID(c *fiber.Ctx) string {
+	if id, ok := c.Locals("requestid").(string); ok && id != "" {
+		return id
+	}
+	if id := c.GetRespHeader(fiber.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Get(fiber.HeaderXRequestID)
+}
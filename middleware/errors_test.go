@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+// The registry lets tenantstore tell unknown tenants from inactive ones
+var _ TenantExistenceChecker = (*tenantstore.TenantStore)(nil)
+
+// registeredTenantStore knows which tenants exist, like a store with a registry
+type registeredTenantStore struct {
+	*tenanttest.Store
+	registered map[string]bool
+}
+
+func (s *registeredTenantStore) TenantExists(ctx context.Context, tenantSchema string) (bool, error) {
+	return s.registered[tenantSchema], nil
+}
+
+func doErrorRequest(t *testing.T, app *fiber.App, tenant string) (int, map[string]interface{}) {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if tenant != "" {
+		req.Header.Set("X-Tenant-ID", tenant)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode error body: %v", err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	store := &registeredTenantStore{Store: tenanttest.NewStore(t), registered: map[string]bool{"acme": true, "globex": true}}
+	store.Deactivate("globex")
+	store.Deactivate("unknown")
+
+	app := fiber.New()
+	app.Use(requestid.New(requestid.Config{Generator: func() string { return "req-1" }}))
+	app.Use(New(Config{
+		Store:         store,
+		Resolver:      HeaderResolver("X-Tenant-ID"),
+		EnforceActive: true,
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		tenant string
+		status int
+		code   string
+	}{
+		{"", fiber.StatusBadRequest, ErrorCodeTenantResolutionFailed},
+		{"globex", fiber.StatusForbidden, ErrorCodeTenantSuspended},
+		{"unknown", fiber.StatusNotFound, ErrorCodeTenantNotFound},
+	}
+	for _, tt := range tests {
+		status, body := doErrorRequest(t, app, tt.tenant)
+		if status != tt.status || body["code"] != tt.code {
+			t.Fatalf("Expected %d %s for tenant %q, got %d %v", tt.status, tt.code, tt.tenant, status, body)
+		}
+		if body["message"] == "" || body["request_id"] != "req-1" {
+			t.Fatalf("Expected a message and the request ID, got %v", body)
+		}
+		if _, ok := body["error"]; ok {
+			t.Fatalf("Expected no legacy error field, got %v", body)
+		}
+	}
+
+	// Store failures are reported with the tenant, which has been resolved
+	app = fiber.New()
+	app.Use(New(Config{
+		Store:    &failingTenantStore{Store: tenanttest.NewStore(t), err: errors.New("connection refused")},
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+
+	status, body := doErrorRequest(t, app, "acme")
+	if status != fiber.StatusServiceUnavailable || body["code"] != ErrorCodeTenantDBUnavailable || body["tenant"] != "acme" {
+		t.Fatalf("Expected 503 TENANT_DB_UNAVAILABLE for acme, got %d %v", status, body)
+	}
+}
+
+func TestCustomErrorHandlerGetsCode(t *testing.T) {
+	var got *Error
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:    tenanttest.NewStore(t),
+		Resolver: HeaderResolver("X-Tenant-ID"),
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			errors.As(err, &got)
+
+			// The resolver's error is still reachable
+			var fiberErr *fiber.Error
+			if !errors.As(err, &fiberErr) {
+				t.Error("Expected the fiber error to be wrapped")
+			}
+			return c.Status(got.Status).JSON(NewErrorResponse(c, got.Code, "custom"))
+		},
+	}))
+
+	status, body := doErrorRequest(t, app, "")
+	if got == nil || got.Code != ErrorCodeTenantResolutionFailed {
+		t.Fatalf("Expected an *Error with TENANT_RESOLUTION_FAILED, got %v", got)
+	}
+	if status != fiber.StatusBadRequest || body["message"] != "custom" {
+		t.Fatalf("Expected the custom body, got %d %v", status, body)
+	}
+}
+
+func TestLegacyErrorBody(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:           &failingTenantStore{Store: tenanttest.NewStore(t), err: errors.New("connection refused")},
+		Resolver:        HeaderResolver("X-Tenant-ID"),
+		LegacyErrorBody: true,
+	}))
+
+	status, body := doErrorRequest(t, app, "")
+	if status != fiber.StatusBadRequest || body["error"] != "tenant_resolution_failed" || body["message"] != "Tenant header not found" {
+		t.Fatalf("Expected the legacy body, got %d %v", status, body)
+	}
+	if _, ok := body["code"]; ok {
+		t.Fatalf("Expected no code in the legacy body, got %v", body)
+	}
+
+	// Store errors without a status keep the old 400
+	status, body = doErrorRequest(t, app, "acme")
+	if status != fiber.StatusBadRequest || body["error"] != "tenant_resolution_failed" {
+		t.Fatalf("Expected the legacy 400, got %d %v", status, body)
+	}
+}
+
+func doNegotiatedRequest(t *testing.T, app *fiber.App, tenant, accept string) (int, string, string) {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant-ID", tenant)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+}
+
+func TestErrorContentNegotiation(t *testing.T) {
+	const hostile = `<script>alert("x")</script>`
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:    &failingTenantStore{Store: tenanttest.NewStore(t), err: errors.New("connection refused")},
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{"no Accept", "", fiber.MIMEApplicationJSON},
+		{"any", "*/*", fiber.MIMEApplicationJSON},
+		{"JSON", "application/json", fiber.MIMEApplicationJSON},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", fiber.MIMETextHTMLCharsetUTF8},
+		{"plain text", "text/plain", fiber.MIMETextPlainCharsetUTF8},
+		{"other", "image/png", fiber.MIMETextPlainCharsetUTF8},
+	}
+	for _, tt := range tests {
+		status, contentType, body := doNegotiatedRequest(t, app, hostile, tt.accept)
+		if status != fiber.StatusServiceUnavailable {
+			t.Fatalf("%s: Expected 503, got %d", tt.name, status)
+		}
+		if contentType != tt.contentType {
+			t.Fatalf("%s: Expected %s, got %s", tt.name, tt.contentType, contentType)
+		}
+		if !strings.Contains(body, ErrorCodeTenantDBUnavailable) {
+			t.Fatalf("%s: Expected the error code in the body, got %s", tt.name, body)
+		}
+		if tt.contentType == fiber.MIMETextHTMLCharsetUTF8 {
+			if strings.Contains(body, "<script>") {
+				t.Fatalf("%s: Expected the tenant to be escaped, got %s", tt.name, body)
+			}
+			if !strings.Contains(body, "&lt;script&gt;") {
+				t.Fatalf("%s: Expected the escaped tenant in the page, got %s", tt.name, body)
+			}
+		}
+	}
+}
+
+func TestErrorTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("error").Parse(`<h1>{{.Status}} {{.Code}}</h1><p>{{.Tenant}}</p>`))
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:         &failingTenantStore{Store: tenanttest.NewStore(t), err: errors.New("connection refused")},
+		Resolver:      HeaderResolver("X-Tenant-ID"),
+		ErrorTemplate: tmpl,
+	}))
+
+	_, _, body := doNegotiatedRequest(t, app, `acme"><img src=x onerror=alert(1)>`, "text/html")
+	expected := `<h1>503 TENANT_DB_UNAVAILABLE</h1><p>acme&#34;&gt;&lt;img src=x onerror=alert(1)&gt;</p>`
+	if body != expected {
+		t.Fatalf("Expected %s, got %s", expected, body)
+	}
+
+	// JSON clients keep the envelope
+	_, contentType, _ := doNegotiatedRequest(t, app, "acme", "application/json")
+	if contentType != fiber.MIMEApplicationJSON {
+		t.Fatalf("Expected JSON, got %s", contentType)
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TenantCSVExporter writes a ZIP of CSV files with a tenant's data, such as
+// tenantstore.TenantStore
+type TenantCSVExporter interface {
+	ExportTenantCSV(ctx context.Context, tenantSchema string, w io.Writer) error
+}
+
+// ExportHandler returns a handler streaming the request tenant's data as a
+// ZIP of CSV files, one per table, for "download my data" buttons. Mount it
+// after the middleware. The archive is written while it is sent, so large
+// tenants are never held in memory; a failure midway cuts the download
+// short, which clients see as a corrupt archive. Stores implementing
+// SchemaNamer export the mapped schema.
+//
+//	app.Get("/account/export", middleware.ExportHandler(store))
+func ExportHandler(exporter TenantCSVExporter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tenant := GetTenant(c)
+		if tenant == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "No tenant resolved")
+		}
+
+		schema, err := schemaFor(exporter, tenant)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		c.Set(fiber.HeaderContentType, "application/zip")
+		c.Attachment(exportFilename(tenant, time.Now()))
+
+		// The stream is written after the handler returns, so it cannot use
+		// the request context
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			if exporter.ExportTenantCSV(context.Background(), schema, w) == nil {
+				w.Flush()
+			}
+		})
+		return nil
+	}
+}
+
+// exportFilename names the archive after the tenant and date, keeping only
+// characters safe in a Content-Disposition filename
+func exportFilename(tenant string, now time.Time) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, tenant)
+	return fmt.Sprintf("%s-export-%s.zip", safe, now.UTC().Format("2006-01-02"))
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+var _ TenantCSVExporter = (*tenantstore.TenantStore)(nil)
+
+// csvExporter writes a fixed number of rows per table
+type csvExporter struct {
+	tables  map[string]int
+	schemas []string
+}
+
+func (e *csvExporter) ExportTenantCSV(ctx context.Context, tenantSchema string, w io.Writer) error {
+	e.schemas = append(e.schemas, tenantSchema)
+
+	archive := zip.NewWriter(w)
+	for table, rows := range e.tables {
+		file, err := archive.Create(table + ".csv")
+		if err != nil {
+			return err
+		}
+		out := csv.NewWriter(file)
+		out.Write([]string{"id", "tenant"})
+		for i := 1; i <= rows; i++ {
+			out.Write([]string{fmt.Sprint(i), tenantSchema})
+		}
+		out.Flush()
+	}
+	return archive.Close()
+}
+
+func TestExportHandler(t *testing.T) {
+	exporter := &csvExporter{tables: map[string]int{"users": 3, "orders": 5000}}
+
+	app := fiber.New()
+	app.Use(New(Config{Store: tenanttest.NewStore(t), Resolver: HeaderResolver("X-Tenant-ID")}))
+	app.Get("/export", ExportHandler(exporter))
+
+	req := httptest.NewRequest("GET", "/export", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get(fiber.HeaderContentType); got != "application/zip" {
+		t.Fatalf("Expected application/zip, got %s", got)
+	}
+	want := fmt.Sprintf(`attachment; filename="acme-export-%s.zip"`, time.Now().UTC().Format("2006-01-02"))
+	if got := resp.Header.Get(fiber.HeaderContentDisposition); got != want {
+		t.Fatalf("Expected %s, got %s", want, got)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	if len(archive.File) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(archive.File))
+	}
+	for _, file := range archive.File {
+		r, _ := file.Open()
+		records, err := csv.NewReader(r).ReadAll()
+		r.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file.Name, err)
+		}
+
+		rows := exporter.tables[strings.TrimSuffix(file.Name, ".csv")]
+		if len(records)-1 != rows {
+			t.Fatalf("Expected %d rows in %s, got %d", rows, file.Name, len(records)-1)
+		}
+		if strings.Join(records[0], ",") != "id,tenant" || records[1][1] != "acme" {
+			t.Fatalf("Unexpected records in %s: %q", file.Name, records[:2])
+		}
+	}
+}
+
+func TestExportFilename(t *testing.T) {
+	now := time.Date(2026, 3, 1, 23, 0, 0, 0, time.FixedZone("EST", -5*3600))
+	if got := exportFilename(`ac"me/../x`, now); got != "ac_me____x-export-2026-03-02.zip" {
+		t.Fatalf("Expected sanitized filename, got %s", got)
+	}
+}
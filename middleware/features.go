@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultFeatureSettingPrefix prefixes the tenant settings read by
+// SettingsFeatureProvider, as in "feature.new-billing"
+const DefaultFeatureSettingPrefix = "feature."
+
+// DefaultFeatureCacheTTL is how long SettingsFeatureProvider caches a
+// tenant's settings when CacheTTL is zero
+const DefaultFeatureCacheTTL = 30 * time.Second
+
+// FeatureProvider decides whether a feature is enabled for a tenant. Set it
+// as Config.Features and check flags with Feature and RequireFeature.
+type FeatureProvider interface {
+	FeatureEnabled(ctx context.Context, tenant, feature string) (bool, error)
+}
+
+// TenantSettingsSource returns a tenant's settings, such as the registry
+// settings of tenantstore.TenantStore
+type TenantSettingsSource interface {
+	TenantSettings(ctx context.Context, tenant string) (map[string]string, error)
+}
+
+type featuresKey struct{}
+
+// Feature reports whether the feature is enabled for the request's tenant by
+// Config.Features. It is false without a tenant or provider, and when the
+// provider fails.
+func Feature(c *fiber.Ctx, name string) bool {
+	provider, ok := c.Locals(featuresKey{}).(FeatureProvider)
+	if !ok {
+		return false
+	}
+	tenant := GetTenant(c)
+	if tenant == "" {
+		return false
+	}
+
+	enabled, err := provider.FeatureEnabled(c.UserContext(), tenant, name)
+	return err == nil && enabled
+}
+
+// RequireFeature returns a handler that responds 404 to tenants without the
+// feature, as if the route did not exist
+func RequireFeature(name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !Feature(c, name) {
+			return fiber.ErrNotFound
+		}
+		return c.Next()
+	}
+}
+
+// SettingsFeatureConfig configures NewSettingsFeatureProvider
+type SettingsFeatureConfig struct {
+	// Settings returns the tenant settings flags are read from (required).
+	// A SchemaNamer, such as tenantstore.TenantStore, is asked with the
+	// tenant's schema.
+	Settings TenantSettingsSource
+
+	// Optional: Prefix of flag settings (defaults to
+	// DefaultFeatureSettingPrefix)
+	Prefix string
+
+	// Optional: Whether features are enabled for tenants without a setting
+	// or rollout
+	Defaults map[string]bool
+
+	// Optional: Percentage of tenants, from 0 to 100, a feature is enabled
+	// for when they have no setting. Tenants are bucketed by a hash of the
+	// tenant and feature, so each keeps its answer as the percentage grows.
+	Rollouts map[string]float64
+
+	// Optional: How long settings are cached per tenant (defaults to
+	// DefaultFeatureCacheTTL, negative disables the cache)
+	CacheTTL time.Duration
+}
+
+// SettingsFeatureProvider is a FeatureProvider reading flags from tenant
+// settings. A setting named Prefix plus the feature, parsed with
+// strconv.ParseBool, overrides the rollout, which overrides the default.
+type SettingsFeatureProvider struct {
+	cfg SettingsFeatureConfig
+
+	mu    sync.Mutex
+	cache map[string]featureCacheEntry
+}
+
+type featureCacheEntry struct {
+	settings map[string]string
+	expires  time.Time
+}
+
+// NewSettingsFeatureProvider returns a provider for cfg
+func NewSettingsFeatureProvider(cfg SettingsFeatureConfig) *SettingsFeatureProvider {
+	if cfg.Settings == nil {
+		panic("SettingsFeatureProvider requires Settings")
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultFeatureSettingPrefix
+	}
+	if cfg.CacheTTL == 0 {
+		cfg.CacheTTL = DefaultFeatureCacheTTL
+	}
+	return &SettingsFeatureProvider{cfg: cfg, cache: make(map[string]featureCacheEntry)}
+}
+
+// FeatureEnabled evaluates the feature for the tenant
+func (p *SettingsFeatureProvider) FeatureEnabled(ctx context.Context, tenant, feature string) (bool, error) {
+	settings, err := p.settings(ctx, tenant)
+	if err != nil {
+		return false, err
+	}
+
+	if value, ok := settings[p.cfg.Prefix+feature]; ok {
+		if enabled, err := strconv.ParseBool(value); err == nil {
+			return enabled, nil
+		}
+	}
+	if percentage, ok := p.cfg.Rollouts[feature]; ok {
+		return rolloutBucket(tenant, feature) < percentage, nil
+	}
+	return p.cfg.Defaults[feature], nil
+}
+
+// Invalidate drops the tenant's cached settings
+func (p *SettingsFeatureProvider) Invalidate(tenant string) {
+	p.mu.Lock()
+	delete(p.cache, tenant)
+	p.mu.Unlock()
+}
+
+func (p *SettingsFeatureProvider) settings(ctx context.Context, tenant string) (map[string]string, error) {
+	if p.cfg.CacheTTL > 0 {
+		p.mu.Lock()
+		entry, ok := p.cache[tenant]
+		p.mu.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.settings, nil
+		}
+	}
+
+	schema, err := schemaFor(p.cfg.Settings, tenant)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := p.cfg.Settings.TenantSettings(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.cfg.CacheTTL > 0 {
+		// Tenants resolved from requests point into reused buffers
+		p.mu.Lock()
+		p.cache[strings.Clone(tenant)] = featureCacheEntry{settings: settings, expires: time.Now().Add(p.cfg.CacheTTL)}
+		p.mu.Unlock()
+	}
+	return settings, nil
+}
+
+// rolloutBucket places the tenant in [0, 100) for the feature
+func rolloutBucket(tenant, feature string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(feature))
+	h.Write([]byte{0})
+	h.Write([]byte(tenant))
+	return float64(h.Sum32()%10000) / 100
+}
@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+var (
+	_ TenantSettingsSource = (*tenantstore.TenantStore)(nil)
+	_ TenantSettingsSource = (*tenanttest.Store)(nil)
+)
+
+// countingSettings counts settings lookups
+type countingSettings struct {
+	*tenanttest.Store
+	calls int
+}
+
+func (s *countingSettings) TenantSettings(ctx context.Context, tenant string) (map[string]string, error) {
+	s.calls++
+	return s.Store.TenantSettings(ctx, tenant)
+}
+
+type failingSettings struct{}
+
+func (failingSettings) TenantSettings(ctx context.Context, tenant string) (map[string]string, error) {
+	return nil, errors.New("settings unavailable")
+}
+
+func TestSettingsFeatureProvider(t *testing.T) {
+	store := tenanttest.NewStore(t)
+	store.SetSettings("acme", map[string]string{
+		"feature.billing": "false",
+		"feature.reports": "true",
+		"feature.export":  "not a bool",
+	})
+
+	provider := NewSettingsFeatureProvider(SettingsFeatureConfig{
+		Settings: store,
+		Defaults: map[string]bool{"billing": true, "export": true},
+	})
+
+	tests := []struct {
+		tenant  string
+		feature string
+		want    bool
+	}{
+		{tenant: "acme", feature: "billing", want: false},
+		{tenant: "acme", feature: "reports", want: true},
+		{tenant: "acme", feature: "export", want: true},
+		{tenant: "acme", feature: "unknown", want: false},
+		{tenant: "globex", feature: "billing", want: true},
+		{tenant: "globex", feature: "reports", want: false},
+	}
+
+	for _, tt := range tests {
+		enabled, err := provider.FeatureEnabled(context.Background(), tt.tenant, tt.feature)
+		if err != nil {
+			t.Fatalf("Failed to evaluate %s for %s: %v", tt.feature, tt.tenant, err)
+		}
+		if enabled != tt.want {
+			t.Fatalf("Expected %s for %s to be %v, got %v", tt.feature, tt.tenant, tt.want, enabled)
+		}
+	}
+}
+
+func TestSettingsFeatureProviderRollout(t *testing.T) {
+	store := tenanttest.NewStore(t)
+	store.SetSettings("tenant-0", map[string]string{"feature.beta": "false"})
+
+	rollout := func(percentage float64) *SettingsFeatureProvider {
+		return NewSettingsFeatureProvider(SettingsFeatureConfig{
+			Settings: store,
+			Rollouts: map[string]float64{"beta": percentage},
+			CacheTTL: -1,
+		})
+	}
+
+	enabledFor := func(provider *SettingsFeatureProvider) map[string]bool {
+		enabled := make(map[string]bool)
+		for i := 1; i <= 1000; i++ {
+			tenant := fmt.Sprintf("tenant-%d", i)
+			on, err := provider.FeatureEnabled(context.Background(), tenant, "beta")
+			if err != nil {
+				t.Fatalf("Failed to evaluate beta for %s: %v", tenant, err)
+			}
+			if on {
+				enabled[tenant] = true
+			}
+		}
+		return enabled
+	}
+
+	if n := len(enabledFor(rollout(0))); n != 0 {
+		t.Fatalf("Expected no tenants at 0%%, got %d", n)
+	}
+	if n := len(enabledFor(rollout(100))); n != 1000 {
+		t.Fatalf("Expected every tenant at 100%%, got %d", n)
+	}
+
+	// Buckets are deterministic and grow monotonically with the percentage
+	quarter, again, half := enabledFor(rollout(25)), enabledFor(rollout(25)), enabledFor(rollout(50))
+	if len(quarter) < 200 || len(quarter) > 300 {
+		t.Fatalf("Expected about 250 tenants at 25%%, got %d", len(quarter))
+	}
+	for tenant := range quarter {
+		if !again[tenant] {
+			t.Fatalf("Expected %s to stay enabled across evaluations", tenant)
+		}
+		if !half[tenant] {
+			t.Fatalf("Expected %s enabled at 25%% to stay enabled at 50%%", tenant)
+		}
+	}
+	if len(again) != len(quarter) {
+		t.Fatalf("Expected the same tenants on every evaluation, got %d and %d", len(quarter), len(again))
+	}
+
+	// Settings override the rollout
+	if on, _ := rollout(100).FeatureEnabled(context.Background(), "tenant-0", "beta"); on {
+		t.Fatal("Expected the tenant's setting to override the rollout")
+	}
+
+	// Features are bucketed independently
+	if rolloutBucket("acme", "beta") == rolloutBucket("acme", "gamma") {
+		t.Fatal("Expected different buckets per feature")
+	}
+}
+
+func TestSettingsFeatureProviderCache(t *testing.T) {
+	settings := &countingSettings{Store: tenanttest.NewStore(t)}
+	settings.SetSettings("acme", map[string]string{"feature.reports": "true"})
+
+	provider := NewSettingsFeatureProvider(SettingsFeatureConfig{Settings: settings})
+	for i := 0; i < 3; i++ {
+		if on, _ := provider.FeatureEnabled(context.Background(), "acme", "reports"); !on {
+			t.Fatal("Expected reports to be enabled")
+		}
+	}
+	if settings.calls != 1 {
+		t.Fatalf("Expected 1 settings lookup, got %d", settings.calls)
+	}
+
+	settings.SetSettings("acme", map[string]string{"feature.reports": "false"})
+	provider.Invalidate("acme")
+	if on, _ := provider.FeatureEnabled(context.Background(), "acme", "reports"); on {
+		t.Fatal("Expected invalidation to read the new settings")
+	}
+}
+
+func TestRequireFeature(t *testing.T) {
+	store := tenanttest.NewStore(t)
+	store.SetSettings("acme", map[string]string{"feature.reports": "true"})
+
+	newApp := func(settings TenantSettingsSource) *fiber.App {
+		app := fiber.New()
+		app.Use(New(Config{
+			Store:    store,
+			Resolver: HeaderResolver("X-Tenant-ID"),
+			Features: NewSettingsFeatureProvider(SettingsFeatureConfig{Settings: settings}),
+		}))
+		app.Get("/reports", RequireFeature("reports"), func(c *fiber.Ctx) error {
+			return c.SendString("reports")
+		})
+		return app
+	}
+
+	tests := []struct {
+		name       string
+		settings   TenantSettingsSource
+		tenant     string
+		wantStatus int
+	}{
+		{name: "Enabled", settings: store, tenant: "acme", wantStatus: fiber.StatusOK},
+		{name: "Disabled", settings: store, tenant: "globex", wantStatus: fiber.StatusNotFound},
+		{name: "Provider error", settings: failingSettings{}, tenant: "acme", wantStatus: fiber.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/reports", nil)
+			req.Header.Set("X-Tenant-ID", tt.tenant)
+			resp, err := newApp(tt.settings).Test(req)
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestFeatureWithoutProvider(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if Feature(c, "reports") {
+			t.Errorf("Expected features to be off without a provider")
+		}
+		return nil
+	})
+
+	if _, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+}
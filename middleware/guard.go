@@ -0,0 +1,288 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Defaults of ResolutionGuard
+const (
+	DefaultGuardWindow           = time.Minute
+	DefaultGuardMaxFailuresPerIP = 30
+	DefaultGuardMaxNewTenants    = 60
+	DefaultGuardNegativeTTL      = 5 * time.Minute
+	DefaultGuardMaxRejected      = 10000
+)
+
+var (
+	errGuardClientThrottled = fiber.NewError(fiber.StatusTooManyRequests, "Too many failed tenant resolutions")
+	errGuardTenantRejected  = fiber.NewError(fiber.StatusTooManyRequests, "Tenant was recently rejected")
+	errGuardNewTenantsCap   = fiber.NewError(fiber.StatusTooManyRequests, "Too many new tenants")
+)
+
+// ResolutionGuard keeps hostile traffic, such as clients scanning random
+// subdomains, away from the store and the master DB. Before a tenant is
+// looked up it answers 429 with TENANT_RESOLUTION_THROTTLED when
+//
+//   - the client IP had MaxFailuresPerIP failed resolutions in the current
+//     window, counting unresolvable requests and unknown tenants
+//   - the tenant was rejected by the store within NegativeTTL, as unknown
+//     or with another 4xx status
+//   - the tenant was never served by this process and MaxNewTenants other
+//     such tenants were admitted in the current window
+//
+// Tenants served once are admitted until the process restarts, so the cap
+// only delays tenants created since, by a window at most. The state is in
+// memory of the process. Apart from the tenants served, it is bounded by the
+// limits, so it is safe with untrusted tenant names. The zero value uses the
+// defaults.
+type ResolutionGuard struct {
+	// Optional: Failed resolutions per client IP and window (defaults to
+	// DefaultGuardMaxFailuresPerIP). Client IPs are taken from c.IP(), so
+	// set fiber.Config.ProxyHeader behind a proxy.
+	MaxFailuresPerIP int
+
+	// Optional: Tenants not served before admitted per window (defaults to
+	// DefaultGuardMaxNewTenants)
+	MaxNewTenants int
+
+	// Optional: Period failures and new tenants are counted over (defaults
+	// to DefaultGuardWindow)
+	Window time.Duration
+
+	// Optional: How long rejected tenants are refused without asking the
+	// store (defaults to DefaultGuardNegativeTTL)
+	NegativeTTL time.Duration
+
+	// Optional: Rejected tenants remembered at once (defaults to
+	// DefaultGuardMaxRejected). The oldest entries beyond it are dropped.
+	MaxRejected int
+
+	now func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	failures    map[string]int
+	newTenants  map[string]struct{}
+	known       map[string]struct{}
+	rejected    map[string]time.Time
+
+	stats struct {
+		failures, rejections, throttledClients, negativeHits, newTenantsCapped atomic.Uint64
+	}
+}
+
+// GuardStats are the counters of a ResolutionGuard since it was created,
+// for alerting on scans
+type GuardStats struct {
+	// Failures counts unresolvable requests and Rejections tenants the
+	// store rejected
+	Failures   uint64 `json:"failures"`
+	Rejections uint64 `json:"rejections"`
+
+	// ThrottledClients, NegativeHits and NewTenantsCapped count the
+	// requests refused for each reason
+	ThrottledClients uint64 `json:"throttled_clients"`
+	NegativeHits     uint64 `json:"negative_hits"`
+	NewTenantsCapped uint64 `json:"new_tenants_capped"`
+
+	// RejectedTenants is the size of the negative cache
+	RejectedTenants int `json:"rejected_tenants"`
+}
+
+// Stats returns the guard's counters
+func (g *ResolutionGuard) Stats() GuardStats {
+	g.mu.Lock()
+	rejected := len(g.rejected)
+	g.mu.Unlock()
+
+	return GuardStats{
+		Failures:         g.stats.failures.Load(),
+		Rejections:       g.stats.rejections.Load(),
+		ThrottledClients: g.stats.throttledClients.Load(),
+		NegativeHits:     g.stats.negativeHits.Load(),
+		NewTenantsCapped: g.stats.newTenantsCapped.Load(),
+		RejectedTenants:  rejected,
+	}
+}
+
+// config returns the configured limits with defaults filled in
+func (g *ResolutionGuard) config() (window, negativeTTL time.Duration, maxFailures, maxNew, maxRejected int) {
+	window, negativeTTL = g.Window, g.NegativeTTL
+	maxFailures, maxNew, maxRejected = g.MaxFailuresPerIP, g.MaxNewTenants, g.MaxRejected
+	if window <= 0 {
+		window = DefaultGuardWindow
+	}
+	if negativeTTL <= 0 {
+		negativeTTL = DefaultGuardNegativeTTL
+	}
+	if maxFailures <= 0 {
+		maxFailures = DefaultGuardMaxFailuresPerIP
+	}
+	if maxNew <= 0 {
+		maxNew = DefaultGuardMaxNewTenants
+	}
+	if maxRejected <= 0 {
+		maxRejected = DefaultGuardMaxRejected
+	}
+	return
+}
+
+// roll starts a new window once the current one is over and returns the
+// time left in the window. Callers hold mu.
+func (g *ResolutionGuard) roll(now time.Time, window time.Duration) time.Duration {
+	if g.known == nil {
+		g.known = make(map[string]struct{})
+		g.rejected = make(map[string]time.Time)
+	}
+	if g.failures == nil || now.Sub(g.windowStart) >= window {
+		g.windowStart = now
+		g.failures = make(map[string]int)
+		g.newTenants = make(map[string]struct{})
+	}
+	return window - now.Sub(g.windowStart)
+}
+
+// clock returns the current time
+func (g *ResolutionGuard) clock() time.Time {
+	if g.now != nil {
+		return g.now()
+	}
+	return time.Now()
+}
+
+// allowClient refuses clients with too many failures in the window
+func (g *ResolutionGuard) allowClient(c *fiber.Ctx) error {
+	window, _, maxFailures, _, _ := g.config()
+	now := g.clock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	left := g.roll(now, window)
+	if g.failures[c.IP()] < maxFailures {
+		return nil
+	}
+	g.stats.throttledClients.Add(1)
+	return throttle(c, left, errGuardClientThrottled)
+}
+
+// admit refuses recently rejected tenants and new tenants beyond the cap
+func (g *ResolutionGuard) admit(c *fiber.Ctx, tenant string) error {
+	window, _, _, maxNew, _ := g.config()
+	now := g.clock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	left := g.roll(now, window)
+	if _, ok := g.known[tenant]; ok {
+		return nil
+	}
+	if expires, ok := g.rejected[tenant]; ok {
+		if now.Before(expires) {
+			g.failures[c.IP()]++
+			g.stats.negativeHits.Add(1)
+			return throttle(c, expires.Sub(now), errGuardTenantRejected)
+		}
+		delete(g.rejected, tenant)
+	}
+	if _, ok := g.newTenants[tenant]; ok {
+		return nil
+	}
+	if len(g.newTenants) >= maxNew {
+		g.stats.newTenantsCapped.Add(1)
+		return throttle(c, left, errGuardNewTenantsCap)
+	}
+	g.newTenants[tenant] = struct{}{}
+	return nil
+}
+
+// fail counts a request of the client without a tenant
+func (g *ResolutionGuard) fail(c *fiber.Ctx) {
+	window, _, _, _, _ := g.config()
+	now := g.clock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.roll(now, window)
+	g.failures[c.IP()]++
+	g.stats.failures.Add(1)
+}
+
+// reject remembers a tenant the store rejected and counts it against the
+// client
+func (g *ResolutionGuard) reject(c *fiber.Ctx, tenant string) {
+	window, negativeTTL, _, _, maxRejected := g.config()
+	now := g.clock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.roll(now, window)
+	g.failures[c.IP()]++
+	g.stats.rejections.Add(1)
+	if _, ok := g.rejected[tenant]; !ok && len(g.rejected) >= maxRejected {
+		g.evict(now, maxRejected)
+	}
+	g.rejected[tenant] = now.Add(negativeTTL)
+}
+
+// evict drops the expired rejections, or the oldest one when none expired.
+// Callers hold mu.
+func (g *ResolutionGuard) evict(now time.Time, maxRejected int) {
+	var oldest string
+	var oldestExpiry time.Time
+	for tenant, expires := range g.rejected {
+		if !now.Before(expires) {
+			delete(g.rejected, tenant)
+			continue
+		}
+		if oldest == "" || expires.Before(oldestExpiry) {
+			oldest, oldestExpiry = tenant, expires
+		}
+	}
+	if len(g.rejected) >= maxRejected {
+		delete(g.rejected, oldest)
+	}
+}
+
+// serve admits the tenant from now on
+func (g *ResolutionGuard) serve(tenant string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.known == nil {
+		g.known = make(map[string]struct{})
+		g.rejected = make(map[string]time.Time)
+	}
+	g.known[tenant] = struct{}{}
+	delete(g.rejected, tenant)
+}
+
+// storeFailed remembers the tenant when the store's error means it does not
+// serve the tenant, rather than that it is unavailable, and returns err. A
+// nil guard only returns err.
+func (g *ResolutionGuard) storeFailed(c *fiber.Ctx, tenant string, err *Error) *Error {
+	if g == nil {
+		return err
+	}
+	if err.Code == ErrorCodeTenantNotFound ||
+		err.Status >= fiber.StatusBadRequest && err.Status < fiber.StatusInternalServerError && err.Status != fiber.StatusTooManyRequests {
+		g.reject(c, tenant)
+	}
+	return err
+}
+
+// throttle sets Retry-After and returns the guard's error
+func throttle(c *fiber.Ctx, retryAfter time.Duration, err error) *Error {
+	seconds := max(int(math.Ceil(retryAfter.Seconds())), 1)
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return newError(ErrorCodeTenantResolutionThrottled, 0, err)
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+// scannedStore serves acme and globex and rejects other tenants as unknown,
+// counting every lookup
+type scannedStore struct {
+	*tenanttest.Store
+	calls int
+}
+
+func (s *scannedStore) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	s.calls++
+	if tenantSchema != "acme" && tenantSchema != "globex" {
+		return nil, fiber.NewError(fiber.StatusNotFound, "unknown tenant")
+	}
+	return s.Store.GetTenantDB(ctx, tenantSchema)
+}
+
+// newGuardedApp returns an app taking client IPs from X-Forwarded-For
+func newGuardedApp(store TenantStore, guard *ResolutionGuard) *fiber.App {
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor})
+	app.Use(New(Config{
+		Store:           store,
+		Resolver:        SubdomainResolverWithConfig(SubdomainConfig{BaseDomain: "example.com"}),
+		ResolutionGuard: guard,
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+	return app
+}
+
+// guardedRequest sends a request for host from ip and returns the status
+func guardedRequest(t *testing.T, app *fiber.App, host, ip string) int {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = host
+	req.Header.Set(fiber.HeaderXForwardedFor, ip)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestResolutionGuardScanningClient(t *testing.T) {
+	store := &scannedStore{Store: tenanttest.NewStore(t)}
+	guard := &ResolutionGuard{MaxFailuresPerIP: 10}
+	app := newGuardedApp(store, guard)
+
+	throttled := 0
+	for i := 0; i < 200; i++ {
+		status := guardedRequest(t, app, fmt.Sprintf("scan%d.example.com", i), "203.0.113.7")
+		if status == fiber.StatusTooManyRequests {
+			throttled++
+		}
+	}
+	if store.calls != 10 {
+		t.Fatalf("Expected the store to see 10 scanned tenants, got %d", store.calls)
+	}
+	if throttled != 190 {
+		t.Fatalf("Expected 190 requests to be throttled, got %d", throttled)
+	}
+
+	// Garbage hosts count as failures too, and other clients are served
+	if status := guardedRequest(t, app, "example.com", "203.0.113.8"); status != fiber.StatusBadRequest {
+		t.Fatalf("Expected 400 for a host without a tenant, got %d", status)
+	}
+	if status := guardedRequest(t, app, "acme.example.com", "198.51.100.1"); status != fiber.StatusOK {
+		t.Fatalf("Expected acme to be served, got %d", status)
+	}
+
+	stats := guard.Stats()
+	if stats.Rejections != 10 || stats.Failures != 1 || stats.ThrottledClients != 190 || stats.RejectedTenants != 10 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestResolutionGuardDistributedScan(t *testing.T) {
+	store := &scannedStore{Store: tenanttest.NewStore(t)}
+	guard := &ResolutionGuard{MaxNewTenants: 5}
+	app := newGuardedApp(store, guard)
+
+	// Served tenants stay admitted whatever the cap
+	if status := guardedRequest(t, app, "acme.example.com", "198.51.100.1"); status != fiber.StatusOK {
+		t.Fatalf("Expected acme to be served, got %d", status)
+	}
+
+	// Every scanned tenant comes from another client
+	for i := 0; i < 100; i++ {
+		guardedRequest(t, app, fmt.Sprintf("scan%d.example.com", i), fmt.Sprintf("10.0.%d.%d", i/250, i%250+1))
+	}
+	if store.calls != 5 {
+		t.Fatalf("Expected the store to see acme and 4 scanned tenants, got %d calls", store.calls)
+	}
+	if status := guardedRequest(t, app, "acme.example.com", "198.51.100.1"); status != fiber.StatusOK {
+		t.Fatalf("Expected acme to be served during the scan, got %d", status)
+	}
+
+	// Recently rejected tenants are refused without asking the store
+	calls := store.calls
+	for i := 0; i < 10; i++ {
+		if status := guardedRequest(t, app, "scan0.example.com", fmt.Sprintf("172.16.0.%d", i+1)); status != fiber.StatusTooManyRequests {
+			t.Fatalf("Expected 429 for a rejected tenant, got %d", status)
+		}
+	}
+	if store.calls != calls {
+		t.Fatalf("Expected the negative cache to spare the store, got %d calls", store.calls-calls)
+	}
+
+	stats := guard.Stats()
+	if stats.NewTenantsCapped != 96 || stats.NegativeHits != 10 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestResolutionGuardWindow(t *testing.T) {
+	now := time.Now()
+	store := &scannedStore{Store: tenanttest.NewStore(t)}
+	guard := &ResolutionGuard{MaxFailuresPerIP: 1, MaxNewTenants: 2, NegativeTTL: 90 * time.Second}
+	guard.now = func() time.Time { return now }
+	app := newGuardedApp(store, guard)
+
+	guardedRequest(t, app, "scan.example.com", "203.0.113.7")
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "acme.example.com"
+	req.Header.Set(fiber.HeaderXForwardedFor, "203.0.113.7")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusTooManyRequests || resp.Header.Get(fiber.HeaderRetryAfter) != "60" {
+		t.Fatalf("Expected 429 with Retry-After: 60, got %d with %q", resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+
+	// The client is served again in the next window, the rejection outlives it
+	now = now.Add(time.Minute)
+	if status := guardedRequest(t, app, "acme.example.com", "203.0.113.7"); status != fiber.StatusOK {
+		t.Fatalf("Expected the client to be served in the next window, got %d", status)
+	}
+	if status := guardedRequest(t, app, "scan.example.com", "198.51.100.1"); status != fiber.StatusTooManyRequests {
+		t.Fatalf("Expected the rejection to last NegativeTTL, got %d", status)
+	}
+	now = now.Add(31 * time.Second)
+	if status := guardedRequest(t, app, "scan.example.com", "198.51.100.2"); status != fiber.StatusNotFound {
+		t.Fatalf("Expected the store to be asked again, got %d", status)
+	}
+}
+
+func TestResolutionGuardBoundsRejections(t *testing.T) {
+	guard := &ResolutionGuard{MaxRejected: 3}
+	app := fiber.New()
+	c := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(c)
+	for i := 0; i < 10; i++ {
+		guard.reject(c, fmt.Sprintf("scan%d", i))
+	}
+	if stats := guard.Stats(); stats.RejectedTenants != 3 {
+		t.Fatalf("Expected 3 remembered rejections, got %d", stats.RejectedTenants)
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"hash/fnv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTenantBucket maps the request's tenant to one of buckets, from 0 to
+// buckets-1, with the algorithm of tenantstore.TenantHash: the 32-bit FNV-1a
+// hash of the tenant modulo buckets. Handlers and background jobs holding
+// the same identifier therefore pick the same bucket. It returns -1 for
+// requests without a tenant and panics if buckets is less than 1.
+func GetTenantBucket(c *fiber.Ctx, buckets int) int {
+	if buckets < 1 {
+		panic("middleware: GetTenantBucket buckets must be positive")
+	}
+	tenant := GetTenant(c)
+	if tenant == "" {
+		return -1
+	}
+	return tenantBucket(tenant, buckets)
+}
+
+// tenantBucket must match tenantstore.TenantHash, which this package cannot
+// import
+func tenantBucket(tenant string, buckets int) int {
+	h := fnv.New32a()
+	h.Write([]byte(tenant))
+	return int(uint64(h.Sum32()) % uint64(buckets))
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+func TestGetTenantBucket(t *testing.T) {
+	app := fiber.New()
+	app.Get("/bucket", func(c *fiber.Ctx) error {
+		return c.SendString(strconv.Itoa(GetTenantBucket(c, 1000)))
+	})
+	app.Use(New(Config{
+		Store:    tenanttest.NewStore(t),
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+	app.Get("/tenant/bucket", func(c *fiber.Ctx) error {
+		return c.SendString(strconv.Itoa(GetTenantBucket(c, 1000)))
+	})
+
+	// The same outputs as tenantstore.TenantHash
+	for tenant, want := range map[string]string{"tenant_a": "37", "tenant_b": "180", "acme": "615"} {
+		req := httptest.NewRequest("GET", "/tenant/bucket", nil)
+		req.Header.Set("X-Tenant-ID", tenant)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		if body, _ := io.ReadAll(resp.Body); string(body) != want {
+			t.Fatalf("Expected bucket %s for %s, got %s", want, tenant, body)
+		}
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/bucket", nil))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "-1" {
+		t.Fatalf("Expected -1 without a tenant, got %s", body)
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+type hookTestItem struct {
+	ID     uint `gorm:"primaryKey"`
+	Schema string
+}
+
+// BeforeCreate stamps the tenant the hook sees on the record
+func (i *hookTestItem) BeforeCreate(tx *gorm.DB) error {
+	i.Schema, _ = tenantstore.SchemaFromDB(tx)
+	return nil
+}
+
+func TestHooksSeeTenantSchema(t *testing.T) {
+	for _, transactional := range []bool{false, true} {
+		store := tenanttest.NewStore(t, &hookTestItem{})
+
+		app := fiber.New()
+		app.Use(New(Config{
+			Store:                 store,
+			Resolver:              HeaderResolver("X-Tenant-ID"),
+			TransactionalRequests: transactional,
+		}))
+
+		app.Post("/items", func(c *fiber.Ctx) error {
+			// Derived sessions keep the schema
+			db := GetTenantDB(c).WithContext(c.UserContext()).Session(&gorm.Session{})
+			return db.Create(&hookTestItem{}).Error
+		})
+
+		for _, tenant := range []string{"tenant1", "tenant2"} {
+			req := httptest.NewRequest("POST", "/items", nil)
+			req.Header.Set("X-Tenant-ID", tenant)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+			}
+		}
+
+		for _, tenant := range []string{"tenant1", "tenant2"} {
+			db, _ := store.GetTenantDB(context.Background(), tenant)
+
+			var items []hookTestItem
+			if err := db.Find(&items).Error; err != nil {
+				t.Fatalf("Failed to load items: %v", err)
+			}
+			if len(items) != 1 || items[0].Schema != tenant {
+				t.Fatalf("Expected one item stamped %s (transactional %v), got %+v", tenant, transactional, items)
+			}
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TenantAssertionHeader carries a signed tenant assertion between services
+const TenantAssertionHeader = "X-Tenant-Assertion"
+
+// ClientOption configures the client returned by TenantHTTPClient
+type ClientOption func(*tenantTransport)
+
+// WithTenantAssertion signs outgoing requests with an HMAC-SHA256 assertion
+// over the request method and path, the tenant, the current time and a
+// random nonce, sent in TenantAssertionHeader. Receiving services verify it
+// with SignedHeaderResolver.
+func WithTenantAssertion(secret []byte) ClientOption {
+	return func(t *tenantTransport) {
+		t.secret = secret
+	}
+}
+
+// TenantHTTPClient returns a copy of base whose requests carry the resolved
+// tenant in the given header. A nil base uses http.DefaultClient.
+func TenantHTTPClient(c *fiber.Ctx, base *http.Client, header string, opts ...ClientOption) *http.Client {
+	if base == nil {
+		base = http.DefaultClient
+	}
+
+	transport := &tenantTransport{
+		base:   base.Transport,
+		header: header,
+		// Copy the tenant so the client can outlive the request
+		tenant: strings.Clone(GetTenant(c)),
+	}
+	if transport.base == nil {
+		transport.base = http.DefaultTransport
+	}
+	for _, opt := range opts {
+		opt(transport)
+	}
+
+	client := *base
+	client.Transport = transport
+	return &client
+}
+
+// tenantTransport injects tenant headers into outgoing requests
+type tenantTransport struct {
+	base   http.RoundTripper
+	header string
+	tenant string
+	secret []byte
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *tenantTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+
+	if t.tenant != "" {
+		req.Header.Set(t.header, t.tenant)
+		if t.secret != nil {
+			nonce, err := newAssertionNonce()
+			if err != nil {
+				return nil, err
+			}
+			method := req.Method
+			if method == "" {
+				method = http.MethodGet
+			}
+			assertion := signTenantAssertion(t.secret, method, req.URL.EscapedPath(), t.tenant, time.Now().Unix(), nonce)
+			req.Header.Set(TenantAssertionHeader, assertion)
+		}
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// Tenant assertion failures are shared like the resolver errors. Invalid
+// assertions stop ChainResolvers, so a forged one cannot fall through to an
+// unsigned header.
+var (
+	errNoTenantAssertion       = fiber.NewError(fiber.StatusBadRequest, "Tenant assertion header not found")
+	errInvalidTenantAssertion  = fmt.Errorf("%w: %w", ErrTenantPresentInvalid, fiber.NewError(fiber.StatusUnauthorized, "Invalid tenant assertion"))
+	errExpiredTenantAssertion  = fmt.Errorf("%w: %w", ErrTenantPresentInvalid, fiber.NewError(fiber.StatusUnauthorized, "Tenant assertion expired"))
+	errReplayedTenantAssertion = fmt.Errorf("%w: %w", ErrTenantPresentInvalid, fiber.NewError(fiber.StatusUnauthorized, "Tenant assertion was already used"))
+)
+
+// newAssertionNonce returns a random hex nonce for a tenant assertion
+func newAssertionNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate tenant assertion nonce: %w", err)
+	}
+	return hex.EncodeToString(nonce), nil
+}
+
+// signTenantAssertion builds an assertion of the form
+// tenant.timestamp.nonce.signature for a request
+func signTenantAssertion(secret []byte, method, path, tenant string, timestamp int64, nonce string) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	return tenant + "." + ts + "." + nonce + "." + tenantAssertionMAC(secret, method, path, tenant, ts, nonce)
+}
+
+// tenantAssertionMAC computes the hex encoded HMAC of the request method and
+// path, tenant, timestamp and nonce
+func tenantAssertionMAC(secret []byte, method, path, tenant, timestamp, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{strings.ToUpper(method), path, tenant, timestamp, nonce}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedHeaderResolver extracts tenant from a signed assertion produced by
+// TenantHTTPClient with WithTenantAssertion. Assertions with an invalid
+// signature, signed for another method or path, or with a timestamp more
+// than maxSkew away from now are rejected. Each resolver accepts a nonce
+// once while its assertion is valid. Instances do not share nonces, so
+// behind a load balancer a captured assertion can still be replayed once on
+// each other instance, for the same method and path, within maxSkew.
+func SignedHeaderResolver(secret []byte, maxSkew time.Duration) TenantResolver {
+	nonces := &assertionNonces{ttl: 2 * maxSkew, seen: make(map[string]time.Time)}
+	return func(c *fiber.Ctx) (string, error) {
+		assertion := c.Get(TenantAssertionHeader)
+		if assertion == "" {
+			return "", errNoTenantAssertion
+		}
+
+		// The tenant may contain dots, so split from the right
+		parts := make([]string, 3)
+		rest := assertion
+		for i := len(parts) - 1; i >= 0; i-- {
+			idx := strings.LastIndex(rest, ".")
+			if idx <= 0 {
+				return "", errInvalidTenantAssertion
+			}
+			parts[i] = rest[idx+1:]
+			rest = rest[:idx]
+		}
+		tenant, ts, nonce, signature := rest, parts[0], parts[1], parts[2]
+
+		path := string(c.Request().URI().PathOriginal())
+		expected := tenantAssertionMAC(secret, c.Method(), path, tenant, ts, nonce)
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			return "", errInvalidTenantAssertion
+		}
+
+		timestamp, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return "", errInvalidTenantAssertion
+		}
+
+		skew := time.Since(time.Unix(timestamp, 0))
+		if skew > maxSkew || skew < -maxSkew {
+			return "", errExpiredTenantAssertion
+		}
+
+		if !nonces.use(nonce, time.Now()) {
+			return "", errReplayedTenantAssertion
+		}
+
+		return tenant, nil
+	}
+}
+
+// assertionNonces records the nonces of accepted assertions until they
+// expire
+type assertionNonces struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextSweep time.Time
+}
+
+// use records the nonce and reports whether it was unused
+func (n *assertionNonces) use(nonce string, now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if now.After(n.nextSweep) {
+		for seen, expires := range n.seen {
+			if now.After(expires) {
+				delete(n.seen, seen)
+			}
+		}
+		n.nextSweep = now.Add(n.ttl)
+	}
+
+	if expires, ok := n.seen[nonce]; ok && !now.After(expires) {
+		return false
+	}
+	// Fiber strings point into buffers reused by the next request
+	n.seen[strings.Clone(nonce)] = now.Add(n.ttl)
+	return true
+}
@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+func TestTenantHTTPClientForwardsTenant(t *testing.T) {
+	secret := []byte("shared-secret")
+
+	// Downstream service verifying the signed assertion
+	downstream := fiber.New()
+	downstream.Use(New(Config{
+		Store:    tenanttest.NewStore(t),
+		Resolver: SignedHeaderResolver(secret, time.Minute),
+	}))
+	downstream.Get("/whoami", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c) + "|" + c.Get("X-Tenant-ID"))
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := downstream.Test(r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		w.WriteHeader(resp.StatusCode)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	// Upstream service calling downstream on behalf of the tenant
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:    tenanttest.NewStore(t),
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+	app.Get("/proxy", func(c *fiber.Ctx) error {
+		client := TenantHTTPClient(c, nil, "X-Tenant-ID", WithTenantAssertion(secret))
+
+		resp, err := client.Get(server.URL + "/whoami?page=2")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return c.Status(resp.StatusCode).Send(body)
+	})
+
+	req := httptest.NewRequest("GET", "/proxy", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", resp.StatusCode, string(body))
+	}
+
+	if string(body) != "tenant1|tenant1" {
+		t.Fatalf("Expected tenant forwarded in both headers, got '%s'", string(body))
+	}
+}
+
+func TestTenantHTTPClientDoesNotModifyRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Tenant-ID")))
+	}))
+	defer server.Close()
+
+	app := fiber.New()
+	app.Get("/test", func(c *fiber.Ctx) error {
+		c.Locals("tenant", "tenant1")
+
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		resp, err := TenantHTTPClient(c, nil, "X-Tenant-ID").Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if req.Header.Get("X-Tenant-ID") != "" {
+			t.Fatal("Expected caller's request to be left untouched")
+		}
+		return nil
+	})
+
+	app.Test(httptest.NewRequest("GET", "/test", nil))
+}
+
+func TestSignedHeaderResolver(t *testing.T) {
+	secret := []byte("shared-secret")
+	now := time.Now().Unix()
+
+	valid := signTenantAssertion(secret, "GET", "/test", "tenant1", now, "n1")
+
+	tests := []struct {
+		name       string
+		assertion  string
+		wantTenant string
+		wantStatus int
+	}{
+		{
+			name:       "Valid assertion",
+			assertion:  valid,
+			wantTenant: "tenant1",
+			wantStatus: fiber.StatusOK,
+		},
+		{
+			name:       "Tenant containing dots",
+			assertion:  signTenantAssertion(secret, "GET", "/test", "agency.client1", now, "n2"),
+			wantTenant: "agency.client1",
+			wantStatus: fiber.StatusOK,
+		},
+		{
+			name:       "Missing assertion",
+			wantStatus: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Tampered tenant",
+			assertion:  "tenant2" + strings.TrimPrefix(valid, "tenant1"),
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "Tampered timestamp",
+			assertion:  strings.Replace(valid, ".", ".9", 1),
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "Wrong secret",
+			assertion:  signTenantAssertion([]byte("other-secret"), "GET", "/test", "tenant1", now, "n3"),
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "Expired assertion",
+			assertion:  signTenantAssertion(secret, "GET", "/test", "tenant1", now-600, "n4"),
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "Assertion from the future",
+			assertion:  signTenantAssertion(secret, "GET", "/test", "tenant1", now+600, "n5"),
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "Replayed assertion",
+			assertion:  valid,
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "Signed for another path",
+			assertion:  signTenantAssertion(secret, "GET", "/other", "tenant1", now, "n6"),
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "Signed for another method",
+			assertion:  signTenantAssertion(secret, "POST", "/test", "tenant1", now, "n7"),
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "Malformed assertion",
+			assertion:  "garbage",
+			wantStatus: fiber.StatusUnauthorized,
+		},
+	}
+
+	resolver := SignedHeaderResolver(secret, time.Minute)
+	app := fiber.New()
+	app.Get("/test", func(c *fiber.Ctx) error {
+		tenant, err := resolver(c)
+		if err != nil {
+			return err
+		}
+		return c.SendString(tenant)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test?page=2", nil)
+			if tt.assertion != "" {
+				req.Header.Set(TenantAssertionHeader, tt.assertion)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+
+			if tt.wantTenant != "" {
+				body, _ := io.ReadAll(resp.Body)
+				if string(body) != tt.wantTenant {
+					t.Fatalf("Expected tenant '%s', got '%s'", tt.wantTenant, string(body))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Defaults of IdempotencyConfig
+const (
+	DefaultIdempotencyHeader = "Idempotency-Key"
+	DefaultIdempotencyTTL    = 24 * time.Hour
+	DefaultIdempotencyWait   = 5 * time.Second
+	DefaultIdempotencyLock   = time.Minute
+	DefaultIdempotencyPurge  = time.Hour
+)
+
+// IdempotencyReplayedHeader is set to "true" on replayed responses
+const IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength is the size of the key column
+const maxIdempotencyKeyLength = 255
+
+// idempotencyPollInterval is how often requests waiting for the request
+// holding their key check whether it finished
+var idempotencyPollInterval = 50 * time.Millisecond
+
+var (
+	errIdempotencyKeyTooLong  = fiber.NewError(fiber.StatusBadRequest, "Idempotency key is too long")
+	errIdempotencyKeyReused   = fiber.NewError(fiber.StatusConflict, "Idempotency key was used for a different request")
+	errIdempotencyInProgress  = fiber.NewError(fiber.StatusConflict, "A request with this idempotency key is in progress")
+	errIdempotencyUnavailable = fiber.NewError(fiber.StatusServiceUnavailable, "Idempotency keys unavailable")
+)
+
+// idempotencyRecord is a key of the mt_idempotency_keys table. Keys are
+// claimed by an incomplete record and completed with the response.
+type idempotencyRecord struct {
+	IdempotencyKey string `gorm:"primaryKey;size:255"`
+	RequestHash    string `gorm:"size:64;not null"`
+	Completed      bool   `gorm:"not null;default:false"`
+	Status         int
+	ContentType    string
+	Body           []byte
+	ExpiresAt      time.Time `gorm:"not null;index"`
+	CreatedAt      time.Time
+}
+
+func (idempotencyRecord) TableName() string {
+	return "mt_idempotency_keys"
+}
+
+// IdempotencyConfig configures Idempotency
+type IdempotencyConfig struct {
+	// Store provides the tenant databases keys are stored in (required)
+	Store TenantStore
+
+	// Optional: Request header of the key (defaults to
+	// DefaultIdempotencyHeader)
+	Header string
+
+	// Optional: Methods keys apply to (default to POST and PATCH)
+	Methods []string
+
+	// Optional: How long responses are replayed (defaults to
+	// DefaultIdempotencyTTL)
+	TTL time.Duration
+
+	// Optional: How long a retry waits for the request holding its key
+	// before responding 409 (defaults to DefaultIdempotencyWait)
+	Wait time.Duration
+
+	// Optional: How long a request may hold its key; retries run again
+	// after it, such as when the instance died mid-request (defaults to
+	// DefaultIdempotencyLock)
+	LockTimeout time.Duration
+
+	// Optional: How often a tenant's expired keys are deleted, on its
+	// requests (defaults to DefaultIdempotencyPurge, negative disables it)
+	PurgeInterval time.Duration
+
+	// Optional: Locals key the tenant middleware stores the tenant under
+	ContextKey string
+}
+
+// Idempotency replays the responses of retried requests. Requests sending
+// an idempotency key run once per tenant and key; retries within TTL get the
+// stored status and body with IdempotencyReplayedHeader, and a key reused
+// for a different method, URL or body gets 409. Retries arriving while the
+// first request runs wait for its response. Responses with a status of 500
+// or more, and handler errors, are not stored, so retries run again.
+//
+// Keys are stored in the tenant schema's mt_idempotency_keys table, created
+// on a tenant's first keyed request. Expired keys are deleted on the
+// tenant's requests every PurgeInterval, or with PurgeIdempotencyKeys. Mount
+// it after New; requests without a tenant or key pass through.
+//
+//	app.Use(middleware.New(cfg))
+//	app.Post("/payments", middleware.Idempotency(middleware.IdempotencyConfig{Store: store}), createPayment)
+func Idempotency(cfg IdempotencyConfig) fiber.Handler {
+	if cfg.Store == nil {
+		panic("Idempotency requires a Store")
+	}
+	if cfg.Header == "" {
+		cfg.Header = DefaultIdempotencyHeader
+	}
+	if len(cfg.Methods) == 0 {
+		cfg.Methods = []string{fiber.MethodPost, fiber.MethodPatch}
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultIdempotencyTTL
+	}
+	if cfg.Wait <= 0 {
+		cfg.Wait = DefaultIdempotencyWait
+	}
+	if cfg.LockTimeout <= 0 {
+		cfg.LockTimeout = DefaultIdempotencyLock
+	}
+	if cfg.PurgeInterval == 0 {
+		cfg.PurgeInterval = DefaultIdempotencyPurge
+	}
+
+	keys := &idempotencyKeys{cfg: cfg, tenants: make(map[string]*idempotencyTenant)}
+	return keys.handle
+}
+
+// idempotencyKeys tracks which tenants have the table and when their
+// expired keys are next deleted
+type idempotencyKeys struct {
+	cfg IdempotencyConfig
+
+	mu      sync.Mutex
+	tenants map[string]*idempotencyTenant
+}
+
+// idempotencyTenant is the table state of a tenant
+type idempotencyTenant struct {
+	// migrate serializes the tenant's table creation, so other tenants'
+	// requests never wait for it
+	migrate  sync.Mutex
+	migrated atomic.Bool
+
+	// nextPurge is guarded by idempotencyKeys.mu
+	nextPurge time.Time
+}
+
+func (k *idempotencyKeys) handle(c *fiber.Ctx) error {
+	tenant := GetTenant(c, k.cfg.ContextKey)
+	key := c.Get(k.cfg.Header)
+	if tenant == "" || key == "" || !k.keyed(c.Method()) {
+		return c.Next()
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return errIdempotencyKeyTooLong
+	}
+
+	// Fiber strings point into buffers reused by the next request
+	tenant, key = strings.Clone(tenant), strings.Clone(key)
+
+	// The request's DB may be its transaction, which would hide claims
+	// from concurrent retries
+	db, err := k.cfg.Store.GetTenantDB(c.UserContext(), tenant)
+	if err != nil {
+		return storeError(c, err)
+	}
+	db = db.WithContext(c.UserContext())
+	if err := k.prepare(tenant, db); err != nil {
+		return errIdempotencyUnavailable
+	}
+
+	hash := requestHash(c)
+	deadline := time.Now().Add(k.cfg.Wait)
+	for {
+		record, claimed, err := k.claim(db, key, hash)
+		if err != nil {
+			return errIdempotencyUnavailable
+		}
+		if claimed {
+			return k.run(c, db, key)
+		}
+		if record.RequestHash != hash {
+			return errIdempotencyKeyReused
+		}
+		if record.Completed {
+			c.Status(record.Status)
+			if record.ContentType != "" {
+				c.Set(fiber.HeaderContentType, record.ContentType)
+			}
+			c.Set(IdempotencyReplayedHeader, "true")
+			return c.Send(record.Body)
+		}
+		if time.Now().After(deadline) {
+			return errIdempotencyInProgress
+		}
+
+		select {
+		case <-c.UserContext().Done():
+			return errIdempotencyInProgress
+		case <-time.After(idempotencyPollInterval):
+		}
+	}
+}
+
+func (k *idempotencyKeys) keyed(method string) bool {
+	for _, m := range k.cfg.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// prepare creates the tenant's table on its first keyed request and deletes
+// expired keys when they are due. The database calls run outside k.mu.
+func (k *idempotencyKeys) prepare(tenant string, db *gorm.DB) error {
+	now := time.Now()
+	k.mu.Lock()
+	state, ok := k.tenants[tenant]
+	if !ok {
+		state = new(idempotencyTenant)
+		k.tenants[tenant] = state
+	}
+	// Claim the purge, so concurrent requests skip it
+	purge := k.cfg.PurgeInterval > 0 && now.After(state.nextPurge)
+	if purge {
+		state.nextPurge = now.Add(k.cfg.PurgeInterval)
+	}
+	k.mu.Unlock()
+
+	if !state.migrated.Load() {
+		state.migrate.Lock()
+		if !state.migrated.Load() {
+			if err := db.AutoMigrate(&idempotencyRecord{}); err != nil {
+				state.migrate.Unlock()
+				return err
+			}
+			state.migrated.Store(true)
+		}
+		state.migrate.Unlock()
+	}
+
+	if purge {
+		// A failed purge is retried on the next interval
+		if _, err := PurgeIdempotencyKeys(db.Statement.Context, db); err != nil {
+			log.Printf("WARN failed to purge idempotency keys for tenant %s: %v", tenant, err)
+		}
+	}
+	return nil
+}
+
+// claim inserts an incomplete record for the key, or returns the key's
+// record when it exists and has not expired
+func (k *idempotencyKeys) claim(db *gorm.DB, key, hash string) (idempotencyRecord, bool, error) {
+	now := time.Now()
+	record := idempotencyRecord{IdempotencyKey: key, RequestHash: hash, ExpiresAt: now.Add(k.cfg.LockTimeout)}
+
+	// The second attempt follows the removal of an expired record
+	for attempt := 0; attempt < 2; attempt++ {
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			return record, false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return record, true, nil
+		}
+
+		var existing idempotencyRecord
+		err := db.Where("idempotency_key = ?", key).Take(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return record, false, err
+		}
+		if existing.ExpiresAt.After(now) {
+			return existing, false, nil
+		}
+		if err := db.Where("idempotency_key = ? AND expires_at <= ?", key, now).Delete(&idempotencyRecord{}).Error; err != nil {
+			return record, false, err
+		}
+	}
+	return record, false, errors.New("idempotency key was claimed and released concurrently")
+}
+
+// run executes the handler for a claimed key and stores its response, or
+// releases the key for retries when it failed
+func (k *idempotencyKeys) run(c *fiber.Ctx, db *gorm.DB, key string) error {
+	err := c.Next()
+
+	// Finish even when the client went away, so retries are not blocked
+	db = db.WithContext(context.WithoutCancel(c.UserContext()))
+	status := c.Response().StatusCode()
+	if err != nil || status >= fiber.StatusInternalServerError {
+		db.Where("idempotency_key = ?", key).Delete(&idempotencyRecord{})
+		return err
+	}
+
+	update := db.Model(&idempotencyRecord{}).Where("idempotency_key = ?", key).Updates(map[string]interface{}{
+		"completed":    true,
+		"status":       status,
+		"content_type": string(c.Response().Header.ContentType()),
+		"body":         append([]byte(nil), c.Response().Body()...),
+		"expires_at":   time.Now().Add(k.cfg.TTL),
+	})
+	if update.Error != nil {
+		db.Where("idempotency_key = ?", key).Delete(&idempotencyRecord{})
+	}
+	return nil
+}
+
+// requestHash identifies a request by its method, URL and body
+func requestHash(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method()))
+	h.Write([]byte{0})
+	h.Write([]byte(c.OriginalURL()))
+	h.Write([]byte{0})
+	h.Write(c.Body())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// PurgeIdempotencyKeys deletes the expired keys of a tenant DB and returns
+// how many it deleted. Idempotency deletes them on the tenant's requests;
+// run it with worker.FanOut for tenants without keyed requests.
+//
+//	worker.FanOut(ctx, store, func(ctx context.Context, db *gorm.DB) error {
+//		_, err := middleware.PurgeIdempotencyKeys(ctx, db)
+//		return err
+//	}, worker.FanOutOptions{ContinueOnError: true})
+func PurgeIdempotencyKeys(ctx context.Context, db *gorm.DB) (int64, error) {
+	db = db.WithContext(ctx)
+	if !db.Migrator().HasTable(&idempotencyRecord{}) {
+		return 0, nil
+	}
+	result := db.Where("expires_at <= ?", time.Now()).Delete(&idempotencyRecord{})
+	return result.RowsAffected, result.Error
+}
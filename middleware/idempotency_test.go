@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+func newIdempotencyApp(t *testing.T, handler fiber.Handler) (*fiber.App, *tenanttest.Store) {
+	t.Helper()
+
+	store := tenanttest.NewStore(t)
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:    store,
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+	app.Post("/payments", Idempotency(IdempotencyConfig{Store: store}), handler)
+	return app, store
+}
+
+func pay(t *testing.T, app *fiber.App, tenant, key, body string) (*http.Response, string) {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/payments", strings.NewReader(body))
+	req.Header.Set("X-Tenant-ID", tenant)
+	if key != "" {
+		req.Header.Set(DefaultIdempotencyHeader, key)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	var executions atomic.Int32
+	app, _ := newIdempotencyApp(t, func(c *fiber.Ctx) error {
+		n := executions.Add(1)
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"payment": n})
+	})
+
+	resp, first := pay(t, app, "tenant_a", "key-1", `{"amount":100}`)
+	if resp.StatusCode != fiber.StatusCreated || resp.Header.Get(IdempotencyReplayedHeader) != "" {
+		t.Fatalf("Expected a created payment, got %d %s", resp.StatusCode, first)
+	}
+
+	resp, replayed := pay(t, app, "tenant_a", "key-1", `{"amount":100}`)
+	if resp.StatusCode != fiber.StatusCreated || replayed != first || resp.Header.Get(IdempotencyReplayedHeader) != "true" {
+		t.Fatalf("Expected the replayed %s, got %d %s", first, resp.StatusCode, replayed)
+	}
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != fiber.MIMEApplicationJSON {
+		t.Fatalf("Expected the stored content type, got %q", ct)
+	}
+
+	// Keys are scoped by tenant
+	if _, body := pay(t, app, "tenant_b", "key-1", `{"amount":100}`); body != `{"payment":2}` {
+		t.Fatalf("Expected tenant_b to execute, got %s", body)
+	}
+
+	// Requests without a key always execute
+	pay(t, app, "tenant_a", "", `{"amount":100}`)
+	if n := executions.Load(); n != 3 {
+		t.Fatalf("Expected 3 executions, got %d", n)
+	}
+}
+
+func TestIdempotencyKeyReused(t *testing.T) {
+	app, _ := newIdempotencyApp(t, func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	pay(t, app, "tenant_a", "key-1", `{"amount":100}`)
+	if resp, _ := pay(t, app, "tenant_a", "key-1", `{"amount":200}`); resp.StatusCode != fiber.StatusConflict {
+		t.Fatalf("Expected 409 for a different body, got %d", resp.StatusCode)
+	}
+}
+
+func TestIdempotencyFailureReleasesKey(t *testing.T) {
+	var executions atomic.Int32
+	app, _ := newIdempotencyApp(t, func(c *fiber.Ctx) error {
+		if executions.Add(1) == 1 {
+			return fiber.NewError(fiber.StatusBadGateway, "upstream down")
+		}
+		return c.SendString("ok")
+	})
+
+	if resp, _ := pay(t, app, "tenant_a", "key-1", "{}"); resp.StatusCode != fiber.StatusBadGateway {
+		t.Fatalf("Expected 502, got %d", resp.StatusCode)
+	}
+	if resp, body := pay(t, app, "tenant_a", "key-1", "{}"); resp.StatusCode != fiber.StatusOK || body != "ok" {
+		t.Fatalf("Expected the retry to execute, got %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestIdempotencyConcurrentRequests(t *testing.T) {
+	var executions atomic.Int32
+	app, _ := newIdempotencyApp(t, func(c *fiber.Ctx) error {
+		executions.Add(1)
+		time.Sleep(200 * time.Millisecond)
+		return c.SendString("charged")
+	})
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 2)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/payments", strings.NewReader(`{"amount":100}`))
+			req.Header.Set("X-Tenant-ID", "tenant_a")
+			req.Header.Set(DefaultIdempotencyHeader, "key-1")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Errorf("Failed to test: %v", err)
+				return
+			}
+			data, _ := io.ReadAll(resp.Body)
+			bodies[i] = string(data)
+		}(i)
+	}
+	wg.Wait()
+
+	if n := executions.Load(); n != 1 {
+		t.Fatalf("Expected exactly one execution, got %d", n)
+	}
+	if bodies[0] != "charged" || bodies[1] != "charged" {
+		t.Fatalf("Expected both requests to get the response, got %q", bodies)
+	}
+}
+
+func TestPurgeIdempotencyKeys(t *testing.T) {
+	app, store := newIdempotencyApp(t, func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	ctx := context.Background()
+
+	db, err := store.GetTenantDB(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	if n, err := PurgeIdempotencyKeys(ctx, db); err != nil || n != 0 {
+		t.Fatalf("Expected nothing to purge without the table, got %d %v", n, err)
+	}
+
+	pay(t, app, "tenant_a", "key-1", "{}")
+	pay(t, app, "tenant_a", "key-2", "{}")
+	db.Model(&idempotencyRecord{}).Where("idempotency_key = ?", "key-1").Update("expires_at", time.Now().Add(-time.Minute))
+
+	if n, err := PurgeIdempotencyKeys(ctx, db); err != nil || n != 1 {
+		t.Fatalf("Expected 1 expired key purged, got %d %v", n, err)
+	}
+}
+
+func TestIdempotencyPrepareDoesNotBlockOtherTenants(t *testing.T) {
+	store := tenanttest.NewStore(t)
+	keys := &idempotencyKeys{cfg: IdempotencyConfig{PurgeInterval: time.Hour}, tenants: make(map[string]*idempotencyTenant)}
+
+	// tenant_a's table is still being created
+	slow := new(idempotencyTenant)
+	slow.migrate.Lock()
+	defer slow.migrate.Unlock()
+	keys.tenants["tenant_a"] = slow
+
+	db, err := store.GetTenantDB(context.Background(), "tenant_b")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- keys.prepare("tenant_b", db) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to prepare: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected tenant_b to be prepared while tenant_a migrates")
+	}
+
+	if !db.Migrator().HasTable(&idempotencyRecord{}) {
+		t.Fatal("Expected the table to be created")
+	}
+	if next := keys.tenants["tenant_b"].nextPurge; time.Until(next) < 59*time.Minute {
+		t.Fatalf("Expected the next purge in an hour, got %s", next)
+	}
+}
@@ -0,0 +1,316 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"reflect"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Defaults of ImportOptions
+const (
+	DefaultImportField                 = "file"
+	DefaultImportBatchSize             = 500
+	DefaultImportBatchesPerTransaction = 10
+	DefaultImportMaxErrors             = 100
+)
+
+// ImportOptions configures ImportCSV
+type ImportOptions struct {
+	// Optional: Multipart form field of the file (defaults to
+	// DefaultImportField)
+	Field string
+
+	// Optional: Rows per INSERT (defaults to DefaultImportBatchSize). Keep
+	// it times the model's columns under PostgreSQL's 65535 parameters.
+	BatchSize int
+
+	// Optional: Batches committed per transaction (defaults to
+	// DefaultImportBatchesPerTransaction)
+	BatchesPerTransaction int
+
+	// Optional: Row errors listed in the report (defaults to
+	// DefaultImportMaxErrors); further rows are only counted as skipped
+	MaxErrors int
+
+	// Optional: Field delimiter (defaults to ',')
+	Comma rune
+
+	// Optional: The first row is data, not a header
+	NoHeader bool
+}
+
+// ImportReport is the outcome of ImportCSV
+type ImportReport struct {
+	Inserted int              `json:"inserted"`
+	Skipped  int              `json:"skipped"`
+	Errors   []ImportRowError `json:"errors"`
+
+	// ErrorsTruncated is set when more rows failed than MaxErrors
+	ErrorsTruncated bool `json:"errors_truncated,omitempty"`
+}
+
+// ImportRowError is a row ImportCSV skipped, by its line in the file
+type ImportRowError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (r *ImportReport) skip(line int, err error, maxErrors int) {
+	r.Skipped++
+	if len(r.Errors) >= maxErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+	r.Errors = append(r.Errors, ImportRowError{Line: line, Message: err.Error()})
+}
+
+// ImportCSV inserts the rows of an uploaded CSV file into db, such as the
+// request's tenant DB, for imports from other products. The file is the
+// multipart form field opts.Field, or the whole body of a text/csv request.
+// mapRow turns each row into a record of model's type, such as *User, or
+// returns an error to skip the row; it must not keep the row, which is
+// reused. Records are inserted in batches of opts.BatchSize, committed every
+// opts.BatchesPerTransaction batches, and skipped rows are reported with
+// their line numbers.
+//
+// Enable fiber.Config.StreamRequestBody so the file is read while it is
+// uploaded and memory use stays flat; otherwise Fiber buffers the whole body
+// first. A database failure returns the error with the report of the rows
+// committed before it; a request without a file returns a 400 error.
+//
+//	app.Post("/import/users", func(c *fiber.Ctx) error {
+//		report, err := middleware.ImportCSV(c, middleware.MustGetTenantDB(c), &User{}, func(row []string) (interface{}, error) {
+//			if len(row) < 2 || row[1] == "" {
+//				return nil, errors.New("email is required")
+//			}
+//			return &User{Name: row[0], Email: row[1]}, nil
+//		}, middleware.ImportOptions{})
+//		if err != nil {
+//			return err
+//		}
+//		return c.JSON(report)
+//	})
+func ImportCSV(c *fiber.Ctx, db *gorm.DB, model interface{}, mapRow func([]string) (interface{}, error), opts ImportOptions) (ImportReport, error) {
+	report := ImportReport{Errors: []ImportRowError{}}
+
+	if opts.Field == "" {
+		opts.Field = DefaultImportField
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultImportBatchSize
+	}
+	if opts.BatchesPerTransaction <= 0 {
+		opts.BatchesPerTransaction = DefaultImportBatchesPerTransaction
+	}
+	if opts.MaxErrors <= 0 {
+		opts.MaxErrors = DefaultImportMaxErrors
+	}
+
+	recordType := reflect.TypeOf(model)
+	if recordType == nil {
+		return report, errors.New("ImportCSV requires a model")
+	}
+
+	// Fiber reads the next request from where the handler stopped reading
+	// the stream, so the rest of the upload is discarded
+	body, file, err := importFile(c, opts.Field)
+	defer io.Copy(io.Discard, body)
+	if err != nil {
+		return report, err
+	}
+
+	reader := csv.NewReader(file)
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+	if opts.Comma != 0 {
+		reader.Comma = opts.Comma
+	}
+
+	// Inside the request transaction of TransactionalRequests, rows are
+	// inserted in it and committed with the request
+	_, inTx := db.Statement.ConnPool.(gorm.TxCommitter)
+
+	importer := &csvImporter{
+		db:        db.WithContext(c.UserContext()),
+		inTx:      inTx,
+		opts:      opts,
+		report:    &report,
+		batch:     reflect.MakeSlice(reflect.SliceOf(recordType), 0, opts.BatchSize),
+		batchType: recordType,
+	}
+	defer importer.rollback()
+
+	header := !opts.NoHeader
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			report.skip(parseErr.StartLine, parseErr.Err, opts.MaxErrors)
+			header = false
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		if header {
+			header = false
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		record, err := mapRow(row)
+		if err == nil && reflect.TypeOf(record) != recordType {
+			err = fmt.Errorf("mapRow returned %T, expected %s", record, recordType)
+		}
+		if err != nil {
+			report.skip(line, err, opts.MaxErrors)
+			continue
+		}
+
+		if err := importer.add(record); err != nil {
+			return report, err
+		}
+	}
+
+	if err := importer.flush(); err != nil {
+		return report, err
+	}
+	return report, importer.commit()
+}
+
+// importFile returns the request body, read from the body stream when there
+// is one, and the uploaded file of the multipart field in it, or the body of
+// a CSV request
+func importFile(c *fiber.Ctx, field string) (io.Reader, io.Reader, error) {
+	// Body reads the whole stream, so it is only used without one
+	body := c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+
+	mediaType, params, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	if err == nil && mediaType == "text/csv" {
+		return body, body, nil
+	}
+	if err != nil || mediaType != fiber.MIMEMultipartForm || params["boundary"] == "" {
+		return body, nil, fiber.NewError(fiber.StatusBadRequest, "Expected a multipart upload or a text/csv body")
+	}
+
+	parts := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			return body, nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Missing file field %q", field))
+		}
+		if err != nil {
+			return body, nil, fiber.NewError(fiber.StatusBadRequest, "Malformed multipart upload")
+		}
+		if part.FormName() == field {
+			return body, part, nil
+		}
+	}
+}
+
+// csvImporter batches records of one type and commits them in chunked
+// transactions
+type csvImporter struct {
+	db     *gorm.DB
+	inTx   bool
+	opts   ImportOptions
+	report *ImportReport
+
+	batch     reflect.Value
+	batchType reflect.Type
+
+	// tx is the open transaction, holding pending rows in its batches
+	tx      *gorm.DB
+	batches int
+	pending int
+}
+
+func (i *csvImporter) add(record interface{}) error {
+	i.batch = reflect.Append(i.batch, reflect.ValueOf(record))
+	if i.batch.Len() < i.opts.BatchSize {
+		return nil
+	}
+	if err := i.flush(); err != nil {
+		return err
+	}
+	if i.batches >= i.opts.BatchesPerTransaction {
+		return i.commit()
+	}
+	return nil
+}
+
+// flush inserts the batch in the open transaction
+func (i *csvImporter) flush() error {
+	rows := i.batch.Len()
+	if rows == 0 {
+		return nil
+	}
+
+	if i.inTx {
+		i.tx = i.db
+	} else if i.tx == nil {
+		i.tx = i.db.Begin()
+		if i.tx.Error != nil {
+			err := i.tx.Error
+			i.tx = nil
+			return fmt.Errorf("failed to begin import transaction: %w", err)
+		}
+	}
+	if err := i.tx.Create(i.batch.Interface()).Error; err != nil {
+		return fmt.Errorf("failed to insert import batch: %w", err)
+	}
+
+	i.batches++
+	i.pending += rows
+
+	// Clear the records so the batch does not keep them alive
+	for n := 0; n < rows; n++ {
+		i.batch.Index(n).Set(reflect.Zero(i.batchType))
+	}
+	i.batch = i.batch.Slice(0, 0)
+	return nil
+}
+
+func (i *csvImporter) commit() error {
+	if i.inTx {
+		i.report.Inserted += i.pending
+		i.pending = 0
+		return nil
+	}
+	if i.tx == nil {
+		return nil
+	}
+	err := i.tx.Commit().Error
+	i.tx = nil
+	i.batches = 0
+	if err != nil {
+		i.pending = 0
+		return fmt.Errorf("failed to commit import batch: %w", err)
+	}
+	i.report.Inserted += i.pending
+	i.pending = 0
+	return nil
+}
+
+// rollback discards the rows of a transaction left open by a failure
+func (i *csvImporter) rollback() {
+	if i.tx != nil && !i.inTx {
+		i.tx.Rollback()
+		i.tx = nil
+	}
+}
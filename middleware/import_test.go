@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+type ImportedUser struct {
+	ID    uint
+	Name  string
+	Email string
+	Age   int
+}
+
+func mapImportedUser(row []string) (interface{}, error) {
+	if len(row) != 3 {
+		return nil, fmt.Errorf("expected 3 fields, got %d", len(row))
+	}
+	if !strings.Contains(row[1], "@") {
+		return nil, errors.New("invalid email")
+	}
+	age, err := strconv.Atoi(row[2])
+	if err != nil {
+		return nil, errors.New("invalid age")
+	}
+	return &ImportedUser{Name: row[0], Email: row[1], Age: age}, nil
+}
+
+func newImportApp(t *testing.T, config fiber.Config, opts ImportOptions, mapRow func([]string) (interface{}, error)) (*fiber.App, *tenanttest.Store) {
+	t.Helper()
+
+	store := tenanttest.NewStore(t, &ImportedUser{})
+	app := fiber.New(config)
+	app.Use(New(Config{
+		Store:    store,
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+	app.Post("/import", func(c *fiber.Ctx) error {
+		report, err := ImportCSV(c, MustGetTenantDB(c), &ImportedUser{}, mapRow, opts)
+		if err != nil {
+			return err
+		}
+		return c.JSON(report)
+	})
+	return app, store
+}
+
+func multipartCSV(t *testing.T, field, content string) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("source", "competitor")
+	part, err := form.CreateFormFile(field, "users.csv")
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write([]byte(content))
+	form.Close()
+	return &body, form.FormDataContentType()
+}
+
+func importRequest(t *testing.T, app *fiber.App, body io.Reader, contentType string) (int, ImportReport) {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/import", body)
+	req.Header.Set("X-Tenant-ID", "acme")
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+
+	var report ImportReport
+	if resp.StatusCode == fiber.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatalf("Failed to decode report: %v", err)
+		}
+	}
+	return resp.StatusCode, report
+}
+
+func countImportedUsers(t *testing.T, store *tenanttest.Store) int64 {
+	t.Helper()
+
+	db, err := store.GetTenantDB(context.Background(), "acme")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	var count int64
+	db.Model(&ImportedUser{}).Count(&count)
+	return count
+}
+
+func TestImportCSV(t *testing.T) {
+	app, store := newImportApp(t, fiber.Config{}, ImportOptions{BatchSize: 2, BatchesPerTransaction: 1}, mapImportedUser)
+
+	content := "name,email,age\n" +
+		"Jane,jane@example.com,34\n" +
+		"John,john.example.com,40\n" +
+		"Ada,ada@example.com,36\n" +
+		"\"Bob,bob@example.com,1\n"
+	body, contentType := multipartCSV(t, "file", content)
+
+	status, report := importRequest(t, app, body, contentType)
+	if status != fiber.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if report.Inserted != 2 || report.Skipped != 2 || len(report.Errors) != 2 {
+		t.Fatalf("Expected 2 inserted and 2 skipped, got %+v", report)
+	}
+	if report.Errors[0] != (ImportRowError{Line: 3, Message: "invalid email"}) || report.Errors[1].Line != 5 {
+		t.Fatalf("Expected errors on lines 3 and 5, got %+v", report.Errors)
+	}
+	if n := countImportedUsers(t, store); n != 2 {
+		t.Fatalf("Expected 2 users, got %d", n)
+	}
+}
+
+func TestImportCSVRequests(t *testing.T) {
+	app, _ := newImportApp(t, fiber.Config{}, ImportOptions{MaxErrors: 1, NoHeader: true}, mapImportedUser)
+
+	// Plain CSV bodies are imported too, and errors beyond the cap counted
+	status, report := importRequest(t, app, strings.NewReader("Jane,jane@example.com,34\nJohn,x,1\nAda,y,2\n"), "text/csv")
+	if status != fiber.StatusOK || report.Inserted != 1 || report.Skipped != 2 || len(report.Errors) != 1 || !report.ErrorsTruncated {
+		t.Fatalf("Expected 1 inserted and 2 skipped with 1 listed, got %d %+v", status, report)
+	}
+
+	body, contentType := multipartCSV(t, "other", "Jane,jane@example.com,34\n")
+	if status, _ := importRequest(t, app, body, contentType); status != fiber.StatusBadRequest {
+		t.Fatalf("Expected 400 without the file field, got %d", status)
+	}
+	if status, _ := importRequest(t, app, strings.NewReader("{}"), fiber.MIMEApplicationJSON); status != fiber.StatusBadRequest {
+		t.Fatalf("Expected 400 for JSON, got %d", status)
+	}
+}
+
+func TestImportCSVStreaming(t *testing.T) {
+	const rows = 100_000
+
+	// written counts the rows the client has sent, first the rows it had
+	// sent when the server mapped the first row
+	var written, first atomic.Int64
+	first.Store(-1)
+	mapRow := func(row []string) (interface{}, error) {
+		first.CompareAndSwap(-1, written.Load())
+		return mapImportedUser(row)
+	}
+	app, store := newImportApp(t, fiber.Config{StreamRequestBody: true, DisableStartupMessage: true}, ImportOptions{}, mapRow)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		part, err := form.CreateFormFile("file", "users.csv")
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		fmt.Fprintln(part, "name,email,age")
+		for i := 0; i < rows; i++ {
+			if i%1000 == 999 {
+				fmt.Fprintf(part, "user%d,invalid,%d\n", i, i%90)
+			} else {
+				fmt.Fprintf(part, "user%d,user%d@example.com,%d\n", i, i, i%90)
+			}
+			written.Add(1)
+		}
+		pw.CloseWithError(form.Close())
+	}()
+
+	req, _ := http.NewRequest("POST", "http://"+ln.Addr().String()+"/import", pr)
+	req.Header.Set("X-Tenant-ID", "acme")
+	req.Header.Set(fiber.HeaderContentType, form.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var report ImportReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Inserted != rows-rows/1000 || report.Skipped != rows/1000 {
+		t.Fatalf("Expected %d inserted and %d skipped, got %d and %d", rows-rows/1000, rows/1000, report.Inserted, report.Skipped)
+	}
+	if report.Errors[0].Line != 1001 {
+		t.Fatalf("Expected the first error on line 1001, got %+v", report.Errors[0])
+	}
+	if n := countImportedUsers(t, store); n != int64(report.Inserted) {
+		t.Fatalf("Expected %d users, got %d", report.Inserted, n)
+	}
+
+	// Rows are imported while the file is uploaded, not after buffering it
+	if sent := first.Load(); sent < 0 || sent >= rows {
+		t.Fatalf("Expected the first row mapped before the upload finished, got %d rows sent", sent)
+	}
+}
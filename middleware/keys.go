@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type tenantKey struct{}
+
+type tenantDBKey struct{}
+
+// TenantKey and TenantDBKey are the Locals keys the middleware stores the
+// tenant and its database under. Their unexported types cannot collide with
+// string keys such as "tenant" set by other middleware.
+var (
+	TenantKey   = tenantKey{}
+	TenantDBKey = tenantDBKey{}
+)
+
+// Legacy string keys checked by GetTenant and GetTenantDB during the
+// deprecation window
+const (
+	legacyTenantKey   = "tenant"
+	legacyTenantDBKey = "tenant_db"
+)
+
+// Tenant returns the tenant stored by the middleware created from this config
+func (cfg Config) Tenant(c *fiber.Ctx) string {
+	var key interface{} = TenantKey
+	if cfg.ContextKey != "" {
+		key = cfg.ContextKey
+	}
+
+	tenant, _ := c.Locals(key).(string)
+	return tenant
+}
+
+// DB returns the tenant database stored by the middleware created from this
+// config, or the request transaction when TransactionalRequests is enabled
+func (cfg Config) DB(c *fiber.Ctx) *gorm.DB {
+	var key interface{} = TenantDBKey
+	if cfg.DBContextKey != "" {
+		key = cfg.DBContextKey
+	}
+
+	db, _ := c.Locals(key).(*gorm.DB)
+	return db
+}
+
+// setTenantDB stores the tenant database under the typed key and, if
+// configured, the legacy string key
+func (cfg *Config) setTenantDB(c *fiber.Ctx, db *gorm.DB) {
+	c.Locals(TenantDBKey, db)
+	if cfg.DBContextKey != "" {
+		c.Locals(cfg.DBContextKey, db)
+	}
+}
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// LeakDetector finds Rows and transactions that a handler opened through the
+// request DB and left open after the handler chain returned. Tracking costs
+// a stack capture per query, so enable it in development or for sampled
+// traffic. It does not apply when TransactionalRequests is set, because the
+// middleware ends the request transaction itself.
+type LeakDetector struct {
+	// Rollback closes leaked Rows and rolls back leaked transactions
+	Rollback bool
+
+	// OnLeak is called once per request with leaks. Defaults to logging a
+	// warning with the route, tenant and the stacks that opened them.
+	OnLeak func(c *fiber.Ctx, leak Leak)
+
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// Leak describes what a request left open
+type Leak struct {
+	Route        string
+	Tenant       string
+	Rows         int
+	Transactions int
+
+	// Stacks holds the stack of every leaked Rows or transaction when it
+	// was opened
+	Stacks []string
+}
+
+// Leaks returns the number of leaking requests per route ("METHOD /path")
+func (d *LeakDetector) Leaks() map[string]uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counts := make(map[string]uint64, len(d.counts))
+	for route, n := range d.counts {
+		counts[route] = n
+	}
+	return counts
+}
+
+// track returns a session of db whose Rows and transactions are recorded
+func (d *LeakDetector) track(db *gorm.DB) (*gorm.DB, *leakTracker) {
+	tracker := &leakTracker{ConnPool: db.Statement.ConnPool}
+
+	// WithContext clones the statement, so the shared tenant DB keeps its
+	// pool. The session keeps the DB's own context rather than the request's,
+	// like the untracked request DB.
+	session := db.WithContext(db.Statement.Context)
+	session.Statement.ConnPool = tracker
+	return session, tracker
+}
+
+// check reports what the request left open
+func (d *LeakDetector) check(c *fiber.Ctx, tenant string, tracker *leakTracker) {
+	leak := tracker.leaks(d.Rollback)
+	if leak.Rows == 0 && leak.Transactions == 0 {
+		return
+	}
+
+	leak.Route = c.Method() + " " + c.Route().Path
+	leak.Tenant = tenant
+
+	d.mu.Lock()
+	if d.counts == nil {
+		d.counts = make(map[string]uint64)
+	}
+	d.counts[leak.Route]++
+	d.mu.Unlock()
+
+	if d.OnLeak != nil {
+		d.OnLeak(c, leak)
+		return
+	}
+	log.Printf("WARN tenant DB leak on %s for tenant %s: %d open rows, %d open transactions\n%s",
+		leak.Route, leak.Tenant, leak.Rows, leak.Transactions, strings.Join(leak.Stacks, "\n"))
+}
+
+// leakTracker wraps a connection pool and records the Rows and transactions
+// opened through it
+type leakTracker struct {
+	gorm.ConnPool
+
+	mu   sync.Mutex
+	rows []trackedRows
+	txs  []*trackedTx
+}
+
+type trackedRows struct {
+	rows  *sql.Rows
+	stack string
+}
+
+func (t *leakTracker) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := t.ConnPool.QueryContext(ctx, query, args...)
+	if err == nil {
+		t.addRows(rows)
+	}
+	return rows, err
+}
+
+func (t *leakTracker) addRows(rows *sql.Rows) {
+	t.mu.Lock()
+	t.rows = append(t.rows, trackedRows{rows: rows, stack: string(debug.Stack())})
+	t.mu.Unlock()
+}
+
+// BeginTx begins a transaction on the wrapped pool and tracks it
+func (t *leakTracker) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var (
+		pool gorm.ConnPool
+		err  error
+	)
+	switch beginner := t.ConnPool.(type) {
+	case gorm.TxBeginner:
+		pool, err = beginner.BeginTx(ctx, opts)
+	case gorm.ConnPoolBeginner:
+		pool, err = beginner.BeginTx(ctx, opts)
+	default:
+		err = gorm.ErrInvalidTransaction
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &trackedTx{ConnPool: pool, tracker: t, stack: string(debug.Stack())}
+	t.mu.Lock()
+	t.txs = append(t.txs, tx)
+	t.mu.Unlock()
+	return tx, nil
+}
+
+// GetDBConn returns the underlying *sql.DB so db.DB() keeps working
+func (t *leakTracker) GetDBConn() (*sql.DB, error) {
+	if connector, ok := t.ConnPool.(gorm.GetDBConnector); ok {
+		return connector.GetDBConn()
+	}
+	if sqlDB, ok := t.ConnPool.(*sql.DB); ok {
+		return sqlDB, nil
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// leaks counts the Rows and transactions still open, closing them if asked
+func (t *leakTracker) leaks(rollback bool) Leak {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var leak Leak
+	for _, tracked := range t.rows {
+		// Columns fails once Rows are closed
+		if _, err := tracked.rows.Columns(); err != nil {
+			continue
+		}
+		leak.Rows++
+		leak.Stacks = append(leak.Stacks, tracked.stack)
+		if rollback {
+			tracked.rows.Close()
+		}
+	}
+
+	for _, tx := range t.txs {
+		if tx.done.Load() {
+			continue
+		}
+		leak.Transactions++
+		leak.Stacks = append(leak.Stacks, tx.stack)
+		if rollback {
+			tx.Rollback()
+		}
+	}
+	return leak
+}
+
+// trackedTx records whether a transaction was committed or rolled back
+type trackedTx struct {
+	gorm.ConnPool
+	tracker *leakTracker
+	stack   string
+	done    atomic.Bool
+}
+
+func (tx *trackedTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := tx.ConnPool.QueryContext(ctx, query, args...)
+	if err == nil {
+		tx.tracker.addRows(rows)
+	}
+	return rows, err
+}
+
+func (tx *trackedTx) Commit() error {
+	tx.done.Store(true)
+	if committer, ok := tx.ConnPool.(gorm.TxCommitter); ok {
+		return committer.Commit()
+	}
+	return gorm.ErrInvalidTransaction
+}
+
+func (tx *trackedTx) Rollback() error {
+	tx.done.Store(true)
+	if committer, ok := tx.ConnPool.(gorm.TxCommitter); ok {
+		return committer.Rollback()
+	}
+	return gorm.ErrInvalidTransaction
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+func TestLeakDetectorReportsOpenRows(t *testing.T) {
+	store := tenanttest.NewStore(t, &txTestItem{})
+	tenanttest.Seed(store, "tenant1", &txTestItem{Name: "a"}, &txTestItem{Name: "b"})
+
+	var leaks []Leak
+	detector := &LeakDetector{
+		// The test store has a single connection, so leaked rows must be
+		// closed for the next request to get it
+		Rollback: true,
+		OnLeak: func(c *fiber.Ctx, leak Leak) {
+			leaks = append(leaks, leak)
+		},
+	}
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:        store,
+		Resolver:     HeaderResolver("X-Tenant-ID"),
+		LeakDetector: detector,
+	}))
+
+	app.Get("/leak", func(c *fiber.Ctx) error {
+		rows, err := GetTenantDB(c).Model(&txTestItem{}).Rows()
+		if err != nil {
+			return err
+		}
+		rows.Next()
+		return nil
+	})
+	app.Get("/closed", func(c *fiber.Ctx) error {
+		rows, err := GetTenantDB(c).Model(&txTestItem{}).Rows()
+		if err != nil {
+			return err
+		}
+		return rows.Close()
+	})
+	app.Get("/tx", func(c *fiber.Ctx) error {
+		return GetTenantDB(c).Begin().Error
+	})
+
+	for _, path := range []string{"/leak", "/closed", "/tx", "/leak"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Tenant-ID", "tenant1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test %s: %v", path, err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", path, resp.StatusCode)
+		}
+	}
+
+	if len(leaks) != 3 {
+		t.Fatalf("Expected 3 leaks, got %d: %+v", len(leaks), leaks)
+	}
+	if leaks[0].Route != "GET /leak" || leaks[0].Tenant != "tenant1" || leaks[0].Rows != 1 {
+		t.Fatalf("Unexpected rows leak: %+v", leaks[0])
+	}
+	if len(leaks[0].Stacks) != 1 || leaks[0].Stacks[0] == "" {
+		t.Fatalf("Expected the stack that opened the rows, got %v", leaks[0].Stacks)
+	}
+	if leaks[1].Route != "GET /tx" || leaks[1].Transactions != 1 || leaks[1].Rows != 0 {
+		t.Fatalf("Unexpected transaction leak: %+v", leaks[1])
+	}
+
+	counts := detector.Leaks()
+	if counts["GET /leak"] != 2 || counts["GET /tx"] != 1 || counts["GET /closed"] != 0 {
+		t.Fatalf("Unexpected leak counts: %v", counts)
+	}
+}
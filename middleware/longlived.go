@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// LongLivedDB returns a session on the request tenant's DB for work that
+// outlives the handler, such as the stream writer of a server-sent events
+// or long polling response. Fiber reuses the *fiber.Ctx once the handler
+// returns, and the request transaction of TransactionalRequests has ended
+// by then, so resolve the session before streaming starts.
+//
+// The session is bound to its own context, unaffected by timeouts on the
+// request context; release cancels it and must be called when the stream
+// ends. The DB is nil when the request has no tenant or the store cannot
+// provide its DB; release is never nil.
+func LongLivedDB(c *fiber.Ctx, store TenantStore) (*gorm.DB, func()) {
+	tenant := GetTenant(c)
+	if tenant == "" {
+		return nil, func() {}
+	}
+
+	// Fiber strings point into buffers reused by the next request
+	tenant = strings.Clone(tenant)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	db, err := store.GetTenantDB(ctx, tenant)
+	if err != nil {
+		cancel()
+		return nil, func() {}
+	}
+	return db.WithContext(ctx), cancel
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+type streamTestItem struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func TestLongLivedDBOutlivesHandler(t *testing.T) {
+	for _, transactional := range []bool{false, true} {
+		store := tenanttest.NewStore(t, &streamTestItem{})
+		tenanttest.Seed(store, "tenant1", &streamTestItem{Name: "a"}, &streamTestItem{Name: "b"})
+		tenanttest.Seed(store, "tenant2", &streamTestItem{Name: "c"})
+
+		app := fiber.New()
+		app.Use(New(Config{
+			Store:                 store,
+			Resolver:              HeaderResolver("X-Tenant-ID"),
+			TransactionalRequests: transactional,
+		}))
+
+		var released *gorm.DB
+		app.Get("/events", func(c *fiber.Ctx) error {
+			db, release := LongLivedDB(c, store)
+			if db == nil {
+				return fiber.ErrInternalServerError
+			}
+			released = db
+
+			c.Set(fiber.HeaderContentType, "text/event-stream")
+			c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+				defer release()
+
+				// Runs after the handler returned and the request
+				// transaction ended
+				for i := 0; i < 3; i++ {
+					var count int64
+					if err := db.Model(&streamTestItem{}).Count(&count).Error; err != nil {
+						fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
+						return
+					}
+					fmt.Fprintf(w, "data: %d\n\n", count)
+					w.Flush()
+				}
+			})
+			return nil
+		})
+
+		for tenant, count := range map[string]int{"tenant1": 2, "tenant2": 1} {
+			req := httptest.NewRequest("GET", "/events", nil)
+			req.Header.Set("X-Tenant-ID", tenant)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			expected := strings.Repeat(fmt.Sprintf("data: %d\n\n", count), 3)
+			if string(body) != expected {
+				t.Fatalf("Expected %q for %s (transactional %v), got %q", expected, tenant, transactional, body)
+			}
+		}
+
+		// Releasing cancels the session
+		var count int64
+		if err := released.Model(&streamTestItem{}).Count(&count).Error; !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected queries after release to fail with context.Canceled, got %v", err)
+		}
+	}
+}
+
+func TestLongLivedDBWithoutTenant(t *testing.T) {
+	app := fiber.New()
+	app.Get("/events", func(c *fiber.Ctx) error {
+		db, release := LongLivedDB(c, tenanttest.NewStore(t))
+		release()
+		if db != nil {
+			return fiber.ErrInternalServerError
+		}
+		return nil
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/events", nil))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected no DB without a tenant, got status %d", resp.StatusCode)
+	}
+}
+
+func TestRequestDBIgnoresCancelledUserContext(t *testing.T) {
+	for _, detector := range []*LeakDetector{nil, {}} {
+		store := tenanttest.NewStore(t, &streamTestItem{})
+
+		app := fiber.New()
+		// Stands in for a timeout middleware whose deadline already passed
+		app.Use(func(c *fiber.Ctx) error {
+			ctx, cancel := context.WithCancel(c.UserContext())
+			cancel()
+			c.SetUserContext(ctx)
+			return c.Next()
+		})
+		app.Use(New(Config{
+			Store:        store,
+			Resolver:     HeaderResolver("X-Tenant-ID"),
+			LeakDetector: detector,
+		}))
+		app.Get("/items", func(c *fiber.Ctx) error {
+			var count int64
+			return GetTenantDB(c).Model(&streamTestItem{}).Count(&count).Error
+		})
+
+		req := httptest.NewRequest("GET", "/items", nil)
+		req.Header.Set("X-Tenant-ID", "tenant1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("Expected the request DB to ignore the request context (leak detector %v), got status %d", detector != nil, resp.StatusCode)
+		}
+	}
+}
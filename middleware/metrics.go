@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Defaults of MetricsConfig
+const (
+	DefaultMetricsWindow     = time.Minute
+	DefaultMetricsMaxTenants = 1000
+)
+
+// OverflowTenant collects the requests of tenants beyond
+// MetricsConfig.MaxTenants
+const OverflowTenant = "(other)"
+
+// metricsSlots is the number of slots the window is split into; the window
+// slides by one slot at a time
+const metricsSlots = 6
+
+// latencyBounds are the upper bounds of the latency histogram buckets. The
+// last bucket holds everything slower.
+var latencyBounds = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// MetricsConfig configures NewTenantMetrics
+type MetricsConfig struct {
+	// Optional: Period rates and latencies are computed over (defaults to
+	// DefaultMetricsWindow)
+	Window time.Duration
+
+	// Optional: Number of tenants tracked individually (defaults to
+	// DefaultMetricsMaxTenants). Tenants idle for a window free their slot;
+	// requests of further tenants are counted under OverflowTenant.
+	MaxTenants int
+}
+
+// TenantMetrics counts requests, server errors and latencies per tenant
+// over a sliding window, in memory of the process. Memory is bounded by
+// MaxTenants, so it is safe with untrusted tenant names.
+//
+//	metrics := middleware.NewTenantMetrics(middleware.MetricsConfig{})
+//	app.Use(middleware.New(cfg), metrics.Handler())
+type TenantMetrics struct {
+	window     time.Duration
+	slot       time.Duration
+	maxTenants int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	tenants map[string]*tenantCounters
+}
+
+type tenantCounters struct {
+	slots [metricsSlots]metricsSlot
+}
+
+type metricsSlot struct {
+	epoch     int64
+	requests  uint64
+	errors    uint64
+	latencies [14]uint64 // len(latencyBounds) + 1
+}
+
+// TenantRequestStats are a tenant's requests over the metrics window
+type TenantRequestStats struct {
+	Tenant   string `json:"tenant"`
+	Requests uint64 `json:"requests"`
+	Errors   uint64 `json:"errors"`
+
+	// RequestRate is in requests per second, ErrorRate the share of
+	// requests that failed with a 5xx status
+	RequestRate float64 `json:"request_rate"`
+	ErrorRate   float64 `json:"error_rate"`
+
+	// P95 is the upper bound of the latency bucket holding the 95th
+	// percentile
+	P95 time.Duration `json:"p95"`
+}
+
+// NewTenantMetrics returns metrics for cfg
+func NewTenantMetrics(cfg MetricsConfig) *TenantMetrics {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultMetricsWindow
+	}
+	if cfg.MaxTenants <= 0 {
+		cfg.MaxTenants = DefaultMetricsMaxTenants
+	}
+	return &TenantMetrics{
+		window:     cfg.Window,
+		slot:       max(cfg.Window/metricsSlots, 1),
+		maxTenants: cfg.MaxTenants,
+		now:        time.Now,
+		tenants:    make(map[string]*tenantCounters),
+	}
+}
+
+// Handler returns middleware recording every request with a tenant. Mount
+// it after New, so requests the middleware rejects are not counted.
+func (m *TenantMetrics) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		tenant := GetTenant(c)
+		if tenant == "" {
+			return err
+		}
+
+		// Errors reach the app's error handler after this returns
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+		m.Observe(tenant, time.Since(start), status >= fiber.StatusInternalServerError)
+		return err
+	}
+}
+
+// Observe records a request of the tenant
+func (m *TenantMetrics) Observe(tenant string, latency time.Duration, failed bool) {
+	epoch := m.now().UnixNano() / int64(m.slot)
+	bucket := sort.Search(len(latencyBounds), func(i int) bool { return latency <= latencyBounds[i] })
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counters, ok := m.tenants[tenant]
+	if !ok {
+		if len(m.tenants) >= m.maxTenants {
+			m.sweep(epoch)
+		}
+		if len(m.tenants) >= m.maxTenants {
+			tenant = OverflowTenant
+		}
+		if counters, ok = m.tenants[tenant]; !ok {
+			counters = &tenantCounters{}
+			m.tenants[strings.Clone(tenant)] = counters
+		}
+	}
+
+	slot := &counters.slots[epoch%metricsSlots]
+	if slot.epoch != epoch {
+		*slot = metricsSlot{epoch: epoch}
+	}
+	slot.requests++
+	if failed {
+		slot.errors++
+	}
+	slot.latencies[bucket]++
+}
+
+// sweep forgets tenants without requests in the window
+func (m *TenantMetrics) sweep(epoch int64) {
+	for tenant, counters := range m.tenants {
+		if tenant != OverflowTenant && !counters.active(epoch) {
+			delete(m.tenants, tenant)
+		}
+	}
+}
+
+// active reports whether any slot is within the window ending at epoch
+func (t *tenantCounters) active(epoch int64) bool {
+	for i := range t.slots {
+		if epoch-t.slots[i].epoch < metricsSlots && t.slots[i].requests > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot returns the stats of every tenant with requests in the window,
+// sorted by tenant
+func (m *TenantMetrics) Snapshot() []TenantRequestStats {
+	epoch := m.now().UnixNano() / int64(m.slot)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]TenantRequestStats, 0, len(m.tenants))
+	for tenant, counters := range m.tenants {
+		var total metricsSlot
+		for _, slot := range counters.slots {
+			if epoch-slot.epoch >= metricsSlots {
+				continue
+			}
+			total.requests += slot.requests
+			total.errors += slot.errors
+			for i, n := range slot.latencies {
+				total.latencies[i] += n
+			}
+		}
+		if total.requests == 0 {
+			continue
+		}
+
+		stats = append(stats, TenantRequestStats{
+			Tenant:      tenant,
+			Requests:    total.requests,
+			Errors:      total.errors,
+			RequestRate: float64(total.requests) / m.window.Seconds(),
+			ErrorRate:   float64(total.errors) / float64(total.requests),
+			P95:         percentile(total.latencies[:], total.requests, 0.95),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Tenant < stats[j].Tenant })
+	return stats
+}
+
+// percentile returns the upper bound of the bucket holding the quantile,
+// or the largest bound for the overflow bucket
+func percentile(buckets []uint64, total uint64, quantile float64) time.Duration {
+	rank := uint64(quantile*float64(total) + 0.5)
+	var seen uint64
+	for i, n := range buckets {
+		seen += n
+		if seen >= rank && i < len(latencyBounds) {
+			return latencyBounds[i]
+		}
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+func TestTenantMetricsHandler(t *testing.T) {
+	metrics := NewTenantMetrics(MetricsConfig{})
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:    tenanttest.NewStore(t),
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}), metrics.Handler())
+	app.Get("/ok", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return fiber.ErrServiceUnavailable
+	})
+	app.Get("/missing", func(c *fiber.Ctx) error {
+		return fiber.ErrNotFound
+	})
+
+	for _, path := range []string{"/ok", "/ok", "/fail", "/missing"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Tenant-ID", "tenant1")
+		if _, err := app.Test(req); err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+	}
+
+	stats := metrics.Snapshot()
+	if len(stats) != 1 || stats[0].Tenant != "tenant1" {
+		t.Fatalf("Expected stats for tenant1, got %+v", stats)
+	}
+	if stats[0].Requests != 4 || stats[0].Errors != 1 {
+		t.Fatalf("Expected 4 requests and 1 server error, got %+v", stats[0])
+	}
+	if stats[0].ErrorRate != 0.25 {
+		t.Fatalf("Expected error rate 0.25, got %v", stats[0].ErrorRate)
+	}
+}
+
+func TestTenantMetricsWindow(t *testing.T) {
+	metrics := NewTenantMetrics(MetricsConfig{Window: time.Minute})
+	now := time.Unix(1_700_000_000, 0)
+	metrics.now = func() time.Time { return now }
+
+	for i := 0; i < 95; i++ {
+		metrics.Observe("tenant1", 3*time.Millisecond, false)
+	}
+	for i := 0; i < 5; i++ {
+		metrics.Observe("tenant1", time.Second, false)
+	}
+
+	stats := metrics.Snapshot()
+	if len(stats) != 1 || stats[0].P95 != 5*time.Millisecond {
+		t.Fatalf("Expected p95 in the 5ms bucket, got %+v", stats)
+	}
+	if stats[0].RequestRate != 100.0/60 {
+		t.Fatalf("Expected 100 requests per minute, got %v/s", stats[0].RequestRate)
+	}
+
+	// Requests leave the window as it slides
+	now = now.Add(time.Minute + time.Second)
+	if stats := metrics.Snapshot(); len(stats) != 0 {
+		t.Fatalf("Expected no stats after the window, got %+v", stats)
+	}
+}
+
+func TestTenantMetricsMaxTenants(t *testing.T) {
+	metrics := NewTenantMetrics(MetricsConfig{MaxTenants: 3})
+	now := time.Unix(1_700_000_000, 0)
+	metrics.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		metrics.Observe(fmt.Sprintf("tenant%d", i), time.Millisecond, false)
+	}
+	stats := metrics.Snapshot()
+	if len(stats) != 4 {
+		t.Fatalf("Expected 3 tenants and the overflow, got %+v", stats)
+	}
+	if stats[0].Tenant != OverflowTenant || stats[0].Requests != 7 {
+		t.Fatalf("Expected 7 requests under %s, got %+v", OverflowTenant, stats[0])
+	}
+
+	// Idle tenants free their slots
+	now = now.Add(2 * time.Minute)
+	metrics.Observe("tenant9", time.Millisecond, false)
+	stats = metrics.Snapshot()
+	if len(stats) != 1 || stats[0].Tenant != "tenant9" {
+		t.Fatalf("Expected tenant9 to be tracked once others went idle, got %+v", stats)
+	}
+}
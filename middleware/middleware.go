@@ -38,52 +38,227 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"html/template"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenancy"
+	"github.com/1Nelsonel/fiber-multitenant/tenantctx"
 )
 
-// TenantStore interface defines methods for managing tenant database connections
-type TenantStore interface {
-	GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error)
-	GetMasterDB() *gorm.DB
-}
+// TenantStore interface defines methods for managing tenant database
+// connections. It is tenancy.DBProvider, so stores and mocks written against
+// the tenancy package can be passed directly.
+type TenantStore = tenancy.DBProvider
 
 // Config holds middleware configuration
 type Config struct {
 	// Resolver function to extract tenant from request
 	Resolver TenantResolver
 
+	// Optional: Resolver returning attributes alongside the tenant, such as
+	// JWTResolver. It takes precedence over Resolver; handlers read the
+	// attributes with GetResolution.
+	ResolverV2 ResolverV2
+
 	// TenantStore manages database connections
 	Store TenantStore
 
-	// Optional: Custom error handler
+	// Optional: Custom error handler. Failures of the middleware are passed
+	// as *Error, which carries the envelope code and status. Defaults to
+	// DefaultErrorHandler.
 	ErrorHandler func(c *fiber.Ctx, err error) error
 
+	// Optional: Page the default error handler shows browsers, executed
+	// with an ErrorPage (defaults to DefaultErrorTemplate). Use html/template,
+	// which escapes the tenant and message. Ignored with ErrorHandler.
+	ErrorTemplate *template.Template
+
+	// Optional: Make the default error handler respond with the body used
+	// before ErrorResponse, {"error": "tenant_resolution_failed", "message":
+	// ...}, with the error's status or 400
+	LegacyErrorBody bool
+
+	// Optional: Longest the resolver may take. Resolvers doing I/O must use
+	// c.UserContext(), which carries the deadline; when it passes the
+	// request fails with ErrResolveTimeout, TENANT_RESOLUTION_TIMEOUT and
+	// status 503. Zero waits as long as the resolver takes.
+	ResolveTimeout time.Duration
+
+	// Optional: Resolutions taking longer are reported to OnSlowResolve,
+	// timed out ones included. Zero reports none.
+	ResolveWarnThreshold time.Duration
+
+	// Optional: Called with the duration of slow resolutions. Defaults to
+	// logging a warning with the route.
+	OnSlowResolve func(c *fiber.Ctx, elapsed time.Duration)
+
 	// Optional: Skip middleware for certain paths
 	Skip func(c *fiber.Ctx) bool
 
-	// ContextKey for storing tenant in fiber context (defaults to "tenant")
+	// Optional: Methods passed to the next handler without resolving a
+	// tenant, so CORS preflights and monitors need no tenant. Handlers see
+	// no tenant locals. Defaults to OPTIONS; set an empty slice to resolve
+	// every method. Skip applies independently.
+	PassthroughMethods []string
+
+	// Optional: Also store the tenant under this string Locals key. The tenant
+	// is always stored under TenantKey; string keys are kept for compatibility
+	// and can collide with other middleware.
 	ContextKey string
 
-	// DBContextKey for storing tenant DB in fiber context (defaults to "tenant_db")
+	// Optional: Also store the tenant DB under this string Locals key. The DB
+	// is always stored under TenantDBKey.
 	DBContextKey string
 
+	// Optional: Replace the resolved tenant before it is verified, stored
+	// in locals or looked up in the store, such as legacy IDs migrated to
+	// new slugs. Returning the tenant unchanged keeps it; an error fails the
+	// request with TENANT_RESOLUTION_FAILED and status 400 unless it carries
+	// one. The resolved tenant and the replacement are both validated.
+	RewriteTenant func(c *fiber.Ctx, tenant string) (string, error)
+
 	// Optional: Callback after tenant is resolved successfully
 	OnTenantResolved func(c *fiber.Ctx, tenant string) error
+
+	// Optional: Feature flags read by Feature and RequireFeature, such as a
+	// SettingsFeatureProvider
+	Features FeatureProvider
+
+	// Optional: Values constructed with the tenant DB as soon as it is
+	// attached, before OnTenantResolved, e.g. Eager(NewOrderRepository).
+	// Handlers get them with Provide.
+	Providers []Provider
+
+	// Optional: Run each request inside a transaction on the tenant DB with
+	// the tenant's search_path pinned via SET LOCAL. GetTenantDB returns the
+	// transaction, which is committed when the handler chain succeeds and
+	// rolled back on errors, status codes >= 400, MarkRollback or panics.
+	TransactionalRequests bool
+
+	// Optional: Verify the request may access the resolved tenant before the
+	// tenant DB is attached. Header and query param resolvers let the client
+	// pick the tenant, so they must always be paired with a verifier.
+	VerifyTenantAccess TenantVerifier
+
+	// Optional: Reject tenants the store reports as inactive, before the
+	// tenant DB is touched. The Store must implement TenantActivityChecker,
+	// and is asked with the tenant's schema if it is a SchemaNamer.
+	EnforceActive bool
+
+	// Optional: Status returned for inactive tenants (defaults to 403)
+	InactiveStatus int
+
+	// Optional: Report Rows and transactions handlers leave open on the
+	// tenant DB. Ignored when TransactionalRequests is set.
+	LeakDetector *LeakDetector
+
+	// Optional: Refuse clients and tenants that keep failing resolution,
+	// and cap the tenants never served before, with 429 before the store is
+	// asked. Protects the master DB from clients scanning subdomains.
+	ResolutionGuard *ResolutionGuard
+
+	// Optional: Guard the master DB in requests with a tenant, where it is
+	// most likely used by mistake. Queries on the store's master DB bound to
+	// c.UserContext() are logged as warnings, or rejected with
+	// StrictTenantRoutesFail. The Store must implement TenantRouteGuard.
+	StrictTenantRoutes     bool
+	StrictTenantRoutesFail bool
+}
+
+// TenantActivityChecker is implemented by stores that track whether tenants
+// may serve requests, such as tenantstore.TenantStore with its registry
+type TenantActivityChecker interface {
+	IsTenantActive(ctx context.Context, tenantSchema string) (bool, error)
+}
+
+// TenantRouteGuard is implemented by stores that can check their master DB
+// for use in tenant requests, such as tenantstore.TenantStore. The returned
+// context carries the mark; fail rejects queries instead of logging them.
+type TenantRouteGuard interface {
+	GuardTenantRoute(ctx context.Context, tenant string, fail bool) context.Context
+}
+
+// TenantDBBorrower is implemented by stores that wait for the connections in
+// use before shutting down, such as tenantstore.TenantStore. The middleware
+// registers every request with a tenant as a borrower until the handler
+// chain returns.
+type TenantDBBorrower interface {
+	Borrow() (release func(), err error)
+}
+
+// TenantExistenceChecker is implemented by stores that can tell unknown
+// tenants from inactive ones. EnforceActive then responds 404 with
+// TENANT_NOT_FOUND for unknown tenants instead of InactiveStatus.
+type TenantExistenceChecker interface {
+	TenantExists(ctx context.Context, tenantSchema string) (bool, error)
+}
+
+// SchemaNamer is implemented by stores that map tenant IDs to schema names,
+// such as tenantstore.TenantStore. TransactionalRequests pins the mapped
+// schema, and registry lookups of EnforceActive, SettingsFeatureProvider and
+// SettingsCachePolicy use it.
+type SchemaNamer interface {
+	SchemaName(tenant string) (string, error)
+}
+
+// schemaFor maps a tenant ID to its schema when store is a SchemaNamer, and
+// returns the ID otherwise
+func schemaFor(store interface{}, tenant string) (string, error) {
+	if namer, ok := store.(SchemaNamer); ok {
+		return namer.SchemaName(tenant)
+	}
+	return tenant, nil
+}
+
+// SearchPather is implemented by stores with a custom search_path per
+// tenant, such as tenantstore.TenantStore. TransactionalRequests pins the
+// returned schemas instead of the tenant schema and public.
+type SearchPather interface {
+	SearchPath(tenantSchema string) ([]string, error)
+}
+
+// StatusError is implemented by store errors that map to an HTTP status, such
+// as tenantstore.ErrTenantQuotaExceeded (503) and ErrProvisionRateLimited (429)
+type StatusError interface {
+	error
+	HTTPStatus() int
+}
+
+// RetryAfterError is implemented by store errors that tell clients when to
+// retry, such as tenantstore.ErrDatabaseSaturated
+type RetryAfterError interface {
+	error
+	RetryAfter() time.Duration
+}
+
+// storeError turns store errors carrying a status into fiber errors and sets
+// Retry-After when the error has one
+func storeError(c *fiber.Ctx, err error) error {
+	var retryErr RetryAfterError
+	if errors.As(err, &retryErr) && retryErr.RetryAfter() > 0 {
+		seconds := int(math.Ceil(retryErr.RetryAfter().Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	}
+
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return fiber.NewError(statusErr.HTTPStatus(), statusErr.Error())
+	}
+	return err
 }
 
 // ConfigDefault is the default config
 var ConfigDefault = Config{
 	Resolver:     SubdomainResolver,
-	ContextKey:   "tenant",
-	DBContextKey: "tenant_db",
-	ErrorHandler: func(c *fiber.Ctx, err error) error {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "tenant_resolution_failed",
-			"message": err.Error(),
-		})
-	},
+	ErrorHandler: DefaultErrorHandler,
 }
 
 // New creates a new tenant middleware handler
@@ -99,14 +274,13 @@ func New(config ...Config) fiber.Handler {
 		if cfg.Resolver == nil {
 			cfg.Resolver = ConfigDefault.Resolver
 		}
-		if cfg.ContextKey == "" {
-			cfg.ContextKey = ConfigDefault.ContextKey
-		}
-		if cfg.DBContextKey == "" {
-			cfg.DBContextKey = ConfigDefault.DBContextKey
-		}
 		if cfg.ErrorHandler == nil {
 			cfg.ErrorHandler = ConfigDefault.ErrorHandler
+			if cfg.LegacyErrorBody {
+				cfg.ErrorHandler = legacyErrorHandler("tenant_resolution_failed", fiber.StatusBadRequest)
+			} else if cfg.ErrorTemplate != nil {
+				cfg.ErrorHandler = ErrorHandlerWithTemplate(cfg.ErrorTemplate)
+			}
 		}
 	}
 
@@ -115,34 +289,211 @@ func New(config ...Config) fiber.Handler {
 		panic("TenantStore is required")
 	}
 
+	var activity TenantActivityChecker
+	var existence TenantExistenceChecker
+	if cfg.EnforceActive {
+		var ok bool
+		if activity, ok = cfg.Store.(TenantActivityChecker); !ok {
+			panic("EnforceActive requires a TenantStore implementing TenantActivityChecker")
+		}
+		existence, _ = cfg.Store.(TenantExistenceChecker)
+	}
+	borrower, _ := cfg.Store.(TenantDBBorrower)
+	var guard TenantRouteGuard
+	if cfg.StrictTenantRoutes {
+		var ok bool
+		if guard, ok = cfg.Store.(TenantRouteGuard); !ok {
+			panic("StrictTenantRoutes requires a TenantStore implementing TenantRouteGuard")
+		}
+	}
+	inactiveStatus := cfg.InactiveStatus
+	if inactiveStatus == 0 {
+		inactiveStatus = fiber.StatusForbidden
+	}
+
+	// Box the legacy string keys once; converting them to interface{} on
+	// every request would allocate
+	var legacyKey, legacyDBKey interface{}
+	if cfg.ContextKey != "" {
+		legacyKey = cfg.ContextKey
+	}
+	if cfg.DBContextKey != "" {
+		legacyDBKey = cfg.DBContextKey
+	}
+
+	passthrough := cfg.PassthroughMethods
+	if passthrough == nil {
+		passthrough = []string{fiber.MethodOptions}
+	}
+	passthrough = append([]string(nil), passthrough...)
+	for i, method := range passthrough {
+		passthrough[i] = strings.ToUpper(method)
+	}
+
+	resolve := cfg.ResolverV2
+	if resolve == nil {
+		resolve = cfg.Resolver.V2()
+	}
+	resolve = cfg.timeResolver(resolve)
+
+	resolutionGuard := cfg.ResolutionGuard
+
+	// Requests share the state until they get a tenant, which changes their
+	// user context
+	state := cfg.newRequestState()
+
 	return func(c *fiber.Ctx) error {
 		// Skip middleware if Skip function returns true
 		if cfg.Skip != nil && cfg.Skip(c) {
 			return c.Next()
 		}
 
+		// Drop what an earlier run left on the request, e.g. before a
+		// retry with c.RestartRouting(), and resolve the tenant again
+		enter(c, state)
+
+		// Let preflights and monitors through without a tenant
+		if len(passthrough) > 0 && slices.Contains(passthrough, c.Method()) {
+			return c.Next()
+		}
+
+		// Refuse clients that keep failing before resolving anything
+		if resolutionGuard != nil {
+			if err := resolutionGuard.allowClient(c); err != nil {
+				return cfg.ErrorHandler(c, err)
+			}
+		}
+
 		// Resolve tenant from request
-		tenant, err := cfg.Resolver(c)
+		resolution, err := resolve(c)
+		if errors.Is(err, ErrResolveTimeout) {
+			return cfg.ErrorHandler(c, newError(ErrorCodeTenantResolutionTimeout, 0, err))
+		}
 		if err != nil {
-			return cfg.ErrorHandler(c, err)
+			if resolutionGuard != nil {
+				resolutionGuard.fail(c)
+			}
+			return cfg.ErrorHandler(c, newError(ErrorCodeTenantResolutionFailed, fiber.StatusBadRequest, err))
+		}
+
+		// Resolvers return strings pointing into request buffers that Fiber
+		// reuses once the handler returns, unless the app is Immutable. Own
+		// the tenant so locals, the store and goroutines can keep it.
+		tenant := strings.Clone(resolution.Tenant)
+		if err := validateTenant(tenant); err != nil {
+			if resolutionGuard != nil {
+				resolutionGuard.fail(c)
+			}
+			return cfg.ErrorHandler(c, newError(ErrorCodeTenantResolutionFailed, fiber.StatusBadRequest, err))
+		}
+
+		// The guard keys on the resolved tenant, so rewrites are guarded too
+		resolved := tenant
+		if resolutionGuard != nil {
+			if err := resolutionGuard.admit(c, resolved); err != nil {
+				return cfg.ErrorHandler(c, err)
+			}
+		}
+
+		if cfg.RewriteTenant != nil {
+			rewritten, err := cfg.RewriteTenant(c, tenant)
+			if err == nil {
+				err = validateTenant(rewritten)
+				tenant = strings.Clone(rewritten)
+			}
+			if err != nil {
+				return cfg.ErrorHandler(c, newError(ErrorCodeTenantResolutionFailed, fiber.StatusBadRequest, err))
+			}
+		}
+
+		// Verify the request is allowed to access the tenant
+		if cfg.VerifyTenantAccess != nil {
+			if err := cfg.VerifyTenantAccess(c, tenant); err != nil {
+				return cfg.ErrorHandler(c, newError(ErrorCodeTenantResolutionFailed, fiber.StatusForbidden, err))
+			}
+		}
+
+		// Reject inactive tenants before touching their schema. The
+		// registry keeps schema names, not tenant IDs.
+		if activity != nil {
+			schema, err := schemaFor(cfg.Store, tenant)
+			if err != nil {
+				return cfg.ErrorHandler(c, newError(ErrorCodeTenantResolutionFailed, fiber.StatusBadRequest, err))
+			}
+			active, err := activity.IsTenantActive(c.Context(), schema)
+			if err != nil {
+				return cfg.ErrorHandler(c, newError(ErrorCodeTenantDBUnavailable, 0, errTenantStatusUnavailable))
+			}
+			if !active {
+				if existence != nil {
+					exists, err := existence.TenantExists(c.Context(), schema)
+					if err != nil {
+						return cfg.ErrorHandler(c, newError(ErrorCodeTenantDBUnavailable, 0, errTenantStatusUnavailable))
+					}
+					if !exists {
+						return cfg.ErrorHandler(c, resolutionGuard.storeFailed(c, resolved, newError(ErrorCodeTenantNotFound, 0, errTenantNotFound)))
+					}
+				}
+				return cfg.ErrorHandler(c, newError(ErrorCodeTenantSuspended, 0, fiber.NewError(inactiveStatus, "Tenant is not active")))
+			}
 		}
 
 		// Store tenant in context
-		c.Locals(cfg.ContextKey, tenant)
+		resolution.Tenant = tenant
+		c.Locals(resolutionKey{}, &resolution)
+		c.Locals(TenantKey, tenant)
+		if legacyKey != nil {
+			c.Locals(legacyKey, tenant)
+		}
+		if cfg.Features != nil {
+			c.Locals(featuresKey{}, cfg.Features)
+		}
+		c.Locals(requestStateKey{}, &requestState{keys: state.keys, userContext: c.UserContext()})
+		if guard != nil {
+			c.SetUserContext(guard.GuardTenantRoute(c.UserContext(), tenant, cfg.StrictTenantRoutesFail))
+		}
+
+		// Keep the store open until the request is done
+		if borrower != nil {
+			release, err := borrower.Borrow()
+			if err != nil {
+				return cfg.ErrorHandler(c, newError(ErrorCodeTenantDBUnavailable, fiber.StatusServiceUnavailable, storeError(c, err)))
+			}
+			defer release()
+		}
 
 		// Get tenant database connection
 		tenantDB, err := cfg.Store.GetTenantDB(c.Context(), tenant)
 		if err != nil {
-			return cfg.ErrorHandler(c, err)
+			return cfg.ErrorHandler(c, resolutionGuard.storeFailed(c, resolved, newError(ErrorCodeTenantDBUnavailable, fiber.StatusServiceUnavailable, storeError(c, err))))
+		}
+		if resolutionGuard != nil {
+			resolutionGuard.serve(resolved)
+		}
+
+		if cfg.TransactionalRequests {
+			return runInTransaction(c, cfg, tenant, tenantDB)
+		}
+
+		var tracker *leakTracker
+		if cfg.LeakDetector != nil {
+			tenantDB, tracker = cfg.LeakDetector.track(tenantDB)
+			defer cfg.LeakDetector.check(c, tenant, tracker)
 		}
 
 		// Store tenant DB in context
-		c.Locals(cfg.DBContextKey, tenantDB)
+		c.Locals(TenantDBKey, tenantDB)
+		if legacyDBKey != nil {
+			c.Locals(legacyDBKey, tenantDB)
+		}
+		c.SetUserContext(tenantctx.WithDB(c.UserContext(), tenant, tenantDB))
+
+		cfg.provide(c)
 
 		// Call optional callback
 		if cfg.OnTenantResolved != nil {
 			if err := cfg.OnTenantResolved(c, tenant); err != nil {
-				return cfg.ErrorHandler(c, err)
+				return cfg.ErrorHandler(c, newError(ErrorCodeTenantResolutionFailed, fiber.StatusBadRequest, err))
 			}
 		}
 
@@ -150,31 +501,41 @@ func New(config ...Config) fiber.Handler {
 	}
 }
 
-// GetTenant retrieves the tenant identifier from fiber context
+// GetTenant retrieves the tenant identifier from fiber context. Without a
+// key it reads TenantKey and falls back to the deprecated "tenant" string key.
 func GetTenant(c *fiber.Ctx, contextKey ...string) string {
-	key := "tenant"
 	if len(contextKey) > 0 && contextKey[0] != "" {
-		key = contextKey[0]
+		tenant, _ := c.Locals(contextKey[0]).(string)
+		return tenant
 	}
 
-	tenant, ok := c.Locals(key).(string)
-	if !ok {
-		return ""
+	if tenant, ok := c.Locals(TenantKey).(string); ok {
+		return tenant
 	}
+
+	tenant, _ := c.Locals(legacyTenantKey).(string)
 	return tenant
 }
 
-// GetTenantDB retrieves the tenant database from fiber context
+// GetTenantDB retrieves the tenant database from fiber context. Without a key
+// it reads TenantDBKey and falls back to the deprecated "tenant_db" string key.
+//
+// The DB is not bound to the request context, so request timeouts do not
+// cancel its queries; use db.WithContext(c.UserContext()) to tie them to the
+// request. With TransactionalRequests it is the request transaction instead,
+// bound to c.UserContext() and ended when the handler chain returns. Use
+// LongLivedDB for queries in streaming responses.
 func GetTenantDB(c *fiber.Ctx, contextKey ...string) *gorm.DB {
-	key := "tenant_db"
 	if len(contextKey) > 0 && contextKey[0] != "" {
-		key = contextKey[0]
+		db, _ := c.Locals(contextKey[0]).(*gorm.DB)
+		return db
 	}
 
-	db, ok := c.Locals(key).(*gorm.DB)
-	if !ok {
-		return nil
+	if db, ok := c.Locals(TenantDBKey).(*gorm.DB); ok {
+		return db
 	}
+
+	db, _ := c.Locals(legacyTenantDBKey).(*gorm.DB)
 	return db
 }
 
@@ -2,29 +2,46 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
 	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantctx"
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
 )
 
-// Mock TenantStore for testing
-type mockTenantStore struct {
-	tenants map[string]*gorm.DB
+// The in-memory tenanttest store must satisfy the middleware interface
+var _ TenantStore = (*tenanttest.Store)(nil)
+
+// countingTenantStore records how often the middleware asks for a tenant DB
+type countingTenantStore struct {
+	*tenanttest.Store
+	calls int
 }
 
-func (m *mockTenantStore) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
-	if db, ok := m.tenants[tenantSchema]; ok {
-		return db, nil
-	}
-	// Return a mock DB (in real tests you'd use a test database)
-	return &gorm.DB{}, nil
+func (m *countingTenantStore) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	m.calls++
+	return m.Store.GetTenantDB(ctx, tenantSchema)
 }
 
-func (m *mockTenantStore) GetMasterDB() *gorm.DB {
-	return &gorm.DB{}
+// failingTenantStore fails every tenant DB lookup with err
+type failingTenantStore struct {
+	*tenanttest.Store
+	err error
+}
+
+func (f *failingTenantStore) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	return nil, f.err
 }
 
 func TestSubdomainResolver(t *testing.T) {
@@ -115,6 +132,134 @@ func TestSubdomainResolver(t *testing.T) {
 	}
 }
 
+func TestSubdomainResolverWithConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     SubdomainConfig
+		host       string
+		wantTenant string
+		wantError  bool
+	}{
+		{
+			name:       "Single label",
+			config:     SubdomainConfig{NestedSeparator: "_"},
+			host:       "acme.example.com",
+			wantTenant: "acme",
+		},
+		{
+			name:       "Two nested labels",
+			config:     SubdomainConfig{NestedSeparator: "_"},
+			host:       "client1.agency.example.com:3000",
+			wantTenant: "agency_client1",
+		},
+		{
+			name:       "Two nested labels left to right",
+			config:     SubdomainConfig{NestedSeparator: "_", NestedLeftToRight: true},
+			host:       "client1.agency.example.com",
+			wantTenant: "client1_agency",
+		},
+		{
+			name:       "Three nested labels",
+			config:     SubdomainConfig{NestedSeparator: "_", MaxDepth: 3},
+			host:       "team.client1.agency.example.com",
+			wantTenant: "agency_client1_team",
+		},
+		{
+			name:      "Three nested labels above default depth",
+			config:    SubdomainConfig{NestedSeparator: "_"},
+			host:      "team.client1.agency.example.com",
+			wantError: true,
+		},
+		{
+			name:      "Nested labels without separator",
+			config:    SubdomainConfig{},
+			host:      "client1.agency.example.com",
+			wantError: true,
+		},
+		{
+			name:      "Label containing the separator",
+			config:    SubdomainConfig{NestedSeparator: "-"},
+			host:      "client-1.agency.example.com",
+			wantError: true,
+		},
+		{
+			name:       "Uppercase host",
+			config:     SubdomainConfig{NestedSeparator: "_"},
+			host:       "Client1.Agency.Example.com",
+			wantTenant: "agency_client1",
+		},
+		{
+			name:       "Nested localhost",
+			config:     SubdomainConfig{NestedSeparator: "_"},
+			host:       "client1.agency.localhost:3000",
+			wantTenant: "agency_client1",
+		},
+		{
+			name:       "Base domain with more labels",
+			config:     SubdomainConfig{BaseDomain: "app.example.co.uk", NestedSeparator: "_"},
+			host:       "client1.agency.app.example.co.uk",
+			wantTenant: "agency_client1",
+		},
+		{
+			name:       "Base domain counts nested labels from its start",
+			config:     SubdomainConfig{BaseDomain: ".example.co.uk.", NestedSeparator: "_", MaxDepth: 3},
+			host:       "team.client1.agency.example.co.uk",
+			wantTenant: "agency_client1_team",
+		},
+		{
+			name:      "Other domain",
+			config:    SubdomainConfig{BaseDomain: "example.co.uk", NestedSeparator: "_"},
+			host:      "acme.notexample.co.uk",
+			wantError: true,
+		},
+		{
+			name:      "Base domain alone",
+			config:    SubdomainConfig{BaseDomain: "example.co.uk", NestedSeparator: "_"},
+			host:      "example.co.uk",
+			wantError: true,
+		},
+		{
+			name:      "WWW subdomain",
+			config:    SubdomainConfig{NestedSeparator: "_"},
+			host:      "www.example.com",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			resolver := SubdomainResolverWithConfig(tt.config)
+
+			app.Get("/test", func(c *fiber.Ctx) error {
+				tenant, err := resolver(c)
+				if err != nil {
+					return err
+				}
+				return c.SendString(tenant)
+			})
+
+			req := httptest.NewRequest("GET", "http://"+tt.host+"/test", nil)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+
+			if tt.wantError {
+				if resp.StatusCode != fiber.StatusBadRequest {
+					t.Fatalf("Expected status 400, got %d", resp.StatusCode)
+				}
+				return
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != fiber.StatusOK || string(body) != tt.wantTenant {
+				t.Fatalf("Expected tenant '%s', got %d '%s'", tt.wantTenant, resp.StatusCode, string(body))
+			}
+		})
+	}
+}
+
 func TestHeaderResolver(t *testing.T) {
 	app := fiber.New()
 
@@ -170,6 +315,122 @@ func TestPathPrefixResolver(t *testing.T) {
 	}
 }
 
+func TestPathPrefixResolverNormalization(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantTenant string
+		wantError  bool
+	}{
+		{
+			name:       "Plain path",
+			path:       "/acme/users",
+			wantTenant: "acme",
+		},
+		{
+			name:       "Double slashes",
+			path:       "//acme//users",
+			wantTenant: "acme",
+		},
+		{
+			name:       "Leading dot segment",
+			path:       "/./acme/users",
+			wantTenant: "acme",
+		},
+		{
+			name:       "Dot segments resolved",
+			path:       "/other/../acme/users",
+			wantTenant: "acme",
+		},
+		{
+			name:       "Percent-encoded tenant",
+			path:       "/%61cme/users",
+			wantTenant: "acme",
+		},
+		{
+			name:      "Encoded traversal",
+			path:      "/%2e%2e/admin",
+			wantError: true,
+		},
+		{
+			name:      "Traversal above root",
+			path:      "/../admin",
+			wantError: true,
+		},
+		{
+			name:      "Encoded slash",
+			path:      "/acme%2Fusers",
+			wantError: true,
+		},
+		{
+			name:      "Encoded backslash",
+			path:      "/acme%5Cusers",
+			wantError: true,
+		},
+		{
+			name:      "Dots only",
+			path:      "/.../users",
+			wantError: true,
+		},
+		{
+			name:      "Invalid escape",
+			path:      "/acme%zz/users",
+			wantError: true,
+		},
+		{
+			name:      "Segment too long",
+			path:      "/" + strings.Repeat("a", MaxPathTenantLength+1) + "/users",
+			wantError: true,
+		},
+		{
+			name:      "Only slashes",
+			path:      "///",
+			wantError: true,
+		},
+	}
+
+	app := fiber.New()
+
+	app.Use(func(c *fiber.Ctx) error {
+		tenant, err := PathPrefixResolver(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		return c.SendString(tenant)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RequestURI = tt.path
+			req.URL.RawPath = tt.path
+			req.URL.Path = tt.path
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+
+			if tt.wantError {
+				if resp.StatusCode != fiber.StatusBadRequest {
+					t.Fatalf("Expected status 400, got %d (%s)", resp.StatusCode, string(body))
+				}
+				return
+			}
+
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("Expected status 200, got %d (%s)", resp.StatusCode, string(body))
+			}
+
+			if string(body) != tt.wantTenant {
+				t.Fatalf("Expected tenant '%s', got '%s'", tt.wantTenant, string(body))
+			}
+		})
+	}
+}
+
 func TestQueryParamResolver(t *testing.T) {
 	app := fiber.New()
 
@@ -241,11 +502,77 @@ func TestChainResolvers(t *testing.T) {
 	}
 }
 
-func TestMiddlewareNew(t *testing.T) {
-	mockStore := &mockTenantStore{
-		tenants: make(map[string]*gorm.DB),
+func TestChainResolversStopsOnPresentInvalid(t *testing.T) {
+	app := fiber.New()
+
+	app.Get("/test", func(c *fiber.Ctx) error {
+		resolver := ChainResolvers(
+			StrictHeaderResolver("X-Tenant-ID"),
+			StrictQueryParamResolver("tenant"),
+			PathPrefixResolver,
+		)
+
+		tenant, err := resolver(c)
+		if errors.Is(err, ErrTenantPresentInvalid) {
+			return c.Status(fiber.StatusBadRequest).SendString("invalid")
+		}
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		return c.SendString(tenant)
+	})
+
+	tests := []struct {
+		name       string
+		url        string
+		sendHeader bool
+		header     string
+		expected   string
+	}{
+		{"empty header with query", "/test?tenant=tenant2", true, "", "invalid"},
+		{"header with query", "/test?tenant=tenant2", true, "tenant1", "tenant1"},
+		{"no header with query", "/test?tenant=tenant2", false, "", "tenant2"},
+		{"empty query with path", "/test?tenant=", false, "", "invalid"},
+		{"bare query with path", "/test?tenant", false, "", "invalid"},
+		{"no header or query", "/test", false, "", "test"},
 	}
 
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.url, nil)
+		if tt.sendHeader {
+			req.Header["X-Tenant-Id"] = []string{tt.header}
+		}
+		resp, _ := app.Test(req)
+
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != tt.expected {
+			t.Fatalf("%s: Expected '%s', got '%s'", tt.name, tt.expected, string(body))
+		}
+	}
+}
+
+func TestStrictHeaderResolverThroughMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:    tenanttest.NewStore(t),
+		Resolver: ChainResolvers(StrictHeaderResolver("X-Tenant-ID"), QueryParamResolver("tenant")),
+	}))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+
+	req := httptest.NewRequest("GET", "/test?tenant=other", nil)
+	req.Header["X-Tenant-Id"] = []string{""}
+	resp, _ := app.Test(req)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("Expected 400 for an empty tenant header, got %d (%s)", resp.StatusCode, body)
+	}
+}
+
+func TestMiddlewareNew(t *testing.T) {
+	mockStore := tenanttest.NewStore(t)
+
 	app := fiber.New()
 
 	app.Use(New(Config{
@@ -362,9 +689,7 @@ func TestMustGetTenantPanic(t *testing.T) {
 }
 
 func TestSkipMiddleware(t *testing.T) {
-	mockStore := &mockTenantStore{
-		tenants: make(map[string]*gorm.DB),
-	}
+	mockStore := tenanttest.NewStore(t)
 
 	app := fiber.New()
 
@@ -392,3 +717,427 @@ func TestSkipMiddleware(t *testing.T) {
 		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
 	}
 }
+
+func TestPassthroughMethods(t *testing.T) {
+	store := tenanttest.NewStore(t)
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:    store,
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+	// CORS after the tenant middleware, e.g. on a group, still answers preflights
+	app.Use(cors.New())
+	app.Get("/items", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+
+	req := httptest.NewRequest("OPTIONS", "/items", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	resp, _ := app.Test(req)
+	if resp.StatusCode != fiber.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") == "" {
+		t.Fatalf("Expected the preflight to be answered by CORS with 204, got %d", resp.StatusCode)
+	}
+
+	req = httptest.NewRequest("GET", "/items", nil)
+	resp, _ = app.Test(req)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("Expected GET without a tenant to fail with 400, got %d", resp.StatusCode)
+	}
+
+	// HEAD is resolved unless listed
+	req = httptest.NewRequest("HEAD", "/items", nil)
+	resp, _ = app.Test(req)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("Expected HEAD without a tenant to fail with 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestPassthroughMethodsConfigured(t *testing.T) {
+	store := tenanttest.NewStore(t)
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:              store,
+		Resolver:           HeaderResolver("X-Tenant-ID"),
+		PassthroughMethods: []string{"head"},
+		Skip: func(c *fiber.Ctx) bool {
+			return c.Path() == "/health"
+		},
+	}))
+	app.Get("/items", func(c *fiber.Ctx) error {
+		if GetTenant(c) != "" || GetTenantDB(c) != nil {
+			t.Error("Expected no tenant locals for a passed-through method")
+		}
+		return c.SendString("ok")
+	})
+	app.Options("/items", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	app.Options("/health", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{"HEAD", "/items", fiber.StatusOK},
+		{"OPTIONS", "/items", fiber.StatusBadRequest}, // replaced the default
+		{"OPTIONS", "/health", fiber.StatusNoContent}, // Skip still applies
+	} {
+		resp, _ := app.Test(httptest.NewRequest(tc.method, tc.path, nil))
+		if resp.StatusCode != tc.status {
+			t.Fatalf("Expected %s %s to respond %d, got %d", tc.method, tc.path, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestTypedContextKeysDoNotCollide(t *testing.T) {
+	app := fiber.New()
+
+	// Another middleware using the same bare string keys
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("tenant", "auth-realm")
+		c.Locals("tenant_db", "not-a-db")
+		return c.Next()
+	})
+
+	app.Use(New(Config{
+		Store:    tenanttest.NewStore(t),
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+
+	app.Get("/test", func(c *fiber.Ctx) error {
+		if GetTenantDB(c) == nil {
+			t.Error("Expected tenant DB under the typed key")
+		}
+		return c.SendString(GetTenant(c) + "|" + c.Locals("tenant").(string))
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "tenant1|auth-realm" {
+		t.Fatalf("Expected both values to survive, got '%s'", string(body))
+	}
+}
+
+func TestConfigAccessors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{
+			name: "Typed keys",
+			cfg:  Config{Resolver: HeaderResolver("X-Tenant-ID")},
+		},
+		{
+			name: "Legacy string keys",
+			cfg: Config{
+				Resolver:     HeaderResolver("X-Tenant-ID"),
+				ContextKey:   "custom_tenant",
+				DBContextKey: "custom_tenant_db",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Store = tenanttest.NewStore(t)
+
+			app := fiber.New()
+			app.Use(New(cfg))
+			app.Get("/test", func(c *fiber.Ctx) error {
+				if cfg.DB(c) == nil {
+					t.Error("Expected tenant DB from config accessor")
+				}
+				if cfg.ContextKey != "" && GetTenant(c, cfg.ContextKey) != cfg.Tenant(c) {
+					t.Error("Expected tenant under the legacy key as well")
+				}
+				return c.SendString(cfg.Tenant(c))
+			})
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.Header.Set("X-Tenant-ID", "tenant1")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != "tenant1" {
+				t.Fatalf("Expected 'tenant1', got '%s'", string(body))
+			}
+		})
+	}
+}
+
+func TestProvisioningErrorsMapToStatus(t *testing.T) {
+	tests := []struct {
+		err        error
+		status     int
+		retryAfter string
+	}{
+		{fmt.Errorf("%w: 5 of 5 tenants exist", tenantstore.ErrTenantQuotaExceeded), fiber.StatusServiceUnavailable, ""},
+		{tenantstore.ErrProvisionRateLimited, fiber.StatusTooManyRequests, ""},
+		{fmt.Errorf("%w: too many clients", tenantstore.ErrDatabaseSaturated), fiber.StatusServiceUnavailable, "1"},
+		{errors.New("connection refused"), fiber.StatusServiceUnavailable, ""},
+	}
+
+	for _, tt := range tests {
+		app := fiber.New()
+		app.Use(New(Config{
+			Store:    &failingTenantStore{Store: tenanttest.NewStore(t), err: tt.err},
+			Resolver: HeaderResolver("X-Tenant-ID"),
+		}))
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Tenant-ID", "tenant1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Fatalf("Expected status %d for %v, got %d", tt.status, tt.err, resp.StatusCode)
+		}
+		if got := resp.Header.Get("Retry-After"); got != tt.retryAfter {
+			t.Fatalf("Expected Retry-After %q for %v, got %q", tt.retryAfter, tt.err, got)
+		}
+	}
+}
+
+// The tenant stored by the middleware must stay intact after Fiber reuses the
+// request's buffers, even with Immutable disabled
+func TestTenantOutlivesRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		resolver TenantResolver
+		request  func(tenant string) *http.Request
+	}{
+		{
+			name:     "Subdomain",
+			resolver: SubdomainResolver,
+			request: func(tenant string) *http.Request {
+				req := httptest.NewRequest("GET", "/", nil)
+				req.Host = tenant + ".localhost"
+				return req
+			},
+		},
+		{
+			name:     "Header",
+			resolver: HeaderResolver("X-Tenant-ID"),
+			request: func(tenant string) *http.Request {
+				req := httptest.NewRequest("GET", "/", nil)
+				req.Header.Set("X-Tenant-ID", tenant)
+				return req
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &recordingTenantStore{Store: tenanttest.NewStore(t)}
+			app := fiber.New()
+			app.Use(New(Config{Store: store, Resolver: tc.resolver}))
+
+			captured := make(chan string, 1)
+			release := make(chan struct{})
+			app.Get("/", func(c *fiber.Ctx) error {
+				tenant := GetTenant(c)
+				if tenant == "aaaaaaaa" {
+					go func() {
+						<-release
+						captured <- tenant
+					}()
+				}
+				return c.SendString(tenant)
+			})
+
+			if _, err := app.Test(tc.request("aaaaaaaa")); err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			for i := 0; i < 10; i++ {
+				if _, err := app.Test(tc.request("bbbbbbbb")); err != nil {
+					t.Fatalf("Request failed: %v", err)
+				}
+			}
+			close(release)
+
+			if got := <-captured; got != "aaaaaaaa" {
+				t.Fatalf("Expected captured tenant aaaaaaaa, got %q", got)
+			}
+			if got := store.tenants[0]; got != "aaaaaaaa" {
+				t.Fatalf("Expected store to keep tenant aaaaaaaa, got %q", got)
+			}
+		})
+	}
+}
+
+// recordingTenantStore keeps the tenants the middleware asked for
+type recordingTenantStore struct {
+	*tenanttest.Store
+	tenants []string
+}
+
+func (r *recordingTenantStore) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	r.tenants = append(r.tenants, tenantSchema)
+	return r.Store.GetTenantDB(ctx, tenantSchema)
+}
+
+func TestRewriteTenant(t *testing.T) {
+	store := &recordingTenantStore{Store: tenanttest.NewStore(t)}
+	legacy := map[string]string{"cust-0042": "acme"}
+
+	var resolved []string
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:    store,
+		Resolver: HeaderResolver("X-Tenant-ID"),
+		RewriteTenant: func(c *fiber.Ctx, tenant string) (string, error) {
+			switch {
+			case tenant == "retired":
+				return "", fiber.NewError(fiber.StatusGone, "Tenant was retired")
+			case tenant == "broken":
+				return "bad\x00slug", nil
+			case legacy[tenant] != "":
+				return legacy[tenant], nil
+			}
+			return tenant, nil
+		},
+		VerifyTenantAccess: func(c *fiber.Ctx, tenant string) error {
+			if tenant == "cust-0042" {
+				return errors.New("legacy IDs must be rewritten before verification")
+			}
+			return nil
+		},
+		OnTenantResolved: func(c *fiber.Ctx, tenant string) error {
+			resolved = append(resolved, tenant)
+			return nil
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+
+	request := func(tenant string) (int, string) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Tenant-ID", tenant)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := request("cust-0042"); status != fiber.StatusOK || body != "acme" {
+		t.Fatalf("Expected the legacy ID to be served as acme, got %d %s", status, body)
+	}
+	if status, body := request("globex"); status != fiber.StatusOK || body != "globex" {
+		t.Fatalf("Expected globex unchanged, got %d %s", status, body)
+	}
+	if len(store.tenants) != 2 || store.tenants[0] != "acme" || store.tenants[1] != "globex" {
+		t.Fatalf("Expected the store to see acme and globex, got %v", store.tenants)
+	}
+	if len(resolved) != 2 || resolved[0] != "acme" {
+		t.Fatalf("Expected OnTenantResolved to see the rewritten tenant, got %v", resolved)
+	}
+
+	if status, body := request("retired"); status != fiber.StatusGone || !strings.Contains(body, ErrorCodeTenantResolutionFailed) {
+		t.Fatalf("Expected the rewriter's 410, got %d %s", status, body)
+	}
+	if status, _ := request("broken"); status != fiber.StatusBadRequest {
+		t.Fatalf("Expected an invalid rewrite to be rejected with 400, got %d", status)
+	}
+	if len(store.tenants) != 2 {
+		t.Fatalf("Expected failed rewrites not to reach the store, got %v", store.tenants)
+	}
+}
+
+func TestResolvedTenantValidated(t *testing.T) {
+	for _, rewrite := range []bool{false, true} {
+		store := &recordingTenantStore{Store: tenanttest.NewStore(t)}
+		cfg := Config{
+			Store: store,
+			Resolver: func(c *fiber.Ctx) (string, error) {
+				return c.Query("tenant"), nil
+			},
+		}
+		if rewrite {
+			cfg.RewriteTenant = func(c *fiber.Ctx, tenant string) (string, error) {
+				return tenant, nil
+			}
+		}
+		app := fiber.New()
+		app.Use(New(cfg))
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendString(GetTenant(c))
+		})
+
+		for _, tenant := range []string{"bad%00slug", "..%2Fetc", "a%0Ab"} {
+			resp, err := app.Test(httptest.NewRequest("GET", "/?tenant="+tenant, nil))
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+			var body ErrorResponse
+			json.NewDecoder(resp.Body).Decode(&body)
+			if resp.StatusCode != fiber.StatusBadRequest || body.Code != ErrorCodeTenantResolutionFailed {
+				t.Fatalf("Expected 400 for %s (rewrite %v), got %d %+v", tenant, rewrite, resp.StatusCode, body)
+			}
+		}
+		if len(store.tenants) != 0 {
+			t.Fatalf("Expected invalid tenants not to reach the store, got %v", store.tenants)
+		}
+	}
+}
+
+func TestMiddlewareSetsTenantContext(t *testing.T) {
+	for _, transactional := range []bool{false, true} {
+		store := &countingTenantStore{Store: tenanttest.NewStore(t)}
+
+		app := fiber.New()
+		app.Use(New(Config{
+			Store:                 store,
+			Resolver:              HeaderResolver("X-Tenant-ID"),
+			TransactionalRequests: transactional,
+		}))
+		app.Get("/", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+			tenant, ok := tenantctx.Tenant(ctx)
+			if !ok || tenant != "tenant1" {
+				return fmt.Errorf("expected tenant1 on the user context, got %q", tenant)
+			}
+			db, err := tenantctx.DB(ctx, store)
+			if err != nil {
+				return err
+			}
+			if db.Statement.ConnPool != GetTenantDB(c).Statement.ConnPool {
+				return errors.New("expected the request DB on the user context")
+			}
+			return c.SendStatus(fiber.StatusNoContent)
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Tenant-ID", "tenant1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusNoContent {
+			body, _ := io.ReadAll(resp.Body)
+			t.Fatalf("Expected status 204 (transactional %v), got %d: %s", transactional, resp.StatusCode, body)
+		}
+		if store.calls != 1 {
+			t.Fatalf("Expected the middleware's lookup only, got %d", store.calls)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults of OpenAPIConfig
+const (
+	DefaultOpenAPIScheme = "https"
+	DefaultOpenAPITenant = "acme"
+)
+
+// OpenAPIConfig configures TemplateOpenAPIServers and ServeOpenAPI
+type OpenAPIConfig struct {
+	// Optional: Domain the tenant subdomains precede, as in SubdomainConfig,
+	// e.g. "api.example.com". Without it documents keep their servers
+	// unless they are served through a tenant host.
+	BaseDomain string
+
+	// Optional: Scheme of the server URLs (defaults to DefaultOpenAPIScheme)
+	Scheme string
+
+	// Optional: Path of the API below the host, e.g. "/v1"
+	BasePath string
+
+	// Optional: Default of the tenant variable in the templated server
+	// (defaults to DefaultOpenAPITenant)
+	DefaultTenant string
+}
+
+// withDefaults returns the config with defaults filled in
+func (cfg OpenAPIConfig) withDefaults() OpenAPIConfig {
+	if cfg.Scheme == "" {
+		cfg.Scheme = DefaultOpenAPIScheme
+	}
+	if cfg.DefaultTenant == "" {
+		cfg.DefaultTenant = DefaultOpenAPITenant
+	}
+	cfg.BaseDomain = strings.ToLower(strings.Trim(cfg.BaseDomain, "."))
+	cfg.BasePath = strings.TrimSuffix(cfg.BasePath, "/")
+	return cfg
+}
+
+// openAPIServer is an entry of an OpenAPI servers section
+type openAPIServer struct {
+	URL         string                           `json:"url" yaml:"url"`
+	Description string                           `json:"description,omitempty" yaml:"description,omitempty"`
+	Variables   map[string]openAPIServerVariable `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+// openAPIServerVariable is a variable of a templated server URL
+type openAPIServerVariable struct {
+	Default     string `json:"default" yaml:"default"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// templatedServer is the server of every tenant, with the tenant as
+// variable
+func (cfg OpenAPIConfig) templatedServer() openAPIServer {
+	return openAPIServer{
+		URL:         cfg.Scheme + "://{tenant}." + cfg.BaseDomain + cfg.BasePath,
+		Description: "Tenant API",
+		Variables: map[string]openAPIServerVariable{
+			"tenant": {Default: cfg.DefaultTenant, Description: "Your tenant's subdomain"},
+		},
+	}
+}
+
+// tenantServer is the server of the tenant at host
+func (cfg OpenAPIConfig) tenantServer(host string) openAPIServer {
+	return openAPIServer{URL: cfg.Scheme + "://" + host + cfg.BasePath}
+}
+
+// TemplateOpenAPIServers replaces the servers section of an OpenAPI document,
+// JSON or YAML, with one server templated on the tenant subdomain:
+//
+//	servers:
+//	  - url: https://{tenant}.api.example.com/v1
+//	    variables:
+//	      tenant:
+//	        default: acme
+//
+// The document keeps its format; YAML documents keep their key order and
+// comments. cfg.BaseDomain is required.
+func TemplateOpenAPIServers(doc []byte, cfg OpenAPIConfig) ([]byte, error) {
+	cfg = cfg.withDefaults()
+	if cfg.BaseDomain == "" {
+		return nil, fmt.Errorf("templating OpenAPI servers requires a BaseDomain")
+	}
+	parsed, err := parseOpenAPI(doc)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.withServers(cfg.templatedServer())
+}
+
+// ServeOpenAPI returns a handler serving an OpenAPI document, JSON or YAML.
+// Mounted after New, requests through a tenant host, such as
+// acme.api.example.com or a tenant's custom domain, get the document with
+// that host as the only server, so "try it out" calls reach the tenant.
+// Other requests get the servers templated by TemplateOpenAPIServers with a
+// BaseDomain, or the document as it is. Hosts are only used once the
+// middleware resolved a tenant for the request.
+//
+//	app.Get("/openapi.json", middleware.ServeOpenAPI(spec, middleware.OpenAPIConfig{BaseDomain: "api.example.com"}))
+func ServeOpenAPI(doc []byte, config ...OpenAPIConfig) fiber.Handler {
+	var cfg OpenAPIConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	cfg = cfg.withDefaults()
+
+	parsed, err := parseOpenAPI(doc)
+	if err != nil {
+		panic(fmt.Sprintf("ServeOpenAPI: %v", err))
+	}
+	shared := doc
+	if cfg.BaseDomain != "" {
+		if shared, err = parsed.withServers(cfg.templatedServer()); err != nil {
+			panic(fmt.Sprintf("ServeOpenAPI: %v", err))
+		}
+	}
+	contentType := "application/yaml"
+	if parsed.json != nil {
+		contentType = fiber.MIMEApplicationJSONCharsetUTF8
+	}
+
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Set(fiber.HeaderVary, fiber.HeaderHost)
+
+		host := strings.ToLower(c.Hostname())
+		name, _, _ := strings.Cut(host, ":")
+		if GetTenant(c) == "" || name == "" || name == cfg.BaseDomain {
+			return c.Send(shared)
+		}
+		body, err := parsed.withServers(cfg.tenantServer(host))
+		if err != nil {
+			return err
+		}
+		return c.Send(body)
+	}
+}
+
+// openAPIDocument is a parsed OpenAPI document, either JSON or YAML
+type openAPIDocument struct {
+	json map[string]interface{}
+	yaml *yaml.Node
+}
+
+// parseOpenAPI parses a JSON document, or a YAML one when it does not start
+// with a brace
+func parseOpenAPI(doc []byte) (*openAPIDocument, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(doc), []byte("{")) {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal(doc, &parsed); err != nil {
+			return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+		}
+		return &openAPIDocument{json: parsed}, nil
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(doc, &node); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	if node.Kind != yaml.DocumentNode || len(node.Content) != 1 || node.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: not a mapping")
+	}
+	return &openAPIDocument{yaml: &node}, nil
+}
+
+// withServers encodes the document with its servers replaced. The parsed
+// document is shared by requests, so it is copied, not changed.
+func (d *openAPIDocument) withServers(servers ...openAPIServer) ([]byte, error) {
+	if d.json != nil {
+		doc := make(map[string]interface{}, len(d.json)+1)
+		for key, value := range d.json {
+			doc[key] = value
+		}
+		doc["servers"] = servers
+		return json.Marshal(doc)
+	}
+
+	var value yaml.Node
+	if err := value.Encode(servers); err != nil {
+		return nil, fmt.Errorf("failed to encode OpenAPI servers: %w", err)
+	}
+
+	root := *d.yaml.Content[0]
+	root.Content = append([]*yaml.Node(nil), root.Content...)
+	replaced := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "servers" {
+			root.Content[i+1] = &value
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "servers"}
+		root.Content = append(root.Content, key, &value)
+	}
+
+	doc := *d.yaml
+	doc.Content = []*yaml.Node{&root}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to encode OpenAPI document: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode OpenAPI document: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at the spec
+var swaggerUIPage = template.Must(template.New("swagger-ui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>API documentation</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({url: {{.}}, dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`))
+
+// ServeSwaggerUI returns a handler serving Swagger UI for the document at
+// specPath, typically a ServeOpenAPI route. The page loads the document
+// from the host it was served on, so on a tenant host it shows the
+// tenant's server.
+//
+//	app.Get("/docs", middleware.ServeSwaggerUI("/openapi.json"))
+func ServeSwaggerUI(specPath string) fiber.Handler {
+	var page bytes.Buffer
+	if err := swaggerUIPage.Execute(&page, specPath); err != nil {
+		panic(fmt.Sprintf("ServeSwaggerUI: %v", err))
+	}
+	body := page.Bytes()
+
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.Send(body)
+	}
+}
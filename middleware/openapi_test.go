@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+const openAPIYAML = `openapi: 3.0.3
+info:
+  title: Orders API # shown in the docs
+  version: 1.0.0
+servers:
+  - url: https://staging.example.com
+paths:
+  /orders:
+    get:
+      summary: List orders
+`
+
+const openAPIJSON = `{"openapi": "3.0.3", "info": {"title": "Orders API", "version": "1.0.0"}, "paths": {}}`
+
+// openAPIServers returns the server URLs of a JSON or YAML document
+func openAPIServers(t *testing.T, doc []byte) []string {
+	t.Helper()
+
+	var parsed struct {
+		Servers []struct {
+			URL string `json:"url" yaml:"url"`
+		} `json:"servers" yaml:"servers"`
+	}
+	if err := yaml.Unmarshal(doc, &parsed); err != nil {
+		t.Fatalf("Failed to parse document: %v", err)
+	}
+	var urls []string
+	for _, server := range parsed.Servers {
+		urls = append(urls, server.URL)
+	}
+	return urls
+}
+
+func TestTemplateOpenAPIServers(t *testing.T) {
+	cfg := OpenAPIConfig{BaseDomain: "api.example.com", BasePath: "/v1/"}
+
+	doc, err := TemplateOpenAPIServers([]byte(openAPIYAML), cfg)
+	if err != nil {
+		t.Fatalf("Failed to template: %v", err)
+	}
+	if servers := openAPIServers(t, doc); len(servers) != 1 || servers[0] != "https://{tenant}.api.example.com/v1" {
+		t.Fatalf("Expected the templated server, got %v", servers)
+	}
+	text := string(doc)
+	if !strings.Contains(text, "default: acme") || !strings.Contains(text, "# shown in the docs") {
+		t.Fatalf("Expected the tenant variable and the comments, got:\n%s", text)
+	}
+	if strings.Index(text, "info:") > strings.Index(text, "servers:") || strings.Index(text, "servers:") > strings.Index(text, "paths:") {
+		t.Fatalf("Expected the key order to be kept, got:\n%s", text)
+	}
+
+	doc, err = TemplateOpenAPIServers([]byte(openAPIJSON), OpenAPIConfig{BaseDomain: "api.example.com", DefaultTenant: "demo"})
+	if err != nil {
+		t.Fatalf("Failed to template: %v", err)
+	}
+	var parsed struct {
+		Servers []openAPIServer `json:"servers"`
+	}
+	if err := json.Unmarshal(doc, &parsed); err != nil {
+		t.Fatalf("Expected JSON, got %s: %v", doc, err)
+	}
+	if len(parsed.Servers) != 1 || parsed.Servers[0].URL != "https://{tenant}.api.example.com" || parsed.Servers[0].Variables["tenant"].Default != "demo" {
+		t.Fatalf("Expected the templated server with demo as default, got %+v", parsed.Servers)
+	}
+
+	if _, err := TemplateOpenAPIServers([]byte(openAPIJSON), OpenAPIConfig{}); err == nil {
+		t.Fatal("Expected an error without a BaseDomain")
+	}
+	if _, err := TemplateOpenAPIServers([]byte("- not a document"), cfg); err == nil {
+		t.Fatal("Expected an error for a document that is not a mapping")
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	store := tenanttest.NewStore(t)
+	customDomains := map[string]string{"docs.globex.com": "globex"}
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store: store,
+		Resolver: ChainResolvers(
+			SubdomainResolverWithConfig(SubdomainConfig{BaseDomain: "api.example.com"}),
+			func(c *fiber.Ctx) (string, error) {
+				if tenant, ok := customDomains[c.Hostname()]; ok {
+					return tenant, nil
+				}
+				return "", fiber.ErrBadRequest
+			},
+		),
+		Skip: func(c *fiber.Ctx) bool { return c.Hostname() == "api.example.com" },
+	}))
+	app.Get("/openapi.yaml", ServeOpenAPI([]byte(openAPIYAML), OpenAPIConfig{BaseDomain: "api.example.com", BasePath: "/v1"}))
+	app.Get("/openapi.json", ServeOpenAPI([]byte(openAPIJSON)))
+	app.Get("/docs", ServeSwaggerUI("/openapi.yaml"))
+
+	request := func(t *testing.T, host, path string) (*http.Response, []byte) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = host
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("Expected 200 from %s%s, got %d: %s", host, path, resp.StatusCode, body)
+		}
+		return resp, body
+	}
+
+	tests := []struct {
+		name    string
+		host    string
+		path    string
+		servers []string
+	}{
+		{name: "Subdomain tenant", host: "acme.api.example.com", path: "/openapi.yaml", servers: []string{"https://acme.api.example.com/v1"}},
+		{name: "Custom domain tenant", host: "docs.globex.com", path: "/openapi.yaml", servers: []string{"https://docs.globex.com/v1"}},
+		{name: "Shared host", host: "api.example.com", path: "/openapi.yaml", servers: []string{"https://{tenant}.api.example.com/v1"}},
+		{name: "JSON on a tenant host", host: "acme.api.example.com", path: "/openapi.json", servers: []string{"https://acme.api.example.com"}},
+		{name: "JSON on the shared host", host: "api.example.com", path: "/openapi.json", servers: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := request(t, tt.host, tt.path)
+			servers := openAPIServers(t, body)
+			if strings.Join(servers, ",") != strings.Join(tt.servers, ",") {
+				t.Fatalf("Expected servers %v, got %v in:\n%s", tt.servers, servers, body)
+			}
+			if vary := resp.Header.Get(fiber.HeaderVary); vary != fiber.HeaderHost {
+				t.Fatalf("Expected Vary: Host, got %q", vary)
+			}
+		})
+	}
+
+	if _, body := request(t, "acme.api.example.com", "/openapi.json"); !json.Valid(body) {
+		t.Fatalf("Expected JSON documents to stay JSON, got %s", body)
+	}
+	if _, body := request(t, "acme.api.example.com", "/docs"); !strings.Contains(string(body), `url: "/openapi.yaml"`) {
+		t.Fatalf("Expected Swagger UI to load the spec, got %s", body)
+	}
+}
@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Limits is what a tenant's plan allows. Zero values are unlimited.
+type Limits struct {
+	// MaxBodyBytes caps the request body size
+	MaxBodyBytes int64
+
+	// MaxRequestsPerDay caps the requests counted per day. Rejected requests
+	// count too, so clients that keep retrying stay rejected.
+	MaxRequestsPerDay int64
+
+	// AllowedRoutes lists the path prefixes the tenant may call, such as
+	// "/api/orders". Nil allows every route.
+	AllowedRoutes []string
+}
+
+// PlanUsage is the tenant's plan and usage for the current day, stored by
+// PlanLimits for handlers serving a usage API
+type PlanUsage struct {
+	Limits   Limits
+	Requests int64
+	ResetsAt time.Time
+}
+
+// UsageStorage keeps the daily request counters. Implement it on a shared
+// store such as Redis when several instances serve the same tenants.
+type UsageStorage interface {
+	// Increment adds a request to the tenant's counter for the day starting
+	// at period and returns the new count
+	Increment(ctx context.Context, tenant string, period time.Time) (int64, error)
+
+	// Get returns the tenant's count for the day starting at period
+	Get(ctx context.Context, tenant string, period time.Time) (int64, error)
+}
+
+// PlanLimitsConfig configures PlanLimits
+type PlanLimitsConfig struct {
+	// LimitsFor returns the limits of the tenant's plan (required)
+	LimitsFor func(ctx context.Context, tenant string) (Limits, error)
+
+	// Optional: Daily counters (defaults to NewMemoryUsageStorage)
+	Storage UsageStorage
+
+	// Optional: Time of day the counters reset, as an offset from midnight
+	// in Location
+	ResetAt time.Duration
+
+	// Optional: Location of the daily boundary (defaults to UTC)
+	Location *time.Location
+
+	// Optional: Locals key the tenant middleware stores the tenant under
+	ContextKey string
+
+	// Optional: Custom error handler. Limit errors are passed as *Error with
+	// the code PLAN_LIMIT_EXCEEDED. Defaults to DefaultErrorHandler.
+	ErrorHandler func(c *fiber.Ctx, err error) error
+
+	// Optional: Make the default error handler respond with the body used
+	// before ErrorResponse, {"error": "plan_limit_exceeded", "message": ...}
+	LegacyErrorBody bool
+}
+
+type planUsageKey struct{}
+
+var (
+	errRouteNotAllowed = fiber.NewError(fiber.StatusForbidden, "Route is not included in the tenant's plan")
+	errBodyTooLarge    = fiber.NewError(fiber.StatusRequestEntityTooLarge, "Request body exceeds the tenant's plan limit")
+	errDailyQuota      = fiber.NewError(fiber.StatusTooManyRequests, "Daily request quota of the tenant's plan exceeded")
+)
+
+// PlanLimits enforces per-tenant plan limits: routes outside AllowedRoutes
+// get 403, bodies over MaxBodyBytes get 413 before they are parsed, and
+// requests over MaxRequestsPerDay get 429 with Retry-After set to the reset.
+// Register it after the tenant middleware; untenanted requests pass through.
+//
+// Fiber buffers request bodies up to fiber.Config.BodyLimit before any
+// handler runs. Enable fiber.Config.StreamRequestBody so oversized bodies
+// without a Content-Length are cut off after MaxBodyBytes instead.
+func PlanLimits(cfg PlanLimitsConfig) fiber.Handler {
+	if cfg.LimitsFor == nil {
+		panic("PlanLimits requires LimitsFor")
+	}
+	if cfg.Storage == nil {
+		cfg.Storage = NewMemoryUsageStorage()
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = DefaultErrorHandler
+		if cfg.LegacyErrorBody {
+			cfg.ErrorHandler = legacyErrorHandler("plan_limit_exceeded", fiber.StatusInternalServerError)
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		tenant := GetTenant(c, cfg.ContextKey)
+		if tenant == "" {
+			return c.Next()
+		}
+
+		limits, err := cfg.LimitsFor(c.UserContext(), tenant)
+		if err != nil {
+			return cfg.ErrorHandler(c, newError(ErrorCodePlanLimitsUnavailable, 0, fiber.NewError(fiber.StatusServiceUnavailable, "Plan limits unavailable")))
+		}
+
+		if !routeAllowed(limits.AllowedRoutes, c.Path()) {
+			return cfg.ErrorHandler(c, newError(ErrorCodePlanLimitExceeded, 0, errRouteNotAllowed))
+		}
+
+		if limits.MaxBodyBytes > 0 {
+			if err := limitBody(c, limits.MaxBodyBytes); err != nil {
+				return cfg.ErrorHandler(c, newError(ErrorCodePlanLimitExceeded, 0, err))
+			}
+		}
+
+		period, resetsAt := cfg.period(time.Now())
+		usage := PlanUsage{Limits: limits, ResetsAt: resetsAt}
+
+		usage.Requests, err = cfg.Storage.Increment(c.UserContext(), tenant, period)
+		if err != nil {
+			return cfg.ErrorHandler(c, newError(ErrorCodePlanLimitsUnavailable, 0, fiber.NewError(fiber.StatusServiceUnavailable, "Plan usage unavailable")))
+		}
+		if limits.MaxRequestsPerDay > 0 && usage.Requests > limits.MaxRequestsPerDay {
+			retryAfter := time.Until(resetsAt).Seconds()
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(retryAfter)+1))
+			return cfg.ErrorHandler(c, newError(ErrorCodePlanLimitExceeded, 0, errDailyQuota))
+		}
+
+		c.Locals(planUsageKey{}, usage)
+		return c.Next()
+	}
+}
+
+// GetPlanUsage returns the plan and usage PlanLimits recorded for the request
+func GetPlanUsage(c *fiber.Ctx) (PlanUsage, bool) {
+	usage, ok := c.Locals(planUsageKey{}).(PlanUsage)
+	return usage, ok
+}
+
+// Usage returns the tenant's request count for the current day, for usage
+// APIs outside the tenant's own requests. The config must set Storage to
+// the storage the middleware uses.
+func (cfg PlanLimitsConfig) Usage(ctx context.Context, tenant string) (int64, error) {
+	if cfg.Storage == nil {
+		return 0, errors.New("PlanLimitsConfig.Storage is not set")
+	}
+	period, _ := cfg.period(time.Now())
+	return cfg.Storage.Get(ctx, tenant, period)
+}
+
+// period returns the start of the day now falls in and when it ends
+func (cfg PlanLimitsConfig) period(now time.Time) (time.Time, time.Time) {
+	loc := cfg.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	now = now.In(loc)
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).Add(cfg.ResetAt)
+	if now.Before(start) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start, start.AddDate(0, 0, 1)
+}
+
+// routeAllowed reports whether path is below one of the allowed prefixes
+func routeAllowed(allowed []string, path string) bool {
+	if allowed == nil {
+		return true
+	}
+	for _, prefix := range allowed {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// limitBody rejects bodies over max. Buffered bodies are already read, so
+// only their length is checked. Streamed bodies are rejected by their
+// Content-Length, or read through a limited reader so at most max+1 bytes
+// are buffered before the request is rejected.
+func limitBody(c *fiber.Ctx, max int64) error {
+	req := c.Request()
+	if !req.IsBodyStream() {
+		if int64(len(req.Body())) > max {
+			return errBodyTooLarge
+		}
+		return nil
+	}
+
+	// The rest of a rejected stream is never read, so the connection cannot
+	// be reused for another request
+	if int64(req.Header.ContentLength()) > max {
+		c.Context().SetConnectionClose()
+		return errBodyTooLarge
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.BodyStream(), max+1))
+	if err != nil {
+		c.Context().SetConnectionClose()
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to read request body")
+	}
+	if int64(len(body)) > max {
+		c.Context().SetConnectionClose()
+		return errBodyTooLarge
+	}
+	req.SetBody(body)
+	return nil
+}
+
+// MemoryUsageStorage is a UsageStorage in process memory. Each tenant keeps
+// only the current day's counter.
+type MemoryUsageStorage struct {
+	mu       sync.Mutex
+	counters map[string]usageCounter
+}
+
+type usageCounter struct {
+	period time.Time
+	count  int64
+}
+
+// NewMemoryUsageStorage returns an empty MemoryUsageStorage
+func NewMemoryUsageStorage() *MemoryUsageStorage {
+	return &MemoryUsageStorage{counters: make(map[string]usageCounter)}
+}
+
+// Increment implements UsageStorage
+func (m *MemoryUsageStorage) Increment(ctx context.Context, tenant string, period time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter := m.counters[tenant]
+	if !counter.period.Equal(period) {
+		counter = usageCounter{period: period}
+	}
+	counter.count++
+	m.counters[strings.Clone(tenant)] = counter
+	return counter.count, nil
+}
+
+// Get implements UsageStorage
+func (m *MemoryUsageStorage) Get(ctx context.Context, tenant string, period time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter := m.counters[tenant]
+	if !counter.period.Equal(period) {
+		return 0, nil
+	}
+	return counter.count, nil
+}
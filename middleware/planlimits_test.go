@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+var testPlans = map[string]Limits{
+	"free": {
+		MaxBodyBytes:      16,
+		MaxRequestsPerDay: 2,
+		AllowedRoutes:     []string{"/orders"},
+	},
+	"pro": {},
+}
+
+func newPlanLimitsTestApp(t *testing.T, fiberConfig fiber.Config, storage UsageStorage) *fiber.App {
+	app := fiber.New(fiberConfig)
+	app.Use(New(Config{
+		Store:    tenanttest.NewStore(t),
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+	app.Use(PlanLimits(PlanLimitsConfig{
+		LimitsFor: func(ctx context.Context, tenant string) (Limits, error) {
+			limits, ok := testPlans[tenant]
+			if !ok {
+				return Limits{}, errors.New("unknown plan")
+			}
+			return limits, nil
+		},
+		Storage: storage,
+	}))
+
+	handler := func(c *fiber.Ctx) error {
+		usage, _ := GetPlanUsage(c)
+		return c.JSON(fiber.Map{"requests": usage.Requests, "body": len(c.Body())})
+	}
+	app.Post("/orders", handler)
+	app.Get("/orders/:id", handler)
+	app.Get("/reports", handler)
+
+	return app
+}
+
+func doPlanLimitsRequest(t *testing.T, app *fiber.App, tenant, method, path string, body io.Reader) (int, map[string]interface{}, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("X-Tenant-ID", tenant)
+	if req.ContentLength < 0 {
+		req.TransferEncoding = []string{"chunked"}
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result, resp.Header.Get(fiber.HeaderRetryAfter)
+}
+
+func TestPlanLimitsRoutes(t *testing.T) {
+	app := newPlanLimitsTestApp(t, fiber.Config{}, nil)
+
+	status, _, _ := doPlanLimitsRequest(t, app, "free", "GET", "/orders/1", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("Expected status 200 below an allowed prefix, got %d", status)
+	}
+
+	status, result, _ := doPlanLimitsRequest(t, app, "free", "GET", "/reports", nil)
+	if status != fiber.StatusForbidden || result["code"] != ErrorCodePlanLimitExceeded {
+		t.Fatalf("Expected 403 PLAN_LIMIT_EXCEEDED, got %d %v", status, result)
+	}
+	if result["tenant"] != "free" {
+		t.Fatalf("Expected the tenant in the error, got %v", result)
+	}
+
+	status, _, _ = doPlanLimitsRequest(t, app, "pro", "GET", "/reports", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("Expected status 200 without route limits, got %d", status)
+	}
+
+	if routeAllowed([]string{"/orders"}, "/ordersexport") {
+		t.Fatal("Expected prefixes to match whole path segments")
+	}
+}
+
+func TestPlanLimitsBodySize(t *testing.T) {
+	app := newPlanLimitsTestApp(t, fiber.Config{}, nil)
+
+	status, result, _ := doPlanLimitsRequest(t, app, "free", "POST", "/orders", strings.NewReader("small"))
+	if status != fiber.StatusOK || result["body"] != float64(5) {
+		t.Fatalf("Expected status 200 with the body, got %d %v", status, result)
+	}
+
+	status, result, _ = doPlanLimitsRequest(t, app, "free", "POST", "/orders", strings.NewReader(strings.Repeat("x", 17)))
+	if status != fiber.StatusRequestEntityTooLarge || result["code"] != ErrorCodePlanLimitExceeded {
+		t.Fatalf("Expected 413 PLAN_LIMIT_EXCEEDED, got %d %v", status, result)
+	}
+
+	status, _, _ = doPlanLimitsRequest(t, app, "pro", "POST", "/orders", strings.NewReader(strings.Repeat("x", 17)))
+	if status != fiber.StatusOK {
+		t.Fatalf("Expected status 200 without a body limit, got %d", status)
+	}
+}
+
+func TestPlanLimitsStreamedBodySize(t *testing.T) {
+	app := newPlanLimitsTestApp(t, fiber.Config{StreamRequestBody: true}, nil)
+
+	// A reader of unknown length is sent chunked, without Content-Length
+	chunked := func(body string) io.Reader {
+		return io.MultiReader(strings.NewReader(body))
+	}
+
+	status, result, _ := doPlanLimitsRequest(t, app, "free", "POST", "/orders", chunked("small"))
+	if status != fiber.StatusOK || result["body"] != float64(5) {
+		t.Fatalf("Expected status 200 with the body, got %d %v", status, result)
+	}
+
+	status, _, _ = doPlanLimitsRequest(t, app, "free", "POST", "/orders", chunked(strings.Repeat("x", 1024)))
+	if status != fiber.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413, got %d", status)
+	}
+}
+
+func TestPlanLimitsDailyQuota(t *testing.T) {
+	storage := NewMemoryUsageStorage()
+	app := newPlanLimitsTestApp(t, fiber.Config{}, storage)
+
+	for i := 1; i <= 2; i++ {
+		status, result, _ := doPlanLimitsRequest(t, app, "free", "GET", "/orders/1", nil)
+		if status != fiber.StatusOK || result["requests"] != float64(i) {
+			t.Fatalf("Expected status 200 as request %d, got %d %v", i, status, result)
+		}
+	}
+
+	status, result, retryAfter := doPlanLimitsRequest(t, app, "free", "GET", "/orders/1", nil)
+	if status != fiber.StatusTooManyRequests || result["code"] != ErrorCodePlanLimitExceeded {
+		t.Fatalf("Expected 429 PLAN_LIMIT_EXCEEDED, got %d %v", status, result)
+	}
+	if retryAfter == "" {
+		t.Fatal("Expected Retry-After until the daily reset")
+	}
+
+	// Other tenants have their own counters
+	status, _, _ = doPlanLimitsRequest(t, app, "pro", "GET", "/orders/1", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("Expected status 200 for another tenant, got %d", status)
+	}
+
+	used, err := PlanLimitsConfig{Storage: storage}.Usage(context.Background(), "free")
+	if err != nil || used != 3 {
+		t.Fatalf("Expected 3 requests counted, got %d (%v)", used, err)
+	}
+}
+
+func TestPlanLimitsResetBoundary(t *testing.T) {
+	cfg := PlanLimitsConfig{ResetAt: 6 * time.Hour}
+
+	before := time.Date(2024, 3, 10, 5, 59, 0, 0, time.UTC)
+	after := time.Date(2024, 3, 10, 6, 0, 0, 0, time.UTC)
+
+	start, end := cfg.period(before)
+	if !start.Equal(time.Date(2024, 3, 9, 6, 0, 0, 0, time.UTC)) || !end.Equal(after) {
+		t.Fatalf("Expected the day to run from 6:00 to 6:00, got %v to %v", start, end)
+	}
+
+	next, _ := cfg.period(after)
+	if !next.Equal(after) {
+		t.Fatalf("Expected a new day at 6:00, got %v", next)
+	}
+
+	storage := NewMemoryUsageStorage()
+	ctx := context.Background()
+	storage.Increment(ctx, "acme", start)
+	storage.Increment(ctx, "acme", start)
+
+	if count, _ := storage.Increment(ctx, "acme", next); count != 1 {
+		t.Fatalf("Expected the counter to reset for the new day, got %d", count)
+	}
+	if count, _ := storage.Get(ctx, "acme", start); count != 0 {
+		t.Fatalf("Expected the previous day to be dropped, got %d", count)
+	}
+}
+
+func TestPlanLimitsUnavailable(t *testing.T) {
+	app := newPlanLimitsTestApp(t, fiber.Config{}, nil)
+
+	status, _, _ := doPlanLimitsRequest(t, app, "unknown", "GET", "/orders/1", nil)
+	if status != fiber.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503 when limits cannot be loaded, got %d", status)
+	}
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Defaults of ProbesConfig
+const (
+	DefaultLivePath              = "/livez"
+	DefaultReadyPath             = "/readyz"
+	DefaultProbeMasterTimeout    = time.Second
+	DefaultMaxTenantFailureRatio = 0.5
+)
+
+// TenantPinger is implemented by stores that can ping the tenant
+// connections they hold without creating any, such as
+// tenantstore.TenantStore. PingTenants pings up to limit of them and returns
+// the error of each pinged schema, nil if it answered.
+type TenantPinger interface {
+	PingTenants(ctx context.Context, limit int) map[string]error
+}
+
+// ReadinessChecker is implemented by stores that are not ready right after
+// they are created, such as tenantstore.TenantStore warming its critical
+// tenants. The readiness probe fails while Ready returns an error.
+type ReadinessChecker interface {
+	Ready(ctx context.Context) error
+}
+
+// ProbesConfig configures Probes
+type ProbesConfig struct {
+	// Optional: Paths of the probes (default to DefaultLivePath and
+	// DefaultReadyPath)
+	LivePath  string
+	ReadyPath string
+
+	// Optional: How long the readiness probe waits for the master database
+	// and tenant pings (defaults to DefaultProbeMasterTimeout)
+	Timeout time.Duration
+
+	// Optional: Number of cached tenant connections pinged by each readiness
+	// probe. The store must implement TenantPinger; zero pings none.
+	TenantSample int
+
+	// Optional: Share of sampled tenants, from 0 to 1, that may fail before
+	// the pod is not ready (defaults to DefaultMaxTenantFailureRatio)
+	MaxTenantFailureRatio float64
+
+	// Optional: Further readiness checks by name, such as the state of a
+	// circuit breaker. A check returning an error makes the pod not ready.
+	Checks map[string]func(ctx context.Context) error
+}
+
+// ProbeResult is the body of the readiness probe
+type ProbeResult struct {
+	Status  string   `json:"status"`
+	Reasons []string `json:"reasons,omitempty"`
+
+	// TenantsPinged and TenantsFailed count the sampled tenants
+	TenantsPinged int `json:"tenants_pinged,omitempty"`
+	TenantsFailed int `json:"tenants_failed,omitempty"`
+}
+
+// Probe statuses
+const (
+	ProbeStatusOK       = "ok"
+	ProbeStatusDegraded = "degraded"
+)
+
+// Probes returns middleware answering Kubernetes probes on two paths and
+// passing other requests on. The liveness probe only reports that the
+// process serves requests and never touches the database. The readiness
+// probe pings the master database, checks the store is ready if it is a
+// ReadinessChecker, pings the sampled tenant connections and runs the
+// Checks, and responds 503 with the reasons in a ProbeResult when any fails.
+// Neither creates schemas or connections. Mount it before New, so probes
+// need no tenant.
+//
+//	app.Use(middleware.Probes(store, middleware.ProbesConfig{TenantSample: 5}))
+//	app.Use(middleware.New(cfg))
+func Probes(store TenantStore, config ...ProbesConfig) fiber.Handler {
+	if store == nil {
+		panic("Probes requires a TenantStore")
+	}
+	var cfg ProbesConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.LivePath == "" {
+		cfg.LivePath = DefaultLivePath
+	}
+	if cfg.ReadyPath == "" {
+		cfg.ReadyPath = DefaultReadyPath
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultProbeMasterTimeout
+	}
+	if cfg.MaxTenantFailureRatio <= 0 {
+		cfg.MaxTenantFailureRatio = DefaultMaxTenantFailureRatio
+	}
+	pinger, _ := store.(TenantPinger)
+	readiness, _ := store.(ReadinessChecker)
+	if pinger == nil {
+		cfg.TenantSample = 0
+	}
+
+	checks := make([]string, 0, len(cfg.Checks))
+	for name := range cfg.Checks {
+		checks = append(checks, name)
+	}
+	sort.Strings(checks)
+
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+			return c.Next()
+		}
+		switch c.Path() {
+		case cfg.LivePath:
+			return c.JSON(ProbeResult{Status: ProbeStatusOK})
+		case cfg.ReadyPath:
+		default:
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), cfg.Timeout)
+		defer cancel()
+
+		result := ProbeResult{Status: ProbeStatusOK}
+		if err := pingMaster(ctx, store); err != nil {
+			result.Reasons = append(result.Reasons, "master: "+err.Error())
+		}
+		if readiness != nil {
+			if err := readiness.Ready(ctx); err != nil {
+				result.Reasons = append(result.Reasons, "startup: "+err.Error())
+			}
+		}
+
+		if cfg.TenantSample > 0 {
+			for _, err := range pinger.PingTenants(ctx, cfg.TenantSample) {
+				result.TenantsPinged++
+				if err != nil {
+					result.TenantsFailed++
+				}
+			}
+			if result.TenantsPinged > 0 && float64(result.TenantsFailed)/float64(result.TenantsPinged) > cfg.MaxTenantFailureRatio {
+				result.Reasons = append(result.Reasons, "tenants: too many sampled tenant connections failing")
+			}
+		}
+
+		for _, name := range checks {
+			if err := cfg.Checks[name](ctx); err != nil {
+				result.Reasons = append(result.Reasons, name+": "+err.Error())
+			}
+		}
+
+		if len(result.Reasons) > 0 {
+			result.Status = ProbeStatusDegraded
+			return c.Status(fiber.StatusServiceUnavailable).JSON(result)
+		}
+		return c.JSON(result)
+	}
+}
+
+func pingMaster(ctx context.Context, store TenantStore) error {
+	sqlDB, err := store.GetMasterDB().DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
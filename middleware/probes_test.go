@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+// pingingStore reports fixed tenant ping results
+type pingingStore struct {
+	*tenanttest.Store
+	pings map[string]error
+}
+
+func (s *pingingStore) PingTenants(ctx context.Context, limit int) map[string]error {
+	return s.pings
+}
+
+func probe(t *testing.T, app *fiber.App, path string) (int, ProbeResult) {
+	t.Helper()
+
+	resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	var result ProbeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode %s: %v", path, err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestProbesMasterDown(t *testing.T) {
+	store := tenanttest.NewStore(t)
+	app := fiber.New()
+	app.Use(Probes(store))
+	app.Use(New(Config{
+		Store:    store,
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+
+	if status, result := probe(t, app, "/readyz"); status != fiber.StatusOK || result.Status != ProbeStatusOK {
+		t.Fatalf("Expected ready, got %d %+v", status, result)
+	}
+
+	sqlDB, err := store.GetMasterDB().DB()
+	if err != nil {
+		t.Fatalf("Failed to get master pool: %v", err)
+	}
+	sqlDB.Close()
+
+	status, result := probe(t, app, "/readyz")
+	if status != fiber.StatusServiceUnavailable || result.Status != ProbeStatusDegraded || len(result.Reasons) != 1 {
+		t.Fatalf("Expected not ready with the master down, got %d %+v", status, result)
+	}
+	if status, result := probe(t, app, "/livez"); status != fiber.StatusOK || result.Status != ProbeStatusOK {
+		t.Fatalf("Expected live with the master down, got %d %+v", status, result)
+	}
+
+	// Probes neither need a tenant nor open one
+	if tenants := store.Tenants(); len(tenants) != 0 {
+		t.Fatalf("Expected no tenant databases, got %v", tenants)
+	}
+}
+
+func TestProbesTenantThreshold(t *testing.T) {
+	down := errors.New("connection refused")
+	store := &pingingStore{
+		Store: tenanttest.NewStore(t),
+		pings: map[string]error{"tenant_a": nil, "tenant_b": down, "tenant_c": nil, "tenant_d": nil},
+	}
+	app := fiber.New()
+	app.Use(Probes(store, ProbesConfig{TenantSample: 4, MaxTenantFailureRatio: 0.25}))
+
+	status, result := probe(t, app, "/readyz")
+	if status != fiber.StatusOK || result.TenantsPinged != 4 || result.TenantsFailed != 1 {
+		t.Fatalf("Expected ready with 1 of 4 tenants failing, got %d %+v", status, result)
+	}
+
+	store.pings["tenant_c"] = down
+	if status, result := probe(t, app, "/readyz"); status != fiber.StatusServiceUnavailable || result.TenantsFailed != 2 {
+		t.Fatalf("Expected not ready with 2 of 4 tenants failing, got %d %+v", status, result)
+	}
+}
+
+func TestProbesChecks(t *testing.T) {
+	var open bool
+	app := fiber.New()
+	app.Use(Probes(tenanttest.NewStore(t), ProbesConfig{
+		ReadyPath: "/health/ready",
+		Checks: map[string]func(ctx context.Context) error{
+			"breaker": func(ctx context.Context) error {
+				if open {
+					return errors.New("open")
+				}
+				return nil
+			},
+		},
+	}))
+	app.Get("/other", func(c *fiber.Ctx) error {
+		return c.SendString("other")
+	})
+
+	if status, _ := probe(t, app, "/health/ready"); status != fiber.StatusOK {
+		t.Fatalf("Expected ready, got %d", status)
+	}
+	open = true
+	status, result := probe(t, app, "/health/ready")
+	if status != fiber.StatusServiceUnavailable || len(result.Reasons) != 1 || result.Reasons[0] != "breaker: open" {
+		t.Fatalf("Expected not ready with the breaker open, got %d %+v", status, result)
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/other", nil))
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected other routes to pass through, got %v %v", resp, err)
+	}
+}
+
+// startingStore is not ready until started is set
+type startingStore struct {
+	*tenanttest.Store
+	started bool
+}
+
+func (s *startingStore) Ready(ctx context.Context) error {
+	if !s.started {
+		return errors.New("critical tenants are not warm yet")
+	}
+	return nil
+}
+
+func TestProbesReadinessChecker(t *testing.T) {
+	store := &startingStore{Store: tenanttest.NewStore(t)}
+	app := fiber.New()
+	app.Use(Probes(store))
+
+	status, result := probe(t, app, "/readyz")
+	if status != fiber.StatusServiceUnavailable || len(result.Reasons) != 1 || result.Reasons[0] != "startup: critical tenants are not warm yet" {
+		t.Fatalf("Expected not ready before start, got %d %+v", status, result)
+	}
+	if status, _ := probe(t, app, "/livez"); status != fiber.StatusOK {
+		t.Fatalf("Expected live before start, got %d", status)
+	}
+
+	store.started = true
+	if status, result := probe(t, app, "/readyz"); status != fiber.StatusOK {
+		t.Fatalf("Expected ready once started, got %d %+v", status, result)
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// providerKey is the key of the value provided for T. Each T gets its own
+// key type, so values of different types never collide.
+type providerKey[T any] struct{}
+
+// providedKey is the Locals key of the request's provided values, kept in
+// one map so Reset can drop them all
+type providedKey struct{}
+
+// Provider constructs a value for the request, see Config.Providers
+type Provider func(c *fiber.Ctx)
+
+// Provide returns the request's T, calling factory with the tenant DB the
+// first time it is asked for and returning the same value for the rest of
+// the request. Use it to build repositories and services that need the
+// tenant DB:
+//
+//	func ordersRepo(c *fiber.Ctx) *OrderRepository {
+//		return middleware.Provide(c, NewOrderRepository)
+//	}
+//
+// Values are memoized per type, so factories returning the same type share
+// one value. Without a tenant DB it returns the zero value and does not call
+// factory; MustProvide panics instead.
+func Provide[T any](c *fiber.Ctx, factory func(db *gorm.DB) T) T {
+	provided, _ := c.Locals(providedKey{}).(map[interface{}]interface{})
+	if value, ok := provided[providerKey[T]{}].(T); ok {
+		return value
+	}
+
+	db := GetTenantDB(c)
+	if db == nil {
+		var zero T
+		return zero
+	}
+
+	value := factory(db)
+	if provided == nil {
+		provided = make(map[interface{}]interface{})
+		c.Locals(providedKey{}, provided)
+	}
+	provided[providerKey[T]{}] = value
+	return value
+}
+
+// MustProvide is Provide that panics without a tenant DB (use in routes
+// after middleware)
+func MustProvide[T any](c *fiber.Ctx, factory func(db *gorm.DB) T) T {
+	if GetTenantDB(c) == nil {
+		panic("tenant database not found in context")
+	}
+	return Provide(c, factory)
+}
+
+// Eager returns a Provider for Config.Providers that constructs T with
+// factory as soon as the tenant is resolved. Handlers then get the same
+// value from Provide.
+func Eager[T any](factory func(db *gorm.DB) T) Provider {
+	return func(c *fiber.Ctx) {
+		Provide(c, factory)
+	}
+}
+
+// provide runs the configured providers
+func (cfg *Config) provide(c *fiber.Ctx) {
+	for _, provider := range cfg.Providers {
+		provider(c)
+	}
+}
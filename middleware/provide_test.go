@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+type provideTestRepo struct {
+	db *gorm.DB
+}
+
+func (r *provideTestRepo) count(t *testing.T) int64 {
+	t.Helper()
+
+	var count int64
+	if err := r.db.Model(&txTestItem{}).Count(&count).Error; err != nil {
+		t.Fatalf("Failed to count items: %v", err)
+	}
+	return count
+}
+
+func doProvideTestRequest(t *testing.T, app *fiber.App, tenant string) int {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant-ID", tenant)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestProvideConstructsOncePerRequest(t *testing.T) {
+	store := tenanttest.NewStore(t, &txTestItem{})
+
+	constructed := 0
+	newRepo := func(db *gorm.DB) *provideTestRepo {
+		constructed++
+		return &provideTestRepo{db: db}
+	}
+
+	app := fiber.New()
+	app.Use(New(Config{Store: store, Resolver: HeaderResolver("X-Tenant-ID")}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		first := Provide(c, newRepo)
+		if second := MustProvide(c, newRepo); second != first {
+			t.Errorf("Expected the same repository within a request")
+		}
+		if first.db != GetTenantDB(c) {
+			t.Errorf("Expected the repository to get the tenant DB")
+		}
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if status := doProvideTestRequest(t, app, "tenant1"); status != fiber.StatusOK {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+	}
+
+	if constructed != 2 {
+		t.Fatalf("Expected 2 constructions for 2 requests, got %d", constructed)
+	}
+}
+
+func TestProvideInjectsTenantDB(t *testing.T) {
+	store := tenanttest.NewStore(t, &txTestItem{})
+
+	app := fiber.New()
+	app.Use(New(Config{Store: store, Resolver: HeaderResolver("X-Tenant-ID")}))
+
+	var counts []int64
+	app.Get("/", func(c *fiber.Ctx) error {
+		repo := Provide(c, func(db *gorm.DB) *provideTestRepo { return &provideTestRepo{db: db} })
+		if GetTenant(c) == "tenant1" {
+			if err := repo.db.Create(&txTestItem{Name: "item"}).Error; err != nil {
+				return err
+			}
+		}
+		counts = append(counts, repo.count(t))
+		return nil
+	})
+
+	for _, tenant := range []string{"tenant1", "tenant2"} {
+		if status := doProvideTestRequest(t, app, tenant); status != fiber.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", tenant, status)
+		}
+	}
+
+	if len(counts) != 2 || counts[0] != 1 || counts[1] != 0 {
+		t.Fatalf("Expected 1 item in tenant1 and none in tenant2, got %v", counts)
+	}
+}
+
+func TestProvideWithoutTenantDB(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		called := false
+		repo := Provide(c, func(db *gorm.DB) *provideTestRepo {
+			called = true
+			return &provideTestRepo{db: db}
+		})
+		if repo != nil || called {
+			t.Errorf("Expected no construction without a tenant DB")
+		}
+
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected MustProvide to panic without a tenant DB")
+			}
+		}()
+		MustProvide(c, func(db *gorm.DB) *provideTestRepo { return &provideTestRepo{db: db} })
+		return nil
+	})
+
+	if _, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+}
+
+func TestEagerProviders(t *testing.T) {
+	store := tenanttest.NewStore(t, &txTestItem{})
+
+	constructed := 0
+	newRepo := func(db *gorm.DB) *provideTestRepo {
+		constructed++
+		return &provideTestRepo{db: db}
+	}
+
+	for _, transactional := range []bool{false, true} {
+		constructed = 0
+
+		app := fiber.New()
+		app.Use(New(Config{
+			Store:                 store,
+			Resolver:              HeaderResolver("X-Tenant-ID"),
+			TransactionalRequests: transactional,
+			Providers:             []Provider{Eager(newRepo)},
+			OnTenantResolved: func(c *fiber.Ctx, tenant string) error {
+				if constructed != 1 {
+					t.Errorf("Expected providers to run before OnTenantResolved")
+				}
+				return nil
+			},
+		}))
+		app.Get("/", func(c *fiber.Ctx) error {
+			if repo := Provide(c, newRepo); repo.db != GetTenantDB(c) {
+				t.Errorf("Expected the eager repository to get the request's tenant DB")
+			}
+			return nil
+		})
+
+		if status := doProvideTestRequest(t, app, "tenant1"); status != fiber.StatusOK {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+		if constructed != 1 {
+			t.Fatalf("Expected 1 construction with transactional=%v, got %d", transactional, constructed)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type requestStateKey struct{}
+
+// requestState records what the middleware changed on a request beyond its
+// typed Locals keys, so Reset can undo it
+type requestState struct {
+	// keys are the configured string keys the tenant and DB were stored under
+	keys []interface{}
+
+	// userContext is the user context before the tenant was set on it
+	userContext context.Context
+}
+
+// Reset clears the tenant state the middleware stored on the request: the
+// tenant, its resolution and bearer claims, its DB and the string keys of
+// ContextKey and DBContextKey, values built by Provide, SQL capture,
+// MarkRollback, plan usage, the StrictTenantRoutes guard and the tenantctx
+// values on c.UserContext(). Handlers after Reset see no tenant.
+//
+// The middleware resets on its own when it runs again for the same request,
+// such as after c.RestartRouting() in a retry middleware, so a second
+// attempt never sees the tenant or DB of the first; call Reset when a
+// request must continue without a tenant.
+func Reset(c *fiber.Ctx) {
+	if state, ok := c.Locals(requestStateKey{}).(*requestState); ok {
+		for _, key := range state.keys {
+			c.Locals(key, nil)
+		}
+		if state.userContext != nil {
+			c.SetUserContext(state.userContext)
+		}
+		c.Locals(requestStateKey{}, nil)
+	}
+
+	c.Locals(TenantKey, nil)
+	c.Locals(resolutionKey{}, nil)
+	c.Locals(bearerClaimsKey{}, nil)
+	c.Locals(TenantDBKey, nil)
+	c.Locals(featuresKey{}, nil)
+	c.Locals(providedKey{}, nil)
+	c.Locals(sqlCaptureKey{}, nil)
+	c.Locals(rollbackKey{}, nil)
+	c.Locals(planUsageKey{}, nil)
+}
+
+// newRequestState returns the state shared by requests that do not change
+// the user context
+func (cfg *Config) newRequestState() *requestState {
+	state := &requestState{}
+	if cfg.ContextKey != "" {
+		state.keys = append(state.keys, cfg.ContextKey)
+	}
+	if cfg.DBContextKey != "" && cfg.DBContextKey != cfg.ContextKey {
+		state.keys = append(state.keys, cfg.DBContextKey)
+	}
+	return state
+}
+
+// enter resets the state a previous run of the middleware left on the
+// request and records state as the current one
+func enter(c *fiber.Ctx, state *requestState) {
+	if _, reentered := c.Locals(requestStateKey{}).(*requestState); reentered {
+		Reset(c)
+	}
+	c.Locals(requestStateKey{}, state)
+}
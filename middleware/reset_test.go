@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantctx"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+type resetTestRepo struct {
+	db *gorm.DB
+}
+
+// retryOnce runs the chain again with the tenant header set to next, the
+// way a retry middleware re-enters the tenant middleware
+func retryOnce(next string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Locals("retried") == true {
+			return c.Next()
+		}
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		c.Locals("retried", true)
+		if next == "" {
+			c.Request().Header.Del("X-Tenant-ID")
+		} else {
+			c.Request().Header.Set("X-Tenant-ID", next)
+		}
+		c.Response().Reset()
+		return c.RestartRouting()
+	}
+}
+
+func TestMiddlewareReentry(t *testing.T) {
+	for _, transactional := range []bool{false, true} {
+		store := tenanttest.NewStore(t, &streamTestItem{})
+		tenanttest.Seed(store, "tenant1", &streamTestItem{Name: "a"})
+		tenanttest.Seed(store, "tenant2", &streamTestItem{Name: "b"}, &streamTestItem{Name: "c"})
+
+		app := fiber.New()
+		app.Use(retryOnce("tenant2"))
+		app.Use(New(Config{
+			Store:                 store,
+			Resolver:              HeaderResolver("X-Tenant-ID"),
+			ContextKey:            "tenant_id",
+			TransactionalRequests: transactional,
+		}))
+
+		var attempts []string
+		var counts []int64
+		app.Get("/", func(c *fiber.Ctx) error {
+			rollback := c.Locals(rollbackKey{}) == true
+			capturing := CapturedSQL(c) != nil
+
+			repo := Provide(c, func(db *gorm.DB) *resetTestRepo { return &resetTestRepo{db: db} })
+			var count int64
+			if err := repo.db.Model(&streamTestItem{}).Count(&count).Error; err != nil {
+				return err
+			}
+			attempts = append(attempts, GetTenant(c)+"/"+c.Locals("tenant_id").(string))
+			counts = append(counts, count)
+
+			if len(attempts) == 2 && (rollback || capturing) {
+				t.Errorf("Expected no rollback mark or SQL capture from the first attempt, got %v and %v", rollback, capturing)
+			}
+
+			// State the second attempt must not inherit
+			CaptureSQL(c, true)
+			MarkRollback(c)
+			return c.SendString(GetTenant(c))
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Tenant-ID", "tenant1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+
+		if len(attempts) != 2 || attempts[0] != "tenant1/tenant1" || attempts[1] != "tenant2/tenant2" {
+			t.Fatalf("Expected attempts for tenant1 then tenant2, got %v", attempts)
+		}
+		if counts[0] != 1 || counts[1] != 2 {
+			t.Fatalf("Expected the second attempt to query tenant2's DB, got counts %v", counts)
+		}
+	}
+}
+
+func TestMiddlewareReentryFailingResolution(t *testing.T) {
+	store := tenanttest.NewStore(t)
+
+	var tenant string
+	var db *gorm.DB
+	app := fiber.New()
+	app.Use(retryOnce(""))
+	app.Use(New(Config{
+		Store:    store,
+		Resolver: HeaderResolver("X-Tenant-ID"),
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			tenant, db = GetTenant(c), GetTenantDB(c)
+			return DefaultErrorHandler(c, err)
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("Expected status 400 for the retry without a tenant, got %d", resp.StatusCode)
+	}
+	if tenant != "" || db != nil {
+		t.Fatalf("Expected no tenant left from the first attempt, got %q and %v", tenant, db)
+	}
+}
+
+func TestReset(t *testing.T) {
+	store := tenanttest.NewStore(t)
+	cfg := Config{
+		Store:        store,
+		Resolver:     HeaderResolver("X-Tenant-ID"),
+		ContextKey:   "tenant_id",
+		DBContextKey: "db",
+	}
+
+	app := fiber.New()
+	app.Use(New(cfg))
+	app.Get("/", func(c *fiber.Ctx) error {
+		Provide(c, func(db *gorm.DB) *resetTestRepo { return &resetTestRepo{db: db} })
+		Reset(c)
+
+		if GetTenant(c) != "" || GetTenantDB(c) != nil || cfg.Tenant(c) != "" || cfg.DB(c) != nil {
+			return errors.New("tenant state left after Reset")
+		}
+		if _, ok := tenantctx.Tenant(c.UserContext()); ok {
+			return errors.New("tenant left on the user context after Reset")
+		}
+		if repo := Provide(c, func(db *gorm.DB) *resetTestRepo { return &resetTestRepo{db: db} }); repo != nil {
+			return errors.New("provided value left after Reset")
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type resolutionKey struct{}
+
+type bearerClaimsKey struct{}
+
+// Resolution is a resolved tenant with attributes the resolver found next to
+// it, such as the user's role in the tenant, so later middleware need not
+// parse the request again
+type Resolution struct {
+	Tenant     string
+	Attributes map[string]interface{}
+}
+
+// Attribute returns an attribute of the resolution, or nil
+func (r Resolution) Attribute(name string) interface{} {
+	return r.Attributes[name]
+}
+
+// ResolverV2 is a resolver returning attributes alongside the tenant. Set it
+// as Config.ResolverV2, or turn it into a TenantResolver with Resolver to
+// use it in ChainResolvers.
+type ResolverV2 func(c *fiber.Ctx) (Resolution, error)
+
+// V2 adapts a TenantResolver to a ResolverV2. Resolutions of ResolverV2s
+// chained into it keep their attributes; other tenants have none.
+func (r TenantResolver) V2() ResolverV2 {
+	return func(c *fiber.Ctx) (Resolution, error) {
+		tenant, err := r(c)
+		if err != nil {
+			return Resolution{}, err
+		}
+		if resolution, ok := c.Locals(resolutionKey{}).(*Resolution); ok && resolution.Tenant == tenant {
+			return *resolution, nil
+		}
+		return Resolution{Tenant: tenant}, nil
+	}
+}
+
+// Resolver adapts a ResolverV2 to a TenantResolver, so it can be mixed with
+// other resolvers in ChainResolvers. Its resolution is kept on the request
+// and the middleware serves its attributes when the chain picks its tenant.
+//
+//	ChainResolvers(JWTResolver("tenant").Resolver(), HeaderResolver("X-Tenant-ID"))
+func (r ResolverV2) Resolver() TenantResolver {
+	return func(c *fiber.Ctx) (string, error) {
+		resolution, err := r(c)
+		if err != nil || resolution.Tenant == "" {
+			return "", err
+		}
+		c.Locals(resolutionKey{}, &resolution)
+		return resolution.Tenant, nil
+	}
+}
+
+// GetResolution returns the resolution of the current request: the tenant,
+// as GetTenant returns it after RewriteTenant, and the attributes of the
+// resolver. Without a tenant it returns an empty Resolution.
+func GetResolution(c *fiber.Ctx) Resolution {
+	if resolution, ok := c.Locals(resolutionKey{}).(*Resolution); ok {
+		return *resolution
+	}
+	return Resolution{}
+}
+
+var (
+	errNoBearerToken      = fiber.NewError(fiber.StatusUnauthorized, "Bearer token not found")
+	errInvalidBearerToken = fiber.NewError(fiber.StatusUnauthorized, "Invalid bearer token")
+	errNoTenantClaim      = fiber.NewError(fiber.StatusForbidden, "Token is not bound to a tenant")
+	errInvalidTokenTenant = fmt.Errorf("%w: %w", ErrTenantPresentInvalid, errInvalidBearerToken)
+)
+
+// JWTResolver resolves the tenant from a claim of the request's bearer token
+// and returns every claim as an attribute, e.g. the user's role:
+//
+//	role, _ := middleware.GetResolution(c).Attribute("role").(string)
+//
+// A request without a token or without the claim falls through in
+// ChainResolvers; an undecodable token stops the chain with 401. The token
+// is decoded once per request and shared with JWTClaimVerifier. Like the
+// verifier it does not validate the signature, so register your
+// authentication middleware first.
+func JWTResolver(claim string) ResolverV2 {
+	return func(c *fiber.Ctx) (Resolution, error) {
+		claims, err := bearerClaims(c)
+		if err != nil {
+			if err == errInvalidBearerToken {
+				return Resolution{}, errInvalidTokenTenant
+			}
+			return Resolution{}, err
+		}
+
+		tenant, ok := claims[claim].(string)
+		if !ok || tenant == "" {
+			return Resolution{}, errNoTenantClaim
+		}
+		return Resolution{Tenant: tenant, Attributes: claims}, nil
+	}
+}
+
+// bearerClaimsEntry holds the decoded claims of a request's bearer token
+type bearerClaimsEntry struct {
+	token  string
+	claims map[string]interface{}
+}
+
+// decodeClaims decodes a token's claims; tests count its calls
+var decodeClaims = decodeJWTClaims
+
+// bearerClaims returns the claims of the request's bearer token, decoding
+// it only the first time per request
+func bearerClaims(c *fiber.Ctx) (map[string]interface{}, error) {
+	auth := c.Get(fiber.HeaderAuthorization)
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return nil, errNoBearerToken
+	}
+	token := strings.TrimSpace(auth[7:])
+
+	if entry, ok := c.Locals(bearerClaimsKey{}).(*bearerClaimsEntry); ok && entry.token == token {
+		return entry.claims, nil
+	}
+	claims, err := decodeClaims(token)
+	if err != nil {
+		return nil, errInvalidBearerToken
+	}
+	c.Locals(bearerClaimsKey{}, &bearerClaimsEntry{token: strings.Clone(token), claims: claims})
+	return claims, nil
+}
+
+// ErrResolveTimeout is returned when the resolver takes longer than
+// Config.ResolveTimeout
+var ErrResolveTimeout = fiber.NewError(fiber.StatusServiceUnavailable, "Tenant resolution timed out")
+
+// timeResolver enforces ResolveTimeout around resolve and reports
+// resolutions slower than ResolveWarnThreshold. Fiber contexts must not be
+// used once the handler returns, so the resolver runs on the request's
+// goroutine and the deadline only cuts short resolvers honoring
+// c.UserContext(); slower results are still discarded.
+func (cfg *Config) timeResolver(resolve ResolverV2) ResolverV2 {
+	timeout, threshold := cfg.ResolveTimeout, cfg.ResolveWarnThreshold
+	if timeout <= 0 && threshold <= 0 {
+		return resolve
+	}
+	onSlow := cfg.OnSlowResolve
+	if onSlow == nil {
+		onSlow = func(c *fiber.Ctx, elapsed time.Duration) {
+			log.Printf("WARN slow tenant resolution on %s %s: %s", c.Method(), c.Path(), elapsed)
+		}
+	}
+
+	return func(c *fiber.Ctx) (Resolution, error) {
+		started := time.Now()
+		if timeout > 0 {
+			parent := c.UserContext()
+			ctx, cancel := context.WithTimeout(parent, timeout)
+			c.SetUserContext(ctx)
+			defer func() {
+				cancel()
+				c.SetUserContext(parent)
+			}()
+		}
+
+		resolution, err := resolve(c)
+		elapsed := time.Since(started)
+		if threshold > 0 && elapsed > threshold {
+			onSlow(c, elapsed)
+		}
+		if timeout > 0 && elapsed >= timeout {
+			return Resolution{}, ErrResolveTimeout
+		}
+		return resolution, err
+	}
+}
@@ -0,0 +1,251 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+// countDecodes counts the bearer tokens decoded until the test ends
+func countDecodes(t *testing.T) *int {
+	t.Helper()
+
+	var decodes int
+	decodeClaims = func(token string) (map[string]interface{}, error) {
+		decodes++
+		return decodeJWTClaims(token)
+	}
+	t.Cleanup(func() { decodeClaims = decodeJWTClaims })
+	return &decodes
+}
+
+func TestJWTResolverAttributesParsedOnce(t *testing.T) {
+	decodes := countDecodes(t)
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:              tenanttest.NewStore(t),
+		ResolverV2:         JWTResolver("tenant"),
+		VerifyTenantAccess: JWTClaimVerifier("tenant"),
+	}))
+	app.Get("/role", func(c *fiber.Ctx) error {
+		resolution := GetResolution(c)
+		role, _ := resolution.Attribute("role").(string)
+		return c.SendString(resolution.Tenant + ":" + role)
+	})
+
+	req := httptest.NewRequest("GET", "/role", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTestJWT(t, map[string]interface{}{"tenant": "acme", "role": "admin"}))
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != fiber.StatusOK || string(body) != "acme:admin" {
+		t.Fatalf("Expected acme:admin, got %d %q", resp.StatusCode, body)
+	}
+	if *decodes != 1 {
+		t.Fatalf("Expected the token decoded once, got %d", *decodes)
+	}
+
+	// A request without a token fails with 401
+	resp, err = app.Test(httptest.NewRequest("GET", "/role", nil))
+	if err != nil || resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("Expected 401 without a token, got %d (%v)", resp.StatusCode, err)
+	}
+}
+
+func TestChainResolversMixesResolverKinds(t *testing.T) {
+	decodes := countDecodes(t)
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store: tenanttest.NewStore(t),
+		Resolver: ChainResolvers(
+			JWTResolver("tenant").Resolver(),
+			HeaderResolver("X-Tenant-ID"),
+		),
+		VerifyTenantAccess: func(c *fiber.Ctx, tenant string) error {
+			if _, err := bearerClaims(c); errors.Is(err, errNoBearerToken) {
+				return nil
+			}
+			return JWTClaimVerifier("tenant")(c, tenant)
+		},
+	}))
+	app.Get("/role", func(c *fiber.Ctx) error {
+		resolution := GetResolution(c)
+		role, _ := resolution.Attribute("role").(string)
+		return c.SendString(resolution.Tenant + ":" + role)
+	})
+
+	tests := []struct {
+		name    string
+		token   string
+		header  string
+		want    string
+		decodes int
+	}{
+		{
+			name:    "Token",
+			token:   makeTestJWT(t, map[string]interface{}{"tenant": "acme", "role": "admin"}),
+			want:    "acme:admin",
+			decodes: 1,
+		},
+		{
+			name:   "Header without attributes",
+			header: "globex",
+			want:   "globex:",
+		},
+		{
+			name:    "Token without the claim falls through",
+			token:   makeTestJWT(t, map[string]interface{}{"role": "admin"}),
+			header:  "globex",
+			decodes: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*decodes = 0
+			req := httptest.NewRequest("GET", "/role", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.header != "" {
+				req.Header.Set("X-Tenant-ID", tt.header)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if tt.want == "" {
+				if resp.StatusCode != fiber.StatusForbidden {
+					t.Fatalf("Expected the verifier to reject the token, got %d %q", resp.StatusCode, body)
+				}
+			} else if resp.StatusCode != fiber.StatusOK || string(body) != tt.want {
+				t.Fatalf("Expected %q, got %d %q", tt.want, resp.StatusCode, body)
+			}
+			if *decodes != tt.decodes {
+				t.Fatalf("Expected %d decodes, got %d", tt.decodes, *decodes)
+			}
+		})
+	}
+}
+
+func TestResolverV2StopsChainOnInvalidToken(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Store: tenanttest.NewStore(t),
+		Resolver: ChainResolvers(
+			JWTResolver("tenant").Resolver(),
+			HeaderResolver("X-Tenant-ID"),
+		),
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	req.Header.Set("X-Tenant-ID", "globex")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("Expected 401 for an invalid token, got %d (%v)", resp.StatusCode, err)
+	}
+}
+
+func TestResolveTimeout(t *testing.T) {
+	var slow []time.Duration
+	app := fiber.New()
+	app.Use(New(Config{
+		Store: tenanttest.NewStore(t),
+		Resolver: func(c *fiber.Ctx) (string, error) {
+			if c.Get("X-Slow") == "" {
+				return "acme", nil
+			}
+			select {
+			case <-time.After(5 * time.Second):
+				return "acme", nil
+			case <-c.UserContext().Done():
+				return "", c.UserContext().Err()
+			}
+		},
+		ResolveTimeout:       50 * time.Millisecond,
+		ResolveWarnThreshold: 20 * time.Millisecond,
+		OnSlowResolve: func(c *fiber.Ctx, elapsed time.Duration) {
+			slow = append(slow, elapsed)
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		if _, ok := c.UserContext().Deadline(); ok {
+			return errors.New("handler sees the resolution deadline")
+		}
+		return c.SendString(GetTenant(c))
+	})
+
+	// A fast resolver is unaffected
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != fiber.StatusOK || string(body) != "acme" {
+		t.Fatalf("Expected acme, got %d %q", resp.StatusCode, body)
+	}
+	if len(slow) != 0 {
+		t.Fatalf("Expected no slow resolutions, got %v", slow)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Slow", "1")
+	started := time.Now()
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("Expected the request to fail fast, took %s", elapsed)
+	}
+	if resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d", resp.StatusCode)
+	}
+	var body ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Code != ErrorCodeTenantResolutionTimeout {
+		t.Fatalf("Expected %s, got %+v (%v)", ErrorCodeTenantResolutionTimeout, body, err)
+	}
+	if len(slow) != 1 || slow[0] < 50*time.Millisecond {
+		t.Fatalf("Expected the timed out resolution reported as slow, got %v", slow)
+	}
+}
+
+func TestResolveTimeoutWrapped(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Store: tenanttest.NewStore(t),
+		Resolver: func(c *fiber.Ctx) (string, error) {
+			return "", fmt.Errorf("tenant lookup service: %w", ErrResolveTimeout)
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d", resp.StatusCode)
+	}
+	var body ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Code != ErrorCodeTenantResolutionTimeout {
+		t.Fatalf("Expected %s, got %+v (%v)", ErrorCodeTenantResolutionTimeout, body, err)
+	}
+}
@@ -1,49 +1,185 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// TenantContextKey is the key used to store tenant information in fiber context
+// TenantContextKey is the legacy string key for tenant information in fiber
+// context.
+//
+// Deprecated: the middleware stores the tenant under TenantKey.
 const TenantContextKey = "tenant"
 
 // TenantResolver is a function that extracts tenant identifier from the request
 type TenantResolver func(c *fiber.Ctx) (string, error)
 
+// Resolution failures are allocated once and shared, so resolvers that miss
+// inside ChainResolvers cost nothing per request
+var (
+	errNoSubdomain        = fiber.NewError(fiber.StatusBadRequest, "No valid tenant subdomain found")
+	errSubdomainTooDeep   = fiber.NewError(fiber.StatusBadRequest, "Too many nested tenant subdomains")
+	errNoTenantHeader     = fiber.NewError(fiber.StatusBadRequest, "Tenant header not found")
+	errNoTenantQueryParam = fiber.NewError(fiber.StatusBadRequest, "Tenant query parameter not found")
+	errNoTenantInChain    = fiber.NewError(fiber.StatusBadRequest, "No tenant found using any resolver")
+	errInvalidTenantPath  = fiber.NewError(fiber.StatusBadRequest, "Invalid tenant path")
+	errNoTenantInPath     = fiber.NewError(fiber.StatusBadRequest, "No tenant found in path")
+	errInvalidTenant      = fiber.NewError(fiber.StatusBadRequest, "Invalid tenant")
+	errEmptyTenantHeader  = fmt.Errorf("%w: tenant header is empty", ErrTenantPresentInvalid)
+	errEmptyTenantQuery   = fmt.Errorf("%w: tenant query parameter is empty", ErrTenantPresentInvalid)
+)
+
+// ErrTenantPresentInvalid is returned by resolvers that found a tenant in
+// the request, such as a header that was sent, but whose value is unusable.
+// ChainResolvers stops at it instead of trying the next resolver, so a
+// client pinning its tenant in one place cannot fall through to another.
+var ErrTenantPresentInvalid = errors.New("tenant is present but invalid")
+
 // SubdomainResolver extracts tenant from subdomain (e.g., tenant1.example.com -> tenant1)
 func SubdomainResolver(c *fiber.Ctx) (string, error) {
 	host := c.Hostname()
 
 	// Remove port if present
-	if idx := strings.Index(host, ":"); idx != -1 {
+	if idx := strings.IndexByte(host, ':'); idx != -1 {
 		host = host[:idx]
 	}
 
-	parts := strings.Split(host, ".")
-
 	// Need at least 2 parts for a subdomain
 	// For localhost: tenant.localhost (2 parts is ok)
 	// For domains: tenant.example.com (3+ parts required)
-	if len(parts) >= 2 {
-		subdomain := parts[0]
+	dot := strings.IndexByte(host, '.')
+	if dot == -1 {
+		return "", errNoSubdomain
+	}
+
+	subdomain, rest := host[:dot], host[dot+1:]
+
+	// Filter out common non-tenant subdomains
+	if subdomain == "www" || subdomain == "api" || subdomain == "localhost" {
+		return "", errNoSubdomain
+	}
+
+	// For 2-part hosts, only accept if second part is "localhost"
+	if strings.IndexByte(rest, '.') == -1 && rest != "localhost" {
+		return "", errNoSubdomain
+	}
+
+	// Valid subdomain found
+	return subdomain, nil
+}
+
+// DefaultMaxSubdomainDepth is the number of nested labels
+// SubdomainResolverWithConfig accepts when NestedSeparator is set and
+// MaxDepth is not
+const DefaultMaxSubdomainDepth = 2
+
+// SubdomainConfig configures SubdomainResolverWithConfig
+type SubdomainConfig struct {
+	// Optional: Domain the tenant labels precede, e.g. "example.co.uk". By
+	// default the last two labels are the base domain, or "localhost".
+	BaseDomain string
+
+	// Optional: Joins nested labels into one tenant ID, so with "_" the host
+	// client1.agency.example.com resolves to agency_client1. Without it,
+	// hosts with more than one label before the base domain are rejected.
+	NestedSeparator string
+
+	// Optional: Join nested labels left to right (client1_agency) instead of
+	// right to left (agency_client1), which keeps sub-accounts next to their
+	// parent when sorted
+	NestedLeftToRight bool
+
+	// Optional: Most labels accepted before the base domain (defaults to
+	// DefaultMaxSubdomainDepth with a NestedSeparator, and 1 without)
+	MaxDepth int
+}
 
-		// Filter out common non-tenant subdomains
-		if subdomain == "www" || subdomain == "api" || subdomain == "localhost" {
-			return "", fiber.NewError(fiber.StatusBadRequest, "No valid tenant subdomain found")
+// SubdomainResolverWithConfig extracts the tenant from the labels before the
+// base domain. A single label is the tenant ID as with SubdomainResolver;
+// nested labels are joined with NestedSeparator. Hosts are lowercased,
+// since DNS names are case-insensitive, and labels containing the separator
+// are rejected so two hosts cannot resolve to the same tenant. The tenant
+// ID is then validated and mapped to a schema by the store like any other.
+func SubdomainResolverWithConfig(cfg SubdomainConfig) TenantResolver {
+	base := strings.ToLower(strings.Trim(cfg.BaseDomain, "."))
+
+	maxDepth := cfg.MaxDepth
+	if cfg.NestedSeparator == "" {
+		if maxDepth > 1 {
+			panic("SubdomainConfig.MaxDepth above 1 requires a NestedSeparator")
+		}
+		maxDepth = 1
+	} else if maxDepth <= 0 {
+		maxDepth = DefaultMaxSubdomainDepth
+	}
+
+	return func(c *fiber.Ctx) (string, error) {
+		host := c.Hostname()
+		if idx := strings.IndexByte(host, ':'); idx != -1 {
+			host = host[:idx]
+		}
+		host = strings.ToLower(host)
+
+		prefix, ok := subdomainPrefix(host, base)
+		if !ok {
+			return "", errNoSubdomain
+		}
+
+		labels := strings.Split(prefix, ".")
+		if len(labels) > maxDepth {
+			return "", errSubdomainTooDeep
+		}
+		for _, label := range labels {
+			if label == "" || (cfg.NestedSeparator != "" && strings.Contains(label, cfg.NestedSeparator)) {
+				return "", errNoSubdomain
+			}
 		}
 
-		// For 2-part hosts, only accept if second part is "localhost"
-		if len(parts) == 2 && parts[1] != "localhost" {
-			return "", fiber.NewError(fiber.StatusBadRequest, "No valid tenant subdomain found")
+		if len(labels) == 1 {
+			if labels[0] == "www" || labels[0] == "api" {
+				return "", errNoSubdomain
+			}
+			return labels[0], nil
 		}
 
-		// Valid subdomain found
-		return subdomain, nil
+		if !cfg.NestedLeftToRight {
+			for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+				labels[i], labels[j] = labels[j], labels[i]
+			}
+		}
+		return strings.Join(labels, cfg.NestedSeparator), nil
 	}
+}
 
-	return "", fiber.NewError(fiber.StatusBadRequest, "No valid tenant subdomain found")
+// subdomainPrefix returns the part of host before the base domain
+func subdomainPrefix(host, base string) (string, bool) {
+	if base == "" {
+		if strings.HasSuffix(host, ".localhost") {
+			base = "localhost"
+		} else {
+			// The base domain is the last two labels
+			last := strings.LastIndexByte(host, '.')
+			if last == -1 {
+				return "", false
+			}
+			secondLast := strings.LastIndexByte(host[:last], '.')
+			if secondLast == -1 {
+				return "", false
+			}
+			return host[:secondLast], true
+		}
+	}
+
+	if len(host) <= len(base)+1 || !strings.HasSuffix(host, base) || host[len(host)-len(base)-1] != '.' {
+		return "", false
+	}
+	return host[:len(host)-len(base)-1], true
 }
 
 // HeaderResolver extracts tenant from a custom header
@@ -51,22 +187,78 @@ func HeaderResolver(headerName string) TenantResolver {
 	return func(c *fiber.Ctx) (string, error) {
 		tenant := c.Get(headerName)
 		if tenant == "" {
-			return "", fiber.NewError(fiber.StatusBadRequest, "Tenant header not found")
+			return "", errNoTenantHeader
 		}
 		return tenant, nil
 	}
 }
 
-// PathPrefixResolver extracts tenant from URL path prefix (e.g., /tenant1/users -> tenant1)
+// StrictHeaderResolver extracts tenant from a custom header like
+// HeaderResolver, but returns ErrTenantPresentInvalid when the header is
+// sent empty, so ChainResolvers does not fall through to the next resolver
+func StrictHeaderResolver(headerName string) TenantResolver {
+	return func(c *fiber.Ctx) (string, error) {
+		tenant := c.Get(headerName)
+		if tenant != "" {
+			return tenant, nil
+		}
+		if len(c.Request().Header.PeekAll(headerName)) > 0 {
+			return "", errEmptyTenantHeader
+		}
+		return "", errNoTenantHeader
+	}
+}
+
+// MaxPathTenantLength is the longest tenant segment PathPrefixResolver accepts.
+// It matches PostgreSQL's 63-byte identifier limit.
+const MaxPathTenantLength = 63
+
+// PathPrefixResolver extracts tenant from URL path prefix (e.g., /tenant1/users -> tenant1).
+// The path is decoded, repeated slashes are collapsed and dot segments are
+// cleaned before the first segment is used. Segments containing encoded
+// slashes, dots-only values and traversal above the root are rejected.
 func PathPrefixResolver(c *fiber.Ctx) (string, error) {
-	path := c.Path()
-	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	var segments []string
 
-	if len(parts) > 0 && parts[0] != "" {
-		return parts[0], nil
+	for _, raw := range strings.Split(c.Path(), "/") {
+		if raw == "" {
+			continue
+		}
+
+		segment, err := url.PathUnescape(raw)
+		if err != nil {
+			return "", errInvalidTenantPath
+		}
+
+		// Encoded separators must not produce extra segments
+		if strings.ContainsAny(segment, "/\\") {
+			return "", errInvalidTenantPath
+		}
+
+		switch segment {
+		case ".":
+			continue
+		case "..":
+			if len(segments) == 0 {
+				return "", errInvalidTenantPath
+			}
+			segments = segments[:len(segments)-1]
+			continue
+		}
+
+		segments = append(segments, segment)
 	}
 
-	return "", fiber.NewError(fiber.StatusBadRequest, "No tenant found in path")
+	if len(segments) == 0 {
+		return "", errNoTenantInPath
+	}
+
+	tenant := segments[0]
+	if strings.Trim(tenant, ".") == "" || len(tenant) > MaxPathTenantLength {
+		return "", errInvalidTenantPath
+	}
+
+	return tenant, nil
 }
 
 // QueryParamResolver extracts tenant from query parameter
@@ -74,13 +266,35 @@ func QueryParamResolver(paramName string) TenantResolver {
 	return func(c *fiber.Ctx) (string, error) {
 		tenant := c.Query(paramName)
 		if tenant == "" {
-			return "", fiber.NewError(fiber.StatusBadRequest, "Tenant query parameter not found")
+			return "", errNoTenantQueryParam
 		}
 		return tenant, nil
 	}
 }
 
-// ChainResolvers tries multiple resolvers in order until one succeeds
+// StrictQueryParamResolver extracts tenant from a query parameter like
+// QueryParamResolver, but returns ErrTenantPresentInvalid when the parameter
+// is sent empty, as in ?tenant= or ?tenant
+func StrictQueryParamResolver(paramName string) TenantResolver {
+	return func(c *fiber.Ctx) (string, error) {
+		tenant := c.Query(paramName)
+		if tenant != "" {
+			return tenant, nil
+		}
+		if c.Context().QueryArgs().Has(paramName) {
+			return "", errEmptyTenantQuery
+		}
+		return "", errNoTenantQueryParam
+	}
+}
+
+// ChainResolvers tries resolvers in the order given and returns the tenant
+// of the first one that succeeds with a non-empty tenant; later resolvers
+// are not called. A resolver returning ErrTenantPresentInvalid stops the
+// chain with that error, so pair StrictHeaderResolver with a fallback to
+// keep an empty header from resolving to the fallback's tenant.
+//
+//	ChainResolvers(StrictHeaderResolver("X-Tenant-ID"), QueryParamResolver("tenant"))
 func ChainResolvers(resolvers ...TenantResolver) TenantResolver {
 	return func(c *fiber.Ctx) (string, error) {
 		for _, resolver := range resolvers {
@@ -88,8 +302,11 @@ func ChainResolvers(resolvers ...TenantResolver) TenantResolver {
 			if err == nil && tenant != "" {
 				return tenant, nil
 			}
+			if err != nil && errors.Is(err, ErrTenantPresentInvalid) {
+				return "", err
+			}
 		}
-		return "", fiber.NewError(fiber.StatusBadRequest, "No tenant found using any resolver")
+		return "", errNoTenantInChain
 	}
 }
 
@@ -97,3 +314,13 @@ func ChainResolvers(resolvers ...TenantResolver) TenantResolver {
 func CustomResolver(fn func(c *fiber.Ctx) (string, error)) TenantResolver {
 	return fn
 }
+
+// validateTenant rejects tenants that are empty, invalid UTF-8 or contain
+// control characters or "..", since tenants end up in file names and
+// storage paths
+func validateTenant(tenant string) error {
+	if tenant == "" || !utf8.ValidString(tenant) || strings.IndexFunc(tenant, unicode.IsControl) >= 0 || strings.Contains(tenant, "..") {
+		return errInvalidTenant
+	}
+	return nil
+}
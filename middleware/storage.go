@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrInvalidObjectName is returned for object names that are empty, absolute
+// or could escape the tenant prefix
+var ErrInvalidObjectName = errors.New("invalid object name")
+
+// ErrNoTenant is returned by TenantObjects when the request has no tenant
+var ErrNoTenant = errors.New("no tenant in request context")
+
+// ObjectStore is a key/value blob store such as local disk, S3 or GCS. Keys
+// are slash-separated and already scoped by TenantObjects.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// TenantObjects scopes an ObjectStore to one tenant. Every name is validated
+// and prefixed with the tenant, so handlers cannot reach other tenants' objects.
+type TenantObjects struct {
+	store  ObjectStore
+	tenant string
+}
+
+// TenantStorage returns store scoped to the resolved tenant. The accessor
+// copies the tenant and can outlive the request.
+func TenantStorage(c *fiber.Ctx, store ObjectStore) *TenantObjects {
+	return &TenantObjects{
+		store:  store,
+		tenant: strings.ToLower(strings.Clone(GetTenant(c))),
+	}
+}
+
+// Key returns the store key for name: the tenant, a slash and the name.
+// Names may contain slashes but no ".." or "." elements, backslashes, NUL
+// bytes or leading slashes.
+func (t *TenantObjects) Key(name string) (string, error) {
+	if t.tenant == "" {
+		return "", ErrNoTenant
+	}
+	if strings.ContainsAny(t.tenant, `/\`) {
+		return "", fmt.Errorf("%w: tenant %q", ErrInvalidObjectName, t.tenant)
+	}
+	if !validObjectName(name) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidObjectName, name)
+	}
+	return t.tenant + "/" + name, nil
+}
+
+// Put stores r under name
+func (t *TenantObjects) Put(ctx context.Context, name string, r io.Reader) error {
+	key, err := t.Key(name)
+	if err != nil {
+		return err
+	}
+	return t.store.Put(ctx, key, r)
+}
+
+// Get opens the object stored under name
+func (t *TenantObjects) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	key, err := t.Key(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.store.Get(ctx, key)
+}
+
+// Delete removes the object stored under name
+func (t *TenantObjects) Delete(ctx context.Context, name string) error {
+	key, err := t.Key(name)
+	if err != nil {
+		return err
+	}
+	return t.store.Delete(ctx, key)
+}
+
+// validObjectName reports whether name is a clean relative slash path
+func validObjectName(name string) bool {
+	if name == "" || strings.ContainsAny(name, "\\\x00") {
+		return false
+	}
+	if path.Clean(name) != name || strings.HasPrefix(name, "/") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." || part == "." {
+			return false
+		}
+	}
+	return true
+}
+
+// DiskStorage is an ObjectStore on the local file system
+type DiskStorage struct {
+	root string
+}
+
+// NewDiskStorage stores objects as files below root
+func NewDiskStorage(root string) *DiskStorage {
+	return &DiskStorage{root: root}
+}
+
+// Put writes r to the file for key, creating parent directories
+func (d *DiskStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	file, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Get opens the file for key
+func (d *DiskStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(file)
+}
+
+// Delete removes the file for key
+func (d *DiskStorage) Delete(ctx context.Context, key string) error {
+	file, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+// path maps key to a file below root, rejecting keys that would leave it
+func (d *DiskStorage) path(key string) (string, error) {
+	if !validObjectName(key) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidObjectName, key)
+	}
+	return filepath.Join(d.root, filepath.FromSlash(key)), nil
+}
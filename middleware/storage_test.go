@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+func TestTenantStorageConfinesWrites(t *testing.T) {
+	root := t.TempDir()
+	disk := NewDiskStorage(filepath.Join(root, "objects"))
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:    tenanttest.NewStore(t),
+		Resolver: HeaderResolver("X-Tenant-ID"),
+	}))
+	app.Post("/upload", func(c *fiber.Ctx) error {
+		err := TenantStorage(c, disk).Put(c.UserContext(), c.Query("name"), strings.NewReader("data"))
+		if errors.Is(err, ErrInvalidObjectName) {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid file name")
+		}
+		return err
+	})
+
+	upload := func(name string) int {
+		t.Helper()
+
+		req := httptest.NewRequest("POST", "/upload?name="+url.QueryEscape(name), nil)
+		req.Header.Set("X-Tenant-ID", "Acme")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := upload("reports/2024.pdf"); status != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if _, err := os.Stat(filepath.Join(root, "objects", "acme", "reports", "2024.pdf")); err != nil {
+		t.Fatalf("Expected file under the tenant prefix: %v", err)
+	}
+
+	hostile := []string{
+		"",
+		"..",
+		"../globex/evil",
+		"reports/../../globex/evil",
+		"/etc/passwd",
+		"./evil",
+		"reports//evil",
+		`..\globex\evil`,
+		"evil\x00.txt",
+		"reports/",
+	}
+	for _, name := range hostile {
+		if status := upload(name); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status 400 for %q, got %d", name, status)
+		}
+	}
+
+	// Nothing may exist outside the tenant's prefix
+	filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && !strings.HasPrefix(file, filepath.Join(root, "objects", "acme")+string(filepath.Separator)) {
+			t.Fatalf("Unexpected file outside the tenant prefix: %s", file)
+		}
+		return nil
+	})
+}
+
+func TestTenantObjectsRoundTrip(t *testing.T) {
+	disk := NewDiskStorage(t.TempDir())
+	objects := &TenantObjects{store: disk, tenant: "acme"}
+	ctx := context.Background()
+
+	if key, _ := objects.Key("a/b.txt"); key != "acme/a/b.txt" {
+		t.Fatalf("Expected key acme/a/b.txt, got %s", key)
+	}
+
+	if err := objects.Put(ctx, "a/b.txt", strings.NewReader("hello")); err != nil {
+		t.Fatalf("Failed to put object: %v", err)
+	}
+
+	r, err := objects.Get(ctx, "a/b.txt")
+	if err != nil {
+		t.Fatalf("Failed to get object: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "hello" {
+		t.Fatalf("Expected hello, got %q", data)
+	}
+
+	if err := objects.Delete(ctx, "a/b.txt"); err != nil {
+		t.Fatalf("Failed to delete object: %v", err)
+	}
+
+	noTenant := &TenantObjects{store: disk}
+	if _, err := noTenant.Key("a.txt"); !errors.Is(err, ErrNoTenant) {
+		t.Fatalf("Expected ErrNoTenant, got %v", err)
+	}
+}
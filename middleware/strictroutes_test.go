@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+var _ TenantRouteGuard = (*tenantstore.TenantStore)(nil)
+
+type guardKey struct{}
+
+// guardStore marks request contexts with the tenant and fail flag
+type guardStore struct {
+	TenantStore
+}
+
+func (s guardStore) GuardTenantRoute(ctx context.Context, tenant string, fail bool) context.Context {
+	mark := tenant + ":warn"
+	if fail {
+		mark = tenant + ":fail"
+	}
+	return context.WithValue(ctx, guardKey{}, mark)
+}
+
+func TestStrictTenantRoutes(t *testing.T) {
+	app := fiber.New()
+	app.Get("/public", func(c *fiber.Ctx) error {
+		mark, _ := c.UserContext().Value(guardKey{}).(string)
+		return c.SendString(mark)
+	})
+	app.Use(New(Config{
+		Store:                  guardStore{tenanttest.NewStore(t)},
+		Resolver:               HeaderResolver("X-Tenant-ID"),
+		StrictTenantRoutes:     true,
+		StrictTenantRoutesFail: true,
+	}))
+	app.Get("/tenant", func(c *fiber.Ctx) error {
+		mark, _ := c.UserContext().Value(guardKey{}).(string)
+		return c.SendString(mark)
+	})
+
+	for path, want := range map[string]string{"/tenant": "tenant1:fail", "/public": ""} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Tenant-ID", "tenant1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		if body, _ := io.ReadAll(resp.Body); string(body) != want {
+			t.Fatalf("Expected %s to see mark %q, got %q", path, want, body)
+		}
+	}
+}
+
+func TestStrictTenantRoutesRequiresGuard(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected panic when the store cannot guard tenant routes")
+		}
+	}()
+
+	New(Config{
+		Store:              tenanttest.NewStore(t),
+		StrictTenantRoutes: true,
+	})
+}
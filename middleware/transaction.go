@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantctx"
+)
+
+// rollbackKey marks a transactional request for rollback
+type rollbackKey struct{}
+
+// MarkRollback makes the middleware roll back the request transaction even
+// when the handler succeeds. It has no effect unless TransactionalRequests is set.
+func MarkRollback(c *fiber.Ctx) {
+	c.Locals(rollbackKey{}, true)
+}
+
+// runInTransaction begins a transaction on the tenant DB, pins the tenant's
+// search_path for its lifetime and exposes it as the request DB. The
+// transaction is committed after the handler chain succeeds and rolled back on
+// errors, error statuses, MarkRollback or panics.
+func runInTransaction(c *fiber.Ctx, cfg Config, tenant string, tenantDB *gorm.DB) (err error) {
+	tx := tenantDB.WithContext(c.UserContext()).Begin()
+	if tx.Error != nil {
+		return cfg.ErrorHandler(c, newError(ErrorCodeTenantDBUnavailable, fiber.StatusServiceUnavailable, tx.Error))
+	}
+
+	// SET LOCAL only lasts until the transaction ends, so pooled connections
+	// never keep another tenant's search_path
+	if tx.Dialector.Name() == "postgres" {
+		schema, err := schemaFor(cfg.Store, tenant)
+		if err != nil {
+			tx.Rollback()
+			return cfg.ErrorHandler(c, newError(ErrorCodeTenantResolutionFailed, fiber.StatusBadRequest, err))
+		}
+
+		path := []string{schema, "public"}
+		if pather, ok := cfg.Store.(SearchPather); ok {
+			if path, err = pather.SearchPath(schema); err != nil {
+				tx.Rollback()
+				return cfg.ErrorHandler(c, newError(ErrorCodeTenantResolutionFailed, fiber.StatusBadRequest, err))
+			}
+		}
+
+		quoted := make([]string, len(path))
+		for i, name := range path {
+			quoted[i] = quoteIdentifier(name)
+		}
+		pin := "SET LOCAL search_path TO " + strings.Join(quoted, ", ")
+		if err := tx.Exec(pin).Error; err != nil {
+			tx.Rollback()
+			return cfg.ErrorHandler(c, newError(ErrorCodeTenantDBUnavailable, fiber.StatusServiceUnavailable, err))
+		}
+	}
+
+	db := scopePreparedStatements(tx, tenant)
+	cfg.setTenantDB(c, db)
+	c.SetUserContext(tenantctx.WithDB(c.UserContext(), tenant, db))
+	cfg.provide(c)
+
+	// Roll back if a handler panics, then let the panic continue
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if cfg.OnTenantResolved != nil {
+		if err := cfg.OnTenantResolved(c, tenant); err != nil {
+			tx.Rollback()
+			return cfg.ErrorHandler(c, newError(ErrorCodeTenantResolutionFailed, fiber.StatusBadRequest, err))
+		}
+	}
+
+	if err := c.Next(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if c.Response().StatusCode() >= fiber.StatusBadRequest || c.Locals(rollbackKey{}) == true {
+		return tx.Rollback().Error
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return cfg.ErrorHandler(c, newError(ErrorCodeTenantDBUnavailable, fiber.StatusServiceUnavailable, err))
+	}
+
+	return nil
+}
+
+// scopePreparedStatements keys the prepared statements of a transaction on a
+// shared pool by tenant. GORM caches prepared statements by SQL text across
+// every connection of the pool, so without a per-tenant key a statement
+// prepared under one tenant's search_path would be reused under another's.
+// Transactions without PrepareStmt are returned unchanged.
+func scopePreparedStatements(tx *gorm.DB, tenant string) *gorm.DB {
+	pool, ok := tx.Statement.ConnPool.(*gorm.PreparedStmtTX)
+	if !ok {
+		return tx
+	}
+
+	// WithContext clones the statement, so the transaction itself still
+	// commits through the original connection pool
+	scoped := tx.WithContext(tx.Statement.Context)
+	scoped.Statement.ConnPool = &tenantConnPool{
+		PreparedStmtTX: pool,
+		prefix:         preparedStatementPrefix(tenant),
+	}
+	return scoped
+}
+
+// preparedStatementPrefix returns the comment keying a tenant's prepared
+// statements. It holds a hash of the tenant instead of its name, so no
+// tenant ID can close the comment and inject SQL.
+func preparedStatementPrefix(tenant string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(tenant)))
+	return "/* tenant " + hex.EncodeToString(sum[:8]) + " */ "
+}
+
+// tenantConnPool prefixes every statement with the tenant so the prepared
+// statement cache keys it per tenant
+type tenantConnPool struct {
+	*gorm.PreparedStmtTX
+	prefix string
+}
+
+func (p *tenantConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.PreparedStmtTX.PrepareContext(ctx, p.prefix+query)
+}
+
+func (p *tenantConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.PreparedStmtTX.ExecContext(ctx, p.prefix+query, args...)
+}
+
+func (p *tenantConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.PreparedStmtTX.QueryContext(ctx, p.prefix+query, args...)
+}
+
+func (p *tenantConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.PreparedStmtTX.QueryRowContext(ctx, p.prefix+query, args...)
+}
+
+// quoteIdentifier quotes a PostgreSQL identifier
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,281 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+// TransactionalRequests pins the store's custom search_path
+var _ SearchPather = (*tenantstore.TenantStore)(nil)
+
+type txTestItem struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+// newTxTestApp mounts the middleware in transactional mode on an in-memory
+// SQLite database and returns the database for assertions
+func newTxTestApp(t *testing.T) (*fiber.App, *gorm.DB) {
+	t.Helper()
+
+	store := tenanttest.NewStore(t, &txTestItem{})
+
+	db, err := store.GetTenantDB(context.Background(), "tenant1")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(recover.New())
+	app.Use(New(Config{
+		Store:                 store,
+		Resolver:              HeaderResolver("X-Tenant-ID"),
+		TransactionalRequests: true,
+	}))
+
+	return app, db
+}
+
+func countTxTestItems(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Model(&txTestItem{}).Count(&count).Error; err != nil {
+		t.Fatalf("Failed to count items: %v", err)
+	}
+	return count
+}
+
+func doTxTestRequest(t *testing.T, app *fiber.App, path string) int {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", path, nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestTransactionalRequestsCommit(t *testing.T) {
+	app, db := newTxTestApp(t)
+
+	app.Post("/items", func(c *fiber.Ctx) error {
+		return GetTenantDB(c).Create(&txTestItem{Name: "committed"}).Error
+	})
+
+	if status := doTxTestRequest(t, app, "/items"); status != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	if count := countTxTestItems(t, db); count != 1 {
+		t.Fatalf("Expected 1 committed item, got %d", count)
+	}
+}
+
+func TestTransactionalRequestsRollback(t *testing.T) {
+	app, db := newTxTestApp(t)
+
+	app.Post("/error", func(c *fiber.Ctx) error {
+		GetTenantDB(c).Create(&txTestItem{Name: "error"})
+		return errors.New("handler failed")
+	})
+
+	app.Post("/status", func(c *fiber.Ctx) error {
+		GetTenantDB(c).Create(&txTestItem{Name: "status"})
+		return c.SendStatus(fiber.StatusUnprocessableEntity)
+	})
+
+	app.Post("/marked", func(c *fiber.Ctx) error {
+		GetTenantDB(c).Create(&txTestItem{Name: "marked"})
+		MarkRollback(c)
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	app.Post("/panic", func(c *fiber.Ctx) error {
+		GetTenantDB(c).Create(&txTestItem{Name: "panic"})
+		panic("handler panicked")
+	})
+
+	for _, path := range []string{"/error", "/status", "/marked", "/panic"} {
+		doTxTestRequest(t, app, path)
+
+		if count := countTxTestItems(t, db); count != 0 {
+			t.Fatalf("Expected %s to roll back, found %d items", path, count)
+		}
+	}
+}
+
+func TestTransactionalRequestsIgnoreStringRollbackKey(t *testing.T) {
+	app, db := newTxTestApp(t)
+
+	// Other middleware's string keys cannot mark the request for rollback
+	app.Post("/string", func(c *fiber.Ctx) error {
+		c.Locals("tenant_tx_rollback", true)
+		return GetTenantDB(c).Create(&txTestItem{Name: "string"}).Error
+	})
+
+	if status := doTxTestRequest(t, app, "/string"); status != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if count := countTxTestItems(t, db); count != 1 {
+		t.Fatalf("Expected 1 committed item, got %d", count)
+	}
+}
+
+func TestTransactionalRequestsNestedTransaction(t *testing.T) {
+	app, db := newTxTestApp(t)
+
+	app.Post("/nested", func(c *fiber.Ctx) error {
+		tx := GetTenantDB(c)
+
+		// The nested transaction becomes a savepoint and rolls back alone
+		tx.Transaction(func(nested *gorm.DB) error {
+			nested.Create(&txTestItem{Name: "nested"})
+			return errors.New("nested failed")
+		})
+
+		return tx.Create(&txTestItem{Name: "outer"}).Error
+	})
+
+	if status := doTxTestRequest(t, app, "/nested"); status != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var items []txTestItem
+	db.Find(&items)
+	if len(items) != 1 || items[0].Name != "outer" {
+		t.Fatalf("Expected only the outer item to be committed, got %+v", items)
+	}
+}
+
+// sharedPoolStore serves every tenant from one connection pool, relying on
+// TransactionalRequests to pin the search_path
+type sharedPoolStore struct {
+	db *gorm.DB
+}
+
+func (s sharedPoolStore) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	return s.db, nil
+}
+
+func (s sharedPoolStore) GetMasterDB() *gorm.DB {
+	return s.db
+}
+
+func TestTransactionalRequestsKeyPreparedStatementsByTenant(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:shared_pool?mode=memory&cache=shared"), &gorm.Config{PrepareStmt: true})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&txTestItem{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:                 sharedPoolStore{db: db},
+		Resolver:              HeaderResolver("X-Tenant-ID"),
+		TransactionalRequests: true,
+	}))
+	app.Post("/items", func(c *fiber.Ctx) error {
+		return GetTenantDB(c).Create(&txTestItem{Name: GetTenant(c)}).Error
+	})
+
+	for _, tenant := range []string{"tenant1", "tenant2"} {
+		req := httptest.NewRequest("POST", "/items", nil)
+		req.Header.Set("X-Tenant-ID", tenant)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", tenant, resp.StatusCode)
+		}
+	}
+
+	if count := countTxTestItems(t, db); count != 2 {
+		t.Fatalf("Expected 2 committed items, got %d", count)
+	}
+
+	prepared := db.ConnPool.(*gorm.PreparedStmtDB)
+	keys := map[string]bool{}
+	for query := range prepared.Stmts {
+		switch {
+		case strings.HasPrefix(query, preparedStatementPrefix("tenant1")+"INSERT"):
+			keys["tenant1"] = true
+		case strings.HasPrefix(query, preparedStatementPrefix("tenant2")+"INSERT"):
+			keys["tenant2"] = true
+		case strings.Contains(query, "INSERT"):
+			t.Fatalf("Expected INSERT to be keyed by tenant, got %q", query)
+		}
+	}
+	if !keys["tenant1"] || !keys["tenant2"] {
+		t.Fatalf("Expected a prepared INSERT per tenant, got %v", prepared.PreparedSQL)
+	}
+}
+
+func TestTransactionalRequestsKeepTenantOutOfSQL(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:shared_pool_injection?mode=memory&cache=shared"), &gorm.Config{PrepareStmt: true})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&txTestItem{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Store:                 sharedPoolStore{db: db},
+		Resolver:              HeaderResolver("X-Tenant-ID"),
+		TransactionalRequests: true,
+	}))
+	app.Post("/items", func(c *fiber.Ctx) error {
+		return GetTenantDB(c).Create(&txTestItem{Name: GetTenant(c)}).Error
+	})
+
+	// Removing */ once would leave x*/, closing the comment
+	tenant := "x**//;DROP TABLE tx_test_items; --"
+	req := httptest.NewRequest("POST", "/items", nil)
+	req.Header.Set("X-Tenant-ID", tenant)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if count := countTxTestItems(t, db); count != 1 {
+		t.Fatalf("Expected the item committed, got %d", count)
+	}
+
+	for query := range db.ConnPool.(*gorm.PreparedStmtDB).Stmts {
+		if strings.Contains(query, "DROP") || strings.Count(query, "*/") > 1 {
+			t.Fatalf("Expected the tenant kept out of the SQL, got %q", query)
+		}
+	}
+}
+
+func TestScopePreparedStatementsWithoutPrepareStmt(t *testing.T) {
+	store := tenanttest.NewStore(t, &txTestItem{})
+	db, _ := store.GetTenantDB(context.Background(), "tenant1")
+
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	if scoped := scopePreparedStatements(tx, "tenant1"); scoped != tx {
+		t.Fatal("Expected transaction without PrepareStmt to be returned unchanged")
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TenantVerifier is a function that decides whether the current request may
+// access the resolved tenant. Returning an error aborts the request before
+// the tenant database is attached.
+type TenantVerifier func(c *fiber.Ctx, tenant string) error
+
+// JWTClaimVerifier compares the resolved tenant against a claim in the
+// request's bearer token and rejects mismatches with 403 Forbidden.
+//
+// The verifier only decodes the token payload; it does not validate the
+// signature. Register your authentication middleware before the tenant
+// middleware so that only verified tokens reach this check. A token
+// JWTResolver already decoded is not decoded again.
+func JWTClaimVerifier(claim string) TenantVerifier {
+	return func(c *fiber.Ctx, tenant string) error {
+		claims, err := bearerClaims(c)
+		if err != nil {
+			return err
+		}
+
+		bound, ok := claims[claim].(string)
+		if !ok || bound == "" {
+			return errNoTenantClaim
+		}
+
+		if bound != tenant {
+			return fiber.NewError(fiber.StatusForbidden, "Token is not valid for this tenant")
+		}
+
+		return nil
+	}
+}
+
+// decodeJWTClaims extracts the claims set from a compact JWT without verifying it
+func decodeJWTClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+// makeTestJWT builds an unsigned compact JWT carrying the given claims
+func makeTestJWT(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Failed to marshal claims: %v", err)
+	}
+
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+}
+
+func TestJWTClaimVerifierBlocksQueryParamTenantSwitch(t *testing.T) {
+	mockStore := tenanttest.NewStore(t)
+
+	app := fiber.New()
+
+	app.Use(New(Config{
+		Store: mockStore,
+		Resolver: ChainResolvers(
+			HeaderResolver("X-Tenant-ID"),
+			QueryParamResolver("tenant"),
+		),
+		VerifyTenantAccess: JWTClaimVerifier("tenant"),
+	}))
+
+	app.Get("/data", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+
+	token := makeTestJWT(t, map[string]interface{}{"sub": "user1", "tenant": "tenant1"})
+
+	tests := []struct {
+		name       string
+		url        string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "Own tenant",
+			url:        "/data?tenant=tenant1",
+			token:      token,
+			wantStatus: fiber.StatusOK,
+		},
+		{
+			name:       "Other tenant via query param",
+			url:        "/data?tenant=othertenant",
+			token:      token,
+			wantStatus: fiber.StatusForbidden,
+		},
+		{
+			name:       "Token without tenant claim",
+			url:        "/data?tenant=tenant1",
+			token:      makeTestJWT(t, map[string]interface{}{"sub": "user1"}),
+			wantStatus: fiber.StatusForbidden,
+		},
+		{
+			name:       "Missing token",
+			url:        "/data?tenant=tenant1",
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "Malformed token",
+			url:        "/data?tenant=tenant1",
+			token:      "not-a-jwt",
+			wantStatus: fiber.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestVerifyTenantAccessRunsBeforeStore(t *testing.T) {
+	store := &countingTenantStore{Store: tenanttest.NewStore(t)}
+
+	app := fiber.New()
+
+	app.Use(New(Config{
+		Store:    store,
+		Resolver: QueryParamResolver("tenant"),
+		VerifyTenantAccess: func(c *fiber.Ctx, tenant string) error {
+			return fiber.NewError(fiber.StatusForbidden, "denied")
+		},
+	}))
+
+	app.Get("/data", func(c *fiber.Ctx) error {
+		return c.SendString(GetTenant(c))
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/data?tenant=tenant1", nil))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d", resp.StatusCode)
+	}
+
+	if store.calls != 0 {
+		t.Fatalf("Expected store not to be called, got %d calls", store.calls)
+	}
+}
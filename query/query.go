@@ -0,0 +1,343 @@
+// Package query standardizes list endpoints on tenant databases: page or
+// cursor pagination, bounded page sizes and sorting against an allowlist of
+// columns.
+//
+//	app.Get("/users", func(c *fiber.Ctx) error {
+//		var users []User
+//		page, err := query.Paginate(c, middleware.GetTenantDB(c), &users,
+//			query.Sortable("name", "created_at"),
+//			query.DefaultSort("-created_at"))
+//		if err != nil {
+//			return err
+//		}
+//		return c.JSON(page)
+//	})
+//
+// Requests choose ?page=2&per_page=50&sort=name,-created_at, or with
+// WithCursor ?cursor=<next_cursor of the previous page>.
+package query
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Page size bounds used unless PerPage overrides them
+const (
+	DefaultPerPage    = 20
+	DefaultMaxPerPage = 100
+)
+
+// Page is a page of results, marshaled the same way by every list endpoint
+type Page struct {
+	// Items is the slice passed to Paginate, never null in JSON
+	Items interface{} `json:"items"`
+
+	// Total counts the matching rows across all pages
+	Total int64 `json:"total"`
+
+	// Page is the 1-based page number, or 0 with cursor pagination
+	Page    int `json:"page,omitempty"`
+	PerPage int `json:"per_page"`
+
+	// NextCursor fetches the following page with cursor pagination, and is
+	// empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Option configures Paginate
+type Option func(*options)
+
+type options struct {
+	sortable    []string
+	defaultSort string
+	perPage     int
+	maxPerPage  int
+	cursor      bool
+	key         string
+}
+
+// Sortable lists the columns or field names clients may sort by. Sorting by
+// anything else is rejected with 400.
+func Sortable(columns ...string) Option {
+	return func(o *options) {
+		o.sortable = append(o.sortable, columns...)
+	}
+}
+
+// DefaultSort is used when the request has no sort, in the same syntax:
+// comma-separated columns, descending with a leading "-". It does not need
+// to be Sortable.
+func DefaultSort(sort string) Option {
+	return func(o *options) {
+		o.defaultSort = sort
+	}
+}
+
+// PerPage sets the default page size and the largest one clients may ask
+// for; larger per_page values are capped at max
+func PerPage(perPage, max int) Option {
+	return func(o *options) {
+		o.perPage = perPage
+		o.maxPerPage = max
+	}
+}
+
+// WithCursor switches to cursor pagination: pages are fetched with the
+// cursor query param set to the previous page's NextCursor instead of page
+// numbers, so rows inserted or deleted meanwhile do not shift later pages.
+func WithCursor() Option {
+	return func(o *options) {
+		o.cursor = true
+	}
+}
+
+// Key sets the unique column appended to every sort so the order is total
+// (defaults to the primary key)
+func Key(column string) Option {
+	return func(o *options) {
+		o.key = column
+	}
+}
+
+// sortField is a resolved sort column
+type sortField struct {
+	field *schema.Field
+	desc  bool
+}
+
+// cursor is the decoded cursor param: the sort it was issued for and the
+// sort values of the last row of the previous page
+type cursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// Paginate loads a page of db's rows into out, a pointer to a slice of
+// models, as chosen by the request's page, per_page, sort and cursor query
+// params. db may carry conditions, such as a tenant DB with filters applied.
+// Invalid params fail with a 400 fiber.Error.
+func Paginate(c *fiber.Ctx, db *gorm.DB, out interface{}, opts ...Option) (Page, error) {
+	o := options{perPage: DefaultPerPage, maxPerPage: DefaultMaxPerPage}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	slice := reflect.ValueOf(out)
+	if slice.Kind() != reflect.Pointer || slice.Elem().Kind() != reflect.Slice {
+		return Page{}, fmt.Errorf("paginate expects a pointer to a slice, got %T", out)
+	}
+	slice = slice.Elem()
+
+	page := Page{PerPage: o.perPage}
+	if v := c.Query("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return Page{}, fiber.NewError(fiber.StatusBadRequest, "per_page must be a positive integer")
+		}
+		page.PerPage = min(n, o.maxPerPage)
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(out); err != nil {
+		return Page{}, fmt.Errorf("failed to parse %T: %w", out, err)
+	}
+
+	sortSpec := c.Query("sort")
+	if sortSpec == "" {
+		sortSpec = o.defaultSort
+	}
+	fields, sortSpec, err := parseSort(stmt.Schema, sortSpec, c.Query("sort") != "", o)
+	if err != nil {
+		return Page{}, err
+	}
+
+	base := db.Session(&gorm.Session{})
+	if err := base.Model(out).Count(&page.Total).Error; err != nil {
+		return Page{}, fmt.Errorf("failed to count rows: %w", err)
+	}
+
+	find := base
+	for _, f := range fields {
+		find = find.Order(clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: f.field.DBName},
+			Desc:   f.desc,
+		})
+	}
+
+	if !o.cursor {
+		page.Page = 1
+		if v := c.Query("page"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return Page{}, fiber.NewError(fiber.StatusBadRequest, "page must be a positive integer")
+			}
+			page.Page = n
+		}
+
+		err := find.Limit(page.PerPage).Offset((page.Page - 1) * page.PerPage).Find(out).Error
+		if err != nil {
+			return Page{}, fmt.Errorf("failed to load page: %w", err)
+		}
+		page.Items = items(slice)
+		return page, nil
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		after, err := decodeCursor(v, sortSpec, fields)
+		if err != nil {
+			return Page{}, err
+		}
+		find = find.Where(after)
+	}
+
+	// One extra row tells whether there is a next page
+	if err := find.Limit(page.PerPage + 1).Find(out).Error; err != nil {
+		return Page{}, fmt.Errorf("failed to load page: %w", err)
+	}
+	if slice.Len() > page.PerPage {
+		slice.Set(slice.Slice(0, page.PerPage))
+		next, err := encodeCursor(c.UserContext(), sortSpec, fields, slice.Index(page.PerPage-1))
+		if err != nil {
+			return Page{}, err
+		}
+		page.NextCursor = next
+	}
+	page.Items = items(slice)
+	return page, nil
+}
+
+// parseSort resolves the sort spec against the model and, for requested
+// sorts, the allowlist, appending the key column. It returns the canonical
+// spec cursors are issued for.
+func parseSort(s *schema.Schema, spec string, requested bool, o options) ([]sortField, string, error) {
+	allowed := make(map[string]bool, len(o.sortable))
+	for _, column := range o.sortable {
+		if field := s.LookUpField(column); field != nil {
+			allowed[field.DBName] = true
+		}
+	}
+
+	var fields []sortField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		desc := strings.HasPrefix(part, "-")
+		name := strings.TrimPrefix(part, "-")
+		field := s.LookUpField(name)
+		if field == nil || field.DBName == "" || (requested && !allowed[field.DBName]) {
+			return nil, "", fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("cannot sort by %q", name))
+		}
+		if !seen[field.DBName] {
+			seen[field.DBName] = true
+			fields = append(fields, sortField{field: field, desc: desc})
+		}
+	}
+
+	key := s.PrioritizedPrimaryField
+	if o.key != "" {
+		key = s.LookUpField(o.key)
+	}
+	if key == nil {
+		return nil, "", fmt.Errorf("%s has no primary key; set query.Key", s.Name)
+	}
+	if !seen[key.DBName] {
+		fields = append(fields, sortField{field: key})
+	}
+
+	canonical := make([]string, len(fields))
+	for i, f := range fields {
+		canonical[i] = f.field.DBName
+		if f.desc {
+			canonical[i] = "-" + canonical[i]
+		}
+	}
+	return fields, strings.Join(canonical, ","), nil
+}
+
+// decodeCursor returns the condition selecting rows after the cursor in
+// the sort order: (a > x) OR (a = x AND b > y) OR ...
+func decodeCursor(v, sortSpec string, fields []sortField) (clause.Expression, error) {
+	errInvalid := fiber.NewError(fiber.StatusBadRequest, "invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, errInvalid
+	}
+	var cur cursor
+	if err := json.Unmarshal(raw, &cur); err != nil || len(cur.Values) != len(fields) {
+		return nil, errInvalid
+	}
+	if cur.Sort != sortSpec {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "cursor was issued for another sort")
+	}
+
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		value := reflect.New(f.field.FieldType)
+		if err := json.Unmarshal(cur.Values[i], value.Interface()); err != nil {
+			return nil, errInvalid
+		}
+		values[i] = value.Elem().Interface()
+	}
+
+	ors := make([]clause.Expression, len(fields))
+	for i, f := range fields {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: column(fields[j]), Value: values[j]})
+		}
+		if f.desc {
+			ands = append(ands, clause.Lt{Column: column(f), Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: column(f), Value: values[i]})
+		}
+		ors[i] = clause.And(ands...)
+	}
+	return clause.Or(ors...), nil
+}
+
+// encodeCursor returns the cursor for the rows after row
+func encodeCursor(ctx context.Context, sortSpec string, fields []sortField, row reflect.Value) (string, error) {
+	cur := cursor{Sort: sortSpec, Values: make([]json.RawMessage, len(fields))}
+	for i, f := range fields {
+		value, _ := f.field.ValueOf(ctx, reflect.Indirect(row))
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode cursor: %w", err)
+		}
+		cur.Values[i] = raw
+	}
+
+	raw, err := json.Marshal(cur)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func column(f sortField) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: f.field.DBName}
+}
+
+// items returns the slice, empty instead of nil so it marshals as []
+func items(slice reflect.Value) interface{} {
+	if slice.IsNil() {
+		slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+	}
+	return slice.Interface()
+}
@@ -0,0 +1,229 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type item struct {
+	ID    uint   `gorm:"primaryKey" json:"id"`
+	Name  string `json:"name"`
+	Group int    `json:"group"`
+}
+
+type itemPage struct {
+	Items      []item `json:"items"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page"`
+	PerPage    int    `json:"per_page"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// newTestApp serves db's items with the options on GET /items
+func newTestApp(t *testing.T, opts ...Option) (*fiber.App, *gorm.DB) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := db.AutoMigrate(&item{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	app := fiber.New()
+	app.Get("/items", func(c *fiber.Ctx) error {
+		var items []item
+		page, err := Paginate(c, db, &items, opts...)
+		if err != nil {
+			return err
+		}
+		return c.JSON(page)
+	})
+	return app, db
+}
+
+func seedItems(t *testing.T, db *gorm.DB, n int) {
+	t.Helper()
+
+	for i := 1; i <= n; i++ {
+		if err := db.Create(&item{Name: fmt.Sprintf("item-%02d", i), Group: i % 3}).Error; err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+}
+
+func getPage(t *testing.T, app *fiber.App, params url.Values) (int, itemPage) {
+	t.Helper()
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/items?"+params.Encode(), nil))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	var page itemPage
+	if resp.StatusCode == fiber.StatusOK {
+		if err := json.Unmarshal(body, &page); err != nil {
+			t.Fatalf("Failed to decode %s: %v", body, err)
+		}
+	}
+	return resp.StatusCode, page
+}
+
+func ids(items []item) []uint {
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+func TestPaginatePages(t *testing.T) {
+	app, db := newTestApp(t, Sortable("name"), PerPage(5, 10))
+	seedItems(t, db, 12)
+
+	status, page := getPage(t, app, url.Values{"page": {"3"}})
+	if status != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if page.Total != 12 || page.Page != 3 || page.PerPage != 5 || len(page.Items) != 2 {
+		t.Fatalf("Expected the last 2 of 12 items on page 3, got %+v", page)
+	}
+
+	// per_page is capped
+	if _, page := getPage(t, app, url.Values{"per_page": {"1000"}}); page.PerPage != 10 || len(page.Items) != 10 {
+		t.Fatalf("Expected per_page capped at 10, got %+v", page)
+	}
+
+	_, page = getPage(t, app, url.Values{"sort": {"-name"}, "per_page": {"2"}})
+	if page.Items[0].Name != "item-12" || page.Items[1].Name != "item-11" {
+		t.Fatalf("Expected descending names, got %+v", page.Items)
+	}
+
+	for _, params := range []url.Values{
+		{"page": {"0"}},
+		{"page": {"x"}},
+		{"per_page": {"-1"}},
+	} {
+		if status, _ := getPage(t, app, params); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status 400 for %v, got %d", params, status)
+		}
+	}
+}
+
+func TestPaginateEmptyItems(t *testing.T) {
+	app, _ := newTestApp(t)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/items", nil))
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if want := `{"items":[],"total":0,"page":1,"per_page":20}`; string(body) != want {
+		t.Fatalf("Expected %s, got %s", want, body)
+	}
+}
+
+func TestPaginateSortAllowlist(t *testing.T) {
+	app, db := newTestApp(t, Sortable("name"), DefaultSort("-group"))
+	seedItems(t, db, 3)
+
+	for _, sort := range []string{"group", "-group", "name,group", "missing", "name; DROP TABLE items"} {
+		if status, _ := getPage(t, app, url.Values{"sort": {sort}}); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status 400 for sort %q, got %d", sort, status)
+		}
+	}
+
+	// Field names resolve to their columns
+	if status, _ := getPage(t, app, url.Values{"sort": {"Name"}}); status != fiber.StatusOK {
+		t.Fatalf("Expected sorting by field name to be allowed, got %d", status)
+	}
+
+	// The default sort need not be sortable by clients
+	_, page := getPage(t, app, nil)
+	if page.Items[0].Group != 2 {
+		t.Fatalf("Expected the default sort by group descending, got %+v", page.Items)
+	}
+}
+
+func TestPaginateCursor(t *testing.T) {
+	app, db := newTestApp(t, Sortable("group"), WithCursor(), PerPage(4, 4))
+	seedItems(t, db, 10)
+
+	// Groups repeat, so the ID tie-breaker keeps the order total
+	params := url.Values{"sort": {"-group"}}
+	var seen []uint
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("Expected pagination to end")
+		}
+		status, page := getPage(t, app, params)
+		if status != fiber.StatusOK {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+		if page.Total < 10 || page.Page != 0 {
+			t.Fatalf("Expected the total without page numbers, got %+v", page)
+		}
+		seen = append(seen, ids(page.Items)...)
+
+		if pages == 0 {
+			// Rows inserted before the cursor do not shift later pages
+			if err := db.Create(&item{Name: "late", Group: 2}).Error; err != nil {
+				t.Fatalf("Failed to insert: %v", err)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		params.Set("cursor", page.NextCursor)
+	}
+
+	// Groups 2 (IDs 2, 5, 8), 1 (1, 4, 7, 10) and 0 (3, 6, 9); the late row
+	// in group 2 sorts before the cursor and neither repeats nor skips rows
+	want := []uint{2, 5, 8, 1, 4, 7, 10, 3, 6, 9}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Fatalf("Expected %v, got %v", want, seen)
+	}
+}
+
+func TestPaginateCursorStable(t *testing.T) {
+	app, db := newTestApp(t, Sortable("id"), WithCursor(), PerPage(3, 3))
+	seedItems(t, db, 6)
+
+	_, first := getPage(t, app, nil)
+	if first.NextCursor == "" {
+		t.Fatal("Expected a next cursor")
+	}
+
+	// Deleting rows of the first page does not skip rows of the second
+	if err := db.Delete(&item{}, first.Items[0].ID).Error; err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	_, second := getPage(t, app, url.Values{"cursor": {first.NextCursor}})
+	if fmt.Sprint(ids(second.Items)) != "[4 5 6]" || second.NextCursor != "" {
+		t.Fatalf("Expected items 4 to 6 on the last page, got %+v", second)
+	}
+
+	for _, params := range []url.Values{
+		{"cursor": {"not a cursor"}},
+		{"cursor": {first.NextCursor}, "sort": {"-id"}},
+	} {
+		if status, _ := getPage(t, app, params); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status 400 for %v, got %d", params, status)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Package mock provides a test double of tenancy.Store, so code written
+// against the tenancy interfaces can be unit-tested without a database.
+//
+// Each method of Store calls the function field of the same name with a
+// Func suffix. Calling a method whose field is nil panics, so a test fails
+// loudly on calls it did not expect. Every call is recorded in order.
+//
+// Example usage:
+//
+//	store := &mock.Store{
+//		TenantExistsFunc: func(ctx context.Context, schema string) (bool, error) {
+//			return false, nil
+//		},
+//		MigrateTenantFunc: func(ctx context.Context, schema string) error {
+//			return nil
+//		},
+//	}
+//	onboarding := &Onboarding{Store: store}
+//	if err := onboarding.Provision(ctx, "acme"); err != nil {
+//		t.Fatal(err)
+//	}
+//	if len(store.CallsTo("MigrateTenant")) != 1 {
+//		t.Fatal("Expected the tenant to be migrated")
+//	}
+package mock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenancy"
+)
+
+var _ tenancy.Store = (*Store)(nil)
+
+// Call is a recorded call of a Store method. Schema is the tenant schema
+// passed to it, empty for methods without one.
+type Call struct {
+	Method string
+	Schema string
+}
+
+// Store is a tenancy.Store backed by function fields
+type Store struct {
+	GetTenantDBFunc func(ctx context.Context, tenantSchema string) (*gorm.DB, error)
+	GetMasterDBFunc func() *gorm.DB
+
+	MigrateTenantFunc func(ctx context.Context, tenantSchema string) error
+	TenantExistsFunc  func(ctx context.Context, tenantSchema string) (bool, error)
+	ListSchemasFunc   func(ctx context.Context) ([]string, error)
+
+	IsTenantActiveFunc   func(ctx context.Context, tenantSchema string) (bool, error)
+	ActivateTenantFunc   func(ctx context.Context, tenantSchema string) error
+	DeactivateTenantFunc func(ctx context.Context, tenantSchema string) error
+	SoftDeleteTenantFunc func(ctx context.Context, tenantSchema string) error
+	RestoreTenantFunc    func(ctx context.Context, tenantSchema string) error
+	RemoveTenantDBFunc   func(tenantSchema string) error
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Calls returns every call made so far, in order
+func (m *Store) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// CallsTo returns the calls made to one method, in order
+func (m *Store) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range m.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// record logs a call and panics when the method's function is not set
+func (m *Store) record(method, schema string, set bool) {
+	m.mu.Lock()
+	m.calls = append(m.calls, Call{Method: method, Schema: schema})
+	m.mu.Unlock()
+
+	if !set {
+		panic(fmt.Sprintf("mock.Store.%s called, but %sFunc is not set", method, method))
+	}
+}
+
+// GetTenantDB calls GetTenantDBFunc
+func (m *Store) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	m.record("GetTenantDB", tenantSchema, m.GetTenantDBFunc != nil)
+	return m.GetTenantDBFunc(ctx, tenantSchema)
+}
+
+// GetMasterDB calls GetMasterDBFunc
+func (m *Store) GetMasterDB() *gorm.DB {
+	m.record("GetMasterDB", "", m.GetMasterDBFunc != nil)
+	return m.GetMasterDBFunc()
+}
+
+// MigrateTenant calls MigrateTenantFunc
+func (m *Store) MigrateTenant(ctx context.Context, tenantSchema string) error {
+	m.record("MigrateTenant", tenantSchema, m.MigrateTenantFunc != nil)
+	return m.MigrateTenantFunc(ctx, tenantSchema)
+}
+
+// TenantExists calls TenantExistsFunc
+func (m *Store) TenantExists(ctx context.Context, tenantSchema string) (bool, error) {
+	m.record("TenantExists", tenantSchema, m.TenantExistsFunc != nil)
+	return m.TenantExistsFunc(ctx, tenantSchema)
+}
+
+// ListSchemas calls ListSchemasFunc
+func (m *Store) ListSchemas(ctx context.Context) ([]string, error) {
+	m.record("ListSchemas", "", m.ListSchemasFunc != nil)
+	return m.ListSchemasFunc(ctx)
+}
+
+// IsTenantActive calls IsTenantActiveFunc
+func (m *Store) IsTenantActive(ctx context.Context, tenantSchema string) (bool, error) {
+	m.record("IsTenantActive", tenantSchema, m.IsTenantActiveFunc != nil)
+	return m.IsTenantActiveFunc(ctx, tenantSchema)
+}
+
+// ActivateTenant calls ActivateTenantFunc
+func (m *Store) ActivateTenant(ctx context.Context, tenantSchema string) error {
+	m.record("ActivateTenant", tenantSchema, m.ActivateTenantFunc != nil)
+	return m.ActivateTenantFunc(ctx, tenantSchema)
+}
+
+// DeactivateTenant calls DeactivateTenantFunc
+func (m *Store) DeactivateTenant(ctx context.Context, tenantSchema string) error {
+	m.record("DeactivateTenant", tenantSchema, m.DeactivateTenantFunc != nil)
+	return m.DeactivateTenantFunc(ctx, tenantSchema)
+}
+
+// SoftDeleteTenant calls SoftDeleteTenantFunc
+func (m *Store) SoftDeleteTenant(ctx context.Context, tenantSchema string) error {
+	m.record("SoftDeleteTenant", tenantSchema, m.SoftDeleteTenantFunc != nil)
+	return m.SoftDeleteTenantFunc(ctx, tenantSchema)
+}
+
+// RestoreTenant calls RestoreTenantFunc
+func (m *Store) RestoreTenant(ctx context.Context, tenantSchema string) error {
+	m.record("RestoreTenant", tenantSchema, m.RestoreTenantFunc != nil)
+	return m.RestoreTenantFunc(ctx, tenantSchema)
+}
+
+// RemoveTenantDB calls RemoveTenantDBFunc
+func (m *Store) RemoveTenantDB(tenantSchema string) error {
+	m.record("RemoveTenantDB", tenantSchema, m.RemoveTenantDBFunc != nil)
+	return m.RemoveTenantDBFunc(tenantSchema)
+}
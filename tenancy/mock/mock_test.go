@@ -0,0 +1,96 @@
+package mock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenancy"
+	"github.com/1Nelsonel/fiber-multitenant/tenancy/mock"
+)
+
+// onboarding is a provisioning service written against tenancy interfaces
+type onboarding struct {
+	store interface {
+		tenancy.Provisioner
+		tenancy.Lifecycle
+	}
+}
+
+func (o *onboarding) provision(ctx context.Context, schema string) error {
+	exists, err := o.store.TenantExists(ctx, schema)
+	if err != nil || exists {
+		return err
+	}
+	if err := o.store.MigrateTenant(ctx, schema); err != nil {
+		o.store.RemoveTenantDB(schema)
+		return err
+	}
+	return o.store.ActivateTenant(ctx, schema)
+}
+
+func TestProvisioningWithMock(t *testing.T) {
+	ctx := context.Background()
+	store := &mock.Store{
+		TenantExistsFunc:   func(ctx context.Context, schema string) (bool, error) { return schema == "globex", nil },
+		MigrateTenantFunc:  func(ctx context.Context, schema string) error { return nil },
+		ActivateTenantFunc: func(ctx context.Context, schema string) error { return nil },
+	}
+	service := &onboarding{store: store}
+
+	if err := service.provision(ctx, "acme"); err != nil {
+		t.Fatalf("Failed to provision: %v", err)
+	}
+	if err := service.provision(ctx, "globex"); err != nil {
+		t.Fatalf("Failed to skip an existing tenant: %v", err)
+	}
+
+	expected := []mock.Call{
+		{Method: "TenantExists", Schema: "acme"},
+		{Method: "MigrateTenant", Schema: "acme"},
+		{Method: "ActivateTenant", Schema: "acme"},
+		{Method: "TenantExists", Schema: "globex"},
+	}
+	calls := store.Calls()
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatalf("Expected call %d to be %v, got %v", i, expected[i], calls[i])
+		}
+	}
+}
+
+func TestProvisioningFailureWithMock(t *testing.T) {
+	failed := errors.New("migration failed")
+	store := &mock.Store{
+		TenantExistsFunc:   func(ctx context.Context, schema string) (bool, error) { return false, nil },
+		MigrateTenantFunc:  func(ctx context.Context, schema string) error { return failed },
+		RemoveTenantDBFunc: func(schema string) error { return nil },
+	}
+
+	err := (&onboarding{store: store}).provision(context.Background(), "acme")
+	if !errors.Is(err, failed) {
+		t.Fatalf("Expected the migration error, got %v", err)
+	}
+	if calls := store.CallsTo("RemoveTenantDB"); len(calls) != 1 || calls[0].Schema != "acme" {
+		t.Fatalf("Expected the connection to be evicted, got %v", calls)
+	}
+	if calls := store.CallsTo("ActivateTenant"); len(calls) != 0 {
+		t.Fatalf("Expected no activation, got %v", calls)
+	}
+}
+
+func TestUnexpectedCallPanics(t *testing.T) {
+	store := &mock.Store{}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a call without a function to panic")
+		}
+		if calls := store.CallsTo("DeactivateTenant"); len(calls) != 1 {
+			t.Fatalf("Expected the call to be recorded, got %v", calls)
+		}
+	}()
+	store.DeactivateTenant(context.Background(), "acme")
+}
@@ -0,0 +1,76 @@
+// Package tenancy defines the interfaces of a tenant store, layered so code
+// can depend on only what it uses and be unit-tested without PostgreSQL.
+//
+// DBProvider hands out database connections, Provisioner creates and
+// migrates tenant schemas, and Lifecycle activates, deactivates and evicts
+// tenants. Store composes the three. *tenantstore.TenantStore implements
+// all of them, and the mock package provides test doubles.
+//
+// Example usage:
+//
+//	// Onboarding provisions tenants; it only needs a Provisioner
+//	type Onboarding struct {
+//		Store tenancy.Provisioner
+//	}
+//
+//	func (o *Onboarding) Provision(ctx context.Context, schema string) error {
+//		if exists, err := o.Store.TenantExists(ctx, schema); err != nil || exists {
+//			return err
+//		}
+//		return o.Store.MigrateTenant(ctx, schema)
+//	}
+//
+//	onboarding := &Onboarding{Store: store} // store is a *tenantstore.TenantStore
+package tenancy
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// DBProvider hands out the database connections of tenants and the master
+// database. It is the interface middleware.New takes.
+type DBProvider interface {
+	// GetTenantDB returns a connection bound to the tenant's schema
+	GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error)
+
+	// GetMasterDB returns the connection to shared tables
+	GetMasterDB() *gorm.DB
+}
+
+// Provisioner creates and migrates tenant schemas
+type Provisioner interface {
+	// MigrateTenant brings the tenant's schema up to date with the models
+	MigrateTenant(ctx context.Context, tenantSchema string) error
+
+	// TenantExists reports whether the tenant is registered
+	TenantExists(ctx context.Context, tenantSchema string) (bool, error)
+
+	// ListSchemas returns every tenant schema, sorted by name
+	ListSchemas(ctx context.Context) ([]string, error)
+}
+
+// Lifecycle changes whether tenants are served and evicts their connections
+type Lifecycle interface {
+	// IsTenantActive reports whether the tenant may serve requests
+	IsTenantActive(ctx context.Context, tenantSchema string) (bool, error)
+
+	ActivateTenant(ctx context.Context, tenantSchema string) error
+	DeactivateTenant(ctx context.Context, tenantSchema string) error
+
+	// SoftDeleteTenant hides the tenant without dropping its schema;
+	// RestoreTenant brings it back
+	SoftDeleteTenant(ctx context.Context, tenantSchema string) error
+	RestoreTenant(ctx context.Context, tenantSchema string) error
+
+	// RemoveTenantDB closes the tenant's cached connection
+	RemoveTenantDB(tenantSchema string) error
+}
+
+// Store is a complete tenant store
+type Store interface {
+	DBProvider
+	Provisioner
+	Lifecycle
+}
@@ -0,0 +1,21 @@
+package tenancy_test
+
+import (
+	"github.com/1Nelsonel/fiber-multitenant/adminapi"
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+	"github.com/1Nelsonel/fiber-multitenant/tenancy"
+	"github.com/1Nelsonel/fiber-multitenant/tenancy/mock"
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+// The tenant store implements every layer; the admin API and middleware
+// accept it through their narrower interfaces
+var (
+	_ tenancy.Store          = (*tenantstore.TenantStore)(nil)
+	_ adminapi.Store         = (*tenantstore.TenantStore)(nil)
+	_ middleware.TenantStore = (*tenantstore.TenantStore)(nil)
+
+	_ tenancy.DBProvider     = (*tenanttest.Store)(nil)
+	_ middleware.TenantStore = (*mock.Store)(nil)
+)
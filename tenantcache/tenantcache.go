@@ -0,0 +1,135 @@
+// Package tenantcache defines the cache the tenant store keeps registry
+// lookups in, so replicas can share one cache instead of each keeping its
+// own.
+//
+// Cache is a small byte-oriented key/value interface with a TTL per key.
+// NewMemory returns the in-process implementation the store uses by default;
+// the contrib/redistenantcache module implements it on Redis. Namespace
+// prefixes the keys of a cache, so several stores or applications can share
+// one server.
+//
+// Example usage:
+//
+//	config := tenantstore.DefaultConfig(dsn)
+//	config.EnableRegistry = true
+//	config.Cache = redistenantcache.New(redisClient)
+//	store, err := tenantstore.New(config)
+package tenantcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache stores values for a TTL. Implementations must be safe for
+// concurrent use. A TTL of zero or less keeps the value until it is deleted.
+type Cache interface {
+	// Get returns the value of key and whether it was found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Set stores value under key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes keys; keys that do not exist are ignored
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Clearer is implemented by caches that can drop every key, such as
+// Memory. Shared caches usually leave it out, since clearing them would
+// affect every replica.
+type Clearer interface {
+	Clear(ctx context.Context) error
+}
+
+// Memory is a Cache in the memory of the process. Expired keys are removed
+// when they are read.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory returns an empty in-memory cache
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]memoryEntry)}
+}
+
+// Get returns a copy of the value of key
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	return append([]byte(nil), entry.value...), true, nil
+}
+
+// Set stores a copy of value under key
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := memoryEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	m.mu.Lock()
+	m.entries[key] = entry
+	m.mu.Unlock()
+	return nil
+}
+
+// Delete removes keys
+func (m *Memory) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// Clear removes every key
+func (m *Memory) Clear(ctx context.Context) error {
+	m.mu.Lock()
+	m.entries = make(map[string]memoryEntry)
+	m.mu.Unlock()
+	return nil
+}
+
+// Namespace returns a view of cache whose keys are prefixed with namespace
+// and a colon, as in "registry:acme". Clearing it clears nothing, since the
+// keys of other namespaces share the cache.
+func Namespace(cache Cache, namespace string) Cache {
+	return &namespaced{cache: cache, prefix: namespace + ":"}
+}
+
+type namespaced struct {
+	cache  Cache
+	prefix string
+}
+
+func (n *namespaced) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return n.cache.Get(ctx, n.prefix+key)
+}
+
+func (n *namespaced) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return n.cache.Set(ctx, n.prefix+key, value, ttl)
+}
+
+func (n *namespaced) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = n.prefix + key
+	}
+	return n.cache.Delete(ctx, prefixed...)
+}
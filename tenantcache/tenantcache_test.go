@@ -0,0 +1,29 @@
+package tenantcache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantcache"
+	"github.com/1Nelsonel/fiber-multitenant/tenantcache/tenantcachetest"
+)
+
+func TestMemory(t *testing.T) {
+	tenantcachetest.Run(t, func(t *testing.T) tenantcache.Cache {
+		return tenantcache.NewMemory()
+	})
+}
+
+func TestMemoryClear(t *testing.T) {
+	ctx := context.Background()
+	cache := tenantcache.NewMemory()
+	cache.Set(ctx, "acme", []byte("a"), time.Minute)
+
+	if err := cache.Clear(ctx); err != nil {
+		t.Fatalf("Failed to clear: %v", err)
+	}
+	if _, ok, _ := cache.Get(ctx, "acme"); ok {
+		t.Fatal("Expected Clear to remove every key")
+	}
+}
@@ -0,0 +1,143 @@
+// Package tenantcachetest checks that a tenantcache.Cache implementation
+// behaves as the tenant store expects.
+//
+// Example usage:
+//
+//	func TestCache(t *testing.T) {
+//		tenantcachetest.Run(t, func(t *testing.T) tenantcache.Cache {
+//			return mycache.New(t)
+//		})
+//	}
+package tenantcachetest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantcache"
+)
+
+// Run tests a Cache implementation. newCache is called once per subtest and
+// must return an empty cache. Expiry is checked with a TTL of a second, so
+// implementations with a coarser resolution fail.
+func Run(t *testing.T, newCache func(t *testing.T) tenantcache.Cache) {
+	ctx := context.Background()
+
+	t.Run("SetGet", func(t *testing.T) {
+		cache := newCache(t)
+		if _, ok, err := cache.Get(ctx, "missing"); ok || err != nil {
+			t.Fatalf("Expected a miss for an unknown key, got %v (%v)", ok, err)
+		}
+
+		if err := cache.Set(ctx, "acme", []byte(`{"plan":"pro"}`), time.Minute); err != nil {
+			t.Fatalf("Failed to set: %v", err)
+		}
+		value, ok, err := cache.Get(ctx, "acme")
+		if err != nil || !ok || string(value) != `{"plan":"pro"}` {
+			t.Fatalf("Expected the stored value, got %q %v (%v)", value, ok, err)
+		}
+
+		if err := cache.Set(ctx, "acme", []byte("null"), time.Minute); err != nil {
+			t.Fatalf("Failed to overwrite: %v", err)
+		}
+		if value, _, _ := cache.Get(ctx, "acme"); string(value) != "null" {
+			t.Fatalf("Expected the overwritten value, got %q", value)
+		}
+	})
+
+	t.Run("EmptyValue", func(t *testing.T) {
+		cache := newCache(t)
+		if err := cache.Set(ctx, "empty", nil, time.Minute); err != nil {
+			t.Fatalf("Failed to set: %v", err)
+		}
+		if value, ok, err := cache.Get(ctx, "empty"); err != nil || !ok || len(value) != 0 {
+			t.Fatalf("Expected an empty value to be found, got %q %v (%v)", value, ok, err)
+		}
+	})
+
+	t.Run("ValuesAreCopied", func(t *testing.T) {
+		cache := newCache(t)
+		value := []byte("original")
+		cache.Set(ctx, "acme", value, time.Minute)
+		copy(value, "modified")
+
+		stored, _, _ := cache.Get(ctx, "acme")
+		if !bytes.Equal(stored, []byte("original")) {
+			t.Fatalf("Expected the cache to keep its own copy, got %q", stored)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		cache := newCache(t)
+		cache.Set(ctx, "acme", []byte("a"), time.Minute)
+		cache.Set(ctx, "globex", []byte("g"), time.Minute)
+		cache.Set(ctx, "initech", []byte("i"), time.Minute)
+
+		if err := cache.Delete(ctx, "acme", "globex", "missing"); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+		for _, key := range []string{"acme", "globex"} {
+			if _, ok, _ := cache.Get(ctx, key); ok {
+				t.Fatalf("Expected %s to be deleted", key)
+			}
+		}
+		if _, ok, _ := cache.Get(ctx, "initech"); !ok {
+			t.Fatal("Expected other keys to survive")
+		}
+		if err := cache.Delete(ctx); err != nil {
+			t.Fatalf("Expected deleting no keys to succeed, got %v", err)
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		cache := newCache(t)
+		cache.Set(ctx, "short", []byte("s"), time.Second)
+		cache.Set(ctx, "forever", []byte("f"), 0)
+
+		advance(t, cache, 1100*time.Millisecond)
+
+		if _, ok, _ := cache.Get(ctx, "short"); ok {
+			t.Fatal("Expected the key to expire after its TTL")
+		}
+		if _, ok, _ := cache.Get(ctx, "forever"); !ok {
+			t.Fatal("Expected a key without TTL to be kept")
+		}
+	})
+
+	t.Run("Namespace", func(t *testing.T) {
+		cache := newCache(t)
+		registry := tenantcache.Namespace(cache, "registry")
+		domains := tenantcache.Namespace(cache, "domains")
+
+		registry.Set(ctx, "acme", []byte("r"), time.Minute)
+		domains.Set(ctx, "acme", []byte("d"), time.Minute)
+
+		if value, _, _ := registry.Get(ctx, "acme"); string(value) != "r" {
+			t.Fatalf("Expected the registry value, got %q", value)
+		}
+		if value, _, _ := cache.Get(ctx, "domains:acme"); string(value) != "d" {
+			t.Fatalf("Expected prefixed keys in the cache, got %q", value)
+		}
+
+		registry.Delete(ctx, "acme")
+		if _, ok, _ := domains.Get(ctx, "acme"); !ok {
+			t.Fatal("Expected deletes to stay in their namespace")
+		}
+	})
+}
+
+// Advancer is implemented by caches with a fake clock, such as one backed by
+// miniredis, so Run checks expiry without sleeping
+type Advancer interface {
+	Advance(d time.Duration)
+}
+
+func advance(t *testing.T, cache tenantcache.Cache, d time.Duration) {
+	if a, ok := cache.(Advancer); ok {
+		a.Advance(d)
+		return
+	}
+	time.Sleep(d)
+}
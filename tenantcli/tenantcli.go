@@ -0,0 +1,591 @@
+// Package tenantcli implements the fmt-tenant command line tool for managing
+// tenant schemas from CI jobs and runbooks.
+//
+// The stock binary in cmd/fmt-tenant knows nothing about your models, so its
+// migrate command only creates missing schemas. Build your own binary to
+// migrate application models:
+//
+//	func main() {
+//		os.Exit(tenantcli.Run(context.Background(), os.Args[1:], tenantcli.Options{
+//			Models: []interface{}{&User{}, &Product{}},
+//		}))
+//	}
+package tenantcli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+// Exit codes returned by Run
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+)
+
+// Options configures Run
+type Options struct {
+	// Models are migrated into every tenant by create and migrate
+	Models []interface{}
+
+	// Config optionally customizes the store config built from the DSN
+	Config func(config *tenantstore.Config)
+
+	// Stdout and Stderr default to the process streams
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// usageError reports invalid command line input
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// command is a parsed subcommand ready to run against a store
+type command func(ctx context.Context, store *tenantstore.TenantStore, out *output) error
+
+const usage = `Usage: fmt-tenant [--dsn DSN] [--output table|json] <command> [arguments]
+
+Commands:
+  list                                             List tenant schemas
+  create <schema>                                  Create and migrate a tenant schema
+  create-batch <file> [--concurrency N]            Create the tenants listed in a YAML or JSON file
+               [--stop-on-error]
+  migrate (--all | <schema>) [--dry-run]           Migrate one or all tenant schemas
+  drop <schema> (--yes | --dry-run) [--cascade]    Drop a tenant schema
+  truncate <schema> (--yes | --dry-run)            Delete all rows in a tenant schema
+           [--restart-identity]
+  export <schema> [--format json]                  Export all tenant tables
+  seed --dir <dir>                                 Load fixtures into their tenants
+  stats                                            Show table counts and sizes per schema
+  check                                            Run the store's self-check on a throwaway schema
+
+The DSN defaults to the DATABASE_URL environment variable.
+`
+
+// Run executes the command line and returns the process exit code
+func Run(ctx context.Context, args []string, opts Options) int {
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	global := flag.NewFlagSet("fmt-tenant", flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	dsn := global.String("dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN")
+	format := global.String("output", "table", "output format: table or json")
+
+	if err := global.Parse(args); err != nil {
+		return fail(stderr, usagef("%v", err))
+	}
+	if *format != "table" && *format != "json" {
+		return fail(stderr, usagef("unknown output format %q", *format))
+	}
+	if global.NArg() == 0 {
+		return fail(stderr, usagef("missing command"))
+	}
+
+	cmd, err := parseCommand(global.Arg(0), global.Args()[1:])
+	if err != nil {
+		return fail(stderr, err)
+	}
+
+	if *dsn == "" {
+		return fail(stderr, usagef("no DSN: pass --dsn or set DATABASE_URL"))
+	}
+
+	config := tenantstore.DefaultConfig(*dsn)
+	config.Models = opts.Models
+	if opts.Config != nil {
+		opts.Config(config)
+	}
+
+	store, err := tenantstore.New(config)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	defer store.Close()
+
+	if err := cmd(ctx, store, &output{w: stdout, json: *format == "json"}); err != nil {
+		return fail(stderr, err)
+	}
+	return ExitOK
+}
+
+// fail prints the error and maps it to an exit code
+func fail(stderr io.Writer, err error) int {
+	fmt.Fprintf(stderr, "fmt-tenant: %v\n", err)
+
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprint(stderr, "\n"+usage)
+		return ExitUsage
+	}
+	return ExitFailure
+}
+
+// parseCommand validates the subcommand and its flags before any connection
+// is opened
+func parseCommand(name string, args []string) (command, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	switch name {
+	case "list":
+		if _, err := parseArgs(fs, args, 0); err != nil {
+			return nil, err
+		}
+		return listCommand, nil
+
+	case "stats":
+		if _, err := parseArgs(fs, args, 0); err != nil {
+			return nil, err
+		}
+		return statsCommand, nil
+
+	case "check":
+		if _, err := parseArgs(fs, args, 0); err != nil {
+			return nil, err
+		}
+		return checkCommand, nil
+
+	case "create":
+		positional, err := parseArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return createCommand(positional[0]), nil
+
+	case "create-batch":
+		concurrency := fs.Int("concurrency", tenantstore.DefaultBatchConcurrency, "tenants created at once")
+		stopOnError := fs.Bool("stop-on-error", false, "skip the remaining tenants after a failure")
+		positional, err := parseArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return createBatchCommand(positional[0], tenantstore.BatchOptions{
+			Concurrency: *concurrency,
+			StopOnError: *stopOnError,
+		}), nil
+
+	case "migrate":
+		all := fs.Bool("all", false, "migrate every tenant schema")
+		concurrency := fs.Int("concurrency", 1, "tenants migrated at once")
+		dryRun := fs.Bool("dry-run", false, "print the planned changes without migrating")
+		positional, err := parseArgs(fs, args, -1)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case *all && len(positional) == 0:
+			return migrateAllCommand(*concurrency, *dryRun), nil
+		case !*all && len(positional) == 1 && *dryRun:
+			return planMigrationCommand(positional[0]), nil
+		case !*all && len(positional) == 1:
+			return createCommand(positional[0]), nil
+		default:
+			return nil, usagef("migrate expects either --all or a single schema")
+		}
+
+	case "drop":
+		cascade := fs.Bool("cascade", false, "drop all objects in the schema")
+		yes := fs.Bool("yes", false, "confirm the drop")
+		dryRun := fs.Bool("dry-run", false, "print the plan without dropping")
+		positional, err := parseArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if !*yes && !*dryRun {
+			return nil, usagef("refusing to drop %s without --yes", positional[0])
+		}
+		return dropCommand(positional[0], tenantstore.DropOptions{Cascade: *cascade, DryRun: *dryRun}), nil
+
+	case "truncate":
+		restartIdentity := fs.Bool("restart-identity", false, "reset sequences of the truncated tables")
+		yes := fs.Bool("yes", false, "confirm the truncate")
+		dryRun := fs.Bool("dry-run", false, "print the plan without truncating")
+		positional, err := parseArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if !*yes && !*dryRun {
+			return nil, usagef("refusing to truncate %s without --yes", positional[0])
+		}
+		return truncateCommand(positional[0], tenantstore.TruncateOptions{
+			RestartIdentity: *restartIdentity,
+			DryRun:          *dryRun,
+		}), nil
+
+	case "export":
+		format := fs.String("format", "json", "export format")
+		positional, err := parseArgs(fs, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if *format != "json" {
+			return nil, usagef("unknown export format %q", *format)
+		}
+		return exportCommand(positional[0]), nil
+
+	case "seed":
+		dir := fs.String("dir", "", "directory with one fixtures file per tenant")
+		if _, err := parseArgs(fs, args, 0); err != nil {
+			return nil, err
+		}
+		if *dir == "" {
+			return nil, usagef("seed expects --dir")
+		}
+		return seedCommand(*dir), nil
+	}
+
+	return nil, usagef("unknown command %q", name)
+}
+
+// parseArgs parses flags that may appear before or after positional arguments
+// and checks the positional count; want < 0 accepts any number
+func parseArgs(fs *flag.FlagSet, args []string, want int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, usagef("%s: %v", fs.Name(), err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if want >= 0 && len(positional) != want {
+		return nil, usagef("%s expects %d argument(s), got %d", fs.Name(), want, len(positional))
+	}
+	return positional, nil
+}
+
+func listCommand(ctx context.Context, store *tenantstore.TenantStore, out *output) error {
+	schemas, err := store.ListSchemas(ctx)
+	if err != nil {
+		return err
+	}
+
+	if out.json {
+		if schemas == nil {
+			schemas = []string{}
+		}
+		return out.encode(schemas)
+	}
+
+	return out.table([]string{"SCHEMA"}, len(schemas), func(i int) []interface{} {
+		return []interface{}{schemas[i]}
+	})
+}
+
+func statsCommand(ctx context.Context, store *tenantstore.TenantStore, out *output) error {
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	if out.json {
+		if stats == nil {
+			stats = []tenantstore.TenantStats{}
+		}
+		return out.encode(stats)
+	}
+
+	return out.table([]string{"SCHEMA", "TABLES", "SIZE"}, len(stats), func(i int) []interface{} {
+		return []interface{}{stats[i].Schema, stats[i].Tables, formatBytes(stats[i].SizeBytes)}
+	})
+}
+
+func checkCommand(ctx context.Context, store *tenantstore.TenantStore, out *output) error {
+	report, checkErr := store.SelfCheck(ctx)
+
+	var err error
+	if out.json {
+		err = out.encode(report)
+	} else {
+		err = out.table([]string{"STEP", "STATUS", "DURATION", "ERROR", "HINT"}, len(report.Steps), func(i int) []interface{} {
+			step := report.Steps[i]
+			status := "ok"
+			if !step.OK {
+				status = "failed"
+			}
+			return []interface{}{step.Name, status, step.Duration.Round(time.Millisecond), step.Error, step.Hint}
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return checkErr
+}
+
+func createCommand(schema string) command {
+	return func(ctx context.Context, store *tenantstore.TenantStore, out *output) error {
+		if err := store.MigrateTenant(ctx, schema); err != nil {
+			return err
+		}
+		return out.status(schema, "migrated")
+	}
+}
+
+func createBatchCommand(path string, opts tenantstore.BatchOptions) command {
+	return func(ctx context.Context, store *tenantstore.TenantStore, out *output) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		specs, err := tenantstore.ReadTenantSpecs(f)
+		if err != nil {
+			return err
+		}
+
+		report, err := store.CreateTenants(ctx, specs, opts)
+		if err != nil {
+			return err
+		}
+
+		if out.json {
+			err = out.encode(report)
+		} else {
+			err = out.table([]string{"SCHEMA", "STATUS", "ERROR"}, len(report.Results), func(i int) []interface{} {
+				result := report.Results[i]
+				return []interface{}{result.Schema, result.Status, result.Error}
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		if created := report.Count(tenantstore.BatchCreated); created < len(report.Results) {
+			return fmt.Errorf("%d of %d tenant(s) were not created", len(report.Results)-created, len(report.Results))
+		}
+		return nil
+	}
+}
+
+func planMigrationCommand(schema string) command {
+	return func(ctx context.Context, store *tenantstore.TenantStore, out *output) error {
+		plan, err := store.PlanMigration(ctx, schema)
+		if err != nil {
+			return err
+		}
+		return out.plan(plan)
+	}
+}
+
+func migrateAllCommand(concurrency int, dryRun bool) command {
+	return func(ctx context.Context, store *tenantstore.TenantStore, out *output) error {
+		report, err := store.MigrateAll(ctx, tenantstore.MigrateOptions{
+			ForEachOptions: tenantstore.ForEachOptions{
+				Concurrency:     concurrency,
+				ContinueOnError: true,
+			},
+			DryRun: dryRun,
+		})
+		if err != nil {
+			return err
+		}
+
+		if dryRun {
+			if err := out.plan(report.Plan); err != nil {
+				return err
+			}
+			return report.Err()
+		}
+
+		if err := out.report(report); err != nil {
+			return err
+		}
+
+		if len(report.Failed) > 0 {
+			return fmt.Errorf("%d of %d tenant(s) failed to migrate",
+				len(report.Failed), len(report.Failed)+len(report.Migrated))
+		}
+		return nil
+	}
+}
+
+func dropCommand(schema string, opts tenantstore.DropOptions) command {
+	return func(ctx context.Context, store *tenantstore.TenantStore, out *output) error {
+		plan, err := store.DropTenant(ctx, schema, opts)
+		if err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return out.plan(plan)
+		}
+		return out.status(schema, "dropped")
+	}
+}
+
+func truncateCommand(schema string, opts tenantstore.TruncateOptions) command {
+	return func(ctx context.Context, store *tenantstore.TenantStore, out *output) error {
+		plan, err := store.TruncateTenant(ctx, schema, opts)
+		if err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return out.plan(plan)
+		}
+		return out.status(schema, "truncated")
+	}
+}
+
+func exportCommand(schema string) command {
+	return func(ctx context.Context, store *tenantstore.TenantStore, out *output) error {
+		export, err := store.ExportTenant(ctx, schema)
+		if err != nil {
+			return err
+		}
+
+		// Exports are always JSON regardless of --output
+		return out.encode(map[string]interface{}{
+			"schema": schema,
+			"tables": export,
+		})
+	}
+}
+
+func seedCommand(dir string) command {
+	return func(ctx context.Context, store *tenantstore.TenantStore, out *output) error {
+		fixtures, err := tenantstore.LoadFixtures(dir)
+		if err != nil {
+			return err
+		}
+		if err := store.SeedFixtures(ctx, fixtures); err != nil {
+			return err
+		}
+
+		tenants := make([]string, 0, len(fixtures))
+		for tenant := range fixtures {
+			tenants = append(tenants, tenant)
+		}
+		sort.Strings(tenants)
+
+		if out.json {
+			seeded := make(map[string]int, len(fixtures))
+			for tenant, records := range fixtures {
+				seeded[tenant] = len(records)
+			}
+			return out.encode(seeded)
+		}
+		return out.table([]string{"TENANT", "RECORDS"}, len(tenants), func(i int) []interface{} {
+			return []interface{}{tenants[i], len(fixtures[tenants[i]])}
+		})
+	}
+}
+
+// output renders command results as a table or JSON
+type output struct {
+	w    io.Writer
+	json bool
+}
+
+func (o *output) encode(v interface{}) error {
+	encoder := json.NewEncoder(o.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (o *output) table(headers []string, rows int, row func(i int) []interface{}) error {
+	tw := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for i := 0; i < rows; i++ {
+		values := row(i)
+		cells := make([]string, len(values))
+		for j, value := range values {
+			cells[j] = fmt.Sprint(value)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (o *output) status(schema, status string) error {
+	if o.json {
+		return o.encode(map[string]string{"schema": schema, "status": status})
+	}
+	return o.table([]string{"SCHEMA", "STATUS"}, 1, func(int) []interface{} {
+		return []interface{}{schema, status}
+	})
+}
+
+func (o *output) report(report *tenantstore.MigrateReport) error {
+	failed := make(map[string]string, len(report.Failed))
+	for schema, err := range report.Failed {
+		failed[schema] = err.Error()
+	}
+
+	if o.json {
+		migrated := report.Migrated
+		if migrated == nil {
+			migrated = []string{}
+		}
+		return o.encode(map[string]interface{}{
+			"migrated":    migrated,
+			"failed":      failed,
+			"duration_ms": report.Duration.Milliseconds(),
+		})
+	}
+
+	schemas := append([]string{}, report.Migrated...)
+	for schema := range failed {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+
+	return o.table([]string{"SCHEMA", "STATUS", "ERROR"}, len(schemas), func(i int) []interface{} {
+		if msg, ok := failed[schemas[i]]; ok {
+			return []interface{}{schemas[i], "failed", msg}
+		}
+		return []interface{}{schemas[i], "migrated", ""}
+	})
+}
+
+func (o *output) plan(plan *tenantstore.Plan) error {
+	if o.json {
+		return o.encode(plan)
+	}
+	return o.table([]string{"SCHEMA", "ACTION", "SQL"}, len(plan.Steps), func(i int) []interface{} {
+		step := plan.Steps[i]
+		return []interface{}{step.Schema, step.Action, step.SQL}
+	})
+}
+
+// formatBytes renders a size in human-readable units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,218 @@
+package tenantcli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore/tenantstoretest"
+)
+
+type widget struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	tenantstoretest.Stop()
+	os.Exit(code)
+}
+
+func getTestDSN(t *testing.T) string {
+	t.Helper()
+
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		dsn = tenantstoretest.StartPostgres(t)
+	}
+	return tenantstoretest.NewDatabase(t, dsn)
+}
+
+// run executes the CLI and returns the exit code, stdout and stderr
+func run(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), args, Options{
+		Models: []interface{}{&widget{}},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "Missing command", args: []string{"--dsn", "x"}},
+		{name: "Unknown command", args: []string{"--dsn", "x", "frobnicate"}},
+		{name: "Unknown output", args: []string{"--dsn", "x", "--output", "xml", "list"}},
+		{name: "Drop without confirmation", args: []string{"--dsn", "x", "drop", "acme", "--cascade"}},
+		{name: "Truncate without confirmation", args: []string{"--dsn", "x", "truncate", "acme"}},
+		{name: "Migrate without target", args: []string{"--dsn", "x", "migrate"}},
+		{name: "Migrate with both targets", args: []string{"--dsn", "x", "migrate", "--all", "acme"}},
+		{name: "Create without schema", args: []string{"--dsn", "x", "create"}},
+		{name: "Create batch without file", args: []string{"--dsn", "x", "create-batch"}},
+		{name: "Seed without dir", args: []string{"--dsn", "x", "seed"}},
+		{name: "Check with argument", args: []string{"--dsn", "x", "check", "acme"}},
+		{name: "Unknown export format", args: []string{"--dsn", "x", "export", "acme", "--format", "xml"}},
+		{name: "Missing DSN", args: []string{"--dsn", "", "list"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := run(t, tt.args...)
+			if code != ExitUsage {
+				t.Fatalf("Expected exit code %d, got %d: %s", ExitUsage, code, stderr)
+			}
+			if !strings.Contains(stderr, "Usage:") {
+				t.Fatalf("Expected usage in stderr, got: %s", stderr)
+			}
+		})
+	}
+}
+
+func TestRunTenantLifecycle(t *testing.T) {
+	dsn := getTestDSN(t)
+
+	for _, schema := range []string{"acme", "globex"} {
+		if code, _, stderr := run(t, "--dsn", dsn, "create", schema); code != ExitOK {
+			t.Fatalf("Failed to create %s: %s", schema, stderr)
+		}
+	}
+
+	code, stdout, stderr := run(t, "--dsn", dsn, "--output", "json", "list")
+	if code != ExitOK {
+		t.Fatalf("Failed to list: %s", stderr)
+	}
+
+	var schemas []string
+	if err := json.Unmarshal([]byte(stdout), &schemas); err != nil {
+		t.Fatalf("Failed to decode list output: %v", err)
+	}
+	if len(schemas) != 2 || schemas[0] != "acme" || schemas[1] != "globex" {
+		t.Fatalf("Expected [acme globex], got %v", schemas)
+	}
+
+	code, stdout, stderr = run(t, "--dsn", dsn, "migrate", "--all")
+	if code != ExitOK {
+		t.Fatalf("Failed to migrate: %s", stderr)
+	}
+	if !strings.Contains(stdout, "acme") || !strings.Contains(stdout, "migrated") {
+		t.Fatalf("Expected migrate report table, got: %s", stdout)
+	}
+
+	code, stdout, stderr = run(t, "--dsn", dsn, "export", "acme")
+	if code != ExitOK {
+		t.Fatalf("Failed to export: %s", stderr)
+	}
+
+	var export struct {
+		Schema string                              `json:"schema"`
+		Tables map[string][]map[string]interface{} `json:"tables"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &export); err != nil {
+		t.Fatalf("Failed to decode export: %v", err)
+	}
+	if _, ok := export.Tables["widgets"]; !ok {
+		t.Fatalf("Expected widgets table in export, got %v", export.Tables)
+	}
+
+	code, stdout, stderr = run(t, "--dsn", dsn, "--output", "json", "drop", "acme", "--cascade", "--dry-run")
+	if code != ExitOK {
+		t.Fatalf("Failed to plan drop: %s", stderr)
+	}
+	if !strings.Contains(stdout, "DROP SCHEMA acme CASCADE") || !strings.Contains(stdout, `"dry_run": true`) {
+		t.Fatalf("Expected drop plan, got: %s", stdout)
+	}
+	if _, stdout, _ = run(t, "--dsn", dsn, "list"); !strings.Contains(stdout, "acme") {
+		t.Fatalf("Expected dry run to keep acme, got: %s", stdout)
+	}
+
+	if code, _, stderr := run(t, "--dsn", dsn, "drop", "acme", "--cascade", "--yes"); code != ExitOK {
+		t.Fatalf("Failed to drop: %s", stderr)
+	}
+
+	_, stdout, _ = run(t, "--dsn", dsn, "stats")
+	if strings.Contains(stdout, "acme") || !strings.Contains(stdout, "globex") {
+		t.Fatalf("Expected only globex in stats, got: %s", stdout)
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	dsn := getTestDSN(t)
+
+	code, stdout, stderr := run(t, "--dsn", dsn, "check")
+	if code != ExitOK {
+		t.Fatalf("Expected self-check to pass: %s", stderr)
+	}
+	if !strings.Contains(stdout, "round_trip") || strings.Contains(stdout, "failed") {
+		t.Fatalf("Expected passing steps, got: %s", stdout)
+	}
+
+	code, stdout, _ = run(t, "--dsn", dsn, "--output", "json", "check")
+	var report struct {
+		Steps []struct {
+			Name string `json:"name"`
+			OK   bool   `json:"ok"`
+		} `json:"steps"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil || code != ExitOK {
+		t.Fatalf("Expected JSON report, got %d: %s", code, stdout)
+	}
+	if len(report.Steps) == 0 {
+		t.Fatalf("Expected steps in report, got: %s", stdout)
+	}
+}
+
+func TestRunDropMissingSchemaFails(t *testing.T) {
+	dsn := getTestDSN(t)
+
+	code, _, stderr := run(t, "--dsn", dsn, "drop", "missing", "--yes")
+	if code != ExitFailure {
+		t.Fatalf("Expected exit code %d, got %d", ExitFailure, code)
+	}
+	if !strings.Contains(stderr, "missing") {
+		t.Fatalf("Expected schema in error, got: %s", stderr)
+	}
+}
+
+func TestRunCreateBatch(t *testing.T) {
+	dsn := getTestDSN(t)
+
+	path := filepath.Join(t.TempDir(), "tenants.yaml")
+	specs := `tenants:
+  - schema: initech
+    seed:
+      widgets:
+        - id: 1
+  - schema: broken
+    seed:
+      missing_table:
+        - id: 1
+  - schema: hooli
+`
+	if err := os.WriteFile(path, []byte(specs), 0o644); err != nil {
+		t.Fatalf("Failed to write specs: %v", err)
+	}
+
+	code, stdout, stderr := run(t, "--dsn", dsn, "create-batch", path, "--concurrency", "2")
+	if code != ExitFailure {
+		t.Fatalf("Expected exit code %d for a partial batch, got %d", ExitFailure, code)
+	}
+	if !strings.Contains(stderr, "1 of 3") || !strings.Contains(stdout, "broken") {
+		t.Fatalf("Expected the failed tenant reported, got: %s %s", stdout, stderr)
+	}
+
+	_, stdout, _ = run(t, "--dsn", dsn, "list")
+	if !strings.Contains(stdout, "initech") || !strings.Contains(stdout, "hooli") || strings.Contains(stdout, "broken") {
+		t.Fatalf("Expected initech and hooli without broken, got: %s", stdout)
+	}
+}
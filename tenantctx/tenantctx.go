@@ -0,0 +1,94 @@
+// Package tenantctx carries the tenant on a context.Context, so service code
+// shared by HTTP handlers, cron jobs, CLI commands and tests gets the tenant
+// and its database the same way wherever it runs. The middleware sets it on
+// c.UserContext(), worker.Run and worker.FanOut on the context of their
+// function, and other entry points call With:
+//
+//	// Shared by the handler and the CLI
+//	func CountOrders(ctx context.Context, store tenantctx.Store) (int64, error) {
+//		db, err := tenantctx.DB(ctx, store)
+//		if err != nil {
+//			return 0, err
+//		}
+//		var count int64
+//		return count, db.Model(&Order{}).Count(&count).Error
+//	}
+//
+//	// HTTP handler, after middleware.New
+//	count, err := CountOrders(c.UserContext(), store)
+//
+//	// CLI command
+//	count, err := CountOrders(tenantctx.With(ctx, "acme"), store)
+package tenantctx
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// ErrNoTenant is returned by DB for contexts without a tenant
+var ErrNoTenant = errors.New("no tenant in context")
+
+// Store provides tenant database connections, as tenantstore.TenantStore
+// and tenanttest.Store do
+type Store interface {
+	GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error)
+}
+
+type scopeKey struct{}
+
+// scope is the tenant of a context and its database once resolved
+type scope struct {
+	tenant string
+
+	mu sync.Mutex
+	db *gorm.DB
+}
+
+// With returns a context carrying the tenant. Its database is resolved by
+// the first DB call.
+func With(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &scope{tenant: tenant})
+}
+
+// WithDB returns a context carrying the tenant and its database, for entry
+// points that already hold it, such as the middleware
+func WithDB(ctx context.Context, tenant string, db *gorm.DB) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &scope{tenant: tenant, db: db})
+}
+
+// Tenant returns the tenant of the context, if any
+func Tenant(ctx context.Context) (string, bool) {
+	scope, ok := ctx.Value(scopeKey{}).(*scope)
+	if !ok {
+		return "", false
+	}
+	return scope.tenant, true
+}
+
+// DB returns the tenant's database bound to ctx. The first call resolves it
+// through the store and later calls reuse it, also with another store, for
+// the context returned by With and every context derived from it. Failures
+// are not remembered, so the next call asks the store again. Without a
+// tenant DB returns ErrNoTenant.
+func DB(ctx context.Context, store Store) (*gorm.DB, error) {
+	scope, ok := ctx.Value(scopeKey{}).(*scope)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+
+	if scope.db == nil {
+		db, err := store.GetTenantDB(ctx, scope.tenant)
+		if err != nil {
+			return nil, err
+		}
+		scope.db = db
+	}
+	return scope.db.WithContext(ctx), nil
+}
@@ -0,0 +1,101 @@
+package tenantctx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+// countingStore counts the tenant DB lookups and fails them with err
+type countingStore struct {
+	*tenanttest.Store
+	calls int
+	err   error
+}
+
+func (s *countingStore) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.Store.GetTenantDB(ctx, tenantSchema)
+}
+
+func TestAbsentTenant(t *testing.T) {
+	store := &countingStore{Store: tenanttest.NewStore(t)}
+	ctx := context.Background()
+
+	if tenant, ok := Tenant(ctx); ok || tenant != "" {
+		t.Fatalf("Expected no tenant, got %q", tenant)
+	}
+	if _, err := DB(ctx, store); !errors.Is(err, ErrNoTenant) {
+		t.Fatalf("Expected ErrNoTenant, got %v", err)
+	}
+	if store.calls != 0 {
+		t.Fatalf("Expected the store not to be asked, got %d calls", store.calls)
+	}
+}
+
+func TestPresentTenant(t *testing.T) {
+	store := &countingStore{Store: tenanttest.NewStore(t)}
+	ctx := With(context.Background(), "acme")
+
+	if tenant, ok := Tenant(ctx); !ok || tenant != "acme" {
+		t.Fatalf("Expected acme, got %q", tenant)
+	}
+	db, err := DB(ctx, store)
+	if err != nil {
+		t.Fatalf("Failed to get DB: %v", err)
+	}
+	if db.Statement.Context != ctx {
+		t.Fatal("Expected the DB to be bound to the context")
+	}
+
+	// Contexts from WithDB never ask the store
+	held, _ := store.Store.GetTenantDB(ctx, "globex")
+	ctx = WithDB(context.Background(), "globex", held)
+	if tenant, _ := Tenant(ctx); tenant != "globex" {
+		t.Fatalf("Expected globex, got %q", tenant)
+	}
+	if _, err := DB(ctx, store); err != nil || store.calls != 1 {
+		t.Fatalf("Expected the held DB, got %v after %d calls", err, store.calls)
+	}
+}
+
+func TestDBIsMemoized(t *testing.T) {
+	store := &countingStore{Store: tenanttest.NewStore(t)}
+	ctx := With(context.Background(), "acme")
+
+	// Failures are not remembered
+	store.err = errors.New("connection refused")
+	if _, err := DB(ctx, store); err == nil {
+		t.Fatal("Expected the store's error")
+	}
+	store.err = nil
+
+	first, err := DB(ctx, store)
+	if err != nil {
+		t.Fatalf("Failed to get DB: %v", err)
+	}
+	derived, cancel := context.WithCancel(ctx)
+	defer cancel()
+	second, err := DB(derived, store)
+	if err != nil {
+		t.Fatalf("Failed to get DB: %v", err)
+	}
+	if store.calls != 2 {
+		t.Fatalf("Expected 2 lookups, the failed one and the first success, got %d", store.calls)
+	}
+	if first.Statement.ConnPool != second.Statement.ConnPool || second.Statement.Context != derived {
+		t.Fatal("Expected the same DB bound to the derived context")
+	}
+
+	// Each With starts over
+	if _, err := DB(With(ctx, "acme"), store); err != nil || store.calls != 3 {
+		t.Fatalf("Expected a new lookup for a new context, got %v after %d calls", err, store.calls)
+	}
+}
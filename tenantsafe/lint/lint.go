@@ -0,0 +1,214 @@
+// Package lint reports master database access in tenant-scoped packages,
+// where handlers must use the tenant database of the request. A package is
+// tenant-scoped when one of its files carries the directive above its
+// package clause:
+//
+//	//tenantsafe:scoped
+//	package handlers
+//
+// Every call of a GetMasterDB method in the package's non-test files is then
+// reported, whatever store it is called on. Calls that are meant to reach
+// the master database, such as a tenant signup, are allowed with
+// //tenantsafe:ignore on the line of the call or the line above it.
+//
+// The checks only parse the source, so they need no build and run on code
+// that does not compile. Command tenantsafe-lint runs them on packages.
+package lint
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Directives read by the checks
+const (
+	ScopedDirective = "//tenantsafe:scoped"
+	IgnoreDirective = "//tenantsafe:ignore"
+)
+
+// masterMethod is the method reported in tenant-scoped packages
+const masterMethod = "GetMasterDB"
+
+// Diagnostic is a reported call
+type Diagnostic struct {
+	Pos     token.Position
+	Message string
+}
+
+// String formats the diagnostic like go vet, file:line:column: message
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+}
+
+// CheckFiles checks the files of one package and returns nothing unless
+// one of them marks it tenant-scoped
+func CheckFiles(fset *token.FileSet, files []*ast.File) []Diagnostic {
+	scoped := false
+	for _, file := range files {
+		if isScoped(file) {
+			scoped = true
+			break
+		}
+	}
+	if !scoped {
+		return nil
+	}
+
+	var diagnostics []Diagnostic
+	for _, file := range files {
+		ignored := ignoredLines(fset, file)
+		ast.Inspect(file, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			selector, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || selector.Sel.Name != masterMethod || len(call.Args) != 0 {
+				return true
+			}
+			pos := fset.Position(selector.Sel.Pos())
+			if ignored[pos.Line] {
+				return true
+			}
+			diagnostics = append(diagnostics, Diagnostic{
+				Pos:     pos,
+				Message: masterMethod + " called in a tenant-scoped package; use the tenant database of the request",
+			})
+			return true
+		})
+	}
+
+	sort.Slice(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Pos, diagnostics[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+	return diagnostics
+}
+
+// CheckDir parses the Go files of dir, test files excluded, and checks
+// them as one package
+func CheckDir(dir string) ([]Diagnostic, error) {
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, dir, func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", dir, err)
+	}
+
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var diagnostics []Diagnostic
+	for _, name := range names {
+		files := make([]*ast.File, 0, len(packages[name].Files))
+		for _, file := range packages[name].Files {
+			files = append(files, file)
+		}
+		diagnostics = append(diagnostics, CheckFiles(fset, files)...)
+	}
+	return diagnostics, nil
+}
+
+// Dirs expands patterns as the go command does for directories: "dir"
+// is the directory itself and "dir/..." every directory below it with Go
+// files, skipping testdata, vendor and hidden directories
+func Dirs(patterns []string) ([]string, error) {
+	var dirs []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, pattern := range patterns {
+		root, recursive := strings.CutSuffix(pattern, "...")
+		if !recursive {
+			add(filepath.Clean(pattern))
+			continue
+		}
+		root = filepath.Clean(strings.TrimSuffix(root, "/"))
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() {
+				return nil
+			}
+			name := entry.Name()
+			if path != root && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			if hasGoFiles(path) {
+				add(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+		}
+	}
+	return dirs, nil
+}
+
+// isScoped reports whether the file has the scoped directive above its
+// package clause
+func isScoped(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if strings.TrimSpace(comment.Text) == ScopedDirective {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ignoredLines returns the lines whose calls are not reported: those with
+// the ignore directive and the lines following it
+func ignoredLines(fset *token.FileSet, file *ast.File) map[int]bool {
+	lines := make(map[int]bool)
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			if strings.HasPrefix(comment.Text, IgnoreDirective) {
+				line := fset.Position(comment.Pos()).Line
+				lines[line] = true
+				lines[line+1] = true
+			}
+		}
+	}
+	return lines
+}
+
+// hasGoFiles reports whether dir holds Go files other than tests
+func hasGoFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			return true
+		}
+	}
+	return false
+}
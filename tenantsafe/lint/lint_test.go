@@ -0,0 +1,79 @@
+package lint
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// wantLines returns file:line of every line of the Go files in dir that
+// ends in a "// want" comment
+func wantLines(t *testing.T, dir string) []string {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatalf("Failed to list %s: %v", dir, err)
+	}
+	var lines []string
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", path, err)
+		}
+		scanner := bufio.NewScanner(file)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.HasSuffix(scanner.Text(), "// want") {
+				lines = append(lines, fmt.Sprintf("%s:%d", path, line))
+			}
+		}
+		file.Close()
+	}
+	return lines
+}
+
+func TestCheckDir(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  string
+	}{
+		{name: "Scoped package", dir: "scoped"},
+		{name: "Unscoped package", dir: "unscoped"},
+		{name: "Ignored calls", dir: "ignored"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join("testdata", tt.dir)
+			diagnostics, err := CheckDir(dir)
+			if err != nil {
+				t.Fatalf("Failed to check %s: %v", dir, err)
+			}
+
+			var got []string
+			for _, diagnostic := range diagnostics {
+				got = append(got, fmt.Sprintf("%s:%d", diagnostic.Pos.Filename, diagnostic.Pos.Line))
+				if !strings.Contains(diagnostic.String(), "GetMasterDB called in a tenant-scoped package") {
+					t.Fatalf("Expected the diagnostic to name the call, got %s", diagnostic)
+				}
+			}
+			if want := wantLines(t, dir); !reflect.DeepEqual(got, want) {
+				t.Fatalf("Expected diagnostics at %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestDirs(t *testing.T) {
+	dirs, err := Dirs([]string{"./...", "testdata/scoped"})
+	if err != nil {
+		t.Fatalf("Failed to expand: %v", err)
+	}
+	if want := []string{".", filepath.Join("testdata", "scoped")}; !reflect.DeepEqual(dirs, want) {
+		t.Fatalf("Expected %v, got %v", want, dirs)
+	}
+}
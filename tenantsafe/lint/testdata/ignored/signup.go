@@ -0,0 +1,18 @@
+//tenantsafe:scoped
+package signup
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+var store *tenantstore.TenantStore
+
+// Signup registers a tenant, which is a master DB operation
+func Signup(c *fiber.Ctx) error {
+	//tenantsafe:ignore signup creates the tenant in the registry
+	db := store.GetMasterDB()
+	store.GetMasterDB() //tenantsafe:ignore
+	return db.Error
+}
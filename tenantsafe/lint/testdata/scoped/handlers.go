@@ -0,0 +1,29 @@
+//tenantsafe:scoped
+
+// Package handlers is tenant-scoped: its handlers must use the tenant DB
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+type ResetToken struct {
+	ID    uint
+	Token string
+}
+
+var store *tenantstore.TenantStore
+
+// ResetPassword looks the token up in the master DB, across tenants
+func ResetPassword(c *fiber.Ctx) error {
+	var token ResetToken
+	return store.GetMasterDB().Where("token = ?", c.FormValue("token")).First(&token).Error // want
+}
+
+// Profile uses the tenant DB
+func Profile(c *fiber.Ctx) error {
+	return middleware.GetTenantDB(c).First(&ResetToken{}).Error
+}
@@ -0,0 +1,7 @@
+package handlers
+
+import "testing"
+
+func TestSetup(t *testing.T) {
+	store.GetMasterDB()
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import "github.com/gofiber/fiber/v2"
+
+// CountTenants reads the master DB through a getter
+func CountTenants(c *fiber.Ctx) error {
+	var count int64
+	master := store.GetMasterDB
+	_ = master
+	return store.
+		GetMasterDB(). // want
+		Table("tenants").
+		Count(&count).Error
+}
@@ -0,0 +1,16 @@
+// Package admin serves operators across tenants
+package admin
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+var store *tenantstore.TenantStore
+
+// Tenants lists every tenant from the master DB
+func Tenants(c *fiber.Ctx) error {
+	var tenants []tenantstore.Tenant
+	return store.GetMasterDB().Find(&tenants).Error
+}
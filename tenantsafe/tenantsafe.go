@@ -0,0 +1,111 @@
+// Package tenantsafe looks records up by a column on the tenant database of
+// the request, so lookups by values shared across tenants, such as reset
+// tokens or emails, cannot reach the master database by mistake. The
+// helpers take the request instead of a *gorm.DB and always use the DB the
+// middleware attached:
+//
+//	app.Post("/password/reset", func(c *fiber.Ctx) error {
+//		token, err := tenantsafe.FirstBy[ResetToken](c, "token", c.FormValue("token"))
+//		if errors.Is(err, gorm.ErrRecordNotFound) {
+//			return fiber.ErrNotFound
+//		}
+//		// ...
+//	})
+//
+// The columns must belong to the model, so they can come from the request.
+// Command tenantsafe-lint reports GetMasterDB calls in packages marked
+// tenant-scoped.
+package tenantsafe
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+)
+
+// ErrNoTenantDB is returned when the request has no tenant database, such
+// as on routes the middleware skips
+var ErrNoTenantDB = fiber.NewError(fiber.StatusInternalServerError, "No tenant database on the request")
+
+// ErrUnknownColumn is returned for columns the model does not have
+var ErrUnknownColumn = fiber.NewError(fiber.StatusBadRequest, "Unknown column")
+
+// FirstBy returns the first record of T whose column equals value, ordered
+// by primary key, or gorm.ErrRecordNotFound
+func FirstBy[T any](c *fiber.Ctx, column string, value interface{}) (*T, error) {
+	db, err := where[T](c, column, value)
+	if err != nil {
+		return nil, err
+	}
+	record := new(T)
+	if err := db.First(record).Error; err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// FindBy returns every record of T whose column equals value
+func FindBy[T any](c *fiber.Ctx, column string, value interface{}) ([]T, error) {
+	db, err := where[T](c, column, value)
+	if err != nil {
+		return nil, err
+	}
+	records := []T{}
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// CountBy counts the records of T whose column equals value
+func CountBy[T any](c *fiber.Ctx, column string, value interface{}) (int64, error) {
+	db, err := where[T](c, column, value)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if err := db.Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ExistsBy reports whether a record of T has column equal to value
+func ExistsBy[T any](c *fiber.Ctx, column string, value interface{}) (bool, error) {
+	count, err := CountBy[T](c, column, value)
+	return count > 0, err
+}
+
+// DeleteBy deletes the records of T whose column equals value, such as a
+// used token, and returns how many were deleted
+func DeleteBy[T any](c *fiber.Ctx, column string, value interface{}) (int64, error) {
+	db, err := where[T](c, column, value)
+	if err != nil {
+		return 0, err
+	}
+	result := db.Delete(new(T))
+	return result.RowsAffected, result.Error
+}
+
+// where returns a session of the request's tenant DB on T filtered by the
+// column, which must be a field of T
+func where[T any](c *fiber.Ctx, column string, value interface{}) (*gorm.DB, error) {
+	db := middleware.GetTenantDB(c)
+	if db == nil {
+		return nil, ErrNoTenantDB
+	}
+
+	db = db.WithContext(c.UserContext()).Model(new(T))
+	if err := db.Statement.Parse(new(T)); err != nil {
+		return nil, fmt.Errorf("failed to parse model: %w", err)
+	}
+	field := db.Statement.Schema.LookUpField(column)
+	if field == nil || field.DBName == "" {
+		return nil, fmt.Errorf("%w %q of %s", ErrUnknownColumn, column, db.Statement.Schema.Name)
+	}
+	return db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: value}), nil
+}
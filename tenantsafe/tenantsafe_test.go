@@ -0,0 +1,121 @@
+package tenantsafe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+// ResetToken is looked up by its value, which may exist in several tenants
+type ResetToken struct {
+	ID     uint `gorm:"primaryKey"`
+	Token  string
+	UserID uint
+}
+
+func newApp(t *testing.T) *fiber.App {
+	t.Helper()
+
+	store := tenanttest.NewStore(t, &ResetToken{})
+	tenanttest.Seed(store, "acme", &ResetToken{Token: "shared", UserID: 1}, &ResetToken{Token: "acme-only", UserID: 2})
+	tenanttest.Seed(store, "globex", &ResetToken{Token: "shared", UserID: 7})
+	store.GetMasterDB().AutoMigrate(&ResetToken{})
+	store.GetMasterDB().Create(&ResetToken{Token: "acme-only", UserID: 99})
+
+	app := fiber.New()
+	app.Get("/unscoped", func(c *fiber.Ctx) error {
+		_, err := FirstBy[ResetToken](c, "token", "shared")
+		return err
+	})
+	app.Use(middleware.New(middleware.Config{
+		Store:    store,
+		Resolver: middleware.HeaderResolver(tenanttest.TenantHeader),
+	}))
+	app.Get("/tokens/:column/:value", func(c *fiber.Ctx) error {
+		column, value := c.Params("column"), c.Params("value")
+		token, err := FirstBy[ResetToken](c, column, value)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		tokens, err := FindBy[ResetToken](c, column, value)
+		if err != nil {
+			return err
+		}
+		exists, err := ExistsBy[ResetToken](c, column, value)
+		if err != nil {
+			return err
+		}
+		return c.SendString(fmt.Sprintf("%d %d %t", token.UserID, len(tokens), exists))
+	})
+	app.Delete("/tokens/:value", func(c *fiber.Ctx) error {
+		deleted, err := DeleteBy[ResetToken](c, "token", c.Params("value"))
+		if err != nil {
+			return err
+		}
+		count, err := CountBy[ResetToken](c, "token", c.Params("value"))
+		if err != nil {
+			return err
+		}
+		return c.SendString(fmt.Sprintf("%d %d", deleted, count))
+	})
+	return app
+}
+
+func TestLookupsUseTheTenantDB(t *testing.T) {
+	app := newApp(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		tenant     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "Own token", method: "GET", tenant: "acme", path: "/tokens/token/shared", wantStatus: fiber.StatusOK, wantBody: "1 1 true"},
+		{name: "Same token in another tenant", method: "GET", tenant: "globex", path: "/tokens/token/shared", wantStatus: fiber.StatusOK, wantBody: "7 1 true"},
+		{name: "Token of another tenant", method: "GET", tenant: "globex", path: "/tokens/token/acme-only", wantStatus: fiber.StatusNotFound},
+		{name: "Field name", method: "GET", tenant: "acme", path: "/tokens/UserID/2", wantStatus: fiber.StatusOK, wantBody: "2 1 true"},
+		{name: "Unknown column", method: "GET", tenant: "acme", path: "/tokens/password/x", wantStatus: fiber.StatusBadRequest},
+		{name: "Delete", method: "DELETE", tenant: "acme", path: "/tokens/shared", wantStatus: fiber.StatusOK, wantBody: "1 0"},
+		{name: "Delete leaves other tenants", method: "GET", tenant: "globex", path: "/tokens/token/shared", wantStatus: fiber.StatusOK, wantBody: "7 1 true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tenanttest.Request(app, tt.method, tt.path, tenanttest.WithTenantHeader(tt.tenant))
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected %d, got %d %q", tt.wantStatus, resp.StatusCode, body)
+			}
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Fatalf("Expected %q, got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestLookupWithoutTenantDB(t *testing.T) {
+	app := newApp(t)
+
+	resp, err := tenanttest.Request(app, "GET", "/unscoped")
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Fatalf("Expected ErrNoTenantDB to fail the request, got %d", resp.StatusCode)
+	}
+}
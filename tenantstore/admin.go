@@ -0,0 +1,452 @@
+package tenantstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MigrateReport summarizes a MigrateAll run
+type MigrateReport struct {
+	Migrated []string      `json:"migrated"`
+	Failed   TenantErrors  `json:"-"`
+	Duration time.Duration `json:"duration"`
+
+	// Plan lists the planned changes of a dry run
+	Plan *Plan `json:"plan,omitempty"`
+}
+
+// Err returns the per-tenant failures, or nil if every tenant migrated
+func (r *MigrateReport) Err() error {
+	if len(r.Failed) > 0 {
+		return r.Failed
+	}
+	return nil
+}
+
+// TenantStats describes a tenant schema
+type TenantStats struct {
+	Schema    string `json:"schema"`
+	Tables    int    `json:"tables"`
+	SizeBytes int64  `json:"size_bytes"`
+	Connected bool   `json:"connected"`
+
+	// Settings are the Config.SessionSettings of the cached connection
+	Settings map[string]string `gorm:"-" json:"settings,omitempty"`
+
+	// LongTransactions counts the watchdog's findings in its last check
+	LongTransactions int `gorm:"-" json:"long_transactions,omitempty"`
+
+	// Pinned is set for tenants pinned with PinnedTenants or PinTenant
+	Pinned bool `gorm:"-" json:"pinned,omitempty"`
+
+	// ReadRetries counts reads retried under Config.RetryReads
+	ReadRetries int64 `gorm:"-" json:"read_retries,omitempty"`
+}
+
+// MigrateTenant creates the tenant schema if needed, migrates Config.Models
+// and ModelGroups regardless of Config.AutoMigrate, adds SearchIndexes and
+// recreates TenantViews. It applies migrations GetTenantDB refuses with
+// ErrMigrationPending.
+// The migration connection from GetMigrationDSN is used when configured.
+func (s *TenantStore) MigrateTenant(ctx context.Context, tenantSchema string) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+	if err := s.migrateTenant(context.WithValue(ctx, explicitMigrationKey{}, true), tenantSchema); err != nil {
+		return err
+	}
+	s.migrated(tenantSchema)
+	return nil
+}
+
+func (s *TenantStore) migrateTenant(ctx context.Context, tenantSchema string) error {
+	groups, err := s.tenantModelGroups(ctx, tenantSchema)
+	if err != nil {
+		return err
+	}
+
+	if s.config().GetMigrationDSN != nil {
+		if err := s.checkProvision(ctx, s.master(), tenantSchema); err != nil {
+			return err
+		}
+		return s.migrateWithMigrationDSN(ctx, tenantSchema, groups)
+	}
+
+	db, err := s.tenantDB(ctx, tenantSchema)
+	if err != nil {
+		return err
+	}
+
+	if len(groups) > 0 {
+		if err := s.autoMigrate(ctx, db, tenantSchema, groups); err != nil {
+			return err
+		}
+		if err := s.afterAutoMigrate(ctx, db, tenantSchema); err != nil {
+			return err
+		}
+	}
+
+	if err := s.createViews(ctx, db, tenantSchema); err != nil {
+		return err
+	}
+	return s.createMaterializedViews(ctx, db, tenantSchema)
+}
+
+// MigrateModels migrates only the given models in an existing tenant schema,
+// for example a model added in a hotfix, and then reapplies the setup that
+// depends on tables: search indexes, the ID strategy and cross-schema
+// foreign keys. Models are migrated in the order given, with their
+// MigrationHook, and TenantViews are left alone.
+func (s *TenantStore) MigrateModels(ctx context.Context, tenantSchema string, models ...interface{}) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+	if _, err := s.schemaTables(ctx, tenantSchema); err != nil {
+		return err
+	}
+
+	// One group per model keeps the caller's order
+	groups := make([][]interface{}, len(models))
+	for i, model := range models {
+		groups[i] = []interface{}{model}
+	}
+
+	migrate := func(db *gorm.DB) error {
+		if err := s.autoMigrate(ctx, db, tenantSchema, groups); err != nil {
+			return err
+		}
+		return s.afterAutoMigrate(ctx, db, tenantSchema)
+	}
+
+	if s.config().GetMigrationDSN != nil {
+		migrationDB, err := s.openMigrationDB(tenantSchema)
+		if err != nil {
+			return err
+		}
+		defer closeDB(migrationDB)
+
+		return migrate(migrationDB)
+	}
+
+	db, err := s.tenantDB(ctx, tenantSchema)
+	if err != nil {
+		return err
+	}
+	return migrate(db)
+}
+
+// MigrateOptions controls MigrateAll
+type MigrateOptions struct {
+	ForEachOptions
+
+	// DryRun returns the planned changes in MigrateReport.Plan without
+	// migrating or connecting to any tenant
+	DryRun bool
+}
+
+// MigrateAll runs MigrateTenant for every schema returned by ListSchemas. The
+// report lists migrated and failed tenants; an error is only returned when
+// the schemas cannot be listed.
+func (s *TenantStore) MigrateAll(ctx context.Context, opts MigrateOptions) (*MigrateReport, error) {
+	start := time.Now()
+
+	schemas, err := s.ListSchemas(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MigrateReport{Failed: TenantErrors{}}
+	if opts.DryRun {
+		report.Plan = &Plan{Operation: "migrate", DryRun: true, Steps: []PlanStep{}}
+	}
+	var mu sync.Mutex
+
+	err = forEachSchema(ctx, schemas, func(ctx context.Context, tenantSchema string) error {
+		if opts.DryRun {
+			plan, err := s.PlanMigration(ctx, tenantSchema)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			report.Plan.Steps = append(report.Plan.Steps, plan.Steps...)
+			mu.Unlock()
+			return nil
+		}
+
+		if err := s.MigrateTenant(ctx, tenantSchema); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		report.Migrated = append(report.Migrated, tenantSchema)
+		mu.Unlock()
+		return nil
+	}, opts.ForEachOptions)
+
+	if failures, ok := err.(TenantErrors); ok {
+		report.Failed = failures
+	} else if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(report.Migrated)
+	if report.Plan != nil {
+		report.Plan.sort()
+	}
+	report.Duration = time.Since(start)
+
+	return report, nil
+}
+
+// DropOptions controls DropTenant
+type DropOptions struct {
+	// Cascade drops every object in the schema. Without it the drop fails
+	// if the schema still contains objects.
+	Cascade bool
+
+	// DryRun validates the drop and returns the plan without executing it
+	DryRun bool
+}
+
+// DropTenant closes the tenant's cached connection and drops its schema. It
+// returns the executed plan, or with DryRun the plan that would run. Schemas
+// of another Config.Environment are refused.
+func (s *TenantStore) DropTenant(ctx context.Context, tenantSchema string, opts DropOptions) (*Plan, error) {
+	if tenantSchema == "" {
+		return nil, fmt.Errorf("tenant schema cannot be empty")
+	}
+	if isReservedSchema(tenantSchema) {
+		return nil, fmt.Errorf("refusing to drop reserved schema %s", tenantSchema)
+	}
+	if err := s.checkEnvironment("drop", tenantSchema); err != nil {
+		return nil, err
+	}
+
+	tables, err := s.schemaTables(ctx, tenantSchema)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) > 0 && !opts.Cascade {
+		return nil, fmt.Errorf("schema %s contains %d table(s); drop it with cascade", tenantSchema, len(tables))
+	}
+
+	dropSchemaSQL := fmt.Sprintf("DROP SCHEMA %s", quoteIdentifier(tenantSchema))
+	if opts.Cascade {
+		dropSchemaSQL += " CASCADE"
+	}
+
+	plan := &Plan{Operation: "drop", DryRun: opts.DryRun}
+	s.mu.RLock()
+	_, connected := s.tenantDBs[tenantSchema]
+	s.mu.RUnlock()
+	if connected {
+		plan.add(tenantSchema, "close connection", "")
+	}
+	for _, table := range tables {
+		plan.add(tenantSchema, "drop table "+table, "")
+	}
+	plan.add(tenantSchema, "drop schema", dropSchemaSQL)
+
+	if opts.DryRun {
+		return plan, nil
+	}
+
+	if err := s.RemoveTenantDB(tenantSchema); err != nil {
+		return nil, err
+	}
+
+	if err := s.master().WithContext(ctx).Exec(dropSchemaSQL).Error; err != nil {
+		return nil, fmt.Errorf("failed to drop schema %s: %w", tenantSchema, err)
+	}
+	s.UnpinTenant(tenantSchema)
+
+	s.emit(ctx, EventSchemaDropped, tenantSchema)
+	return plan, nil
+}
+
+// TruncateOptions controls TruncateTenant
+type TruncateOptions struct {
+	// RestartIdentity resets the sequences owned by the truncated tables
+	RestartIdentity bool
+
+	// DryRun returns the plan without executing it
+	DryRun bool
+}
+
+// TruncateTenant deletes every row of every table in the tenant schema while
+// keeping the tables. It returns the executed plan, or with DryRun the plan
+// that would run.
+func (s *TenantStore) TruncateTenant(ctx context.Context, tenantSchema string, opts TruncateOptions) (*Plan, error) {
+	if tenantSchema == "" {
+		return nil, fmt.Errorf("tenant schema cannot be empty")
+	}
+	if isReservedSchema(tenantSchema) {
+		return nil, fmt.Errorf("refusing to truncate reserved schema %s", tenantSchema)
+	}
+	if err := s.checkEnvironment("truncate", tenantSchema); err != nil {
+		return nil, err
+	}
+
+	tables, err := s.schemaTables(ctx, tenantSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Operation: "truncate", DryRun: opts.DryRun, Steps: []PlanStep{}}
+	if len(tables) == 0 {
+		return plan, nil
+	}
+
+	qualified := make([]string, len(tables))
+	for i, table := range tables {
+		qualified[i] = quoteIdentifier(tenantSchema) + "." + quoteIdentifier(table)
+	}
+	truncateSQL := "TRUNCATE TABLE " + strings.Join(qualified, ", ")
+	if opts.RestartIdentity {
+		truncateSQL += " RESTART IDENTITY"
+	}
+	plan.add(tenantSchema, fmt.Sprintf("truncate %d table(s)", len(tables)), truncateSQL)
+
+	if opts.DryRun {
+		return plan, nil
+	}
+
+	if err := s.master().WithContext(ctx).Exec(truncateSQL).Error; err != nil {
+		return nil, fmt.Errorf("failed to truncate %s: %w", tenantSchema, err)
+	}
+	return plan, nil
+}
+
+// Stats returns table counts and on-disk sizes for every tenant schema of
+// Config.Environment, whether the store currently holds a connection for
+// it, the session settings applied to that connection and its long
+// transactions
+func (s *TenantStore) Stats(ctx context.Context) ([]TenantStats, error) {
+	var stats []TenantStats
+	err := s.master().WithContext(ctx).Raw(`
+		SELECT n.nspname AS schema,
+			COUNT(c.oid) FILTER (WHERE c.relkind IN ('r', 'p')) AS tables,
+			COALESCE(SUM(pg_total_relation_size(c.oid)) FILTER (WHERE c.relkind IN ('r', 'p', 'm')), 0) AS size_bytes
+		FROM pg_namespace n
+		LEFT JOIN pg_class c ON c.relnamespace = n.oid
+		WHERE n.nspname NOT IN ('public', 'information_schema')
+		AND n.nspname NOT LIKE 'pg\_%'
+		GROUP BY n.nspname
+		ORDER BY n.nspname`).Scan(&stats).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect tenant stats: %w", err)
+	}
+
+	inEnvironment := stats[:0]
+	for _, stat := range stats {
+		if s.inEnvironment(stat.Schema) {
+			inEnvironment = append(inEnvironment, stat)
+		}
+	}
+	stats = inEnvironment
+
+	s.mu.RLock()
+	for i := range stats {
+		_, stats[i].Connected = s.tenantDBs[stats[i].Schema]
+		stats[i].Settings = s.sessionSettings[stats[i].Schema]
+		stats[i].Pinned = s.pinned[stats[i].Schema]
+	}
+	s.mu.RUnlock()
+
+	retries := s.ReadRetries()
+	for i := range stats {
+		stats[i].ReadRetries = retries[stats[i].Schema]
+	}
+
+	for _, tx := range s.longTransactions() {
+		for i := range stats {
+			if stats[i].Schema == tx.Schema {
+				stats[i].LongTransactions++
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// ConnectionStats returns the pool stats of every cached tenant connection,
+// by schema. Unlike Stats it does not query the database, so it is cheap to
+// call often, such as from middleware.DashboardHandler.
+func (s *TenantStore) ConnectionStats() map[string]sql.DBStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make(map[string]sql.DBStats, len(s.tenantDBs))
+	for tenantSchema, db := range s.tenantDBs {
+		if sqlDB, err := db.DB(); err == nil {
+			stats[tenantSchema] = sqlDB.Stats()
+		}
+	}
+	return stats
+}
+
+// RowCounts returns the number of rows in every table of the tenant schema,
+// keyed by table name. Like ExportTenant it reads through the master
+// connection.
+func (s *TenantStore) RowCounts(ctx context.Context, tenantSchema string) (map[string]int64, error) {
+	db := s.master().WithContext(ctx)
+
+	tables, err := s.schemaTables(ctx, tenantSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		var count int64
+		if err := db.Table(quoteIdentifier(tenantSchema) + "." + quoteIdentifier(table)).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to count %s.%s: %w", tenantSchema, table, err)
+		}
+		counts[table] = count
+	}
+
+	return counts, nil
+}
+
+// ExportTenant returns every row of every table in the tenant schema, keyed
+// by table name. It reads through the master connection and does not create
+// the schema if it is missing.
+func (s *TenantStore) ExportTenant(ctx context.Context, tenantSchema string) (map[string][]map[string]interface{}, error) {
+	db := s.master().WithContext(ctx)
+
+	tables, err := s.schemaTables(ctx, tenantSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	export := make(map[string][]map[string]interface{}, len(tables))
+	for _, table := range tables {
+		rows := []map[string]interface{}{}
+		if err := db.Table(quoteIdentifier(tenantSchema) + "." + quoteIdentifier(table)).Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to export %s.%s: %w", tenantSchema, table, err)
+		}
+		export[table] = rows
+	}
+
+	return export, nil
+}
+
+// isReservedSchema reports whether the schema belongs to PostgreSQL or is the
+// shared public schema
+func isReservedSchema(schema string) bool {
+	schema = strings.ToLower(schema)
+	return schema == "public" || schema == "information_schema" || strings.HasPrefix(schema, "pg_")
+}
+
+// quoteIdentifier quotes a catalog name for use in SQL
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
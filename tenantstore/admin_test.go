@@ -0,0 +1,128 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// attachInformationSchema stands in for Postgres' information_schema on the
+// SQLite master of store, listing the given schemas without tables. The
+// master keeps a single connection, since attached databases belong to the
+// connection.
+func attachInformationSchema(t *testing.T, store *TenantStore, schemas ...string) {
+	t.Helper()
+
+	sqlDB, err := store.masterDB.DB()
+	if err != nil {
+		t.Fatalf("Failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	for _, stmt := range []string{
+		fmt.Sprintf("ATTACH DATABASE 'file:%s_information_schema?mode=memory&cache=shared' AS information_schema", t.Name()),
+		"CREATE TABLE information_schema.schemata (schema_name TEXT)",
+		"CREATE TABLE information_schema.tables (table_schema TEXT, table_name TEXT, table_type TEXT)",
+	} {
+		if err := store.masterDB.Exec(stmt).Error; err != nil {
+			t.Fatalf("Failed to prepare information_schema: %v", err)
+		}
+	}
+	for _, schema := range schemas {
+		if err := store.masterDB.Exec("INSERT INTO information_schema.schemata VALUES (?)", schema).Error; err != nil {
+			t.Fatalf("Failed to add schema: %v", err)
+		}
+	}
+}
+
+func TestMigrateAllAndDropTenant(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.AutoMigrate = false
+	config.Models = []interface{}{&TestModel{}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for _, schema := range []string{"tenant_a", "tenant_b"} {
+		if _, err := store.GetTenantDB(ctx, schema); err != nil {
+			t.Fatalf("Failed to create %s: %v", schema, err)
+		}
+	}
+
+	report, err := store.MigrateAll(ctx, MigrateOptions{ForEachOptions: ForEachOptions{Concurrency: 2, ContinueOnError: true}})
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	if report.Err() != nil || len(report.Migrated) != 2 {
+		t.Fatalf("Expected both tenants migrated, got %+v", report)
+	}
+
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if len(stats) != 2 || stats[0].Tables != 1 || !stats[0].Connected {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+
+	store.GetMasterDB().Exec("INSERT INTO tenant_a.test_models (name) VALUES ('exported')")
+
+	export, err := store.ExportTenant(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	if rows := export["test_models"]; len(rows) != 1 || rows[0]["name"] != "exported" {
+		t.Fatalf("Unexpected export: %v", export)
+	}
+
+	if _, err := store.DropTenant(ctx, "tenant_a", DropOptions{}); err == nil {
+		t.Fatal("Expected drop without cascade to fail for a non-empty schema")
+	}
+
+	if _, err := store.DropTenant(ctx, "tenant_a", DropOptions{Cascade: true}); err != nil {
+		t.Fatalf("Failed to drop tenant: %v", err)
+	}
+
+	schemas, _ := store.ListSchemas(ctx)
+	if len(schemas) != 1 || schemas[0] != "tenant_b" {
+		t.Fatalf("Expected only tenant_b to remain, got %v", schemas)
+	}
+
+	if _, err := store.DropTenant(ctx, "public", DropOptions{Cascade: true}); err == nil {
+		t.Fatal("Expected error when dropping the public schema")
+	}
+}
+
+func TestConnectionStats(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "connection_stats")
+	store.tenantDBs["acme"] = store.masterDB
+
+	stats := store.ConnectionStats()
+	if len(stats) != 1 {
+		t.Fatalf("Expected stats for one pool, got %v", stats)
+	}
+	if _, ok := stats["acme"]; !ok {
+		t.Fatalf("Expected stats keyed by schema, got %v", stats)
+	}
+}
+
+func TestDropTenantQuotesSchema(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "drop_quoted")
+	tenantSchema := `acme"; DROP SCHEMA public; --`
+	attachInformationSchema(t, store, tenantSchema)
+
+	plan, err := store.DropTenant(context.Background(), tenantSchema, DropOptions{Cascade: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to plan the drop: %v", err)
+	}
+	want := `DROP SCHEMA "acme""; DROP SCHEMA public; --" CASCADE`
+	if last := plan.Steps[len(plan.Steps)-1]; last.SQL != want {
+		t.Fatalf("Expected %s, got %s", want, last.SQL)
+	}
+}
@@ -0,0 +1,297 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultBatchConcurrency is the number of tenants CreateTenants provisions
+// at once when BatchOptions.Concurrency is not set
+const DefaultBatchConcurrency = 4
+
+// ErrInvalidBatch is returned by CreateTenants for invalid specs
+var ErrInvalidBatch = errors.New("invalid batch")
+
+// Outcomes of a TenantSpec in a BatchReport
+const (
+	BatchCreated = "created"
+	BatchFailed  = "failed"
+	BatchSkipped = "skipped"
+)
+
+// TenantSpec describes a tenant to create with CreateTenants
+type TenantSpec struct {
+	Schema string `json:"schema"`
+
+	// Name, Plan, Settings and Domains fill the registry record when
+	// Config.EnableRegistry is set. Name defaults to the schema.
+	Name     string         `json:"name,omitempty"`
+	Plan     string         `json:"plan,omitempty"`
+	Settings TenantSettings `json:"settings,omitempty"`
+	Domains  []string       `json:"domains,omitempty"`
+
+	// Seed records are inserted after migration, as with SeedFixtures
+	Seed []interface{} `json:"-"`
+}
+
+// BatchOptions controls CreateTenants
+type BatchOptions struct {
+	// Concurrency is the number of tenants provisioned at once (defaults to
+	// DefaultBatchConcurrency)
+	Concurrency int
+
+	// StopOnError stops starting new tenants after the first failure; the
+	// remaining ones are reported as skipped
+	StopOnError bool
+
+	// SkipProvisionGuards bypasses MaxTenants and ProvisionRateLimit, like
+	// AdoptTenant, for operator imports
+	SkipProvisionGuards bool
+}
+
+// BatchResult is the outcome of one TenantSpec
+type BatchResult struct {
+	Schema string `json:"schema"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	err error
+}
+
+// BatchReport lists the outcome of every spec of a CreateTenants call, in
+// the order of the specs
+type BatchReport struct {
+	Results  []BatchResult `json:"results"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Err returns the per-tenant failures, or nil if no tenant failed
+func (r BatchReport) Err() error {
+	failures := TenantErrors{}
+	for _, result := range r.Results {
+		if result.Status == BatchFailed {
+			failures[result.Schema] = result.err
+		}
+	}
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+// Count returns the number of results with the status
+func (r BatchReport) Count(status string) int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// CreateTenants provisions new tenants concurrently. Each is created
+// atomically: its schema is created and migrated, its registry record added
+// when the registry is enabled, and its Seed inserted, and on any failure
+// the schema and record are removed again. Specs whose schema or registry
+// record already exists fail without touching them.
+//
+// Failures are reported per spec in the BatchReport without aborting the
+// batch, unless StopOnError is set. An error is only returned when the specs
+// are invalid, before anything changes, or when ctx ends.
+func (s *TenantStore) CreateTenants(ctx context.Context, specs []TenantSpec, opts BatchOptions) (BatchReport, error) {
+	return s.createTenants(ctx, specs, opts, s.createTenant)
+}
+
+// createTenants runs create for every spec with the semantics of
+// CreateTenants
+func (s *TenantStore) createTenants(ctx context.Context, specs []TenantSpec, opts BatchOptions, create func(ctx context.Context, spec TenantSpec, opts BatchOptions) error) (BatchReport, error) {
+	start := time.Now()
+	report := BatchReport{Results: make([]BatchResult, len(specs))}
+
+	bySchema := make(map[string]int, len(specs))
+	for i, spec := range specs {
+		where := fmt.Sprintf("specs[%d]", i)
+		if spec.Schema != "" {
+			where += " (" + spec.Schema + ")"
+		}
+
+		if err := validateSchemaName(spec.Schema); err != nil {
+			return report, fmt.Errorf("%w: %s: %w", ErrInvalidBatch, where, err)
+		}
+		if s.isMasterSchema(spec.Schema) {
+			return report, fmt.Errorf("%w: %s: schema is reserved", ErrInvalidBatch, where)
+		}
+		if first, ok := bySchema[spec.Schema]; ok {
+			return report, fmt.Errorf("%w: %s: schema is already listed at specs[%d]", ErrInvalidBatch, where, first)
+		}
+		bySchema[spec.Schema] = i
+		report.Results[i] = BatchResult{Schema: spec.Schema, Status: BatchSkipped}
+	}
+
+	schemas := make([]string, len(specs))
+	for i, spec := range specs {
+		schemas[i] = spec.Schema
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	var mu sync.Mutex
+	err := forEachSchema(ctx, schemas, func(ctx context.Context, tenantSchema string) error {
+		i := bySchema[tenantSchema]
+		err := create(ctx, specs[i], opts)
+
+		mu.Lock()
+		if err != nil {
+			report.Results[i] = BatchResult{Schema: tenantSchema, Status: BatchFailed, Error: err.Error(), err: err}
+		} else {
+			report.Results[i].Status = BatchCreated
+		}
+		mu.Unlock()
+		return err
+	}, ForEachOptions{Concurrency: concurrency, ContinueOnError: !opts.StopOnError})
+
+	report.Duration = time.Since(start)
+	if _, ok := err.(TenantErrors); ok || err == nil {
+		return report, nil
+	}
+	return report, err
+}
+
+// createTenant provisions one tenant and undoes its steps on failure
+func (s *TenantStore) createTenant(ctx context.Context, spec TenantSpec, opts BatchOptions) (err error) {
+	if _, err := s.schemaTables(ctx, spec.Schema); err == nil {
+		return fmt.Errorf("schema %s already exists", spec.Schema)
+	} else if !errors.Is(err, ErrSchemaNotFound) {
+		return err
+	}
+	if s.config().EnableRegistry {
+		var count int64
+		if err := s.master().WithContext(ctx).Unscoped().Model(&Tenant{}).Where("schema = ?", spec.Schema).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to look up tenant %s: %w", spec.Schema, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("tenant %s is already registered", spec.Schema)
+		}
+	}
+
+	registered := false
+	defer func() {
+		if err != nil {
+			// Undo even when the batch was cancelled
+			err = errors.Join(err, s.undoCreateTenant(context.WithoutCancel(ctx), spec.Schema, registered))
+		}
+	}()
+
+	migrateCtx := ctx
+	if opts.SkipProvisionGuards {
+		migrateCtx = context.WithValue(ctx, skipProvisionGuardsKey{}, true)
+	}
+	if err := s.MigrateTenant(migrateCtx, spec.Schema); err != nil {
+		return err
+	}
+
+	if s.config().EnableRegistry {
+		name := spec.Name
+		if name == "" {
+			name = spec.Schema
+		}
+		err := s.RegisterTenant(ctx, &Tenant{
+			Schema:   spec.Schema,
+			Name:     name,
+			Plan:     spec.Plan,
+			Active:   true,
+			Settings: spec.Settings,
+			Domains:  spec.Domains,
+		})
+		if err != nil {
+			return err
+		}
+		registered = true
+	}
+
+	if len(spec.Seed) > 0 {
+		if err := s.seedTenant(ctx, spec.Schema, spec.Seed); err != nil {
+			return fmt.Errorf("failed to seed %s: %w", spec.Schema, err)
+		}
+	}
+	return nil
+}
+
+// undoCreateTenant removes what createTenant made of a tenant
+func (s *TenantStore) undoCreateTenant(ctx context.Context, tenantSchema string, registered bool) error {
+	var errs []error
+	if registered {
+		err := s.master().WithContext(ctx).Unscoped().Where("schema = ?", tenantSchema).Delete(&Tenant{}).Error
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to unregister %s: %w", tenantSchema, err))
+		}
+		s.registry.delete(tenantSchema)
+	}
+
+	_, err := s.DropTenant(ctx, tenantSchema, DropOptions{Cascade: true})
+	if err != nil && !errors.Is(err, ErrSchemaNotFound) {
+		errs = append(errs, fmt.Errorf("failed to roll back %s: %w", tenantSchema, err))
+	}
+	return errors.Join(errs...)
+}
+
+// batchDocument is the document read by ReadTenantSpecs
+type batchDocument struct {
+	Tenants []struct {
+		Schema   string         `yaml:"schema"`
+		Name     string         `yaml:"name"`
+		Plan     string         `yaml:"plan"`
+		Settings TenantSettings `yaml:"settings"`
+		Domains  []string       `yaml:"domains"`
+		Seed     yaml.Node      `yaml:"seed"`
+	} `yaml:"tenants"`
+}
+
+// ReadTenantSpecs parses tenants for CreateTenants from YAML or JSON in the
+// format of a manifest's tenants, without active:
+//
+//	tenants:
+//	  - schema: acme
+//	    name: Acme Corp
+//	    plan: pro
+//	    seed:
+//	      users:
+//	        - id: 1
+//	          name: Alice
+func ReadTenantSpecs(r io.Reader) ([]TenantSpec, error) {
+	var doc batchDocument
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse tenants: %w", err)
+	}
+
+	specs := make([]TenantSpec, len(doc.Tenants))
+	for i, entry := range doc.Tenants {
+		specs[i] = TenantSpec{
+			Schema:   entry.Schema,
+			Name:     entry.Name,
+			Plan:     entry.Plan,
+			Settings: entry.Settings,
+			Domains:  entry.Domains,
+		}
+		if entry.Seed.Kind != 0 {
+			records, err := fixturesFromNode(&entry.Seed, fmt.Sprintf("tenants[%d] seed", i))
+			if err != nil {
+				return nil, err
+			}
+			specs[i].Seed = records
+		}
+	}
+	return specs, nil
+}
@@ -0,0 +1,171 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCreateTenantsReportsEachSpec(t *testing.T) {
+	store := withConfig(&TenantStore{}, DefaultConfig(""))
+	specs := []TenantSpec{{Schema: "batch_a"}, {Schema: "batch_b"}, {Schema: "batch_bad"}, {Schema: "batch_c"}, {Schema: "batch_d"}}
+	errBad := errors.New("seed failed")
+
+	var (
+		mu      sync.Mutex
+		created []string
+	)
+	create := func(ctx context.Context, spec TenantSpec, opts BatchOptions) error {
+		if spec.Schema == "batch_bad" {
+			return errBad
+		}
+		mu.Lock()
+		created = append(created, spec.Schema)
+		mu.Unlock()
+		return nil
+	}
+
+	report, err := store.createTenants(context.Background(), specs, BatchOptions{Concurrency: 2}, create)
+	if err != nil {
+		t.Fatalf("Expected per-spec failures only, got %v", err)
+	}
+	if len(created) != 4 || report.Count(BatchCreated) != 4 || report.Count(BatchFailed) != 1 {
+		t.Fatalf("Expected 4 created and 1 failed, got %+v", report.Results)
+	}
+	for i, result := range report.Results {
+		if result.Schema != specs[i].Schema {
+			t.Fatalf("Expected results in spec order, got %+v", report.Results)
+		}
+	}
+	if bad := report.Results[2]; bad.Status != BatchFailed || bad.Error != "seed failed" {
+		t.Fatalf("Expected batch_bad to fail, got %+v", bad)
+	}
+	if !errors.Is(report.Err(), errBad) {
+		t.Fatalf("Expected report error to wrap the failure, got %v", report.Err())
+	}
+
+	// Fail-fast leaves the specs after the failure alone
+	created = nil
+	report, err = store.createTenants(context.Background(), specs, BatchOptions{Concurrency: 1, StopOnError: true}, create)
+	if err != nil {
+		t.Fatalf("Expected per-spec failures only, got %v", err)
+	}
+	if strings.Join(created, ",") != "batch_a,batch_b" {
+		t.Fatalf("Expected only the specs before the failure created, got %v", created)
+	}
+	if report.Count(BatchSkipped) != 2 || report.Results[3].Status != BatchSkipped {
+		t.Fatalf("Expected the last 2 specs skipped, got %+v", report.Results)
+	}
+}
+
+func TestCreateTenantsValidatesSpecs(t *testing.T) {
+	store := withConfig(&TenantStore{}, DefaultConfig(""))
+	create := func(ctx context.Context, spec TenantSpec, opts BatchOptions) error {
+		t.Fatalf("Expected nothing to be created, got %s", spec.Schema)
+		return nil
+	}
+
+	for _, specs := range [][]TenantSpec{
+		{{Schema: "ok"}, {Schema: ""}},
+		{{Schema: "ok"}, {Schema: "public"}},
+		{{Schema: "ok"}, {Schema: "ok"}},
+	} {
+		if _, err := store.createTenants(context.Background(), specs, BatchOptions{}, create); err == nil || !strings.Contains(err.Error(), "specs[1]") {
+			t.Fatalf("Expected specs[1] to be rejected, got %v", err)
+		}
+	}
+}
+
+func TestReadTenantSpecs(t *testing.T) {
+	specs, err := ReadTenantSpecs(strings.NewReader(`
+tenants:
+  - schema: acme
+    name: Acme Corp
+    plan: pro
+    settings:
+      timezone: Europe/Berlin
+    seed:
+      test_models:
+        - id: 1
+          name: Alice
+        - id: 2
+          name: Bob
+  - schema: globex
+`))
+	if err != nil {
+		t.Fatalf("Failed to read specs: %v", err)
+	}
+	if len(specs) != 2 || specs[0].Name != "Acme Corp" || specs[0].Settings["timezone"] != "Europe/Berlin" || specs[1].Schema != "globex" {
+		t.Fatalf("Unexpected specs %+v", specs)
+	}
+	if len(specs[0].Seed) != 2 || specs[0].Seed[1].(Fixture).Values["name"] != "Bob" {
+		t.Fatalf("Expected 2 seed rows, got %+v", specs[0].Seed)
+	}
+
+	if _, err := ReadTenantSpecs(strings.NewReader("tenants:\n  - schema: acme\n    active: false\n")); err == nil {
+		t.Fatal("Expected unknown fields to be rejected")
+	}
+}
+
+func TestCreateTenants(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&TestModel{}}
+	config.EnableRegistry = true
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	specs := []TenantSpec{
+		{Schema: "batch_one", Plan: "pro", Seed: []interface{}{&TestModel{ID: 1, Name: "one"}}},
+		// Fails after its schema and registry record exist
+		{Schema: "batch_broken", Seed: []interface{}{Fixture{Table: "no_such_table", Values: map[string]interface{}{"id": 1}}}},
+		{Schema: "batch_two"},
+	}
+	defer func() {
+		for _, spec := range specs {
+			store.DropTenant(ctx, spec.Schema, DropOptions{Cascade: true})
+			store.GetMasterDB().Unscoped().Where("schema = ?", spec.Schema).Delete(&Tenant{})
+		}
+	}()
+
+	report, err := store.CreateTenants(ctx, specs, BatchOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Failed to create tenants: %v", err)
+	}
+	if report.Count(BatchCreated) != 2 || report.Results[1].Status != BatchFailed {
+		t.Fatalf("Expected batch_broken to fail and the others to be created, got %+v", report.Results)
+	}
+
+	tenant, err := store.LookupTenant(ctx, "batch_one")
+	if err != nil || tenant.Plan != "pro" {
+		t.Fatalf("Expected batch_one registered on pro, got %+v (%v)", tenant, err)
+	}
+	if counts, err := store.RowCounts(ctx, "batch_one"); err != nil || counts["test_models"] != 1 {
+		t.Fatalf("Expected batch_one seeded, got %v (%v)", counts, err)
+	}
+
+	// The failed tenant left nothing behind
+	if _, err := store.RowCounts(ctx, "batch_broken"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("Expected batch_broken schema to be rolled back, got %v", err)
+	}
+	if _, err := store.LookupTenant(ctx, "batch_broken"); !errors.Is(err, ErrTenantNotFound) {
+		t.Fatalf("Expected batch_broken record to be rolled back, got %v", err)
+	}
+
+	// Existing tenants are refused without being touched
+	report, _ = store.CreateTenants(ctx, specs[:1], BatchOptions{})
+	if report.Results[0].Status != BatchFailed {
+		t.Fatalf("Expected an existing tenant to fail, got %+v", report.Results[0])
+	}
+	if counts, _ := store.RowCounts(ctx, "batch_one"); counts["test_models"] != 1 {
+		t.Fatalf("Expected batch_one untouched, got %v", counts)
+	}
+}
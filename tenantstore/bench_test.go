@@ -0,0 +1,61 @@
+package tenantstore
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// newCachedStore returns a store with a tenant in its cache, without opening
+// any database connection
+func newCachedStore(tenantSchema string) *TenantStore {
+	return withConfig(&TenantStore{
+		tenantDBs:      map[string]*gorm.DB{tenantSchema: {}},
+		tenantVersions: map[string]uint64{tenantSchema: 0},
+		health:         map[string]*tenantHealth{tenantSchema: {}},
+	}, DefaultConfig(""))
+}
+
+func BenchmarkGetTenantDB_CacheHit(b *testing.B) {
+	store := newCachedStore("tenant1")
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := store.GetTenantDB(ctx, "tenant1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetTenantDB_CacheHitParallel(b *testing.B) {
+	store := newCachedStore("tenant1")
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := store.GetTenantDB(ctx, "tenant1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestGetTenantDBCacheHitDoesNotAllocate(t *testing.T) {
+	store := newCachedStore("tenant1")
+	ctx := context.Background()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		store.GetTenantDB(ctx, "tenant1")
+	})
+
+	if allocs != 0 {
+		t.Fatalf("Expected no allocations on cache hit, got %v", allocs)
+	}
+}
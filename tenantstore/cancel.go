@@ -0,0 +1,115 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// ErrTenantQueriesCanceled is added to the error of statements aborted by
+// CancelTenantQueries. The middleware responds with 503.
+var ErrTenantQueriesCanceled error = &statusError{"tenant queries canceled", http.StatusServiceUnavailable, 0}
+
+// queryScope is the parent every statement of a tenant runs under
+type queryScope struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+// queryScopeKey holds the release of a statement's scope
+const queryScopeKey = "tenantstore:query_scope"
+
+// CancelTenantQueries aborts the statements running on the tenant's
+// connections, whatever context they were given: PostgreSQL cancels them
+// and they fail with ErrTenantQueriesCanceled. Statements started afterwards
+// run normally, so stop new requests first, e.g. with DeactivateTenant.
+// SuspendTenants calls it for every tenant it suspends. Pooled tenants,
+// which share their connections, are not affected.
+func (s *TenantStore) CancelTenantQueries(tenantSchema string) {
+	if scope, ok := s.queryScopes.LoadAndDelete(tenantSchema); ok {
+		scope.(*queryScope).cancel(ErrTenantQueriesCanceled)
+	}
+}
+
+// queryScope returns the tenant's current scope, created on first use and
+// again after each CancelTenantQueries
+func (s *TenantStore) queryScope(tenantSchema string) context.Context {
+	if scope, ok := s.queryScopes.Load(tenantSchema); ok {
+		return scope.(*queryScope).ctx
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	scope, loaded := s.queryScopes.LoadOrStore(tenantSchema, &queryScope{ctx: ctx, cancel: cancel})
+	if loaded {
+		cancel(nil)
+	}
+	return scope.(*queryScope).ctx
+}
+
+// registerQueryScope adds the callbacks running each statement of a tenant
+// connection under the tenant's scope as well as its own context. Writes
+// keep the scope until their transaction ended. Rows returned by Row and
+// Rows, also behind Raw(...).Scan, are read after the callbacks, so their
+// context is never canceled when the callbacks end: it stays in the scope
+// until its own context is done, or leaves it at once for contexts that are
+// never done, which would otherwise pile up in the scope.
+func (s *TenantStore) registerQueryScope(db *gorm.DB, tenantSchema string) error {
+	enter := func(db *gorm.DB) {
+		parent := db.Statement.Context
+		if parent == nil {
+			parent = context.Background()
+		}
+		ctx, cancel := context.WithCancelCause(parent)
+		scope := s.queryScope(tenantSchema)
+		stop := context.AfterFunc(scope, func() {
+			cancel(context.Cause(scope))
+		})
+
+		db.Statement.Context = ctx
+		db.InstanceSet(queryScopeKey, func(rows bool) {
+			db.Statement.Context = parent
+			if !rows {
+				stop()
+				cancel(nil)
+			} else if parent.Done() != nil {
+				context.AfterFunc(parent, func() { stop() })
+			} else {
+				stop()
+			}
+		})
+	}
+	leave := func(rows bool) func(db *gorm.DB) {
+		return func(db *gorm.DB) {
+			value, ok := db.InstanceGet(queryScopeKey)
+			if !ok {
+				return
+			}
+			if db.Error != nil && context.Cause(db.Statement.Context) == ErrTenantQueriesCanceled {
+				db.AddError(ErrTenantQueriesCanceled)
+			}
+			value.(func(bool))(rows)
+		}
+	}
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:begin_transaction").Register("tenantstore:query_scope", enter),
+		callbacks.Create().After("gorm:commit_or_rollback_transaction").Register("tenantstore:query_scope_end", leave(false)),
+		callbacks.Update().Before("gorm:begin_transaction").Register("tenantstore:query_scope", enter),
+		callbacks.Update().After("gorm:commit_or_rollback_transaction").Register("tenantstore:query_scope_end", leave(false)),
+		callbacks.Delete().Before("gorm:begin_transaction").Register("tenantstore:query_scope", enter),
+		callbacks.Delete().After("gorm:commit_or_rollback_transaction").Register("tenantstore:query_scope_end", leave(false)),
+		callbacks.Query().Before("gorm:query").Register("tenantstore:query_scope", enter),
+		callbacks.Query().After("gorm:after_query").Register("tenantstore:query_scope_end", leave(false)),
+		callbacks.Raw().Before("gorm:raw").Register("tenantstore:query_scope", enter),
+		callbacks.Raw().After("gorm:raw").Register("tenantstore:query_scope_end", leave(false)),
+		callbacks.Row().Before("gorm:row").Register("tenantstore:query_scope", enter),
+		callbacks.Row().After("gorm:row").Register("tenantstore:query_scope_end", leave(true)),
+	} {
+		if err != nil {
+			return fmt.Errorf("failed to register query scope: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// slowCountSQL runs for seconds in SQLite unless interrupted
+const slowCountSQL = "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000) SELECT count(*) FROM c"
+
+// openScopedSQLite opens a SQLite database whose statements run in the
+// tenant's query scope
+func openScopedSQLite(t *testing.T, store *TenantStore, name, tenantSchema string) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { closeDB(db) })
+	if err := store.registerQueryScope(db, tenantSchema); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	return db
+}
+
+// runSlow starts the slow statement and returns its error channel
+func runSlow(db *gorm.DB) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- db.Exec(slowCountSQL).Error
+	}()
+	return done
+}
+
+func TestCancelTenantQueries(t *testing.T) {
+	store := withConfig(&TenantStore{}, DefaultConfig(""))
+	acme := openScopedSQLite(t, store, "cancel_acme", "acme")
+	globex := openScopedSQLite(t, store, "cancel_globex", "globex")
+
+	acmeDone, globexDone := runSlow(acme), runSlow(globex.WithContext(context.Background()))
+	time.Sleep(50 * time.Millisecond)
+	started := time.Now()
+	store.CancelTenantQueries("acme")
+
+	select {
+	case err := <-acmeDone:
+		if !errors.Is(err, ErrTenantQueriesCanceled) {
+			t.Fatalf("Expected ErrTenantQueriesCanceled, got %v", err)
+		}
+		if elapsed := time.Since(started); elapsed > time.Second {
+			t.Fatalf("Expected the statement to stop promptly, took %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the statement to be canceled")
+	}
+
+	// Other tenants keep running, and new statements of acme run again
+	select {
+	case err := <-globexDone:
+		t.Fatalf("Expected globex to keep running, it ended with %v", err)
+	default:
+	}
+	var one int
+	if err := acme.Raw("SELECT 1").Scan(&one).Error; err != nil || one != 1 {
+		t.Fatalf("Expected acme to query after the cancel, got %d (%v)", one, err)
+	}
+	if err := acme.Exec("CREATE TABLE notes (body TEXT)").Error; err != nil {
+		t.Fatalf("Expected acme to write after the cancel: %v", err)
+	}
+
+	store.CancelTenantQueries("globex")
+	if err := <-globexDone; !errors.Is(err, ErrTenantQueriesCanceled) {
+		t.Fatalf("Expected globex to be canceled in turn, got %v", err)
+	}
+
+	// Canceling a tenant without statements is a no-op
+	store.CancelTenantQueries("initech")
+}
+
+func TestSuspendTenantsCancelsQueries(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "suspend_cancel")
+	ctx := context.Background()
+	if err := store.RegisterTenant(ctx, &Tenant{Schema: "acme", Active: true}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	db := openScopedSQLite(t, store, "suspend_cancel_acme", "acme")
+	store.tenantDBs["acme"] = db
+	store.tenantVersions = map[string]uint64{"acme": 0}
+
+	done := runSlow(db)
+	time.Sleep(50 * time.Millisecond)
+
+	// Closing the pool waits for the statement unless it was canceled
+	if _, err := store.SuspendTenants(ctx, []string{"acme"}); err != nil {
+		t.Fatalf("Failed to suspend: %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrTenantQueriesCanceled) {
+			t.Fatalf("Expected ErrTenantQueriesCanceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the statement to be canceled")
+	}
+	if _, ok := store.tenantDBs["acme"]; ok {
+		t.Fatal("Expected the connection to be closed")
+	}
+}
+
+func TestCancelTenantQueriesPostgres(t *testing.T) {
+	t.Parallel()
+
+	store, err := New(DefaultConfig(getTestDSN(t)))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	acme, err := store.GetTenantDB(ctx, "tenant_cancel_a")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	other, err := store.GetTenantDB(ctx, "tenant_cancel_b")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- acme.WithContext(ctx).Exec("SELECT pg_sleep(30)").Error
+	}()
+	time.Sleep(200 * time.Millisecond)
+	started := time.Now()
+	store.CancelTenantQueries("tenant_cancel_a")
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrTenantQueriesCanceled) {
+			t.Fatalf("Expected ErrTenantQueriesCanceled, got %v", err)
+		}
+		if elapsed := time.Since(started); elapsed > 2*time.Second {
+			t.Fatalf("Expected pg_sleep to stop promptly, took %s", elapsed)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected pg_sleep to be canceled")
+	}
+
+	var one int
+	if err := other.Raw("SELECT 1").Scan(&one).Error; err != nil || one != 1 {
+		t.Fatalf("Expected the other tenant to be unaffected, got %d (%v)", one, err)
+	}
+	if err := acme.Raw("SELECT 1").Scan(&one).Error; err != nil || one != 1 {
+		t.Fatalf("Expected the tenant to query again, got %d (%v)", one, err)
+	}
+}
@@ -0,0 +1,137 @@
+package tenantstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// maxCommentField bounds the name and plan in schema comments, in bytes, so
+// a comment never grows past a few hundred bytes
+const maxCommentField = 200
+
+// SchemaComment is the JSON payload the store sets as the comment of each
+// registered tenant's schema, for DBAs browsing the database with
+// obj_description or \dn+
+type SchemaComment struct {
+	Name      string    `json:"name"`
+	Plan      string    `json:"plan,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// schemaComment returns the comment payload of a registry record
+func schemaComment(tenant *Tenant) SchemaComment {
+	return SchemaComment{
+		Name:      truncateUTF8(tenant.Name, maxCommentField),
+		Plan:      truncateUTF8(tenant.Plan, maxCommentField),
+		CreatedAt: tenant.CreatedAt.UTC(),
+	}
+}
+
+// truncateUTF8 cuts s to at most n bytes at a character boundary
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for !utf8.ValidString(s) && len(s) > 0 {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// commentSQL returns the COMMENT ON SCHEMA statement for a registry record.
+// The payload is quoted as an escape string literal, so it is read the same
+// whatever standard_conforming_strings is set to.
+func commentSQL(tenant *Tenant) (string, error) {
+	payload, err := json.Marshal(schemaComment(tenant))
+	if err != nil {
+		return "", err
+	}
+	literal := "E" + quoteLiteral(strings.ReplaceAll(string(payload), `\`, `\\`))
+	return fmt.Sprintf("COMMENT ON SCHEMA %s IS %s", quoteIdentifier(tenant.Schema), literal), nil
+}
+
+// commentSchema sets the comment of the tenant's schema from its registry
+// record, running the statement on db, which must own the schema. Tenants
+// without a record or schema are skipped. Failures are logged rather than
+// returned: comments are for people and never block provisioning. Callers
+// may hold mu, so the registry is read without master.
+func (s *TenantStore) commentSchema(ctx context.Context, db *gorm.DB, tenantSchema string) {
+	if !s.config().EnableRegistry {
+		return
+	}
+
+	var tenant Tenant
+	err := s.masterDB.WithContext(ctx).Where("schema = ?", tenantSchema).Take(&tenant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return
+	}
+	if err == nil {
+		err = setSchemaComment(ctx, db, &tenant)
+	}
+	if err != nil {
+		s.config().Logger.Warn(ctx, "failed to comment schema %s: %v", tenantSchema, err)
+	}
+}
+
+// updateSchemaComment is commentSchema for a record the caller just wrote
+func (s *TenantStore) updateSchemaComment(ctx context.Context, db *gorm.DB, tenant *Tenant) {
+	if err := setSchemaComment(ctx, db, tenant); err != nil {
+		s.config().Logger.Warn(ctx, "failed to comment schema %s: %v", tenant.Schema, err)
+	}
+}
+
+// setSchemaComment comments the tenant's schema if it exists. Other
+// databases than PostgreSQL, such as SQLite in tests, are skipped.
+func setSchemaComment(ctx context.Context, db *gorm.DB, tenant *Tenant) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	var exists bool
+	err := db.WithContext(ctx).Raw("SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = ?)", tenant.Schema).Scan(&exists).Error
+	if err != nil {
+		return fmt.Errorf("failed to look up schema: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	statement, err := commentSQL(tenant)
+	if err != nil {
+		return err
+	}
+	if err := db.WithContext(ctx).Exec(statement).Error; err != nil {
+		return fmt.Errorf("failed to comment schema: %w", err)
+	}
+	return nil
+}
+
+// SyncSchemaComments sets the comment of every registered tenant's schema
+// from its registry record, to backfill tenants provisioned before comments
+// were set or whose records were edited by hand. Tenants without a schema
+// are skipped; failures are returned as TenantErrors.
+func (s *TenantStore) SyncSchemaComments(ctx context.Context) error {
+	tenants, err := s.ListTenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	records := make(map[string]*Tenant, len(tenants))
+	schemas := make([]string, len(tenants))
+	for i := range tenants {
+		records[tenants[i].Schema] = &tenants[i]
+		schemas[i] = tenants[i].Schema
+	}
+	db := s.master()
+	return forEachSchema(ctx, schemas, func(ctx context.Context, tenantSchema string) error {
+		return setSchemaComment(ctx, db, records[tenantSchema])
+	}, ForEachOptions{ContinueOnError: true})
+}
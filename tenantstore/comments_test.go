@@ -0,0 +1,107 @@
+package tenantstore
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommentSQL(t *testing.T) {
+	tenant := &Tenant{
+		Schema:    "acme",
+		Name:      `O'Brien \ Sons'); DROP SCHEMA public; --`,
+		Plan:      strings.Repeat("é", maxCommentField),
+		CreatedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	statement, err := commentSQL(tenant)
+	if err != nil {
+		t.Fatalf("Failed to build comment: %v", err)
+	}
+
+	prefix := `COMMENT ON SCHEMA "acme" IS E'`
+	if !strings.HasPrefix(statement, prefix) || !strings.HasSuffix(statement, "'") {
+		t.Fatalf("Expected a single escape string literal, got %s", statement)
+	}
+
+	// Undo the literal's escaping and compare with the payload
+	literal := strings.TrimSuffix(strings.TrimPrefix(statement, prefix), "'")
+	if strings.Contains(strings.ReplaceAll(literal, "''", ""), "'") {
+		t.Fatalf("Expected every quote to be doubled, got %s", literal)
+	}
+	literal = strings.ReplaceAll(strings.ReplaceAll(literal, "''", "'"), `\\`, `\`)
+
+	var comment SchemaComment
+	if err := json.Unmarshal([]byte(literal), &comment); err != nil {
+		t.Fatalf("Failed to decode comment %s: %v", literal, err)
+	}
+	if comment.Name != tenant.Name || !comment.CreatedAt.Equal(tenant.CreatedAt) {
+		t.Fatalf("Expected the registry fields, got %+v", comment)
+	}
+	if len(comment.Plan) > maxCommentField || !strings.HasPrefix(tenant.Plan, comment.Plan) {
+		t.Fatalf("Expected the plan cut to %d bytes at a character boundary, got %d bytes", maxCommentField, len(comment.Plan))
+	}
+}
+
+func TestSchemaComments(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.EnableRegistry = true
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	const schema = "comment_tenant"
+	defer store.GetMasterDB().Exec("DELETE FROM mt_tenants WHERE schema = ?", schema)
+	defer store.DropTenant(ctx, schema, DropOptions{Cascade: true})
+
+	readComment := func() (SchemaComment, bool) {
+		var description *string
+		store.GetMasterDB().Raw("SELECT obj_description(oid, 'pg_namespace') FROM pg_namespace WHERE nspname = ?", schema).Scan(&description)
+		if description == nil {
+			return SchemaComment{}, false
+		}
+		var comment SchemaComment
+		if err := json.Unmarshal([]byte(*description), &comment); err != nil {
+			t.Fatalf("Failed to decode comment %s: %v", *description, err)
+		}
+		return comment, true
+	}
+
+	// Registered first, commented when provisioned
+	if err := store.RegisterTenant(ctx, &Tenant{Schema: schema, Name: `Acme "Intl" O'Hara`, Plan: "pro", Active: true}); err != nil {
+		t.Fatalf("Failed to register tenant: %v", err)
+	}
+	if err := store.MigrateTenant(ctx, schema); err != nil {
+		t.Fatalf("Failed to migrate tenant: %v", err)
+	}
+
+	tenant, err := store.LookupTenant(ctx, schema)
+	if err != nil {
+		t.Fatalf("Failed to look up tenant: %v", err)
+	}
+	comment, ok := readComment()
+	if !ok {
+		t.Fatal("Expected the schema to be commented")
+	}
+	expected := schemaComment(tenant)
+	if comment.Name != expected.Name || comment.Plan != expected.Plan || !comment.CreatedAt.Equal(expected.CreatedAt) {
+		t.Fatalf("Expected %+v, got %+v", expected, comment)
+	}
+
+	// Backfill after a change made behind the store's back
+	store.GetMasterDB().Exec("COMMENT ON SCHEMA comment_tenant IS NULL")
+	store.GetMasterDB().Exec("UPDATE mt_tenants SET plan = 'enterprise' WHERE schema = ?", schema)
+	if err := store.SyncSchemaComments(ctx); err != nil {
+		t.Fatalf("Failed to sync comments: %v", err)
+	}
+	if comment, ok := readComment(); !ok || comment.Plan != "enterprise" {
+		t.Fatalf("Expected the synced plan, got %+v", comment)
+	}
+}
@@ -0,0 +1,83 @@
+package tenantstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RotateCredentials fetches a fresh DSN from Config.DSNProvider, re-dials the
+// master pool and marks every cached tenant connection for a lazy re-dial on
+// its next GetTenantDB call. Replaced pools keep serving in-flight requests
+// for Config.RotationGracePeriod before they are closed.
+//
+// Handles returned by GetMasterDB before the rotation are retired as well, so
+// call GetMasterDB for each use instead of keeping the handle around.
+func (s *TenantStore) RotateCredentials(ctx context.Context) error {
+	if s.config().DSNProvider == nil {
+		return fmt.Errorf("credential rotation requires a DSNProvider")
+	}
+
+	masterDB, err := s.openMasterDB(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	old := s.masterDB
+	s.masterDB = masterDB
+	s.dsnVersion++
+	s.mu.Unlock()
+
+	s.retire(old)
+
+	return nil
+}
+
+// retire closes a replaced connection pool once the grace period has passed,
+// or when the store is closed before. sql.DB.Close also waits for queries
+// that already started to finish.
+func (s *TenantStore) retire(db *gorm.DB) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return
+	}
+
+	s.retiredMu.Lock()
+	defer s.retiredMu.Unlock()
+	if s.retired == nil {
+		s.retired = make(map[*sql.DB]*time.Timer)
+	}
+	s.retired[sqlDB] = time.AfterFunc(s.config().RotationGracePeriod, func() {
+		s.retiredMu.Lock()
+		_, pending := s.retired[sqlDB]
+		delete(s.retired, sqlDB)
+		s.retiredMu.Unlock()
+
+		// Close already closed it otherwise
+		if pending {
+			sqlDB.Close()
+		}
+	})
+}
+
+// closeRetired closes the retired pools without waiting out their grace
+// period
+func (s *TenantStore) closeRetired() []error {
+	s.retiredMu.Lock()
+	retired := s.retired
+	s.retired = nil
+	s.retiredMu.Unlock()
+
+	var errs []error
+	for sqlDB, timer := range retired {
+		timer.Stop()
+		if err := sqlDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close retired connection: %w", err))
+		}
+	}
+	return errs
+}
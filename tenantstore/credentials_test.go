@@ -0,0 +1,110 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotateCredentialsWithoutProvider(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.RotateCredentials(context.Background()); err == nil {
+		t.Fatal("Expected error when no DSNProvider is configured")
+	}
+}
+
+func TestRotateCredentials(t *testing.T) {
+	t.Parallel()
+
+	adminDSN := getTestDSN(t)
+	role := fmt.Sprintf("test_rotating_%d", time.Now().Unix())
+
+	admin, err := New(DefaultConfig(adminDSN))
+	if err != nil {
+		t.Fatalf("Failed to create admin store: %v", err)
+	}
+	defer admin.Close()
+
+	var dbName string
+	admin.masterDB.Raw("SELECT current_database()").Scan(&dbName)
+
+	if err := admin.masterDB.Exec(fmt.Sprintf("CREATE ROLE %s LOGIN PASSWORD 'first'", role)).Error; err != nil {
+		t.Fatalf("Failed to create role: %v", err)
+	}
+	admin.masterDB.Exec(fmt.Sprintf("GRANT CREATE ON DATABASE %s TO %s", dbName, role))
+
+	// The provider hands out whatever password is current
+	var mu sync.Mutex
+	password := "first"
+
+	config := DefaultConfig(adminDSN)
+	config.RotationGracePeriod = 0
+	config.DSNProvider = func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return adminDSN + fmt.Sprintf(" user=%s password=%s", role, password), nil
+	}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	ctx := context.Background()
+	tenant1 := fmt.Sprintf("test_tenant_1_%d", time.Now().Unix())
+	tenant2 := fmt.Sprintf("test_tenant_2_%d", time.Now().Unix())
+
+	// Clean up after test
+	defer func() {
+		store.Close()
+		admin.masterDB.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", tenant1))
+		admin.masterDB.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", tenant2))
+		admin.masterDB.Exec(fmt.Sprintf("REVOKE CREATE ON DATABASE %s FROM %s", dbName, role))
+		admin.masterDB.Exec(fmt.Sprintf("DROP ROLE IF EXISTS %s", role))
+	}()
+
+	db1, err := store.GetTenantDB(ctx, tenant1)
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	// Rotate the password: the old one no longer authenticates
+	if err := admin.masterDB.Exec(fmt.Sprintf("ALTER ROLE %s PASSWORD 'second'", role)).Error; err != nil {
+		t.Fatalf("Failed to rotate password: %v", err)
+	}
+	mu.Lock()
+	password = "second"
+	mu.Unlock()
+
+	if err := store.RotateCredentials(ctx); err != nil {
+		t.Fatalf("Failed to rotate credentials: %v", err)
+	}
+
+	// New tenants dial with the fresh password
+	if _, err := store.GetTenantDB(ctx, tenant2); err != nil {
+		t.Fatalf("Failed to get tenant DB after rotation: %v", err)
+	}
+
+	// Existing tenants are re-dialed lazily
+	db1Rotated, err := store.GetTenantDB(ctx, tenant1)
+	if err != nil {
+		t.Fatalf("Failed to re-dial tenant DB after rotation: %v", err)
+	}
+	if db1Rotated == db1 {
+		t.Fatal("Expected tenant connection to be re-dialed after rotation")
+	}
+
+	if err := db1Rotated.Exec("SELECT 1").Error; err != nil {
+		t.Fatalf("Expected re-dialed connection to work: %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// DriftReport compares every tenant schema against a reference schema
+type DriftReport struct {
+	Reference string `json:"reference"`
+
+	// Checked lists the compared tenant schemas
+	Checked []string `json:"checked"`
+
+	// Drifted holds the differences of tenants that don't match the reference
+	Drifted map[string]SchemaDrift `json:"drifted"`
+}
+
+// Schemas returns the drifted tenant schemas, sorted by name
+func (r DriftReport) Schemas() []string {
+	schemas := make([]string, 0, len(r.Drifted))
+	for schema := range r.Drifted {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+	return schemas
+}
+
+// SchemaDrift lists how a tenant schema differs from the reference. Columns
+// are named "table.column".
+type SchemaDrift struct {
+	MissingTables  []string       `json:"missing_tables,omitempty"`
+	MissingColumns []string       `json:"missing_columns,omitempty"`
+	ExtraColumns   []string       `json:"extra_columns,omitempty"`
+	TypeMismatches []TypeMismatch `json:"type_mismatches,omitempty"`
+
+	// PlanTables are reference tables the tenant lacks because
+	// Config.ModelsFor leaves them out of its plan. They are expected and
+	// not drift.
+	PlanTables []string `json:"plan_tables,omitempty"`
+}
+
+// IsEmpty reports whether the schema matches the reference, plan tables
+// aside
+func (d SchemaDrift) IsEmpty() bool {
+	return len(d.MissingTables) == 0 && len(d.MissingColumns) == 0 &&
+		len(d.ExtraColumns) == 0 && len(d.TypeMismatches) == 0
+}
+
+// TypeMismatch is a column whose type differs from the reference
+type TypeMismatch struct {
+	Column   string `json:"column"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// schemaColumn is a row of information_schema.columns
+type schemaColumn struct {
+	TableSchema string
+	TableName   string
+	ColumnName  string
+	DataType    string
+}
+
+// schemaLayout maps table name to column name to type
+type schemaLayout map[string]map[string]string
+
+// DriftReport compares the tables and columns of every schema returned by
+// ListSchemas against referenceSchema, such as a template schema or a freshly
+// migrated scratch schema. Extra tables are not reported. With
+// Config.ModelsFor, tables of the reference's models that are not among the
+// tenant's models are listed as PlanTables instead of MissingTables.
+func (s *TenantStore) DriftReport(ctx context.Context, referenceSchema string) (DriftReport, error) {
+	report := DriftReport{Reference: referenceSchema, Drifted: map[string]SchemaDrift{}}
+
+	schemas, err := s.ListSchemas(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	layouts, err := s.schemaLayouts(ctx, append(schemas, referenceSchema))
+	if err != nil {
+		return report, err
+	}
+
+	reference, ok := layouts[referenceSchema]
+	if !ok {
+		return report, fmt.Errorf("reference schema %s has no tables", referenceSchema)
+	}
+
+	var referenceTables map[string]bool
+	if s.config().ModelsFor != nil {
+		if referenceTables, err = s.tenantTables(ctx, referenceSchema); err != nil {
+			return report, err
+		}
+	}
+
+	for _, schema := range schemas {
+		if schema == referenceSchema {
+			continue
+		}
+
+		report.Checked = append(report.Checked, schema)
+		drift := compareLayouts(reference, layouts[schema])
+		if referenceTables != nil && len(drift.MissingTables) > 0 {
+			tables, err := s.tenantTables(ctx, schema)
+			if err != nil {
+				return report, err
+			}
+			drift = drift.splitPlanTables(referenceTables, tables)
+		}
+		if !drift.IsEmpty() {
+			report.Drifted[schema] = drift
+		}
+	}
+
+	return report, nil
+}
+
+// tenantTables returns the tables of the tenant's models
+func (s *TenantStore) tenantTables(ctx context.Context, tenantSchema string) (map[string]bool, error) {
+	models, err := s.tenantModels(ctx, tenantSchema)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]bool, len(models))
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: s.master()}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+		tables[stmt.Schema.Table] = true
+	}
+	return tables, nil
+}
+
+// splitPlanTables moves missing tables of reference models that the tenant's
+// models leave out to PlanTables
+func (d SchemaDrift) splitPlanTables(referenceTables, tenantTables map[string]bool) SchemaDrift {
+	var missing []string
+	for _, table := range d.MissingTables {
+		if referenceTables[table] && !tenantTables[table] {
+			d.PlanTables = append(d.PlanTables, table)
+		} else {
+			missing = append(missing, table)
+		}
+	}
+	d.MissingTables = missing
+	return d
+}
+
+// FixDrift re-runs MigrateTenant for a drifted tenant. AutoMigrate adds
+// missing tables and columns; it does not drop extra columns.
+func (s *TenantStore) FixDrift(ctx context.Context, tenantSchema string) error {
+	return s.MigrateTenant(ctx, tenantSchema)
+}
+
+// schemaLayouts loads the base table columns of the given schemas
+func (s *TenantStore) schemaLayouts(ctx context.Context, schemas []string) (map[string]schemaLayout, error) {
+	var columns []schemaColumn
+	err := s.master().WithContext(ctx).Raw(`
+		SELECT c.table_schema, c.table_name, c.column_name,
+			CASE
+				WHEN c.data_type = 'USER-DEFINED' THEN c.udt_name
+				WHEN c.character_maximum_length IS NOT NULL THEN c.data_type || '(' || c.character_maximum_length || ')'
+				ELSE c.data_type
+			END AS data_type
+		FROM information_schema.columns c
+		JOIN information_schema.tables t
+			ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE t.table_type = 'BASE TABLE' AND c.table_schema IN ?`, schemas).Scan(&columns).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema columns: %w", err)
+	}
+
+	layouts := make(map[string]schemaLayout)
+	for _, col := range columns {
+		layout, ok := layouts[col.TableSchema]
+		if !ok {
+			layout = schemaLayout{}
+			layouts[col.TableSchema] = layout
+		}
+		if layout[col.TableName] == nil {
+			layout[col.TableName] = map[string]string{}
+		}
+		layout[col.TableName][col.ColumnName] = col.DataType
+	}
+	return layouts, nil
+}
+
+// compareLayouts returns the differences of tenant from reference in a
+// stable order
+func compareLayouts(reference, tenant schemaLayout) SchemaDrift {
+	var drift SchemaDrift
+
+	for table, columns := range reference {
+		tenantColumns, ok := tenant[table]
+		if !ok {
+			drift.MissingTables = append(drift.MissingTables, table)
+			continue
+		}
+
+		for column, expected := range columns {
+			actual, ok := tenantColumns[column]
+			switch {
+			case !ok:
+				drift.MissingColumns = append(drift.MissingColumns, table+"."+column)
+			case actual != expected:
+				drift.TypeMismatches = append(drift.TypeMismatches, TypeMismatch{
+					Column:   table + "." + column,
+					Expected: expected,
+					Actual:   actual,
+				})
+			}
+		}
+
+		for column := range tenantColumns {
+			if _, ok := columns[column]; !ok {
+				drift.ExtraColumns = append(drift.ExtraColumns, table+"."+column)
+			}
+		}
+	}
+
+	sort.Strings(drift.MissingTables)
+	sort.Strings(drift.MissingColumns)
+	sort.Strings(drift.ExtraColumns)
+	sort.Slice(drift.TypeMismatches, func(i, j int) bool {
+		return drift.TypeMismatches[i].Column < drift.TypeMismatches[j].Column
+	})
+
+	return drift
+}
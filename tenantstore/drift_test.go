@@ -0,0 +1,113 @@
+package tenantstore
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDriftReport(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.AutoMigrate = true
+	config.Models = []interface{}{&TestModel{}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for _, tenant := range []string{"tenant_a", "tenant_b", "tenant_c"} {
+		if _, err := store.GetTenantDB(ctx, tenant); err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+	}
+
+	// Drift tenant_b by hand and leave tenant_d without tables
+	master := store.GetMasterDB()
+	master.Exec("ALTER TABLE tenant_b.test_models DROP COLUMN name")
+	master.Exec("ALTER TABLE tenant_b.test_models ADD COLUMN legacy_flag boolean")
+	master.Exec("ALTER TABLE tenant_b.test_models ALTER COLUMN id TYPE integer")
+	master.Exec("CREATE SCHEMA tenant_d")
+
+	report, err := store.DriftReport(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to build drift report: %v", err)
+	}
+
+	if !reflect.DeepEqual(report.Checked, []string{"tenant_b", "tenant_c", "tenant_d"}) {
+		t.Fatalf("Expected tenant_b, tenant_c and tenant_d to be checked, got %v", report.Checked)
+	}
+	if !reflect.DeepEqual(report.Schemas(), []string{"tenant_b", "tenant_d"}) {
+		t.Fatalf("Expected tenant_b and tenant_d to drift, got %v", report.Schemas())
+	}
+
+	drift := report.Drifted["tenant_b"]
+	if !reflect.DeepEqual(drift.MissingColumns, []string{"test_models.name"}) {
+		t.Fatalf("Expected missing name column, got %v", drift.MissingColumns)
+	}
+	if !reflect.DeepEqual(drift.ExtraColumns, []string{"test_models.legacy_flag"}) {
+		t.Fatalf("Expected extra legacy_flag column, got %v", drift.ExtraColumns)
+	}
+	if len(drift.TypeMismatches) != 1 || drift.TypeMismatches[0].Column != "test_models.id" {
+		t.Fatalf("Expected id type mismatch, got %+v", drift.TypeMismatches)
+	}
+	if !reflect.DeepEqual(report.Drifted["tenant_d"].MissingTables, []string{"test_models"}) {
+		t.Fatalf("Expected tenant_d to miss test_models, got %+v", report.Drifted["tenant_d"])
+	}
+
+	if _, err := json.Marshal(report); err != nil {
+		t.Fatalf("Failed to marshal report: %v", err)
+	}
+
+	for _, schema := range report.Schemas() {
+		if err := store.FixDrift(ctx, schema); err != nil {
+			t.Fatalf("Failed to fix drift for %s: %v", schema, err)
+		}
+	}
+
+	report, err = store.DriftReport(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to build drift report: %v", err)
+	}
+	if _, ok := report.Drifted["tenant_d"]; ok {
+		t.Fatalf("Expected tenant_d to be fixed, got %+v", report.Drifted["tenant_d"])
+	}
+	if missing := report.Drifted["tenant_b"].MissingColumns; len(missing) != 0 {
+		t.Fatalf("Expected missing columns to be added, got %v", missing)
+	}
+}
+
+func TestCompareLayouts(t *testing.T) {
+	reference := schemaLayout{
+		"users":  {"id": "bigint", "email": "character varying(255)"},
+		"orders": {"id": "bigint"},
+	}
+	tenant := schemaLayout{
+		"users": {"id": "integer", "nickname": "text"},
+	}
+
+	drift := compareLayouts(reference, tenant)
+
+	if !reflect.DeepEqual(drift.MissingTables, []string{"orders"}) {
+		t.Fatalf("Expected missing orders table, got %v", drift.MissingTables)
+	}
+	if !reflect.DeepEqual(drift.MissingColumns, []string{"users.email"}) {
+		t.Fatalf("Expected missing users.email, got %v", drift.MissingColumns)
+	}
+	if !reflect.DeepEqual(drift.ExtraColumns, []string{"users.nickname"}) {
+		t.Fatalf("Expected extra users.nickname, got %v", drift.ExtraColumns)
+	}
+	expected := []TypeMismatch{{Column: "users.id", Expected: "bigint", Actual: "integer"}}
+	if !reflect.DeepEqual(drift.TypeMismatches, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, drift.TypeMismatches)
+	}
+
+	if !compareLayouts(reference, reference).IsEmpty() {
+		t.Fatal("Expected no drift against itself")
+	}
+}
@@ -0,0 +1,116 @@
+package tenantstore
+
+import (
+	"net/url"
+	"strings"
+)
+
+// tenantDSN derives a tenant DSN from a master DSN by setting search_path
+// to the given schemas, normally from SearchPath. URL DSNs
+// (postgres://...?sslmode=...) get a query parameter and keyword/value DSNs
+// (host=... user=...) a keyword; a search_path already in the master DSN is
+// replaced.
+func tenantDSN(masterDSN string, searchPath []string) string {
+	value := formatSearchPath(searchPath)
+	if isURLDSN(masterDSN) {
+		return setURLParam(masterDSN, "search_path", value)
+	}
+
+	dsn := strings.TrimSpace(removeKeyword(masterDSN, "search_path"))
+	if dsn != "" {
+		dsn += " "
+	}
+	return dsn + "search_path=" + dsnValue(value)
+}
+
+// isURLDSN reports whether a DSN is in URL form, like pgx detects it
+func isURLDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// setURLParam sets a query parameter of a URL DSN, replacing every earlier
+// value and keeping the other parameters as they are
+func setURLParam(dsn, name, value string) string {
+	base, fragment, hasFragment := strings.Cut(dsn, "#")
+	base, query, _ := strings.Cut(base, "?")
+
+	var params []string
+	for _, param := range strings.Split(query, "&") {
+		key, _, _ := strings.Cut(param, "=")
+		if key, err := url.QueryUnescape(key); param == "" || (err == nil && key == name) {
+			continue
+		}
+		params = append(params, param)
+	}
+	params = append(params, name+"="+url.QueryEscape(value))
+
+	dsn = base + "?" + strings.Join(params, "&")
+	if hasFragment {
+		dsn += "#" + fragment
+	}
+	return dsn
+}
+
+// removeKeyword removes a keyword and its value from a keyword/value DSN,
+// leaving the other settings as they are. Values may be quoted with single
+// quotes and escape characters with a backslash.
+func removeKeyword(dsn, keyword string) string {
+	var kept strings.Builder
+	for i := 0; i < len(dsn); {
+		start := i
+		i = skipSpaces(dsn, i)
+		keyStart := i
+		for i < len(dsn) && dsn[i] != '=' && !isSpace(dsn[i]) {
+			i++
+		}
+		key := dsn[keyStart:i]
+		i = skipSpaces(dsn, i)
+		if i < len(dsn) && dsn[i] == '=' {
+			i = skipSpaces(dsn, i+1)
+		}
+
+		quoted := i < len(dsn) && dsn[i] == '\''
+		if quoted {
+			i++
+		}
+		for i < len(dsn) {
+			c := dsn[i]
+			if (quoted && c == '\'') || (!quoted && isSpace(c)) {
+				break
+			}
+			if c == '\\' {
+				i++
+			}
+			i++
+		}
+		if quoted {
+			i++
+		}
+		if i > len(dsn) {
+			i = len(dsn)
+		}
+
+		if key != keyword {
+			kept.WriteString(dsn[start:i])
+		}
+	}
+	return kept.String()
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// dsnValue quotes a keyword/value DSN value
+func dsnValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
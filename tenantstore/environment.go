@@ -0,0 +1,78 @@
+package tenantstore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultEnvironmentSeparator joins a schema and its environment in
+// SuffixComposer when Separator is empty
+const DefaultEnvironmentSeparator = "__"
+
+// EnvironmentComposer maps a tenant's schema and Config.Environment to the
+// physical schema, and back. Like SchemaNamer it must be pure, and
+// Decompose must undo Compose.
+type EnvironmentComposer interface {
+	Compose(tenantSchema, environment string) string
+	Decompose(physical string) (tenantSchema, environment string)
+}
+
+// SuffixComposer appends the separator and the environment to the schema,
+// as in "acme__staging". The empty environment leaves schemas unchanged, so
+// a store without Environment keeps the names it always had. Tenant IDs must
+// not contain the separator.
+type SuffixComposer struct {
+	Separator string
+}
+
+func (c SuffixComposer) separator() string {
+	if c.Separator == "" {
+		return DefaultEnvironmentSeparator
+	}
+	return c.Separator
+}
+
+// Compose returns the physical schema of the tenant in the environment
+func (c SuffixComposer) Compose(tenantSchema, environment string) string {
+	if environment == "" {
+		return tenantSchema
+	}
+	return tenantSchema + c.separator() + environment
+}
+
+// Decompose splits a physical schema at the last separator
+func (c SuffixComposer) Decompose(physical string) (string, string) {
+	i := strings.LastIndex(physical, c.separator())
+	if i <= 0 {
+		return physical, ""
+	}
+	return physical[:i], physical[i+len(c.separator()):]
+}
+
+// composer returns Config.EnvironmentComposer, or a SuffixComposer
+func (c *Config) composer() EnvironmentComposer {
+	if c.EnvironmentComposer != nil {
+		return c.EnvironmentComposer
+	}
+	return SuffixComposer{}
+}
+
+// inEnvironment reports whether a physical schema belongs to the store's
+// environment. Without an environment every schema does, since a schema
+// such as acme__eu only looks like it has one.
+func (s *TenantStore) inEnvironment(tenantSchema string) bool {
+	if s.config().Environment == "" {
+		return true
+	}
+	_, environment := s.config().composer().Decompose(tenantSchema)
+	return environment == s.config().Environment
+}
+
+// checkEnvironment refuses destructive operations on schemas of another
+// environment sharing the database
+func (s *TenantStore) checkEnvironment(op, tenantSchema string) error {
+	if s.inEnvironment(tenantSchema) {
+		return nil
+	}
+	return fmt.Errorf("refusing to %s schema %s outside the %s environment", op, tenantSchema, s.config().Environment)
+}
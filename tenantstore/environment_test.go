@@ -0,0 +1,151 @@
+package tenantstore
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSuffixComposer(t *testing.T) {
+	tests := []struct {
+		composer    SuffixComposer
+		schema, env string
+		physical    string
+	}{
+		{SuffixComposer{}, "acme", "", "acme"},
+		{SuffixComposer{}, "acme", "staging", "acme__staging"},
+		{SuffixComposer{}, "acme_corp", "staging", "acme_corp__staging"},
+		{SuffixComposer{Separator: "_env_"}, "acme", "qa", "acme_env_qa"},
+	}
+
+	for _, tt := range tests {
+		physical := tt.composer.Compose(tt.schema, tt.env)
+		if physical != tt.physical {
+			t.Fatalf("Expected %s, got %s", tt.physical, physical)
+		}
+		schema, env := tt.composer.Decompose(physical)
+		if schema != tt.schema || env != tt.env {
+			t.Fatalf("Expected %s in %q, got %s in %q", tt.schema, tt.env, schema, env)
+		}
+	}
+}
+
+func TestSchemaNameComposesEnvironment(t *testing.T) {
+	config := DefaultConfig("")
+	config.Environment = "staging"
+	store := withConfig(&TenantStore{}, config)
+
+	if schema, err := store.SchemaName("acme"); err != nil || schema != "acme__staging" {
+		t.Fatalf("Expected acme__staging, got %s (%v)", schema, err)
+	}
+
+	// A name at the length limit has no room for the suffix
+	if _, err := store.SchemaName(strings.Repeat("a", MaxSchemaNameLength)); err == nil {
+		t.Fatal("Expected an error for a composed name over the limit")
+	}
+
+	aliases := map[string]string{"public": "tenant_public"}
+	store.aliases.Store(&aliases)
+	if schema, _ := store.SchemaName("public"); schema != "tenant_public" {
+		t.Fatalf("Expected aliases to be used as they are, got %s", schema)
+	}
+}
+
+func TestDropTenantRefusesOtherEnvironments(t *testing.T) {
+	config := DefaultConfig("")
+	config.Environment = "staging"
+	store := withConfig(&TenantStore{}, config)
+	ctx := context.Background()
+
+	for _, schema := range []string{"acme", "acme__production"} {
+		if _, err := store.DropTenant(ctx, schema, DropOptions{Cascade: true}); err == nil || !strings.Contains(err.Error(), "staging environment") {
+			t.Fatalf("Expected drop of %s to be refused, got %v", schema, err)
+		}
+		if _, err := store.TruncateTenant(ctx, schema, TruncateOptions{}); err == nil || !strings.Contains(err.Error(), "staging environment") {
+			t.Fatalf("Expected truncate of %s to be refused, got %v", schema, err)
+		}
+	}
+}
+
+func TestSchemasWithSeparatorWithoutEnvironment(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "separator_without_environment")
+	attachInformationSchema(t, store, "acme", "acme__eu")
+
+	// Without an environment, acme__eu is an ordinary schema
+	schemas, err := store.ListSchemas(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list schemas: %v", err)
+	}
+	if !slices.Equal(schemas, []string{"acme", "acme__eu"}) {
+		t.Fatalf("Expected acme and acme__eu, got %v", schemas)
+	}
+	if err := store.checkEnvironment("drop", "acme__eu"); err != nil {
+		t.Fatalf("Expected acme__eu to be droppable, got %v", err)
+	}
+}
+
+func TestEnvironmentsShareDatabase(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	ctx := context.Background()
+
+	stores := make(map[string]*TenantStore)
+	for _, env := range []string{"", "envtest"} {
+		config := DefaultConfig(dsn)
+		config.Models = []interface{}{&TestModel{}}
+		config.Environment = env
+		store, err := New(config)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		defer store.Close()
+		stores[env] = store
+	}
+	production, staging := stores[""], stores["envtest"]
+	defer production.DropTenant(ctx, "env_acme", DropOptions{Cascade: true})
+	defer staging.DropTenant(ctx, "env_acme__envtest", DropOptions{Cascade: true})
+
+	for env, store := range stores {
+		db, err := store.GetTenantDB(ctx, "env_acme")
+		if err != nil {
+			t.Fatalf("Failed to get tenant DB in %q: %v", env, err)
+		}
+		if err := db.Create(&TestModel{Name: "row in " + env}).Error; err != nil {
+			t.Fatalf("Failed to create row in %q: %v", env, err)
+		}
+	}
+
+	for env, store := range stores {
+		db, _ := store.GetTenantDB(ctx, "env_acme")
+		var models []TestModel
+		db.Find(&models)
+		if len(models) != 1 || models[0].Name != "row in "+env {
+			t.Fatalf("Expected only the row of %q, got %+v", env, models)
+		}
+	}
+
+	schemas, err := staging.ListSchemas(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list schemas: %v", err)
+	}
+	if !slices.Contains(schemas, "env_acme__envtest") || slices.Contains(schemas, "env_acme") {
+		t.Fatalf("Expected only staging schemas, got %v", schemas)
+	}
+	// A store without an environment covers every schema
+	schemas, _ = production.ListSchemas(ctx)
+	if !slices.Contains(schemas, "env_acme") || !slices.Contains(schemas, "env_acme__envtest") {
+		t.Fatalf("Expected every schema in production, got %v", schemas)
+	}
+
+	if _, err := staging.DropTenant(ctx, "env_acme", DropOptions{Cascade: true}); err == nil {
+		t.Fatal("Expected staging to refuse dropping the production schema")
+	}
+	if _, err := staging.DropTenant(ctx, "env_acme__envtest", DropOptions{Cascade: true}); err != nil {
+		t.Fatalf("Failed to drop staging schema: %v", err)
+	}
+	if _, err := production.schemaTables(ctx, "env_acme"); err != nil {
+		t.Fatalf("Expected the production schema to survive, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package tenantstore
+
+import (
+	"context"
+	"time"
+)
+
+// TenantEventType names a tenant lifecycle change
+type TenantEventType string
+
+// Tenant lifecycle events passed to Config.OnTenantEvent
+const (
+	EventTenantRegistered  TenantEventType = "tenant.registered"
+	EventTenantUpdated     TenantEventType = "tenant.updated"
+	EventTenantActivated   TenantEventType = "tenant.activated"
+	EventTenantDeactivated TenantEventType = "tenant.deactivated"
+	EventTenantDeleted     TenantEventType = "tenant.deleted"
+	EventTenantRestored    TenantEventType = "tenant.restored"
+	EventSchemaCreated     TenantEventType = "schema.created"
+	EventSchemaDropped     TenantEventType = "schema.dropped"
+)
+
+// TenantEvent describes a lifecycle change made through the store
+type TenantEvent struct {
+	Type   TenantEventType `json:"type"`
+	Schema string          `json:"schema"`
+	Time   time.Time       `json:"time"`
+}
+
+// emit notifies other instances when Config.Notifications is on and calls
+// Config.OnTenantEvent if set
+func (s *TenantStore) emit(ctx context.Context, eventType TenantEventType, tenantSchema string) {
+	s.notify(ctx, eventType, tenantSchema)
+
+	if s.config().OnTenantEvent == nil {
+		return
+	}
+	s.config().OnTenantEvent(ctx, TenantEvent{Type: eventType, Schema: tenantSchema, Time: time.Now()})
+}
@@ -0,0 +1,121 @@
+package tenantstore
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// csvFlushRows is how many rows ExportTenantCSV buffers before flushing
+// them into the archive
+const csvFlushRows = 1000
+
+// ExportTenantCSV writes a ZIP archive to w with one CSV file per table of
+// the tenant schema, named after the table, each with a header row of column
+// names. Rows are streamed from the database rather than loaded, and all
+// tables are read from one snapshot. Like ExportTenant it reads through the
+// master connection and does not create the schema if it is missing. When it
+// fails after writing has started, w holds a truncated archive.
+func (s *TenantStore) ExportTenantCSV(ctx context.Context, tenantSchema string, w io.Writer) error {
+	tables, err := s.schemaTables(ctx, tenantSchema)
+	if err != nil {
+		return err
+	}
+
+	return s.master().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return exportCSV(tx, tenantSchema, tables, w)
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
+
+// exportCSV writes the tables of the schema as a ZIP of CSV files
+func exportCSV(db *gorm.DB, tenantSchema string, tables []string, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	for _, table := range tables {
+		file, err := archive.Create(table + ".csv")
+		if err != nil {
+			return fmt.Errorf("failed to export %s.%s: %w", tenantSchema, table, err)
+		}
+		if err := exportTableCSV(db, quoteIdentifier(tenantSchema)+"."+quoteIdentifier(table), file); err != nil {
+			return fmt.Errorf("failed to export %s.%s: %w", tenantSchema, table, err)
+		}
+	}
+	return archive.Close()
+}
+
+// exportTableCSV streams every row of the qualified table to w as CSV
+func exportTableCSV(db *gorm.DB, table string, w io.Writer) error {
+	rows, err := db.Raw("SELECT * FROM " + table).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(columns); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+
+	for n := 1; rows.Next(); n++ {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		for i, value := range values {
+			record[i] = csvValue(value)
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+		if n%csvFlushRows == 0 {
+			if out.Flush(); out.Error() != nil {
+				return out.Error()
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// csvValue formats a scanned column value, NULL as an empty field
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,148 @@
+package tenantstore
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+type csvCustomer struct {
+	ID    uint `gorm:"primaryKey"`
+	Name  string
+	Notes *string
+}
+
+type csvInvoice struct {
+	ID         uint `gorm:"primaryKey"`
+	CustomerID uint
+	Amount     float64
+}
+
+// readCSVArchive unzips an export into the records of each file
+func readCSVArchive(t *testing.T, data []byte) map[string][][]string {
+	t.Helper()
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+
+	files := make(map[string][][]string)
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", file.Name, err)
+		}
+		records, err := csv.NewReader(r).ReadAll()
+		r.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file.Name, err)
+		}
+		files[file.Name] = records
+	}
+	return files
+}
+
+func TestExportCSV(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:export_csv?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer closeDB(db)
+	if err := db.AutoMigrate(&csvCustomer{}, &csvInvoice{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	note := "pays late, \"always\""
+	customers := []csvCustomer{{Name: "Acme"}, {Name: "Globex, Inc.", Notes: &note}}
+	if err := db.Create(&customers).Error; err != nil {
+		t.Fatalf("Failed to insert customers: %v", err)
+	}
+	// Enough invoices to flush more than once
+	invoices := make([]csvInvoice, 2*csvFlushRows+1)
+	for i := range invoices {
+		invoices[i] = csvInvoice{CustomerID: customers[i%2].ID, Amount: float64(i) + 0.5}
+	}
+	if err := db.CreateInBatches(&invoices, 500).Error; err != nil {
+		t.Fatalf("Failed to insert invoices: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := exportCSV(db, "main", []string{"csv_customers", "csv_invoices"}, &buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	files := readCSVArchive(t, buf.Bytes())
+
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(files))
+	}
+
+	got := files["csv_customers.csv"]
+	if header := strings.Join(got[0], ","); header != "id,name,notes" {
+		t.Fatalf("Expected header id,name,notes, got %s", header)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Expected 2 customer rows, got %d", len(got)-1)
+	}
+	if got[1][2] != "" || got[2][1] != "Globex, Inc." || got[2][2] != note {
+		t.Fatalf("Expected NULL as empty and quoted fields intact, got %q", got[1:])
+	}
+
+	got = files["csv_invoices.csv"]
+	if header := strings.Join(got[0], ","); header != "id,customer_id,amount" {
+		t.Fatalf("Expected header id,customer_id,amount, got %s", header)
+	}
+	if len(got)-1 != len(invoices) {
+		t.Fatalf("Expected %d invoice rows, got %d", len(invoices), len(got)-1)
+	}
+	if last := got[len(got)-1]; last[0] != fmt.Sprint(len(invoices)) || last[2] != "2000.5" {
+		t.Fatalf("Unexpected last invoice %q", last)
+	}
+}
+
+func TestExportTenantCSV(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&csvCustomer{}, &csvInvoice{}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	db, err := store.GetTenantDB(ctx, "csv_export_tenant")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	defer store.DropTenant(ctx, "csv_export_tenant", DropOptions{Cascade: true})
+
+	db.Create(&[]csvCustomer{{Name: "Acme"}, {Name: "Globex"}})
+	db.Create(&[]csvInvoice{{CustomerID: 1, Amount: 10}, {CustomerID: 1, Amount: 20}, {CustomerID: 2, Amount: 5}})
+
+	var buf bytes.Buffer
+	if err := store.ExportTenantCSV(ctx, "csv_export_tenant", &buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	files := readCSVArchive(t, buf.Bytes())
+
+	if got := files["csv_customers.csv"]; len(got) != 3 || strings.Join(got[0], ",") != "id,name,notes" {
+		t.Fatalf("Unexpected customers export %q", got)
+	}
+	if got := files["csv_invoices.csv"]; len(got) != 4 || strings.Join(got[0], ",") != "id,customer_id,amount" {
+		t.Fatalf("Unexpected invoices export %q", got)
+	}
+
+	if err := store.ExportTenantCSV(ctx, "csv_missing_tenant", &buf); err == nil {
+		t.Fatal("Expected an error for a missing schema")
+	}
+}
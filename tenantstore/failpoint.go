@@ -0,0 +1,14 @@
+package tenantstore
+
+import "net/http"
+
+// Operations passed to Config.FailpointInjector
+const (
+	FailpointGetTenantDB  = "get_tenant_db"
+	FailpointEnsureSchema = "ensure_schema"
+	FailpointMigrate      = "migrate"
+)
+
+// ErrConnectionFailed simulates a tenant database that cannot be reached.
+// Failpoint injectors return it; the middleware reports it as 503.
+var ErrConnectionFailed error = &statusError{"tenant database connection failed", http.StatusServiceUnavailable, 0}
@@ -0,0 +1,19 @@
+//go:build nofailpoints
+
+package tenantstore
+
+import "errors"
+
+// checkFailpoints rejects configs that set FailpointInjector in builds
+// without failpoints, where it would be silently ignored
+func checkFailpoints(config *Config) error {
+	if config.FailpointInjector != nil {
+		return errors.New("Config.FailpointInjector is set but the build uses the nofailpoints tag")
+	}
+	return nil
+}
+
+// failpoint never fails; failpoints are compiled out
+func (s *TenantStore) failpoint(op, schema string) error {
+	return nil
+}
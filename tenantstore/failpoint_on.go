@@ -0,0 +1,16 @@
+//go:build !nofailpoints
+
+package tenantstore
+
+// checkFailpoints accepts any config; failpoints are compiled in
+func checkFailpoints(config *Config) error {
+	return nil
+}
+
+// failpoint returns the error Config.FailpointInjector injects for op
+func (s *TenantStore) failpoint(op, schema string) error {
+	if s.config().FailpointInjector == nil {
+		return nil
+	}
+	return s.config().FailpointInjector(op, schema)
+}
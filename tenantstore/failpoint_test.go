@@ -0,0 +1,70 @@
+//go:build !nofailpoints
+
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestFailpointInjector(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&GroupNote{}}
+	config.FailpointInjector = func(op, schema string) error {
+		mu.Lock()
+		calls = append(calls, op+" "+schema)
+		mu.Unlock()
+
+		if schema == "flaky" || (op == FailpointMigrate && schema == "unmigrated") {
+			return ErrConnectionFailed
+		}
+		return nil
+	}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	if _, err := store.GetTenantDB(ctx, "flaky"); !errors.Is(err, ErrConnectionFailed) {
+		t.Fatalf("Expected ErrConnectionFailed, got %v", err)
+	}
+	if _, err := store.schemaTables(ctx, "flaky"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("Expected the schema not to be created, got %v", err)
+	}
+
+	if _, err := store.GetTenantDB(ctx, "unmigrated"); !errors.Is(err, ErrConnectionFailed) {
+		t.Fatalf("Expected the migration to fail, got %v", err)
+	}
+
+	if _, err := store.GetTenantDB(ctx, "healthy"); err != nil {
+		t.Fatalf("Expected other tenants to work, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"get_tenant_db flaky",
+		"get_tenant_db unmigrated", "ensure_schema unmigrated", "migrate unmigrated",
+		"get_tenant_db healthy", "ensure_schema healthy", "migrate healthy",
+	}
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected calls %v, got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatalf("Expected calls %v, got %v", expected, calls)
+		}
+	}
+}
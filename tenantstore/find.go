@@ -0,0 +1,172 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultFindConcurrency is the number of tenants FindTenantsBy probes at
+// once when FindOptions.Concurrency is not set
+const DefaultFindConcurrency = 4
+
+// DefaultFindTenantTimeout bounds each tenant's probe when
+// FindOptions.TenantTimeout is not set
+const DefaultFindTenantTimeout = 2 * time.Second
+
+// ErrUnknownColumn is returned by FindTenantByUnique for a column its model
+// does not have
+var ErrUnknownColumn = errors.New("unknown column")
+
+// ProbeFunc reports whether a tenant matches a search. db is the tenant's
+// connection, bound to the probe's timeout.
+type ProbeFunc func(tenantSchema string, db *gorm.DB) (bool, error)
+
+// FindOptions controls FindTenantsBy
+type FindOptions struct {
+	// Concurrency is the number of tenants probed at once (defaults to
+	// DefaultFindConcurrency)
+	Concurrency int
+
+	// FirstMatch stops probing after the first tenant that matches
+	FirstMatch bool
+
+	// TenantTimeout bounds each tenant's probe (defaults to
+	// DefaultFindTenantTimeout)
+	TenantTimeout time.Duration
+}
+
+// FindTenantsBy returns the schemas, sorted by name, for which probe reports
+// a match, such as the tenants a user's email belongs to. Every schema of
+// ListSchemas is probed with bounded concurrency, each within
+// TenantTimeout. Probes that fail or time out are returned as TenantErrors
+// together with the matches found in the other tenants. With FirstMatch the
+// search stops at the first match and probes still running are cancelled.
+func (s *TenantStore) FindTenantsBy(ctx context.Context, probe ProbeFunc, opts ...FindOptions) ([]string, error) {
+	schemas, err := s.ListSchemas(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var opt FindOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	return findInSchemas(ctx, schemas, s.tenantDB, probe, opt)
+}
+
+// findInSchemas probes schemas with the connections of open
+func findInSchemas(ctx context.Context, schemas []string, open func(ctx context.Context, tenantSchema string) (*gorm.DB, error), probe ProbeFunc, opts FindOptions) ([]string, error) {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = DefaultFindConcurrency
+	}
+	if opts.TenantTimeout <= 0 {
+		opts.TenantTimeout = DefaultFindTenantTimeout
+	}
+
+	// stop ends the search after the first match; probes it cancels do not
+	// count as failures
+	search, stop := context.WithCancel(ctx)
+	defer stop()
+
+	var (
+		mu      sync.Mutex
+		matches = []string{}
+		stopped bool
+	)
+
+	err := forEachSchema(search, schemas, func(ctx context.Context, tenantSchema string) error {
+		ctx, cancel := context.WithTimeout(ctx, opts.TenantTimeout)
+		defer cancel()
+
+		db, err := open(ctx, tenantSchema)
+		var found bool
+		if err == nil {
+			found, err = probe(tenantSchema, db.WithContext(ctx))
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if found {
+			matches = append(matches, tenantSchema)
+			if opts.FirstMatch {
+				stopped = true
+				stop()
+			}
+		}
+		return nil
+	}, ForEachOptions{Concurrency: opts.Concurrency, ContinueOnError: true})
+
+	sort.Strings(matches)
+	if stopped && errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		err = nil
+	}
+	return matches, err
+}
+
+// FindTenantByUnique returns the tenant with a row of model whose column
+// equals value, such as the tenant of a user's email, stopping at the first
+// match. column must be a column of model. Tenants without a match return
+// ErrTenantNotFound, also when probes of other tenants failed, which are
+// returned as TenantErrors alongside.
+//
+//	schema, err := store.FindTenantByUnique(ctx, &User{}, "email", "jane@example.com")
+func (s *TenantStore) FindTenantByUnique(ctx context.Context, model interface{}, column string, value interface{}, opts ...FindOptions) (string, error) {
+	probe, err := s.uniqueProbe(model, column, value)
+	if err != nil {
+		return "", err
+	}
+
+	opt := FindOptions{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	opt.FirstMatch = true
+
+	matches, err := s.FindTenantsBy(ctx, probe, opt)
+	if len(matches) > 0 {
+		return matches[0], nil
+	}
+	var failures TenantErrors
+	if errors.As(err, &failures) {
+		return "", errors.Join(ErrTenantNotFound, failures)
+	}
+	if err != nil {
+		return "", err
+	}
+	return "", ErrTenantNotFound
+}
+
+// uniqueProbe returns a probe checking whether a row of model has value in
+// column
+func (s *TenantStore) uniqueProbe(model interface{}, column string, value interface{}) (ProbeFunc, error) {
+	stmt := &gorm.Statement{DB: s.master()}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+	}
+	if _, ok := stmt.Schema.FieldsByDBName[column]; !ok {
+		return nil, fmt.Errorf("%w %q in %s", ErrUnknownColumn, column, stmt.Schema.Table)
+	}
+
+	return func(tenantSchema string, db *gorm.DB) (bool, error) {
+		var exists bool
+		query := db.Session(&gorm.Session{NewDB: true}).Model(model).
+			Select("1").Where(clause.Eq{Column: clause.Column{Name: column}, Value: value})
+		if err := db.Raw("SELECT EXISTS (?)", query).Scan(&exists).Error; err != nil {
+			return false, err
+		}
+		return exists, nil
+	}, nil
+}
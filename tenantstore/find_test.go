@@ -0,0 +1,165 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// newFindTenants opens an SQLite database with TestModel per schema and
+// stores a row named after the schema in each
+func newFindTenants(t *testing.T, name string, schemas ...string) map[string]*gorm.DB {
+	t.Helper()
+
+	dbs := make(map[string]*gorm.DB, len(schemas))
+	for _, schema := range schemas {
+		db, err := gorm.Open(sqlite.Open("file:"+name+"_"+schema+"?mode=memory&cache=shared"), &gorm.Config{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { closeDB(db) })
+		if err := db.AutoMigrate(&TestModel{}); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+		db.Create(&TestModel{Name: "owner@" + schema})
+		dbs[schema] = db
+	}
+	return dbs
+}
+
+func TestFindInSchemas(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "find_in_schemas")
+	schemas := []string{"tenant_a", "tenant_b", "tenant_c"}
+	dbs := newFindTenants(t, "find_in_schemas", schemas...)
+	dbs["tenant_b"].Create(&TestModel{Name: "jane@x.com"})
+
+	open := func(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+		return dbs[tenantSchema], nil
+	}
+	ctx := context.Background()
+
+	probe, err := store.uniqueProbe(&TestModel{}, "name", "jane@x.com")
+	if err != nil {
+		t.Fatalf("Failed to build probe: %v", err)
+	}
+	matches, err := findInSchemas(ctx, schemas, open, probe, FindOptions{})
+	if err != nil || len(matches) != 1 || matches[0] != "tenant_b" {
+		t.Fatalf("Expected [tenant_b], got %v %v", matches, err)
+	}
+
+	// Without the value no tenant matches
+	probe, _ = store.uniqueProbe(&TestModel{}, "name", "john@x.com")
+	if matches, err := findInSchemas(ctx, schemas, open, probe, FindOptions{}); err != nil || len(matches) != 0 {
+		t.Fatalf("Expected no match, got %v %v", matches, err)
+	}
+
+	if _, err := store.uniqueProbe(&TestModel{}, "name; DROP TABLE test_models", "x"); err == nil {
+		t.Fatal("Expected error for an unknown column")
+	}
+}
+
+func TestFindInSchemasFirstMatch(t *testing.T) {
+	schemas := []string{"tenant_a", "tenant_b", "tenant_c"}
+	dbs := newFindTenants(t, "find_first_match", schemas...)
+	open := func(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+		return dbs[tenantSchema], nil
+	}
+
+	// Every tenant matches; sequential probing stops after the first
+	var probed atomic.Int32
+	probe := func(tenantSchema string, db *gorm.DB) (bool, error) {
+		probed.Add(1)
+		return true, nil
+	}
+	matches, err := findInSchemas(context.Background(), schemas, open, probe, FindOptions{Concurrency: 1, FirstMatch: true})
+	if err != nil || len(matches) != 1 || matches[0] != "tenant_a" {
+		t.Fatalf("Expected [tenant_a], got %v %v", matches, err)
+	}
+	if n := probed.Load(); n != 1 {
+		t.Fatalf("Expected 1 probe, got %d", n)
+	}
+
+	// Probes running when the first match arrives are cancelled, not failed
+	probe = func(tenantSchema string, db *gorm.DB) (bool, error) {
+		if tenantSchema == "tenant_b" {
+			return true, nil
+		}
+		<-db.Statement.Context.Done()
+		return false, db.Statement.Context.Err()
+	}
+	matches, err = findInSchemas(context.Background(), schemas, open, probe, FindOptions{Concurrency: 3, FirstMatch: true})
+	if err != nil || len(matches) != 1 || matches[0] != "tenant_b" {
+		t.Fatalf("Expected [tenant_b], got %v %v", matches, err)
+	}
+}
+
+func TestFindInSchemasTimeout(t *testing.T) {
+	schemas := []string{"tenant_a", "tenant_b"}
+	dbs := newFindTenants(t, "find_timeout", schemas...)
+	open := func(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+		return dbs[tenantSchema], nil
+	}
+
+	probe := func(tenantSchema string, db *gorm.DB) (bool, error) {
+		if tenantSchema == "tenant_a" {
+			<-db.Statement.Context.Done()
+			return false, db.Statement.Context.Err()
+		}
+		return true, nil
+	}
+	matches, err := findInSchemas(context.Background(), schemas, open, probe, FindOptions{TenantTimeout: 20 * time.Millisecond})
+
+	var failures TenantErrors
+	if !errors.As(err, &failures) || !errors.Is(failures["tenant_a"], context.DeadlineExceeded) {
+		t.Fatalf("Expected tenant_a to time out, got %v", err)
+	}
+	if len(matches) != 1 || matches[0] != "tenant_b" {
+		t.Fatalf("Expected [tenant_b] despite the timeout, got %v", matches)
+	}
+}
+
+func TestFindTenantByUnique(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&TestModel{}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for _, schema := range []string{"tenant_a", "tenant_b", "tenant_c"} {
+		db, err := store.GetTenantDB(ctx, schema)
+		if err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+		db.Create(&TestModel{Name: "owner@" + schema})
+	}
+	db, _ := store.GetTenantDB(ctx, "tenant_b")
+	db.Create(&TestModel{Name: "jane@x.com"})
+
+	schema, err := store.FindTenantByUnique(ctx, &TestModel{}, "name", "jane@x.com")
+	if err != nil || schema != "tenant_b" {
+		t.Fatalf("Expected tenant_b, got %q %v", schema, err)
+	}
+	if _, err := store.FindTenantByUnique(ctx, &TestModel{}, "name", "john@x.com"); !errors.Is(err, ErrTenantNotFound) {
+		t.Fatalf("Expected ErrTenantNotFound, got %v", err)
+	}
+
+	matches, err := store.FindTenantsBy(ctx, func(tenantSchema string, db *gorm.DB) (bool, error) {
+		var count int64
+		err := db.Model(&TestModel{}).Where("name LIKE ?", "owner@%").Count(&count).Error
+		return count > 0, err
+	})
+	if err != nil || len(matches) != 3 {
+		t.Fatalf("Expected 3 tenants, got %v %v", matches, err)
+	}
+}
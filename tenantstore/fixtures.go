@@ -0,0 +1,249 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Fixture is a row loaded from a fixtures file. SeedFixtures turns it into
+// an instance of the model in Config.Models whose table is Table.
+type Fixture struct {
+	Table  string
+	Values map[string]interface{}
+}
+
+// LoadFixtures reads one .yaml, .yml or .json file per tenant from dir. The
+// file name without its extension is the tenant ID, and the file maps table
+// names to rows, keyed by column name:
+//
+//	# fixtures/acme.yaml
+//	users:
+//	  - id: 1
+//	    name: Alice
+//	posts:
+//	  - id: 1
+//	    user_id: 1
+//	    title: Hello
+//
+// Tables are returned in file order, so list parents before the rows that
+// reference them.
+func LoadFixtures(dir string) (map[string][]interface{}, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	fixtures := make(map[string][]interface{})
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+
+		tenantID := strings.TrimSuffix(entry.Name(), ext)
+		if _, exists := fixtures[tenantID]; exists {
+			return nil, fmt.Errorf("duplicate fixtures file for tenant %s", tenantID)
+		}
+
+		records, err := loadFixtureFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		fixtures[tenantID] = records
+	}
+
+	return fixtures, nil
+}
+
+// loadFixtureFile parses a fixtures file. JSON is valid YAML, and decoding
+// into a node keeps the table order that a map would lose.
+func loadFixtureFile(path string) ([]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	return fixturesFromNode(doc.Content[0], path)
+}
+
+// fixturesFromNode reads a mapping of table names to rows, in order
+func fixturesFromNode(root *yaml.Node, source string) ([]interface{}, error) {
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse %s: expected a mapping of table names to rows", source)
+	}
+
+	var records []interface{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		table := root.Content[i].Value
+
+		var rows []map[string]interface{}
+		if err := root.Content[i+1].Decode(&rows); err != nil {
+			return nil, fmt.Errorf("failed to parse %s table %s: %w", source, table, err)
+		}
+		for _, row := range rows {
+			records = append(records, Fixture{Table: table, Values: row})
+		}
+	}
+
+	return records, nil
+}
+
+// SeedFixtures inserts records into each tenant, creating the schema (and
+// the registry record, when the registry is enabled) if it is missing.
+// Records are pointers to models or Fixture values from LoadFixtures, and
+// must set their primary key: rows that already exist are updated, so
+// seeding again is idempotent. Each tenant is seeded in one transaction.
+func (s *TenantStore) SeedFixtures(ctx context.Context, fixtures map[string][]interface{}) error {
+	tenantIDs := make([]string, 0, len(fixtures))
+	for tenantID := range fixtures {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+
+	for _, tenantID := range tenantIDs {
+		if err := s.seedTenant(ctx, tenantID, fixtures[tenantID]); err != nil {
+			return fmt.Errorf("failed to seed %s: %w", tenantID, err)
+		}
+	}
+	return nil
+}
+
+func (s *TenantStore) seedTenant(ctx context.Context, tenantID string, records []interface{}) error {
+	if s.config().EnableRegistry {
+		_, err := s.LookupTenant(ctx, tenantID)
+		if errors.Is(err, ErrTenantNotFound) {
+			err = s.RegisterTenant(ctx, &Tenant{Schema: tenantID, Name: tenantID, Active: true})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := s.GetTenantDB(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	schemaName, err := s.SchemaName(tenantID)
+	if err != nil {
+		return err
+	}
+
+	models := make(map[string]*schema.Schema)
+	for _, model := range s.models() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+		models[stmt.Schema.Table] = stmt.Schema
+	}
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var seeded []*schema.Schema
+		seen := make(map[string]bool)
+
+		for _, record := range records {
+			value, err := fixtureValue(ctx, models, record)
+			if err != nil {
+				return err
+			}
+
+			stmt := &gorm.Statement{DB: tx}
+			if err := stmt.Parse(value); err != nil {
+				return fmt.Errorf("failed to parse fixture %T: %w", value, err)
+			}
+			for _, field := range stmt.Schema.PrimaryFields {
+				if _, zero := field.ValueOf(ctx, reflect.ValueOf(value).Elem()); zero {
+					return fmt.Errorf("fixture for %s has no %s; fixtures need primary keys to be idempotent",
+						stmt.Schema.Table, field.DBName)
+				}
+			}
+
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(value).Error; err != nil {
+				return fmt.Errorf("failed to insert fixture into %s: %w", stmt.Schema.Table, err)
+			}
+
+			if !seen[stmt.Schema.Table] {
+				seen[stmt.Schema.Table] = true
+				seeded = append(seeded, stmt.Schema)
+			}
+		}
+
+		for _, model := range seeded {
+			if err := advanceSequence(tx, schemaName, model); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// fixtureValue returns the model instance to insert for a record
+func fixtureValue(ctx context.Context, models map[string]*schema.Schema, record interface{}) (interface{}, error) {
+	fixture, ok := record.(Fixture)
+	if !ok {
+		if reflect.ValueOf(record).Kind() != reflect.Ptr {
+			return nil, fmt.Errorf("fixture %T must be a pointer to a model", record)
+		}
+		return record, nil
+	}
+
+	model, ok := models[fixture.Table]
+	if !ok {
+		return nil, fmt.Errorf("no model for fixture table %s; add it to Config.Models or ModelGroups", fixture.Table)
+	}
+
+	value := reflect.New(model.ModelType)
+	for column, v := range fixture.Values {
+		field := model.LookUpField(column)
+		if field == nil {
+			return nil, fmt.Errorf("unknown column %s.%s in fixture", fixture.Table, column)
+		}
+		if err := field.Set(ctx, value.Elem(), v); err != nil {
+			return nil, fmt.Errorf("failed to set %s.%s: %w", fixture.Table, column, err)
+		}
+	}
+	return value.Interface(), nil
+}
+
+// advanceSequence moves an auto-increment primary key's sequence past the
+// seeded IDs so the application's own inserts do not collide with them.
+// Sequences already further along, such as OffsetSerial ranges, are kept.
+func advanceSequence(tx *gorm.DB, schemaName string, model *schema.Schema) error {
+	field := model.PrioritizedPrimaryField
+	if field == nil || !field.AutoIncrement {
+		return nil
+	}
+
+	table := quoteIdentifier(schemaName) + "." + quoteIdentifier(model.Table)
+	err := tx.Exec(`SELECT setval(seq.name, m.max_id)
+		FROM (SELECT pg_get_serial_sequence(?, ?) AS name) seq,
+			(SELECT MAX(`+quoteIdentifier(field.DBName)+`) AS max_id FROM `+table+`) m,
+			pg_sequences ps
+		WHERE seq.name IS NOT NULL AND m.max_id IS NOT NULL
+			AND format('%I.%I', ps.schemaname, ps.sequencename) = seq.name
+			AND m.max_id > COALESCE(ps.last_value, ps.start_value - 1)`,
+		table, field.DBName).Error
+	if err != nil {
+		return fmt.Errorf("failed to advance sequence for %s: %w", model.Table, err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package tenantstore
+
+import (
+	"context"
+	"testing"
+)
+
+type FixtureAuthor struct {
+	ID    uint `gorm:"primaryKey"`
+	Name  string
+	Posts []FixturePost `gorm:"foreignKey:AuthorID"`
+}
+
+type FixturePost struct {
+	ID       uint `gorm:"primaryKey"`
+	AuthorID uint
+	Author   FixtureAuthor
+	Title    string
+}
+
+func TestLoadFixtures(t *testing.T) {
+	fixtures, err := LoadFixtures("testdata/fixtures")
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	if len(fixtures) != 2 || len(fixtures["acme"]) != 4 || len(fixtures["globex"]) != 2 {
+		t.Fatalf("Expected 4 acme and 2 globex records, got %v", fixtures)
+	}
+
+	// Tables keep their file order, including from JSON
+	for _, tenant := range []string{"acme", "globex"} {
+		first := fixtures[tenant][0].(Fixture)
+		last := fixtures[tenant][len(fixtures[tenant])-1].(Fixture)
+		if first.Table != "fixture_authors" || last.Table != "fixture_posts" {
+			t.Fatalf("Expected authors before posts for %s, got %s and %s", tenant, first.Table, last.Table)
+		}
+	}
+
+	if _, err := LoadFixtures("testdata/missing"); err == nil {
+		t.Fatal("Expected error for a missing directory")
+	}
+}
+
+func TestSeedFixtures(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.EnableRegistry = true
+	config.Models = []interface{}{&FixtureAuthor{}, &FixturePost{}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	fixtures, err := LoadFixtures("testdata/fixtures")
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// Seeding twice must not duplicate rows
+	for i := 0; i < 2; i++ {
+		if err := store.SeedFixtures(ctx, fixtures); err != nil {
+			t.Fatalf("Failed to seed fixtures: %v", err)
+		}
+	}
+
+	if _, err := store.LookupTenant(ctx, "globex"); err != nil {
+		t.Fatalf("Expected globex to be registered: %v", err)
+	}
+
+	db, err := store.GetTenantDB(ctx, "acme")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	var posts []FixturePost
+	if err := db.Preload("Author").Order("id").Find(&posts).Error; err != nil {
+		t.Fatalf("Failed to load posts: %v", err)
+	}
+	if len(posts) != 2 || posts[1].Author.Name != "Bob" {
+		t.Fatalf("Expected 2 posts with authors, got %+v", posts)
+	}
+
+	// The sequence moved past the seeded IDs
+	author := FixtureAuthor{Name: "Dave"}
+	if err := db.Create(&author).Error; err != nil {
+		t.Fatalf("Failed to create author after seeding: %v", err)
+	}
+	if author.ID != 3 {
+		t.Fatalf("Expected next author ID 3, got %d", author.ID)
+	}
+
+	// Model instances can be seeded directly
+	err = store.SeedFixtures(ctx, map[string][]interface{}{
+		"globex": {&FixtureAuthor{ID: 1, Name: "Carol Updated"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to seed models: %v", err)
+	}
+
+	globex, err := store.GetTenantDB(ctx, "globex")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	var carol FixtureAuthor
+	globex.First(&carol, 1)
+	if carol.Name != "Carol Updated" {
+		t.Fatalf("Expected upserted author, got %+v", carol)
+	}
+
+	err = store.SeedFixtures(ctx, map[string][]interface{}{
+		"globex": {&FixtureAuthor{Name: "No ID"}},
+	})
+	if err == nil {
+		t.Fatal("Expected error for a fixture without a primary key")
+	}
+}
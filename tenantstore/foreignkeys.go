@@ -0,0 +1,209 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// FKDef is a foreign key from a tenant table to a table outside the tenant
+// schema, usually a shared table in public. AutoMigrate resolves references
+// through the search_path, so a tenant schema holding a table with the same
+// name captures the constraint; declaring it here pins the target schema.
+type FKDef struct {
+	FromTable  string
+	FromColumn string
+
+	// ToSchema defaults to public
+	ToSchema string
+	ToTable  string
+
+	// ToColumn defaults to id
+	ToColumn string
+
+	// Name of the constraint, defaults to <FromTable>_<FromColumn>_fkey
+	Name string
+
+	// OnDelete is an optional referential action such as CASCADE or SET NULL
+	OnDelete string
+}
+
+func (def FKDef) withDefaults() FKDef {
+	if def.ToSchema == "" {
+		def.ToSchema = "public"
+	}
+	if def.ToColumn == "" {
+		def.ToColumn = "id"
+	}
+	if def.Name == "" {
+		def.Name = def.FromTable + "_" + def.FromColumn + "_fkey"
+	}
+	return def
+}
+
+// ForeignKeyIssue is a declared cross-schema foreign key that is missing, or
+// another constraint on the same column pointing somewhere else
+type ForeignKeyIssue struct {
+	FKDef
+
+	// Constraint is the name of the wrong constraint, empty if the declared
+	// foreign key is missing
+	Constraint string
+
+	// TargetSchema, TargetTable and TargetColumn are what Constraint
+	// actually references
+	TargetSchema string
+	TargetTable  string
+	TargetColumn string
+}
+
+// foreignKey is a single-column foreign key constraint read from the catalog
+type foreignKey struct {
+	Name         string
+	TargetSchema string
+	TargetTable  string
+	TargetColumn string
+}
+
+// VerifyForeignKeys checks Config.CrossSchemaFKs in the tenant schema and
+// reports missing constraints and constraints on the same columns that
+// resolve to the wrong schema. It does not change anything.
+func (s *TenantStore) VerifyForeignKeys(ctx context.Context, tenantSchema string) ([]ForeignKeyIssue, error) {
+	if tenantSchema == "" {
+		return nil, fmt.Errorf("tenant schema cannot be empty")
+	}
+
+	var issues []ForeignKeyIssue
+	for _, def := range s.config().CrossSchemaFKs {
+		def = def.withDefaults()
+
+		keys, err := columnForeignKeys(ctx, s.master(), tenantSchema, def)
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		for _, key := range keys {
+			if key.targets(def) {
+				found = true
+				continue
+			}
+			issues = append(issues, ForeignKeyIssue{
+				FKDef:        def,
+				Constraint:   key.Name,
+				TargetSchema: key.TargetSchema,
+				TargetTable:  key.TargetTable,
+				TargetColumn: key.TargetColumn,
+			})
+		}
+		if !found {
+			issues = append(issues, ForeignKeyIssue{FKDef: def})
+		}
+	}
+
+	return issues, nil
+}
+
+// ApplyForeignKeys applies Config.CrossSchemaFKs to an existing tenant
+// schema. New schemas get them after AutoMigrate.
+func (s *TenantStore) ApplyForeignKeys(ctx context.Context, tenantSchema string) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+
+	if s.config().GetMigrationDSN != nil {
+		migrationDB, err := s.openMigrationDB(tenantSchema)
+		if err != nil {
+			return err
+		}
+		defer closeDB(migrationDB)
+
+		return s.applyForeignKeys(ctx, migrationDB, tenantSchema)
+	}
+
+	return s.applyForeignKeys(ctx, s.master(), tenantSchema)
+}
+
+// applyForeignKeys drops constraints on the declared columns that point
+// elsewhere and adds the declared ones that are missing
+func (s *TenantStore) applyForeignKeys(ctx context.Context, db *gorm.DB, tenantSchema string) error {
+	for _, def := range s.config().CrossSchemaFKs {
+		def = def.withDefaults()
+
+		keys, err := columnForeignKeys(ctx, db, tenantSchema, def)
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, key := range keys {
+			if key.targets(def) {
+				found = true
+				continue
+			}
+			drop := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s",
+				qualifiedTable(tenantSchema, def.FromTable), quoteIdentifier(key.Name))
+			if err := db.WithContext(ctx).Exec(drop).Error; err != nil {
+				return fmt.Errorf("failed to drop foreign key %s in %s: %w", key.Name, tenantSchema, err)
+			}
+		}
+		if found {
+			continue
+		}
+
+		if err := db.WithContext(ctx).Exec(addForeignKeySQL(def, tenantSchema)).Error; err != nil {
+			return fmt.Errorf("failed to add foreign key %s in %s: %w", def.Name, tenantSchema, err)
+		}
+	}
+	return nil
+}
+
+// addForeignKeySQL returns the schema-qualified statement adding the foreign key
+func addForeignKeySQL(def FKDef, tenantSchema string) string {
+	statement := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s.%s (%s)",
+		qualifiedTable(tenantSchema, def.FromTable),
+		quoteIdentifier(def.Name),
+		quoteIdentifier(def.FromColumn),
+		quoteIdentifier(def.ToSchema),
+		quoteIdentifier(def.ToTable),
+		quoteIdentifier(def.ToColumn),
+	)
+	if def.OnDelete != "" {
+		statement += " ON DELETE " + def.OnDelete
+	}
+	return statement
+}
+
+// qualifiedTable quotes a table in the tenant schema
+func qualifiedTable(tenantSchema, table string) string {
+	return quoteIdentifier(tenantSchema) + "." + quoteIdentifier(table)
+}
+
+// columnForeignKeys lists the single-column foreign keys on the def's column
+func columnForeignKeys(ctx context.Context, db *gorm.DB, tenantSchema string, def FKDef) ([]foreignKey, error) {
+	var keys []foreignKey
+	err := db.WithContext(ctx).Raw(`
+		SELECT con.conname AS name, tns.nspname AS target_schema,
+			tcl.relname AS target_table, ta.attname AS target_column
+		FROM pg_constraint con
+		JOIN pg_class cl ON cl.oid = con.conrelid
+		JOIN pg_namespace ns ON ns.oid = cl.relnamespace
+		JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = con.conkey[1]
+		JOIN pg_class tcl ON tcl.oid = con.confrelid
+		JOIN pg_namespace tns ON tns.oid = tcl.relnamespace
+		JOIN pg_attribute ta ON ta.attrelid = con.confrelid AND ta.attnum = con.confkey[1]
+		WHERE con.contype = 'f' AND array_length(con.conkey, 1) = 1
+			AND ns.nspname = ? AND cl.relname = ? AND a.attname = ?
+		ORDER BY con.conname`,
+		tenantSchema, def.FromTable, def.FromColumn).Scan(&keys).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list foreign keys on %s.%s: %w", tenantSchema, def.FromTable, err)
+	}
+	return keys, nil
+}
+
+// targets reports whether the constraint references the def's target
+func (key foreignKey) targets(def FKDef) bool {
+	return key.TargetSchema == def.ToSchema && key.TargetTable == def.ToTable && key.TargetColumn == def.ToColumn
+}
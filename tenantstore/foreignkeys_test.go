@@ -0,0 +1,96 @@
+package tenantstore
+
+import (
+	"context"
+	"testing"
+)
+
+type FKPlan struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+type FKSubscription struct {
+	ID     uint `gorm:"primaryKey"`
+	PlanID uint
+	Plan   FKPlan
+}
+
+func TestCrossSchemaFKsTargetPublic(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.AutoMigrate = true
+	config.Models = []interface{}{&FKSubscription{}}
+	config.CrossSchemaFKs = []FKDef{
+		{FromTable: "fk_subscriptions", FromColumn: "plan_id", ToTable: "fk_plans"},
+	}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	master := store.GetMasterDB()
+
+	// A tenant-local copy of the shared table captures GORM's constraint
+	// through the search_path
+	for _, statement := range []string{
+		"CREATE TABLE public.fk_plans (id bigserial PRIMARY KEY, name text)",
+		"CREATE SCHEMA tenant_a",
+		"CREATE TABLE tenant_a.fk_plans (id bigserial PRIMARY KEY, name text)",
+	} {
+		if err := master.Exec(statement).Error; err != nil {
+			t.Fatalf("Failed to set up shared table: %v", err)
+		}
+	}
+
+	if _, err := store.GetTenantDB(ctx, "tenant_a"); err != nil {
+		t.Fatalf("Failed to create tenant: %v", err)
+	}
+
+	def := config.CrossSchemaFKs[0].withDefaults()
+	keys, err := columnForeignKeys(ctx, master, "tenant_a", def)
+	if err != nil {
+		t.Fatalf("Failed to list foreign keys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].TargetSchema != "public" || keys[0].Name != "fk_subscriptions_plan_id_fkey" {
+		t.Fatalf("Expected a single constraint targeting public, got %+v", keys)
+	}
+
+	issues, err := store.VerifyForeignKeys(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to verify foreign keys: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("Expected no issues, got %+v", issues)
+	}
+
+	// A constraint pointing at the local copy is reported, as is the
+	// declared one once it is gone
+	for _, statement := range []string{
+		"ALTER TABLE tenant_a.fk_subscriptions ADD CONSTRAINT local_plan FOREIGN KEY (plan_id) REFERENCES tenant_a.fk_plans (id)",
+		"ALTER TABLE tenant_a.fk_subscriptions DROP CONSTRAINT fk_subscriptions_plan_id_fkey",
+	} {
+		if err := master.Exec(statement).Error; err != nil {
+			t.Fatalf("Failed to alter constraints: %v", err)
+		}
+	}
+
+	issues, err = store.VerifyForeignKeys(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to verify foreign keys: %v", err)
+	}
+	if len(issues) != 2 || issues[0].Constraint != "local_plan" || issues[0].TargetSchema != "tenant_a" || issues[1].Constraint != "" {
+		t.Fatalf("Expected wrong and missing constraint issues, got %+v", issues)
+	}
+
+	if err := store.ApplyForeignKeys(ctx, "tenant_a"); err != nil {
+		t.Fatalf("Failed to apply foreign keys: %v", err)
+	}
+	if issues, _ := store.VerifyForeignKeys(ctx, "tenant_a"); len(issues) != 0 {
+		t.Fatalf("Expected apply to fix the constraints, got %+v", issues)
+	}
+}
@@ -0,0 +1,129 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"gorm.io/gorm"
+)
+
+// grantPrefixes are the statements Config.PostCreateGrants may hold
+var grantPrefixes = []string{"GRANT ", "REVOKE ", "ALTER DEFAULT PRIVILEGES "}
+
+// grantTemplateData is passed to Config.PostCreateGrants
+type grantTemplateData struct {
+	Schema string
+}
+
+// renderGrants expands Config.PostCreateGrants for the schema. Each template
+// must render to a single GRANT, REVOKE or ALTER DEFAULT PRIVILEGES
+// statement.
+func renderGrants(grants []string, tenantSchema string) ([]string, error) {
+	if err := validateSchemaName(tenantSchema); err != nil {
+		return nil, err
+	}
+	data := grantTemplateData{Schema: quoteIdentifier(tenantSchema)}
+
+	statements := make([]string, 0, len(grants))
+	for i, grant := range grants {
+		// Only the quoted schema may hold a semicolon
+		grant = strings.TrimSuffix(strings.TrimSpace(grant), ";")
+		if strings.Contains(grant, ";") {
+			return nil, fmt.Errorf("PostCreateGrants[%d] must be a single statement: %q", i, grant)
+		}
+		tmpl, err := template.New("grant").Option("missingkey=error").Parse(grant)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PostCreateGrants[%d]: %w", i, err)
+		}
+		var statement strings.Builder
+		if err := tmpl.Execute(&statement, data); err != nil {
+			return nil, fmt.Errorf("failed to render PostCreateGrants[%d]: %w", i, err)
+		}
+
+		sql := statement.String()
+		upper := strings.ToUpper(strings.Join(strings.Fields(sql), " ")) + " "
+		allowed := false
+		for _, prefix := range grantPrefixes {
+			allowed = allowed || strings.HasPrefix(upper, prefix)
+		}
+		if !allowed {
+			return nil, fmt.Errorf("PostCreateGrants[%d] must be a GRANT, REVOKE or ALTER DEFAULT PRIVILEGES statement: %q", i, sql)
+		}
+		statements = append(statements, sql)
+	}
+	return statements, nil
+}
+
+// checkGrants validates Config.PostCreateGrants in New, so mistakes surface
+// before the first tenant is provisioned
+func checkGrants(config *Config) error {
+	_, err := renderGrants(config.PostCreateGrants, "tenant")
+	return err
+}
+
+// applyGrants runs Config.PostCreateGrants for the schema on db, which must
+// own it, in one transaction. Other databases than PostgreSQL, such as
+// SQLite in tests, are skipped.
+func (s *TenantStore) applyGrants(ctx context.Context, db *gorm.DB, tenantSchema string) error {
+	grants := s.config().PostCreateGrants
+	if len(grants) == 0 || db.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	statements, err := renderGrants(grants, tenantSchema)
+	if err != nil {
+		return err
+	}
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply grants to %s: %w", tenantSchema, err)
+	}
+	return nil
+}
+
+// ApplyGrants runs Config.PostCreateGrants on an existing tenant schema, to
+// backfill tenants provisioned before the grants were configured or
+// changed. Schemas that do not exist fail with ErrSchemaNotFound.
+func (s *TenantStore) ApplyGrants(ctx context.Context, tenantSchema string) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+	if _, err := s.schemaTables(ctx, tenantSchema); err != nil {
+		return err
+	}
+
+	if s.config().GetMigrationDSN != nil {
+		migrationDB, err := s.openMigrationDB(tenantSchema)
+		if err != nil {
+			return err
+		}
+		defer closeDB(migrationDB)
+
+		return s.applyGrants(ctx, migrationDB, tenantSchema)
+	}
+	return s.applyGrants(ctx, s.master(), tenantSchema)
+}
+
+// publicSchemaPrivileges returns the privileges PUBLIC holds on the schema,
+// such as "USAGE", from its ACL or the default ACL when it has none
+func publicSchemaPrivileges(ctx context.Context, db *gorm.DB, tenantSchema string) ([]string, error) {
+	var privileges []string
+	err := db.WithContext(ctx).Raw(`
+		SELECT acl.privilege_type
+		FROM pg_namespace n, aclexplode(COALESCE(n.nspacl, acldefault('n', n.nspowner))) acl
+		WHERE n.nspname = ? AND acl.grantee = 0
+		ORDER BY acl.privilege_type`, tenantSchema).Scan(&privileges).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read privileges of %s: %w", tenantSchema, err)
+	}
+	return privileges, nil
+}
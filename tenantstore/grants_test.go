@@ -0,0 +1,144 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRenderGrants(t *testing.T) {
+	statements, err := renderGrants([]string{
+		"REVOKE ALL ON SCHEMA {{.Schema}} FROM PUBLIC;",
+		"grant usage on schema {{.Schema}} to app",
+		"ALTER DEFAULT PRIVILEGES IN SCHEMA {{.Schema}}\n\tGRANT SELECT ON TABLES TO app",
+	}, "acme")
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	want := []string{
+		`REVOKE ALL ON SCHEMA "acme" FROM PUBLIC`,
+		`grant usage on schema "acme" to app`,
+		"ALTER DEFAULT PRIVILEGES IN SCHEMA \"acme\"\n\tGRANT SELECT ON TABLES TO app",
+	}
+	if strings.Join(statements, "|") != strings.Join(want, "|") {
+		t.Fatalf("Expected %q, got %q", want, statements)
+	}
+
+	// Schema names cannot break out of the identifier
+	statements, err = renderGrants([]string{"GRANT USAGE ON SCHEMA {{.Schema}} TO app"}, `x" TO PUBLIC; --`)
+	if err != nil || statements[0] != `GRANT USAGE ON SCHEMA "x"" TO PUBLIC; --" TO app` {
+		t.Fatalf("Expected the name to be quoted, got %q (%v)", statements, err)
+	}
+
+	for _, grant := range []string{
+		"DROP SCHEMA {{.Schema}}",
+		"GRANT USAGE ON SCHEMA {{.Schema}} TO app; DROP TABLE users",
+		"GRANT USAGE ON SCHEMA {{.Tenant}} TO app",
+		"GRANT USAGE ON SCHEMA {{.Schema TO app",
+	} {
+		if _, err := renderGrants([]string{grant}, "acme"); err == nil {
+			t.Fatalf("Expected %q to be rejected", grant)
+		}
+	}
+	if _, err := renderGrants([]string{"GRANT USAGE ON SCHEMA {{.Schema}} TO app"}, ""); err == nil {
+		t.Fatal("Expected an empty schema to be rejected")
+	}
+}
+
+func TestNewRejectsInvalidGrants(t *testing.T) {
+	config := DefaultConfig("")
+	config.PostCreateGrants = []string{"DROP SCHEMA {{.Schema}} CASCADE"}
+	if _, err := New(config); err == nil || !strings.Contains(err.Error(), "PostCreateGrants[0]") {
+		t.Fatalf("Expected New to reject the grant, got %v", err)
+	}
+}
+
+// grantsTestRole is granted privileges on the tenant schemas of the tests
+const grantsTestRole = "mt_grants_app"
+
+func TestPostCreateGrants(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	newStore := func(grants ...string) *TenantStore {
+		config := DefaultConfig(dsn)
+		config.Models = []interface{}{&TestModel{}}
+		config.PostCreateGrants = grants
+		store, err := New(config)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	}
+	plain := newStore()
+	store := newStore(
+		"REVOKE ALL ON SCHEMA {{.Schema}} FROM PUBLIC",
+		"GRANT USAGE ON SCHEMA {{.Schema}} TO "+grantsTestRole,
+		"ALTER DEFAULT PRIVILEGES IN SCHEMA {{.Schema}} GRANT SELECT ON TABLES TO "+grantsTestRole,
+	)
+
+	ctx := context.Background()
+	master := store.GetMasterDB()
+	err := master.Exec(`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = '` + grantsTestRole + `') THEN
+			CREATE ROLE ` + grantsTestRole + ` NOLOGIN;
+		END IF;
+	END $$`).Error
+	if err != nil {
+		t.Fatalf("Failed to create role: %v", err)
+	}
+
+	// A tenant provisioned before the grants were configured
+	const before, after = "tenant_grants_before", "tenant_grants_after"
+	if _, err := plain.GetTenantDB(ctx, before); err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	master.Exec("GRANT USAGE ON SCHEMA " + before + " TO PUBLIC")
+
+	if _, err := store.GetTenantDB(ctx, after); err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	// The schema ACL has the grant, and tables migrated afterwards got the
+	// default privileges
+	var usage bool
+	if err := master.Raw("SELECT has_schema_privilege(?, ?, 'USAGE')", grantsTestRole, after).Scan(&usage).Error; err != nil || !usage {
+		t.Fatalf("Expected USAGE for %s on %s, got %v (%v)", grantsTestRole, after, usage, err)
+	}
+	var acl string
+	master.Raw("SELECT nspacl::text FROM pg_namespace WHERE nspname = ?", after).Scan(&acl)
+	if !strings.Contains(acl, grantsTestRole+"=U/") {
+		t.Fatalf("Expected the grant in nspacl, got %s", acl)
+	}
+	var tableGrants []string
+	master.Raw(`SELECT privilege_type FROM information_schema.role_table_grants
+		WHERE table_schema = ? AND table_name = 'test_models' AND grantee = ?`, after, grantsTestRole).Scan(&tableGrants)
+	if len(tableGrants) != 1 || tableGrants[0] != "SELECT" {
+		t.Fatalf("Expected SELECT on test_models, got %v", tableGrants)
+	}
+	if privileges, err := publicSchemaPrivileges(ctx, master, after); err != nil || len(privileges) != 0 {
+		t.Fatalf("Expected PUBLIC to have no privileges, got %v (%v)", privileges, err)
+	}
+
+	// ApplyGrants backfills the earlier tenant
+	if privileges, _ := publicSchemaPrivileges(ctx, master, before); len(privileges) != 1 || privileges[0] != "USAGE" {
+		t.Fatalf("Expected PUBLIC to have USAGE before the backfill, got %v", privileges)
+	}
+	if err := store.ApplyGrants(ctx, before); err != nil {
+		t.Fatalf("Failed to apply grants: %v", err)
+	}
+	if privileges, _ := publicSchemaPrivileges(ctx, master, before); len(privileges) != 0 {
+		t.Fatalf("Expected PUBLIC to have no privileges after the backfill, got %v", privileges)
+	}
+	if err := store.ApplyGrants(ctx, "tenant_grants_missing"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("Expected ErrSchemaNotFound, got %v", err)
+	}
+
+	// SelfCheck reports privileges left to PUBLIC
+	report, err := newStore("GRANT USAGE ON SCHEMA {{.Schema}} TO PUBLIC").SelfCheck(ctx)
+	if failed := report.Failed(); err == nil || failed == nil || failed.Name != SelfCheckGrants {
+		t.Fatalf("Expected the grants step to fail, got %+v (%v)", report.Steps, err)
+	}
+}
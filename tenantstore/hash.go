@@ -0,0 +1,19 @@
+package tenantstore
+
+import "hash/fnv"
+
+// TenantHash maps a tenant schema to one of buckets, from 0 to buckets-1,
+// for routing decisions such as picking a queue partition, a cache key
+// prefix or a shard. The result is the 32-bit FNV-1a hash of the schema's
+// bytes modulo buckets; it is part of the API and will not change between
+// versions, so buckets can be stored or computed by other services.
+// middleware.GetTenantBucket uses the same algorithm. TenantHash panics if
+// buckets is less than 1.
+func TenantHash(schema string, buckets int) int {
+	if buckets < 1 {
+		panic("tenantstore: TenantHash buckets must be positive")
+	}
+	h := fnv.New32a()
+	h.Write([]byte(schema))
+	return int(uint64(h.Sum32()) % uint64(buckets))
+}
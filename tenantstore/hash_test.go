@@ -0,0 +1,34 @@
+package tenantstore
+
+import "testing"
+
+// TenantHash is part of the API: these outputs must never change
+func TestTenantHashGolden(t *testing.T) {
+	tests := []struct {
+		schema  string
+		buckets int
+		want    int
+	}{
+		{"", 1000, 261},
+		{"tenant_a", 16, 13},
+		{"tenant_a", 1000, 37},
+		{"tenant_b", 16, 4},
+		{"tenant_b", 1000, 180},
+		{"acme", 1000, 615},
+		{"Acme", 1000, 335},
+		{"über", 1000, 511},
+		{"acme", 1, 0},
+	}
+	for _, tt := range tests {
+		if got := TenantHash(tt.schema, tt.buckets); got != tt.want {
+			t.Fatalf("Expected TenantHash(%q, %d) = %d, got %d", tt.schema, tt.buckets, tt.want, got)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic for zero buckets")
+		}
+	}()
+	TenantHash("acme", 0)
+}
@@ -0,0 +1,228 @@
+package tenantstore
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// tenantHealth is the outcome of the health checker's last ping of a cached
+// tenant connection
+type tenantHealth struct {
+	// checked is the UnixNano time of the last ping, zero before the first
+	checked atomic.Int64
+
+	// err is the error of the last ping, nil if it answered
+	err atomic.Pointer[string]
+}
+
+// healthChecker pings the cached tenant connections every
+// Config.HealthCheckInterval
+type healthChecker struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Health reports the state of the store's connections
+type Health struct {
+	MasterReachable   bool   `json:"master_reachable"`
+	MasterError       string `json:"master_error,omitempty"`
+	TenantConnections int    `json:"tenant_connections"`
+
+	// Listener is set when Config.Notifications is on
+	Listener *ListenerHealth `json:"listener,omitempty"`
+
+	// LongTransactions are the findings of the watchdog's last check
+	LongTransactions []LongTransaction `json:"long_transactions,omitempty"`
+
+	// UnhealthyTenants maps the cached tenant connections whose last health
+	// check failed to the error
+	UnhealthyTenants map[string]string `json:"unhealthy_tenants,omitempty"`
+}
+
+// Healthy reports whether the master database is reachable and the
+// notification listener, if any, is connected
+func (h Health) Healthy() bool {
+	return h.MasterReachable && (h.Listener == nil || h.Listener.Connected)
+}
+
+// Health pings the master database and reports the cached tenant
+// connections with the failures of the health checker, the notification
+// listener and long transactions
+func (s *TenantStore) Health(ctx context.Context) Health {
+	var health Health
+
+	if sqlDB, err := s.master().DB(); err != nil {
+		health.MasterError = err.Error()
+	} else if err := sqlDB.PingContext(ctx); err != nil {
+		health.MasterError = err.Error()
+	} else {
+		health.MasterReachable = true
+	}
+
+	s.mu.RLock()
+	health.TenantConnections = len(s.tenantDBs)
+	for tenantSchema, tenant := range s.health {
+		if err := tenant.err.Load(); err != nil {
+			if health.UnhealthyTenants == nil {
+				health.UnhealthyTenants = make(map[string]string)
+			}
+			health.UnhealthyTenants[tenantSchema] = *err
+		}
+	}
+	s.mu.RUnlock()
+
+	if s.listener != nil {
+		listener := s.listener.snapshot()
+		health.Listener = &listener
+	}
+	health.LongTransactions = s.longTransactions()
+	return health
+}
+
+// PingTenants pings up to limit cached tenant connections, picked at random,
+// and returns the error of each pinged schema, nil if it answered. It never
+// opens a connection or creates a schema, so readiness probes may call it.
+func (s *TenantStore) PingTenants(ctx context.Context, limit int) map[string]error {
+	s.mu.RLock()
+	dbs := make(map[string]*gorm.DB, len(s.tenantDBs))
+	for schema, db := range s.tenantDBs {
+		dbs[schema] = db
+	}
+	s.mu.RUnlock()
+
+	schemas := make([]string, 0, len(dbs))
+	for schema := range dbs {
+		schemas = append(schemas, schema)
+	}
+	rand.Shuffle(len(schemas), func(i, j int) { schemas[i], schemas[j] = schemas[j], schemas[i] })
+	if limit < len(schemas) {
+		schemas = schemas[:max(limit, 0)]
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]error, len(schemas))
+	)
+	for _, schema := range schemas {
+		wg.Add(1)
+		go func(schema string) {
+			defer wg.Done()
+			sqlDB, err := dbs[schema].DB()
+			if err == nil {
+				err = sqlDB.PingContext(ctx)
+			}
+			mu.Lock()
+			results[schema] = err
+			mu.Unlock()
+		}(schema)
+	}
+	wg.Wait()
+	return results
+}
+
+// startHealthChecker starts pinging the cached tenant connections if
+// HealthCheckInterval is set. UpdateConfig restarts it when the interval
+// changes.
+func (s *TenantStore) startHealthChecker() {
+	interval := s.config().HealthCheckInterval
+	if interval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hc := &healthChecker{cancel: cancel, done: make(chan struct{})}
+	s.healthChecker = hc
+
+	go func() {
+		defer close(hc.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			s.checkTenantHealth(ctx)
+		}
+	}()
+}
+
+// stopHealthChecker stops the health checker and waits for it to return
+func (s *TenantStore) stopHealthChecker() {
+	if s.healthChecker == nil {
+		return
+	}
+	s.healthChecker.cancel()
+	<-s.healthChecker.done
+	s.healthChecker = nil
+}
+
+// unhealthy reports whether the last health check of a cached tenant
+// connection failed. Callers hold mu.
+func (s *TenantStore) unhealthy(tenantSchema string) bool {
+	health := s.health[tenantSchema]
+	return health != nil && health.err.Load() != nil
+}
+
+// checkTenantHealth pings each cached tenant connection, one at a time and
+// each within ConnectionTimeout, and records the outcome. Requests never
+// wait for it; GetTenantDB re-dials a pool whose ping failed on its next
+// use.
+func (s *TenantStore) checkTenantHealth(ctx context.Context) {
+	type check struct {
+		schema string
+		db     *gorm.DB
+		health *tenantHealth
+	}
+
+	s.mu.RLock()
+	checks := make([]check, 0, len(s.tenantDBs))
+	for tenantSchema, db := range s.tenantDBs {
+		if health := s.health[tenantSchema]; health != nil {
+			checks = append(checks, check{tenantSchema, db, health})
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, c := range checks {
+		if ctx.Err() != nil {
+			return
+		}
+
+		pingCtx, cancel := s.pingContext(ctx)
+		sqlDB, err := c.db.DB()
+		if err == nil {
+			err = sqlDB.PingContext(pingCtx)
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.health.checked.Store(time.Now().UnixNano())
+		if err != nil {
+			message := err.Error()
+			c.health.err.Store(&message)
+			s.config().Logger.Warn(ctx, "health check of %s failed: %v", c.schema, err)
+		} else {
+			c.health.err.Store(nil)
+		}
+	}
+}
+
+// pingContext bounds a health check ping by Config.ConnectionTimeout
+func (s *TenantStore) pingContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config().ConnectionTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.config().ConnectionTimeout)
+}
@@ -0,0 +1,193 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPingTenants(t *testing.T) {
+	store := newSQLiteTenantStore(t, "ping_tenants")
+	ctx := context.Background()
+
+	pings := store.PingTenants(ctx, 10)
+	if err, ok := pings["acme"]; len(pings) != 1 || !ok || err != nil {
+		t.Fatalf("Expected acme to answer, got %v", pings)
+	}
+
+	sqlDB, err := store.tenantDBs["acme"].DB()
+	if err != nil {
+		t.Fatalf("Failed to get pool: %v", err)
+	}
+	sqlDB.Close()
+	if err := store.PingTenants(ctx, 10)["acme"]; err == nil {
+		t.Fatal("Expected an error from a closed pool")
+	}
+
+	if pings := store.PingTenants(ctx, 0); len(pings) != 0 {
+		t.Fatalf("Expected no pings for a zero limit, got %v", pings)
+	}
+	if len(store.tenantDBs) != 1 {
+		t.Fatalf("Expected no new connections, got %d", len(store.tenantDBs))
+	}
+}
+
+func TestHealthChecker(t *testing.T) {
+	store := newSQLiteTenantStore(t, "health_checker", func(config *Config) {
+		// Re-dials fail fast
+		config.GetTenantDSN = func(string) string { return "host=127.0.0.1 port=1 connect_timeout=1" }
+	})
+	cacheSQLiteTenants(t, store, "globex")
+	store.health = map[string]*tenantHealth{"acme": {}, "globex": {}}
+	interval := 5 * time.Millisecond
+	if err := store.UpdateConfig(ConfigPatch{HealthCheckInterval: &interval}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if store.healthChecker == nil {
+		t.Fatal("Expected UpdateConfig to start the checker")
+	}
+	baseline := runtime.NumGoroutine()
+
+	// Cache hits neither ping nor start goroutines
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for deadline := time.Now().Add(100 * time.Millisecond); time.Now().Before(deadline); {
+				if _, err := store.GetTenantDB(ctx, "acme"); err != nil {
+					t.Errorf("Failed to get tenant DB: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if goroutines := runtime.NumGoroutine(); goroutines > baseline {
+		t.Fatalf("Expected no goroutine growth from %d, got %d", baseline, goroutines)
+	}
+	if store.health["acme"].checked.Load() == 0 || store.health["acme"].err.Load() != nil {
+		t.Fatal("Expected the checker to have pinged acme")
+	}
+
+	// Failed pings are reported by Health
+	sqlDB, _ := store.tenantDBs["globex"].DB()
+	sqlDB.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		health := store.Health(ctx)
+		if _, ok := health.UnhealthyTenants["globex"]; ok && len(health.UnhealthyTenants) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected globex to be unhealthy, got %v", health.UnhealthyTenants)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Failed pools are re-dialed instead of handed out
+	if db, err := store.GetTenantDB(ctx, "globex"); err == nil {
+		t.Fatalf("Expected the re-dial to fail, got %v", db)
+	}
+
+	// Stopping waits for the checker
+	checker := store.healthChecker
+	store.stopHealthChecker()
+	select {
+	case <-checker.done:
+	default:
+		t.Fatal("Expected the checker to have stopped")
+	}
+}
+
+func TestUpdateConfigRestartsHealthChecker(t *testing.T) {
+	store := newSQLiteTenantStore(t, "health_checker_restart")
+	store.health = map[string]*tenantHealth{"acme": {}}
+	t.Cleanup(store.stopHealthChecker)
+
+	disabled := time.Duration(0)
+	if err := store.UpdateConfig(ConfigPatch{HealthCheckInterval: &disabled}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if store.healthChecker != nil {
+		t.Fatal("Expected a zero interval to stop the checker")
+	}
+
+	interval := 5 * time.Millisecond
+	if err := store.UpdateConfig(ConfigPatch{HealthCheckInterval: &interval}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for store.health["acme"].checked.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the restarted checker to ping acme")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	store.Close()
+	if err := store.UpdateConfig(ConfigPatch{HealthCheckInterval: &disabled}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if err := store.UpdateConfig(ConfigPatch{HealthCheckInterval: &interval}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if store.healthChecker != nil {
+		t.Fatal("Expected UpdateConfig not to restart the checker of a closed store")
+	}
+}
+
+func TestFailedHealthCheckReopensPool(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.HealthCheckInterval = 10 * time.Millisecond
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	tenant := fmt.Sprintf("test_health_reopen_%d", time.Now().UnixNano())
+	defer store.master().Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", tenant))
+
+	broken, err := store.GetTenantDB(ctx, tenant)
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	sqlDB, err := broken.DB()
+	if err != nil {
+		t.Fatalf("Failed to get pool: %v", err)
+	}
+	sqlDB.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := store.Health(ctx).UnhealthyTenants[tenant]; ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the health check to fail")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	db, err := store.GetTenantDB(ctx, tenant)
+	if err != nil {
+		t.Fatalf("Failed to reopen tenant DB: %v", err)
+	}
+	if db == broken {
+		t.Fatal("Expected the failed pool to be reopened")
+	}
+	if err := db.Exec("SELECT 1").Error; err != nil {
+		t.Fatalf("Expected the reopened pool to answer, got %v", err)
+	}
+	if _, ok := store.Health(ctx).UnhealthyTenants[tenant]; ok {
+		t.Fatal("Expected the reopened pool to be healthy")
+	}
+}
@@ -0,0 +1,30 @@
+package tenantstore
+
+import "gorm.io/gorm"
+
+// SchemaSettingKey is the GORM setting holding the tenant schema of every
+// tenant DB returned by the store
+const SchemaSettingKey = "multitenant:schema"
+
+// WithSchema returns a session of db carrying the schema for SchemaFromDB.
+// Chained calls, WithContext, Session and transactions keep the value;
+// Session with NewDB drops it. Custom stores call it on the DBs they return.
+func WithSchema(db *gorm.DB, schema string) *gorm.DB {
+	return db.Set(SchemaSettingKey, schema).Session(&gorm.Session{})
+}
+
+// SchemaFromDB returns the tenant schema attached to db, so model hooks can
+// tell which tenant they run for:
+//
+//	func (o *Order) BeforeCreate(tx *gorm.DB) error {
+//		o.TenantSlug, _ = tenantstore.SchemaFromDB(tx)
+//		return nil
+//	}
+func SchemaFromDB(db *gorm.DB) (string, bool) {
+	value, ok := db.Get(SchemaSettingKey)
+	if !ok {
+		return "", false
+	}
+	schema, ok := value.(string)
+	return schema, ok
+}
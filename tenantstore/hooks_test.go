@@ -0,0 +1,59 @@
+package tenantstore
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type HookModel struct {
+	ID         uint `gorm:"primaryKey"`
+	TenantSlug string
+}
+
+func (m *HookModel) BeforeCreate(tx *gorm.DB) error {
+	m.TenantSlug, _ = SchemaFromDB(tx)
+	return nil
+}
+
+func TestSchemaFromDBInHooks(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&HookModel{}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for _, tenant := range []string{"tenant_a", "tenant_b"} {
+		db, err := store.GetTenantDB(ctx, tenant)
+		if err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+
+		// Derived sessions and transactions keep the schema
+		err = db.WithContext(ctx).Session(&gorm.Session{}).Transaction(func(tx *gorm.DB) error {
+			return tx.Create(&HookModel{}).Error
+		})
+		if err != nil {
+			t.Fatalf("Failed to create record: %v", err)
+		}
+
+		var model HookModel
+		if err := db.First(&model).Error; err != nil {
+			t.Fatalf("Failed to load record: %v", err)
+		}
+		if model.TenantSlug != tenant {
+			t.Fatalf("Expected hook to see %s, got %q", tenant, model.TenantSlug)
+		}
+	}
+
+	if _, ok := SchemaFromDB(store.GetMasterDB()); ok {
+		t.Fatal("Expected no schema on the master DB")
+	}
+}
@@ -0,0 +1,182 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// IDStrategy sets up primary key generation in a tenant schema. Apply runs
+// after every AutoMigrate of the schema, so it must be idempotent.
+// Implementations can install custom defaults, such as a snowflake function.
+type IDStrategy interface {
+	Apply(ctx context.Context, db *gorm.DB, tenantSchema string) error
+}
+
+// Serial leaves sequences as AutoMigrate creates them, so every tenant counts
+// from 1. It is the default.
+type Serial struct{}
+
+// Apply does nothing
+func (Serial) Apply(ctx context.Context, db *gorm.DB, tenantSchema string) error {
+	return nil
+}
+
+// OffsetSerial makes the sequences of each tenant step by Stride from a
+// per-tenant offset, so IDs never overlap across tenants. Offsets are
+// allocated once per schema in public.mt_id_offsets, which limits the number
+// of tenants to Stride. Existing sequences are moved to the next free ID of
+// their offset, never backwards.
+type OffsetSerial struct {
+	Stride int
+}
+
+// Apply allocates the tenant's offset and adjusts every sequence in the
+// schema that doesn't step by Stride yet
+func (o OffsetSerial) Apply(ctx context.Context, db *gorm.DB, tenantSchema string) error {
+	if o.Stride < 1 {
+		return fmt.Errorf("offset serial stride must be positive")
+	}
+
+	db = db.WithContext(ctx)
+
+	setup := []string{
+		"CREATE SEQUENCE IF NOT EXISTS public.mt_id_offset_seq",
+		"CREATE TABLE IF NOT EXISTS public.mt_id_offsets (schema_name text PRIMARY KEY, id_offset bigint NOT NULL UNIQUE)",
+	}
+	for _, statement := range setup {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to create ID offset table: %w", err)
+		}
+	}
+
+	// Only draw from the sequence when the schema has no offset yet
+	err := db.Exec(`
+		INSERT INTO public.mt_id_offsets (schema_name, id_offset)
+		SELECT ?, nextval('public.mt_id_offset_seq')
+		WHERE NOT EXISTS (SELECT 1 FROM public.mt_id_offsets WHERE schema_name = ?)
+		ON CONFLICT (schema_name) DO NOTHING`, tenantSchema, tenantSchema).Error
+	if err != nil {
+		return fmt.Errorf("failed to allocate ID offset for %s: %w", tenantSchema, err)
+	}
+
+	var offset int64
+	if err := db.Raw("SELECT id_offset FROM public.mt_id_offsets WHERE schema_name = ?", tenantSchema).Scan(&offset).Error; err != nil {
+		return fmt.Errorf("failed to look up ID offset for %s: %w", tenantSchema, err)
+	}
+	if offset > int64(o.Stride) {
+		return fmt.Errorf("ID offset %d for %s exceeds stride %d", offset, tenantSchema, o.Stride)
+	}
+
+	var sequences []struct {
+		SequenceName string
+		IncrementBy  int64
+		LastValue    *int64
+	}
+	if err := db.Raw(`
+		SELECT sequencename AS sequence_name, increment_by, last_value
+		FROM pg_sequences WHERE schemaname = ?`, tenantSchema).Scan(&sequences).Error; err != nil {
+		return fmt.Errorf("failed to list sequences for %s: %w", tenantSchema, err)
+	}
+
+	stride := int64(o.Stride)
+	for _, seq := range sequences {
+		if seq.IncrementBy == stride {
+			continue
+		}
+
+		qualified := quoteIdentifier(tenantSchema) + "." + quoteIdentifier(seq.SequenceName)
+		next := nextOffsetID(seq.LastValue, offset, stride)
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(fmt.Sprintf("ALTER SEQUENCE %s INCREMENT BY %d", qualified, stride)).Error; err != nil {
+				return err
+			}
+			return tx.Exec("SELECT setval(?::regclass, ?, false)", qualified, next).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to offset sequence %s: %w", qualified, err)
+		}
+	}
+	return nil
+}
+
+// nextOffsetID returns the smallest ID after last that belongs to offset
+func nextOffsetID(last *int64, offset, stride int64) int64 {
+	if last == nil || *last < offset {
+		return offset
+	}
+	return offset + ((*last-offset)/stride+1)*stride
+}
+
+// UUIDDefault gives uuid primary key columns without a default the SQL
+// expression in Function, gen_random_uuid() (PostgreSQL 13+) if empty
+type UUIDDefault struct {
+	Function string
+}
+
+// Apply sets the default on every uuid primary key column in the schema that
+// has none
+func (u UUIDDefault) Apply(ctx context.Context, db *gorm.DB, tenantSchema string) error {
+	function := u.Function
+	if function == "" {
+		function = "gen_random_uuid()"
+	}
+
+	db = db.WithContext(ctx)
+
+	var columns []struct {
+		TableName  string
+		ColumnName string
+	}
+	err := db.Raw(`
+		SELECT c.table_name, c.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage k
+			ON k.constraint_schema = tc.constraint_schema AND k.constraint_name = tc.constraint_name
+		JOIN information_schema.columns c
+			ON c.table_schema = k.table_schema AND c.table_name = k.table_name AND c.column_name = k.column_name
+		WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = ?
+		AND c.data_type = 'uuid' AND c.column_default IS NULL`, tenantSchema).Scan(&columns).Error
+	if err != nil {
+		return fmt.Errorf("failed to list uuid keys for %s: %w", tenantSchema, err)
+	}
+
+	for _, col := range columns {
+		statement := fmt.Sprintf("ALTER TABLE %s.%s ALTER COLUMN %s SET DEFAULT %s",
+			quoteIdentifier(tenantSchema), quoteIdentifier(col.TableName), quoteIdentifier(col.ColumnName), function)
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to set uuid default on %s.%s: %w", col.TableName, col.ColumnName, err)
+		}
+	}
+	return nil
+}
+
+// ApplyIDStrategy applies Config.IDStrategy to an existing tenant schema, for
+// example after switching strategies. New schemas get it after AutoMigrate.
+func (s *TenantStore) ApplyIDStrategy(ctx context.Context, tenantSchema string) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+
+	if s.config().GetMigrationDSN != nil {
+		migrationDB, err := s.openMigrationDB(tenantSchema)
+		if err != nil {
+			return err
+		}
+		defer closeDB(migrationDB)
+
+		return s.applyIDStrategy(ctx, migrationDB, tenantSchema)
+	}
+
+	return s.applyIDStrategy(ctx, s.master(), tenantSchema)
+}
+
+// applyIDStrategy runs Config.IDStrategy on db
+func (s *TenantStore) applyIDStrategy(ctx context.Context, db *gorm.DB, tenantSchema string) error {
+	if s.config().IDStrategy == nil {
+		return nil
+	}
+	return s.config().IDStrategy.Apply(ctx, db, tenantSchema)
+}
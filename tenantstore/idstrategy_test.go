@@ -0,0 +1,121 @@
+package tenantstore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOffsetSerialIDsDoNotOverlap(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.AutoMigrate = true
+	config.Models = []interface{}{&TestModel{}}
+	config.IDStrategy = OffsetSerial{Stride: 100}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	seen := map[uint]string{}
+
+	insert := func(tenant string, n int) {
+		t.Helper()
+
+		db, err := store.GetTenantDB(ctx, tenant)
+		if err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+		for i := 0; i < n; i++ {
+			model := TestModel{Name: tenant}
+			if err := db.Create(&model).Error; err != nil {
+				t.Fatalf("Failed to create record: %v", err)
+			}
+			if other, ok := seen[model.ID]; ok {
+				t.Fatalf("ID %d of %s collides with %s", model.ID, tenant, other)
+			}
+			seen[model.ID] = tenant
+		}
+	}
+
+	insert("tenant_a", 3)
+	insert("tenant_b", 3)
+
+	// Re-applying the strategy keeps each tenant on its offset
+	if err := store.MigrateTenant(ctx, "tenant_a"); err != nil {
+		t.Fatalf("Failed to re-migrate tenant: %v", err)
+	}
+	insert("tenant_a", 2)
+
+	offsets := map[string]uint{}
+	for id, tenant := range seen {
+		if offset, ok := offsets[tenant]; ok && offset != id%100 {
+			t.Fatalf("Expected %s IDs to share one offset, got %d and %d", tenant, offset, id%100)
+		}
+		offsets[tenant] = id % 100
+	}
+	if offsets["tenant_a"] == offsets["tenant_b"] {
+		t.Fatalf("Expected distinct offsets, got %v", offsets)
+	}
+}
+
+func TestApplyIDStrategyToExistingTenant(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.AutoMigrate = true
+	config.Models = []interface{}{&TestModel{}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	db, err := store.GetTenantDB(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		db.Create(&TestModel{Name: "serial"})
+	}
+
+	reconfigure(store, func(config *Config) {
+		config.IDStrategy = OffsetSerial{Stride: 10}
+	})
+	if err := store.ApplyIDStrategy(ctx, "tenant_a"); err != nil {
+		t.Fatalf("Failed to apply ID strategy: %v", err)
+	}
+
+	model := TestModel{Name: "offset"}
+	db.Create(&model)
+	if model.ID != 11 {
+		t.Fatalf("Expected the next ID after 5 on offset 1 to be 11, got %d", model.ID)
+	}
+}
+
+func TestNextOffsetID(t *testing.T) {
+	last := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		last   *int64
+		offset int64
+		want   int64
+	}{
+		{nil, 3, 3},
+		{last(1), 3, 3},
+		{last(3), 3, 103},
+		{last(57), 3, 103},
+		{last(103), 3, 203},
+	}
+
+	for _, tt := range tests {
+		if got := nextOffsetID(tt.last, tt.offset, 100); got != tt.want {
+			t.Fatalf("Expected %d, got %d", tt.want, got)
+		}
+	}
+}
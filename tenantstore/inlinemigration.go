@@ -0,0 +1,155 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// ErrMigrationPending is returned by GetTenantDB for existing schemas with
+// changes to Config.Models that may not be applied inside a request, see
+// Config.InlineMigration. The middleware responds with 503.
+var ErrMigrationPending error = &statusError{"tenant schema has pending migrations; apply them with MigrateAll", http.StatusServiceUnavailable, 0}
+
+// explicitMigrationKey marks contexts of MigrateTenant, which migrates
+// whatever Config.InlineMigration says
+type explicitMigrationKey struct{}
+
+// inlineMigration reports whether connecting to the schema runs AutoMigrate,
+// or fails with ErrMigrationPending when the schema needs a migration that
+// may not run inline. Callers hold mu, so the catalog is read through
+// masterDB, and the tenant's model groups are passed in.
+func (s *TenantStore) inlineMigration(ctx context.Context, tenantSchema string, groups [][]interface{}) (bool, error) {
+	if !s.config().AutoMigrate || len(groups) == 0 {
+		return false, nil
+	}
+	if explicit, _ := ctx.Value(explicitMigrationKey{}).(bool); explicit {
+		return false, nil
+	}
+	if s.pendingMigrations[tenantSchema] {
+		return false, fmt.Errorf("%w: %s exceeded MaxInlineMigrationDuration", ErrMigrationPending, tenantSchema)
+	}
+	if s.warmMigration(tenantSchema, groups) {
+		return false, nil
+	}
+	if s.config().InlineMigration {
+		return true, nil
+	}
+
+	pending, err := pendingMigration(ctx, s.masterDB, tenantSchema, flatten(groups))
+	if errors.Is(err, ErrSchemaNotFound) {
+		// New schemas are empty, so migrating them is quick
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(pending) > 0 {
+		return false, fmt.Errorf("%w: %s needs %v", ErrMigrationPending, tenantSchema, pending)
+	}
+	return false, nil
+}
+
+// inlineMigrationContext bounds an inline migration by
+// Config.MaxInlineMigrationDuration
+func (s *TenantStore) inlineMigrationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config().MaxInlineMigrationDuration <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.config().MaxInlineMigrationDuration)
+}
+
+// inlineMigrationFailed turns an inline migration that ran out of time into
+// ErrMigrationPending and remembers the schema, so later requests fail at
+// once instead of starting the migration again. Callers hold mu.
+func (s *TenantStore) inlineMigrationFailed(ctx, migrateCtx context.Context, tenantSchema string, err error) error {
+	if ctx.Err() != nil || !errors.Is(migrateCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	s.pendingMigrations[tenantSchema] = true
+	s.config().Logger.Warn(ctx, "inline migration of %s exceeded %s; migrate it with MigrateTenant or MigrateAll: %v",
+		tenantSchema, s.config().MaxInlineMigrationDuration, err)
+	return fmt.Errorf("%w: %s exceeded MaxInlineMigrationDuration", ErrMigrationPending, tenantSchema)
+}
+
+// migrated forgets that the schema's inline migration ran out of time
+func (s *TenantStore) migrated(tenantSchema string) {
+	s.mu.Lock()
+	delete(s.pendingMigrations, tenantSchema)
+	s.mu.Unlock()
+}
+
+// pendingMigration lists what AutoMigrate would add to an existing schema:
+// missing tables, columns and indexes of the models. It fails with
+// ErrSchemaNotFound for schemas that do not exist.
+func pendingMigration(ctx context.Context, db *gorm.DB, tenantSchema string, models []interface{}) ([]string, error) {
+	db = db.WithContext(ctx)
+
+	var exists bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM information_schema.schemata WHERE schema_name = ?)", tenantSchema).Scan(&exists).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up schema %s: %w", tenantSchema, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, tenantSchema)
+	}
+
+	var columns []struct {
+		TableName  string
+		ColumnName string
+	}
+	if err := db.Raw("SELECT table_name, column_name FROM information_schema.columns WHERE table_schema = ?", tenantSchema).Scan(&columns).Error; err != nil {
+		return nil, fmt.Errorf("failed to load columns of %s: %w", tenantSchema, err)
+	}
+	tables := make(map[string]map[string]bool)
+	for _, column := range columns {
+		if tables[column.TableName] == nil {
+			tables[column.TableName] = make(map[string]bool)
+		}
+		tables[column.TableName][column.ColumnName] = true
+	}
+
+	var indexNames []string
+	if err := db.Raw("SELECT indexname FROM pg_indexes WHERE schemaname = ?", tenantSchema).Scan(&indexNames).Error; err != nil {
+		return nil, fmt.Errorf("failed to load indexes of %s: %w", tenantSchema, err)
+	}
+	indexes := make(map[string]bool, len(indexNames))
+	for _, name := range indexNames {
+		indexes[name] = true
+	}
+
+	var pending []string
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+
+		table := stmt.Schema.Table
+		existing, ok := tables[table]
+		if !ok {
+			pending = append(pending, "create table "+table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !field.IgnoreMigration && !existing[field.DBName] {
+				pending = append(pending, "add column "+table+"."+field.DBName)
+			}
+		}
+
+		var names []string
+		for name := range stmt.Schema.ParseIndexes() {
+			if !indexes[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			pending = append(pending, "create index "+name)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,155 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+)
+
+// inlineModel is TestModel after a release added a column and an index
+type inlineModel struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `gorm:"index"`
+	Email string
+}
+
+func (inlineModel) TableName() string {
+	return "test_models"
+}
+
+func TestInlineMigrationDisabled(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&TestModel{}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if _, err := store.GetTenantDB(ctx, "tenant_inline"); err != nil {
+		t.Fatalf("Failed to provision tenant: %v", err)
+	}
+	store.RemoveTenantDB("tenant_inline")
+
+	// The new release must not migrate the existing schema inline
+	reconfigure(store, func(config *Config) {
+		config.Models = []interface{}{&inlineModel{}}
+		config.InlineMigration = false
+	})
+	_, err = store.GetTenantDB(ctx, "tenant_inline")
+	if !errors.Is(err, ErrMigrationPending) {
+		t.Fatalf("Expected ErrMigrationPending, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "add column test_models.email") || !strings.Contains(err.Error(), "create index idx_test_models_name") {
+		t.Fatalf("Expected the pending column and index, got %v", err)
+	}
+
+	// New schemas are still provisioned
+	if _, err := store.GetTenantDB(ctx, "tenant_inline_new"); err != nil {
+		t.Fatalf("Expected a new schema to be migrated inline, got %v", err)
+	}
+
+	if err := store.MigrateTenant(ctx, "tenant_inline"); err != nil {
+		t.Fatalf("Failed to migrate out of band: %v", err)
+	}
+	store.RemoveTenantDB("tenant_inline")
+	db, err := store.GetTenantDB(ctx, "tenant_inline")
+	if err != nil {
+		t.Fatalf("Expected the migrated schema to connect, got %v", err)
+	}
+	if err := db.Create(&inlineModel{Name: "alpha", Email: "a@example.com"}).Error; err != nil {
+		t.Fatalf("Expected the new column, got %v", err)
+	}
+}
+
+func TestInlineMigrationTimeout(t *testing.T) {
+	config := DefaultConfig("")
+	config.Models = []interface{}{&TestModel{}}
+	config.MaxInlineMigrationDuration = time.Nanosecond
+	store := withConfig(&TenantStore{pendingMigrations: make(map[string]bool)}, config)
+	ctx := context.Background()
+
+	migrateCtx, cancel := store.inlineMigrationContext(ctx)
+	defer cancel()
+	<-migrateCtx.Done()
+
+	err := store.inlineMigrationFailed(ctx, migrateCtx, "acme", context.DeadlineExceeded)
+	if !errors.Is(err, ErrMigrationPending) {
+		t.Fatalf("Expected ErrMigrationPending after the deadline, got %v", err)
+	}
+
+	// Later connections fail without migrating
+	if _, err := store.inlineMigration(ctx, "acme", store.modelGroups()); !errors.Is(err, ErrMigrationPending) {
+		t.Fatalf("Expected acme to stay pending, got %v", err)
+	}
+	if migrate, err := store.inlineMigration(context.WithValue(ctx, explicitMigrationKey{}, true), "acme", store.modelGroups()); migrate || err != nil {
+		t.Fatalf("Expected MigrateTenant to pass, got %v, %v", migrate, err)
+	}
+	if migrate, err := store.inlineMigration(ctx, "globex", store.modelGroups()); !migrate || err != nil {
+		t.Fatalf("Expected other schemas to migrate inline, got %v, %v", migrate, err)
+	}
+
+	store.migrated("acme")
+	if migrate, err := store.inlineMigration(ctx, "acme", store.modelGroups()); !migrate || err != nil {
+		t.Fatalf("Expected acme to migrate inline again, got %v, %v", migrate, err)
+	}
+
+	// Other failures are returned as they are
+	other := errors.New("syntax error")
+	if err := store.inlineMigrationFailed(ctx, ctx, "globex", other); err != other || store.pendingMigrations["globex"] {
+		t.Fatalf("Expected the error unchanged, got %v", err)
+	}
+}
+
+// pendingStore serves tenants from the master pool unless their migration
+// is pending
+type pendingStore struct {
+	*TenantStore
+}
+
+func (s pendingStore) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	if _, err := s.inlineMigration(ctx, tenantSchema, s.modelGroups()); err != nil {
+		return nil, err
+	}
+	return s.master(), nil
+}
+
+func TestMigrationPendingResponse(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "migration_pending", func(config *Config) {
+		config.Models = []interface{}{&TestModel{}}
+	})
+	store.pendingMigrations = map[string]bool{"acme": true}
+
+	app := fiber.New()
+	app.Use(middleware.New(middleware.Config{
+		Store:    pendingStore{store},
+		Resolver: middleware.HeaderResolver("X-Tenant-ID"),
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusServiceUnavailable || !strings.Contains(string(body), "pending migrations") {
+		t.Fatalf("Expected 503 naming the pending migrations, got %d %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,81 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// VerifyIsolation checks that the cached connection for tenantSchema really
+// resolves unqualified names inside that schema. It compares current_schema()
+// against the expected schema and confirms every configured model table exists
+// there in pg_tables, so a connection whose search_path never applied is
+// reported instead of silently reading from public.
+func (s *TenantStore) VerifyIsolation(ctx context.Context, tenantSchema string) error {
+	s.mu.RLock()
+	db, exists := s.tenantDBs[tenantSchema]
+	s.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("no connection cached for tenant %s", tenantSchema)
+	}
+
+	models, err := s.tenantModels(ctx, tenantSchema)
+	if err != nil {
+		return err
+	}
+	return s.verifyIsolation(ctx, tenantSchema, db, models)
+}
+
+// verifyIsolation runs the isolation checks against an open tenant
+// connection, expecting the tables of models
+func (s *TenantStore) verifyIsolation(ctx context.Context, tenantSchema string, db *gorm.DB, models []interface{}) error {
+
+	var currentSchema, searchPath string
+	if err := db.WithContext(ctx).Raw("SELECT current_schema()").Scan(&currentSchema).Error; err != nil {
+		return fmt.Errorf("failed to query current_schema for %s: %w", tenantSchema, err)
+	}
+	if err := db.WithContext(ctx).Raw("SHOW search_path").Scan(&searchPath).Error; err != nil {
+		return fmt.Errorf("failed to query search_path for %s: %w", tenantSchema, err)
+	}
+
+	if currentSchema != tenantSchema {
+		return fmt.Errorf("isolation check failed for tenant %s: current_schema is %q (search_path %q), expected %q",
+			tenantSchema, currentSchema, searchPath, tenantSchema)
+	}
+
+	if len(models) == 0 {
+		return nil
+	}
+
+	var tables []string
+	if err := db.WithContext(ctx).
+		Raw("SELECT tablename FROM pg_tables WHERE schemaname = ?", tenantSchema).
+		Scan(&tables).Error; err != nil {
+		return fmt.Errorf("failed to list tables for %s: %w", tenantSchema, err)
+	}
+
+	present := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		present[table] = true
+	}
+
+	var missing []string
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+		if !present[stmt.Schema.Table] {
+			missing = append(missing, stmt.Schema.Table)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("isolation check failed for tenant %s: tables %v not found in schema %q (search_path %q)",
+			tenantSchema, missing, tenantSchema, searchPath)
+	}
+
+	return nil
+}
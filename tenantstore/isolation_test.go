@@ -0,0 +1,97 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVerifyIsolation(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.AutoMigrate = true
+	config.Models = []interface{}{&TestModel{}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	tenantSchema := fmt.Sprintf("test_tenant_%d", time.Now().Unix())
+
+	// Clean up after test
+	defer func() {
+		store.masterDB.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", tenantSchema))
+	}()
+
+	if _, err := store.GetTenantDB(ctx, tenantSchema); err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	if err := store.VerifyIsolation(ctx, tenantSchema); err != nil {
+		t.Fatalf("Expected isolation check to pass: %v", err)
+	}
+}
+
+func TestVerifyIsolationUnknownTenant(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.VerifyIsolation(context.Background(), "missing_tenant"); err == nil {
+		t.Fatal("Expected error for tenant without a cached connection")
+	}
+}
+
+func TestStrictIsolationRejectsBrokenDSN(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	config := DefaultConfig(dsn)
+	config.AutoMigrate = true
+	config.Models = []interface{}{&TestModel{}}
+	config.StrictIsolation = true
+
+	// Deliberately broken builder: search_path is never applied
+	config.GetTenantDSN = func(tenantSchema string) string {
+		return dsn
+	}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	tenantSchema := fmt.Sprintf("test_tenant_%d", time.Now().Unix())
+
+	// Clean up after test, including the table migrated into public
+	defer func() {
+		store.masterDB.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", tenantSchema))
+		store.masterDB.Exec("DROP TABLE IF EXISTS public.test_models")
+	}()
+
+	_, err = store.GetTenantDB(ctx, tenantSchema)
+	if err == nil {
+		t.Fatal("Expected strict isolation to reject a connection without search_path")
+	}
+
+	// The failing connection must not be cached
+	store.mu.RLock()
+	_, exists := store.tenantDBs[tenantSchema]
+	store.mu.RUnlock()
+
+	if exists {
+		t.Fatal("Expected failing connection not to be cached")
+	}
+}
@@ -0,0 +1,161 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// TenantFunc is called with a tenant schema and its database connection
+type TenantFunc func(ctx context.Context, tenantSchema string, db *gorm.DB) error
+
+// ForEachOptions controls how ForEachTenant visits tenants
+type ForEachOptions struct {
+	// Concurrency is the number of tenants processed at once (default 1)
+	Concurrency int
+
+	// ContinueOnError keeps visiting the remaining tenants after a failure
+	// instead of stopping at the first one
+	ContinueOnError bool
+}
+
+// TenantErrors collects per-tenant failures from ForEachTenant
+type TenantErrors map[string]error
+
+// Error lists the failed tenants in schema order
+func (e TenantErrors) Error() string {
+	schemas := make([]string, 0, len(e))
+	for schema := range e {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+
+	parts := make([]string, 0, len(schemas))
+	for _, schema := range schemas {
+		parts = append(parts, fmt.Sprintf("%s: %v", schema, e[schema]))
+	}
+	return fmt.Sprintf("%d tenant(s) failed: %s", len(e), strings.Join(parts, "; "))
+}
+
+// Unwrap returns the individual tenant errors for errors.Is and errors.As
+func (e TenantErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// ListSchemas returns every tenant schema of Config.Environment in the
+// database, excluding public, PostgreSQL system schemas and snapshots,
+// sorted by name
+func (s *TenantStore) ListSchemas(ctx context.Context) ([]string, error) {
+	return s.listSchemas(s.master().WithContext(ctx))
+}
+
+// listSchemas is ListSchemas through a master session, for callers holding mu
+func (s *TenantStore) listSchemas(db *gorm.DB) ([]string, error) {
+	var schemas []string
+	err := db.Raw(`
+		SELECT schema_name FROM information_schema.schemata
+		WHERE schema_name NOT IN ('public', 'information_schema')
+		AND schema_name NOT LIKE 'pg\_%'
+		ORDER BY schema_name`).Scan(&schemas).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schemas: %w", err)
+	}
+
+	inEnvironment := schemas[:0]
+	for _, schema := range schemas {
+		if s.inEnvironment(schema) && !isSnapshotSchema(schema) {
+			inEnvironment = append(inEnvironment, schema)
+		}
+	}
+	return inEnvironment, nil
+}
+
+// ForEachTenant calls fn for every schema returned by ListSchemas with that
+// tenant's database connection. Failures are returned as TenantErrors; the
+// iteration stops early when ctx is cancelled or, unless ContinueOnError is
+// set, after the first failure.
+func (s *TenantStore) ForEachTenant(ctx context.Context, fn TenantFunc, opts ForEachOptions) error {
+	schemas, err := s.ListSchemas(ctx)
+	if err != nil {
+		return err
+	}
+
+	return forEachSchema(ctx, schemas, func(ctx context.Context, tenantSchema string) error {
+		return s.visitTenant(ctx, tenantSchema, fn)
+	}, opts)
+}
+
+// forEachSchema runs fn for each schema with the concurrency and error
+// semantics of ForEachTenant
+func forEachSchema(ctx context.Context, schemas []string, fn func(ctx context.Context, tenantSchema string) error, opts ForEachOptions) error {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		failures = TenantErrors{}
+		wg       sync.WaitGroup
+		slots    = make(chan struct{}, concurrency)
+	)
+
+	for _, schema := range schemas {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(schema string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			err := fn(ctx, schema)
+			if err == nil {
+				return
+			}
+
+			mu.Lock()
+			failures[schema] = err
+			mu.Unlock()
+
+			if !opts.ContinueOnError {
+				cancel()
+			}
+		}(schema)
+	}
+
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return failures
+	}
+	return ctx.Err()
+}
+
+// visitTenant opens the tenant connection and runs fn against it, leasing
+// the pool so slow jobs are not cut off by eviction
+func (s *TenantStore) visitTenant(ctx context.Context, tenantSchema string, fn TenantFunc) error {
+	defer s.leaseSchema(tenantSchema)()
+
+	db, err := s.tenantDB(ctx, tenantSchema)
+	if err != nil {
+		return err
+	}
+	return fn(ctx, tenantSchema, db)
+}
@@ -0,0 +1,84 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestListSchemas(t *testing.T) {
+	t.Parallel()
+
+	store, err := New(DefaultConfig(getTestDSN(t)))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for _, schema := range []string{"tenant_b", "tenant_a"} {
+		if _, err := store.GetTenantDB(ctx, schema); err != nil {
+			t.Fatalf("Failed to create %s: %v", schema, err)
+		}
+	}
+
+	schemas, err := store.ListSchemas(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list schemas: %v", err)
+	}
+
+	if len(schemas) != 2 || schemas[0] != "tenant_a" || schemas[1] != "tenant_b" {
+		t.Fatalf("Expected [tenant_a tenant_b], got %v", schemas)
+	}
+}
+
+func TestForEachTenant(t *testing.T) {
+	t.Parallel()
+
+	store, err := New(DefaultConfig(getTestDSN(t)))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for _, schema := range []string{"tenant_a", "tenant_b", "tenant_c"} {
+		if _, err := store.GetTenantDB(ctx, schema); err != nil {
+			t.Fatalf("Failed to create %s: %v", schema, err)
+		}
+	}
+
+	boom := errors.New("boom")
+	var visited int32
+
+	err = store.ForEachTenant(ctx, func(ctx context.Context, tenantSchema string, db *gorm.DB) error {
+		atomic.AddInt32(&visited, 1)
+
+		var current string
+		db.Raw("SELECT current_schema()").Scan(&current)
+		if current != tenantSchema {
+			t.Errorf("Expected current_schema %s, got %s", tenantSchema, current)
+		}
+
+		if tenantSchema == "tenant_b" {
+			return boom
+		}
+		return nil
+	}, ForEachOptions{Concurrency: 2, ContinueOnError: true})
+
+	var failures TenantErrors
+	if !errors.As(err, &failures) {
+		t.Fatalf("Expected TenantErrors, got %v", err)
+	}
+
+	if len(failures) != 1 || !errors.Is(err, boom) {
+		t.Fatalf("Expected only tenant_b to fail, got %v", err)
+	}
+
+	if visited != 3 {
+		t.Fatalf("Expected 3 tenants visited, got %d", visited)
+	}
+}
@@ -0,0 +1,89 @@
+package tenantstore
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// janitor periodically closes the pools of idle tenants
+type janitor struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startJanitor starts closing idle pools if TenantIdleTimeout is set.
+// UpdateConfig restarts it when the timeout or interval changes.
+func (s *TenantStore) startJanitor() {
+	timeout := s.config().TenantIdleTimeout
+	if timeout <= 0 {
+		return
+	}
+
+	interval := s.config().JanitorInterval
+	if interval <= 0 {
+		interval = timeout / 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &janitor{cancel: cancel, done: make(chan struct{})}
+	s.janitor = j
+
+	go func() {
+		defer close(j.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if closed := s.CloseIdleTenants(); len(closed) > 0 {
+				s.config().Logger.Info(ctx, "closed the connections of %d idle tenant(s): %v", len(closed), closed)
+			}
+		}
+	}()
+}
+
+// stopJanitor stops the janitor and waits for it to return
+func (s *TenantStore) stopJanitor() {
+	if s.janitor == nil {
+		return
+	}
+	s.janitor.cancel()
+	<-s.janitor.done
+	s.janitor = nil
+}
+
+// CloseIdleTenants evicts the cached connections of tenants whose
+// connection was not handed out within Config.TenantIdleTimeout, and
+// returns their schemas, sorted. Pinned and leased tenants and pools with a
+// query running are kept. Idle connections close at once and the pool after
+// RotationGracePeriod; the tenant is re-dialed on its next use. The janitor
+// calls it every JanitorInterval; call it directly to clean up on demand.
+func (s *TenantStore) CloseIdleTenants() []string {
+	timeout := s.config().TenantIdleTimeout
+	if timeout <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-timeout).UnixNano()
+
+	// Connections are handed out under mu, so a tenant used since the
+	// cutoff is seen here and kept
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var closed []string
+	for tenantSchema, db := range s.tenantDBs {
+		if s.lastUsedAt(tenantSchema) > cutoff || !s.evictable(tenantSchema, db) {
+			continue
+		}
+		s.evictTenantDB(tenantSchema)
+		closed = append(closed, tenantSchema)
+	}
+	sort.Strings(closed)
+	return closed
+}
@@ -0,0 +1,131 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCloseIdleTenants(t *testing.T) {
+	store := newSQLiteTenantStore(t, "close_idle")
+	cacheSQLiteTenants(t, store, "globex", "initech")
+
+	// Without a timeout nothing is closed
+	if closed := store.CloseIdleTenants(); closed != nil {
+		t.Fatalf("Expected nothing closed, got %v", closed)
+	}
+
+	// A janitor checking hourly leaves the closing to this test
+	timeout, interval, grace := time.Hour, time.Hour, time.Duration(0)
+	if err := store.UpdateConfig(ConfigPatch{TenantIdleTimeout: &timeout, JanitorInterval: &interval, RotationGracePeriod: &grace}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	defer store.stopJanitor()
+	store.lastUsed.Delete("globex")
+	store.touch("globex", time.Now().Add(-2*time.Hour))
+	store.lastUsed.Delete("initech")
+	if _, err := store.GetTenantDB(context.Background(), "acme"); err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	if closed := store.CloseIdleTenants(); fmt.Sprint(closed) != "[globex initech]" || cachedSchemas(store) != "[acme]" {
+		t.Fatalf("Expected globex and initech closed, got %v leaving %s", closed, cachedSchemas(store))
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	store := newSQLiteTenantStore(t, "janitor")
+	cacheSQLiteTenants(t, store, "globex")
+	store.pinned = map[string]bool{"initech": true}
+	cacheSQLiteTenants(t, store, "initech")
+	store.touch("acme", time.Now())
+
+	// UpdateConfig starts the janitor
+	timeout, interval, grace := 50*time.Millisecond, 5*time.Millisecond, time.Duration(0)
+	if err := store.UpdateConfig(ConfigPatch{TenantIdleTimeout: &timeout, JanitorInterval: &interval, RotationGracePeriod: &grace}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	defer store.stopJanitor()
+
+	// A tenant in use is never closed, even when it is used right as the
+	// janitor runs
+	ctx := context.Background()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := store.GetTenantDB(ctx, "acme"); err != nil {
+				t.Errorf("Failed to get tenant DB: %v", err)
+				return
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for cachedSchemas(store) != "[acme initech]" {
+		if time.Now().After(deadline) {
+			close(stop)
+			t.Fatalf("Expected globex closed, got %s", cachedSchemas(store))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	if got := cachedSchemas(store); got != "[acme initech]" {
+		t.Fatalf("Expected acme and the pinned initech kept, got %s", got)
+	}
+}
+
+func TestTenantIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&TestModel{}}
+	config.TenantIdleTimeout = 100 * time.Millisecond
+	config.JanitorInterval = 10 * time.Millisecond
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	db, err := store.GetTenantDB(ctx, "tenant_idle")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	if err := db.Create(&TestModel{Name: "alpha"}).Error; err != nil {
+		t.Fatalf("Failed to create record: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(store.GetAllTenantSchemas()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the idle tenant closed, got %v", store.GetAllTenantSchemas())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The next request connects again
+	db, err = store.GetTenantDB(ctx, "tenant_idle")
+	if err != nil {
+		t.Fatalf("Failed to re-open tenant DB: %v", err)
+	}
+	var count int64
+	if err := db.Model(&TestModel{}).Count(&count).Error; err != nil || count != 1 {
+		t.Fatalf("Expected the tenant's data, got %d (%v)", count, err)
+	}
+	if got := store.GetAllTenantSchemas(); len(got) != 1 || got[0] != "tenant_idle" {
+		t.Fatalf("Expected tenant_idle cached again, got %v", got)
+	}
+}
@@ -0,0 +1,106 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Lease is a tenant connection held for a long job. While any lease of a
+// tenant is held, its pool is never evicted, even between the job's
+// queries when no connection is in use.
+type Lease struct {
+	// DB is the tenant connection, valid until Release
+	DB *gorm.DB
+
+	// Schema is the tenant's schema name
+	Schema string
+
+	release func()
+}
+
+// Release returns the lease. It may be called more than once.
+func (l *Lease) Release() {
+	l.release()
+}
+
+// Lease returns the tenant's connection and keeps its pool open until the
+// lease is released. Like Borrow, it holds Drain and ShutdownWithApp until
+// then and fails with ErrStoreClosing once the store drains.
+//
+//	lease, err := store.Lease(ctx, "acme")
+//	if err != nil {
+//		return err
+//	}
+//	defer lease.Release()
+//	lease.DB.Raw(report).Scan(&rows)
+func (s *TenantStore) Lease(ctx context.Context, tenantID string) (*Lease, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant schema cannot be empty")
+	}
+	tenantSchema, err := s.SchemaName(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.Borrow()
+	if err != nil {
+		return nil, err
+	}
+	unlease := s.leaseSchema(tenantSchema)
+
+	// Leased before dialing, so the new pool cannot be evicted in between
+	db, err := s.GetTenantDB(ctx, tenantID)
+	if err != nil {
+		unlease()
+		release()
+		return nil, err
+	}
+
+	var once sync.Once
+	return &Lease{DB: db, Schema: tenantSchema, release: func() {
+		once.Do(func() {
+			unlease()
+			release()
+		})
+	}}, nil
+}
+
+// leaseSchema exempts the schema's pool from eviction until the returned
+// function is called
+func (s *TenantStore) leaseSchema(tenantSchema string) func() {
+	tenantSchema = strings.Clone(tenantSchema)
+
+	s.mu.Lock()
+	if s.leases == nil {
+		s.leases = make(map[string]int)
+	}
+	s.leases[tenantSchema]++
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.leases[tenantSchema]--; s.leases[tenantSchema] <= 0 {
+				delete(s.leases, tenantSchema)
+			}
+		})
+	}
+}
+
+// Leases returns the number of leases held on each tenant, by schema
+func (s *TenantStore) Leases() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	leases := make(map[string]int, len(s.leases))
+	for tenantSchema, n := range s.leases {
+		leases[tenantSchema] = n
+	}
+	return leases
+}
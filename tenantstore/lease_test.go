@@ -0,0 +1,85 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestLeaseSurvivesEviction(t *testing.T) {
+	store := newSQLiteTenantStore(t, "lease_eviction")
+	ctx := context.Background()
+
+	lease, err := store.Lease(ctx, "acme")
+	if err != nil {
+		t.Fatalf("Failed to lease: %v", err)
+	}
+	if lease.Schema != "acme" || store.Leases()["acme"] != 1 || store.Borrowers() != 1 {
+		t.Fatalf("Expected one lease and borrower of acme, got %v and %d", store.Leases(), store.Borrowers())
+	}
+
+	// A slow query is running while the pool is swept
+	rows, err := lease.DB.Model(&TestModel{}).Rows()
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if evicted := store.evictIdle(""); evicted != 0 {
+		t.Fatalf("Expected no eviction during the query, got %d", evicted)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+
+	// Between the job's queries nothing is in use, but the lease holds
+	if evicted := store.evictIdle(""); evicted != 0 {
+		t.Fatalf("Expected the leased pool to be kept, got %d evicted", evicted)
+	}
+	var count int64
+	if err := lease.DB.Model(&TestModel{}).Count(&count).Error; err != nil || count != 1 {
+		t.Fatalf("Expected the job's next query to succeed, got %d (%v)", count, err)
+	}
+
+	lease.Release()
+	lease.Release()
+	if len(store.Leases()) != 0 || store.Borrowers() != 0 {
+		t.Fatalf("Expected the lease to be released, got %v and %d borrowers", store.Leases(), store.Borrowers())
+	}
+	if evicted := store.evictIdle(""); evicted != 1 {
+		t.Fatalf("Expected the released pool to be evicted, got %d", evicted)
+	}
+}
+
+func TestForEachTenantLeases(t *testing.T) {
+	store := newSQLiteTenantStore(t, "lease_foreach")
+
+	err := store.visitTenant(context.Background(), "acme", func(ctx context.Context, schema string, db *gorm.DB) error {
+		if store.Leases()[schema] != 1 {
+			t.Errorf("Expected %s to be leased during the visit", schema)
+		}
+		if evicted := store.evictIdle(""); evicted != 0 {
+			t.Errorf("Expected no eviction during the visit, got %d", evicted)
+		}
+		return db.Model(&TestModel{}).Count(new(int64)).Error
+	})
+	if err != nil {
+		t.Fatalf("Failed to visit: %v", err)
+	}
+	if len(store.Leases()) != 0 {
+		t.Fatalf("Expected the lease to end with the visit, got %v", store.Leases())
+	}
+}
+
+func TestLeaseWhileDraining(t *testing.T) {
+	store := newSQLiteTenantStore(t, "lease_draining")
+	if err := store.Drain(context.Background()); err != nil {
+		t.Fatalf("Failed to drain: %v", err)
+	}
+	if _, err := store.Lease(context.Background(), "acme"); !errors.Is(err, ErrStoreClosing) {
+		t.Fatalf("Expected ErrStoreClosing, got %v", err)
+	}
+	if len(store.Leases()) != 0 {
+		t.Fatalf("Expected no leases, got %v", store.Leases())
+	}
+}
@@ -0,0 +1,123 @@
+package tenantstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrLockHeld is returned by TryTenantLock when another session holds the lock
+var ErrLockHeld = errors.New("tenant lock is held by another session")
+
+// ErrLockTimeout is returned by WithTenantLock when Config.LockTimeout passes
+// before the lock is free
+var ErrLockTimeout = errors.New("timed out waiting for tenant lock")
+
+// WithTenantLock runs fn while holding the advisory lock lockName of the
+// tenant, waiting for other holders to finish first. Replicas running the
+// same job for the same tenant take turns; other tenants and lock names do
+// not contend. The wait is bounded by ctx and Config.LockTimeout.
+//
+// The lock lives on a connection of the tenant pool that fn's db is bound
+// to, so it is released when fn returns or when that connection drops.
+func (s *TenantStore) WithTenantLock(ctx context.Context, tenantID, lockName string, fn func(db *gorm.DB) error) error {
+	return s.withTenantLock(ctx, tenantID, lockName, true, fn)
+}
+
+// TryTenantLock runs fn like WithTenantLock if the lock is free, and
+// otherwise returns ErrLockHeld without running it
+func (s *TenantStore) TryTenantLock(ctx context.Context, tenantID, lockName string, fn func(db *gorm.DB) error) error {
+	return s.withTenantLock(ctx, tenantID, lockName, false, fn)
+}
+
+func (s *TenantStore) withTenantLock(ctx context.Context, tenantID, lockName string, wait bool, fn func(db *gorm.DB) error) error {
+	db, err := s.GetTenantDB(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	tenantSchema, err := s.SchemaName(tenantID)
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get tenant connection pool: %w", err)
+	}
+
+	// Advisory locks belong to the session, so hold one connection from
+	// locking to unlocking
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get tenant connection: %w", err)
+	}
+
+	key := tenantLockKey(tenantSchema, lockName)
+	if err := s.acquireLock(ctx, conn, key, wait); err != nil {
+		// A cancelled lock query may still have taken the lock, so close
+		// the session rather than return it to the pool
+		discardConn(conn)
+		return err
+	}
+
+	defer func() {
+		var unlocked bool
+		err := conn.QueryRowContext(context.Background(), "SELECT pg_advisory_unlock($1)", key).Scan(&unlocked)
+		if err != nil || !unlocked {
+			discardConn(conn)
+			return
+		}
+		conn.Close()
+	}()
+
+	session := db.WithContext(ctx)
+	session.Statement.ConnPool = conn
+	return fn(session)
+}
+
+// acquireLock takes the advisory lock on conn, waiting for it if wait is set
+func (s *TenantStore) acquireLock(ctx context.Context, conn *sql.Conn, key int64, wait bool) error {
+	if !wait {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+			return fmt.Errorf("failed to acquire tenant lock: %w", err)
+		}
+		if !acquired {
+			return ErrLockHeld
+		}
+		return nil
+	}
+
+	lockCtx := ctx
+	if s.config().LockTimeout > 0 {
+		var cancel context.CancelFunc
+		lockCtx, cancel = context.WithTimeout(ctx, s.config().LockTimeout)
+		defer cancel()
+	}
+
+	if _, err := conn.ExecContext(lockCtx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		if ctx.Err() == nil && errors.Is(lockCtx.Err(), context.DeadlineExceeded) {
+			return ErrLockTimeout
+		}
+		return fmt.Errorf("failed to acquire tenant lock: %w", err)
+	}
+	return nil
+}
+
+// tenantLockKey derives the advisory lock key from the schema and lock name
+func tenantLockKey(tenantSchema, lockName string) int64 {
+	sum := sha256.Sum256([]byte(tenantSchema + "\x00" + lockName))
+	return int64(binary.BigEndian.Uint64(sum[:8]))
+}
+
+// discardConn closes conn's session instead of returning it to the pool
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
@@ -0,0 +1,101 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestTenantLockKey(t *testing.T) {
+	if tenantLockKey("acme", "invoices") != tenantLockKey("acme", "invoices") {
+		t.Fatal("Expected keys to be stable")
+	}
+	if tenantLockKey("acme", "invoices") == tenantLockKey("globex", "invoices") ||
+		tenantLockKey("acme", "invoices") == tenantLockKey("acme", "reports") ||
+		tenantLockKey("ab", "c") == tenantLockKey("a", "bc") {
+		t.Fatal("Expected distinct tenants and lock names to get distinct keys")
+	}
+}
+
+func TestTenantLockContention(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.AutoMigrate = false
+	config.LockTimeout = 300 * time.Millisecond
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	// Two replicas race for the nightly job; the winner holds the lock
+	// until the loser has given up
+	var executed atomic.Int32
+	release := make(chan struct{})
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			results <- store.TryTenantLock(ctx, "tenant_a", "nightly", func(db *gorm.DB) error {
+				executed.Add(1)
+				select {
+				case <-release:
+				case <-time.After(5 * time.Second):
+				}
+				return db.Exec("SELECT 1").Error
+			})
+		}()
+	}
+
+	if err := <-results; !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("Expected the loser to get ErrLockHeld, got %v", err)
+	}
+	close(release)
+	if err := <-results; err != nil {
+		t.Fatalf("Expected the winner to succeed, got %v", err)
+	}
+	if executed.Load() != 1 {
+		t.Fatalf("Expected exactly one execution, got %d", executed.Load())
+	}
+
+	// Locks are per tenant
+	held := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- store.WithTenantLock(ctx, "tenant_a", "nightly", func(db *gorm.DB) error {
+			close(held)
+			time.Sleep(time.Second)
+			return nil
+		})
+	}()
+	<-held
+
+	if err := store.TryTenantLock(ctx, "tenant_b", "nightly", func(db *gorm.DB) error { return nil }); err != nil {
+		t.Fatalf("Expected another tenant's lock to be free, got %v", err)
+	}
+
+	// Waiting gives up after LockTimeout
+	err = store.WithTenantLock(ctx, "tenant_a", "nightly", func(db *gorm.DB) error {
+		t.Error("Expected fn not to run without the lock")
+		return nil
+	})
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Expected ErrLockTimeout, got %v", err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Failed to run with lock: %v", err)
+	}
+
+	// Once released, waiting callers get the lock
+	if err := store.WithTenantLock(ctx, "tenant_a", "nightly", func(db *gorm.DB) error { return nil }); err != nil {
+		t.Fatalf("Expected the released lock to be acquired, got %v", err)
+	}
+}
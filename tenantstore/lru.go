@@ -0,0 +1,71 @@
+package tenantstore
+
+import (
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// evictLeastRecentlyUsed evicts the pools handed out longest ago until the
+// cache holds Config.MaxCachedTenants, except keep, pinned and leased
+// tenants and pools with a connection in use. Callers hold mu.
+func (s *TenantStore) evictLeastRecentlyUsed(keep string) int {
+	limit := s.config().MaxCachedTenants
+	evicted := 0
+	for limit > 0 && len(s.tenantDBs) > limit {
+		victim, oldest := "", int64(0)
+		for tenantSchema, db := range s.tenantDBs {
+			if tenantSchema == keep || !s.evictable(tenantSchema, db) {
+				continue
+			}
+			used := s.lastUsedAt(tenantSchema)
+			if victim == "" || used < oldest || (used == oldest && tenantSchema < victim) {
+				victim, oldest = tenantSchema, used
+			}
+		}
+		if victim == "" {
+			return evicted
+		}
+
+		s.evictTenantDB(victim)
+		evicted++
+	}
+	return evicted
+}
+
+// evictable reports whether a cached pool may be evicted: the tenant is
+// neither pinned nor leased and no connection is in use. Callers hold mu.
+func (s *TenantStore) evictable(tenantSchema string, db *gorm.DB) bool {
+	if s.pinned[tenantSchema] || s.leases[tenantSchema] > 0 {
+		return false
+	}
+	sqlDB, err := db.DB()
+	return err == nil && sqlDB.Stats().InUse == 0
+}
+
+// lastUsedAt returns the UnixNano time the schema's connection was last
+// handed out, or zero
+func (s *TenantStore) lastUsedAt(tenantSchema string) int64 {
+	if used, ok := s.lastUsed.Load(tenantSchema); ok {
+		return used.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+// evictTenantDB removes a cached pool, closes its idle connections at once
+// and the pool after RotationGracePeriod, so requests holding it finish.
+// Callers hold mu.
+func (s *TenantStore) evictTenantDB(tenantSchema string) {
+	db := s.tenantDBs[tenantSchema]
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxIdleConns(0)
+	}
+	s.retire(db)
+
+	delete(s.tenantDBs, tenantSchema)
+	delete(s.tenantVersions, tenantSchema)
+	delete(s.health, tenantSchema)
+	delete(s.sessionSettings, tenantSchema)
+	delete(s.poolProfiles, tenantSchema)
+	s.lastUsed.Delete(tenantSchema)
+}
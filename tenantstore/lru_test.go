@@ -0,0 +1,166 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// cacheSQLiteTenants caches an in-memory SQLite pool for each schema,
+// served by GetTenantDB in the given order
+func cacheSQLiteTenants(t *testing.T, store *TenantStore, schemas ...string) {
+	t.Helper()
+
+	start := time.Now()
+	for i, tenantSchema := range schemas {
+		db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s_%s?mode=memory&cache=shared", t.Name(), tenantSchema)), &gorm.Config{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { closeDB(db) })
+		store.tenantDBs[tenantSchema] = db
+		store.touch(tenantSchema, start.Add(time.Duration(i)*time.Second))
+	}
+}
+
+func cachedSchemas(store *TenantStore) string {
+	schemas := store.GetAllTenantSchemas()
+	sort.Strings(schemas)
+	return fmt.Sprint(schemas)
+}
+
+func TestEvictLeastRecentlyUsed(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "evict_lru")
+	limit, grace := 3, time.Duration(0)
+	if err := store.UpdateConfig(ConfigPatch{MaxCachedTenants: &limit, RotationGracePeriod: &grace}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	cacheSQLiteTenants(t, store, "acme", "globex", "initech")
+
+	// Within the limit nothing is evicted
+	if evicted := store.evictLeastRecentlyUsed(""); evicted != 0 {
+		t.Fatalf("Expected no eviction, got %d", evicted)
+	}
+
+	// A hit moves acme to the front, so globex goes when hooli connects
+	store.touch("acme", time.Now().Add(time.Hour))
+	cacheSQLiteTenants(t, store, "hooli")
+	store.touch("hooli", time.Now().Add(2*time.Hour))
+	if evicted := store.evictLeastRecentlyUsed("hooli"); evicted != 1 || cachedSchemas(store) != "[acme hooli initech]" {
+		t.Fatalf("Expected globex evicted, got %d and %s", evicted, cachedSchemas(store))
+	}
+
+	// Lowering the limit evicts at once. Pinned tenants and pools with a
+	// query running stay.
+	store.pinned = map[string]bool{"initech": true}
+	tx := store.tenantDBs["acme"].Begin()
+	defer tx.Rollback()
+	limit = 1
+	if err := store.UpdateConfig(ConfigPatch{MaxCachedTenants: &limit}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if got := cachedSchemas(store); got != "[acme initech]" {
+		t.Fatalf("Expected only hooli evicted, got %s", got)
+	}
+
+	// The connecting tenant is kept even if it was never served
+	cacheSQLiteTenants(t, store, "umbrella")
+	store.lastUsed.Delete("umbrella")
+	if evicted := store.evictLeastRecentlyUsed("umbrella"); evicted != 0 || cachedSchemas(store) != "[acme initech umbrella]" {
+		t.Fatalf("Expected umbrella kept, got %d and %s", evicted, cachedSchemas(store))
+	}
+
+	// Without a limit the cache grows
+	tx.Rollback()
+	limit = 0
+	if err := store.UpdateConfig(ConfigPatch{MaxCachedTenants: &limit}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if evicted := store.evictLeastRecentlyUsed(""); evicted != 0 {
+		t.Fatalf("Expected no eviction without a limit, got %d", evicted)
+	}
+}
+
+func TestEvictedPoolsClosedByClose(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "evict_close")
+	store.health = make(map[string]*tenantHealth)
+	cacheSQLiteTenants(t, store, "acme", "globex")
+	sqlDB, err := store.tenantDBs["acme"].DB()
+	if err != nil {
+		t.Fatalf("Failed to get sql.DB: %v", err)
+	}
+
+	store.mu.Lock()
+	store.evictTenantDB("acme")
+	store.mu.Unlock()
+	if _, ok := store.lastUsed.Load("acme"); ok {
+		t.Fatal("Expected the evicted tenant's last use forgotten")
+	}
+
+	// The pool serves out the grace period, unless the store closes first
+	if err := sqlDB.Ping(); err != nil {
+		t.Fatalf("Expected the evicted pool open during the grace period, got %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if err := sqlDB.Ping(); err == nil {
+		t.Fatal("Expected Close to close the evicted pool")
+	}
+	if len(store.retired) != 0 {
+		t.Fatalf("Expected no retired pools after Close, got %d", len(store.retired))
+	}
+}
+
+func TestMaxCachedTenants(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&TestModel{}}
+	config.MaxCachedTenants = 2
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	first, err := store.GetTenantDB(ctx, "tenant_lru_a")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	if err := first.Create(&TestModel{Name: "alpha"}).Error; err != nil {
+		t.Fatalf("Failed to create record: %v", err)
+	}
+	for _, tenantSchema := range []string{"tenant_lru_b", "tenant_lru_c"} {
+		if _, err := store.GetTenantDB(ctx, tenantSchema); err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+	}
+	if got := cachedSchemas(store); got != "[tenant_lru_b tenant_lru_c]" {
+		t.Fatalf("Expected tenant_lru_a evicted, got %s", got)
+	}
+
+	// A request still holding the evicted pool finishes on it
+	var count int64
+	if err := first.Model(&TestModel{}).Count(&count).Error; err != nil || count != 1 {
+		t.Fatalf("Expected the evicted pool to serve until it is retired, got %d (%v)", count, err)
+	}
+
+	// The evicted tenant is re-dialed transparently
+	db, err := store.GetTenantDB(ctx, "tenant_lru_a")
+	if err != nil {
+		t.Fatalf("Failed to re-open tenant DB: %v", err)
+	}
+	if err := db.Model(&TestModel{}).Count(&count).Error; err != nil || count != 1 {
+		t.Fatalf("Expected the tenant's data after re-opening, got %d (%v)", count, err)
+	}
+	if got := cachedSchemas(store); got != "[tenant_lru_a tenant_lru_c]" {
+		t.Fatalf("Expected tenant_lru_b evicted, got %s", got)
+	}
+}
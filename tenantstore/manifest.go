@@ -0,0 +1,305 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest actions reported by ApplyManifest
+const (
+	ManifestCreate     = "create"
+	ManifestRestore    = "restore"
+	ManifestUpdate     = "update"
+	ManifestActivate   = "activate"
+	ManifestDeactivate = "deactivate"
+	ManifestSeed       = "seed"
+	ManifestPrune      = "prune"
+)
+
+// ManifestAction is one change ApplyManifest made
+type ManifestAction struct {
+	Schema string `json:"schema"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ApplyReport lists the changes ApplyManifest made, in order. Tenants that
+// already match the manifest have no actions.
+type ApplyReport struct {
+	Actions []ManifestAction `json:"actions"`
+}
+
+func (r *ApplyReport) add(schema, action, detail string) {
+	r.Actions = append(r.Actions, ManifestAction{Schema: schema, Action: action, Detail: detail})
+}
+
+// manifest is the document read by ApplyManifest
+type manifest struct {
+	Prune   bool             `yaml:"prune"`
+	Tenants []manifestTenant `yaml:"tenants"`
+}
+
+type manifestTenant struct {
+	Schema   string         `yaml:"schema"`
+	Name     string         `yaml:"name"`
+	Plan     string         `yaml:"plan"`
+	Active   *bool          `yaml:"active"`
+	Settings TenantSettings `yaml:"settings"`
+	Domains  []string       `yaml:"domains"`
+	Seed     yaml.Node      `yaml:"seed"`
+
+	records []interface{}
+}
+
+// ApplyManifest brings the tenant registry in line with a YAML or JSON
+// manifest:
+//
+//	prune: false
+//	tenants:
+//	  - schema: acme
+//	    name: Acme Corp
+//	    plan: pro
+//	    active: true
+//	    settings:
+//	      timezone: Europe/Berlin
+//	    domains: [acme.example.com]
+//	    seed:
+//	      users:
+//	        - id: 1
+//	          name: Alice
+//
+// Missing tenants are registered, migrated and seeded; soft-deleted ones are
+// restored first. Existing tenants get their name, plan, settings, domains
+// and active flag updated, and are not seeded again. Name defaults to the
+// schema and active to true. With prune set, registered tenants that are
+// not listed are soft-deleted and their schemas dropped with all their data.
+//
+// The whole manifest is validated before anything changes, and errors name
+// the offending entry. When applying fails part way, the report lists what
+// was done before the error. Requires Config.EnableRegistry.
+func ApplyManifest(ctx context.Context, store *TenantStore, r io.Reader) (ApplyReport, error) {
+	var report ApplyReport
+
+	m, err := store.readManifest(r)
+	if err != nil {
+		return report, err
+	}
+
+	db, err := store.registryDB(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	var existing []Tenant
+	if err := db.Unscoped().Order("schema").Find(&existing).Error; err != nil {
+		return report, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	registered := make(map[string]*Tenant, len(existing))
+	for i := range existing {
+		registered[existing[i].Schema] = &existing[i]
+	}
+
+	listed := make(map[string]bool, len(m.Tenants))
+	for _, entry := range m.Tenants {
+		listed[entry.Schema] = true
+
+		current := registered[entry.Schema]
+		if current == nil || current.DeletedAt.Valid {
+			err = store.applyNewTenant(ctx, &report, entry, current)
+		} else {
+			err = store.applyTenantChanges(ctx, &report, entry, current)
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to apply tenant %s: %w", entry.Schema, err)
+		}
+	}
+
+	if !m.Prune {
+		return report, nil
+	}
+
+	for _, tenant := range existing {
+		if listed[tenant.Schema] || tenant.DeletedAt.Valid {
+			continue
+		}
+
+		if err := store.SoftDeleteTenant(ctx, tenant.Schema); err != nil {
+			return report, fmt.Errorf("failed to prune tenant %s: %w", tenant.Schema, err)
+		}
+		detail := "unregistered"
+		_, err := store.DropTenant(ctx, tenant.Schema, DropOptions{Cascade: true})
+		if err == nil {
+			detail = "unregistered and dropped schema"
+		} else if !errors.Is(err, ErrSchemaNotFound) {
+			return report, fmt.Errorf("failed to prune tenant %s: %w", tenant.Schema, err)
+		}
+		report.add(tenant.Schema, ManifestPrune, detail)
+	}
+
+	return report, nil
+}
+
+// readManifest parses and validates a manifest
+func (s *TenantStore) readManifest(r io.Reader) (*manifest, error) {
+	var m manifest
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	seen := make(map[string]int, len(m.Tenants))
+	for i := range m.Tenants {
+		entry := &m.Tenants[i]
+		where := fmt.Sprintf("tenants[%d]", i)
+		if entry.Schema != "" {
+			where += " (" + entry.Schema + ")"
+		}
+
+		if entry.Schema == "" {
+			return nil, fmt.Errorf("invalid manifest: %s: schema is required", where)
+		}
+		if _, err := s.SchemaName(entry.Schema); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %s: %w", where, err)
+		}
+		if isReservedSchema(entry.Schema) {
+			return nil, fmt.Errorf("invalid manifest: %s: schema is reserved", where)
+		}
+		if first, ok := seen[entry.Schema]; ok {
+			return nil, fmt.Errorf("invalid manifest: %s: schema is already listed at tenants[%d]", where, first)
+		}
+		seen[entry.Schema] = i
+
+		if entry.Name == "" {
+			entry.Name = entry.Schema
+		}
+		if entry.Active == nil {
+			active := true
+			entry.Active = &active
+		}
+
+		if entry.Seed.Kind != 0 {
+			records, err := fixturesFromNode(&entry.Seed, where+" seed")
+			if err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			entry.records = records
+		}
+	}
+
+	return &m, nil
+}
+
+// applyNewTenant registers, migrates and seeds a tenant that is missing or
+// soft-deleted
+func (s *TenantStore) applyNewTenant(ctx context.Context, report *ApplyReport, entry manifestTenant, deleted *Tenant) error {
+	if deleted != nil {
+		if err := s.RestoreTenant(ctx, entry.Schema); err != nil {
+			return err
+		}
+		report.add(entry.Schema, ManifestRestore, "")
+		if err := s.applyTenantChanges(ctx, report, entry, deleted); err != nil {
+			return err
+		}
+	} else {
+		tenant := &Tenant{
+			Schema:   entry.Schema,
+			Name:     entry.Name,
+			Plan:     entry.Plan,
+			Active:   *entry.Active,
+			Settings: entry.Settings,
+			Domains:  entry.Domains,
+		}
+		if err := s.RegisterTenant(ctx, tenant); err != nil {
+			return err
+		}
+		report.add(entry.Schema, ManifestCreate, "")
+	}
+
+	if err := s.MigrateTenant(ctx, entry.Schema); err != nil {
+		return err
+	}
+
+	if len(entry.records) > 0 {
+		if err := s.seedTenant(ctx, entry.Schema, entry.records); err != nil {
+			return err
+		}
+		report.add(entry.Schema, ManifestSeed, fmt.Sprintf("%d row(s)", len(entry.records)))
+	}
+	return nil
+}
+
+// applyTenantChanges updates the registry fields that differ from the entry
+func (s *TenantStore) applyTenantChanges(ctx context.Context, report *ApplyReport, entry manifestTenant, current *Tenant) error {
+	var changed []string
+	if current.Name != entry.Name {
+		changed = append(changed, "name")
+	}
+	if current.Plan != entry.Plan {
+		changed = append(changed, "plan")
+	}
+	if !sameSettings(current.Settings, entry.Settings) {
+		changed = append(changed, "settings")
+	}
+	if !sameDomains(current.Domains, entry.Domains) {
+		changed = append(changed, "domains")
+	}
+
+	if len(changed) > 0 {
+		db, err := s.registryDB(ctx)
+		if err != nil {
+			return err
+		}
+		// Updating through the model applies the JSON serializer
+		if err := db.Model(&Tenant{Schema: entry.Schema}).Select(changed).Updates(&Tenant{
+			Name:     entry.Name,
+			Plan:     entry.Plan,
+			Settings: entry.Settings,
+			Domains:  entry.Domains,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update tenant %s: %w", entry.Schema, err)
+		}
+		if current.Name != entry.Name || current.Plan != entry.Plan {
+			s.updateSchemaComment(ctx, db, &Tenant{Schema: entry.Schema, Name: entry.Name, Plan: entry.Plan, CreatedAt: current.CreatedAt})
+		}
+		s.registry.delete(entry.Schema)
+		s.emit(ctx, EventTenantUpdated, entry.Schema)
+		report.add(entry.Schema, ManifestUpdate, strings.Join(changed, ", "))
+	}
+
+	if current.Active != *entry.Active {
+		if *entry.Active {
+			if err := s.ActivateTenant(ctx, entry.Schema); err != nil {
+				return err
+			}
+			report.add(entry.Schema, ManifestActivate, "")
+		} else {
+			if err := s.DeactivateTenant(ctx, entry.Schema); err != nil {
+				return err
+			}
+			report.add(entry.Schema, ManifestDeactivate, "")
+		}
+	}
+	return nil
+}
+
+// sameSettings treats nil and empty settings as equal
+func sameSettings(a, b TenantSettings) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func sameDomains(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,177 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestManifestValidation(t *testing.T) {
+	store := withConfig(&TenantStore{}, &Config{})
+
+	for _, tc := range []struct {
+		manifest string
+		err      string
+	}{
+		{"tenants:\n  - name: Acme\n", "tenants[0]: schema is required"},
+		{"tenants:\n  - schema: acme\n  - schema: \"bad\\0name\"\n", "tenants[1] (bad\x00name): schema name"},
+		{"tenants:\n  - schema: public\n", "tenants[0] (public): schema is reserved"},
+		{"tenants:\n  - schema: acme\n  - schema: acme\n", "tenants[1] (acme): schema is already listed at tenants[0]"},
+		{"tenants:\n  - schema: acme\n    seed: [1, 2]\n", "tenants[0] (acme) seed"},
+		{"tenants:\n  - schema: acme\n    plna: pro\n", "field plna not found"},
+	} {
+		_, err := store.readManifest(strings.NewReader(tc.manifest))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("Expected error containing %q, got %v", tc.err, err)
+		}
+	}
+
+	m, err := store.readManifest(strings.NewReader(`{"tenants": [{"schema": "acme", "seed": {"group_notes": [{"id": 1}]}}]}`))
+	if err != nil {
+		t.Fatalf("Failed to read JSON manifest: %v", err)
+	}
+	entry := m.Tenants[0]
+	if entry.Name != "acme" || !*entry.Active || len(entry.records) != 1 {
+		t.Fatalf("Expected defaults and one seed row, got %+v", entry)
+	}
+}
+
+func TestApplyManifestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.EnableRegistry = true
+	config.Models = []interface{}{&GroupNote{}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	apply := func(manifest string) []ManifestAction {
+		t.Helper()
+		report, err := ApplyManifest(ctx, store, strings.NewReader(manifest))
+		if err != nil {
+			t.Fatalf("Failed to apply manifest: %v", err)
+		}
+		return report.Actions
+	}
+	assertActions := func(got, expected []ManifestAction) {
+		t.Helper()
+		if len(got) != len(expected) {
+			t.Fatalf("Expected actions %v, got %v", expected, got)
+		}
+		for i := range expected {
+			if got[i].Schema != expected[i].Schema || got[i].Action != expected[i].Action {
+				t.Fatalf("Expected actions %v, got %v", expected, got)
+			}
+		}
+	}
+
+	v1 := `
+tenants:
+  - schema: manifest_acme
+    name: Acme
+    plan: pro
+    settings:
+      timezone: Europe/Berlin
+    domains: [acme.example.com]
+    seed:
+      group_notes:
+        - id: 1
+          body: Welcome
+  - schema: manifest_globex
+    plan: free
+`
+	assertActions(apply(v1), []ManifestAction{
+		{Schema: "manifest_acme", Action: ManifestCreate},
+		{Schema: "manifest_acme", Action: ManifestSeed},
+		{Schema: "manifest_globex", Action: ManifestCreate},
+	})
+
+	acme, err := store.LookupTenant(ctx, "manifest_acme")
+	if err != nil {
+		t.Fatalf("Failed to look up tenant: %v", err)
+	}
+	if acme.Plan != "pro" || acme.Settings["timezone"] != "Europe/Berlin" || !reflect.DeepEqual(acme.Domains, []string{"acme.example.com"}) {
+		t.Fatalf("Expected the manifest fields to be registered, got %+v", acme)
+	}
+
+	db, err := store.GetTenantDB(ctx, "manifest_acme")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	var note GroupNote
+	if err := db.First(&note, 1).Error; err != nil || note.Body != "Welcome" {
+		t.Fatalf("Expected the seed row, got %+v (%v)", note, err)
+	}
+
+	// Applying again changes nothing
+	assertActions(apply(v1), nil)
+
+	// Modify one tenant and add another
+	v2 := `
+tenants:
+  - schema: manifest_acme
+    name: Acme Corp
+    plan: enterprise
+    settings:
+      timezone: Europe/Berlin
+    domains: [acme.example.com]
+  - schema: manifest_globex
+    plan: free
+    active: false
+  - schema: manifest_initech
+`
+	assertActions(apply(v2), []ManifestAction{
+		{Schema: "manifest_acme", Action: ManifestUpdate},
+		{Schema: "manifest_globex", Action: ManifestDeactivate},
+		{Schema: "manifest_initech", Action: ManifestCreate},
+	})
+
+	acme, err = store.LookupTenant(ctx, "manifest_acme")
+	if err != nil {
+		t.Fatalf("Failed to look up tenant: %v", err)
+	}
+	if acme.Name != "Acme Corp" || acme.Plan != "enterprise" {
+		t.Fatalf("Expected the tenant to be updated, got %+v", acme)
+	}
+	if active, _ := store.IsTenantActive(ctx, "manifest_globex"); active {
+		t.Fatal("Expected globex to be deactivated")
+	}
+
+	// Without prune, unlisted tenants are kept
+	assertActions(apply("tenants:\n  - schema: manifest_acme\n    name: Acme Corp\n    plan: enterprise\n"), []ManifestAction{
+		{Schema: "manifest_acme", Action: ManifestUpdate},
+	})
+	if _, err := store.LookupTenant(ctx, "manifest_globex"); err != nil {
+		t.Fatalf("Expected globex to be kept, got %v", err)
+	}
+
+	// With prune, unlisted tenants are unregistered and dropped
+	v3 := `
+prune: true
+tenants:
+  - schema: manifest_acme
+    name: Acme Corp
+    plan: enterprise
+  - schema: manifest_initech
+`
+	actions := apply(v3)
+	assertActions(actions, []ManifestAction{
+		{Schema: "manifest_globex", Action: ManifestPrune},
+	})
+	if actions[0].Detail != "unregistered and dropped schema" {
+		t.Fatalf("Expected the schema to be dropped, got %q", actions[0].Detail)
+	}
+	if _, err := store.LookupTenant(ctx, "manifest_globex"); !errors.Is(err, ErrTenantNotFound) {
+		t.Fatalf("Expected globex to be unregistered, got %v", err)
+	}
+	if _, err := store.schemaTables(ctx, "manifest_globex"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("Expected globex's schema to be dropped, got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// minRefreshTick bounds how often the refresher looks for due views
+var minRefreshTick = time.Second
+
+// MatViewDef describes a materialized view created in every tenant schema
+// after migration, such as the aggregates behind a reporting dashboard
+type MatViewDef struct {
+	// Name of the view inside the tenant schema
+	Name string
+
+	// SQL is the view's SELECT statement. It runs with the tenant's
+	// search_path, so tenant tables need no schema; like
+	// ViewDefinition.SQLTemplate, {{.Schema}} expands to the tenant schema.
+	SQL string
+
+	// RefreshEvery is how often the store's refresher refreshes the view in
+	// every tenant schema. Zero leaves refreshing to RefreshNow.
+	RefreshEvery time.Duration
+
+	// UniqueKey optionally adds a unique index over these columns. Views
+	// with a unique index are refreshed concurrently, so readers are never
+	// blocked by a refresh.
+	UniqueKey []string
+}
+
+// refresher periodically refreshes Config.MaterializedViews
+type refresher struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// matViewSQL returns the statements creating the view in the schema unless
+// it exists
+func matViewSQL(def MatViewDef, tenantSchema string) ([]string, error) {
+	query, err := renderViewSQL(ViewDefinition{Name: def.Name, SQLTemplate: def.SQL}, tenantSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	qualified := quoteIdentifier(tenantSchema) + "." + quoteIdentifier(def.Name)
+	statements := []string{fmt.Sprintf("CREATE MATERIALIZED VIEW IF NOT EXISTS %s AS %s", qualified, query)}
+	if len(def.UniqueKey) > 0 {
+		columns := make([]string, len(def.UniqueKey))
+		for i, column := range def.UniqueKey {
+			columns[i] = quoteIdentifier(column)
+		}
+		statements = append(statements, fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)",
+			quoteIdentifier(def.Name+"_key"), qualified, strings.Join(columns, ", ")))
+	}
+	return statements, nil
+}
+
+// createMaterializedViews creates the missing Config.MaterializedViews in
+// the schema on db. Existing views keep their data.
+func (s *TenantStore) createMaterializedViews(ctx context.Context, db *gorm.DB, tenantSchema string) error {
+	for _, def := range s.config().MaterializedViews {
+		statements, err := matViewSQL(def, tenantSchema)
+		if err != nil {
+			return err
+		}
+		for _, statement := range statements {
+			if err := db.WithContext(ctx).Exec(statement).Error; err != nil {
+				return fmt.Errorf("failed to create materialized view %s for %s: %w", def.Name, tenantSchema, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RefreshNow refreshes one of Config.MaterializedViews in the tenant schema,
+// for example after a handler changed the data it aggregates. A view missing
+// from the schema, such as one added to the config after the tenant was
+// provisioned, is created instead, which fills it. Views with a unique index
+// are refreshed concurrently.
+func (s *TenantStore) RefreshNow(ctx context.Context, tenantSchema, name string) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+	for _, def := range s.config().MaterializedViews {
+		if def.Name == name {
+			return s.refreshMaterializedView(ctx, tenantSchema, def)
+		}
+	}
+	return fmt.Errorf("materialized view %s is not configured", name)
+}
+
+// matViewState is a materialized view's row in pg_matviews
+type matViewState struct {
+	Populated bool
+	HasUnique bool
+}
+
+func (s *TenantStore) refreshMaterializedView(ctx context.Context, tenantSchema string, def MatViewDef) error {
+	searchPath, err := s.SearchPath(tenantSchema)
+	if err != nil {
+		return err
+	}
+
+	err = s.master().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var states []matViewState
+		err := tx.Raw(`
+			SELECT m.ispopulated AS populated, EXISTS (
+				SELECT 1 FROM pg_index i
+				JOIN pg_class c ON c.oid = i.indrelid
+				JOIN pg_namespace n ON n.oid = c.relnamespace
+				WHERE n.nspname = m.schemaname AND c.relname = m.matviewname
+				AND i.indisunique AND i.indpred IS NULL
+			) AS has_unique
+			FROM pg_matviews m
+			WHERE m.schemaname = ? AND m.matviewname = ?`,
+			tenantSchema, def.Name).Scan(&states).Error
+		if err != nil {
+			return err
+		}
+
+		if len(states) == 0 {
+			statements, err := matViewSQL(def, tenantSchema)
+			if err != nil {
+				return err
+			}
+			statements = append([]string{"SET LOCAL search_path TO " + formatSearchPath(searchPath)}, statements...)
+			for _, statement := range statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		refresh := "REFRESH MATERIALIZED VIEW "
+		if states[0].Populated && states[0].HasUnique {
+			refresh += "CONCURRENTLY "
+		}
+		return tx.Exec(refresh + quoteIdentifier(tenantSchema) + "." + quoteIdentifier(def.Name)).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refresh materialized view %s for %s: %w", def.Name, tenantSchema, err)
+	}
+	return nil
+}
+
+// refreshOffset is the tenant's jitter within the view's period, so the
+// views of all tenants are not refreshed at the same moment
+func refreshOffset(tenantSchema, name string, every time.Duration) time.Duration {
+	h := fnv.New64a()
+	h.Write([]byte(tenantSchema))
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+	return time.Duration(h.Sum64() % uint64(every))
+}
+
+// refreshDue reports whether the view's refresh time for the tenant fell
+// within (prev, now]. Each tenant's refreshes are every apart, shifted by
+// its offset.
+func refreshDue(tenantSchema string, def MatViewDef, prev, now time.Time) bool {
+	offset := int64(refreshOffset(tenantSchema, def.Name, def.RefreshEvery))
+	period := int64(def.RefreshEvery)
+	return (now.UnixNano()+offset)/period != (prev.UnixNano()+offset)/period
+}
+
+// startRefresher starts refreshing views that have RefreshEvery set
+func (s *TenantStore) startRefresher() {
+	var scheduled []MatViewDef
+	tick := time.Minute
+	for _, def := range s.config().MaterializedViews {
+		if def.RefreshEvery > 0 {
+			scheduled = append(scheduled, def)
+			tick = min(tick, def.RefreshEvery/10)
+		}
+	}
+	if len(scheduled) == 0 {
+		return
+	}
+	tick = max(tick, minRefreshTick)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.refresher = &refresher{cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(s.refresher.done)
+
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		prev := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			now := time.Now()
+			s.refreshDueViews(ctx, scheduled, prev, now)
+			prev = now
+		}
+	}()
+}
+
+// refreshDueViews refreshes the views due in (prev, now] one at a time
+func (s *TenantStore) refreshDueViews(ctx context.Context, scheduled []MatViewDef, prev, now time.Time) {
+	schemas, err := s.ListSchemas(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.config().Logger.Error(ctx, "materialized view refresher failed: %v", err)
+		}
+		return
+	}
+
+	for _, tenantSchema := range schemas {
+		if s.isMasterSchema(tenantSchema) {
+			continue
+		}
+		for _, def := range scheduled {
+			if !refreshDue(tenantSchema, def, prev, now) {
+				continue
+			}
+			if err := s.refreshMaterializedView(ctx, tenantSchema, def); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				s.config().Logger.Warn(ctx, "%v", err)
+			}
+		}
+	}
+}
+
+// stopRefresher stops the refresher and waits for it to return
+func (s *TenantStore) stopRefresher() {
+	if s.refresher == nil {
+		return
+	}
+	s.refresher.cancel()
+	<-s.refresher.done
+}
@@ -0,0 +1,160 @@
+package tenantstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type nameCount struct {
+	Name  string
+	Count int
+}
+
+func TestMaterializedViewRefreshNow(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.AutoMigrate = true
+	config.Models = []interface{}{&TestModel{}}
+	config.MaterializedViews = []MatViewDef{{
+		Name:      "model_counts",
+		SQL:       "SELECT name, count(*) AS count FROM test_models GROUP BY name",
+		UniqueKey: []string{"name"},
+	}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	db, err := store.GetTenantDB(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	db.Create(&[]TestModel{{Name: "alpha"}, {Name: "alpha"}, {Name: "beta"}})
+
+	// The view holds the data of its last refresh
+	var counts []nameCount
+	db.Raw("SELECT name, count FROM model_counts ORDER BY name").Scan(&counts)
+	if len(counts) != 0 {
+		t.Fatalf("Expected an empty view before refreshing, got %v", counts)
+	}
+
+	if err := store.RefreshNow(ctx, "tenant_a", "model_counts"); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	db.Raw("SELECT name, count FROM model_counts ORDER BY name").Scan(&counts)
+	if len(counts) != 2 || counts[0] != (nameCount{"alpha", 2}) || counts[1] != (nameCount{"beta", 1}) {
+		t.Fatalf("Expected [{alpha 2} {beta 1}], got %v", counts)
+	}
+
+	// Populated views with a unique index refresh concurrently
+	db.Create(&TestModel{Name: "beta"})
+	if err := store.RefreshNow(ctx, "tenant_a", "model_counts"); err != nil {
+		t.Fatalf("Failed to refresh concurrently: %v", err)
+	}
+	counts = nil
+	db.Raw("SELECT name, count FROM model_counts ORDER BY name").Scan(&counts)
+	if len(counts) != 2 || counts[1] != (nameCount{"beta", 2}) {
+		t.Fatalf("Expected beta counted twice, got %v", counts)
+	}
+
+	if err := store.RefreshNow(ctx, "tenant_a", "unknown"); err == nil {
+		t.Fatal("Expected error for a view that is not configured")
+	}
+}
+
+func TestMaterializedViewRefresher(t *testing.T) {
+	defer func(tick time.Duration) { minRefreshTick = tick }(minRefreshTick)
+	minRefreshTick = 10 * time.Millisecond
+
+	config := DefaultConfig(getTestDSN(t))
+	config.AutoMigrate = true
+	config.Models = []interface{}{&TestModel{}}
+	config.MaterializedViews = []MatViewDef{{
+		Name:         "model_total",
+		SQL:          "SELECT count(*) AS total FROM test_models",
+		RefreshEvery: 100 * time.Millisecond,
+	}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	db, err := store.GetTenantDB(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	db.Create(&[]TestModel{{Name: "alpha"}, {Name: "beta"}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var total int
+		db.Raw("SELECT total FROM model_total").Scan(&total)
+		if total == 2 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the refresher to count 2 rows, got %d", total)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestMatViewSQL(t *testing.T) {
+	statements, err := matViewSQL(MatViewDef{
+		Name:      "daily",
+		SQL:       "SELECT day, count(*) FROM {{.Schema}}.orders GROUP BY day",
+		UniqueKey: []string{"day"},
+	}, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+
+	expected := []string{
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS "tenant_a"."daily" AS SELECT day, count(*) FROM tenant_a.orders GROUP BY day`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "daily_key" ON "tenant_a"."daily" ("day")`,
+	}
+	if strings.Join(statements, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected %q, got %q", expected, statements)
+	}
+
+	if _, err := matViewSQL(MatViewDef{SQL: "SELECT 1"}, "tenant_a"); err == nil {
+		t.Fatal("Expected error for a view without a name")
+	}
+}
+
+func TestRefreshDueJitter(t *testing.T) {
+	def := MatViewDef{Name: "daily", RefreshEvery: time.Minute}
+	start := time.Unix(1_700_000_000, 0)
+
+	// Every tenant is due once per period, at its own offset
+	offsets := make(map[time.Duration]bool)
+	for _, tenantSchema := range []string{"tenant_a", "tenant_b", "tenant_c", "tenant_d"} {
+		due := 0
+		for step := time.Duration(0); step < 10*time.Minute; step += time.Second {
+			if refreshDue(tenantSchema, def, start.Add(step), start.Add(step+time.Second)) {
+				due++
+			}
+		}
+		if due != 10 {
+			t.Fatalf("Expected %s due 10 times in 10 minutes, got %d", tenantSchema, due)
+		}
+		offsets[refreshOffset(tenantSchema, def.Name, def.RefreshEvery)] = true
+	}
+	if len(offsets) < 2 {
+		t.Fatalf("Expected tenants spread over the period, got offsets %v", offsets)
+	}
+
+	// A slow tick still refreshes once
+	if !refreshDue("tenant_a", def, start, start.Add(3*time.Minute)) {
+		t.Fatal("Expected a refresh after missed periods")
+	}
+}
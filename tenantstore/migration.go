@@ -0,0 +1,187 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// MigrationHook is implemented by models that need DDL once their table is
+// migrated, such as a view joining it with tables from earlier model groups.
+// db's search_path targets the tenant schema.
+type MigrationHook interface {
+	AfterMigrate(db *gorm.DB, tenantSchema string) error
+}
+
+// modelGroups returns Config.Models as the first group followed by
+// Config.ModelGroups, skipping empty groups
+func (s *TenantStore) modelGroups() [][]interface{} {
+	return s.groupModels(s.config().Models)
+}
+
+// groupModels returns models as the first group followed by
+// Config.ModelGroups, skipping empty groups
+func (s *TenantStore) groupModels(models []interface{}) [][]interface{} {
+	groups := make([][]interface{}, 0, 1+len(s.config().ModelGroups))
+	for _, group := range append([][]interface{}{models}, s.config().ModelGroups...) {
+		if len(group) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// tenantModelGroups returns the model groups migrated into a tenant: the
+// models of Config.ModelsFor, or Config.Models without it, followed by
+// Config.ModelGroups. ModelsFor may query the store, so callers must not
+// hold mu.
+func (s *TenantStore) tenantModelGroups(ctx context.Context, tenantSchema string) ([][]interface{}, error) {
+	modelsFor := s.config().ModelsFor
+	if modelsFor == nil {
+		return s.modelGroups(), nil
+	}
+	models, err := modelsFor(ctx, tenantSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get models of %s: %w", tenantSchema, err)
+	}
+	return s.groupModels(models), nil
+}
+
+// tenantModels returns every model migrated into a tenant in migration order
+func (s *TenantStore) tenantModels(ctx context.Context, tenantSchema string) ([]interface{}, error) {
+	groups, err := s.tenantModelGroups(ctx, tenantSchema)
+	if err != nil {
+		return nil, err
+	}
+	return flatten(groups), nil
+}
+
+// models returns every model of every group in migration order
+func (s *TenantStore) models() []interface{} {
+	return flatten(s.modelGroups())
+}
+
+// flatten returns the models of the groups in order
+func flatten(groups [][]interface{}) []interface{} {
+	var models []interface{}
+	for _, group := range groups {
+		models = append(models, group...)
+	}
+	return models
+}
+
+// modelReorderer is implemented by GORM's migrators
+type modelReorderer interface {
+	ReorderModels(values []interface{}, autoAdd bool) []interface{}
+}
+
+// autoMigrate migrates the groups in order. Within a group models are sorted
+// by their relations like AutoMigrate does, then migrated one at a time so
+// errors name the model, and each model's MigrationHook runs right after it.
+func (s *TenantStore) autoMigrate(ctx context.Context, db *gorm.DB, tenantSchema string, groups [][]interface{}) error {
+	if err := s.failpoint(FailpointMigrate, tenantSchema); err != nil {
+		return err
+	}
+
+	db = db.WithContext(ctx)
+
+	for _, group := range groups {
+		if reorderer, ok := db.Migrator().(modelReorderer); ok {
+			group = reorderer.ReorderModels(group, false)
+		}
+
+		for _, model := range group {
+			if err := db.AutoMigrate(model); err != nil {
+				return fmt.Errorf("failed to migrate %s in %s: %w", modelName(db, model), tenantSchema, err)
+			}
+			if hook, ok := model.(MigrationHook); ok {
+				if err := hook.AfterMigrate(db, tenantSchema); err != nil {
+					return fmt.Errorf("migration hook of %s failed in %s: %w", modelName(db, model), tenantSchema, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// modelName returns the model's struct name for error messages
+func modelName(db *gorm.DB, model interface{}) string {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return fmt.Sprintf("%T", model)
+	}
+	return stmt.Schema.Name
+}
+
+// migrateWithMigrationDSN creates the tenant schema and migrates the model
+// groups on a short-lived connection opened from GetMigrationDSN. The
+// connection is closed before returning so the privileged role is never cached.
+func (s *TenantStore) migrateWithMigrationDSN(ctx context.Context, tenantSchema string, groups [][]interface{}) error {
+	migrationDB, err := s.openMigrationDB(tenantSchema)
+	if err != nil {
+		return err
+	}
+	defer closeDB(migrationDB)
+
+	if err := s.failpoint(FailpointEnsureSchema, tenantSchema); err != nil {
+		return err
+	}
+
+	createSQL, err := createSchemaSQL(tenantSchema)
+	if err != nil {
+		return err
+	}
+	if err := migrationDB.WithContext(ctx).Exec(createSQL).Error; err != nil {
+		return fmt.Errorf("failed to create schema on migration connection for %s: %w", tenantSchema, err)
+	}
+	if err := s.applyGrants(ctx, migrationDB, tenantSchema); err != nil {
+		return err
+	}
+	s.commentSchema(ctx, migrationDB, tenantSchema)
+
+	if len(groups) > 0 {
+		if err := s.autoMigrate(ctx, migrationDB, tenantSchema, groups); err != nil {
+			return err
+		}
+		if err := s.afterAutoMigrate(ctx, migrationDB, tenantSchema); err != nil {
+			return err
+		}
+	}
+
+	if err := s.createViews(ctx, migrationDB, tenantSchema); err != nil {
+		return err
+	}
+	return s.createMaterializedViews(ctx, migrationDB, tenantSchema)
+}
+
+// afterAutoMigrate applies the schema setup that needs the migrated tables:
+// search indexes, the ID strategy and cross-schema foreign keys
+func (s *TenantStore) afterAutoMigrate(ctx context.Context, db *gorm.DB, tenantSchema string) error {
+	if err := s.createSearchIndexes(ctx, db, tenantSchema); err != nil {
+		return err
+	}
+	if err := s.applyIDStrategy(ctx, db, tenantSchema); err != nil {
+		return err
+	}
+	return s.applyForeignKeys(ctx, db, tenantSchema)
+}
+
+// openMigrationDB opens a connection from GetMigrationDSN
+func (s *TenantStore) openMigrationDB(tenantSchema string) (*gorm.DB, error) {
+	migrationDB, err := gorm.Open(postgres.Open(s.config().GetMigrationDSN(tenantSchema)), &gorm.Config{
+		Logger: s.config().Logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to migration database for %s: %w", tenantSchema, err)
+	}
+	return migrationDB, nil
+}
+
+// closeDB closes the connection pool behind db
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
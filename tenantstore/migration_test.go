@@ -0,0 +1,93 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrationDSNSeparatesPrivileges(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	role := fmt.Sprintf("test_runtime_%d", time.Now().Unix())
+
+	config := DefaultConfig(dsn)
+	config.AutoMigrate = true
+	config.Models = []interface{}{&TestModel{}}
+
+	// Migrations use the privileged test role
+	config.GetMigrationDSN = func(tenantSchema string) string {
+		return dsn + fmt.Sprintf(" search_path=%s,public", tenantSchema)
+	}
+
+	// Runtime connections use a role without DDL privileges
+	config.GetTenantDSN = func(tenantSchema string) string {
+		return dsn + fmt.Sprintf(" user=%s password=runtime search_path=%s,public", role, tenantSchema)
+	}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	tenantSchema := fmt.Sprintf("test_tenant_%d", time.Now().Unix())
+
+	if err := store.masterDB.Exec(fmt.Sprintf("CREATE ROLE %s LOGIN PASSWORD 'runtime'", role)).Error; err != nil {
+		t.Fatalf("Failed to create runtime role: %v", err)
+	}
+
+	// Clean up after test
+	defer func() {
+		store.RemoveTenantDB(tenantSchema)
+		store.masterDB.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", tenantSchema))
+		store.masterDB.Exec(fmt.Sprintf("DROP ROLE IF EXISTS %s", role))
+	}()
+
+	// Provisioning succeeds through the migration connection
+	tenantDB, err := store.GetTenantDB(ctx, tenantSchema)
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	// Tables were created by the migration connection
+	var count int64
+	store.masterDB.Raw("SELECT count(*) FROM pg_tables WHERE schemaname = ? AND tablename = 'test_models'", tenantSchema).Scan(&count)
+	if count != 1 {
+		t.Fatalf("Expected test_models in %s, found %d", tenantSchema, count)
+	}
+
+	// The runtime connection cannot run DDL
+	err = tenantDB.Exec(fmt.Sprintf("CREATE TABLE %s.forbidden (id int)", tenantSchema)).Error
+	if err == nil {
+		t.Fatal("Expected runtime connection to be denied CREATE TABLE")
+	}
+}
+
+func TestMigrationDSNConnectionError(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.GetMigrationDSN = func(tenantSchema string) string {
+		return "host=127.0.0.1 port=1 user=nobody dbname=nothing sslmode=disable connect_timeout=1"
+	}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	_, err = store.GetTenantDB(context.Background(), "test_tenant_migration_error")
+	if err == nil {
+		t.Fatal("Expected error when migration connection fails")
+	}
+
+	if got := err.Error(); !strings.Contains(got, "migration") {
+		t.Fatalf("Expected error to name the migration connection, got %q", got)
+	}
+}
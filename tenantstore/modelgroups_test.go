@@ -0,0 +1,98 @@
+package tenantstore
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type GroupOrder struct {
+	ID    uint `gorm:"primaryKey"`
+	Total int
+}
+
+type GroupInvoice struct {
+	ID      uint `gorm:"primaryKey"`
+	OrderID uint
+}
+
+// AfterMigrate creates a view that needs group_orders to exist
+func (GroupInvoice) AfterMigrate(db *gorm.DB, tenantSchema string) error {
+	return db.Exec(`CREATE OR REPLACE VIEW group_invoice_totals AS
+		SELECT i.id, o.total FROM group_invoices i JOIN group_orders o ON o.id = i.order_id`).Error
+}
+
+type GroupNote struct {
+	ID   uint `gorm:"primaryKey"`
+	Body string
+}
+
+func TestModelGroupsOrder(t *testing.T) {
+	store := withConfig(&TenantStore{}, &Config{
+		Models:      []interface{}{&GroupOrder{}},
+		ModelGroups: [][]interface{}{{}, {&GroupInvoice{}}, {&GroupNote{}}},
+	})
+
+	expected := [][]interface{}{{&GroupOrder{}}, {&GroupInvoice{}}, {&GroupNote{}}}
+	if groups := store.modelGroups(); !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("Expected Models first and empty groups skipped, got %v", groups)
+	}
+	if models := store.models(); len(models) != 3 {
+		t.Fatalf("Expected 3 models, got %v", models)
+	}
+}
+
+func TestModelGroupsMigrateInOrder(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+
+	config := DefaultConfig(dsn)
+	config.ModelGroups = [][]interface{}{{&GroupOrder{}}, {&GroupInvoice{}}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	db, err := store.GetTenantDB(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to create tenant: %v", err)
+	}
+
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM group_invoice_totals").Scan(&count).Error; err != nil {
+		t.Fatalf("Expected the hook's view to exist: %v", err)
+	}
+
+	// Only the new model is migrated into the existing tenant
+	if err := store.MigrateModels(ctx, "tenant_a", &GroupNote{}); err != nil {
+		t.Fatalf("Failed to migrate model: %v", err)
+	}
+	if !db.Migrator().HasTable(&GroupNote{}) {
+		t.Fatal("Expected group_notes to be created")
+	}
+	if err := store.MigrateModels(ctx, "missing", &GroupNote{}); err == nil {
+		t.Fatal("Expected error for a missing schema")
+	}
+
+	// The hook fails when its group runs before the tables it needs
+	reversed := DefaultConfig(dsn)
+	reversed.ModelGroups = [][]interface{}{{&GroupInvoice{}}, {&GroupOrder{}}}
+
+	reversedStore, err := New(reversed)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer reversedStore.Close()
+
+	_, err = reversedStore.GetTenantDB(ctx, "tenant_b")
+	if err == nil || !strings.Contains(err.Error(), "GroupInvoice") || !strings.Contains(err.Error(), "tenant_b") {
+		t.Fatalf("Expected error naming GroupInvoice and tenant_b, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type EnterpriseAuditLog struct {
+	ID     uint `gorm:"primaryKey"`
+	Action string
+}
+
+// planModels returns TestModel for every tenant and EnterpriseAuditLog for
+// tenants on the enterprise plan
+func planModels(store **TenantStore) func(ctx context.Context, tenantSchema string) ([]interface{}, error) {
+	return func(ctx context.Context, tenantSchema string) ([]interface{}, error) {
+		models := []interface{}{&TestModel{}}
+		tenant, err := (*store).LookupTenant(ctx, tenantSchema)
+		if errors.Is(err, ErrTenantNotFound) {
+			return models, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tenant.Plan == "enterprise" {
+			models = append(models, &EnterpriseAuditLog{})
+		}
+		return models, nil
+	}
+}
+
+func TestTenantModelGroups(t *testing.T) {
+	store := withConfig(&TenantStore{}, &Config{
+		Models:      []interface{}{&GroupOrder{}},
+		ModelGroups: [][]interface{}{{&GroupInvoice{}}},
+	})
+	ctx := context.Background()
+
+	groups, err := store.tenantModelGroups(ctx, "acme")
+	if err != nil || !reflect.DeepEqual(groups, store.modelGroups()) {
+		t.Fatalf("Expected Models without ModelsFor, got %v (%v)", groups, err)
+	}
+
+	store = withConfig(&TenantStore{}, &Config{
+		Models:      []interface{}{&GroupOrder{}},
+		ModelGroups: [][]interface{}{{&GroupInvoice{}}},
+		ModelsFor: func(ctx context.Context, tenantSchema string) ([]interface{}, error) {
+			if tenantSchema == "broken" {
+				return nil, errors.New("billing unavailable")
+			}
+			return []interface{}{&GroupOrder{}, &EnterpriseAuditLog{}}, nil
+		},
+	})
+	expected := [][]interface{}{{&GroupOrder{}, &EnterpriseAuditLog{}}, {&GroupInvoice{}}}
+	if groups, err := store.tenantModelGroups(ctx, "acme"); err != nil || !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("Expected ModelsFor in place of Models before ModelGroups, got %v (%v)", groups, err)
+	}
+	if models, err := store.tenantModels(ctx, "acme"); err != nil || len(models) != 3 {
+		t.Fatalf("Expected 3 models, got %v (%v)", models, err)
+	}
+	if _, err := store.tenantModelGroups(ctx, "broken"); err == nil || err.Error() != "failed to get models of broken: billing unavailable" {
+		t.Fatalf("Expected the ModelsFor error, got %v", err)
+	}
+}
+
+func TestSplitPlanTables(t *testing.T) {
+	drift := SchemaDrift{MissingTables: []string{"enterprise_audit_logs", "legacy", "test_models"}}
+	referenceTables := map[string]bool{"enterprise_audit_logs": true, "test_models": true}
+	tenantTables := map[string]bool{"test_models": true}
+
+	drift = drift.splitPlanTables(referenceTables, tenantTables)
+	if !reflect.DeepEqual(drift.PlanTables, []string{"enterprise_audit_logs"}) {
+		t.Fatalf("Expected enterprise_audit_logs as a plan table, got %v", drift.PlanTables)
+	}
+	if !reflect.DeepEqual(drift.MissingTables, []string{"legacy", "test_models"}) {
+		t.Fatalf("Expected other tables to stay missing, got %v", drift.MissingTables)
+	}
+	if !(SchemaDrift{PlanTables: []string{"enterprise_audit_logs"}}).IsEmpty() {
+		t.Fatal("Expected plan tables alone not to be drift")
+	}
+}
+
+func TestModelsForPlanUpgrade(t *testing.T) {
+	t.Parallel()
+
+	var store *TenantStore
+	config := DefaultConfig(getTestDSN(t))
+	config.AutoMigrate = true
+	config.EnableRegistry = true
+	config.ModelsFor = planModels(&store)
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for _, tenant := range []Tenant{{Schema: "tenant_free", Plan: "free", Active: true}, {Schema: "tenant_ent", Plan: "enterprise", Active: true}} {
+		if err := store.RegisterTenant(ctx, &tenant); err != nil {
+			t.Fatalf("Failed to register %s: %v", tenant.Schema, err)
+		}
+	}
+
+	free, err := store.GetTenantDB(ctx, "tenant_free")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	if err := free.Create(&TestModel{Name: "kept"}).Error; err != nil {
+		t.Fatalf("Failed to create record: %v", err)
+	}
+	if free.Migrator().HasTable(&EnterpriseAuditLog{}) {
+		t.Fatal("Expected the free tenant to lack enterprise_audit_logs")
+	}
+	enterprise, err := store.GetTenantDB(ctx, "tenant_ent")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	if !enterprise.Migrator().HasTable(&EnterpriseAuditLog{}) {
+		t.Fatal("Expected the enterprise tenant to have enterprise_audit_logs")
+	}
+
+	// The missing table is expected on the free plan
+	report, err := store.DriftReport(ctx, "tenant_ent")
+	if err != nil {
+		t.Fatalf("Failed to build drift report: %v", err)
+	}
+	if drift, ok := report.Drifted["tenant_free"]; ok {
+		t.Fatalf("Expected the free tenant not to drift, got %+v", drift)
+	}
+
+	plan, err := store.PlanMigration(ctx, "tenant_free")
+	if err != nil || len(plan.Steps) != 0 {
+		t.Fatalf("Expected nothing to migrate on the free plan, got %+v (%v)", plan, err)
+	}
+
+	// Upgrade the plan and migrate the tables it adds
+	if err := store.GetMasterDB().Model(&Tenant{}).Where("schema = ?", "tenant_free").Update("plan", "enterprise").Error; err != nil {
+		t.Fatalf("Failed to upgrade plan: %v", err)
+	}
+	store.InvalidateTenant("tenant_free")
+
+	plan, err = store.PlanMigration(ctx, "tenant_free")
+	if err != nil || len(plan.Steps) != 1 || plan.Steps[0].Action != "create table enterprise_audit_logs" {
+		t.Fatalf("Expected enterprise_audit_logs to be planned, got %+v (%v)", plan, err)
+	}
+	if err := store.MigrateTenant(ctx, "tenant_free"); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if !free.Migrator().HasTable(&EnterpriseAuditLog{}) {
+		t.Fatal("Expected enterprise_audit_logs after the upgrade")
+	}
+
+	var names []string
+	if err := free.Model(&TestModel{}).Pluck("name", &names).Error; err != nil || !reflect.DeepEqual(names, []string{"kept"}) {
+		t.Fatalf("Expected existing records to be intact, got %v (%v)", names, err)
+	}
+}
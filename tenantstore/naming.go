@@ -0,0 +1,88 @@
+package tenantstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxSchemaNameLength is PostgreSQL's identifier limit in bytes. Longer names
+// are silently truncated by the server.
+const MaxSchemaNameLength = 63
+
+// schemaHashLength and schemaPrefixLength split a shortened schema name into
+// a readable prefix, an underscore and a hash of the full tenant ID
+const (
+	schemaHashLength   = 12
+	schemaPrefixLength = MaxSchemaNameLength - schemaHashLength - 1
+)
+
+// SchemaNamer maps a tenant ID to its schema name. It must be a pure
+// function: the same ID must always map to the same schema, across restarts
+// and processes. SchemaName lowercases the result.
+type SchemaNamer func(tenantID string) (string, error)
+
+// DefaultSchemaNamer uses tenant IDs of up to 63 bytes in lower case. Longer
+// IDs keep their first 50 bytes, cut at a character boundary, followed by an
+// underscore and the first 12 hex digits of the SHA-256 of the full ID, so
+// IDs sharing a long prefix get distinct schemas instead of being truncated
+// into the same one.
+func DefaultSchemaNamer(tenantID string) (string, error) {
+	if len(tenantID) <= MaxSchemaNameLength {
+		name := strings.ToLower(tenantID)
+		return name, validateSchemaName(name)
+	}
+
+	prefix := tenantID[:schemaPrefixLength]
+	for !utf8.ValidString(prefix) && len(prefix) > 0 {
+		prefix = prefix[:len(prefix)-1]
+	}
+
+	sum := sha256.Sum256([]byte(tenantID))
+	name := strings.ToLower(prefix) + "_" + hex.EncodeToString(sum[:])[:schemaHashLength]
+	return name, validateSchemaName(name)
+}
+
+// validateSchemaName rejects names PostgreSQL cannot store unchanged. Other
+// characters, such as spaces and quotes, are allowed, so statements must
+// quote schema names with quoteIdentifier.
+func validateSchemaName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("tenant schema cannot be empty")
+	case len(name) > MaxSchemaNameLength:
+		return fmt.Errorf("schema name %q exceeds %d bytes", name, MaxSchemaNameLength)
+	case !utf8.ValidString(name) || strings.IndexByte(name, 0) >= 0:
+		return fmt.Errorf("schema name %q is not a valid identifier", name)
+	}
+	return nil
+}
+
+// SchemaName returns the schema for a tenant ID using its alias from
+// Config.SchemaAliases or QuarantineTenant, else Config.SchemaNamer, or
+// DefaultSchemaNamer if unset, composed with Config.Environment. Schemas are
+// lower case, the way PostgreSQL folds unquoted names, so the store and its
+// callers pass them around and quote them as they are.
+func (s *TenantStore) SchemaName(tenantID string) (string, error) {
+	if aliases := s.aliases.Load(); aliases != nil {
+		if tenantSchema, ok := (*aliases)[tenantID]; ok {
+			return strings.ToLower(tenantSchema), nil
+		}
+	}
+
+	namer := DefaultSchemaNamer
+	if s.config().SchemaNamer != nil {
+		namer = s.config().SchemaNamer
+	}
+	tenantSchema, err := namer(tenantID)
+	if err != nil {
+		return "", err
+	}
+	if s.config().Environment != "" {
+		tenantSchema = s.config().composer().Compose(tenantSchema, s.config().Environment)
+	}
+	tenantSchema = strings.ToLower(tenantSchema)
+	return tenantSchema, validateSchemaName(tenantSchema)
+}
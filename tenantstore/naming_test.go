@@ -0,0 +1,97 @@
+package tenantstore
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDefaultSchemaNamerShortensLongIDs(t *testing.T) {
+	prefix := "acme_corporation_" + strings.Repeat("x", 43) // 60 characters
+	first := prefix + "_3f2a9c1e-7d4b-4f0a-9b6e-1c2d3e4f5a6b"
+	second := prefix + "_8e7d6c5b-4a39-4281-8f7e-6d5c4b3a2918"
+
+	a, err := DefaultSchemaNamer(first)
+	if err != nil {
+		t.Fatalf("Failed to name schema: %v", err)
+	}
+	b, err := DefaultSchemaNamer(second)
+	if err != nil {
+		t.Fatalf("Failed to name schema: %v", err)
+	}
+
+	if a == b {
+		t.Fatalf("Expected distinct schemas for IDs sharing a 60-character prefix, got %s", a)
+	}
+	for _, name := range []string{a, b} {
+		if len(name) != MaxSchemaNameLength {
+			t.Fatalf("Expected %d-byte name, got %d: %s", MaxSchemaNameLength, len(name), name)
+		}
+		if !strings.HasPrefix(name, prefix[:schemaPrefixLength]+"_") {
+			t.Fatalf("Expected name to keep the first %d bytes, got %s", schemaPrefixLength, name)
+		}
+	}
+
+	// The mapping is a pure function
+	if again, _ := DefaultSchemaNamer(first); again != a {
+		t.Fatalf("Expected stable name %s, got %s", a, again)
+	}
+}
+
+func TestDefaultSchemaNamerKeepsShortIDs(t *testing.T) {
+	id := strings.Repeat("a", MaxSchemaNameLength)
+	if name, err := DefaultSchemaNamer(id); err != nil || name != id {
+		t.Fatalf("Expected %s unchanged, got %s (%v)", id, name, err)
+	}
+
+	if _, err := DefaultSchemaNamer(""); err == nil {
+		t.Fatal("Expected error for empty tenant ID")
+	}
+}
+
+func TestDefaultSchemaNamerCutsAtCharacterBoundary(t *testing.T) {
+	// 49 ASCII bytes followed by two-byte characters puts byte 50 mid-character
+	id := strings.Repeat("a", 49) + strings.Repeat("é", 20)
+
+	name, err := DefaultSchemaNamer(id)
+	if err != nil {
+		t.Fatalf("Failed to name schema: %v", err)
+	}
+	if !utf8.ValidString(name) || len(name) > MaxSchemaNameLength {
+		t.Fatalf("Expected a valid name within the limit, got %q", name)
+	}
+}
+
+func TestSchemaNameLowercases(t *testing.T) {
+	if name, err := DefaultSchemaNamer("Acme"); err != nil || name != "acme" {
+		t.Fatalf("Expected acme, got %s (%v)", name, err)
+	}
+
+	config := DefaultConfig("")
+	config.Environment = "Staging"
+	config.SchemaNamer = func(tenantID string) (string, error) {
+		return "T_" + tenantID, nil
+	}
+	config.SchemaAliases = map[string]string{"Initech": "Quarantined_Initech"}
+	store := withConfig(&TenantStore{}, config)
+	store.aliases.Store(&config.SchemaAliases)
+
+	if name, _ := store.SchemaName("Acme"); name != "t_acme__staging" {
+		t.Fatalf("Expected t_acme__staging, got %s", name)
+	}
+	if name, _ := store.SchemaName("Initech"); name != "quarantined_initech" {
+		t.Fatalf("Expected quarantined_initech, got %s", name)
+	}
+}
+
+func TestSchemaNameUsesConfiguredNamer(t *testing.T) {
+	store := withConfig(&TenantStore{}, &Config{
+		SchemaNamer: func(tenantID string) (string, error) {
+			return "t_" + tenantID, nil
+		},
+	})
+
+	if name, _ := store.SchemaName("acme"); name != "t_acme" {
+		t.Fatalf("Expected t_acme, got %s", name)
+	}
+}
@@ -0,0 +1,212 @@
+package tenantstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultNotifyChannel is the channel tenant events are published on when
+// Config.NotifyChannel is empty
+const DefaultNotifyChannel = "mt_tenant_events"
+
+// Listener reconnect backoff, doubled after each failed attempt
+const (
+	listenerMinBackoff = 100 * time.Millisecond
+	listenerMaxBackoff = 30 * time.Second
+)
+
+// notification is the NOTIFY payload. Origin identifies the publishing store
+// so it can skip its own events.
+type notification struct {
+	Type   TenantEventType `json:"type"`
+	Schema string          `json:"schema"`
+	Origin string          `json:"origin"`
+}
+
+// ListenerHealth reports the state of the notification listener
+type ListenerHealth struct {
+	Connected        bool      `json:"connected"`
+	Reconnects       int       `json:"reconnects"`
+	LastError        string    `json:"last_error,omitempty"`
+	LastNotification time.Time `json:"last_notification,omitempty"`
+}
+
+// listener receives other instances' tenant events on a dedicated connection
+type listener struct {
+	channel string
+	origin  string
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu     sync.Mutex
+	health ListenerHealth
+}
+
+func (s *TenantStore) notifyChannel() string {
+	if s.config().NotifyChannel != "" {
+		return s.config().NotifyChannel
+	}
+	return DefaultNotifyChannel
+}
+
+// startListener starts listening for tenant events if notifications are on
+func (s *TenantStore) startListener() {
+	if !s.config().Notifications {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.listener = &listener{
+		channel: s.notifyChannel(),
+		origin:  newOrigin(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go s.listen(ctx)
+}
+
+// stopListener stops the listener and waits for it to close its connection
+func (s *TenantStore) stopListener() {
+	if s.listener == nil {
+		return
+	}
+	s.listener.cancel()
+	<-s.listener.done
+}
+
+// listen keeps a LISTEN connection open until ctx is cancelled, reconnecting
+// with exponential backoff
+func (s *TenantStore) listen(ctx context.Context) {
+	defer close(s.listener.done)
+
+	backoff := listenerMinBackoff
+	for {
+		err := s.listenOnce(ctx, func() { backoff = listenerMinBackoff })
+		if ctx.Err() != nil {
+			return
+		}
+		s.listener.setError(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, listenerMaxBackoff)
+	}
+}
+
+// listenOnce connects, listens and handles notifications until the
+// connection fails. connected is called once LISTEN succeeds.
+func (s *TenantStore) listenOnce(ctx context.Context, connected func()) error {
+	dsn := s.config().MasterDSN
+	if s.config().DSNProvider != nil {
+		var err error
+		if dsn, err = s.config().DSNProvider(ctx); err != nil {
+			return fmt.Errorf("failed to get master DSN from provider: %w", err)
+		}
+	}
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return fmt.Errorf("failed to connect listener: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+quoteIdentifier(s.listener.channel)); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.listener.channel, err)
+	}
+	s.listener.setConnected()
+	connected()
+
+	// Events missed while disconnected are lost, so start from a clean cache
+	s.registry.clear()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("listener connection failed: %w", err)
+		}
+		s.handleNotification(n.Payload)
+	}
+}
+
+// handleNotification invalidates what another instance changed
+func (s *TenantStore) handleNotification(payload string) {
+	var n notification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil || n.Schema == "" {
+		return
+	}
+	s.listener.notified()
+	if n.Origin == s.listener.origin {
+		return
+	}
+
+	s.registry.delete(n.Schema)
+	gone := n.Type == EventSchemaDropped || n.Type == EventSchemaQuarantined
+	if gone {
+		s.UnpinTenant(n.Schema)
+	}
+	if s.config().EvictOnNotify || gone || n.Type == EventSchemaRestored || n.Type == EventTenantConverted {
+		s.RemoveTenantDB(n.Schema)
+	} else if n.Type == EventTenantMoved {
+		s.retireTenantDB(n.Schema)
+	}
+}
+
+// notify publishes a tenant event to other instances
+func (s *TenantStore) notify(ctx context.Context, eventType TenantEventType, tenantSchema string) {
+	if s.listener == nil {
+		return
+	}
+
+	payload, _ := json.Marshal(notification{Type: eventType, Schema: tenantSchema, Origin: s.listener.origin})
+	err := s.master().WithContext(ctx).Exec("SELECT pg_notify(?, ?)", s.listener.channel, string(payload)).Error
+	if err != nil {
+		s.config().Logger.Error(ctx, "failed to notify tenant event %s for %s: %v", eventType, tenantSchema, err)
+	}
+}
+
+func (l *listener) setConnected() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.health.Connected = true
+	l.health.LastError = ""
+}
+
+func (l *listener) setError(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.health.Connected = false
+	l.health.Reconnects++
+	if err != nil && !errors.Is(err, context.Canceled) {
+		l.health.LastError = err.Error()
+	}
+}
+
+func (l *listener) notified() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.health.LastNotification = time.Now()
+}
+
+func (l *listener) snapshot() ListenerHealth {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.health
+}
+
+// newOrigin returns a random ID for this store instance
+func newOrigin() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,97 @@
+package tenantstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestHandleNotification(t *testing.T) {
+	store := withConfig(&TenantStore{
+		tenantDBs: make(map[string]*gorm.DB),
+		health:    make(map[string]*tenantHealth),
+		registry:  newRegistryCache(nil, time.Hour),
+		listener:  &listener{origin: "self"},
+	}, &Config{})
+	cached := func() bool {
+		_, ok := store.registry.get("acme")
+		return ok
+	}
+	store.registry.set("acme", &Tenant{Schema: "acme", Active: true})
+
+	// The store's own events and malformed payloads are ignored
+	store.handleNotification(`{"type":"tenant.deactivated","schema":"acme","origin":"self"}`)
+	store.handleNotification(`not json`)
+	if !cached() {
+		t.Fatal("Expected own events not to invalidate the cache")
+	}
+
+	store.handleNotification(`{"type":"tenant.deactivated","schema":"acme","origin":"other"}`)
+	if cached() {
+		t.Fatal("Expected another instance's event to invalidate the cache")
+	}
+	if store.listener.snapshot().LastNotification.IsZero() {
+		t.Fatal("Expected the notification time to be recorded")
+	}
+}
+
+func TestNotificationsAcrossStores(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	newStore := func() *TenantStore {
+		config := DefaultConfig(dsn)
+		config.EnableRegistry = true
+		config.RegistryCacheTTL = time.Hour
+		config.Notifications = true
+
+		store, err := New(config)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	}
+	a, b := newStore(), newStore()
+
+	ctx := context.Background()
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("both listeners", func() bool {
+		return a.Health(ctx).Healthy() && b.Health(ctx).Healthy()
+	})
+
+	if err := a.RegisterTenant(ctx, &Tenant{Schema: "acme", Active: true}); err != nil {
+		t.Fatalf("Failed to register tenant: %v", err)
+	}
+	waitFor("b to see the new tenant", func() bool {
+		active, _ := b.IsTenantActive(ctx, "acme")
+		return active
+	})
+
+	// b has cached acme as active for an hour; the deactivation on a reaches
+	// it without waiting for the TTL
+	start := time.Now()
+	if err := a.DeactivateTenant(ctx, "acme"); err != nil {
+		t.Fatalf("Failed to deactivate tenant: %v", err)
+	}
+	waitFor("b to see the deactivation", func() bool {
+		active, _ := b.IsTenantActive(ctx, "acme")
+		return !active
+	})
+	t.Logf("Invalidated after %v", time.Since(start))
+
+	if health := b.Health(ctx); health.Listener == nil || health.Listener.LastNotification.IsZero() {
+		t.Fatalf("Expected the listener to report notifications, got %+v", health)
+	}
+}
@@ -0,0 +1,163 @@
+package tenantstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultKeepWarmInterval is how often pinned tenants' connections are used
+// when Config.KeepWarmInterval is not set
+const DefaultKeepWarmInterval = time.Minute
+
+// keeper periodically uses the connections of pinned tenants
+type keeper struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// PinTenant opens the tenant's connection if needed and keeps it open: it is
+// exempt from idle eviction and kept warm every Config.KeepWarmInterval, so
+// the tenant's requests never pay the reconnect cost. Pins last until
+// UnpinTenant or DropTenant.
+func (s *TenantStore) PinTenant(ctx context.Context, tenantSchema string) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+	if _, err := s.tenantDB(ctx, tenantSchema); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.pinned[strings.Clone(tenantSchema)] = true
+	s.mu.Unlock()
+
+	s.startKeeper()
+	return nil
+}
+
+// UnpinTenant makes the tenant's connection evictable again. The connection
+// stays open until it is evicted or removed.
+func (s *TenantStore) UnpinTenant(tenantSchema string) {
+	s.mu.Lock()
+	delete(s.pinned, tenantSchema)
+	s.mu.Unlock()
+}
+
+// PinnedTenants returns the pinned schemas, sorted
+func (s *TenantStore) PinnedTenants() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schemas := make([]string, 0, len(s.pinned))
+	for tenantSchema := range s.pinned {
+		schemas = append(schemas, tenantSchema)
+	}
+	sort.Strings(schemas)
+	return schemas
+}
+
+// startKeeper starts the keep-warm loop unless it is running
+func (s *TenantStore) startKeeper() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keeper != nil {
+		return
+	}
+
+	interval := s.config().KeepWarmInterval
+	if interval <= 0 {
+		interval = DefaultKeepWarmInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k := &keeper{cancel: cancel, done: make(chan struct{})}
+	s.keeper = k
+
+	go func() {
+		defer close(k.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.keepWarm(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopKeeper stops the keep-warm loop and waits for it to return
+func (s *TenantStore) stopKeeper() {
+	s.mu.Lock()
+	k := s.keeper
+	s.keeper = nil
+	s.mu.Unlock()
+
+	if k == nil {
+		return
+	}
+	k.cancel()
+	<-k.done
+}
+
+// keepWarm uses the connections of every pinned tenant
+func (s *TenantStore) keepWarm(ctx context.Context) {
+	for _, tenantSchema := range s.PinnedTenants() {
+		if err := s.warmTenant(ctx, tenantSchema); err != nil && ctx.Err() == nil {
+			s.config().Logger.Warn(ctx, "failed to keep tenant %s warm: %v", tenantSchema, err)
+		}
+	}
+}
+
+// warmTenant pings each idle connection of the tenant's pool, so neither
+// the server nor anything in between drops them as idle. Pools that were
+// closed are dialed again, but only while the schema exists.
+func (s *TenantStore) warmTenant(ctx context.Context, tenantSchema string) error {
+	s.mu.RLock()
+	db, cached := s.tenantDBs[tenantSchema]
+	s.mu.RUnlock()
+
+	if !cached {
+		if _, err := s.schemaTables(ctx, tenantSchema); err != nil {
+			return err
+		}
+		var err error
+		if db, err = s.tenantDB(ctx, tenantSchema); err != nil {
+			return err
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	// Holding each connection makes the pool hand out the next idle one
+	idle := max(sqlDB.Stats().Idle, 1)
+	conns := make([]*sql.Conn, 0, idle)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	for i := 0; i < idle; i++ {
+		conn, err := sqlDB.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+		if err := conn.PingContext(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// newIdlePool opens an in-memory database with one idle connection
+func newIdlePool(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", name)), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", name, err)
+	}
+	if err := db.Exec("SELECT 1").Error; err != nil {
+		t.Fatalf("Failed to use %s: %v", name, err)
+	}
+	t.Cleanup(func() { closeDB(db) })
+	return db
+}
+
+func TestEvictIdleSkipsPinnedTenants(t *testing.T) {
+	store := withConfig(&TenantStore{
+		tenantDBs: map[string]*gorm.DB{
+			"premium": newIdlePool(t, "pinning_premium"),
+			"basic":   newIdlePool(t, "pinning_basic"),
+		},
+		tenantVersions:  map[string]uint64{"premium": 0, "basic": 0},
+		health:          map[string]*tenantHealth{"premium": {}, "basic": {}},
+		sessionSettings: map[string]map[string]string{"basic": {"TimeZone": "UTC"}},
+		pinned:          map[string]bool{"premium": true},
+	}, DefaultConfig(""))
+
+	if evicted := store.evictIdle(""); evicted != 1 {
+		t.Fatalf("Expected 1 evicted pool, got %d", evicted)
+	}
+	if _, cached := store.tenantDBs["premium"]; !cached {
+		t.Fatal("Expected the pinned tenant to survive eviction")
+	}
+	if _, cached := store.tenantDBs["basic"]; cached {
+		t.Fatal("Expected the unpinned tenant to be evicted")
+	}
+	if _, ok := store.sessionSettings["basic"]; ok {
+		t.Fatal("Expected the evicted tenant's settings to be dropped")
+	}
+
+	store.UnpinTenant("premium")
+	if evicted := store.evictIdle(""); evicted != 1 {
+		t.Fatalf("Expected the unpinned tenant to be evicted, got %d", evicted)
+	}
+}
+
+func TestPinTenant(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.PinnedTenants = []string{"premium"}
+	config.KeepWarmInterval = 50 * time.Millisecond
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.PinTenant(ctx, "vip"); err != nil {
+		t.Fatalf("Failed to pin tenant: %v", err)
+	}
+	if _, err := store.GetTenantDB(ctx, "basic"); err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	if pinned := store.PinnedTenants(); len(pinned) != 2 || pinned[0] != "premium" || pinned[1] != "vip" {
+		t.Fatalf("Expected premium and vip to be pinned, got %v", pinned)
+	}
+
+	store.evictIdle("")
+	store.mu.RLock()
+	_, vipCached := store.tenantDBs["vip"]
+	_, basicCached := store.tenantDBs["basic"]
+	store.mu.RUnlock()
+	if !vipCached || basicCached {
+		t.Fatalf("Expected only the pinned tenant to survive eviction, got vip=%v basic=%v", vipCached, basicCached)
+	}
+
+	// Pinned tenants closed elsewhere are dialed again by the keeper
+	if err := store.RemoveTenantDB("vip"); err != nil {
+		t.Fatalf("Failed to remove tenant DB: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		store.mu.RLock()
+		_, vipCached = store.tenantDBs["vip"]
+		store.mu.RUnlock()
+		if vipCached {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the keeper to reconnect the pinned tenant")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// The configured pin has no schema, which the keeper must not create
+	schemas, err := store.ListSchemas(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list schemas: %v", err)
+	}
+	for _, schema := range schemas {
+		if schema == "premium" {
+			t.Fatal("Expected the keeper not to create schemas")
+		}
+	}
+
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	for _, stat := range stats {
+		if want := stat.Schema == "vip"; stat.Pinned != want {
+			t.Fatalf("Expected %s pinned=%v, got %v", stat.Schema, want, stat.Pinned)
+		}
+	}
+
+	if _, err := store.DropTenant(ctx, "vip", DropOptions{Cascade: true}); err != nil {
+		t.Fatalf("Failed to drop tenant: %v", err)
+	}
+	if pinned := store.PinnedTenants(); len(pinned) != 1 {
+		t.Fatalf("Expected dropping to unpin the tenant, got %v", pinned)
+	}
+}
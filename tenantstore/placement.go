@@ -0,0 +1,256 @@
+package tenantstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EventTenantMoved is emitted when MoveTenant changed where a tenant lives,
+// so other instances close their connection to the old location
+const EventTenantMoved TenantEventType = "tenant.moved"
+
+// Placement records where a tenant's schema lives and how its connection is
+// pooled. It is stored with the tenant in the registry; the zero Placement
+// is the master database with the store's pool limits.
+type Placement struct {
+	// Shard names a database in Config.Shards
+	Shard string `gorm:"size:63" json:"shard,omitempty"`
+
+	// DSNRef is resolved to a DSN by Config.ResolveDSN, such as the name of
+	// a secret holding the DSN of a dedicated server. It takes precedence
+	// over Shard.
+	DSNRef string `gorm:"column:dsn_ref;size:255" json:"dsn_ref,omitempty"`
+
+	// PoolProfile names pool limits in Config.PoolProfiles used instead of
+	// the store's
+	PoolProfile string `gorm:"size:63" json:"pool_profile,omitempty"`
+}
+
+// IsZero reports whether the placement is the default one
+func (p Placement) IsZero() bool {
+	return p == Placement{}
+}
+
+// located reports whether the tenant lives outside the master database
+func (p Placement) located() bool {
+	return p.Shard != "" || p.DSNRef != ""
+}
+
+// PoolProfile holds pool limits for tenants placed with it, like the pool
+// fields of Config. Zero keeps the database/sql default.
+type PoolProfile struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// apply sets the pool limits of a tenant or master connection
+func (p PoolProfile) apply(sqlDB *sql.DB) {
+	sqlDB.SetMaxOpenConns(p.MaxOpenConns)
+	if p.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(p.MaxIdleConns)
+	} else {
+		sqlDB.SetMaxIdleConns(defaultMaxIdleConns)
+	}
+	sqlDB.SetConnMaxLifetime(p.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
+
+// MoveTenant points a registered tenant at a new placement. The schema must
+// already exist at the new location, copied there with pg_dump or logical
+// replication; MoveTenant connects to it and checks the schema before it
+// updates the registry, so a wrong DSN or a missing copy leaves the tenant
+// where it was. The cached connection is then retired after
+// Config.RotationGracePeriod, requests in flight finish on the old
+// location, and the next GetTenantDB dials the new one. Other instances
+// pick the move up when their registry cache expires, or at once with
+// Notifications.
+//
+// Stop writes to the tenant, e.g. with DeactivateTenant, between the copy
+// and the move; MoveTenant does not copy data.
+func (s *TenantStore) MoveTenant(ctx context.Context, tenantSchema string, placement Placement) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+	if s.isMasterSchema(tenantSchema) || isSnapshotSchema(tenantSchema) {
+		return fmt.Errorf("refusing to move reserved schema %s", tenantSchema)
+	}
+	if err := s.checkEnvironment("move", tenantSchema); err != nil {
+		return err
+	}
+	registry, err := s.registryDB(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Verify the new location before the registry points at it
+	if err := s.verifyPlacement(ctx, tenantSchema, placement); err != nil {
+		return fmt.Errorf("failed to move %s: %w", tenantSchema, err)
+	}
+
+	result := registry.Model(&Tenant{}).Where("schema = ?", tenantSchema).
+		Select("shard", "dsn_ref", "pool_profile").
+		Updates(&Tenant{Placement: placement})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update tenant %s: %w", tenantSchema, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrTenantNotFound
+	}
+	s.registry.delete(tenantSchema)
+
+	s.retireTenantDB(tenantSchema)
+	s.emit(ctx, EventTenantMoved, tenantSchema)
+	return nil
+}
+
+// retireTenantDB evicts the cached connection of a tenant that moved, so its
+// idle connections to the old location close at once and the pool after
+// Config.RotationGracePeriod
+func (s *TenantStore) retireTenantDB(tenantSchema string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenantDBs[tenantSchema]; !ok {
+		return
+	}
+	s.evictTenantDB(tenantSchema)
+}
+
+// TenantPlacement returns where the tenant lives, read from the cached
+// registry. Unregistered tenants and stores without a registry have the
+// zero Placement.
+func (s *TenantStore) TenantPlacement(ctx context.Context, tenantSchema string) (Placement, error) {
+	if !s.config().EnableRegistry {
+		return Placement{}, nil
+	}
+	db, err := s.registryDB(ctx)
+	if err != nil {
+		return Placement{}, err
+	}
+	return s.placement(db, tenantSchema)
+}
+
+// tenantPlacement is TenantPlacement for callers holding mu
+func (s *TenantStore) tenantPlacement(ctx context.Context, tenantSchema string) (Placement, error) {
+	if !s.config().EnableRegistry {
+		return Placement{}, nil
+	}
+	return s.placement(s.masterDB.WithContext(ctx), tenantSchema)
+}
+
+// placement reads the tenant's placement through a registry session
+func (s *TenantStore) placement(db *gorm.DB, tenantSchema string) (Placement, error) {
+	tenant, err := s.lookupTenant(db, tenantSchema)
+	if errors.Is(err, ErrTenantNotFound) {
+		return Placement{}, nil
+	}
+	if err != nil {
+		return Placement{}, err
+	}
+	return tenant.Placement, nil
+}
+
+// verifyPlacement connects to the placement and checks the tenant schema
+// exists there
+func (s *TenantStore) verifyPlacement(ctx context.Context, tenantSchema string, placement Placement) error {
+	if _, err := s.poolProfile(placement); err != nil {
+		return err
+	}
+	dial, err := s.tenantDialOptions(ctx, tenantSchema, placement)
+	if err != nil {
+		return err
+	}
+	dialector, err := tenantDialector(dial.dsn, nil)
+	if err != nil {
+		return err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: s.config().Logger})
+	if err != nil {
+		return fmt.Errorf("failed to connect to the new location: %w", err)
+	}
+	defer closeDB(db)
+
+	var exists bool
+	if err := db.WithContext(ctx).Raw("SELECT EXISTS (SELECT 1 FROM information_schema.schemata WHERE schema_name = ?)",
+		tenantSchema).Scan(&exists).Error; err != nil {
+		return fmt.Errorf("failed to look up the schema at the new location: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("%w at the new location: %s", ErrSchemaNotFound, tenantSchema)
+	}
+	return nil
+}
+
+// placementDSN returns the DSN of a tenant connection at the placement with
+// the search path. It calls Config.ResolveDSN and DSNProvider, so callers
+// must not hold mu.
+func (s *TenantStore) placementDSN(ctx context.Context, tenantSchema string, placement Placement, searchPath []string) (string, error) {
+	switch {
+	case placement.DSNRef != "":
+		if s.config().ResolveDSN == nil {
+			return "", fmt.Errorf("placement of %s refers to DSN %q but no ResolveDSN is configured", tenantSchema, placement.DSNRef)
+		}
+		dsn, err := s.config().ResolveDSN(ctx, placement.DSNRef)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve DSN %q: %w", placement.DSNRef, err)
+		}
+		return tenantDSN(dsn, searchPath), nil
+	case placement.Shard != "":
+		dsn, ok := s.config().Shards[placement.Shard]
+		if !ok {
+			return "", fmt.Errorf("unknown shard %q", placement.Shard)
+		}
+		return tenantDSN(dsn, searchPath), nil
+	case s.config().DSNProvider != nil:
+		masterDSN, err := s.config().DSNProvider(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to get tenant DSN from provider: %w", err)
+		}
+		return tenantDSN(masterDSN, searchPath), nil
+	default:
+		return s.config().GetTenantDSN(tenantSchema), nil
+	}
+}
+
+// poolProfile returns the pool profile of the placement, or nil for the
+// store's pool limits
+func (s *TenantStore) poolProfile(placement Placement) (*PoolProfile, error) {
+	if placement.PoolProfile == "" {
+		return nil, nil
+	}
+	profile, ok := s.config().PoolProfiles[placement.PoolProfile]
+	if !ok {
+		return nil, fmt.Errorf("unknown pool profile %q", placement.PoolProfile)
+	}
+	return &profile, nil
+}
+
+// connectPlacedTenantDB dials a tenant placed outside the master database.
+// Its schema is not created or migrated there, since it was copied before
+// MoveTenant. Callers hold mu.
+func (s *TenantStore) connectPlacedTenantDB(ctx context.Context, tenantSchema string, groups [][]interface{}, dial dialOptions) (*gorm.DB, error) {
+	tenantDB, err := s.openTenantDB(ctx, tenantSchema, dial)
+	if err != nil {
+		return nil, err
+	}
+	if s.config().StrictIsolation {
+		if err := s.verifyIsolation(ctx, tenantSchema, tenantDB, flatten(groups)); err != nil {
+			closeDB(tenantDB)
+			return nil, err
+		}
+	}
+
+	s.tenantDBs[tenantSchema] = tenantDB
+	s.tenantVersions[tenantSchema] = s.dsnVersion
+	s.health[tenantSchema] = new(tenantHealth)
+	s.touch(tenantSchema, time.Now())
+	s.evictLeastRecentlyUsed(tenantSchema)
+	return tenantDB, nil
+}
@@ -0,0 +1,237 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTenantPlacement(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "tenant_placement", func(config *Config) {
+		config.Shards = map[string]string{"eu": "host=eu.db dbname=app"}
+		config.PoolProfiles = map[string]PoolProfile{"dedicated": {MaxOpenConns: 50}}
+		config.ResolveDSN = func(ctx context.Context, ref string) (string, error) {
+			if ref != "secret/acme" {
+				return "", errors.New("no such secret")
+			}
+			return "host=acme.db dbname=acme", nil
+		}
+	})
+	ctx := context.Background()
+
+	if err := store.RegisterTenant(ctx, &Tenant{Schema: "acme", Active: true, Placement: Placement{Shard: "eu", PoolProfile: "dedicated"}}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	placement, err := store.TenantPlacement(ctx, "acme")
+	if err != nil || placement != (Placement{Shard: "eu", PoolProfile: "dedicated"}) {
+		t.Fatalf("Expected the registered placement, got %+v (%v)", placement, err)
+	}
+	if placement, err := store.TenantPlacement(ctx, "unknown"); err != nil || !placement.IsZero() {
+		t.Fatalf("Expected unregistered tenants on the master database, got %+v (%v)", placement, err)
+	}
+	if profile, err := store.poolProfile(placement); err != nil || profile.MaxOpenConns != 50 {
+		t.Fatalf("Expected the dedicated profile, got %+v (%v)", profile, err)
+	}
+
+	tests := []struct {
+		name      string
+		placement Placement
+		want      string
+		wantErr   string
+	}{
+		{name: "Shard", placement: Placement{Shard: "eu"}, want: "host=eu.db dbname=app search_path="},
+		{name: "DSN reference wins", placement: Placement{Shard: "eu", DSNRef: "secret/acme"}, want: "host=acme.db dbname=acme search_path="},
+		{name: "Unknown shard", placement: Placement{Shard: "us"}, wantErr: `unknown shard "us"`},
+		{name: "Unresolved reference", placement: Placement{DSNRef: "secret/other"}, wantErr: "no such secret"},
+	}
+	searchPath, err := store.SearchPath("acme")
+	if err != nil {
+		t.Fatalf("Failed to get search path: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, err := store.placementDSN(ctx, "acme", tt.placement, searchPath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil || !strings.HasPrefix(dsn, tt.want) || !strings.Contains(dsn, "acme") {
+				t.Fatalf("Expected %s..., got %s (%v)", tt.want, dsn, err)
+			}
+		})
+	}
+
+	if _, err := store.poolProfile(Placement{PoolProfile: "huge"}); err == nil {
+		t.Fatalf("Expected an unknown pool profile to fail")
+	}
+}
+
+func TestGetTenantDBUnknownShard(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "unknown_shard")
+	ctx := context.Background()
+	store.tenantVersions = make(map[string]uint64)
+
+	if err := store.RegisterTenant(ctx, &Tenant{Schema: "acme", Active: true, Placement: Placement{Shard: "missing"}}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	store.registry.delete("acme")
+
+	// The placement is resolved before the store is locked for the new connection
+	done := make(chan error, 1)
+	go func() {
+		_, err := store.GetTenantDB(ctx, "acme")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), `unknown shard "missing"`) {
+			t.Fatalf("Expected the unknown shard, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected GetTenantDB to return, it deadlocked")
+	}
+}
+
+func TestGetTenantDBResolvesDSNBeforeLocking(t *testing.T) {
+	var store *TenantStore
+	store = newSQLiteRegistryStore(t, "resolve_dsn_unlocked", func(config *Config) {
+		config.ResolveDSN = func(ctx context.Context, ref string) (string, error) {
+			// Callbacks may use the store
+			store.GetMasterDB()
+			return "host=127.0.0.1 port=1 user=app dbname=app sslmode=disable connect_timeout=1", nil
+		}
+	})
+	ctx := context.Background()
+	store.tenantVersions = make(map[string]uint64)
+
+	if err := store.RegisterTenant(ctx, &Tenant{Schema: "acme", Active: true, Placement: Placement{DSNRef: "secret/acme"}}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := store.GetTenantDB(ctx, "acme")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "failed to connect to tenant database") {
+			t.Fatalf("Expected the unreachable database, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected GetTenantDB to return, it deadlocked")
+	}
+}
+
+func TestRetireTenantDB(t *testing.T) {
+	store := newSQLiteTenantStore(t, "retire_tenant_db")
+	store.touch("acme", time.Now())
+
+	store.retireTenantDB("acme")
+	if _, ok := store.tenantDBs["acme"]; ok {
+		t.Fatal("Expected the connection to be dropped")
+	}
+	if used := store.lastUsedAt("acme"); used != 0 {
+		t.Fatalf("Expected the last use to be forgotten, got %d", used)
+	}
+}
+
+func TestMoveTenantUnreachable(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "move_unreachable", func(config *Config) {
+		config.Shards = map[string]string{"down": "host=127.0.0.1 port=1 user=app dbname=app sslmode=disable connect_timeout=1"}
+	})
+	ctx := context.Background()
+
+	if err := store.RegisterTenant(ctx, &Tenant{Schema: "acme", Active: true}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if err := store.MoveTenant(ctx, "acme", Placement{Shard: "down"}); err == nil {
+		t.Fatalf("Expected the move to an unreachable database to fail")
+	}
+	if err := store.MoveTenant(ctx, "acme", Placement{PoolProfile: "missing"}); err == nil || !strings.Contains(err.Error(), "unknown pool profile") {
+		t.Fatalf("Expected an unknown pool profile to fail, got %v", err)
+	}
+	if placement, err := store.TenantPlacement(ctx, "acme"); err != nil || !placement.IsZero() {
+		t.Fatalf("Expected the tenant to stay in place, got %+v (%v)", placement, err)
+	}
+}
+
+func TestMoveTenant(t *testing.T) {
+	t.Parallel()
+
+	dsn, dedicatedDSN, emptyDSN := getTestDSN(t), getTestDSN(t), getTestDSN(t)
+	ctx := context.Background()
+
+	config := DefaultConfig(dsn)
+	config.Models = []interface{}{&TestModel{}}
+	config.EnableRegistry = true
+	config.Shards = map[string]string{"dedicated": dedicatedDSN, "empty": emptyDSN}
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.RegisterTenant(ctx, &Tenant{Schema: "move_acme", Active: true}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	db, err := store.GetTenantDB(ctx, "move_acme")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	db.Create(&TestModel{Name: "master"})
+
+	// The copy on the dedicated database, as pg_dump would leave it
+	dedicatedConfig := DefaultConfig(dedicatedDSN)
+	dedicatedConfig.Models = []interface{}{&TestModel{}}
+	dedicated, err := New(dedicatedConfig)
+	if err != nil {
+		t.Fatalf("Failed to create dedicated store: %v", err)
+	}
+	defer dedicated.Close()
+	copyDB, err := dedicated.GetTenantDB(ctx, "move_acme")
+	if err != nil {
+		t.Fatalf("Failed to create the copy: %v", err)
+	}
+	copyDB.Create(&TestModel{Name: "dedicated"})
+
+	name := func() string {
+		t.Helper()
+		db, err := store.GetTenantDB(ctx, "move_acme")
+		if err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+		var model TestModel
+		if err := db.First(&model).Error; err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		return model.Name
+	}
+
+	// A database without the schema is refused and nothing changes
+	if err := store.MoveTenant(ctx, "move_acme", Placement{Shard: "empty"}); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("Expected ErrSchemaNotFound, got %v", err)
+	}
+	if got := name(); got != "master" {
+		t.Fatalf("Expected the tenant to stay on the master database, got %s", got)
+	}
+
+	if err := store.MoveTenant(ctx, "move_acme", Placement{Shard: "dedicated"}); err != nil {
+		t.Fatalf("Failed to move: %v", err)
+	}
+	if got := name(); got != "dedicated" {
+		t.Fatalf("Expected requests to hit the dedicated database, got %s", got)
+	}
+
+	// Moving back returns to the master database
+	if err := store.MoveTenant(ctx, "move_acme", Placement{}); err != nil {
+		t.Fatalf("Failed to move back: %v", err)
+	}
+	if got := name(); got != "master" {
+		t.Fatalf("Expected requests to hit the master database again, got %s", got)
+	}
+}
@@ -0,0 +1,134 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Plan lists the actions of a destructive or migrating operation: the ones
+// executed, or in a dry run the ones that would be
+type Plan struct {
+	Operation string     `json:"operation"`
+	DryRun    bool       `json:"dry_run"`
+	Steps     []PlanStep `json:"steps"`
+}
+
+// PlanStep is one action of a plan. SQL is empty for actions that are not a
+// single statement, such as tables removed by a cascading drop.
+type PlanStep struct {
+	Schema string `json:"schema"`
+	Action string `json:"action"`
+	SQL    string `json:"sql,omitempty"`
+}
+
+func (p *Plan) add(schema, action, sql string) {
+	p.Steps = append(p.Steps, PlanStep{Schema: schema, Action: action, SQL: sql})
+}
+
+// sort orders steps by schema, keeping each schema's steps in order
+func (p *Plan) sort() {
+	sort.SliceStable(p.Steps, func(i, j int) bool {
+		return p.Steps[i].Schema < p.Steps[j].Schema
+	})
+}
+
+// PlanMigration returns what MigrateTenant would change in an existing
+// schema: missing tables and columns of the tenant's models, search indexes and
+// views. It only reads the catalog through the master connection and never
+// opens a tenant connection.
+func (s *TenantStore) PlanMigration(ctx context.Context, tenantSchema string) (*Plan, error) {
+	if _, err := s.schemaTables(ctx, tenantSchema); err != nil {
+		return nil, err
+	}
+
+	layouts, err := s.schemaLayouts(ctx, []string{tenantSchema})
+	if err != nil {
+		return nil, err
+	}
+	layout := layouts[tenantSchema]
+
+	plan := &Plan{Operation: "migrate", DryRun: true, Steps: []PlanStep{}}
+
+	models, err := s.tenantModels(ctx, tenantSchema)
+	if err != nil {
+		return nil, err
+	}
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: s.master()}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+
+		table := stmt.Schema.Table
+		columns, exists := layout[table]
+		if !exists {
+			plan.add(tenantSchema, "create table "+table, "")
+			continue
+		}
+
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			if _, ok := columns[field.DBName]; !ok {
+				plan.add(tenantSchema, "add column "+table+"."+field.DBName, "")
+			}
+		}
+	}
+
+	for _, def := range s.config().SearchIndexes {
+		statements, err := searchIndexSQL(def, tenantSchema)
+		if err != nil {
+			return nil, err
+		}
+		for _, statement := range statements {
+			plan.add(tenantSchema, "ensure search index "+def.IndexName, statement)
+		}
+	}
+
+	for _, def := range s.config().CrossSchemaFKs {
+		def = def.withDefaults()
+		plan.add(tenantSchema, "ensure foreign key "+def.Name, addForeignKeySQL(def, tenantSchema))
+	}
+
+	for _, view := range s.config().TenantViews {
+		query, err := renderViewSQL(view, tenantSchema)
+		if err != nil {
+			return nil, err
+		}
+		plan.add(tenantSchema, "recreate view "+view.Name,
+			fmt.Sprintf("CREATE VIEW %s.%s AS %s", quoteIdentifier(tenantSchema), view.Name, query))
+	}
+
+	return plan, nil
+}
+
+// ErrSchemaNotFound is returned by operations on existing schemas, such as
+// DropTenant and RowCounts, when the schema does not exist
+var ErrSchemaNotFound = errors.New("schema does not exist")
+
+// schemaTables returns the base tables of an existing schema, sorted by name
+func (s *TenantStore) schemaTables(ctx context.Context, tenantSchema string) ([]string, error) {
+	db := s.master().WithContext(ctx)
+
+	var exists bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM information_schema.schemata WHERE schema_name = ?)", tenantSchema).Scan(&exists).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up schema %s: %w", tenantSchema, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, tenantSchema)
+	}
+
+	var tables []string
+	if err := db.Raw(`
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = ? AND table_type = 'BASE TABLE'
+		ORDER BY table_name`, tenantSchema).Scan(&tables).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tables for %s: %w", tenantSchema, err)
+	}
+	return tables, nil
+}
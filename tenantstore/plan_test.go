@@ -0,0 +1,106 @@
+package tenantstore
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type plannedModel struct {
+	ID    uint
+	Title string
+}
+
+// catalogSnapshot lists every table and column of the non-system schemas
+func catalogSnapshot(t *testing.T, store *TenantStore) []string {
+	t.Helper()
+
+	var rows []string
+	err := store.GetMasterDB().Raw(`
+		SELECT table_schema || '.' || table_name || '.' || column_name
+		FROM information_schema.columns
+		WHERE table_schema NOT IN ('information_schema', 'pg_catalog')
+		ORDER BY 1`).Scan(&rows).Error
+	if err != nil {
+		t.Fatalf("Failed to read catalog: %v", err)
+	}
+
+	var schemas []string
+	store.GetMasterDB().Raw("SELECT schema_name FROM information_schema.schemata ORDER BY 1").Scan(&schemas)
+	return append(rows, schemas...)
+}
+
+func TestDryRunHasNoSideEffects(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&TestModel{}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if _, err := store.GetTenantDB(ctx, "tenant_a"); err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	store.GetMasterDB().Exec("INSERT INTO tenant_a.test_models (name) VALUES ('kept')")
+
+	// A model added since the tenant was created
+	reconfigure(store, func(config *Config) {
+		config.Models = []interface{}{&TestModel{}, &plannedModel{}}
+	})
+
+	before := catalogSnapshot(t, store)
+
+	dropPlan, err := store.DropTenant(ctx, "tenant_a", DropOptions{Cascade: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to plan drop: %v", err)
+	}
+	last := dropPlan.Steps[len(dropPlan.Steps)-1]
+	if !dropPlan.DryRun || last.SQL != "DROP SCHEMA tenant_a CASCADE" {
+		t.Fatalf("Unexpected drop plan: %+v", dropPlan)
+	}
+
+	truncatePlan, err := store.TruncateTenant(ctx, "tenant_a", TruncateOptions{RestartIdentity: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to plan truncate: %v", err)
+	}
+	if len(truncatePlan.Steps) != 1 || !strings.Contains(truncatePlan.Steps[0].SQL, `"tenant_a"."test_models"`) {
+		t.Fatalf("Unexpected truncate plan: %+v", truncatePlan)
+	}
+
+	report, err := store.MigrateAll(ctx, MigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to plan migration: %v", err)
+	}
+	if len(report.Migrated) != 0 || report.Plan == nil {
+		t.Fatalf("Expected a plan and no migrated tenants, got %+v", report)
+	}
+	want := []PlanStep{{Schema: "tenant_a", Action: "create table planned_models"}}
+	if !reflect.DeepEqual(report.Plan.Steps, want) {
+		t.Fatalf("Expected %+v, got %+v", want, report.Plan.Steps)
+	}
+
+	if after := catalogSnapshot(t, store); !reflect.DeepEqual(before, after) {
+		t.Fatalf("Expected dry runs to leave the catalog unchanged:\nbefore %v\nafter  %v", before, after)
+	}
+
+	var count int64
+	store.GetMasterDB().Raw("SELECT COUNT(*) FROM tenant_a.test_models").Scan(&count)
+	if count != 1 {
+		t.Fatalf("Expected the row to survive dry runs, got %d rows", count)
+	}
+
+	// Without DryRun the truncate runs
+	if _, err := store.TruncateTenant(ctx, "tenant_a", TruncateOptions{}); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	store.GetMasterDB().Raw("SELECT COUNT(*) FROM tenant_a.test_models").Scan(&count)
+	if count != 0 {
+		t.Fatalf("Expected truncate to delete all rows, got %d", count)
+	}
+}
@@ -0,0 +1,373 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// TenantMode is how a tenant's data is stored, recorded in the registry
+type TenantMode string
+
+// Tenant modes. Tenants without a mode keep their own schema.
+const (
+	ModeSchema TenantMode = ""
+	ModePooled TenantMode = "pooled"
+)
+
+// EventTenantConverted is emitted when ConvertToPooled moved a tenant into
+// the shared tables, so other instances close their schema connection
+const EventTenantConverted TenantEventType = "tenant.converted"
+
+// DefaultPooledTenantColumn is the column of shared tables holding the tenant
+const DefaultPooledTenantColumn = "tenant_id"
+
+// pooledTenantKey is the GORM setting holding the tenant of a pooled session
+const pooledTenantKey = "tenantstore:pooled_tenant"
+
+// ConvertOptions controls ConvertToPooled
+type ConvertOptions struct {
+	// Tables maps tenant tables to the shared tables their rows are copied
+	// to. Tables not listed keep their name.
+	Tables map[string]string
+
+	// Skip lists tenant tables that are not copied
+	Skip []string
+
+	// BatchSize is the number of rows inserted at once (default 500)
+	BatchSize int
+
+	// DropSchema drops the tenant schema once its rows are copied and the
+	// tenant is routed to the shared tables
+	DropSchema bool
+}
+
+// ConvertToPooled moves a schema-per-tenant tenant into the shared tables of
+// target, the pooled database, stamping every row with the tenant in
+// Config.PooledTenantColumn. Row counts are verified per table, the copy
+// runs in one transaction on target and rows of the tenant already in the
+// shared tables are replaced, so a failed conversion can be run again. The
+// tenant must be registered; its registry mode is set to ModePooled, after
+// which GetTenantDB returns a session of target scoped to the tenant.
+//
+// The tenant's tables are locked against writes while they are copied.
+// Writes waiting for the lock land in the schema after the conversion and
+// are not copied, so deactivate the tenant first to convert it safely.
+// A nil target uses Config.PooledDB.
+func (s *TenantStore) ConvertToPooled(ctx context.Context, tenantSchema string, target *gorm.DB, opts ConvertOptions) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+	if s.isMasterSchema(tenantSchema) || isSnapshotSchema(tenantSchema) {
+		return fmt.Errorf("refusing to convert reserved schema %s", tenantSchema)
+	}
+	if err := s.checkEnvironment("convert", tenantSchema); err != nil {
+		return err
+	}
+	if target == nil {
+		if target = s.pooledDB.Load(); target == nil {
+			return fmt.Errorf("no pooled database to convert %s to", tenantSchema)
+		}
+	}
+	registry, err := s.registryDB(ctx)
+	if err != nil {
+		return err
+	}
+	if err := registerPooledScope(target, s.pooledTenantColumn()); err != nil {
+		return err
+	}
+
+	tables, err := s.schemaTables(ctx, tenantSchema)
+	if err != nil {
+		return err
+	}
+	skip := make(map[string]bool, len(opts.Skip))
+	for _, table := range opts.Skip {
+		skip[table] = true
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	err = registry.Transaction(func(source *gorm.DB) error {
+		// Keep the rows from changing between the copy and the switch
+		var copied []string
+		for _, table := range tables {
+			if !skip[table] {
+				copied = append(copied, quoteIdentifier(tenantSchema)+"."+quoteIdentifier(table))
+			}
+		}
+		if len(copied) > 0 {
+			if err := source.Exec("LOCK TABLE " + strings.Join(copied, ", ") + " IN SHARE MODE").Error; err != nil {
+				return fmt.Errorf("failed to lock tables of %s: %w", tenantSchema, err)
+			}
+		}
+
+		err := target.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for _, table := range tables {
+				if skip[table] {
+					continue
+				}
+				shared := table
+				if name, ok := opts.Tables[table]; ok {
+					shared = name
+				}
+				if err := s.copyToPooled(source, tx, tenantSchema, table, shared, batchSize); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		result := source.Model(&Tenant{}).Where("schema = ?", tenantSchema).Update("mode", ModePooled)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update tenant %s: %w", tenantSchema, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrTenantNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to convert %s to pooled mode: %w", tenantSchema, err)
+	}
+
+	s.pooledDB.CompareAndSwap(nil, target)
+	s.registry.delete(tenantSchema)
+	s.UnpinTenant(tenantSchema)
+	if err := s.RemoveTenantDB(tenantSchema); err != nil {
+		return err
+	}
+	s.emit(ctx, EventTenantConverted, tenantSchema)
+
+	if opts.DropSchema {
+		if _, err := s.DropTenant(ctx, tenantSchema, DropOptions{Cascade: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyToPooled replaces the tenant's rows in a shared table with the rows
+// of its own table and checks that the counts match
+func (s *TenantStore) copyToPooled(source, tx *gorm.DB, tenantSchema, table, shared string, batchSize int) error {
+	column := s.pooledTenantColumn()
+	qualified := quoteIdentifier(tenantSchema) + "." + quoteIdentifier(table)
+
+	if err := tx.Exec("DELETE FROM "+quoteIdentifier(shared)+" WHERE "+quoteIdentifier(column)+" = ?", tenantSchema).Error; err != nil {
+		return fmt.Errorf("failed to clear %s for %s: %w", shared, tenantSchema, err)
+	}
+
+	rows, err := source.Raw("SELECT * FROM " + qualified).Rows()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", qualified, err)
+	}
+	defer rows.Close()
+
+	var want int64
+	batch := make([]map[string]interface{}, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := tx.Table(shared).Create(&batch).Error; err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", qualified, shared, err)
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := source.ScanRows(rows, &row); err != nil {
+			return fmt.Errorf("failed to read %s: %w", qualified, err)
+		}
+		row[column] = tenantSchema
+		batch = append(batch, row)
+		want++
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", qualified, err)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	var got int64
+	if err := tx.Table(shared).Where(quoteIdentifier(column)+" = ?", tenantSchema).Count(&got).Error; err != nil {
+		return fmt.Errorf("failed to count %s: %w", shared, err)
+	}
+	if got != want {
+		return fmt.Errorf("copied %d of %d rows from %s to %s", got, want, qualified, shared)
+	}
+
+	if tx.Dialector.Name() == "postgres" {
+		return advanceTableSequences(tx, shared)
+	}
+	return nil
+}
+
+// advanceTableSequences moves the sequences of a table's serial columns
+// past the copied values, never backwards
+func advanceTableSequences(tx *gorm.DB, table string) error {
+	var columns []string
+	if err := tx.Raw(`SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ? AND column_default LIKE 'nextval(%'`,
+		table).Scan(&columns).Error; err != nil {
+		return fmt.Errorf("failed to look up sequences of %s: %w", table, err)
+	}
+
+	for _, column := range columns {
+		err := tx.Exec(`SELECT setval(seq.name, m.max_id)
+			FROM (SELECT pg_get_serial_sequence(?, ?) AS name) seq,
+				(SELECT MAX(`+quoteIdentifier(column)+`) AS max_id FROM `+quoteIdentifier(table)+`) m,
+				pg_sequences ps
+			WHERE seq.name IS NOT NULL AND m.max_id IS NOT NULL
+				AND format('%I.%I', ps.schemaname, ps.sequencename) = seq.name
+				AND m.max_id > COALESCE(ps.last_value, ps.start_value - 1)`,
+			quoteIdentifier(table), column).Error
+		if err != nil {
+			return fmt.Errorf("failed to advance sequence of %s.%s: %w", table, column, err)
+		}
+	}
+	return nil
+}
+
+// pooledTenantDB returns the pooled session of a converted tenant, or nil
+// for tenants with a schema of their own
+func (s *TenantStore) pooledTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	target := s.pooledDB.Load()
+	if target == nil || !s.config().EnableRegistry {
+		return nil, nil
+	}
+
+	tenant, err := s.LookupTenant(ctx, tenantSchema)
+	if errors.Is(err, ErrTenantNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tenant.Mode != ModePooled {
+		return nil, nil
+	}
+	return PooledSession(target, tenantSchema), nil
+}
+
+// pooledTenantColumn returns the tenant column of shared tables
+func (s *TenantStore) pooledTenantColumn() string {
+	if column := s.config().PooledTenantColumn; column != "" {
+		return column
+	}
+	return DefaultPooledTenantColumn
+}
+
+// PooledSession returns a session of db scoped to the tenant, as GetTenantDB
+// returns for pooled tenants. Queries, updates and deletes on models with
+// the tenant column only see the tenant's rows, and creates stamp it. Raw
+// SQL and tables used without a model are not scoped. db must be the
+// store's Config.PooledDB or a database converted to with ConvertToPooled.
+func PooledSession(db *gorm.DB, tenant string) *gorm.DB {
+	return WithSchema(db.Set(pooledTenantKey, tenant), tenant)
+}
+
+// registerPooledScope adds the callbacks scoping pooled sessions to db,
+// once per database
+func registerPooledScope(db *gorm.DB, column string) error {
+	callbacks := db.Callback()
+	if callbacks.Query().Get("tenantstore:pooled_scope") != nil {
+		return nil
+	}
+
+	scope := func(db *gorm.DB) {
+		tenant, field := pooledTenant(db, column)
+		if field == nil {
+			return
+		}
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenant},
+		}})
+	}
+	// Writes without conditions fail like they do on tenant schemas instead
+	// of changing every row of the tenant
+	scopeWrite := func(db *gorm.DB) {
+		if _, field := pooledTenant(db, column); field != nil && missingWhere(db) {
+			db.AddError(gorm.ErrMissingWhereClause)
+			return
+		}
+		scope(db)
+	}
+	stamp := func(db *gorm.DB) {
+		tenant, field := pooledTenant(db, column)
+		if field == nil {
+			return
+		}
+		value := db.Statement.ReflectValue
+		switch value.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < value.Len(); i++ {
+				if err := field.Set(db.Statement.Context, reflect.Indirect(value.Index(i)), tenant); err != nil {
+					db.AddError(err)
+				}
+			}
+		case reflect.Struct:
+			if err := field.Set(db.Statement.Context, value, tenant); err != nil {
+				db.AddError(err)
+			}
+		}
+	}
+
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register("tenantstore:pooled_scope", stamp),
+		callbacks.Query().Before("gorm:query").Register("tenantstore:pooled_scope", scope),
+		callbacks.Row().Before("gorm:row").Register("tenantstore:pooled_scope", scope),
+		callbacks.Update().Before("gorm:update").Register("tenantstore:pooled_scope", scopeWrite),
+		callbacks.Delete().Before("gorm:delete").Register("tenantstore:pooled_scope", scopeWrite),
+	} {
+		if err != nil {
+			return fmt.Errorf("failed to register pooled scope: %w", err)
+		}
+	}
+	return nil
+}
+
+// pooledTenant returns the tenant of a pooled session and the tenant field
+// of the statement's model, or a nil field when the statement is not scoped
+func pooledTenant(db *gorm.DB, column string) (string, *schema.Field) {
+	value, ok := db.Get(pooledTenantKey)
+	if !ok || db.Statement.Schema == nil {
+		return "", nil
+	}
+	tenant, _ := value.(string)
+	return tenant, db.Statement.Schema.LookUpField(column)
+}
+
+// missingWhere reports whether an update or delete has neither conditions
+// nor primary keys GORM turns into conditions
+func missingWhere(db *gorm.DB) bool {
+	if db.AllowGlobalUpdate {
+		return false
+	}
+	if _, ok := db.Statement.Clauses["WHERE"]; ok {
+		return false
+	}
+	if db.Statement.ReflectValue.IsValid() && len(db.Statement.Schema.PrimaryFields) > 0 {
+		_, values := schema.GetIdentityFieldValuesMap(db.Statement.Context, db.Statement.ReflectValue, db.Statement.Schema.PrimaryFields)
+		return len(values) == 0
+	}
+	return true
+}
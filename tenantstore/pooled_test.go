@@ -0,0 +1,198 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// PooledItem is a model stored per schema or in a shared table
+type PooledItem struct {
+	ID       uint   `gorm:"primaryKey"`
+	TenantID string `gorm:"size:63;index"`
+	Name     string
+}
+
+// newPooledDB returns an in-memory SQLite database with the shared
+// pooled_items table and the pooled scope registered
+func newPooledDB(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { closeDB(db) })
+	if err := db.AutoMigrate(&PooledItem{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if err := registerPooledScope(db, DefaultPooledTenantColumn); err != nil {
+		t.Fatalf("Failed to register scope: %v", err)
+	}
+	return db
+}
+
+func TestPooledSession(t *testing.T) {
+	db := newPooledDB(t, "pooled_session")
+	acme, globex := PooledSession(db, "acme"), PooledSession(db, "globex")
+
+	// Creates are stamped with the session's tenant, whatever the row says
+	if err := acme.Create(&[]PooledItem{{Name: "a1"}, {Name: "a2", TenantID: "globex"}}).Error; err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	other := PooledItem{Name: "g1"}
+	if err := globex.Create(&other).Error; err != nil || other.TenantID != "globex" {
+		t.Fatalf("Expected the row stamped with globex, got %q (%v)", other.TenantID, err)
+	}
+
+	var items []PooledItem
+	if err := acme.Order("id").Find(&items).Error; err != nil || len(items) != 2 {
+		t.Fatalf("Expected acme's 2 rows, got %+v (%v)", items, err)
+	}
+	var count int64
+	if err := globex.Model(&PooledItem{}).Count(&count).Error; err != nil || count != 1 {
+		t.Fatalf("Expected globex's 1 row, got %d (%v)", count, err)
+	}
+	if name, ok := SchemaFromDB(acme); !ok || name != "acme" {
+		t.Fatalf("Expected the session tagged with acme, got %q", name)
+	}
+
+	// Another tenant's row cannot be read, changed or deleted by its key
+	if err := acme.First(&PooledItem{}, other.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("Expected globex's row to be invisible to acme, got %v", err)
+	}
+	if result := acme.Model(&other).Update("name", "taken"); result.Error != nil || result.RowsAffected != 0 {
+		t.Fatalf("Expected no rows updated, got %d (%v)", result.RowsAffected, result.Error)
+	}
+	if result := acme.Delete(&other); result.Error != nil || result.RowsAffected != 0 {
+		t.Fatalf("Expected no rows deleted, got %d (%v)", result.RowsAffected, result.Error)
+	}
+	if result := acme.Model(&items[0]).Update("name", "renamed"); result.Error != nil || result.RowsAffected != 1 {
+		t.Fatalf("Expected acme's own row updated, got %d (%v)", result.RowsAffected, result.Error)
+	}
+
+	// Unconditional writes fail as on a tenant schema
+	if err := acme.Model(&PooledItem{}).Update("name", "all").Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Fatalf("Expected ErrMissingWhereClause, got %v", err)
+	}
+	if err := acme.Delete(&PooledItem{}).Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Fatalf("Expected ErrMissingWhereClause, got %v", err)
+	}
+
+	// Sessions without a tenant see every row
+	if err := db.Model(&PooledItem{}).Count(&count).Error; err != nil || count != 3 {
+		t.Fatalf("Expected 3 rows unscoped, got %d (%v)", count, err)
+	}
+}
+
+func TestGetTenantDBRoutesPooledTenants(t *testing.T) {
+	store := newSQLiteTenantStore(t, "pooled_routing")
+	pooled := newPooledDB(t, "pooled_routing_shared")
+	store.pooledDB.Store(pooled)
+	ctx := context.Background()
+
+	for _, tenant := range []*Tenant{{Schema: "acme", Active: true}, {Schema: "globex", Active: true}} {
+		if err := store.RegisterTenant(ctx, tenant); err != nil {
+			t.Fatalf("Failed to register %s: %v", tenant.Schema, err)
+		}
+	}
+	store.GetMasterDB().Model(&Tenant{}).Where("schema = ?", "globex").Update("mode", ModePooled)
+	store.InvalidateTenant("globex")
+	PooledSession(pooled, "globex").Create(&PooledItem{Name: "g1"})
+	PooledSession(pooled, "other").Create(&PooledItem{Name: "o1"})
+
+	db, err := store.GetTenantDB(ctx, "globex")
+	if err != nil {
+		t.Fatalf("Failed to get pooled tenant DB: %v", err)
+	}
+	var items []PooledItem
+	if err := db.Find(&items).Error; err != nil || len(items) != 1 || items[0].Name != "g1" {
+		t.Fatalf("Expected globex's shared row, got %+v (%v)", items, err)
+	}
+
+	// Schema tenants keep their own connection
+	db, err = store.GetTenantDB(ctx, "acme")
+	if err != nil || db != store.tenantDBs["acme"] {
+		t.Fatalf("Expected acme's schema connection, got %v", err)
+	}
+}
+
+func TestConvertToPooled(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	ctx := context.Background()
+
+	config := DefaultConfig(dsn)
+	config.Models = []interface{}{&PooledItem{}}
+	config.EnableRegistry = true
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	// The shared table lives in public of the master database
+	target := store.GetMasterDB()
+	if err := target.AutoMigrate(&PooledItem{}); err != nil {
+		t.Fatalf("Failed to create the shared table: %v", err)
+	}
+
+	for _, schema := range []string{"pool_small", "pool_big"} {
+		defer store.DropTenant(ctx, schema, DropOptions{Cascade: true})
+		if err := store.RegisterTenant(ctx, &Tenant{Schema: schema, Active: true}); err != nil {
+			t.Fatalf("Failed to register %s: %v", schema, err)
+		}
+		db, err := store.GetTenantDB(ctx, schema)
+		if err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+		db.Create(&[]PooledItem{{Name: schema + "-1"}, {Name: schema + "-2"}})
+	}
+
+	if err := store.ConvertToPooled(ctx, "pool_small", target, ConvertOptions{Tables: map[string]string{"pooled_items": "pooled_items"}}); err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+	if tenant, err := store.LookupTenant(ctx, "pool_small"); err != nil || tenant.Mode != ModePooled {
+		t.Fatalf("Expected pool_small recorded as pooled, got %+v (%v)", tenant, err)
+	}
+
+	check := func(schema string, want ...string) *gorm.DB {
+		t.Helper()
+		db, err := store.GetTenantDB(ctx, schema)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", schema, err)
+		}
+		var items []PooledItem
+		if err := db.Order("id").Find(&items).Error; err != nil || len(items) != len(want) {
+			t.Fatalf("Expected %d rows for %s, got %+v (%v)", len(want), schema, items, err)
+		}
+		for i, name := range want {
+			if items[i].Name != name {
+				t.Fatalf("Expected %s for %s, got %s", name, schema, items[i].Name)
+			}
+		}
+		return db
+	}
+	small := check("pool_small", "pool_small-1", "pool_small-2")
+	check("pool_big", "pool_big-1", "pool_big-2")
+
+	// New rows of the converted tenant go to the shared table, after the copied IDs
+	if err := small.Create(&PooledItem{Name: "pool_small-3"}).Error; err != nil {
+		t.Fatalf("Failed to create in the shared table: %v", err)
+	}
+	check("pool_small", "pool_small-1", "pool_small-2", "pool_small-3")
+	check("pool_big", "pool_big-1", "pool_big-2")
+
+	// Converting again replaces the copied rows instead of duplicating them
+	if err := store.ConvertToPooled(ctx, "pool_small", target, ConvertOptions{DropSchema: true}); err != nil {
+		t.Fatalf("Failed to convert again: %v", err)
+	}
+	check("pool_small", "pool_small-1", "pool_small-2")
+	if _, err := store.schemaTables(ctx, "pool_small"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("Expected the schema to be dropped, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package tenantstore
+
+// PrepareStmtMode controls GORM's prepared statement cache on a connection
+type PrepareStmtMode int
+
+const (
+	// PrepareStmtInherit uses the enclosing setting: Config.PrepareStmt for
+	// tenant connections and GORM's default (off) for Config.PrepareStmt
+	PrepareStmtInherit PrepareStmtMode = iota
+
+	// PrepareStmtOn caches prepared statements
+	PrepareStmtOn
+
+	// PrepareStmtOff runs every query unprepared
+	PrepareStmtOff
+)
+
+// enabled resolves the mode against the inherited setting
+func (m PrepareStmtMode) enabled(inherited bool) bool {
+	switch m {
+	case PrepareStmtOn:
+		return true
+	case PrepareStmtOff:
+		return false
+	default:
+		return inherited
+	}
+}
+
+// tenantPrepareStmt resolves the prepared statement setting for a tenant
+// connection
+func (s *TenantStore) tenantPrepareStmt(tenantSchema string) bool {
+	inherited := s.config().PrepareStmt.enabled(false)
+	if s.config().TenantPrepareStmt == nil {
+		return inherited
+	}
+	return s.config().TenantPrepareStmt(tenantSchema).enabled(inherited)
+}
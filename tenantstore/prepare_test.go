@@ -0,0 +1,118 @@
+package tenantstore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+)
+
+type sharedPoolItem struct {
+	ID   uint
+	Name string
+}
+
+// sharedPool serves every tenant from the master pool
+type sharedPool struct {
+	*TenantStore
+}
+
+func (s sharedPool) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	return s.master(), nil
+}
+
+func TestSharedPoolPrepareStmtIsolation(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&sharedPoolItem{}}
+	config.PrepareStmt = PrepareStmtOn
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for _, tenant := range []string{"tenant_a", "tenant_b"} {
+		db, err := store.GetTenantDB(ctx, tenant)
+		if err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+		db.Create(&sharedPoolItem{Name: tenant + "-item"})
+	}
+
+	app := fiber.New()
+	app.Use(middleware.New(middleware.Config{
+		Store:                 sharedPool{store},
+		Resolver:              middleware.HeaderResolver("X-Tenant-ID"),
+		TransactionalRequests: true,
+	}))
+	app.Get("/items", func(c *fiber.Ctx) error {
+		var names []string
+		if err := middleware.GetTenantDB(c).Model(&sharedPoolItem{}).Pluck("name", &names).Error; err != nil {
+			return err
+		}
+		return c.JSON(names)
+	})
+
+	// Alternate tenants so the same query runs on pooled connections that
+	// served the other tenant before
+	for _, tenant := range []string{"tenant_a", "tenant_b", "tenant_a", "tenant_b"} {
+		req := httptest.NewRequest("GET", "/items", nil)
+		req.Header.Set("X-Tenant-ID", tenant)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+
+		var names []string
+		if err := json.NewDecoder(resp.Body).Decode(&names); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(names) != 1 || names[0] != tenant+"-item" {
+			t.Fatalf("Expected only %s's row, got %v", tenant, names)
+		}
+	}
+
+	for query := range store.GetMasterDB().ConnPool.(*gorm.PreparedStmtDB).Stmts {
+		if strings.Contains(query, "shared_pool_items") && !strings.HasPrefix(query, "/* tenant ") {
+			t.Fatalf("Expected tenant queries to be keyed by tenant, got %q", query)
+		}
+	}
+}
+
+func TestPrepareStmtMode(t *testing.T) {
+	store := withConfig(&TenantStore{}, &Config{})
+	if store.tenantPrepareStmt("acme") {
+		t.Fatal("Expected prepared statements to be off by default")
+	}
+
+	store = withConfig(&TenantStore{}, &Config{PrepareStmt: PrepareStmtOn})
+	if !store.tenantPrepareStmt("acme") {
+		t.Fatal("Expected tenant connections to inherit PrepareStmtOn")
+	}
+
+	store = withConfig(&TenantStore{}, &Config{
+		PrepareStmt: PrepareStmtOn,
+		TenantPrepareStmt: func(tenantSchema string) PrepareStmtMode {
+			if tenantSchema == "acme" {
+				return PrepareStmtOff
+			}
+			return PrepareStmtInherit
+		},
+	})
+	if store.tenantPrepareStmt("acme") {
+		t.Fatal("Expected the per-tenant override to disable prepared statements")
+	}
+	if !store.tenantPrepareStmt("globex") {
+		t.Fatal("Expected PrepareStmtInherit to fall back to Config.PrepareStmt")
+	}
+}
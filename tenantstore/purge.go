@@ -0,0 +1,177 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultPurgeBatchSize is the number of rows PurgeSoftDeleted deletes per
+// statement when Config.PurgeBatchSize is not set
+const DefaultPurgeBatchSize = 1000
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// PurgeReport lists the rows purged per tenant and table
+type PurgeReport struct {
+	// Purged maps each tenant schema to the rows deleted per table
+	Purged map[string]map[string]int64 `json:"purged"`
+	Failed TenantErrors                `json:"-"`
+}
+
+// Err returns the per-tenant failures, or nil if every tenant was purged
+func (r *PurgeReport) Err() error {
+	if len(r.Failed) > 0 {
+		return r.Failed
+	}
+	return nil
+}
+
+// Total returns the number of rows purged across tenants and tables
+func (r *PurgeReport) Total() int64 {
+	var total int64
+	for _, tables := range r.Purged {
+		for _, rows := range tables {
+			total += rows
+		}
+	}
+	return total
+}
+
+// PurgeSoftDeleted hard-deletes rows of the tenant schema that were
+// soft-deleted with gorm.DeletedAt more than olderThan ago. Without models
+// every model in Config.Models and ModelGroups with a DeletedAt field is
+// purged. Rows are deleted in batches of Config.PurgeBatchSize with
+// Config.PurgeBatchPause between them, so large backlogs do not hold locks
+// for long; a failure keeps the batches already deleted.
+func (s *TenantStore) PurgeSoftDeleted(ctx context.Context, tenantSchema string, olderThan time.Duration, models ...interface{}) (PurgeReport, error) {
+	report := PurgeReport{Purged: map[string]map[string]int64{}}
+
+	tables, err := s.purgeTables(models)
+	if err != nil {
+		return report, err
+	}
+
+	db, err := s.tenantDB(ctx, tenantSchema)
+	if err != nil {
+		return report, err
+	}
+
+	purged, err := s.purgeTenant(ctx, db, tables, time.Now().Add(-olderThan))
+	report.Purged[tenantSchema] = purged
+	return report, err
+}
+
+// PurgeSoftDeletedAllTenants runs PurgeSoftDeleted for every schema with
+// ForEachTenant. Failed tenants are listed in the report, with the rows
+// purged before the failure; an error is only returned when the models are
+// invalid or the schemas cannot be listed.
+func (s *TenantStore) PurgeSoftDeletedAllTenants(ctx context.Context, olderThan time.Duration, opts ForEachOptions, models ...interface{}) (PurgeReport, error) {
+	report := PurgeReport{Purged: map[string]map[string]int64{}, Failed: TenantErrors{}}
+
+	tables, err := s.purgeTables(models)
+	if err != nil {
+		return report, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var mu sync.Mutex
+
+	err = s.ForEachTenant(ctx, func(ctx context.Context, tenantSchema string, db *gorm.DB) error {
+		purged, err := s.purgeTenant(ctx, db, tables, cutoff)
+
+		mu.Lock()
+		report.Purged[tenantSchema] = purged
+		mu.Unlock()
+		return err
+	}, opts)
+
+	if failures, ok := err.(TenantErrors); ok {
+		report.Failed = failures
+		return report, nil
+	}
+	return report, err
+}
+
+// purgeTable is a table with a soft delete column
+type purgeTable struct {
+	table     string
+	deletedAt string
+}
+
+// purgeTables finds the soft delete column of each model
+func (s *TenantStore) purgeTables(models []interface{}) ([]purgeTable, error) {
+	explicit := len(models) > 0
+	if !explicit {
+		models = s.models()
+	}
+
+	var tables []purgeTable
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: s.master()}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+
+		var deletedAt string
+		for _, field := range stmt.Schema.Fields {
+			if field.FieldType == deletedAtType && field.DBName != "" {
+				deletedAt = field.DBName
+				break
+			}
+		}
+		if deletedAt == "" {
+			if explicit {
+				return nil, fmt.Errorf("model %T has no gorm.DeletedAt field", model)
+			}
+			continue
+		}
+
+		tables = append(tables, purgeTable{table: stmt.Schema.Table, deletedAt: deletedAt})
+	}
+
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no soft-deleted models to purge")
+	}
+	return tables, nil
+}
+
+// purgeTenant deletes expired rows table by table, in batches
+func (s *TenantStore) purgeTenant(ctx context.Context, db *gorm.DB, tables []purgeTable, cutoff time.Time) (map[string]int64, error) {
+	batchSize := s.config().PurgeBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultPurgeBatchSize
+	}
+
+	purged := make(map[string]int64, len(tables))
+	for _, t := range tables {
+		table, column := quoteIdentifier(t.table), quoteIdentifier(t.deletedAt)
+		deleteSQL := fmt.Sprintf(
+			"DELETE FROM %s WHERE ctid IN (SELECT ctid FROM %s WHERE %s < ? LIMIT %d)",
+			table, table, column, batchSize)
+
+		for {
+			result := db.WithContext(ctx).Exec(deleteSQL, cutoff)
+			if result.Error != nil {
+				return purged, fmt.Errorf("failed to purge %s: %w", t.table, result.Error)
+			}
+			purged[t.table] += result.RowsAffected
+			if result.RowsAffected < int64(batchSize) {
+				break
+			}
+
+			if s.config().PurgeBatchPause > 0 {
+				select {
+				case <-ctx.Done():
+					return purged, ctx.Err()
+				case <-time.After(s.config().PurgeBatchPause):
+				}
+			}
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,104 @@
+package tenantstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type PurgeItem struct {
+	ID        uint `gorm:"primaryKey"`
+	Name      string
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func TestPurgeTables(t *testing.T) {
+	masterDB, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	store := withConfig(&TenantStore{
+		masterDB: masterDB,
+	}, &Config{Models: []interface{}{&GroupNote{}, &PurgeItem{}}})
+
+	// Models without DeletedAt are skipped unless given explicitly
+	tables, err := store.purgeTables(nil)
+	if err != nil || len(tables) != 1 || tables[0] != (purgeTable{table: "purge_items", deletedAt: "deleted_at"}) {
+		t.Fatalf("Expected purge_items only, got %v (%v)", tables, err)
+	}
+	if _, err := store.purgeTables([]interface{}{&GroupNote{}}); err == nil || !strings.Contains(err.Error(), "no gorm.DeletedAt") {
+		t.Fatalf("Expected an error for a model without DeletedAt, got %v", err)
+	}
+}
+
+func TestPurgeSoftDeleted(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&PurgeItem{}}
+	config.PurgeBatchSize = 2
+	config.PurgeBatchPause = time.Millisecond
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	// Each tenant gets rows deleted long ago, recently and not at all
+	expired := map[string]int{"purge_a": 5, "purge_b": 1}
+	for tenant, count := range expired {
+		db, err := store.GetTenantDB(ctx, tenant)
+		if err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+
+		var items []PurgeItem
+		for i := 0; i < count; i++ {
+			items = append(items, PurgeItem{Name: "expired", DeletedAt: gorm.DeletedAt{Time: now.Add(-48 * time.Hour), Valid: true}})
+		}
+		items = append(items,
+			PurgeItem{Name: "recent", DeletedAt: gorm.DeletedAt{Time: now.Add(-time.Hour), Valid: true}},
+			PurgeItem{Name: "live"},
+		)
+		if err := db.Create(&items).Error; err != nil {
+			t.Fatalf("Failed to create items: %v", err)
+		}
+	}
+
+	report, err := store.PurgeSoftDeletedAllTenants(ctx, 24*time.Hour, ForEachOptions{Concurrency: 2})
+	if err != nil || report.Err() != nil {
+		t.Fatalf("Failed to purge: %v %v", err, report.Err())
+	}
+	for tenant, count := range expired {
+		if got := report.Purged[tenant]["purge_items"]; got != int64(count) {
+			t.Fatalf("Expected %d rows purged from %s, got %d", count, tenant, got)
+		}
+
+		db, _ := store.GetTenantDB(ctx, tenant)
+		var names []string
+		db.Unscoped().Model(&PurgeItem{}).Order("name").Pluck("name", &names)
+		if strings.Join(names, ",") != "live,recent" {
+			t.Fatalf("Expected live and recent rows to remain in %s, got %v", tenant, names)
+		}
+	}
+	if report.Total() != 6 {
+		t.Fatalf("Expected 6 rows purged in total, got %d", report.Total())
+	}
+
+	// A shorter cutoff reaches the recent rows of one tenant
+	report, err = store.PurgeSoftDeleted(ctx, "purge_a", 0, &PurgeItem{})
+	if err != nil {
+		t.Fatalf("Failed to purge: %v", err)
+	}
+	if got := report.Purged["purge_a"]["purge_items"]; got != 1 {
+		t.Fatalf("Expected the recent row to be purged, got %d", got)
+	}
+}
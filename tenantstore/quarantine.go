@@ -0,0 +1,137 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrMasterSchema is returned instead of serving public, PostgreSQL's own
+// schemas or Config.MasterSchemaNames as a tenant. The middleware responds
+// with 404, as for an unknown tenant.
+var ErrMasterSchema error = &statusError{"schema holds shared data and cannot be served as a tenant", http.StatusNotFound, 0}
+
+// EventSchemaQuarantined is emitted with the old schema when QuarantineTenant
+// moves a tenant out of it
+const EventSchemaQuarantined TenantEventType = "schema.quarantined"
+
+// isMasterSchema reports whether the schema may never be served as a tenant
+func (s *TenantStore) isMasterSchema(tenantSchema string) bool {
+	if isReservedSchema(tenantSchema) {
+		return true
+	}
+	for _, name := range s.config().MasterSchemaNames {
+		if strings.EqualFold(name, tenantSchema) {
+			return true
+		}
+	}
+	return false
+}
+
+// QuarantineTenant moves a tenant whose schema conflicts with shared data,
+// such as a tenant that signed up as "public" or one of
+// Config.MasterSchemaNames, into newSchema, and aliases the old name to it
+// so the tenant ID keeps working. From a master schema only the tables of
+// Config.Models and ModelGroups are moved, and the tenant's TenantViews in it
+// are dropped; any other schema is renamed as a whole. The registry record
+// follows, newSchema is then migrated, and other instances evict the old
+// connection. Aliases last until Close: add the mapping to
+// Config.SchemaAliases to keep it across restarts and replicas.
+func (s *TenantStore) QuarantineTenant(ctx context.Context, tenantSchema, newSchema string) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+	if err := validateSchemaName(newSchema); err != nil {
+		return err
+	}
+	if s.isMasterSchema(newSchema) {
+		return fmt.Errorf("%w: %s", ErrMasterSchema, newSchema)
+	}
+
+	tables, err := s.schemaTables(ctx, tenantSchema)
+	if err != nil {
+		return err
+	}
+	if _, err := s.schemaTables(ctx, newSchema); err == nil {
+		return fmt.Errorf("schema %s already exists", newSchema)
+	} else if !errors.Is(err, ErrSchemaNotFound) {
+		return err
+	}
+
+	from := quoteIdentifier(tenantSchema)
+	to := quoteIdentifier(newSchema)
+	var statements []string
+	if s.isMasterSchema(tenantSchema) {
+		present := make(map[string]bool, len(tables))
+		for _, table := range tables {
+			present[table] = true
+		}
+
+		for _, view := range s.config().TenantViews {
+			statements = append(statements, fmt.Sprintf("DROP VIEW IF EXISTS %s.%s", from, quoteIdentifier(view.Name)))
+		}
+		statements = append(statements, "CREATE SCHEMA "+to)
+		for _, model := range s.models() {
+			stmt := &gorm.Statement{DB: s.master()}
+			if err := stmt.Parse(model); err != nil {
+				return fmt.Errorf("failed to parse model %T: %w", model, err)
+			}
+			if present[stmt.Schema.Table] {
+				// Owned sequences, indexes and constraints move along
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s.%s SET SCHEMA %s", from, quoteIdentifier(stmt.Schema.Table), to))
+				delete(present, stmt.Schema.Table)
+			}
+		}
+	} else {
+		statements = append(statements, fmt.Sprintf("ALTER SCHEMA %s RENAME TO %s", from, to))
+	}
+
+	if err := s.RemoveTenantDB(tenantSchema); err != nil {
+		return err
+	}
+
+	err = s.master().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		if s.config().EnableRegistry {
+			return tx.Unscoped().Model(&Tenant{}).Where("schema = ?", tenantSchema).Update("schema", newSchema).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to quarantine %s into %s: %w", tenantSchema, newSchema, err)
+	}
+
+	s.setAlias(tenantSchema, newSchema)
+	s.registry.delete(tenantSchema)
+	s.UnpinTenant(tenantSchema)
+	s.emit(ctx, EventSchemaQuarantined, tenantSchema)
+
+	// Recreate views and anything else missing in the new schema
+	if err := s.MigrateTenant(context.WithValue(ctx, skipProvisionGuardsKey{}, true), newSchema); err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", newSchema, err)
+	}
+	return nil
+}
+
+// setAlias serves the tenant ID from tenantSchema
+func (s *TenantStore) setAlias(tenantID, tenantSchema string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	aliases := make(map[string]string)
+	if current := s.aliases.Load(); current != nil {
+		for id, schema := range *current {
+			aliases[id] = schema
+		}
+	}
+	aliases[tenantID] = tenantSchema
+	s.aliases.Store(&aliases)
+}
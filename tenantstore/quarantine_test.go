@@ -0,0 +1,109 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestGetTenantDBRefusesMasterSchemas(t *testing.T) {
+	config := DefaultConfig("")
+	config.MasterSchemaNames = []string{"master"}
+	store := withConfig(&TenantStore{}, config)
+
+	for _, tenantID := range []string{"public", "PUBLIC", "pg_catalog", "information_schema", "master", "Master"} {
+		_, err := store.GetTenantDB(context.Background(), tenantID)
+		if !errors.Is(err, ErrMasterSchema) {
+			t.Fatalf("Expected ErrMasterSchema for %s, got %v", tenantID, err)
+		}
+	}
+
+	var status interface{ HTTPStatus() int }
+	if !errors.As(ErrMasterSchema, &status) || status.HTTPStatus() != http.StatusNotFound {
+		t.Fatal("Expected ErrMasterSchema to map to 404")
+	}
+}
+
+func TestSchemaAliases(t *testing.T) {
+	config := DefaultConfig("")
+	config.SchemaAliases = map[string]string{"public": "tenant_public"}
+	store := withConfig(&TenantStore{}, config)
+	store.aliases.Store(&config.SchemaAliases)
+
+	if schema, err := store.SchemaName("public"); err != nil || schema != "tenant_public" {
+		t.Fatalf("Expected public to map to tenant_public, got %s (%v)", schema, err)
+	}
+	if schema, _ := store.SchemaName("acme"); schema != "acme" {
+		t.Fatalf("Expected acme unchanged, got %s", schema)
+	}
+
+	store.setAlias("master", "tenant_master")
+	if schema, _ := store.SchemaName("master"); schema != "tenant_master" {
+		t.Fatalf("Expected master to map to tenant_master, got %s", schema)
+	}
+	if schema, _ := store.SchemaName("public"); schema != "tenant_public" {
+		t.Fatalf("Expected earlier aliases to survive, got %s", schema)
+	}
+}
+
+func TestQuarantineTenant(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	ctx := context.Background()
+
+	// A tenant signed up as qt_master before the schema was reserved
+	before := DefaultConfig(dsn)
+	before.Models = []interface{}{&TestModel{}}
+	legacy, err := New(before)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	db, err := legacy.GetTenantDB(ctx, "qt_master")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	db.Create(&TestModel{Name: "tenant row"})
+	legacy.GetMasterDB().Exec("CREATE TABLE qt_master.qt_metadata (key text)")
+	legacy.Close()
+
+	config := DefaultConfig(dsn)
+	config.Models = []interface{}{&TestModel{}}
+	config.MasterSchemaNames = []string{"qt_master"}
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	defer store.GetMasterDB().Exec("DROP SCHEMA IF EXISTS qt_master CASCADE")
+	defer store.DropTenant(ctx, "qt_tenant_master", DropOptions{Cascade: true})
+
+	if _, err := store.GetTenantDB(ctx, "qt_master"); !errors.Is(err, ErrMasterSchema) {
+		t.Fatalf("Expected ErrMasterSchema, got %v", err)
+	}
+
+	if err := store.QuarantineTenant(ctx, "qt_master", "qt_tenant_master"); err != nil {
+		t.Fatalf("Failed to quarantine: %v", err)
+	}
+
+	// The tenant ID now resolves to the moved data
+	db, err = store.GetTenantDB(ctx, "qt_master")
+	if err != nil {
+		t.Fatalf("Failed to get quarantined tenant DB: %v", err)
+	}
+	var rows []TestModel
+	if err := db.Find(&rows).Error; err != nil || len(rows) != 1 || rows[0].Name != "tenant row" {
+		t.Fatalf("Expected the tenant row in the new schema, got %+v (%v)", rows, err)
+	}
+
+	// Shared tables stay behind
+	tables, err := store.schemaTables(ctx, "qt_master")
+	if err != nil || len(tables) != 1 || tables[0] != "qt_metadata" {
+		t.Fatalf("Expected only qt_metadata left in qt_master, got %v (%v)", tables, err)
+	}
+
+	if err := store.QuarantineTenant(ctx, "qt_master", "public"); !errors.Is(err, ErrMasterSchema) {
+		t.Fatalf("Expected quarantine into public to be refused, got %v", err)
+	}
+}
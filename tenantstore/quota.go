@@ -0,0 +1,106 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// ErrTenantQuotaExceeded is returned instead of creating a schema once
+// Config.MaxTenants schemas exist. The middleware responds with 503.
+var ErrTenantQuotaExceeded error = &statusError{"tenant quota exceeded", http.StatusServiceUnavailable, 0}
+
+// ErrProvisionRateLimited is returned instead of creating a schema faster
+// than Config.ProvisionRateLimit allows. The middleware responds with 429.
+var ErrProvisionRateLimited error = &statusError{"tenant provisioning rate limited", http.StatusTooManyRequests, 0}
+
+// statusError is an error with the HTTP status it should be reported as
+type statusError struct {
+	message    string
+	status     int
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// HTTPStatus returns the status the middleware responds with
+func (e *statusError) HTTPStatus() int {
+	return e.status
+}
+
+// RetryAfter returns how long clients should wait before retrying, or zero
+func (e *statusError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+type skipProvisionGuardsKey struct{}
+
+// AdoptTenant creates and migrates the tenant's schema like MigrateTenant but
+// without the MaxTenants and ProvisionRateLimit guards, for operators
+// importing or restoring tenants
+func (s *TenantStore) AdoptTenant(ctx context.Context, tenantID string) error {
+	tenantSchema, err := s.SchemaName(tenantID)
+	if err != nil {
+		return err
+	}
+	return s.MigrateTenant(context.WithValue(ctx, skipProvisionGuardsKey{}, true), tenantSchema)
+}
+
+// newProvisionLimiter returns the limiter for Config.ProvisionRateLimit, or
+// nil when creation is not rate limited
+func newProvisionLimiter(config *Config) *rate.Limiter {
+	if config.ProvisionRateLimit <= 0 || config.ProvisionRateLimit == rate.Inf {
+		return nil
+	}
+
+	burst := config.ProvisionBurst
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(config.ProvisionRateLimit, burst)
+}
+
+// checkProvision enforces MaxTenants and ProvisionRateLimit before a schema
+// is created, querying through master: s.masterDB for callers holding mu,
+// s.master() otherwise. Existing schemas always pass.
+func (s *TenantStore) checkProvision(ctx context.Context, master *gorm.DB, tenantSchema string) error {
+	maxTenants, limiter := s.config().MaxTenants, s.provisionLimiter.Load()
+	if maxTenants <= 0 && limiter == nil {
+		return nil
+	}
+	if skip, _ := ctx.Value(skipProvisionGuardsKey{}).(bool); skip {
+		return nil
+	}
+
+	db := master.WithContext(ctx)
+
+	var exists bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM information_schema.schemata WHERE schema_name = ?)",
+		tenantSchema).Scan(&exists).Error; err != nil {
+		return fmt.Errorf("failed to look up schema %s: %w", tenantSchema, err)
+	}
+	if exists {
+		return nil
+	}
+
+	if maxTenants > 0 {
+		schemas, err := s.listSchemas(db)
+		if err != nil {
+			return err
+		}
+		if len(schemas) >= maxTenants {
+			return fmt.Errorf("%w: %d of %d tenants exist", ErrTenantQuotaExceeded, len(schemas), maxTenants)
+		}
+	}
+
+	if limiter != nil && !limiter.Allow() {
+		return ErrProvisionRateLimited
+	}
+	return nil
+}
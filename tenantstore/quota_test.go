@@ -0,0 +1,114 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestMaxTenants(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.MaxTenants = 2
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for _, tenant := range []string{"tenant_a", "tenant_b"} {
+		if _, err := store.GetTenantDB(ctx, tenant); err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+	}
+
+	if _, err := store.GetTenantDB(ctx, "tenant_c"); !errors.Is(err, ErrTenantQuotaExceeded) {
+		t.Fatalf("Expected ErrTenantQuotaExceeded, got %v", err)
+	}
+
+	// Existing schemas keep working after their connection is dropped
+	store.RemoveTenantDB("tenant_a")
+	if _, err := store.GetTenantDB(ctx, "tenant_a"); err != nil {
+		t.Fatalf("Expected existing tenant to reconnect, got %v", err)
+	}
+
+	if err := store.AdoptTenant(ctx, "tenant_c"); err != nil {
+		t.Fatalf("Expected AdoptTenant to bypass the quota, got %v", err)
+	}
+}
+
+func TestProvisionRateLimit(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.ProvisionRateLimit = rate.Every(time.Hour)
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if _, err := store.GetTenantDB(ctx, "tenant_a"); err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	if _, err := store.GetTenantDB(ctx, "tenant_b"); !errors.Is(err, ErrProvisionRateLimited) {
+		t.Fatalf("Expected ErrProvisionRateLimited, got %v", err)
+	}
+
+	if err := store.AdoptTenant(ctx, "tenant_b"); err != nil {
+		t.Fatalf("Expected AdoptTenant to bypass the rate limit, got %v", err)
+	}
+}
+
+func TestProvisionLimiterDisabledByDefault(t *testing.T) {
+	if newProvisionLimiter(&Config{}) != nil {
+		t.Fatal("Expected no limiter without ProvisionRateLimit")
+	}
+	if newProvisionLimiter(&Config{ProvisionRateLimit: rate.Inf}) != nil {
+		t.Fatal("Expected no limiter for rate.Inf")
+	}
+
+	limiter := newProvisionLimiter(&Config{ProvisionRateLimit: rate.Every(time.Hour), ProvisionBurst: 3})
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow() {
+			t.Fatalf("Expected burst of 3, denied at %d", i)
+		}
+	}
+	if limiter.Allow() {
+		t.Fatal("Expected the fourth creation to be limited")
+	}
+}
+
+func TestMaxTenantsWhileConnecting(t *testing.T) {
+	store := newSQLiteTenantStore(t, "quota_connecting")
+	maxTenants := 2
+	if err := store.UpdateConfig(ConfigPatch{MaxTenants: &maxTenants}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	attachInformationSchema(t, store, "acme", "globex")
+
+	// The quota is checked while the store is locked for the new connection
+	done := make(chan error, 1)
+	go func() {
+		_, err := store.GetTenantDB(context.Background(), "initech")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrTenantQuotaExceeded) {
+			t.Fatalf("Expected ErrTenantQuotaExceeded, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected GetTenantDB to return, it deadlocked")
+	}
+}
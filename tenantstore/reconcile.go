@@ -0,0 +1,152 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+)
+
+// MissingSchemaAction decides what Reconcile does with registered tenants
+// that have no schema
+type MissingSchemaAction int
+
+const (
+	// MissingSchemaReport only lists the tenant
+	MissingSchemaReport MissingSchemaAction = iota
+
+	// MissingSchemaCreate creates and migrates the schema with MigrateTenant
+	MissingSchemaCreate
+
+	// MissingSchemaUnregister soft-deletes the registry record
+	MissingSchemaUnregister
+)
+
+// OrphanSchemaAction decides what Reconcile does with schemas that have no
+// registry record
+type OrphanSchemaAction int
+
+const (
+	// OrphanSchemaReport only lists the schema
+	OrphanSchemaReport OrphanSchemaAction = iota
+
+	// OrphanSchemaRegister adds an active registry record named after the schema
+	OrphanSchemaRegister
+
+	// OrphanSchemaDrop drops the schema and all its data with DropTenant
+	OrphanSchemaDrop
+)
+
+// ReconcilePolicy chooses the action for each direction. The zero value only
+// reports.
+type ReconcilePolicy struct {
+	MissingSchemas MissingSchemaAction
+	OrphanSchemas  OrphanSchemaAction
+}
+
+// ReconcileReport lists the differences Reconcile found and what it changed
+type ReconcileReport struct {
+	// MissingSchemas are registered tenants without a schema
+	MissingSchemas []string `json:"missing_schemas"`
+
+	// OrphanSchemas are schemas without a registry record
+	OrphanSchemas []string `json:"orphan_schemas"`
+
+	Created      []string     `json:"created,omitempty"`
+	Unregistered []string     `json:"unregistered,omitempty"`
+	Registered   []string     `json:"registered,omitempty"`
+	Dropped      []string     `json:"dropped,omitempty"`
+	Failed       TenantErrors `json:"-"`
+}
+
+// Err returns the per-tenant failures, or nil if every action succeeded
+func (r *ReconcileReport) Err() error {
+	if len(r.Failed) > 0 {
+		return r.Failed
+	}
+	return nil
+}
+
+// Reconcile compares the tenant registry against the schemas returned by
+// ListSchemas and applies the policy to the differences. Nothing is dropped
+// unless the policy says OrphanSchemaDrop, and running it again once the two
+// agree changes nothing, so it is safe to call on every deploy. Changes emit
+// tenant events; an error is only returned when either side cannot be listed.
+func (s *TenantStore) Reconcile(ctx context.Context, policy ReconcilePolicy) (*ReconcileReport, error) {
+	tenants, err := s.ListTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas, err := s.ListSchemas(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	registered := make(map[string]bool, len(tenants))
+	for _, tenant := range tenants {
+		registered[tenant.Schema] = true
+	}
+	existing := make(map[string]bool, len(schemas))
+	for _, schema := range schemas {
+		existing[schema] = true
+	}
+
+	// Soft-deleted tenants keep their schema until it is dropped on purpose
+	var deleted []Tenant
+	if err := s.master().WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL").Find(&deleted).Error; err != nil {
+		return nil, fmt.Errorf("failed to list deleted tenants: %w", err)
+	}
+	for _, tenant := range deleted {
+		registered[tenant.Schema] = true
+	}
+
+	report := &ReconcileReport{Failed: TenantErrors{}}
+
+	for _, tenant := range tenants {
+		// The registry is shared by every environment of the database
+		if existing[tenant.Schema] || !s.inEnvironment(tenant.Schema) {
+			continue
+		}
+		report.MissingSchemas = append(report.MissingSchemas, tenant.Schema)
+
+		switch policy.MissingSchemas {
+		case MissingSchemaCreate:
+			if err := s.MigrateTenant(ctx, tenant.Schema); err != nil {
+				report.Failed[tenant.Schema] = err
+				continue
+			}
+			report.Created = append(report.Created, tenant.Schema)
+			s.emit(ctx, EventSchemaCreated, tenant.Schema)
+		case MissingSchemaUnregister:
+			if err := s.SoftDeleteTenant(ctx, tenant.Schema); err != nil {
+				report.Failed[tenant.Schema] = err
+				continue
+			}
+			report.Unregistered = append(report.Unregistered, tenant.Schema)
+		}
+	}
+
+	for _, schema := range schemas {
+		if registered[schema] {
+			continue
+		}
+		report.OrphanSchemas = append(report.OrphanSchemas, schema)
+
+		switch policy.OrphanSchemas {
+		case OrphanSchemaRegister:
+			if err := s.RegisterTenant(ctx, &Tenant{Schema: schema, Name: schema, Active: true}); err != nil {
+				report.Failed[schema] = err
+				continue
+			}
+			report.Registered = append(report.Registered, schema)
+		case OrphanSchemaDrop:
+			if _, err := s.DropTenant(ctx, schema, DropOptions{Cascade: true}); err != nil {
+				report.Failed[schema] = err
+				continue
+			}
+			report.Dropped = append(report.Dropped, schema)
+		}
+	}
+
+	return report, nil
+}
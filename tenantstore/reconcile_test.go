@@ -0,0 +1,98 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		events []TenantEvent
+	)
+
+	config := DefaultConfig(getTestDSN(t))
+	config.EnableRegistry = true
+	config.OnTenantEvent = func(ctx context.Context, event TenantEvent) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	// A registered tenant without a schema and a schema without a record
+	if err := store.RegisterTenant(ctx, &Tenant{Schema: "registered_only", Active: true}); err != nil {
+		t.Fatalf("Failed to register tenant: %v", err)
+	}
+	store.GetMasterDB().Exec("CREATE SCHEMA orphan")
+	events = nil
+
+	report, err := store.Reconcile(ctx, ReconcilePolicy{})
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	if !reflect.DeepEqual(report.MissingSchemas, []string{"registered_only"}) {
+		t.Fatalf("Expected missing schema registered_only, got %v", report.MissingSchemas)
+	}
+	if !reflect.DeepEqual(report.OrphanSchemas, []string{"orphan"}) {
+		t.Fatalf("Expected orphan schema, got %v", report.OrphanSchemas)
+	}
+	if len(report.Created)+len(report.Registered) != 0 || len(events) != 0 {
+		t.Fatalf("Expected report-only policy to change nothing, got %+v and events %v", report, events)
+	}
+
+	policy := ReconcilePolicy{MissingSchemas: MissingSchemaCreate, OrphanSchemas: OrphanSchemaRegister}
+	report, err = store.Reconcile(ctx, policy)
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatalf("Expected no failures, got %v", err)
+	}
+	if !reflect.DeepEqual(report.Created, []string{"registered_only"}) || !reflect.DeepEqual(report.Registered, []string{"orphan"}) {
+		t.Fatalf("Expected schema created and orphan registered, got %+v", report)
+	}
+
+	types := map[TenantEventType]string{}
+	for _, event := range events {
+		types[event.Type] = event.Schema
+	}
+	if types[EventSchemaCreated] != "registered_only" || types[EventTenantRegistered] != "orphan" {
+		t.Fatalf("Expected created and registered events, got %v", events)
+	}
+
+	// A second run finds nothing to do
+	report, err = store.Reconcile(ctx, policy)
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	if len(report.MissingSchemas) != 0 || len(report.OrphanSchemas) != 0 {
+		t.Fatalf("Expected registry and schemas to agree, got %+v", report)
+	}
+}
+
+func TestReconcileRequiresRegistry(t *testing.T) {
+	t.Parallel()
+
+	store, err := New(DefaultConfig(getTestDSN(t)))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Reconcile(context.Background(), ReconcilePolicy{}); !errors.Is(err, ErrRegistryDisabled) {
+		t.Fatalf("Expected ErrRegistryDisabled, got %v", err)
+	}
+}
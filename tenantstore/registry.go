@@ -0,0 +1,348 @@
+package tenantstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantcache"
+)
+
+// ErrRegistryDisabled is returned by registry methods when
+// Config.EnableRegistry is false
+var ErrRegistryDisabled = errors.New("tenant registry is not enabled")
+
+// ErrTenantNotFound is returned when a tenant has no registry record or its
+// record is soft-deleted
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// Tenant is a tenant's record in the registry, stored in the master database
+type Tenant struct {
+	Schema     string         `gorm:"primaryKey;size:63" json:"schema"`
+	Name       string         `json:"name"`
+	Plan       string         `json:"plan"`
+	APIVersion string         `gorm:"size:32" json:"api_version,omitempty"`
+	Active     bool           `gorm:"not null;default:true" json:"active"`
+	Settings   TenantSettings `gorm:"type:jsonb;serializer:json" json:"settings,omitempty"`
+	Domains    []string       `gorm:"type:jsonb;serializer:json" json:"domains,omitempty"`
+	Mode       TenantMode     `gorm:"size:16" json:"mode,omitempty"`
+	Placement  `gorm:"embedded"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+// TenantSettings are free-form per-tenant settings, such as a time zone
+type TenantSettings map[string]string
+
+// TableName places the registry next to the application's own master tables
+func (Tenant) TableName() string {
+	return "mt_tenants"
+}
+
+// registryCache keeps registry lookups, including misses, for a TTL in
+// Config.Cache or, by default, in memory. Misses are stored as null.
+type registryCache struct {
+	cache tenantcache.Cache
+	ttl   time.Duration
+}
+
+func newRegistryCache(cache tenantcache.Cache, ttl time.Duration) *registryCache {
+	if cache == nil {
+		cache = tenantcache.NewMemory()
+	} else {
+		cache = tenantcache.Namespace(cache, "mt:registry")
+	}
+	return &registryCache{cache: cache, ttl: ttl}
+}
+
+// get returns a cached lookup. Cache failures are misses, so lookups fall
+// back to the database.
+func (c *registryCache) get(schema string) (*Tenant, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+
+	value, ok, err := c.cache.Get(context.Background(), schema)
+	if err != nil || !ok {
+		return nil, false
+	}
+	var tenant *Tenant
+	if err := json.Unmarshal(value, &tenant); err != nil {
+		return nil, false
+	}
+	return tenant, true
+}
+
+func (c *registryCache) set(schema string, tenant *Tenant) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	value, err := json.Marshal(tenant)
+	if err != nil {
+		return
+	}
+	c.cache.Set(context.Background(), schema, value, c.ttl)
+}
+
+// delete invalidates a lookup, in a shared cache for every replica at once
+func (c *registryCache) delete(schema string) {
+	c.cache.Delete(context.Background(), schema)
+}
+
+// clear drops every lookup of the in-memory cache. Shared caches are left
+// alone: writers delete their keys, so they do not miss invalidations.
+func (c *registryCache) clear() {
+	if clearer, ok := c.cache.(tenantcache.Clearer); ok {
+		clearer.Clear(context.Background())
+	}
+}
+
+// registryDB returns a master session for registry queries
+func (s *TenantStore) registryDB(ctx context.Context) (*gorm.DB, error) {
+	if !s.config().EnableRegistry {
+		return nil, ErrRegistryDisabled
+	}
+	return s.master().WithContext(ctx), nil
+}
+
+// RegisterTenant adds a tenant to the registry. It does not create the schema.
+func (s *TenantStore) RegisterTenant(ctx context.Context, tenant *Tenant) error {
+	db, err := s.registryDB(ctx)
+	if err != nil {
+		return err
+	}
+	if tenant.Schema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+
+	if err := db.Create(tenant).Error; err != nil {
+		return fmt.Errorf("failed to register tenant %s: %w", tenant.Schema, err)
+	}
+
+	// Active defaults to true in the database, but an explicit false from
+	// the caller is dropped by GORM as a zero value
+	if !tenant.Active {
+		if err := db.Model(&Tenant{}).Where("schema = ?", tenant.Schema).Update("active", false).Error; err != nil {
+			return fmt.Errorf("failed to register tenant %s: %w", tenant.Schema, err)
+		}
+	}
+
+	s.updateSchemaComment(ctx, db, tenant)
+	s.registry.delete(tenant.Schema)
+	s.emit(ctx, EventTenantRegistered, tenant.Schema)
+	return nil
+}
+
+// LookupTenant returns the tenant's registry record, served from a cache for
+// Config.RegistryCacheTTL. Missing and soft-deleted tenants return
+// ErrTenantNotFound.
+func (s *TenantStore) LookupTenant(ctx context.Context, tenantSchema string) (*Tenant, error) {
+	db, err := s.registryDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.lookupTenant(db, tenantSchema)
+}
+
+// lookupTenant is LookupTenant on a registry session. Callers holding mu
+// pass masterDB, since master would lock it again.
+func (s *TenantStore) lookupTenant(db *gorm.DB, tenantSchema string) (*Tenant, error) {
+	if cached, ok := s.registry.get(tenantSchema); ok {
+		if cached == nil {
+			return nil, ErrTenantNotFound
+		}
+		tenant := *cached
+		return &tenant, nil
+	}
+
+	var tenant Tenant
+	err := db.Where("schema = ?", tenantSchema).Take(&tenant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.registry.set(tenantSchema, nil)
+		return nil, ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up tenant %s: %w", tenantSchema, err)
+	}
+
+	cached := tenant
+	s.registry.set(tenantSchema, &cached)
+	return &tenant, nil
+}
+
+// ListTenants returns every registered tenant that is not soft-deleted
+func (s *TenantStore) ListTenants(ctx context.Context) ([]Tenant, error) {
+	db, err := s.registryDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenants []Tenant
+	if err := db.Order("schema").Find(&tenants).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	return tenants, nil
+}
+
+// IsTenantActive reports whether the tenant may serve requests: it must be
+// registered, active and not soft-deleted. Lookups are cached.
+func (s *TenantStore) IsTenantActive(ctx context.Context, tenantSchema string) (bool, error) {
+	tenant, err := s.LookupTenant(ctx, tenantSchema)
+	if errors.Is(err, ErrTenantNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return tenant.Active, nil
+}
+
+// TenantExists reports whether the tenant is registered and not
+// soft-deleted, active or not. Lookups are cached.
+func (s *TenantStore) TenantExists(ctx context.Context, tenantSchema string) (bool, error) {
+	_, err := s.LookupTenant(ctx, tenantSchema)
+	if errors.Is(err, ErrTenantNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// TenantSettings returns the tenant's registry settings, or nil for unknown
+// tenants. Lookups are cached.
+func (s *TenantStore) TenantSettings(ctx context.Context, tenantSchema string) (map[string]string, error) {
+	tenant, err := s.LookupTenant(ctx, tenantSchema)
+	if errors.Is(err, ErrTenantNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tenant.Settings, nil
+}
+
+// TenantAPIVersion returns the API version the tenant is pinned to, or ""
+// for unknown tenants and tenants without one. Lookups are cached.
+func (s *TenantStore) TenantAPIVersion(ctx context.Context, tenantSchema string) (string, error) {
+	tenant, err := s.LookupTenant(ctx, tenantSchema)
+	if errors.Is(err, ErrTenantNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return tenant.APIVersion, nil
+}
+
+// SetTenantAPIVersion pins the tenant to an API version. Other processes
+// see it once their cached record expires.
+func (s *TenantStore) SetTenantAPIVersion(ctx context.Context, tenantSchema, version string) error {
+	db, err := s.registryDB(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := db.Model(&Tenant{}).Where("schema = ?", tenantSchema).Update("api_version", version)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update tenant %s: %w", tenantSchema, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrTenantNotFound
+	}
+
+	s.registry.delete(tenantSchema)
+	return nil
+}
+
+// DeactivateTenant marks the tenant inactive. Its schema and data are kept.
+func (s *TenantStore) DeactivateTenant(ctx context.Context, tenantSchema string) error {
+	if err := s.setTenantActive(ctx, tenantSchema, false); err != nil {
+		return err
+	}
+	s.emit(ctx, EventTenantDeactivated, tenantSchema)
+	return nil
+}
+
+// ActivateTenant marks the tenant active again
+func (s *TenantStore) ActivateTenant(ctx context.Context, tenantSchema string) error {
+	if err := s.setTenantActive(ctx, tenantSchema, true); err != nil {
+		return err
+	}
+	s.emit(ctx, EventTenantActivated, tenantSchema)
+	return nil
+}
+
+func (s *TenantStore) setTenantActive(ctx context.Context, tenantSchema string, active bool) error {
+	db, err := s.registryDB(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := db.Model(&Tenant{}).Where("schema = ?", tenantSchema).Update("active", active)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update tenant %s: %w", tenantSchema, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrTenantNotFound
+	}
+
+	s.registry.delete(tenantSchema)
+	return nil
+}
+
+// SoftDeleteTenant hides the tenant from the registry without touching its
+// schema. RestoreTenant undoes it.
+func (s *TenantStore) SoftDeleteTenant(ctx context.Context, tenantSchema string) error {
+	db, err := s.registryDB(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := db.Where("schema = ?", tenantSchema).Delete(&Tenant{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete tenant %s: %w", tenantSchema, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrTenantNotFound
+	}
+
+	s.registry.delete(tenantSchema)
+	s.emit(ctx, EventTenantDeleted, tenantSchema)
+	return nil
+}
+
+// RestoreTenant brings back a soft-deleted tenant
+func (s *TenantStore) RestoreTenant(ctx context.Context, tenantSchema string) error {
+	db, err := s.registryDB(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := db.Unscoped().Model(&Tenant{}).
+		Where("schema = ? AND deleted_at IS NOT NULL", tenantSchema).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to restore tenant %s: %w", tenantSchema, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrTenantNotFound
+	}
+
+	s.registry.delete(tenantSchema)
+	s.emit(ctx, EventTenantRestored, tenantSchema)
+	return nil
+}
+
+// InvalidateTenant drops the cached registry record so the next lookup reads
+// the database, for changes made by another process
+func (s *TenantStore) InvalidateTenant(tenantSchema string) {
+	s.registry.delete(tenantSchema)
+}
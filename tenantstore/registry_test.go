@@ -0,0 +1,153 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantcache"
+)
+
+func TestRegistryActivation(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.EnableRegistry = true
+	config.RegistryCacheTTL = time.Hour
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	assertActive := func(want bool) {
+		t.Helper()
+		active, err := store.IsTenantActive(ctx, "acme")
+		if err != nil {
+			t.Fatalf("Failed to check tenant: %v", err)
+		}
+		if active != want {
+			t.Fatalf("Expected active=%v, got %v", want, active)
+		}
+	}
+
+	// Unregistered tenants are not active
+	assertActive(false)
+
+	if err := store.RegisterTenant(ctx, &Tenant{Schema: "acme", Name: "Acme", Active: true}); err != nil {
+		t.Fatalf("Failed to register tenant: %v", err)
+	}
+	assertActive(true)
+
+	// Changes through the store invalidate the cache at once
+	if err := store.DeactivateTenant(ctx, "acme"); err != nil {
+		t.Fatalf("Failed to deactivate tenant: %v", err)
+	}
+	assertActive(false)
+
+	if err := store.ActivateTenant(ctx, "acme"); err != nil {
+		t.Fatalf("Failed to activate tenant: %v", err)
+	}
+	assertActive(true)
+
+	// Changes made elsewhere need an explicit invalidation within the TTL
+	store.GetMasterDB().Exec("UPDATE mt_tenants SET active = false WHERE schema = 'acme'")
+	assertActive(true)
+	store.InvalidateTenant("acme")
+	assertActive(false)
+
+	if err := store.SoftDeleteTenant(ctx, "acme"); err != nil {
+		t.Fatalf("Failed to soft-delete tenant: %v", err)
+	}
+	if _, err := store.LookupTenant(ctx, "acme"); !errors.Is(err, ErrTenantNotFound) {
+		t.Fatalf("Expected ErrTenantNotFound after soft delete, got %v", err)
+	}
+
+	if err := store.RestoreTenant(ctx, "acme"); err != nil {
+		t.Fatalf("Failed to restore tenant: %v", err)
+	}
+	if _, err := store.LookupTenant(ctx, "acme"); err != nil {
+		t.Fatalf("Expected tenant after restore, got %v", err)
+	}
+}
+
+func TestRegistryDisabled(t *testing.T) {
+	t.Parallel()
+
+	store, err := New(DefaultConfig(getTestDSN(t)))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.IsTenantActive(context.Background(), "acme"); !errors.Is(err, ErrRegistryDisabled) {
+		t.Fatalf("Expected ErrRegistryDisabled, got %v", err)
+	}
+}
+
+func TestTenantAPIVersion(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "api_version")
+	ctx := context.Background()
+
+	if err := store.RegisterTenant(ctx, &Tenant{Schema: "acme", Active: true, APIVersion: "1"}); err != nil {
+		t.Fatalf("Failed to register tenant: %v", err)
+	}
+	if version, err := store.TenantAPIVersion(ctx, "acme"); err != nil || version != "1" {
+		t.Fatalf("Expected version 1, got %q %v", version, err)
+	}
+
+	if err := store.SetTenantAPIVersion(ctx, "acme", "2.1"); err != nil {
+		t.Fatalf("Failed to set version: %v", err)
+	}
+	if version, err := store.TenantAPIVersion(ctx, "acme"); err != nil || version != "2.1" {
+		t.Fatalf("Expected version 2.1, got %q %v", version, err)
+	}
+
+	if version, err := store.TenantAPIVersion(ctx, "unknown"); err != nil || version != "" {
+		t.Fatalf("Expected no version for unknown tenants, got %q %v", version, err)
+	}
+	if err := store.SetTenantAPIVersion(ctx, "unknown", "2"); !errors.Is(err, ErrTenantNotFound) {
+		t.Fatalf("Expected ErrTenantNotFound, got %v", err)
+	}
+}
+
+func TestRegistrySharedCache(t *testing.T) {
+	ctx := context.Background()
+	shared := tenantcache.NewMemory()
+
+	// Two replicas of one registry
+	replicaA := newSQLiteRegistryStore(t, "registry_shared_cache")
+	replicaB := newSQLiteRegistryStore(t, "registry_shared_cache")
+	replicaA.registry = newRegistryCache(shared, time.Hour)
+	replicaB.registry = newRegistryCache(shared, time.Hour)
+
+	if err := replicaA.RegisterTenant(ctx, &Tenant{Schema: "acme", Active: true}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if tenant, err := replicaA.LookupTenant(ctx, "acme"); err != nil || !tenant.Active {
+		t.Fatalf("Expected an active tenant, got %+v (%v)", tenant, err)
+	}
+	if _, ok, _ := shared.Get(ctx, "mt:registry:acme"); !ok {
+		t.Fatal("Expected the lookup in the shared cache")
+	}
+
+	// A change on one replica invalidates the other at once
+	if err := replicaB.DeactivateTenant(ctx, "acme"); err != nil {
+		t.Fatalf("Failed to deactivate: %v", err)
+	}
+	if tenant, err := replicaA.LookupTenant(ctx, "acme"); err != nil || tenant.Active {
+		t.Fatalf("Expected the deactivation on the other replica, got %+v (%v)", tenant, err)
+	}
+
+	// Misses are shared too
+	if _, err := replicaB.LookupTenant(ctx, "globex"); !errors.Is(err, ErrTenantNotFound) {
+		t.Fatalf("Expected ErrTenantNotFound, got %v", err)
+	}
+	if value, ok, _ := shared.Get(ctx, "mt:registry:globex"); !ok || string(value) != "null" {
+		t.Fatalf("Expected a cached miss, got %q", value)
+	}
+}
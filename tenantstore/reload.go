@@ -0,0 +1,234 @@
+package tenantstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Dialect is the only database dialect the store speaks
+const Dialect = "postgres"
+
+// ErrImmutableConfig is returned by UpdateConfig for fields that cannot
+// change while the store runs
+var ErrImmutableConfig = errors.New("config field cannot be changed at runtime")
+
+// ConfigPatch lists the config fields UpdateConfig may change. Nil fields
+// are left as they are.
+type ConfigPatch struct {
+	// MasterDSN and Dialect are immutable. Patches may repeat their current
+	// values, so a config service can send the whole config, but any other
+	// value fails with ErrImmutableConfig.
+	MasterDSN *string
+	Dialect   *string
+
+	MaxOpenConns    *int
+	MaxIdleConns    *int
+	ConnMaxLifetime *time.Duration
+	ConnMaxIdleTime *time.Duration
+
+	HealthCheckInterval *time.Duration
+
+	// MasterSchemaNames replaces the reserved schemas; cached connections
+	// to schemas it adds are closed
+	MasterSchemaNames *[]string
+
+	MaxTenants         *int
+	ProvisionRateLimit *rate.Limit
+	ProvisionBurst     *int
+
+	// Lowering MaxCachedTenants evicts pools beyond it; a new
+	// TenantIdleTimeout or JanitorInterval restarts the janitor
+	MaxCachedTenants    *int
+	TenantIdleTimeout   *time.Duration
+	JanitorInterval     *time.Duration
+	RotationGracePeriod *time.Duration
+}
+
+// ConfigChange describes a field changed by UpdateConfig
+type ConfigChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// UpdateConfig applies patch to a copy of the config and swaps it in, so
+// concurrent operations see either the old or the new config, never a mix.
+// Pool limits are applied to open tenant pools as well, and the provision
+// rate limiter keeps its tokens when only its rate or burst changes.
+// Invalid values and changes to immutable fields return an error and change
+// nothing. Config.OnConfigChange is called for each changed field. It is the
+// only safe way to change the config of a running store.
+func (s *TenantStore) UpdateConfig(patch ConfigPatch) error {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	current := s.config()
+	if patch.MasterDSN != nil && *patch.MasterDSN != current.MasterDSN {
+		return fmt.Errorf("%w: MasterDSN", ErrImmutableConfig)
+	}
+	if patch.Dialect != nil && *patch.Dialect != Dialect {
+		return fmt.Errorf("%w: Dialect", ErrImmutableConfig)
+	}
+	if err := patch.validate(); err != nil {
+		return err
+	}
+
+	next := *current
+	var changes []ConfigChange
+	patchField(&changes, "MaxOpenConns", &next.MaxOpenConns, patch.MaxOpenConns)
+	patchField(&changes, "MaxIdleConns", &next.MaxIdleConns, patch.MaxIdleConns)
+	patchField(&changes, "ConnMaxLifetime", &next.ConnMaxLifetime, patch.ConnMaxLifetime)
+	patchField(&changes, "ConnMaxIdleTime", &next.ConnMaxIdleTime, patch.ConnMaxIdleTime)
+	patchField(&changes, "HealthCheckInterval", &next.HealthCheckInterval, patch.HealthCheckInterval)
+	patchField(&changes, "MaxTenants", &next.MaxTenants, patch.MaxTenants)
+	patchField(&changes, "ProvisionRateLimit", &next.ProvisionRateLimit, patch.ProvisionRateLimit)
+	patchField(&changes, "ProvisionBurst", &next.ProvisionBurst, patch.ProvisionBurst)
+	patchField(&changes, "MaxCachedTenants", &next.MaxCachedTenants, patch.MaxCachedTenants)
+	patchField(&changes, "TenantIdleTimeout", &next.TenantIdleTimeout, patch.TenantIdleTimeout)
+	patchField(&changes, "JanitorInterval", &next.JanitorInterval, patch.JanitorInterval)
+	patchField(&changes, "RotationGracePeriod", &next.RotationGracePeriod, patch.RotationGracePeriod)
+	if patch.MasterSchemaNames != nil && !slices.Equal(*patch.MasterSchemaNames, current.MasterSchemaNames) {
+		next.MasterSchemaNames = slices.Clone(*patch.MasterSchemaNames)
+		changes = append(changes, ConfigChange{Field: "MasterSchemaNames", Old: current.MasterSchemaNames, New: next.MasterSchemaNames})
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	s.cfg.Store(&next)
+	if next.current != nil {
+		// The DefaultConfig callbacks follow the store's config
+		next.current.CompareAndSwap(current, &next)
+	}
+	s.applyConfigChanges(&next, changes)
+
+	if next.OnConfigChange != nil {
+		for _, change := range changes {
+			next.OnConfigChange(change)
+		}
+	}
+	return nil
+}
+
+func (p ConfigPatch) validate() error {
+	for name, value := range map[string]*int{"MaxOpenConns": p.MaxOpenConns, "MaxIdleConns": p.MaxIdleConns, "MaxTenants": p.MaxTenants, "ProvisionBurst": p.ProvisionBurst, "MaxCachedTenants": p.MaxCachedTenants} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+	}
+	for name, value := range map[string]*time.Duration{"ConnMaxLifetime": p.ConnMaxLifetime, "ConnMaxIdleTime": p.ConnMaxIdleTime, "HealthCheckInterval": p.HealthCheckInterval,
+		"TenantIdleTimeout": p.TenantIdleTimeout, "JanitorInterval": p.JanitorInterval, "RotationGracePeriod": p.RotationGracePeriod} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+	}
+	if p.ProvisionRateLimit != nil && *p.ProvisionRateLimit < 0 {
+		return fmt.Errorf("ProvisionRateLimit cannot be negative")
+	}
+	if p.MasterSchemaNames != nil {
+		for _, name := range *p.MasterSchemaNames {
+			if name == "" {
+				return fmt.Errorf("MasterSchemaNames cannot contain an empty name")
+			}
+		}
+	}
+	return nil
+}
+
+// patchField sets *dst to *value when value is set and differs, recording
+// the change
+func patchField[T comparable](changes *[]ConfigChange, field string, dst *T, value *T) {
+	if value == nil || *value == *dst {
+		return
+	}
+	*changes = append(*changes, ConfigChange{Field: field, Old: *dst, New: *value})
+	*dst = *value
+}
+
+// applyConfigChanges brings running state in line with a new config
+func (s *TenantStore) applyConfigChanges(config *Config, changes []ConfigChange) {
+	var pool, limiter, reserved, cached, janitor, healthChecker bool
+	for _, change := range changes {
+		switch change.Field {
+		case "MaxOpenConns", "MaxIdleConns", "ConnMaxLifetime", "ConnMaxIdleTime":
+			pool = true
+		case "ProvisionRateLimit", "ProvisionBurst":
+			limiter = true
+		case "MasterSchemaNames":
+			reserved = true
+		case "MaxCachedTenants":
+			cached = true
+		case "TenantIdleTimeout", "JanitorInterval":
+			janitor = true
+		case "HealthCheckInterval":
+			healthChecker = true
+		}
+	}
+
+	// Close stops the background loops under configMu, so they are never
+	// restarted on a closed store
+	if janitor && !s.stopped {
+		s.stopJanitor()
+		s.startJanitor()
+	}
+	if healthChecker && !s.stopped {
+		s.stopHealthChecker()
+		s.startHealthChecker()
+	}
+	if cached {
+		s.mu.Lock()
+		s.evictLeastRecentlyUsed("")
+		s.mu.Unlock()
+	}
+
+	if limiter {
+		next := newProvisionLimiter(config)
+		if current := s.provisionLimiter.Load(); current != nil && next != nil {
+			current.SetLimit(next.Limit())
+			current.SetBurst(next.Burst())
+		} else {
+			s.provisionLimiter.Store(next)
+		}
+	}
+
+	var evict []string
+	s.mu.RLock()
+	for tenantSchema, db := range s.tenantDBs {
+		if reserved && s.isMasterSchema(tenantSchema) {
+			evict = append(evict, tenantSchema)
+			continue
+		}
+		if pool && s.poolProfiles[tenantSchema] == "" {
+			if sqlDB, err := db.DB(); err == nil {
+				config.applyPool(sqlDB)
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, tenantSchema := range evict {
+		s.UnpinTenant(tenantSchema)
+		s.RemoveTenantDB(tenantSchema)
+	}
+}
+
+// defaultMaxIdleConns is database/sql's idle limit when none is set
+const defaultMaxIdleConns = 2
+
+// applyPool sets the pool limits of a tenant connection. Zero restores the
+// database/sql default, so limits removed by UpdateConfig are lifted.
+func (c *Config) applyPool(sqlDB *sql.DB) {
+	sqlDB.SetMaxOpenConns(c.MaxOpenConns)
+	if c.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(c.MaxIdleConns)
+	} else {
+		sqlDB.SetMaxIdleConns(defaultMaxIdleConns)
+	}
+	sqlDB.SetConnMaxLifetime(c.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+}
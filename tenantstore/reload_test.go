@@ -0,0 +1,167 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestUpdateConfigWhileServing(t *testing.T) {
+	var changes atomic.Int64
+	store := newSQLiteTenantStore(t, "update_config_race", func(config *Config) {
+		config.OnConfigChange = func(change ConfigChange) {
+			changes.Add(1)
+		}
+	})
+	store.health = map[string]*tenantHealth{"acme": {}}
+	t.Cleanup(store.stopHealthChecker)
+	ctx := context.Background()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := store.GetTenantDB(ctx, "acme"); err != nil {
+					t.Errorf("Failed to get tenant DB: %v", err)
+					return
+				}
+				store.checkProvision(context.WithValue(ctx, skipProvisionGuardsKey{}, true), store.master(), "acme")
+			}
+		}()
+	}
+
+	for i := 1; i <= 200; i++ {
+		open, interval := i%10+1, time.Duration(i)*time.Millisecond
+		limit := rate.Limit(i)
+		if err := store.UpdateConfig(ConfigPatch{MaxOpenConns: &open, HealthCheckInterval: &interval, ProvisionRateLimit: &limit}); err != nil {
+			t.Fatalf("Failed to update config: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if changes.Load() == 0 {
+		t.Fatal("Expected OnConfigChange to be called")
+	}
+
+	// Open pools get the last limits
+	sqlDB, _ := store.tenantDBs["acme"].DB()
+	if max := sqlDB.Stats().MaxOpenConnections; max != 200%10+1 {
+		t.Fatalf("Expected the pool limited to %d, got %d", 200%10+1, max)
+	}
+	if limiter := store.provisionLimiter.Load(); limiter == nil || limiter.Limit() != 200 {
+		t.Fatalf("Expected the provision limit of 200, got %v", limiter)
+	}
+}
+
+func TestUpdateConfigChanges(t *testing.T) {
+	var changes []ConfigChange
+	store := newSQLiteTenantStore(t, "update_config_changes", func(config *Config) {
+		config.OnConfigChange = func(change ConfigChange) {
+			changes = append(changes, change)
+		}
+	})
+	t.Cleanup(store.stopHealthChecker)
+	before := store.config()
+
+	interval, open := time.Minute, 4
+	if err := store.UpdateConfig(ConfigPatch{HealthCheckInterval: &interval, MaxOpenConns: &open}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Field != "MaxOpenConns" || changes[0].New != 4 || changes[1].Field != "HealthCheckInterval" {
+		t.Fatalf("Expected changes of MaxOpenConns and HealthCheckInterval, got %+v", changes)
+	}
+	if store.config().HealthCheckInterval != time.Minute || before.HealthCheckInterval == time.Minute {
+		t.Fatal("Expected a new config, leaving the old one untouched")
+	}
+
+	// Repeating values changes nothing
+	changes = nil
+	if err := store.UpdateConfig(ConfigPatch{HealthCheckInterval: &interval}); err != nil || len(changes) != 0 {
+		t.Fatalf("Expected no changes, got %+v (%v)", changes, err)
+	}
+
+	// Reserving a cached schema closes its connection
+	if err := store.UpdateConfig(ConfigPatch{MasterSchemaNames: &[]string{"acme"}}); err != nil {
+		t.Fatalf("Failed to reserve acme: %v", err)
+	}
+	if _, ok := store.tenantDBs["acme"]; ok {
+		t.Fatal("Expected the connection to the reserved schema to be closed")
+	}
+	if _, err := store.GetTenantDB(context.Background(), "acme"); !errors.Is(err, ErrMasterSchema) {
+		t.Fatalf("Expected ErrMasterSchema, got %v", err)
+	}
+}
+
+func TestUpdateConfigRejectsInvalidPatches(t *testing.T) {
+	store := withConfig(&TenantStore{}, DefaultConfig("postgres://localhost/app"))
+	before := store.config()
+
+	same, other := "postgres://localhost/app", "postgres://localhost/other"
+	mysql, postgres := "mysql", Dialect
+	negative := -1
+	open := 10
+
+	if err := store.UpdateConfig(ConfigPatch{MasterDSN: &other, MaxOpenConns: &open}); !errors.Is(err, ErrImmutableConfig) {
+		t.Fatalf("Expected ErrImmutableConfig for MasterDSN, got %v", err)
+	}
+	if err := store.UpdateConfig(ConfigPatch{Dialect: &mysql}); !errors.Is(err, ErrImmutableConfig) {
+		t.Fatalf("Expected ErrImmutableConfig for Dialect, got %v", err)
+	}
+	if err := store.UpdateConfig(ConfigPatch{MaxIdleConns: &negative}); err == nil {
+		t.Fatal("Expected an error for a negative pool size")
+	}
+	if store.config() != before {
+		t.Fatal("Expected rejected patches to change nothing")
+	}
+
+	// Current values of immutable fields are accepted
+	if err := store.UpdateConfig(ConfigPatch{MasterDSN: &same, Dialect: &postgres, MaxOpenConns: &open}); err != nil {
+		t.Fatalf("Expected the patch to apply, got %v", err)
+	}
+	if store.config().MaxOpenConns != 10 {
+		t.Fatalf("Expected MaxOpenConns 10, got %d", store.config().MaxOpenConns)
+	}
+}
+
+func TestDefaultConfigFollowsUpdateConfig(t *testing.T) {
+	config := DefaultConfig("host=localhost dbname=app")
+	store := withConfig(&TenantStore{}, config)
+
+	open := 10
+	if err := store.UpdateConfig(ConfigPatch{MaxOpenConns: &open}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	// GetTenantDSN reads the swapped config, not the one it was created with
+	if config.current.Load() != store.config() {
+		t.Fatal("Expected GetTenantDSN to read the updated config")
+	}
+	if dsn := store.config().GetTenantDSN("acme"); dsn != `host=localhost dbname=app search_path='"acme", "public"'` {
+		t.Fatalf("Expected the tenant DSN, got %s", dsn)
+	}
+
+	// Another store created from a copy leaves it alone
+	copied := *store.config()
+	other := withConfig(&TenantStore{}, &copied)
+	open = 20
+	if err := other.UpdateConfig(ConfigPatch{MaxOpenConns: &open}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if config.current.Load() != store.config() {
+		t.Fatal("Expected the copy's updates not to reach the original store's GetTenantDSN")
+	}
+}
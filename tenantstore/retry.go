@@ -0,0 +1,162 @@
+package tenantstore
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// FailpointQuery is the operation passed to Config.FailpointInjector before
+// each attempt of a query retried under Config.RetryReads
+const FailpointQuery = "query"
+
+// Defaults of RetryPolicy
+const (
+	DefaultRetryBackoff    = 20 * time.Millisecond
+	DefaultRetryMaxBackoff = 500 * time.Millisecond
+)
+
+// DefaultRetrySQLStates are the transient errors retried when
+// RetryPolicy.SQLStates is nil: serialization failures and deadlocks,
+// connection failures and servers shutting down during a failover
+var DefaultRetrySQLStates = []string{
+	"40001", // serialization_failure
+	"40P01", // deadlock_detected
+	"08000", // connection_exception
+	"08003", // connection_does_not_exist
+	"08006", // connection_failure
+	"57P01", // admin_shutdown
+	"57P02", // crash_shutdown
+	"57P03", // cannot_connect_now
+}
+
+// RetryPolicy retries failed reads on tenant connections. Only queries run
+// through GORM's query callbacks, such as Find, First, Take, Count and
+// Pluck, are retried; creates, updates, deletes, Raw and Exec never are,
+// nor are queries inside a transaction, which PostgreSQL aborts on the
+// first error.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts per query, the first included.
+	// Zero or one disables retries.
+	MaxAttempts int
+
+	// Backoff is the pause before the first retry, doubled before each
+	// further retry up to MaxBackoff (defaults DefaultRetryBackoff and
+	// DefaultRetryMaxBackoff). Pauses end early with the query's context.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// SQLStates are the SQLSTATE codes retried, DefaultRetrySQLStates when
+	// nil. Broken connections the driver reports without a SQLSTATE are
+	// retried too.
+	SQLStates []string
+}
+
+// enabled reports whether the policy retries at all
+func (p RetryPolicy) enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+// retryable reports whether err is one of the policy's transient errors
+func (p RetryPolicy) retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		states := p.SQLStates
+		if states == nil {
+			states = DefaultRetrySQLStates
+		}
+		return slices.Contains(states, pgErr.Code)
+	}
+	return errors.Is(err, driver.ErrBadConn) || pgconn.SafeToRetry(err)
+}
+
+// backoff returns the pause before the given retry, counted from 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	backoff, limit := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	if limit <= 0 {
+		limit = DefaultRetryMaxBackoff
+	}
+	for i := 1; i < retry && backoff < limit; i++ {
+		backoff *= 2
+	}
+	return min(backoff, limit)
+}
+
+// ReadRetries returns how many times reads were retried under
+// Config.RetryReads, by schema, since the store was created
+func (s *TenantStore) ReadRetries() map[string]int64 {
+	retries := make(map[string]int64)
+	s.readRetries.Range(func(key, value any) bool {
+		retries[key.(string)] = value.(*atomic.Int64).Load()
+		return true
+	})
+	return retries
+}
+
+// countReadRetry records a retried read of the tenant
+func (s *TenantStore) countReadRetry(tenantSchema string) {
+	counter, _ := s.readRetries.LoadOrStore(tenantSchema, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(1)
+}
+
+// registerRetryReads wraps the query callback of a tenant connection to
+// retry transient failures under Config.RetryReads. The policy is read per
+// query.
+func (s *TenantStore) registerRetryReads(db *gorm.DB, tenantSchema string) error {
+	callbacks := db.Callback().Query()
+	query := callbacks.Get("gorm:query")
+	if query == nil {
+		return nil
+	}
+
+	retrying := func(db *gorm.DB) {
+		policy := s.config().RetryReads
+		if !policy.enabled() || db.Error != nil {
+			query(db)
+			return
+		}
+
+		for attempt := 1; ; attempt++ {
+			if err := s.failpoint(FailpointQuery, tenantSchema); err != nil {
+				db.AddError(err)
+			} else {
+				query(db)
+			}
+			if db.Error == nil || attempt >= policy.MaxAttempts || !policy.retryable(db.Error) || inTransaction(db) {
+				return
+			}
+
+			timer := time.NewTimer(policy.backoff(attempt))
+			select {
+			case <-db.Statement.Context.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			// The statement keeps its SQL, so the next attempt sends it again
+			db.Error = nil
+			s.countReadRetry(tenantSchema)
+		}
+	}
+
+	if err := callbacks.Replace("gorm:query", retrying); err != nil {
+		return fmt.Errorf("failed to register read retries: %w", err)
+	}
+	return nil
+}
+
+// inTransaction reports whether the statement runs in a transaction
+func inTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
@@ -0,0 +1,145 @@
+//go:build !nofailpoints
+
+package tenantstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+func TestRetryReads(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:retry_reads?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { closeDB(db) })
+	if err := db.AutoMigrate(&TestModel{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	db.Create(&TestModel{Name: "alpha"})
+
+	// failures are injected into the next query attempts
+	var failures []error
+	calls := 0
+	config := DefaultConfig("")
+	config.RetryReads = RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	config.FailpointInjector = func(op, schema string) error {
+		if op != FailpointQuery || schema != "acme" {
+			t.Fatalf("Unexpected failpoint %s for %s", op, schema)
+		}
+		calls++
+		if len(failures) == 0 {
+			return nil
+		}
+		err := failures[0]
+		failures = failures[1:]
+		return err
+	}
+	store := withConfig(&TenantStore{}, config)
+	if err := store.registerRetryReads(db, "acme"); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	serialization := &pgconn.PgError{Code: "40001", Message: "could not serialize access"}
+
+	t.Run("Transient failure then success", func(t *testing.T) {
+		calls, failures = 0, []error{serialization}
+		var models []TestModel
+		if err := db.Find(&models).Error; err != nil || len(models) != 1 {
+			t.Fatalf("Expected the retry to succeed, got %v (%v)", models, err)
+		}
+		if calls != 2 || store.ReadRetries()["acme"] != 1 {
+			t.Fatalf("Expected 2 attempts and 1 retry, got %d and %v", calls, store.ReadRetries())
+		}
+	})
+
+	t.Run("Attempts are capped", func(t *testing.T) {
+		calls, failures = 0, []error{serialization, serialization, serialization, serialization}
+		var count int64
+		if err := db.Model(&TestModel{}).Count(&count).Error; !errors.Is(err, serialization) {
+			t.Fatalf("Expected the serialization failure, got %v", err)
+		}
+		if calls != 3 || store.ReadRetries()["acme"] != 3 {
+			t.Fatalf("Expected 3 attempts and 3 retries in total, got %d and %v", calls, store.ReadRetries())
+		}
+	})
+
+	t.Run("Other errors are not retried", func(t *testing.T) {
+		calls, failures = 0, []error{&pgconn.PgError{Code: "42P01"}}
+		var model TestModel
+		if err := db.First(&model).Error; err == nil {
+			t.Fatal("Expected the error")
+		}
+		if calls != 1 {
+			t.Fatalf("Expected 1 attempt, got %d", calls)
+		}
+	})
+
+	t.Run("Configured SQLSTATEs", func(t *testing.T) {
+		reconfigure(store, func(config *Config) {
+			config.RetryReads.SQLStates = []string{"XX000"}
+		})
+		defer reconfigure(store, func(config *Config) {
+			config.RetryReads.SQLStates = nil
+		})
+
+		calls, failures = 0, []error{serialization}
+		var models []TestModel
+		if err := db.Find(&models).Error; !errors.Is(err, serialization) || calls != 1 {
+			t.Fatalf("Expected 40001 not to be retried, got %v after %d attempts", err, calls)
+		}
+		calls, failures = 0, []error{&pgconn.PgError{Code: "XX000"}}
+		if err := db.Find(&models).Error; err != nil || calls != 2 {
+			t.Fatalf("Expected XX000 to be retried, got %v after %d attempts", err, calls)
+		}
+	})
+
+	t.Run("Writes and transactions are not retried", func(t *testing.T) {
+		calls, failures = 0, nil
+		if err := db.Create(&TestModel{Name: "beta"}).Error; err != nil {
+			t.Fatalf("Failed to create: %v", err)
+		}
+		if err := db.Model(&TestModel{}).Where("name = ?", "beta").Update("name", "gamma").Error; err != nil {
+			t.Fatalf("Failed to update: %v", err)
+		}
+		if calls != 0 {
+			t.Fatalf("Expected writes to bypass the retries, got %d attempts", calls)
+		}
+
+		failures = []error{serialization}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var models []TestModel
+			return tx.Find(&models).Error
+		})
+		if !errors.Is(err, serialization) || calls != 1 {
+			t.Fatalf("Expected no retry in a transaction, got %v after %d attempts", err, calls)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		reconfigure(store, func(config *Config) {
+			config.RetryReads = RetryPolicy{}
+		})
+		calls, failures = 0, []error{serialization}
+		var models []TestModel
+		if err := db.Find(&models).Error; err != nil || calls != 0 {
+			t.Fatalf("Expected queries without the failpoint, got %v after %d attempts", err, calls)
+		}
+	})
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for retry, expected := range map[int]time.Duration{1: 10 * time.Millisecond, 2: 20 * time.Millisecond, 3: 40 * time.Millisecond, 4: 50 * time.Millisecond, 10: 50 * time.Millisecond} {
+		if backoff := policy.backoff(retry); backoff != expected {
+			t.Fatalf("Expected %s before retry %d, got %s", expected, retry, backoff)
+		}
+	}
+	if backoff := (RetryPolicy{}).backoff(1); backoff != DefaultRetryBackoff {
+		t.Fatalf("Expected the default backoff, got %s", backoff)
+	}
+}
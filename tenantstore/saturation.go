@@ -0,0 +1,97 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// ErrDatabaseSaturated is returned when PostgreSQL refuses a new connection
+// because max_connections (or a role or database limit) is reached. The
+// middleware responds with 503 and a Retry-After header.
+var ErrDatabaseSaturated error = &statusError{"database connections exhausted", http.StatusServiceUnavailable, time.Second}
+
+// Backoff between dial attempts while waiting for a free connection slot
+const (
+	saturationBackoff    = 50 * time.Millisecond
+	maxSaturationBackoff = time.Second
+)
+
+// isTooManyConnections reports whether err is PostgreSQL's SQLSTATE 53300
+func isTooManyConnections(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "53300"
+}
+
+// tenantDB returns the connection for a schema name. When the server is out
+// of connections it evicts idle tenant pools and retries the dial, waiting
+// for up to Config.SaturationWait before failing with ErrDatabaseSaturated.
+func (s *TenantStore) tenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	db, err := s.connectTenantDB(ctx, tenantSchema)
+	if err == nil || !isTooManyConnections(err) {
+		return db, err
+	}
+
+	deadline := time.Now().Add(s.config().SaturationWait)
+	backoff := saturationBackoff
+	for {
+		// Slots freed by eviction are tried at once
+		if s.evictIdle(tenantSchema) == 0 {
+			if time.Now().Add(backoff).After(deadline) {
+				return nil, fmt.Errorf("%w: %v", ErrDatabaseSaturated, err)
+			}
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, fmt.Errorf("%w: %v", ErrDatabaseSaturated, ctx.Err())
+			case <-timer.C:
+			}
+
+			if backoff *= 2; backoff > maxSaturationBackoff {
+				backoff = maxSaturationBackoff
+			}
+		}
+
+		db, err = s.connectTenantDB(ctx, tenantSchema)
+		if err == nil || !isTooManyConnections(err) {
+			return db, err
+		}
+	}
+}
+
+// evictIdle drops cached tenant pools with no connection in use, except
+// keep, pinned and leased tenants, and closes their idle connections at once
+// to free server slots. Pools skipped because a query runs are checked again
+// on the next attempt. Evicted pools are re-dialed on their next use.
+func (s *TenantStore) evictIdle(keep string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evicted := 0
+	for tenantSchema, db := range s.tenantDBs {
+		if tenantSchema == keep || s.pinned[tenantSchema] || s.leases[tenantSchema] > 0 {
+			continue
+		}
+
+		sqlDB, err := db.DB()
+		if err != nil {
+			continue
+		}
+		if stats := sqlDB.Stats(); stats.InUse > 0 || stats.Idle == 0 {
+			continue
+		}
+
+		// Requests that fetched the pool before eviction can still use it
+		// until it is retired; their connections close when released
+		s.evictTenantDB(tenantSchema)
+		evicted++
+	}
+	return evicted
+}
@@ -0,0 +1,87 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore/tenantstoretest"
+)
+
+func TestIsTooManyConnections(t *testing.T) {
+	tooMany := fmt.Errorf("failed to connect to tenant database: %w", &pgconn.PgError{Code: "53300"})
+	if !isTooManyConnections(tooMany) {
+		t.Fatal("Expected SQLSTATE 53300 to be detected through wrapping")
+	}
+	if isTooManyConnections(&pgconn.PgError{Code: "28P01"}) || isTooManyConnections(errors.New("53300")) {
+		t.Fatal("Expected other errors not to be detected")
+	}
+}
+
+func TestSaturationEvictsIdlePoolsAndWaits(t *testing.T) {
+	t.Parallel()
+
+	// A server of its own, so other tests do not use up its few slots
+	admin := tenantstoretest.StartDedicatedPostgres(t,
+		"-c", "max_connections=8", "-c", "superuser_reserved_connections=0")
+
+	config := DefaultConfig(tenantstoretest.NewDatabase(t, admin))
+	config.AutoMigrate = false
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	// Pin one connection per tenant until the server refuses more
+	var (
+		held      []*gorm.DB
+		saturated error
+	)
+	for i := 0; i < 10; i++ {
+		db, err := store.GetTenantDB(ctx, fmt.Sprintf("tenant_%d", i))
+		if err != nil {
+			saturated = err
+			break
+		}
+		held = append(held, db.Begin())
+	}
+	defer func() {
+		for _, tx := range held {
+			tx.Rollback()
+		}
+	}()
+
+	if !errors.Is(saturated, ErrDatabaseSaturated) || len(held) == 0 {
+		t.Fatalf("Expected ErrDatabaseSaturated after some tenants, got %v after %d", saturated, len(held))
+	}
+
+	// Releasing a connection lets a waiting dial through by evicting the
+	// now idle pool
+	reconfigure(store, func(config *Config) {
+		config.SaturationWait = 5 * time.Second
+	})
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		held[0].Rollback()
+	}()
+
+	if _, err := store.GetTenantDB(ctx, "waiting"); err != nil {
+		t.Fatalf("Expected the dial to wait for a free slot, got %v", err)
+	}
+
+	store.mu.RLock()
+	_, cached := store.tenantDBs["tenant_0"]
+	store.mu.RUnlock()
+	if cached {
+		t.Fatal("Expected the idle tenant_0 pool to be evicted")
+	}
+}
@@ -0,0 +1,107 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Defaults for SearchIndexDef
+const (
+	DefaultSearchColumn   = "search_vector"
+	DefaultSearchLanguage = "english"
+)
+
+// SearchIndexDef describes a full-text search index maintained in every
+// tenant schema: a generated tsvector column over Columns and a GIN index on
+// it. It requires PostgreSQL 12 or later.
+type SearchIndexDef struct {
+	// Table the index belongs to, as created by AutoMigrate
+	Table string
+
+	// Columns concatenated into the search document
+	Columns []string
+
+	// IndexName of the GIN index
+	IndexName string
+
+	// Column holding the generated tsvector (defaults to "search_vector")
+	Column string
+
+	// Language is the text search configuration (defaults to "english")
+	Language string
+}
+
+// ReindexSearch rebuilds the GIN indexes of Config.SearchIndexes in the
+// tenant schema, for example after bulk loads
+func (s *TenantStore) ReindexSearch(ctx context.Context, tenantSchema string) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+
+	db := s.master().WithContext(ctx)
+	schema := quoteIdentifier(tenantSchema)
+
+	for _, def := range s.config().SearchIndexes {
+		if err := db.Exec("REINDEX INDEX " + schema + "." + quoteIdentifier(def.IndexName)).Error; err != nil {
+			return fmt.Errorf("failed to reindex %s for %s: %w", def.IndexName, tenantSchema, err)
+		}
+	}
+	return nil
+}
+
+// createSearchIndexes adds the tsvector columns and GIN indexes of
+// Config.SearchIndexes to the tenant schema if they don't exist
+func (s *TenantStore) createSearchIndexes(ctx context.Context, db *gorm.DB, tenantSchema string) error {
+	for _, def := range s.config().SearchIndexes {
+		statements, err := searchIndexSQL(def, tenantSchema)
+		if err != nil {
+			return err
+		}
+
+		for _, statement := range statements {
+			if err := db.WithContext(ctx).Exec(statement).Error; err != nil {
+				return fmt.Errorf("failed to create search index %s for %s: %w", def.IndexName, tenantSchema, err)
+			}
+		}
+	}
+	return nil
+}
+
+// searchIndexSQL returns the idempotent statements creating a search index
+func searchIndexSQL(def SearchIndexDef, tenantSchema string) ([]string, error) {
+	if def.Table == "" || def.IndexName == "" || len(def.Columns) == 0 {
+		return nil, fmt.Errorf("search index requires a table, an index name and columns")
+	}
+
+	column := def.Column
+	if column == "" {
+		column = DefaultSearchColumn
+	}
+	language := def.Language
+	if language == "" {
+		language = DefaultSearchLanguage
+	}
+
+	parts := make([]string, len(def.Columns))
+	for i, col := range def.Columns {
+		parts[i] = "coalesce(" + quoteIdentifier(col) + "::text, '')"
+	}
+	document := strings.Join(parts, " || ' ' || ")
+
+	table := quoteIdentifier(tenantSchema) + "." + quoteIdentifier(def.Table)
+
+	return []string{
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s tsvector GENERATED ALWAYS AS (to_tsvector(%s::regconfig, %s)) STORED",
+			table, quoteIdentifier(column), quoteLiteral(language), document),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (%s)",
+			quoteIdentifier(def.IndexName), table, quoteIdentifier(column)),
+	}, nil
+}
+
+// quoteLiteral quotes a string literal for use in SQL
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
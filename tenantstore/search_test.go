@@ -0,0 +1,95 @@
+package tenantstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type Article struct {
+	ID    uint
+	Title string
+	Body  string
+}
+
+func TestSearchIndexes(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.AutoMigrate = true
+	config.Models = []interface{}{&Article{}}
+	config.SearchIndexes = []SearchIndexDef{{
+		Table:     "articles",
+		Columns:   []string{"title", "body"},
+		IndexName: "articles_search_idx",
+	}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	db, err := store.GetTenantDB(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	db.Create(&Article{Title: "Schema per tenant", Body: "Isolating customers with PostgreSQL schemas"})
+	db.Create(&Article{Title: "Connection pooling", Body: "Sizing pools for many tenants"})
+
+	var titles []string
+	db.Raw("SELECT title FROM articles WHERE search_vector @@ to_tsquery('english', 'postgresql & schema')").Scan(&titles)
+	if len(titles) != 1 || titles[0] != "Schema per tenant" {
+		t.Fatalf("Expected [Schema per tenant], got %v", titles)
+	}
+
+	var indexes int64
+	store.GetMasterDB().Raw("SELECT COUNT(*) FROM pg_indexes WHERE schemaname = 'tenant_a' AND indexname = 'articles_search_idx'").Scan(&indexes)
+	if indexes != 1 {
+		t.Fatalf("Expected search index in tenant_a, got %d", indexes)
+	}
+
+	// Running the migration again must not fail on the existing column and index
+	if err := store.MigrateTenant(ctx, "tenant_a"); err != nil {
+		t.Fatalf("Failed to re-migrate tenant: %v", err)
+	}
+
+	if err := store.ReindexSearch(ctx, "tenant_a"); err != nil {
+		t.Fatalf("Failed to reindex: %v", err)
+	}
+}
+
+func TestSearchIndexSQL(t *testing.T) {
+	statements, err := searchIndexSQL(SearchIndexDef{
+		Table:     "articles",
+		Columns:   []string{"title", `we"ird`},
+		IndexName: "articles_search_idx",
+		Language:  "simple",
+	}, "acme")
+	if err != nil {
+		t.Fatalf("Failed to build SQL: %v", err)
+	}
+
+	if len(statements) != 2 {
+		t.Fatalf("Expected 2 statements, got %d", len(statements))
+	}
+	if !strings.Contains(statements[0], `"acme"."articles"`) {
+		t.Fatalf("Expected quoted schema, got %s", statements[0])
+	}
+	if !strings.Contains(statements[0], `coalesce("we""ird"::text, '')`) {
+		t.Fatalf("Expected escaped column, got %s", statements[0])
+	}
+	if !strings.Contains(statements[0], `to_tsvector('simple'::regconfig`) {
+		t.Fatalf("Expected language literal, got %s", statements[0])
+	}
+	if !strings.Contains(statements[1], `USING GIN ("search_vector")`) {
+		t.Fatalf("Expected GIN index on default column, got %s", statements[1])
+	}
+
+	if _, err := searchIndexSQL(SearchIndexDef{Table: "articles"}, "acme"); err == nil {
+		t.Fatal("Expected error for incomplete definition")
+	}
+}
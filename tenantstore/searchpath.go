@@ -0,0 +1,46 @@
+package tenantstore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultSearchPath is the search_path of tenant connections unless
+// Config.SearchPathFor is set: the tenant schema, then public
+func DefaultSearchPath(tenantSchema string) []string {
+	return []string{tenantSchema, "public"}
+}
+
+// SearchPath returns the validated search_path of the tenant's connections,
+// from Config.SearchPathFor or DefaultSearchPath. The tenant schema must come
+// first, since unqualified DDL and the isolation checks target the first
+// schema.
+func (s *TenantStore) SearchPath(tenantSchema string) ([]string, error) {
+	return s.config().searchPath(tenantSchema)
+}
+
+func (c *Config) searchPath(tenantSchema string) ([]string, error) {
+	if c.SearchPathFor == nil {
+		return DefaultSearchPath(tenantSchema), nil
+	}
+
+	path := c.SearchPathFor(tenantSchema)
+	if len(path) == 0 || path[0] != tenantSchema {
+		return nil, fmt.Errorf("search_path %v of tenant %s must start with the tenant schema", path, tenantSchema)
+	}
+	for _, schema := range path {
+		if err := validateSchemaName(schema); err != nil {
+			return nil, fmt.Errorf("invalid search_path of tenant %s: %w", tenantSchema, err)
+		}
+	}
+	return path, nil
+}
+
+// formatSearchPath renders a search_path value with quoted identifiers
+func formatSearchPath(path []string) string {
+	quoted := make([]string, len(path))
+	for i, schema := range path {
+		quoted[i] = quoteIdentifier(schema)
+	}
+	return strings.Join(quoted, ", ")
+}
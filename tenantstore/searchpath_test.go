@@ -0,0 +1,138 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestSearchPathValidation(t *testing.T) {
+	config := DefaultConfig("host=localhost")
+	if path, err := config.searchPath("acme"); err != nil || fmt.Sprint(path) != "[acme public]" {
+		t.Fatalf("Expected default search_path [acme public], got %v (%v)", path, err)
+	}
+
+	config.SearchPathFor = func(tenantSchema string) []string {
+		switch tenantSchema {
+		case "vertical_first":
+			return []string{"retail", tenantSchema, "public"}
+		case "empty":
+			return nil
+		case "nul":
+			return []string{tenantSchema, "re\x00tail"}
+		}
+		return []string{tenantSchema, "retail", "public"}
+	}
+	for _, tenantSchema := range []string{"vertical_first", "empty", "nul"} {
+		if _, err := config.searchPath(tenantSchema); err == nil {
+			t.Fatalf("Expected search_path of %s to be rejected", tenantSchema)
+		}
+	}
+	if path, err := config.searchPath("acme"); err != nil || fmt.Sprint(path) != "[acme retail public]" {
+		t.Fatalf("Expected search_path [acme retail public], got %v (%v)", path, err)
+	}
+}
+
+func TestTenantDSNQuotesSearchPath(t *testing.T) {
+	dsn := tenantDSN("host=localhost user=app", []string{"Acme Corp", `we"ird`, "it's", "public"})
+
+	config, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", dsn, err)
+	}
+	want := `"Acme Corp", "we""ird", "it's", "public"`
+	if got := config.RuntimeParams["search_path"]; got != want {
+		t.Fatalf("Expected search_path %s, got %s", want, got)
+	}
+}
+
+func TestSearchPathFor(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	config := DefaultConfig(dsn)
+	config.SearchPathFor = func(tenantSchema string) []string {
+		return []string{tenantSchema, "sp_vertical_retail", "public"}
+	}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	master := store.GetMasterDB().WithContext(ctx)
+	for _, stmt := range []string{
+		"CREATE SCHEMA IF NOT EXISTS sp_vertical_retail",
+		"CREATE TABLE IF NOT EXISTS sp_vertical_retail.sp_categories (name text)",
+		"TRUNCATE sp_vertical_retail.sp_categories",
+		"INSERT INTO sp_vertical_retail.sp_categories VALUES ('groceries'), ('apparel')",
+	} {
+		if err := master.Exec(stmt).Error; err != nil {
+			t.Fatalf("Failed to set up vertical schema: %v", err)
+		}
+	}
+	defer master.Exec("DROP SCHEMA IF EXISTS sp_vertical_retail CASCADE")
+	defer store.DropTenant(ctx, "sp_tenant", DropOptions{Cascade: true})
+
+	db, err := store.GetTenantDB(ctx, "sp_tenant")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	// The vertical's lookup table resolves without qualification
+	var count int64
+	if err := db.Table("sp_categories").Count(&count).Error; err != nil {
+		t.Fatalf("Failed to query vertical table: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 categories, got %d", count)
+	}
+
+	// New tables still land in the tenant schema
+	var current string
+	if err := db.Raw("SELECT current_schema()").Scan(&current).Error; err != nil || current != "sp_tenant" {
+		t.Fatalf("Expected current_schema sp_tenant, got %q (%v)", current, err)
+	}
+}
+
+func TestSearchPathForQueriesStore(t *testing.T) {
+	var store *TenantStore
+	var vertical string
+	store = newSQLiteRegistryStore(t, "search_path_lookup", func(config *Config) {
+		config.Shards = map[string]string{"closed": "host=127.0.0.1 port=1 connect_timeout=1"}
+		config.SearchPathFor = func(tenantSchema string) []string {
+			tenant, err := store.LookupTenant(context.Background(), tenantSchema)
+			if err != nil {
+				return DefaultSearchPath(tenantSchema)
+			}
+			vertical = tenant.Settings["vertical"]
+			return []string{tenantSchema, vertical, "public"}
+		}
+	})
+	ctx := context.Background()
+
+	tenant := &Tenant{Schema: "acme", Active: true, Settings: map[string]string{"vertical": "retail"}, Placement: Placement{Shard: "closed"}}
+	if err := store.RegisterTenant(ctx, tenant); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	// The shard refuses the connection, after the search path was read
+	done := make(chan error, 1)
+	go func() {
+		_, err := store.GetTenantDB(ctx, "acme")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || vertical != "retail" {
+			t.Fatalf("Expected the search path read and the dial to fail, got %q and %v", vertical, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected GetTenantDB to return, it deadlocked")
+	}
+}
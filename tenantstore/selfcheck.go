@@ -0,0 +1,232 @@
+package tenantstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Steps of SelfCheck, in the order they run
+const (
+	SelfCheckMaster       = "master"
+	SelfCheckPermissions  = "permissions"
+	SelfCheckCreateSchema = "create_schema"
+	SelfCheckGrants       = "grants"
+	SelfCheckMigrate      = "migrate"
+	SelfCheckIsolation    = "isolation"
+	SelfCheckRoundTrip    = "round_trip"
+	SelfCheckDropSchema   = "drop_schema"
+)
+
+// selfCheckTable is created in the throwaway schema for the round trip
+const selfCheckTable = "mt_selfcheck"
+
+// SelfCheckStep is the outcome of one step of SelfCheck
+type SelfCheckStep struct {
+	Name     string        `json:"name"`
+	OK       bool          `json:"ok"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+
+	// Hint suggests the usual fix when the step failed
+	Hint string `json:"hint,omitempty"`
+}
+
+// SelfCheckReport lists the steps SelfCheck ran. Steps after a failure are
+// not run, except for dropping the throwaway schema.
+type SelfCheckReport struct {
+	Schema string          `json:"schema"`
+	Steps  []SelfCheckStep `json:"steps"`
+}
+
+// Passed reports whether every step succeeded
+func (r *SelfCheckReport) Passed() bool {
+	return r.Failed() == nil
+}
+
+// Failed returns the first failed step, or nil
+func (r *SelfCheckReport) Failed() *SelfCheckStep {
+	for i := range r.Steps {
+		if !r.Steps[i].OK {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
+
+// SelfCheck validates the multitenant setup end to end on a throwaway
+// schema: the master connection and its privileges, schema creation with
+// Config.PostCreateGrants leaving PUBLIC no privileges, migration of
+// Config.Models, search_path isolation of tenant connections, a round-trip
+// insert and select, and dropping the schema. It neither counts
+// against MaxTenants nor emits tenant events. The error names the first
+// failed step; the report has a remediation hint for it.
+func (s *TenantStore) SelfCheck(ctx context.Context) (SelfCheckReport, error) {
+	report := SelfCheckReport{Schema: selfCheckSchema()}
+	tenantSchema := report.Schema
+
+	run := func(name, hint string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+
+		step := SelfCheckStep{Name: name, OK: err == nil, Duration: time.Since(start)}
+		if err != nil {
+			step.Error = err.Error()
+			step.Hint = hint
+		}
+		report.Steps = append(report.Steps, step)
+		return err == nil
+	}
+
+	ok := run(SelfCheckMaster,
+		"check MasterDSN or DSNProvider: host, port, database, credentials and sslmode",
+		func() error {
+			sqlDB, err := s.master().DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		})
+
+	// Schemas are created on the master connection unless GetMigrationDSN
+	// is set
+	if ok && s.config().GetMigrationDSN == nil {
+		ok = run(SelfCheckPermissions,
+			"grant the master role CREATE on the database (GRANT CREATE ON DATABASE <db> TO <role>) or set GetMigrationDSN to a role that has it",
+			func() error {
+				var canCreate bool
+				if err := s.master().WithContext(ctx).
+					Raw("SELECT has_database_privilege(current_database(), 'CREATE')").
+					Scan(&canCreate).Error; err != nil {
+					return fmt.Errorf("failed to check privileges: %w", err)
+				}
+				if !canCreate {
+					return fmt.Errorf("master role cannot create schemas")
+				}
+				return nil
+			})
+	}
+
+	created := false
+	ok = ok && run(SelfCheckCreateSchema,
+		"check that the role creating schemas has CREATE on the database and that GetMigrationDSN, if set, connects",
+		func() error {
+			var err error
+			if s.config().GetMigrationDSN != nil {
+				err = s.migrateWithMigrationDSN(ctx, tenantSchema, nil)
+			} else {
+				err = s.ensureSchema(ctx, tenantSchema)
+			}
+			created = err == nil
+			return err
+		})
+
+	ok = ok && run(SelfCheckGrants,
+		"PUBLIC must not have privileges on tenant schemas: add REVOKE ALL ON SCHEMA {{.Schema}} FROM PUBLIC to Config.PostCreateGrants and check ALTER DEFAULT PRIVILEGES of the role creating schemas",
+		func() error {
+			privileges, err := publicSchemaPrivileges(ctx, s.master(), tenantSchema)
+			if err != nil {
+				return err
+			}
+			if len(privileges) > 0 {
+				return fmt.Errorf("PUBLIC has %s on new tenant schemas", strings.Join(privileges, ", "))
+			}
+			return nil
+		})
+
+	ok = ok && run(SelfCheckMigrate,
+		"check that Config.Models and ModelGroups migrate cleanly into an empty schema and that GetTenantDSN connects",
+		func() error {
+			return s.MigrateTenant(context.WithValue(ctx, skipProvisionGuardsKey{}, true), tenantSchema)
+		})
+
+	ok = ok && run(SelfCheckIsolation,
+		"tenant connections must set search_path to the tenant schema: keep the default GetTenantDSN or add search_path to your DSN; poolers in transaction mode drop it",
+		func() error {
+			db, err := s.tenantDB(ctx, tenantSchema)
+			if err != nil {
+				return err
+			}
+			models, err := s.tenantModels(ctx, tenantSchema)
+			if err != nil {
+				return err
+			}
+			return s.verifyIsolation(ctx, tenantSchema, db, models)
+		})
+
+	if ok {
+		run(SelfCheckRoundTrip,
+			"the tenant role needs USAGE on tenant schemas, and CREATE unless GetMigrationDSN creates the tables",
+			func() error {
+				return s.selfCheckRoundTrip(ctx, tenantSchema)
+			})
+	}
+
+	if created {
+		run(SelfCheckDropSchema,
+			fmt.Sprintf("the master role must own tenant schemas, or be a member of the role that does, to drop them; drop %s by hand", tenantSchema),
+			func() error {
+				if err := s.RemoveTenantDB(tenantSchema); err != nil {
+					return err
+				}
+				return s.master().WithContext(ctx).
+					Exec(fmt.Sprintf("DROP SCHEMA %s CASCADE", quoteIdentifier(tenantSchema))).Error
+			})
+	}
+
+	if failed := report.Failed(); failed != nil {
+		return report, fmt.Errorf("self-check failed at %s: %s", failed.Name, failed.Error)
+	}
+	return report, nil
+}
+
+// selfCheckRoundTrip writes through an unqualified name on the tenant
+// connection and reads the row back from the schema-qualified table
+func (s *TenantStore) selfCheckRoundTrip(ctx context.Context, tenantSchema string) error {
+	db, err := s.tenantDB(ctx, tenantSchema)
+	if err != nil {
+		return err
+	}
+
+	createDB := db
+	if s.config().GetMigrationDSN != nil {
+		migrationDB, err := s.openMigrationDB(tenantSchema)
+		if err != nil {
+			return err
+		}
+		defer closeDB(migrationDB)
+		createDB = migrationDB
+	}
+
+	if err := createDB.WithContext(ctx).
+		Exec(fmt.Sprintf("CREATE TABLE %s (value text NOT NULL)", selfCheckTable)).Error; err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	written := tenantSchema
+	if err := db.WithContext(ctx).
+		Exec(fmt.Sprintf("INSERT INTO %s (value) VALUES (?)", selfCheckTable), written).Error; err != nil {
+		return fmt.Errorf("failed to insert: %w", err)
+	}
+
+	var read string
+	if err := db.WithContext(ctx).
+		Raw(fmt.Sprintf("SELECT value FROM %s.%s", quoteIdentifier(tenantSchema), selfCheckTable)).
+		Scan(&read).Error; err != nil {
+		return fmt.Errorf("failed to select: %w", err)
+	}
+	if read != written {
+		return fmt.Errorf("row written to %s was not found in schema %s", selfCheckTable, tenantSchema)
+	}
+	return nil
+}
+
+// selfCheckSchema returns a random name for the throwaway schema
+func selfCheckSchema() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "mt_selfcheck_" + hex.EncodeToString(b)
+}
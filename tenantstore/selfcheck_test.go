@@ -0,0 +1,135 @@
+package tenantstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSelfCheck(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&TestModel{}}
+	config.MaxTenants = 1
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if _, err := store.GetTenantDB(ctx, "tenant1"); err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	// The throwaway schema is exempt from MaxTenants
+	report, err := store.SelfCheck(ctx)
+	if err != nil {
+		t.Fatalf("Expected self-check to pass: %v", err)
+	}
+
+	want := []string{SelfCheckMaster, SelfCheckPermissions, SelfCheckCreateSchema, SelfCheckGrants, SelfCheckMigrate,
+		SelfCheckIsolation, SelfCheckRoundTrip, SelfCheckDropSchema}
+	if len(report.Steps) != len(want) {
+		t.Fatalf("Expected %d steps, got %+v", len(want), report.Steps)
+	}
+	for i, step := range report.Steps {
+		if step.Name != want[i] || !step.OK {
+			t.Fatalf("Expected step %s to pass, got %+v", want[i], step)
+		}
+	}
+
+	schemas, err := store.ListSchemas(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list schemas: %v", err)
+	}
+	for _, schema := range schemas {
+		if schema == report.Schema {
+			t.Fatalf("Expected schema %s to be dropped", report.Schema)
+		}
+	}
+	store.mu.RLock()
+	_, cached := store.tenantDBs[report.Schema]
+	store.mu.RUnlock()
+	if cached {
+		t.Fatal("Expected the self-check connection to be closed")
+	}
+}
+
+func TestSelfCheckBrokenDSN(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	config := DefaultConfig(dsn)
+	config.Models = []interface{}{&TestModel{}}
+
+	// Deliberately broken builder: search_path is never applied
+	config.GetTenantDSN = func(tenantSchema string) string {
+		return dsn
+	}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	defer store.masterDB.Exec("DROP TABLE IF EXISTS public.test_models")
+
+	report, err := store.SelfCheck(context.Background())
+	if err == nil {
+		t.Fatal("Expected self-check to fail without search_path")
+	}
+
+	failed := report.Failed()
+	if failed == nil || failed.Name != SelfCheckIsolation || failed.Hint == "" {
+		t.Fatalf("Expected the isolation step to fail with a hint, got %+v", failed)
+	}
+	if !strings.Contains(err.Error(), SelfCheckIsolation) {
+		t.Fatalf("Expected error to name the failed step, got %v", err)
+	}
+
+	// The schema is dropped even though a step failed
+	last := report.Steps[len(report.Steps)-1]
+	if last.Name != SelfCheckDropSchema || !last.OK {
+		t.Fatalf("Expected the schema to be dropped, got %+v", last)
+	}
+}
+
+func TestSelfCheckOnStart(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	config := DefaultConfig(dsn)
+	config.SelfCheckOnStart = true
+	config.GetTenantDSN = func(tenantSchema string) string {
+		return dsn
+	}
+
+	if _, err := New(config); err == nil {
+		t.Fatal("Expected New to fail the self-check")
+	}
+
+	config.GetTenantDSN = DefaultConfig(dsn).GetTenantDSN
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Expected New to pass the self-check: %v", err)
+	}
+	store.Close()
+}
+
+func TestSelfCheckReportFailed(t *testing.T) {
+	report := SelfCheckReport{Steps: []SelfCheckStep{
+		{Name: SelfCheckMaster, OK: true},
+		{Name: SelfCheckMigrate, Error: "boom"},
+		{Name: SelfCheckDropSchema, OK: true},
+	}}
+
+	if report.Passed() {
+		t.Fatal("Expected report with a failed step not to pass")
+	}
+	if failed := report.Failed(); failed == nil || failed.Name != SelfCheckMigrate {
+		t.Fatalf("Expected migrate to be the failed step, got %+v", failed)
+	}
+}
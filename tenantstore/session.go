@@ -0,0 +1,46 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// tenantDialector returns the dialector for a tenant DSN. With session
+// settings every new pooled connection applies them before first use, so
+// they survive reconnects.
+func tenantDialector(dsn string, settings map[string]string) (gorm.Dialector, error) {
+	if len(settings) == 0 {
+		return postgres.Open(dsn), nil
+	}
+
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tenant DSN: %w", err)
+	}
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	afterConnect := func(ctx context.Context, conn *pgx.Conn) error {
+		for _, name := range names {
+			// set_config takes the name and value as parameters, so
+			// neither needs quoting
+			if _, err := conn.Exec(ctx, "SELECT set_config($1, $2, false)", name, settings[name]); err != nil {
+				return fmt.Errorf("failed to apply session setting %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+
+	sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionAfterConnect(afterConnect))
+	return postgres.New(postgres.Config{Conn: sqlDB}), nil
+}
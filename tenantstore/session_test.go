@@ -0,0 +1,113 @@
+package tenantstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTenantDialectorRejectsInvalidDSN(t *testing.T) {
+	if _, err := tenantDialector("postgres://[invalid", map[string]string{"TimeZone": "UTC"}); err == nil {
+		t.Fatal("Expected an error for an unparsable DSN")
+	}
+	if _, err := tenantDialector("postgres://[invalid", nil); err != nil {
+		t.Fatalf("Expected DSNs without settings to be parsed on connect, got %v", err)
+	}
+}
+
+func TestSessionSettings(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.SessionSettings = func(tenantSchema string) map[string]string {
+		switch tenantSchema {
+		case "tz_tokyo":
+			return map[string]string{"TimeZone": "Asia/Tokyo", "lc_monetary": "C"}
+		case "tz_utc":
+			return map[string]string{"TimeZone": "UTC"}
+		}
+		return nil
+	}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	offsetHours := func(tenant string) int {
+		t.Helper()
+		db, err := store.GetTenantDB(ctx, tenant)
+		if err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+		var offset int
+		if err := db.Raw("SELECT EXTRACT(timezone_hour FROM now())::int").Scan(&offset).Error; err != nil {
+			t.Fatalf("Failed to query now(): %v", err)
+		}
+		return offset
+	}
+
+	if offset := offsetHours("tz_tokyo"); offset != 9 {
+		t.Fatalf("Expected now() at +9 for tz_tokyo, got %+d", offset)
+	}
+	if offset := offsetHours("tz_utc"); offset != 0 {
+		t.Fatalf("Expected now() at +0 for tz_utc, got %+d", offset)
+	}
+
+	// New pooled connections apply the settings as well
+	db, _ := store.GetTenantDB(ctx, "tz_tokyo")
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxIdleConns(0)
+	if offset := offsetHours("tz_tokyo"); offset != 9 {
+		t.Fatalf("Expected reconnects to keep the time zone, got %+d", offset)
+	}
+
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	for _, stat := range stats {
+		if stat.Schema == "tz_tokyo" && stat.Settings["TimeZone"] != "Asia/Tokyo" {
+			t.Fatalf("Expected the effective settings in stats, got %v", stat.Settings)
+		}
+	}
+}
+
+func TestSessionSettingsQueryStore(t *testing.T) {
+	var store *TenantStore
+	var timeZone string
+	store = newSQLiteRegistryStore(t, "session_lookup", func(config *Config) {
+		config.Shards = map[string]string{"closed": "host=127.0.0.1 port=1 connect_timeout=1"}
+		config.SessionSettings = func(tenantSchema string) map[string]string {
+			tenant, err := store.LookupTenant(context.Background(), tenantSchema)
+			if err != nil {
+				return nil
+			}
+			timeZone = tenant.Settings["timezone"]
+			return map[string]string{"TimeZone": timeZone}
+		}
+	})
+	ctx := context.Background()
+
+	tenant := &Tenant{Schema: "acme", Active: true, Settings: map[string]string{"timezone": "Asia/Tokyo"}, Placement: Placement{Shard: "closed"}}
+	if err := store.RegisterTenant(ctx, tenant); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	// The shard refuses the connection, after the settings were read
+	done := make(chan error, 1)
+	go func() {
+		_, err := store.GetTenantDB(ctx, "acme")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || timeZone != "Asia/Tokyo" {
+			t.Fatalf("Expected the settings read and the dial to fail, got %q and %v", timeZone, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected GetTenantDB to return, it deadlocked")
+	}
+}
@@ -0,0 +1,142 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ErrStoreClosing is returned by GetTenantDB and Borrow once the store
+// drains for shutdown. The middleware responds with 503.
+var ErrStoreClosing error = &statusError{"tenant store is shutting down", http.StatusServiceUnavailable, 0}
+
+// borrowers counts the borrowers registered with Borrow and not yet released
+type borrowers struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // closed once n drops to zero while draining
+}
+
+// Borrow registers a borrower of tenant connections, such as a request, and
+// returns the function that releases it. Drain and ShutdownWithApp wait for
+// every borrower to be released before connections are closed. It fails
+// with ErrStoreClosing once the store drains. release may be called more
+// than once.
+func (s *TenantStore) Borrow() (release func(), err error) {
+	s.borrowers.mu.Lock()
+	defer s.borrowers.mu.Unlock()
+
+	if s.closing.Load() {
+		return nil, ErrStoreClosing
+	}
+	s.borrowers.n++
+
+	var once sync.Once
+	return func() { once.Do(s.release) }, nil
+}
+
+// BorrowTenantDB is GetTenantDB for callers that tell the store when they are
+// done with the connection, such as background jobs; see Borrow. The
+// tenant's pool is leased until release, see Lease.
+func (s *TenantStore) BorrowTenantDB(ctx context.Context, tenantID string) (*gorm.DB, func(), error) {
+	lease, err := s.Lease(ctx, tenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lease.DB, lease.Release, nil
+}
+
+func (s *TenantStore) release() {
+	s.borrowers.mu.Lock()
+	defer s.borrowers.mu.Unlock()
+
+	s.borrowers.n--
+	if s.borrowers.n == 0 && s.borrowers.idle != nil {
+		close(s.borrowers.idle)
+		s.borrowers.idle = nil
+	}
+}
+
+// Borrowers returns the number of borrowers registered with Borrow and not
+// yet released
+func (s *TenantStore) Borrowers() int {
+	s.borrowers.mu.Lock()
+	defer s.borrowers.mu.Unlock()
+	return s.borrowers.n
+}
+
+// Drain makes GetTenantDB, Borrow and BorrowTenantDB fail with
+// ErrStoreClosing and waits until every borrower is released or ctx is done. The
+// store keeps serving the connections already handed out; call Close after
+// it returns.
+func (s *TenantStore) Drain(ctx context.Context) error {
+	s.borrowers.mu.Lock()
+	s.closing.Store(true)
+	if s.borrowers.n == 0 {
+		s.borrowers.mu.Unlock()
+		return nil
+	}
+	if s.borrowers.idle == nil {
+		s.borrowers.idle = make(chan struct{})
+	}
+	idle := s.borrowers.idle
+	s.borrowers.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain %d tenant DB borrowers: %w", s.Borrowers(), ctx.Err())
+	}
+}
+
+// ShutdownWithApp shuts down the app and then the store, in the order that
+// keeps in-flight requests off closed connections. It stops handing out
+// tenant connections, so requests still arriving get 503, shuts the app
+// down, waits for borrowed connections to be released and closes the
+// store's connections, logging each phase. Every phase shares the timeout;
+// once it passes, the app's connections are closed by force and the
+// store's connections closed regardless of borrowers.
+//
+//	<-sig
+//	if err := tenantstore.ShutdownWithApp(context.Background(), app, store, 30*time.Second); err != nil {
+//		log.Println(err)
+//	}
+func ShutdownWithApp(ctx context.Context, app *fiber.App, store *TenantStore, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	log := store.config().Logger
+	var errs []error
+
+	log.Info(ctx, "shutdown: refusing new tenant connections")
+	store.closing.Store(true)
+
+	log.Info(ctx, "shutdown: stopping app")
+	if err := app.ShutdownWithContext(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to shut down app: %w", err))
+	}
+
+	log.Info(ctx, "shutdown: waiting for %d tenant DB borrowers", store.Borrowers())
+	if err := store.Drain(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	log.Info(ctx, "shutdown: closing connections")
+	if err := store.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		log.Error(ctx, "shutdown: %v", err)
+		return err
+	}
+	return nil
+}
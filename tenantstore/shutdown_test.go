@@ -0,0 +1,158 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+)
+
+// newSQLiteTenantStore returns a store serving the tenant acme from an
+// in-memory SQLite database holding one TestModel
+func newSQLiteTenantStore(t *testing.T, name string, configure ...func(*Config)) *TenantStore {
+	t.Helper()
+
+	store := newSQLiteRegistryStore(t, name, configure...)
+	db, err := gorm.Open(sqlite.Open("file:"+name+"_acme?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { closeDB(db) })
+	if err := db.AutoMigrate(&TestModel{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	db.Create(&TestModel{Name: "alpha"})
+
+	store.tenantDBs["acme"] = db
+	return store
+}
+
+func TestShutdownWithAppSlowHandler(t *testing.T) {
+	store := newSQLiteTenantStore(t, "shutdown_slow")
+
+	started := make(chan struct{})
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(middleware.New(middleware.Config{
+		Store:    store,
+		Resolver: middleware.HeaderResolver("X-Tenant-ID"),
+	}))
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+
+		var count int64
+		if err := middleware.GetTenantDB(c).Model(&TestModel{}).Count(&count).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.SendString("done")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go app.Listener(ln)
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	results := make(chan result, 1)
+	go func() {
+		req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/slow", nil)
+		req.Header.Set("X-Tenant-ID", "acme")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		results <- result{status: resp.StatusCode, body: string(body)}
+	}()
+
+	<-started
+	if err := ShutdownWithApp(context.Background(), app, store, 5*time.Second); err != nil {
+		t.Fatalf("Failed to shut down: %v", err)
+	}
+
+	res := <-results
+	if res.err != nil || res.status != fiber.StatusOK || res.body != "done" {
+		t.Fatalf("Expected the slow request to finish with 200, got %d %q (%v)", res.status, res.body, res.err)
+	}
+	if _, err := store.GetTenantDB(context.Background(), "acme"); !errors.Is(err, ErrStoreClosing) {
+		t.Fatalf("Expected ErrStoreClosing after shutdown, got %v", err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	store := newSQLiteTenantStore(t, "shutdown_drain")
+
+	app := fiber.New()
+	app.Use(middleware.New(middleware.Config{
+		Store:    store,
+		Resolver: middleware.HeaderResolver("X-Tenant-ID"),
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	request := func() int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Tenant-ID", "acme")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		return resp.StatusCode
+	}
+	if status := request(); status != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if store.Borrowers() != 0 {
+		t.Fatalf("Expected the request to release its borrow, got %d borrowers", store.Borrowers())
+	}
+
+	db, release, err := store.BorrowTenantDB(context.Background(), "acme")
+	if err != nil || db == nil {
+		t.Fatalf("Failed to borrow: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := store.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected Drain to time out with a borrower, got %v", err)
+	}
+
+	// New arrivals are turned away while draining
+	if status := request(); status != fiber.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503 while draining, got %d", status)
+	}
+	if _, err := store.Borrow(); !errors.Is(err, ErrStoreClosing) {
+		t.Fatalf("Expected ErrStoreClosing, got %v", err)
+	}
+
+	// The borrowed connection keeps working until released
+	var count int64
+	if err := db.Model(&TestModel{}).Count(&count).Error; err != nil || count != 1 {
+		t.Fatalf("Expected the borrowed DB to work, got %d (%v)", count, err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- store.Drain(context.Background()) }()
+	release()
+	release()
+	if err := <-done; err != nil {
+		t.Fatalf("Expected Drain to return once released, got %v", err)
+	}
+}
@@ -0,0 +1,308 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SnapshotSeparator joins a schema and a snapshot ID in the name of the
+// snapshot's schema, as in "acme__snap_20240101T120000". ListSchemas skips
+// schemas containing it, so snapshots are never served or iterated as
+// tenants.
+const SnapshotSeparator = "__snap_"
+
+// snapshotIDLayout formats snapshot IDs from the UTC time they were taken
+const snapshotIDLayout = "20060102T150405"
+
+// EventSchemaRestored is emitted when Restore swaps a snapshot back in, so
+// other instances evict their connections to the replaced schema
+const EventSchemaRestored TenantEventType = "schema.restored"
+
+// ErrSnapshotNotFound is returned for snapshot IDs without a snapshot
+var ErrSnapshotNotFound = errors.New("snapshot does not exist")
+
+// isSnapshotSchema reports whether a schema holds a snapshot
+func isSnapshotSchema(schema string) bool {
+	return strings.Contains(schema, SnapshotSeparator)
+}
+
+// snapshotSchema returns the schema of a tenant schema's snapshot
+func snapshotSchema(tenantSchema, snapshotID string) (string, error) {
+	if _, err := time.Parse(snapshotIDLayout, snapshotID); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrSnapshotNotFound, snapshotID)
+	}
+	name := tenantSchema + SnapshotSeparator + snapshotID
+	if len(name) > MaxSchemaNameLength {
+		return "", fmt.Errorf("snapshot schema %s exceeds %d bytes", name, MaxSchemaNameLength)
+	}
+	return name, nil
+}
+
+// Snapshot copies a tenant schema into a sibling schema named with
+// SnapshotSeparator and returns the snapshot's ID, the UTC time it was
+// taken, for Restore and DropSnapshot. Tables are copied with their rows,
+// indexes, constraints, foreign keys between them and sequence positions;
+// views are not copied, and Restore recreates Config.TenantViews and
+// MaterializedViews. The copy runs in one transaction, so it is consistent,
+// but writes made during it are not in the snapshot.
+func (s *TenantStore) Snapshot(ctx context.Context, tenantSchema string) (string, error) {
+	if err := s.checkSnapshotTarget("snapshot", tenantSchema); err != nil {
+		return "", err
+	}
+
+	snapshotID := time.Now().UTC().Format(snapshotIDLayout)
+	snapshot, err := snapshotSchema(tenantSchema, snapshotID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.schemaTables(ctx, snapshot); err == nil {
+		return "", fmt.Errorf("snapshot %s of %s already exists", snapshotID, tenantSchema)
+	} else if !errors.Is(err, ErrSchemaNotFound) {
+		return "", err
+	}
+
+	tables, err := s.schemaTables(ctx, tenantSchema)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.master().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Read the source and write the copy in one snapshot of the data
+		if err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ").Error; err != nil {
+			return err
+		}
+		return cloneSchema(tx, tenantSchema, snapshot, tables)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot %s: %w", tenantSchema, err)
+	}
+	return snapshotID, nil
+}
+
+// ListSnapshots returns the IDs of a tenant schema's snapshots, oldest first
+func (s *TenantStore) ListSnapshots(ctx context.Context, tenantSchema string) ([]string, error) {
+	var schemas []string
+	err := s.master().WithContext(ctx).Raw(
+		"SELECT schema_name FROM information_schema.schemata WHERE strpos(schema_name, ?) > 0",
+		SnapshotSeparator).Scan(&schemas).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots of %s: %w", tenantSchema, err)
+	}
+
+	snapshots := []string{}
+	prefix := tenantSchema + SnapshotSeparator
+	for _, schema := range schemas {
+		if id, ok := strings.CutPrefix(schema, prefix); ok {
+			if _, err := time.Parse(snapshotIDLayout, id); err == nil {
+				snapshots = append(snapshots, id)
+			}
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// Restore replaces a tenant schema with one of its snapshots. The schema is
+// dropped and the snapshot renamed in its place in one transaction, so the
+// snapshot is used up; take another snapshot first to keep the current
+// state. Cached connections are evicted here and, with
+// Config.Notifications, on other instances, and the schema is migrated to
+// recreate views and columns added since the snapshot.
+func (s *TenantStore) Restore(ctx context.Context, tenantSchema, snapshotID string) error {
+	if err := s.checkSnapshotTarget("restore", tenantSchema); err != nil {
+		return err
+	}
+	snapshot, err := snapshotSchema(tenantSchema, snapshotID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.schemaTables(ctx, snapshot); errors.Is(err, ErrSchemaNotFound) {
+		return fmt.Errorf("%w: %s of %s", ErrSnapshotNotFound, snapshotID, tenantSchema)
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.RemoveTenantDB(tenantSchema); err != nil {
+		return err
+	}
+
+	err = s.master().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", quoteIdentifier(tenantSchema))).Error; err != nil {
+			return err
+		}
+		return tx.Exec(fmt.Sprintf("ALTER SCHEMA %s RENAME TO %s", quoteIdentifier(snapshot), quoteIdentifier(tenantSchema))).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore %s from snapshot %s: %w", tenantSchema, snapshotID, err)
+	}
+
+	// Requests may have reconnected to the replaced schema meanwhile
+	if err := s.RemoveTenantDB(tenantSchema); err != nil {
+		return err
+	}
+	s.emit(ctx, EventSchemaRestored, tenantSchema)
+
+	if err := s.MigrateTenant(context.WithValue(ctx, skipProvisionGuardsKey{}, true), tenantSchema); err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", tenantSchema, err)
+	}
+	return nil
+}
+
+// DropSnapshot removes a snapshot of a tenant schema
+func (s *TenantStore) DropSnapshot(ctx context.Context, tenantSchema, snapshotID string) error {
+	snapshot, err := snapshotSchema(tenantSchema, snapshotID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.schemaTables(ctx, snapshot); errors.Is(err, ErrSchemaNotFound) {
+		return fmt.Errorf("%w: %s of %s", ErrSnapshotNotFound, snapshotID, tenantSchema)
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.master().WithContext(ctx).Exec(fmt.Sprintf("DROP SCHEMA %s CASCADE", quoteIdentifier(snapshot))).Error; err != nil {
+		return fmt.Errorf("failed to drop snapshot %s of %s: %w", snapshotID, tenantSchema, err)
+	}
+	return nil
+}
+
+// checkSnapshotTarget refuses snapshots of schemas that are not tenants
+func (s *TenantStore) checkSnapshotTarget(op, tenantSchema string) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+	if s.isMasterSchema(tenantSchema) || isSnapshotSchema(tenantSchema) {
+		return fmt.Errorf("refusing to %s schema %s", op, tenantSchema)
+	}
+	return s.checkEnvironment(op, tenantSchema)
+}
+
+// ownedSequence is a sequence generating a column's values
+type ownedSequence struct {
+	Sequence string
+	Table    string
+	Column   string
+
+	// Kind is 'a' for serial columns and 'i' for identity columns
+	Kind string
+}
+
+// constraintDef is a constraint of a table with its definition
+type constraintDef struct {
+	Name       string
+	Table      string
+	Definition string
+}
+
+// cloneSchema copies the tables of from into the new schema to within tx:
+// their structure, rows, sequence positions and foreign keys. Serial
+// columns get sequences of their own in to, so the copy does not depend on
+// from.
+func cloneSchema(tx *gorm.DB, from, to string, tables []string) error {
+	source, target := quoteIdentifier(from), quoteIdentifier(to)
+
+	if err := tx.Exec("CREATE SCHEMA " + target).Error; err != nil {
+		return err
+	}
+	for _, table := range tables {
+		t := quoteIdentifier(table)
+		if err := tx.Exec(fmt.Sprintf("CREATE TABLE %s.%s (LIKE %s.%s INCLUDING ALL)", target, t, source, t)).Error; err != nil {
+			return err
+		}
+	}
+
+	var sequences []ownedSequence
+	err := tx.Raw(`
+		SELECT seq.relname AS sequence, tbl.relname AS "table", att.attname AS "column", dep.deptype AS kind
+		FROM pg_depend dep
+		JOIN pg_class seq ON seq.oid = dep.objid AND seq.relkind = 'S'
+		JOIN pg_namespace ns ON ns.oid = seq.relnamespace
+		JOIN pg_class tbl ON tbl.oid = dep.refobjid
+		JOIN pg_attribute att ON att.attrelid = tbl.oid AND att.attnum = dep.refobjsubid
+		WHERE ns.nspname = ? AND dep.classid = 'pg_class'::regclass
+		AND dep.refclassid = 'pg_class'::regclass AND dep.deptype IN ('a', 'i')`, from).Scan(&sequences).Error
+	if err != nil {
+		return fmt.Errorf("failed to list sequences: %w", err)
+	}
+
+	for _, seq := range sequences {
+		table := target + "." + quoteIdentifier(seq.Table)
+		if seq.Kind == "a" {
+			// LIKE copied the default, which still draws from the source
+			sequence := target + "." + quoteIdentifier(seq.Sequence)
+			statements := []string{
+				"CREATE SEQUENCE " + sequence,
+				fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT nextval(%s::regclass)", table, quoteIdentifier(seq.Column), quoteLiteral(sequence)),
+				fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s", sequence, table, quoteIdentifier(seq.Column)),
+			}
+			for _, statement := range statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		var position struct {
+			LastValue int64
+			IsCalled  bool
+		}
+		if err := tx.Raw(fmt.Sprintf("SELECT last_value, is_called FROM %s.%s", source, quoteIdentifier(seq.Sequence))).Scan(&position).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("SELECT setval(pg_get_serial_sequence(?, ?), ?, ?)", table, seq.Column, position.LastValue, position.IsCalled).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, table := range tables {
+		var columns []string
+		err := tx.Raw(`
+			SELECT column_name FROM information_schema.columns
+			WHERE table_schema = ? AND table_name = ? AND is_generated = 'NEVER'
+			ORDER BY ordinal_position`, from, table).Scan(&columns).Error
+		if err != nil {
+			return err
+		}
+		for i, column := range columns {
+			columns[i] = quoteIdentifier(column)
+		}
+
+		list := strings.Join(columns, ", ")
+		t := quoteIdentifier(table)
+		if err := tx.Exec(fmt.Sprintf("INSERT INTO %s.%s (%s) OVERRIDING SYSTEM VALUE SELECT %s FROM %s.%s", target, t, list, list, source, t)).Error; err != nil {
+			return fmt.Errorf("failed to copy %s: %w", table, err)
+		}
+	}
+
+	// Definitions leave tables of the search path unqualified, so foreign
+	// keys within the schema point into the copy
+	if err := tx.Exec("SET LOCAL search_path TO " + source).Error; err != nil {
+		return err
+	}
+	var foreignKeys []constraintDef
+	err = tx.Raw(`
+		SELECT con.conname AS name, tbl.relname AS "table", pg_get_constraintdef(con.oid) AS definition
+		FROM pg_constraint con
+		JOIN pg_class tbl ON tbl.oid = con.conrelid
+		JOIN pg_namespace ns ON ns.oid = tbl.relnamespace
+		WHERE ns.nspname = ? AND con.contype = 'f'`, from).Scan(&foreignKeys).Error
+	if err != nil {
+		return fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+	if err := tx.Exec("SET LOCAL search_path TO " + target).Error; err != nil {
+		return err
+	}
+	for _, fk := range foreignKeys {
+		statement := fmt.Sprintf("ALTER TABLE %s.%s ADD CONSTRAINT %s %s", target, quoteIdentifier(fk.Table), quoteIdentifier(fk.Name), fk.Definition)
+		if err := tx.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to copy foreign key %s: %w", fk.Name, err)
+		}
+	}
+	return tx.Exec("SET LOCAL search_path TO DEFAULT").Error
+}
@@ -0,0 +1,116 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotSchema(t *testing.T) {
+	schema, err := snapshotSchema("acme", "20240101T120000")
+	if err != nil || schema != "acme__snap_20240101T120000" {
+		t.Fatalf("Expected acme__snap_20240101T120000, got %s (%v)", schema, err)
+	}
+	if !isSnapshotSchema(schema) || isSnapshotSchema("acme") {
+		t.Fatal("Expected only the snapshot schema to be recognized")
+	}
+
+	for _, id := range []string{"", "latest", "20240101", "x; DROP SCHEMA acme"} {
+		if _, err := snapshotSchema("acme", id); !errors.Is(err, ErrSnapshotNotFound) {
+			t.Fatalf("Expected ErrSnapshotNotFound for %q, got %v", id, err)
+		}
+	}
+
+	if _, err := snapshotSchema(strings.Repeat("a", 50), "20240101T120000"); err == nil {
+		t.Fatal("Expected an error for a snapshot name over the identifier limit")
+	}
+}
+
+func TestSnapshotRefusesMasterSchemas(t *testing.T) {
+	store := withConfig(&TenantStore{}, DefaultConfig(""))
+	ctx := context.Background()
+
+	for _, schema := range []string{"", "public", "acme__snap_20240101T120000"} {
+		if _, err := store.Snapshot(ctx, schema); err == nil {
+			t.Fatalf("Expected a snapshot of %q to be refused", schema)
+		}
+		if err := store.Restore(ctx, schema, "20240101T120000"); err == nil {
+			t.Fatalf("Expected a restore of %q to be refused", schema)
+		}
+	}
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	ctx := context.Background()
+
+	config := DefaultConfig(dsn)
+	config.Models = []interface{}{&TestModel{}}
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	defer store.DropTenant(ctx, "snap_tenant", DropOptions{Cascade: true})
+
+	db, err := store.GetTenantDB(ctx, "snap_tenant")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	db.Create(&TestModel{Name: "before"})
+
+	snapshotID, err := store.Snapshot(ctx, "snap_tenant")
+	if err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+	defer store.DropSnapshot(ctx, "snap_tenant", snapshotID)
+
+	snapshots, err := store.ListSnapshots(ctx, "snap_tenant")
+	if err != nil || len(snapshots) != 1 || snapshots[0] != snapshotID {
+		t.Fatalf("Expected snapshot %s, got %v (%v)", snapshotID, snapshots, err)
+	}
+
+	// Snapshots are not tenants
+	schemas, err := store.ListSchemas(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list schemas: %v", err)
+	}
+	for _, schema := range schemas {
+		if isSnapshotSchema(schema) {
+			t.Fatalf("Expected ListSchemas to skip snapshots, got %s", schema)
+		}
+	}
+
+	db.Create(&TestModel{Name: "after"})
+	db.Where("name = ?", "before").Delete(&TestModel{})
+
+	if err := store.Restore(ctx, "snap_tenant", snapshotID); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+
+	db, err = store.GetTenantDB(ctx, "snap_tenant")
+	if err != nil {
+		t.Fatalf("Failed to get restored tenant DB: %v", err)
+	}
+	var rows []TestModel
+	if err := db.Find(&rows).Error; err != nil || len(rows) != 1 || rows[0].Name != "before" {
+		t.Fatalf("Expected only the snapshotted row, got %+v (%v)", rows, err)
+	}
+
+	// The copied sequence continues after the snapshotted rows
+	row := TestModel{Name: "next"}
+	if err := db.Create(&row).Error; err != nil || row.ID <= rows[0].ID {
+		t.Fatalf("Expected a new ID after %d, got %d (%v)", rows[0].ID, row.ID, err)
+	}
+
+	// Restoring uses the snapshot up
+	if snapshots, _ := store.ListSnapshots(ctx, "snap_tenant"); len(snapshots) != 0 {
+		t.Fatalf("Expected no snapshots left, got %v", snapshots)
+	}
+	if err := store.Restore(ctx, "snap_tenant", snapshotID); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Fatalf("Expected ErrSnapshotNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotStarted is returned by Ready while Config.CriticalTenants have not
+// been warmed by Start
+var ErrNotStarted = errors.New("critical tenants are not warm yet")
+
+// TenantStartup is the outcome of warming one critical tenant
+type TenantStartup struct {
+	Tenant   string        `json:"tenant"`
+	Schema   string        `json:"schema,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Err      error         `json:"-"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// StartupReport describes a Start: every critical tenant, in config order,
+// with how long it took to warm and why it failed
+type StartupReport struct {
+	StartedAt time.Time       `json:"started_at"`
+	Duration  time.Duration   `json:"duration"`
+	Tenants   []TenantStartup `json:"tenants"`
+}
+
+// Succeeded returns the tenants that were warmed
+func (r *StartupReport) Succeeded() []TenantStartup {
+	var tenants []TenantStartup
+	for _, tenant := range r.Tenants {
+		if tenant.Err == nil {
+			tenants = append(tenants, tenant)
+		}
+	}
+	return tenants
+}
+
+// Failed returns the tenants that could not be warmed
+func (r *StartupReport) Failed() []TenantStartup {
+	var tenants []TenantStartup
+	for _, tenant := range r.Tenants {
+		if tenant.Err != nil {
+			tenants = append(tenants, tenant)
+		}
+	}
+	return tenants
+}
+
+// StartupError is returned by Start and New when critical tenants failed to
+// warm. errors.Is and errors.As see the error of every failed tenant.
+type StartupError struct {
+	Report *StartupReport
+}
+
+func (e *StartupError) Error() string {
+	failed := e.Report.Failed()
+	reasons := make([]string, len(failed))
+	for i, tenant := range failed {
+		reasons[i] = tenant.Tenant + ": " + tenant.Error
+	}
+	return fmt.Sprintf("failed to warm %d of %d critical tenants: %s", len(failed), len(e.Report.Tenants), strings.Join(reasons, "; "))
+}
+
+func (e *StartupError) Unwrap() []error {
+	var errs []error
+	for _, tenant := range e.Report.Failed() {
+		errs = append(errs, tenant.Err)
+	}
+	return errs
+}
+
+// Start warms Config.CriticalTenants concurrently: each must map to a
+// schema that exists, and its connection is opened and pinged. It never
+// creates schemas. The report lists every critical tenant; if any failed,
+// the error is a *StartupError carrying the report and Ready keeps failing
+// until a later Start succeeds. New calls Start unless Config.DeferStart
+// is set, failing when it fails. Pinned tenants are warmed in the
+// background either way.
+func (s *TenantStore) Start(ctx context.Context) (*StartupReport, error) {
+	if s.closing.Load() {
+		return nil, ErrStoreClosing
+	}
+
+	critical := s.config().CriticalTenants
+	report := &StartupReport{StartedAt: time.Now(), Tenants: make([]TenantStartup, len(critical))}
+
+	var wg sync.WaitGroup
+	for i, tenantID := range critical {
+		wg.Add(1)
+		go func(i int, tenantID string) {
+			defer wg.Done()
+
+			started := time.Now()
+			result := TenantStartup{Tenant: tenantID}
+			result.Schema, result.Err = s.SchemaName(tenantID)
+			if result.Err == nil {
+				result.Err = s.warmTenant(ctx, result.Schema)
+			}
+			if result.Err != nil {
+				result.Error = result.Err.Error()
+			}
+			result.Duration = time.Since(started)
+			report.Tenants[i] = result
+		}(i, tenantID)
+	}
+	wg.Wait()
+	report.Duration = time.Since(report.StartedAt)
+
+	s.startup.Store(report)
+	if len(report.Failed()) > 0 {
+		return report, &StartupError{Report: report}
+	}
+	return report, nil
+}
+
+// StartupReport returns the report of the last Start, or nil before it
+func (s *TenantStore) StartupReport() *StartupReport {
+	return s.startup.Load()
+}
+
+// Ready returns nil once the last Start warmed every critical tenant, so a
+// readiness probe stays red until then. Stores without critical tenants
+// are always ready. middleware.Probes checks it on the readiness path.
+func (s *TenantStore) Ready(ctx context.Context) error {
+	if len(s.config().CriticalTenants) == 0 {
+		return nil
+	}
+	report := s.startup.Load()
+	if report == nil {
+		return ErrNotStarted
+	}
+	if len(report.Failed()) > 0 {
+		return &StartupError{Report: report}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+)
+
+func TestStartCriticalTenantFails(t *testing.T) {
+	store := newSQLiteTenantStore(t, "startup_critical", func(config *Config) {
+		config.CriticalTenants = []string{"acme", "Bad Schema!"}
+	})
+	ctx := context.Background()
+
+	if err := store.Ready(ctx); !errors.Is(err, ErrNotStarted) {
+		t.Fatalf("Expected ErrNotStarted before Start, got %v", err)
+	}
+
+	report, err := store.Start(ctx)
+	var startupErr *StartupError
+	if !errors.As(err, &startupErr) || startupErr.Report != report {
+		t.Fatalf("Expected a StartupError with the report, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "Bad Schema!") {
+		t.Fatalf("Expected the error to name the failed tenant, got %v", err)
+	}
+	if ok := report.Succeeded(); len(ok) != 1 || ok[0].Tenant != "acme" || ok[0].Schema != "acme" {
+		t.Fatalf("Expected acme warmed, got %+v", ok)
+	}
+	if failed := report.Failed(); len(failed) != 1 || failed[0].Tenant != "Bad Schema!" || failed[0].Error == "" {
+		t.Fatalf("Expected the bad tenant failed with a reason, got %+v", failed)
+	}
+	if store.StartupReport() != report {
+		t.Fatalf("Expected the report to be kept")
+	}
+
+	app := fiber.New()
+	app.Use(middleware.Probes(store))
+	resp, err := app.Test(httptest.NewRequest("GET", "/readyz", nil))
+	if err != nil || resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Fatalf("Expected not ready, got %v (%v)", resp.StatusCode, err)
+	}
+
+	// A later Start with the tenant fixed makes the store ready
+	reconfigure(store, func(config *Config) {
+		config.CriticalTenants = []string{"acme"}
+	})
+	if _, err := store.Start(ctx); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	if err := store.Ready(ctx); err != nil {
+		t.Fatalf("Expected ready, got %v", err)
+	}
+	resp, err = app.Test(httptest.NewRequest("GET", "/readyz", nil))
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected ready, got %v (%v)", resp.StatusCode, err)
+	}
+}
+
+func TestNewFailsOnCriticalTenant(t *testing.T) {
+	t.Parallel()
+
+	dsn := getTestDSN(t)
+	config := DefaultConfig(dsn)
+	config.CriticalTenants = []string{"Bad Schema!"}
+
+	store, err := New(config)
+	var startupErr *StartupError
+	if store != nil || !errors.As(err, &startupErr) {
+		t.Fatalf("Expected New to fail with a StartupError, got %v", err)
+	}
+	if failed := startupErr.Report.Failed(); len(failed) != 1 {
+		t.Fatalf("Expected one failed tenant, got %+v", failed)
+	}
+}
@@ -29,23 +29,131 @@ package tenantstore
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/time/rate"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantcache"
 )
 
 // TenantStore manages database connections for multiple tenants with schema isolation
 type TenantStore struct {
-	masterDB        *gorm.DB
-	tenantDBs       map[string]*gorm.DB
-	mu              sync.RWMutex
-	config          *Config
-	healthCheckDone map[string]bool
-	healthMu        sync.Mutex
+	masterDB  *gorm.DB
+	tenantDBs map[string]*gorm.DB
+	mu        sync.RWMutex
+
+	// cfg is the current config, replaced as a whole by UpdateConfig and
+	// never modified once stored; read it with config()
+	cfg      atomic.Pointer[Config]
+	configMu sync.Mutex
+
+	// health holds the outcome of the health checker's last ping of each
+	// cached tenant connection; the pointers are replaced under mu and
+	// updated atomically
+	health map[string]*tenantHealth
+
+	// registry caches tenant registry lookups
+	registry *registryCache
+
+	// listener receives other instances' tenant events, nil unless
+	// Config.Notifications is set
+	listener *listener
+
+	// watchdog looks for long transactions, nil unless
+	// Config.MaxTransactionAge is set
+	watchdog *watchdog
+
+	// healthChecker pings cached tenant connections, nil unless
+	// Config.HealthCheckInterval is set
+	healthChecker *healthChecker
+
+	// janitor closes idle tenant pools, nil unless Config.TenantIdleTimeout
+	// is set
+	janitor *janitor
+
+	// stopped is set by Close, under configMu, once the background loops
+	// above are stopped
+	stopped bool
+
+	// pinned tenants are exempt from eviction and kept warm by keeper,
+	// which runs while any tenant was pinned
+	pinned map[string]bool
+	keeper *keeper
+
+	// leases counts the leases held on each schema; leased pools are
+	// exempt from eviction like pinned ones
+	leases map[string]int
+
+	// pooledDB holds the shared tables of tenants converted with
+	// ConvertToPooled, nil until Config.PooledDB is set or a tenant is
+	// converted
+	pooledDB atomic.Pointer[gorm.DB]
+
+	// startup is the report of the last Start
+	startup atomic.Pointer[StartupReport]
+
+	// refresher refreshes Config.MaterializedViews, nil unless any has
+	// RefreshEvery set
+	refresher *refresher
+
+	// pendingMigrations holds schemas whose inline migration exceeded
+	// Config.MaxInlineMigrationDuration
+	pendingMigrations map[string]bool
+
+	// warmMigrations holds the migration hashes of schemas imported with
+	// ImportWarmState, until their first connection
+	warmMigrations map[string]string
+
+	// lastUsed holds the UnixNano time each schema's cached connection was
+	// last handed out, as *atomic.Int64, for ExportWarmState,
+	// MaxCachedTenants and the janitor; it is updated under mu
+	lastUsed sync.Map
+
+	// closing is set by Drain; borrowers counts connections Drain waits for
+	closing   atomic.Bool
+	borrowers borrowers
+
+	// provisionLimiter throttles schema creation, nil if unlimited
+	provisionLimiter atomic.Pointer[rate.Limiter]
+
+	// retired holds the pools replaced by RotateCredentials or evicted, with
+	// the timers closing them after RotationGracePeriod; Close closes the
+	// rest
+	retired   map[*sql.DB]*time.Timer
+	retiredMu sync.Mutex
+
+	// dsnVersion is bumped by RotateCredentials; tenant connections dialed
+	// with an older version are re-dialed lazily
+	dsnVersion     uint64
+	tenantVersions map[string]uint64
+
+	// sessionSettings holds the Config.SessionSettings applied to each
+	// cached tenant connection
+	sessionSettings map[string]map[string]string
+
+	// poolProfiles holds the Placement.PoolProfile of cached tenant
+	// connections pooled with a profile instead of the store's limits
+	poolProfiles map[string]string
+
+	// queryScopes holds the *queryScope every statement of a tenant runs
+	// under, by schema, replaced by CancelTenantQueries
+	queryScopes sync.Map
+
+	// readRetries counts the reads retried under Config.RetryReads, by
+	// schema, as *atomic.Int64
+	readRetries sync.Map
+
+	// aliases maps tenant IDs to the schemas they were moved to, starting
+	// from Config.SchemaAliases; replaced as a whole by QuarantineTenant
+	aliases atomic.Pointer[map[string]string]
 }
 
 // Config holds configuration for tenant store
@@ -57,21 +165,389 @@ type Config struct {
 	ConnectionTimeout   time.Duration
 	HealthCheckInterval time.Duration
 	Logger              logger.Interface
+
+	// MaxOpenConns, MaxIdleConns, ConnMaxLifetime and ConnMaxIdleTime limit
+	// each tenant connection pool, like the database/sql setters of the same
+	// names. Zero keeps the database/sql default, which lets a busy tenant
+	// open connections until the server's max_connections; DefaultConfig
+	// sets the Default pool limits.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// MasterPool limits the master connection pool like the fields above.
+	// Zero keeps the database/sql default.
+	MasterPool PoolProfile
+
+	// GetMigrationDSN optionally returns a DSN for a privileged role used only
+	// for schema creation and AutoMigrate. Like GetTenantDSN it must set the
+	// search_path to the tenant schema. When set, runtime tenant connections
+	// from GetTenantDSN never need DDL privileges.
+	GetMigrationDSN func(tenantSchema string) string
+
+	// DSNProvider optionally supplies the master DSN, for example from a
+	// secrets manager with rotating credentials. It is consulted for every
+	// new connection and takes precedence over MasterDSN; tenant DSNs are
+	// then derived from the provided DSN instead of GetTenantDSN.
+	DSNProvider func(ctx context.Context) (string, error)
+
+	// RotationGracePeriod is how long connections replaced by
+	// RotateCredentials, or evicted, keep serving in-flight requests before
+	// being closed. Close closes them at once.
+	RotationGracePeriod time.Duration
+
+	// StrictIsolation verifies every new tenant connection with
+	// VerifyIsolation and refuses to cache connections that fail
+	StrictIsolation bool
+
+	// EnableRegistry keeps a record per tenant in the mt_tenants table of
+	// the master database, created by New
+	EnableRegistry bool
+
+	// RegistryCacheTTL is how long registry lookups, including misses, are
+	// cached. Changes made through this store invalidate the cache at once;
+	// changes made elsewhere take effect after the TTL or InvalidateTenant,
+	// or at once with Notifications.
+	RegistryCacheTTL time.Duration
+
+	// Cache holds registry lookups, such as a Redis cache from the
+	// contrib/redistenantcache module shared by every replica, so a change
+	// made on one replica is seen by all at once (defaults to an in-memory
+	// cache per store). Keys are prefixed with "mt:registry:".
+	Cache tenantcache.Cache
+
+	// PooledDB holds the shared tables of pooled tenants, converted from
+	// their own schema with ConvertToPooled. GetTenantDB returns sessions of
+	// it scoped to the tenant for tenants whose registry mode is ModePooled.
+	// Requires EnableRegistry.
+	PooledDB *gorm.DB
+
+	// PooledTenantColumn is the column of shared tables holding the tenant
+	// (defaults to DefaultPooledTenantColumn)
+	PooledTenantColumn string
+
+	// Shards name the databases tenants can be placed on with MoveTenant,
+	// by their master DSN. Placed tenants connect to their shard with the
+	// tenant search_path. Requires EnableRegistry.
+	Shards map[string]string
+
+	// ResolveDSN returns the DSN a Placement.DSNRef refers to, such as a
+	// dedicated server's DSN kept in a secrets manager. It is called for
+	// every new connection of the tenant, before the store is locked, so it
+	// may use the store.
+	ResolveDSN func(ctx context.Context, ref string) (string, error)
+
+	// PoolProfiles name pool limits used instead of MaxOpenConns and the
+	// other pool fields for tenants placed with them, e.g. a larger pool
+	// for a tenant on a dedicated server
+	PoolProfiles map[string]PoolProfile
+
+	// PostCreateGrants are GRANT, REVOKE or ALTER DEFAULT PRIVILEGES
+	// statements run on every tenant schema right after CREATE SCHEMA and
+	// before migration, by the role creating schemas. They are
+	// text/template; {{.Schema}} expands to the quoted schema name:
+	//
+	//	REVOKE ALL ON SCHEMA {{.Schema}} FROM PUBLIC
+	//	GRANT USAGE ON SCHEMA {{.Schema}} TO app
+	//	ALTER DEFAULT PRIVILEGES IN SCHEMA {{.Schema}} GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO app
+	//
+	// Provisioning fails if a statement fails; call ApplyGrants to backfill
+	// existing tenants.
+	PostCreateGrants []string
+
+	// TenantViews are created in every tenant schema after migration.
+	// Provisioning fails if a view cannot be created; call RefreshViews after
+	// changing a definition.
+	TenantViews []ViewDefinition
+
+	// MaterializedViews are created in every tenant schema after
+	// TenantViews. Views with RefreshEvery set are refreshed by a background
+	// refresher; call RefreshNow to refresh one at once.
+	MaterializedViews []MatViewDef
+
+	// InlineMigration lets GetTenantDB run AutoMigrate on existing schemas
+	// when it first connects to them, inside the request. When false, a
+	// schema missing tables, columns or indexes of the models fails with
+	// ErrMigrationPending until MigrateTenant or MigrateAll migrates it out
+	// of band; new schemas are still migrated. DefaultConfig enables it.
+	InlineMigration bool
+
+	// MaxInlineMigrationDuration bounds inline migrations. A schema whose
+	// migration takes longer fails with ErrMigrationPending, and keeps
+	// failing without another attempt until MigrateTenant or MigrateAll
+	// migrates it. Zero means no limit.
+	MaxInlineMigrationDuration time.Duration
+
+	// PrepareStmt enables GORM's prepared statement cache on the master
+	// connection and, unless TenantPrepareStmt overrides it, on tenant
+	// connections. Every cached statement is prepared on the server once per
+	// pooled connection, so with thousands of tenant pools PrepareStmtOff
+	// keeps server memory bounded. PrepareStmtInherit keeps GORM's default.
+	PrepareStmt PrepareStmtMode
+
+	// TenantPrepareStmt optionally chooses the mode per tenant connection;
+	// PrepareStmtInherit falls back to PrepareStmt
+	TenantPrepareStmt func(tenantSchema string) PrepareStmtMode
+
+	// SchemaNamer maps the tenant IDs passed to GetTenantDB to schema
+	// names. Defaults to DefaultSchemaNamer, which shortens IDs longer than
+	// PostgreSQL's 63-byte limit deterministically. Methods taking a schema,
+	// such as MigrateTenant or DropTenant, expect the mapped name.
+	SchemaNamer SchemaNamer
+
+	// MaxTenants caps the number of tenant schemas. Creating a schema beyond
+	// it fails with ErrTenantQuotaExceeded; existing schemas keep working.
+	// Zero means unlimited.
+	MaxTenants int
+
+	// ProvisionRateLimit throttles schema creation across the process, in
+	// schemas per second with bursts of ProvisionBurst (default 1). Creations
+	// over the limit fail with ErrProvisionRateLimited. Zero means unlimited.
+	ProvisionRateLimit rate.Limit
+	ProvisionBurst     int
+
+	// ModelGroups are migrated after Models, group by group in order, for
+	// models that need others to exist first, such as a model whose
+	// MigrationHook creates a view over earlier tables
+	ModelGroups [][]interface{}
+
+	// ModelsFor returns the models of a tenant in place of Models, so tables
+	// of a plan's features only exist in the schemas of tenants on that plan.
+	// It is asked whenever a tenant is connected or migrated; after a plan
+	// change, MigrateTenant creates the tables the tenant gained. Tables of
+	// a lost plan are left in place. It may call the store, e.g.
+	// LookupTenant for the tenant's plan.
+	ModelsFor func(ctx context.Context, tenantSchema string) ([]interface{}, error)
+
+	// SaturationWait is how long a new tenant connection waits for a free
+	// slot when PostgreSQL reports too many connections (SQLSTATE 53300).
+	// Idle tenant pools are evicted on saturation either way; once the wait
+	// is over the dial fails with ErrDatabaseSaturated. Zero fails at once.
+	SaturationWait time.Duration
+
+	// MaxCachedTenants limits how many tenant connection pools are cached.
+	// Connecting a tenant beyond it evicts the least recently used pool; its
+	// idle connections close at once and the rest once released, at the
+	// latest after RotationGracePeriod, and the tenant is re-dialed on its
+	// next use. Pinned and leased tenants and pools with a query running are
+	// never evicted, so the cache may exceed the limit while they hold it.
+	// Zero means no limit.
+	MaxCachedTenants int
+
+	// TenantIdleTimeout closes the connections of tenants not used for that
+	// long, checked by a janitor every JanitorInterval (defaults to half the
+	// timeout), so a tenant that signed in once does not keep its pool until
+	// the process restarts. The same tenants as with MaxCachedTenants are
+	// kept. Zero keeps connections until Close.
+	TenantIdleTimeout time.Duration
+	JanitorInterval   time.Duration
+
+	// RetryReads retries reads on tenant connections that fail with a
+	// transient error, such as a serialization failure or a connection
+	// reset during a failover. Off unless MaxAttempts is above one;
+	// ReadRetries counts the retries.
+	RetryReads RetryPolicy
+
+	// LockTimeout bounds how long WithTenantLock waits for a lock held
+	// elsewhere before failing with ErrLockTimeout. Zero waits as long as
+	// the context allows.
+	LockTimeout time.Duration
+
+	// PurgeBatchSize is the number of rows PurgeSoftDeleted deletes per
+	// statement (defaults to DefaultPurgeBatchSize), and PurgeBatchPause
+	// the pause between batches
+	PurgeBatchSize  int
+	PurgeBatchPause time.Duration
+
+	// IDStrategy configures primary key generation in every tenant schema
+	// after AutoMigrate. Defaults to Serial; see OffsetSerial and UUIDDefault
+	// for IDs that stay unique across tenants.
+	IDStrategy IDStrategy
+
+	// SearchPathFor optionally returns the search_path of a tenant's
+	// connections, such as a shared vertical schema of lookup tables between
+	// the tenant schema and public, typically chosen from its registry
+	// record. The tenant schema must come first. It applies to the DSNs of
+	// DefaultConfig and DSNProvider, and to the SET LOCAL of the
+	// middleware's TransactionalRequests. Defaults to DefaultSearchPath.
+	// New connections ask it before the store locks, so it may query the
+	// store.
+	SearchPathFor func(tenantSchema string) []string
+
+	// MasterSchemaNames are schemas holding shared data, such as a metadata
+	// schema named master, that are never served as tenants. public and
+	// PostgreSQL's own schemas are always refused. Connecting to one fails
+	// with ErrMasterSchema; move a tenant already living in one with
+	// QuarantineTenant.
+	MasterSchemaNames []string
+
+	// SchemaAliases maps tenant IDs to the schemas they are served from,
+	// ahead of SchemaNamer, such as tenants moved by QuarantineTenant
+	SchemaAliases map[string]string
+
+	// Environment lets stores for several environments, such as staging
+	// and production, share one database: SchemaName composes each tenant's
+	// schema with it through EnvironmentComposer (defaults to a
+	// SuffixComposer, "acme__staging"), ListSchemas and Stats only see the
+	// environment's schemas, and DropTenant and TruncateTenant refuse the
+	// others. Tenant IDs handed to the middleware and handlers are not
+	// affected. Empty is the default environment, whose schemas keep their
+	// plain names and which sees every schema.
+	Environment         string
+	EnvironmentComposer EnvironmentComposer
+
+	// PinnedTenants are schemas whose connections are exempt from idle
+	// eviction and kept warm by a periodic ping every KeepWarmInterval
+	// (defaults to DefaultKeepWarmInterval), for latency-sensitive tenants.
+	// PinTenant and UnpinTenant change pins at runtime.
+	PinnedTenants    []string
+	KeepWarmInterval time.Duration
+
+	// CriticalTenants are tenant IDs that must be served before the process
+	// takes traffic. New warms them with Start and fails if any cannot be
+	// warmed, unless DeferStart is set, in which case the application calls
+	// Start itself. Ready, checked by middleware.Probes, fails until they
+	// are warm.
+	CriticalTenants []string
+	DeferStart      bool
+
+	// WarmStateTenants is how many of the most recently used tenants
+	// ImportWarmState dials when asked to warm them (defaults to
+	// DefaultWarmStateTenants)
+	WarmStateTenants int
+
+	// SessionSettings optionally returns run-time parameters for a tenant,
+	// such as TimeZone or lc_monetary, typically from its registry record.
+	// They are applied with set_config on every new connection of the
+	// tenant's pool, including reconnects, and read again when the pool is
+	// re-dialed. Empty values are skipped. Stats reports them. It is called
+	// before the store locks for the new connection, so it may query the
+	// store.
+	SessionSettings func(tenantSchema string) map[string]string
+
+	// Notifications publishes tenant events with NOTIFY on NotifyChannel
+	// and listens on a dedicated connection for those of other store
+	// instances, which invalidate the registry cache at once instead of
+	// after RegistryCacheTTL. The listener reconnects with backoff; its state
+	// is reported by Health.
+	Notifications bool
+
+	// NotifyChannel defaults to DefaultNotifyChannel
+	NotifyChannel string
+
+	// EvictOnNotify also closes the cached connection of tenants changed by
+	// other instances. Connections to dropped schemas are always closed.
+	EvictOnNotify bool
+
+	// MaxTransactionAge turns on a watchdog that looks for transactions of
+	// this store's tenant sessions open for longer, such as sessions stuck
+	// idle in transaction while holding locks. Findings are logged, passed
+	// to OnLongTransaction and reported by Health and Stats. Tenant sessions
+	// are then identified by an application_name of ApplicationName, a
+	// colon and the schema.
+	MaxTransactionAge time.Duration
+
+	// WatchdogInterval is how often the watchdog checks (defaults to half
+	// of MaxTransactionAge)
+	WatchdogInterval time.Duration
+
+	// TerminateLongTransactions makes the watchdog end the sessions it
+	// finds with pg_terminate_backend, rolling back their transactions
+	TerminateLongTransactions bool
+
+	// OnLongTransaction is called for every long transaction the watchdog
+	// finds, on every check until it ends
+	OnLongTransaction func(ctx context.Context, tx LongTransaction)
+
+	// ApplicationName prefixes the application_name of tenant sessions when
+	// the watchdog is on. Defaults to DefaultApplicationName.
+	ApplicationName string
+
+	// OnTenantEvent is called after lifecycle changes made through the
+	// store, such as registering, deactivating or dropping a tenant. It runs
+	// synchronously, so slow work belongs in a goroutine.
+	OnTenantEvent func(ctx context.Context, event TenantEvent)
+
+	// OnConfigChange is called for every field UpdateConfig changes, after
+	// the new config is in effect
+	OnConfigChange func(change ConfigChange)
+
+	// SearchIndexes are full-text search columns and GIN indexes added to
+	// every tenant schema after AutoMigrate. Creation is idempotent.
+	SearchIndexes []SearchIndexDef
+
+	// CrossSchemaFKs are foreign keys from tenant tables to shared tables,
+	// added with schema-qualified targets after AutoMigrate. Other
+	// constraints on the same columns are dropped; see VerifyForeignKeys.
+	CrossSchemaFKs []FKDef
+
+	// SelfCheckOnStart makes New run SelfCheck and fail with its error, so
+	// a misconfigured deployment stops at startup instead of failing
+	// requests later
+	SelfCheckOnStart bool
+
+	// FailpointInjector is for tests only. It is called with the operation
+	// (FailpointGetTenantDB, FailpointEnsureSchema, FailpointMigrate or
+	// FailpointQuery) and schema at the start of each, and a non-nil error
+	// fails the operation.
+	// Never set it in production; builds with the nofailpoints tag ignore
+	// it and New rejects configs that set it.
+	FailpointInjector func(op string, schema string) error
+
+	// current is the config the GetTenantDSN of DefaultConfig reads: this
+	// one, then the copies UpdateConfig swaps in
+	current *atomic.Pointer[Config]
 }
 
+// Pool limits of DefaultConfig. A pool per tenant adds up, so each tenant
+// gets a few connections and the master, shared by every tenant's registry
+// lookups and provisioning, some more.
+const (
+	DefaultMaxOpenConns       = 5
+	DefaultMaxIdleConns       = 2
+	DefaultConnMaxLifetime    = 30 * time.Minute
+	DefaultConnMaxIdleTime    = 5 * time.Minute
+	DefaultMasterMaxOpenConns = 20
+)
+
 // DefaultConfig returns a config with sensible defaults
 func DefaultConfig(masterDSN string) *Config {
-	return &Config{
-		MasterDSN: masterDSN,
-		GetTenantDSN: func(tenantSchema string) string {
-			return masterDSN + fmt.Sprintf(" search_path=%s,public", tenantSchema)
-		},
+	config := &Config{
+		MasterDSN:           masterDSN,
 		AutoMigrate:         true,
+		InlineMigration:     true,
 		Models:              []interface{}{},
 		ConnectionTimeout:   10 * time.Second,
 		HealthCheckInterval: 5 * time.Minute,
+		RotationGracePeriod: 30 * time.Second,
+		RegistryCacheTTL:    30 * time.Second,
 		Logger:              logger.Default.LogMode(logger.Silent),
+		MaxOpenConns:        DefaultMaxOpenConns,
+		MaxIdleConns:        DefaultMaxIdleConns,
+		ConnMaxLifetime:     DefaultConnMaxLifetime,
+		ConnMaxIdleTime:     DefaultConnMaxIdleTime,
+		MasterPool: PoolProfile{
+			MaxOpenConns:    DefaultMasterMaxOpenConns,
+			MaxIdleConns:    DefaultMaxIdleConns,
+			ConnMaxLifetime: DefaultConnMaxLifetime,
+			ConnMaxIdleTime: DefaultConnMaxIdleTime,
+		},
 	}
+	// Reads the config when called, so SearchPathFor may be set after
+	// DefaultConfig and the store's UpdateConfig applies
+	config.current = new(atomic.Pointer[Config])
+	config.current.Store(config)
+	current := config.current
+	config.GetTenantDSN = func(tenantSchema string) string {
+		config := current.Load()
+		path, err := config.searchPath(tenantSchema)
+		if err != nil {
+			path = DefaultSearchPath(tenantSchema)
+		}
+		return tenantDSN(config.MasterDSN, path)
+	}
+	return config
 }
 
 // New creates a new TenantStore instance
@@ -80,119 +556,441 @@ func New(config *Config) (*TenantStore, error) {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
 
+	if err := checkFailpoints(config); err != nil {
+		return nil, err
+	}
+	if err := checkGrants(config); err != nil {
+		return nil, err
+	}
+
+	store := &TenantStore{
+		tenantDBs:         make(map[string]*gorm.DB),
+		health:            make(map[string]*tenantHealth),
+		tenantVersions:    make(map[string]uint64),
+		sessionSettings:   make(map[string]map[string]string),
+		poolProfiles:      make(map[string]string),
+		pinned:            make(map[string]bool),
+		leases:            make(map[string]int),
+		pendingMigrations: make(map[string]bool),
+		warmMigrations:    make(map[string]string),
+		registry:          newRegistryCache(config.Cache, config.RegistryCacheTTL),
+	}
+	store.cfg.Store(config)
+	store.provisionLimiter.Store(newProvisionLimiter(config))
+	if len(config.SchemaAliases) > 0 {
+		aliases := make(map[string]string, len(config.SchemaAliases))
+		for tenantID, tenantSchema := range config.SchemaAliases {
+			aliases[tenantID] = tenantSchema
+		}
+		store.aliases.Store(&aliases)
+	}
+
 	// Open master database connection
-	masterDB, err := gorm.Open(postgres.Open(config.MasterDSN), &gorm.Config{
-		Logger: config.Logger,
-	})
+	masterDB, err := store.openMasterDB(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to master database: %w", err)
+		return nil, err
 	}
+	store.masterDB = masterDB
 
-	store := &TenantStore{
-		masterDB:        masterDB,
-		tenantDBs:       make(map[string]*gorm.DB),
-		config:          config,
-		healthCheckDone: make(map[string]bool),
+	// Create the registry table
+	if config.EnableRegistry {
+		if err := masterDB.AutoMigrate(&Tenant{}); err != nil {
+			closeDB(masterDB)
+			return nil, fmt.Errorf("failed to migrate tenant registry: %w", err)
+		}
+	}
+
+	if config.PooledDB != nil {
+		if err := registerPooledScope(config.PooledDB, store.pooledTenantColumn()); err != nil {
+			closeDB(masterDB)
+			return nil, err
+		}
+		store.pooledDB.Store(config.PooledDB)
+	}
+
+	if config.SelfCheckOnStart {
+		if _, err := store.SelfCheck(context.Background()); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+
+	store.startListener()
+	store.startWatchdog()
+	store.startHealthChecker()
+	store.startJanitor()
+	for _, tenantSchema := range config.PinnedTenants {
+		store.pinned[tenantSchema] = true
+	}
+	if len(store.pinned) > 0 {
+		store.startKeeper()
+	}
+	store.startRefresher()
+
+	if len(config.CriticalTenants) > 0 && !config.DeferStart {
+		if _, err := store.Start(context.Background()); err != nil {
+			store.Close()
+			return nil, err
+		}
 	}
 
 	return store, nil
 }
 
-// GetMasterDB returns the master database connection
+// config returns the current config. Read it once per operation when
+// fields must agree with each other.
+func (s *TenantStore) config() *Config {
+	return s.cfg.Load()
+}
+
+// GetMasterDB returns the master database connection. In requests marked by
+// GuardTenantRoute, its queries are reported or rejected.
 func (s *TenantStore) GetMasterDB() *gorm.DB {
+	return guardedDB(s.master())
+}
+
+// master returns the master connection for the store's own queries, which
+// the tenant route guard lets through
+func (s *TenantStore) master() *gorm.DB {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.masterDB
 }
 
-// GetTenantDB returns a database connection for the specified tenant schema
-// It creates the connection if it doesn't exist and performs health checks
-func (s *TenantStore) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
-	if tenantSchema == "" {
+// GetTenantDB returns a database connection for the specified tenant
+// It maps the tenant ID to its schema with SchemaName, creates the connection
+// if it doesn't exist and performs health checks
+func (s *TenantStore) GetTenantDB(ctx context.Context, tenantID string) (*gorm.DB, error) {
+	if tenantID == "" {
 		return nil, fmt.Errorf("tenant schema cannot be empty")
 	}
+	if s.closing.Load() {
+		return nil, ErrStoreClosing
+	}
+
+	tenantSchema, err := s.SchemaName(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.failpoint(FailpointGetTenantDB, tenantSchema); err != nil {
+		return nil, err
+	}
+
+	// Converted tenants live in the shared tables
+	if db, err := s.pooledTenantDB(ctx, tenantSchema); db != nil || err != nil {
+		return db, err
+	}
+	return s.tenantDB(ctx, tenantSchema)
+}
 
+// connectTenantDB returns the cached connection for a schema name or creates it
+func (s *TenantStore) connectTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
 	// Check if connection exists
 	s.mu.RLock()
 	db, exists := s.tenantDBs[tenantSchema]
+	current := s.tenantVersions[tenantSchema] == s.dsnVersion && !s.unhealthy(tenantSchema)
+	if exists && current {
+		// Under mu, so the janitor never closes a pool just handed out.
+		// The health checker pings cached pools in the background.
+		s.touch(tenantSchema, time.Now())
+	}
 	s.mu.RUnlock()
 
-	if exists {
-		// Perform periodic health check
-		s.healthCheckWithInterval(ctx, tenantSchema, db)
+	if exists && current {
 		return db, nil
 	}
 
-	// Create new connection
+	// Shared schemas are never cached, so refusing them here is enough
+	if s.isMasterSchema(tenantSchema) {
+		return nil, fmt.Errorf("%w: %s", ErrMasterSchema, tenantSchema)
+	}
+
+	// Config.ModelsFor, SearchPathFor and SessionSettings may query the
+	// store, so ask them before locking
+	groups, err := s.tenantModelGroups(ctx, tenantSchema)
+	if err != nil {
+		return nil, err
+	}
+	placement, err := s.TenantPlacement(ctx, tenantSchema)
+	if err != nil {
+		return nil, err
+	}
+	dial, err := s.tenantDialOptions(ctx, tenantSchema, placement)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create new connection. Fiber strings point into reused request
+	// buffers, so keep a copy of the name used as map key.
+	tenantSchema = strings.Clone(tenantSchema)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// Double-check after acquiring write lock
 	if db, exists := s.tenantDBs[tenantSchema]; exists {
-		return db, nil
+		s.touch(tenantSchema, time.Now())
+		if s.tenantVersions[tenantSchema] == s.dsnVersion && !s.unhealthy(tenantSchema) {
+			return db, nil
+		}
+
+		// Re-dial connections opened before the credentials were rotated
+		// and pools whose last health check failed
+		tenantDB, err := s.openTenantDB(ctx, tenantSchema, dial)
+		if err != nil {
+			return nil, err
+		}
+		s.tenantDBs[tenantSchema] = tenantDB
+		s.tenantVersions[tenantSchema] = s.dsnVersion
+		s.health[tenantSchema] = new(tenantHealth)
+		s.retire(db)
+
+		return tenantDB, nil
+	}
+
+	// Tenants placed elsewhere were provisioned where they live
+	if dial.placement.located() {
+		return s.connectPlacedTenantDB(ctx, tenantSchema, groups, dial)
+	}
+
+	// Refuse to create schemas beyond the quota or rate limit
+	if err := s.checkProvision(ctx, s.masterDB, tenantSchema); err != nil {
+		return nil, err
 	}
 
-	// Create schema if it doesn't exist
-	if err := s.ensureSchema(ctx, tenantSchema); err != nil {
-		return nil, fmt.Errorf("failed to ensure schema: %w", err)
+	migrate, err := s.inlineMigration(ctx, tenantSchema, groups)
+	if err != nil {
+		return nil, err
 	}
+	migrateCtx, cancel := s.inlineMigrationContext(ctx)
+	defer cancel()
 
-	// Get tenant-specific DSN with search_path
-	tenantDSN := s.config.GetTenantDSN(tenantSchema)
+	if s.config().GetMigrationDSN != nil {
+		// Create schema and migrate on a short-lived privileged connection
+		var migrated [][]interface{}
+		if migrate {
+			migrated = groups
+		}
+		if err := s.migrateWithMigrationDSN(migrateCtx, tenantSchema, migrated); err != nil {
+			return nil, s.inlineMigrationFailed(ctx, migrateCtx, tenantSchema, err)
+		}
+	} else {
+		// Create schema if it doesn't exist
+		if err := s.ensureSchema(ctx, tenantSchema); err != nil {
+			return nil, fmt.Errorf("failed to ensure schema: %w", err)
+		}
+	}
 
 	// Open tenant database connection
-	tenantDB, err := gorm.Open(postgres.Open(tenantDSN), &gorm.Config{
-		Logger: s.config.Logger,
-	})
+	tenantDB, err := s.openTenantDB(ctx, tenantSchema, dial)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to tenant database: %w", err)
+		return nil, err
 	}
 
 	// Auto-migrate models if enabled
-	if s.config.AutoMigrate && len(s.config.Models) > 0 {
-		if err := tenantDB.AutoMigrate(s.config.Models...); err != nil {
-			return nil, fmt.Errorf("failed to auto-migrate models: %w", err)
+	if s.config().GetMigrationDSN == nil && migrate {
+		if err := s.autoMigrate(migrateCtx, tenantDB, tenantSchema, groups); err != nil {
+			closeDB(tenantDB)
+			return nil, s.inlineMigrationFailed(ctx, migrateCtx, tenantSchema, err)
+		}
+		if err := s.afterAutoMigrate(migrateCtx, tenantDB, tenantSchema); err != nil {
+			closeDB(tenantDB)
+			return nil, s.inlineMigrationFailed(ctx, migrateCtx, tenantSchema, err)
+		}
+	}
+
+	// Create tenant views over shared data, then the materialized views
+	if s.config().GetMigrationDSN == nil {
+		if err := s.createViews(ctx, tenantDB, tenantSchema); err != nil {
+			closeDB(tenantDB)
+			return nil, err
+		}
+		if err := s.createMaterializedViews(ctx, tenantDB, tenantSchema); err != nil {
+			closeDB(tenantDB)
+			return nil, err
+		}
+	}
+
+	// Verify the connection resolves tables inside the tenant schema
+	if s.config().StrictIsolation {
+		if err := s.verifyIsolation(ctx, tenantSchema, tenantDB, flatten(groups)); err != nil {
+			closeDB(tenantDB)
+			return nil, err
 		}
 	}
 
 	// Store connection
 	s.tenantDBs[tenantSchema] = tenantDB
-	s.healthCheckDone[tenantSchema] = false
+	s.tenantVersions[tenantSchema] = s.dsnVersion
+	s.health[tenantSchema] = new(tenantHealth)
+	s.touch(tenantSchema, time.Now())
+	s.evictLeastRecentlyUsed(tenantSchema)
 
 	return tenantDB, nil
 }
 
-// ensureSchema creates the schema if it doesn't exist
-func (s *TenantStore) ensureSchema(ctx context.Context, schemaName string) error {
-	createSchemaSQL := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", schemaName)
-	if err := s.masterDB.WithContext(ctx).Exec(createSchemaSQL).Error; err != nil {
-		return fmt.Errorf("failed to create schema: %w", err)
+// openMasterDB opens a master connection using the current master DSN
+func (s *TenantStore) openMasterDB(ctx context.Context) (*gorm.DB, error) {
+	dsn := s.config().MasterDSN
+	if s.config().DSNProvider != nil {
+		var err error
+		if dsn, err = s.config().DSNProvider(ctx); err != nil {
+			return nil, fmt.Errorf("failed to get master DSN from provider: %w", err)
+		}
 	}
-	return nil
+
+	masterDB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger:      s.config().Logger,
+		PrepareStmt: s.config().PrepareStmt.enabled(false),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to master database: %w", err)
+	}
+	if err := registerTenantRouteGuard(masterDB, s.config().Logger); err != nil {
+		closeDB(masterDB)
+		return nil, err
+	}
+	if sqlDB, err := masterDB.DB(); err == nil {
+		s.config().MasterPool.apply(sqlDB)
+	}
+	return masterDB, nil
+}
+
+// dialOptions are the per-tenant Config callbacks' answers for a new
+// connection. The callbacks may query the store, so they are asked before
+// mu is taken.
+type dialOptions struct {
+	// placement is where the registry placed the tenant
+	placement Placement
+	// searchPath is the validated search_path of Config.SearchPathFor
+	searchPath []string
+	// dsn is the tenant DSN at the placement
+	dsn string
+	// settings are the non-empty Config.SessionSettings
+	settings map[string]string
+}
+
+// tenantDialOptions asks the Config callbacks for the tenant's dial options
+// at the placement. Callers must not hold mu.
+func (s *TenantStore) tenantDialOptions(ctx context.Context, tenantSchema string, placement Placement) (dialOptions, error) {
+	searchPath, err := s.SearchPath(tenantSchema)
+	if err != nil {
+		return dialOptions{}, err
+	}
+	dsn, err := s.placementDSN(ctx, tenantSchema, placement, searchPath)
+	if err != nil {
+		return dialOptions{}, err
+	}
+	dial := dialOptions{placement: placement, searchPath: searchPath, dsn: dsn}
+	if s.config().SessionSettings != nil {
+		// Empty values leave the server default
+		for name, value := range s.config().SessionSettings(tenantSchema) {
+			if value == "" {
+				continue
+			}
+			if dial.settings == nil {
+				dial.settings = make(map[string]string)
+			}
+			dial.settings[name] = value
+		}
+	}
+	return dial, nil
 }
 
-// healthCheckWithInterval performs health check with interval control
-func (s *TenantStore) healthCheckWithInterval(ctx context.Context, tenantSchema string, db *gorm.DB) {
-	s.healthMu.Lock()
-	defer s.healthMu.Unlock()
+// openTenantDB opens a connection whose search_path targets the tenant schema,
+// tagged with the schema for SchemaFromDB. Callers hold mu.
+func (s *TenantStore) openTenantDB(ctx context.Context, tenantSchema string, dial dialOptions) (*gorm.DB, error) {
+	// Tenants moved with MoveTenant are dialed where the registry places
+	// them. The DSN was resolved before locking, so refuse it if the tenant
+	// moved since.
+	placement, err := s.tenantPlacement(ctx, tenantSchema)
+	if err != nil {
+		return nil, err
+	}
+	if placement != dial.placement {
+		return nil, fmt.Errorf("tenant %s moved while connecting, retry", tenantSchema)
+	}
+	profile, err := s.poolProfile(placement)
+	if err != nil {
+		return nil, err
+	}
 
-	if s.healthCheckDone[tenantSchema] {
-		return
+	settings := make(map[string]string, len(dial.settings)+1)
+	for name, value := range dial.settings {
+		settings[name] = value
+	}
+	if s.config().MaxTransactionAge > 0 {
+		// The watchdog finds the tenant's sessions by name
+		settings["application_name"] = s.applicationName(tenantSchema)
+	}
+	dialector, err := tenantDialector(dial.dsn, settings)
+	if err != nil {
+		return nil, err
 	}
 
-	// Perform health check
-	sqlDB, err := db.DB()
-	if err == nil {
-		if err := sqlDB.PingContext(ctx); err == nil {
-			s.healthCheckDone[tenantSchema] = true
-
-			// Reset health check flag after interval
-			go func() {
-				time.Sleep(s.config.HealthCheckInterval)
-				s.healthMu.Lock()
-				s.healthCheckDone[tenantSchema] = false
-				s.healthMu.Unlock()
-			}()
+	tenantDB, err := gorm.Open(dialector, &gorm.Config{
+		Logger:      s.config().Logger,
+		PrepareStmt: s.tenantPrepareStmt(tenantSchema),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to tenant database: %w", err)
+	}
+	if err := s.registerQueryScope(tenantDB, tenantSchema); err != nil {
+		closeDB(tenantDB)
+		return nil, err
+	}
+	if err := s.registerRetryReads(tenantDB, tenantSchema); err != nil {
+		closeDB(tenantDB)
+		return nil, err
+	}
+	if sqlDB, err := tenantDB.DB(); err == nil {
+		if profile != nil {
+			profile.apply(sqlDB)
+		} else {
+			s.config().applyPool(sqlDB)
 		}
 	}
+	if profile != nil {
+		s.poolProfiles[tenantSchema] = placement.PoolProfile
+	} else {
+		delete(s.poolProfiles, tenantSchema)
+	}
+
+	if len(settings) > 0 {
+		s.sessionSettings[tenantSchema] = settings
+	} else {
+		delete(s.sessionSettings, tenantSchema)
+	}
+	return WithSchema(tenantDB, tenantSchema), nil
+}
+
+// ensureSchema creates the schema if it doesn't exist
+func (s *TenantStore) ensureSchema(ctx context.Context, schemaName string) error {
+	if err := s.failpoint(FailpointEnsureSchema, schemaName); err != nil {
+		return err
+	}
+
+	createSQL, err := createSchemaSQL(schemaName)
+	if err != nil {
+		return err
+	}
+	if err := s.masterDB.WithContext(ctx).Exec(createSQL).Error; err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+	if err := s.applyGrants(ctx, s.masterDB, schemaName); err != nil {
+		return err
+	}
+	s.commentSchema(ctx, s.masterDB, schemaName)
+	return nil
+}
+
+// createSchemaSQL returns the statement creating a valid schema name unless
+// it exists. The name is quoted and lowercased like the unquoted names of
+// CREATE SCHEMA.
+func createSchemaSQL(schemaName string) (string, error) {
+	if err := validateSchemaName(schemaName); err != nil {
+		return "", err
+	}
+	return "CREATE SCHEMA IF NOT EXISTS " + quoteIdentifier(schemaName), nil
 }
 
 // RemoveTenantDB closes and removes a tenant database connection
@@ -200,6 +998,10 @@ func (s *TenantStore) RemoveTenantDB(tenantSchema string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// Schemas removed before their first connection may be dropped and
+	// recreated empty, so the imported migration state no longer holds
+	delete(s.warmMigrations, tenantSchema)
+
 	db, exists := s.tenantDBs[tenantSchema]
 	if !exists {
 		return nil
@@ -215,13 +1017,30 @@ func (s *TenantStore) RemoveTenantDB(tenantSchema string) error {
 	}
 
 	delete(s.tenantDBs, tenantSchema)
-	delete(s.healthCheckDone, tenantSchema)
+	delete(s.tenantVersions, tenantSchema)
+	delete(s.health, tenantSchema)
+	delete(s.sessionSettings, tenantSchema)
+	delete(s.poolProfiles, tenantSchema)
+	s.lastUsed.Delete(tenantSchema)
 
 	return nil
 }
 
 // Close closes all database connections
 func (s *TenantStore) Close() error {
+	// The listener, watchdog, health checker, janitor, keeper and refresher
+	// take mu, so stop them first. UpdateConfig restarts some of them, so
+	// hold configMu.
+	s.configMu.Lock()
+	s.stopped = true
+	s.stopListener()
+	s.stopWatchdog()
+	s.stopHealthChecker()
+	s.stopJanitor()
+	s.stopKeeper()
+	s.stopRefresher()
+	s.configMu.Unlock()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -240,6 +1059,9 @@ func (s *TenantStore) Close() error {
 		}
 	}
 
+	// Close pools still serving out their grace period
+	errs = append(errs, s.closeRetired()...)
+
 	// Close master connection
 	masterSQLDB, err := s.masterDB.DB()
 	if err != nil {
@@ -2,10 +2,16 @@ package tenantstore
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
 	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore/tenantstoretest"
 )
 
 type TestModel struct {
@@ -13,16 +19,28 @@ type TestModel struct {
 	Name string
 }
 
-func getTestDSN() string {
+func TestMain(m *testing.M) {
+	code := m.Run()
+	tenantstoretest.Stop()
+	os.Exit(code)
+}
+
+// getTestDSN returns a DSN for a fresh database on the server named by
+// DATABASE_URL, or on a disposable container when it is unset
+func getTestDSN(t *testing.T) string {
+	t.Helper()
+
 	dsn := os.Getenv("DATABASE_URL")
 	if dsn == "" {
-		dsn = "host=localhost user=postgres password=0101 dbname=multitenant_test port=5432 sslmode=disable"
+		dsn = tenantstoretest.StartPostgres(t)
 	}
-	return dsn
+	return tenantstoretest.NewDatabase(t, dsn)
 }
 
 func TestNew(t *testing.T) {
-	config := DefaultConfig(getTestDSN())
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
 
 	store, err := New(config)
 	if err != nil {
@@ -40,6 +58,8 @@ func TestNew(t *testing.T) {
 }
 
 func TestNewWithInvalidConfig(t *testing.T) {
+	t.Parallel()
+
 	_, err := New(nil)
 	if err == nil {
 		t.Fatal("Expected error when config is nil")
@@ -47,7 +67,9 @@ func TestNewWithInvalidConfig(t *testing.T) {
 }
 
 func TestGetMasterDB(t *testing.T) {
-	config := DefaultConfig(getTestDSN())
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
 	store, err := New(config)
 	if err != nil {
 		t.Fatalf("Failed to create store: %v", err)
@@ -60,8 +82,73 @@ func TestGetMasterDB(t *testing.T) {
 	}
 }
 
+func TestPoolLimits(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	masterDB, _ := store.GetMasterDB().DB()
+	if max := masterDB.Stats().MaxOpenConnections; max != DefaultMasterMaxOpenConns {
+		t.Fatalf("Expected the master pool limited to %d, got %d", DefaultMasterMaxOpenConns, max)
+	}
+	db, err := store.GetTenantDB(context.Background(), "tenant_pool_limits")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	tenantDB, _ := db.DB()
+	if max := tenantDB.Stats().MaxOpenConnections; max != DefaultMaxOpenConns {
+		t.Fatalf("Expected the tenant pool limited to %d, got %d", DefaultMaxOpenConns, max)
+	}
+
+	// Zero lifts the limits
+	config = DefaultConfig(config.MasterDSN)
+	config.MaxOpenConns = 0
+	config.MasterPool = PoolProfile{}
+	unlimited, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer unlimited.Close()
+
+	masterDB, _ = unlimited.GetMasterDB().DB()
+	db, err = unlimited.GetTenantDB(context.Background(), "tenant_pool_limits")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	tenantDB, _ = db.DB()
+	if masterDB.Stats().MaxOpenConnections != 0 || tenantDB.Stats().MaxOpenConnections != 0 {
+		t.Fatalf("Expected unlimited pools, got %d and %d", masterDB.Stats().MaxOpenConnections, tenantDB.Stats().MaxOpenConnections)
+	}
+}
+
+func TestDefaultConfigPoolLimits(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:default_pool_limits?mode=memory"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer closeDB(db)
+	sqlDB, _ := db.DB()
+
+	config := DefaultConfig("")
+	config.applyPool(sqlDB)
+	if max := sqlDB.Stats().MaxOpenConnections; max != DefaultMaxOpenConns {
+		t.Fatalf("Expected tenant pools limited to %d, got %d", DefaultMaxOpenConns, max)
+	}
+	config.MasterPool.apply(sqlDB)
+	if max := sqlDB.Stats().MaxOpenConnections; max != DefaultMasterMaxOpenConns {
+		t.Fatalf("Expected the master pool limited to %d, got %d", DefaultMasterMaxOpenConns, max)
+	}
+}
+
 func TestGetTenantDB(t *testing.T) {
-	config := DefaultConfig(getTestDSN())
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
 	config.AutoMigrate = true
 	config.Models = []interface{}{&TestModel{}}
 
@@ -96,7 +183,9 @@ func TestGetTenantDB(t *testing.T) {
 }
 
 func TestGetTenantDBEmptySchema(t *testing.T) {
-	config := DefaultConfig(getTestDSN())
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
 	store, err := New(config)
 	if err != nil {
 		t.Fatalf("Failed to create store: %v", err)
@@ -112,7 +201,9 @@ func TestGetTenantDBEmptySchema(t *testing.T) {
 }
 
 func TestGetTenantDBCaching(t *testing.T) {
-	config := DefaultConfig(getTestDSN())
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
 	store, err := New(config)
 	if err != nil {
 		t.Fatalf("Failed to create store: %v", err)
@@ -146,7 +237,9 @@ func TestGetTenantDBCaching(t *testing.T) {
 }
 
 func TestRemoveTenantDB(t *testing.T) {
-	config := DefaultConfig(getTestDSN())
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
 	store, err := New(config)
 	if err != nil {
 		t.Fatalf("Failed to create store: %v", err)
@@ -184,7 +277,9 @@ func TestRemoveTenantDB(t *testing.T) {
 }
 
 func TestGetAllTenantSchemas(t *testing.T) {
-	config := DefaultConfig(getTestDSN())
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
 	store, err := New(config)
 	if err != nil {
 		t.Fatalf("Failed to create store: %v", err)
@@ -226,7 +321,9 @@ func TestGetAllTenantSchemas(t *testing.T) {
 }
 
 func TestAutoMigration(t *testing.T) {
-	config := DefaultConfig(getTestDSN())
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
 	config.AutoMigrate = true
 	config.Models = []interface{}{&TestModel{}}
 
@@ -266,7 +363,9 @@ func TestAutoMigration(t *testing.T) {
 }
 
 func TestSchemaIsolation(t *testing.T) {
-	config := DefaultConfig(getTestDSN())
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
 	config.AutoMigrate = true
 	config.Models = []interface{}{&TestModel{}}
 
@@ -326,8 +425,93 @@ func TestSchemaIsolation(t *testing.T) {
 	}
 }
 
+func TestCreateSchemaSQL(t *testing.T) {
+	createSQL, err := createSchemaSQL(`Acme"; DROP SCHEMA public; --`)
+	if err != nil {
+		t.Fatalf("Failed to build statement: %v", err)
+	}
+	if want := `CREATE SCHEMA IF NOT EXISTS "Acme""; DROP SCHEMA public; --"`; createSQL != want {
+		t.Fatalf("Expected %s, got %s", want, createSQL)
+	}
+	if _, err := createSchemaSQL(""); err == nil {
+		t.Fatal("Expected an empty name to be rejected")
+	}
+}
+
+func TestSchemaNameNeedsQuoting(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&TestModel{}}
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	tenantSchema := "tenant quoted; -- name"
+	defer store.masterDB.Exec("DROP SCHEMA IF EXISTS " + quoteIdentifier(tenantSchema) + " CASCADE")
+
+	db, err := store.GetTenantDB(ctx, tenantSchema)
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	if err := db.Create(&TestModel{Name: "quoted"}).Error; err != nil {
+		t.Fatalf("Failed to create record: %v", err)
+	}
+	if _, err := store.DropTenant(ctx, tenantSchema, DropOptions{Cascade: true}); err != nil {
+		t.Fatalf("Failed to drop tenant: %v", err)
+	}
+}
+
+func TestMixedCaseTenantRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&TestModel{}}
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	tenantID := fmt.Sprintf("Mixed_Case_%d", time.Now().UnixNano())
+	tenantSchema, err := store.SchemaName(tenantID)
+	if err != nil {
+		t.Fatalf("Failed to map tenant: %v", err)
+	}
+	defer store.masterDB.Exec("DROP SCHEMA IF EXISTS " + quoteIdentifier(tenantSchema) + " CASCADE")
+
+	db, err := store.GetTenantDB(ctx, tenantID)
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	if err := db.Create(&TestModel{Name: "mixed"}).Error; err != nil {
+		t.Fatalf("Failed to create record: %v", err)
+	}
+
+	counts, err := store.RowCounts(ctx, tenantSchema)
+	if err != nil || counts["test_models"] != 1 {
+		t.Fatalf("Expected 1 row in %s, got %v (%v)", tenantSchema, counts, err)
+	}
+	export, err := store.ExportTenant(ctx, tenantSchema)
+	if err != nil || len(export["test_models"]) != 1 {
+		t.Fatalf("Expected 1 exported row in %s, got %v (%v)", tenantSchema, export, err)
+	}
+	if _, err := store.DropTenant(ctx, tenantSchema, DropOptions{Cascade: true}); err != nil {
+		t.Fatalf("Failed to drop tenant: %v", err)
+	}
+	if _, err := store.schemaTables(ctx, tenantSchema); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("Expected %s to be dropped, got %v", tenantSchema, err)
+	}
+}
+
 func TestClose(t *testing.T) {
-	config := DefaultConfig(getTestDSN())
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
 	store, err := New(config)
 	if err != nil {
 		t.Fatalf("Failed to create store: %v", err)
@@ -359,3 +543,25 @@ func TestClose(t *testing.T) {
 		t.Fatal("Expected master DB to be closed")
 	}
 }
+
+// withConfig sets the config of a store built as a struct literal
+func withConfig(s *TenantStore, config *Config) *TenantStore {
+	s.cfg.Store(config)
+	return s
+}
+
+// reconfigure swaps in a changed copy of the store's config, like
+// UpdateConfig, for fields ConfigPatch does not cover. The stored config is
+// never modified.
+func reconfigure(s *TenantStore, change func(*Config)) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	current := s.config()
+	next := *current
+	change(&next)
+	s.cfg.Store(&next)
+	if next.current != nil {
+		next.current.CompareAndSwap(current, &next)
+	}
+}
@@ -0,0 +1,84 @@
+package tenantstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrMasterDBInTenantRoute is returned for queries on GetMasterDB in a
+// request marked by GuardTenantRoute with fail set
+var ErrMasterDBInTenantRoute = errors.New("master DB used in a tenant route")
+
+// guardedKey tags sessions returned by GetMasterDB; the store's own queries
+// on the master connection are untagged and never checked
+const guardedKey = "tenantstore:guarded"
+
+// tenantRouteKey marks request contexts with their tenantRoute
+type tenantRouteKey struct{}
+
+type tenantRoute struct {
+	tenant string
+	fail   bool
+}
+
+// GuardTenantRoute marks ctx as a request for the tenant. Queries on
+// GetMasterDB bound to the context, as with
+// store.GetMasterDB().WithContext(c.UserContext()), are then logged as
+// warnings or, with fail, rejected with ErrMasterDBInTenantRoute, since
+// they would read or write public rather than the tenant schema. The
+// store's own queries, such as registry lookups, are not affected. The
+// middleware calls it for every request with a tenant when
+// StrictTenantRoutes is set.
+func (s *TenantStore) GuardTenantRoute(ctx context.Context, tenant string, fail bool) context.Context {
+	return context.WithValue(ctx, tenantRouteKey{}, tenantRoute{tenant: tenant, fail: fail})
+}
+
+// AllowMasterDB returns ctx without the GuardTenantRoute mark, for handlers
+// that use the master DB on purpose
+func AllowMasterDB(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantRouteKey{}, nil)
+}
+
+// guardedDB returns a session of db whose queries the guard checks
+func guardedDB(db *gorm.DB) *gorm.DB {
+	return db.Set(guardedKey, true).Session(&gorm.Session{})
+}
+
+// registerTenantRouteGuard adds the callbacks checking guarded queries to
+// db. They run before each operation, so rejected queries never reach the
+// database and writes never open a transaction.
+func registerTenantRouteGuard(db *gorm.DB, log logger.Interface) error {
+	check := func(db *gorm.DB) {
+		if _, ok := db.Get(guardedKey); !ok || db.Statement.Context == nil {
+			return
+		}
+		route, ok := db.Statement.Context.Value(tenantRouteKey{}).(tenantRoute)
+		if !ok {
+			return
+		}
+		if route.fail {
+			db.AddError(fmt.Errorf("%w for tenant %s", ErrMasterDBInTenantRoute, route.tenant))
+			return
+		}
+		log.Warn(db.Statement.Context, "master DB used in a request for tenant %s; use the tenant DB, or tenantstore.AllowMasterDB if this is intended", route.tenant)
+	}
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:begin_transaction").Register("tenantstore:tenant_route", check),
+		callbacks.Update().Before("gorm:begin_transaction").Register("tenantstore:tenant_route", check),
+		callbacks.Delete().Before("gorm:begin_transaction").Register("tenantstore:tenant_route", check),
+		callbacks.Query().Before("gorm:query").Register("tenantstore:tenant_route", check),
+		callbacks.Row().Before("gorm:row").Register("tenantstore:tenant_route", check),
+		callbacks.Raw().Before("gorm:raw").Register("tenantstore:tenant_route", check),
+	} {
+		if err != nil {
+			return fmt.Errorf("failed to register tenant route guard: %w", err)
+		}
+	}
+	return nil
+}
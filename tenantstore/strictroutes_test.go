@@ -0,0 +1,129 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/logger"
+
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+)
+
+// warnLogger records warnings and discards everything else
+type warnLogger struct {
+	logger.Interface
+
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (l *warnLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, fmt.Sprintf(msg, args...))
+}
+
+func newStrictRoutesApp(t *testing.T, store *TenantStore, fail bool) *fiber.App {
+	t.Helper()
+
+	app := fiber.New()
+	app.Use(middleware.New(middleware.Config{
+		Store:                  sharedPool{store},
+		Resolver:               middleware.HeaderResolver("X-Tenant-ID"),
+		EnforceActive:          true,
+		StrictTenantRoutes:     true,
+		StrictTenantRoutesFail: fail,
+	}))
+
+	// A handler writing to the master DB instead of the tenant DB
+	app.Get("/master", func(c *fiber.Ctx) error {
+		var count int64
+		if err := store.GetMasterDB().WithContext(c.UserContext()).Model(&Tenant{}).Count(&count).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.SendString("ok")
+	})
+	app.Get("/allowed", func(c *fiber.Ctx) error {
+		var count int64
+		ctx := AllowMasterDB(c.UserContext())
+		if err := store.GetMasterDB().WithContext(ctx).Model(&Tenant{}).Count(&count).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.SendString("ok")
+	})
+	app.Get("/store", func(c *fiber.Ctx) error {
+		if _, err := store.ListTenants(c.UserContext()); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.SendString("ok")
+	})
+	return app
+}
+
+func strictRoutesRequest(t *testing.T, app *fiber.App, path string) int {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestStrictTenantRoutesFail(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "strict_routes_fail")
+	if err := registerTenantRouteGuard(store.masterDB, store.config().Logger); err != nil {
+		t.Fatalf("Failed to register guard: %v", err)
+	}
+	if err := store.RegisterTenant(context.Background(), &Tenant{Schema: "acme", Name: "Acme", Active: true}); err != nil {
+		t.Fatalf("Failed to register tenant: %v", err)
+	}
+	app := newStrictRoutesApp(t, store, true)
+
+	if status := strictRoutesRequest(t, app, "/master"); status != fiber.StatusInternalServerError {
+		t.Fatalf("Expected the master DB query to fail with 500, got %d", status)
+	}
+	if status := strictRoutesRequest(t, app, "/allowed"); status != fiber.StatusOK {
+		t.Fatalf("Expected AllowMasterDB to pass, got %d", status)
+	}
+	if status := strictRoutesRequest(t, app, "/store"); status != fiber.StatusOK {
+		t.Fatalf("Expected the store's own queries to pass, got %d", status)
+	}
+
+	// Outside requests the master DB is unrestricted
+	var count int64
+	if err := store.GetMasterDB().Model(&Tenant{}).Count(&count).Error; err != nil || count != 1 {
+		t.Fatalf("Expected 1 tenant outside requests, got %d (%v)", count, err)
+	}
+}
+
+func TestStrictTenantRoutesWarn(t *testing.T) {
+	store := newSQLiteRegistryStore(t, "strict_routes_warn")
+	log := &warnLogger{Interface: logger.Discard}
+	if err := registerTenantRouteGuard(store.masterDB, log); err != nil {
+		t.Fatalf("Failed to register guard: %v", err)
+	}
+	if err := store.RegisterTenant(context.Background(), &Tenant{Schema: "acme", Name: "Acme", Active: true}); err != nil {
+		t.Fatalf("Failed to register tenant: %v", err)
+	}
+	app := newStrictRoutesApp(t, store, false)
+
+	if status := strictRoutesRequest(t, app, "/master"); status != fiber.StatusOK {
+		t.Fatalf("Expected the master DB query to pass with a warning, got %d", status)
+	}
+	if len(log.warnings) != 1 || !strings.Contains(log.warnings[0], "tenant acme") {
+		t.Fatalf("Expected one warning naming acme, got %v", log.warnings)
+	}
+
+	strictRoutesRequest(t, app, "/store")
+	if len(log.warnings) != 1 {
+		t.Fatalf("Expected no warning for the store's own queries, got %v", log.warnings)
+	}
+}
@@ -0,0 +1,118 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Outcomes of a tenant in the results of SuspendTenants and ResumeTenants
+const (
+	SuspendChanged   = "changed"
+	SuspendUnchanged = "unchanged"
+	SuspendNotFound  = "not_found"
+)
+
+// SuspendResult is the outcome of one schema passed to SuspendTenants or
+// ResumeTenants. Error is set when the change was made but the tenant's
+// connection could not be closed.
+type SuspendResult struct {
+	Schema string `json:"schema"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SuspendTenants deactivates the tenants in one registry update, for
+// incidents where many tenants must stop at once. Their cached registry
+// records are dropped, so the middleware's EnforceActive rejects them from
+// the next request on, their running statements are aborted with
+// CancelTenantQueries, and their cached connections are closed, ending work
+// still queued on them. EventTenantDeactivated is emitted for each tenant
+// that was active. Results follow the order of schemas; an error is only
+// returned when the registry cannot be updated, in which case nothing
+// changed.
+func (s *TenantStore) SuspendTenants(ctx context.Context, schemas []string) ([]SuspendResult, error) {
+	return s.setTenantsActive(ctx, schemas, false)
+}
+
+// ResumeTenants activates the tenants again in one registry update, undoing
+// SuspendTenants. EventTenantActivated is emitted for each tenant that was
+// inactive.
+func (s *TenantStore) ResumeTenants(ctx context.Context, schemas []string) ([]SuspendResult, error) {
+	return s.setTenantsActive(ctx, schemas, true)
+}
+
+func (s *TenantStore) setTenantsActive(ctx context.Context, schemas []string, active bool) ([]SuspendResult, error) {
+	db, err := s.registryDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, tenantSchema := range schemas {
+		if tenantSchema == "" {
+			return nil, fmt.Errorf("tenant schema cannot be empty")
+		}
+	}
+
+	var (
+		found   []Tenant
+		changed []string
+	)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("schema", "active").Where("schema IN ?", schemas).Find(&found).Error; err != nil {
+			return err
+		}
+		for _, tenant := range found {
+			if tenant.Active != active {
+				changed = append(changed, tenant.Schema)
+			}
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+		return tx.Model(&Tenant{}).Where("schema IN ?", changed).Update("active", active).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update tenants: %w", err)
+	}
+
+	status := make(map[string]string, len(found))
+	for _, tenant := range found {
+		status[tenant.Schema] = SuspendUnchanged
+	}
+	for _, tenantSchema := range changed {
+		status[tenantSchema] = SuspendChanged
+	}
+
+	event := EventTenantActivated
+	if !active {
+		event = EventTenantDeactivated
+	}
+
+	results := make([]SuspendResult, 0, len(schemas))
+	done := make(map[string]bool, len(schemas))
+	for _, tenantSchema := range schemas {
+		result := SuspendResult{Schema: tenantSchema, Status: status[tenantSchema]}
+		if result.Status == "" {
+			result.Status = SuspendNotFound
+		}
+
+		// Repeated schemas are reported again but handled once
+		if !done[tenantSchema] && result.Status != SuspendNotFound {
+			done[tenantSchema] = true
+			s.registry.delete(tenantSchema)
+			if !active {
+				// Closing waits for running statements, so abort them first
+				s.CancelTenantQueries(tenantSchema)
+				if err := s.RemoveTenantDB(tenantSchema); err != nil {
+					result.Error = err.Error()
+				}
+			}
+			if result.Status == SuspendChanged {
+				s.emit(ctx, event, tenantSchema)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
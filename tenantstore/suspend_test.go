@@ -0,0 +1,143 @@
+package tenantstore
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+)
+
+// newSQLiteRegistryStore returns a store whose registry lives in an
+// in-memory SQLite database, with a cache TTL longer than any test
+func newSQLiteRegistryStore(t *testing.T, name string, configure ...func(*Config)) *TenantStore {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { closeDB(db) })
+	if err := db.AutoMigrate(&Tenant{}); err != nil {
+		t.Fatalf("Failed to migrate registry: %v", err)
+	}
+
+	config := DefaultConfig("")
+	config.EnableRegistry = true
+	config.RegistryCacheTTL = time.Hour
+	for _, fn := range configure {
+		fn(config)
+	}
+	return withConfig(&TenantStore{
+		masterDB:  db,
+		tenantDBs: make(map[string]*gorm.DB),
+		registry:  newRegistryCache(nil, config.RegistryCacheTTL),
+	}, config)
+}
+
+func TestSuspendTenants(t *testing.T) {
+	var events []TenantEvent
+	store := newSQLiteRegistryStore(t, "suspend_tenants", func(config *Config) {
+		config.OnTenantEvent = func(ctx context.Context, event TenantEvent) {
+			events = append(events, event)
+		}
+	})
+	ctx := context.Background()
+
+	for _, schema := range []string{"acme", "globex", "initech"} {
+		if err := store.RegisterTenant(ctx, &Tenant{Schema: schema, Name: schema, Active: true}); err != nil {
+			t.Fatalf("Failed to register %s: %v", schema, err)
+		}
+	}
+	store.DeactivateTenant(ctx, "initech")
+	events = nil
+
+	app := fiber.New()
+	app.Use(middleware.New(middleware.Config{
+		Store:         sharedPool{store},
+		Resolver:      middleware.HeaderResolver("X-Tenant-ID"),
+		EnforceActive: true,
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(middleware.GetTenant(c))
+	})
+	request := func(tenant string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Tenant-ID", tenant)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	// Cache the active records and hold a connection for acme
+	if status := request("acme"); status != fiber.StatusOK {
+		t.Fatalf("Expected acme to be served, got %d", status)
+	}
+	if status := request("globex"); status != fiber.StatusOK {
+		t.Fatalf("Expected globex to be served, got %d", status)
+	}
+	conn, err := gorm.Open(sqlite.Open("file:suspend_tenants_acme?mode=memory"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	store.tenantDBs["acme"] = conn
+
+	results, err := store.SuspendTenants(ctx, []string{"acme", "initech", "missing"})
+	if err != nil {
+		t.Fatalf("Failed to suspend tenants: %v", err)
+	}
+	expected := []SuspendResult{
+		{Schema: "acme", Status: SuspendChanged},
+		{Schema: "initech", Status: SuspendUnchanged},
+		{Schema: "missing", Status: SuspendNotFound},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v", len(expected), results)
+	}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Fatalf("Expected %+v, got %+v", expected[i], results[i])
+		}
+	}
+
+	if status := request("acme"); status != fiber.StatusForbidden {
+		t.Fatalf("Expected suspended acme to be rejected on the next request, got %d", status)
+	}
+	if status := request("globex"); status != fiber.StatusOK {
+		t.Fatalf("Expected globex to keep being served, got %d", status)
+	}
+	if _, connected := store.tenantDBs["acme"]; connected {
+		t.Fatal("Expected the connection of acme to be closed")
+	}
+	if len(events) != 1 || events[0].Type != EventTenantDeactivated || events[0].Schema != "acme" {
+		t.Fatalf("Expected one deactivation event for acme, got %+v", events)
+	}
+
+	events = nil
+	if _, err := store.ResumeTenants(ctx, []string{"acme", "initech"}); err != nil {
+		t.Fatalf("Failed to resume tenants: %v", err)
+	}
+	if status := request("acme"); status != fiber.StatusOK {
+		t.Fatalf("Expected resumed acme to be served, got %d", status)
+	}
+	if status := request("initech"); status != fiber.StatusOK {
+		t.Fatalf("Expected resumed initech to be served, got %d", status)
+	}
+	if len(events) != 2 || events[0].Type != EventTenantActivated {
+		t.Fatalf("Expected two activation events, got %+v", events)
+	}
+}
+
+func TestSuspendTenantsRequiresRegistry(t *testing.T) {
+	store := withConfig(&TenantStore{}, DefaultConfig(""))
+	if _, err := store.SuspendTenants(context.Background(), []string{"acme"}); err != ErrRegistryDisabled {
+		t.Fatalf("Expected ErrRegistryDisabled, got %v", err)
+	}
+}
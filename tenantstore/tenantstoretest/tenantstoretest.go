@@ -0,0 +1,283 @@
+// Package tenantstoretest provides a disposable PostgreSQL server for
+// integration tests of the tenant store.
+//
+// StartPostgres launches a throwaway PostgreSQL container through the Docker
+// CLI and returns an admin DSN for it. The container is shared by every test in
+// the process and started on first use. When Docker is unavailable the calling
+// test is skipped with a message explaining how to point the tests at an
+// existing server instead.
+//
+// NewDatabase creates a dedicated database for a single test, so tests can run
+// in parallel without their schemas, tables or roles' grants colliding.
+//
+// Example usage:
+//
+//	func TestMain(m *testing.M) {
+//		code := m.Run()
+//		tenantstoretest.Stop()
+//		os.Exit(code)
+//	}
+//
+//	func TestSomething(t *testing.T) {
+//		t.Parallel()
+//		dsn := tenantstoretest.NewDatabase(t, tenantstoretest.StartPostgres(t))
+//		// ...
+//	}
+package tenantstoretest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// DefaultImage is the PostgreSQL image started by StartPostgres. It can be
+// overridden with the TENANTSTORETEST_IMAGE environment variable.
+const DefaultImage = "postgres:15-alpine"
+
+// StartupTimeout bounds how long StartPostgres waits for the server to accept
+// connections
+const StartupTimeout = 60 * time.Second
+
+const (
+	containerUser     = "postgres"
+	containerPassword = "postgres"
+)
+
+var (
+	startOnce   sync.Once
+	startErr    error
+	containerID string
+	adminDSN    string
+
+	// databaseCounter keeps database names unique within the process
+	databaseCounter uint64
+)
+
+// StartPostgres returns the admin DSN of a disposable PostgreSQL server,
+// starting the shared container on first use. The test is skipped when Docker
+// is unavailable or the container fails to start.
+func StartPostgres(t testing.TB) string {
+	t.Helper()
+
+	startOnce.Do(func() {
+		containerID, adminDSN, startErr = startContainer()
+	})
+
+	if startErr != nil {
+		t.Skipf("tenantstoretest: PostgreSQL container unavailable (%v); set DATABASE_URL to run against an existing server", startErr)
+	}
+
+	return adminDSN
+}
+
+// StartDedicatedPostgres starts a container for the calling test alone, with
+// args passed to the postgres server, for example "-c", "max_connections=10".
+// It returns the admin DSN and removes the container when the test finishes.
+// The test is skipped when Docker is unavailable.
+func StartDedicatedPostgres(t testing.TB, args ...string) string {
+	t.Helper()
+
+	id, dsn, err := startContainer(args...)
+	if err != nil {
+		t.Skipf("tenantstoretest: PostgreSQL container unavailable (%v)", err)
+	}
+	t.Cleanup(func() {
+		exec.Command("docker", "rm", "-f", id).Run()
+	})
+
+	return dsn
+}
+
+// Stop removes the shared container if one was started. Call it from TestMain
+// after the tests have run.
+func Stop() {
+	if containerID == "" {
+		return
+	}
+	exec.Command("docker", "rm", "-f", containerID).Run()
+	containerID = ""
+}
+
+// NewDatabase creates an empty database on the server behind dsn and returns
+// a DSN for it. The database is dropped when the test finishes. The role in
+// dsn needs the CREATEDB privilege.
+func NewDatabase(t testing.TB, dsn string) string {
+	t.Helper()
+
+	name := fmt.Sprintf("tenantstoretest_%d_%d", os.Getpid(), atomic.AddUint64(&databaseCounter, 1))
+
+	admin, err := open(dsn)
+	if err != nil {
+		t.Fatalf("tenantstoretest: failed to connect to %s: %v", redact(dsn), err)
+	}
+	defer closeDB(admin)
+
+	if err := admin.Exec(fmt.Sprintf("CREATE DATABASE %s", name)).Error; err != nil {
+		t.Fatalf("tenantstoretest: failed to create database %s: %v", name, err)
+	}
+
+	t.Cleanup(func() {
+		admin, err := open(dsn)
+		if err != nil {
+			t.Logf("tenantstoretest: failed to drop database %s: %v", name, err)
+			return
+		}
+		defer closeDB(admin)
+
+		// FORCE terminates connections still held by pools retired in the background
+		if err := admin.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE)", name)).Error; err != nil {
+			t.Logf("tenantstoretest: failed to drop database %s: %v", name, err)
+		}
+	})
+
+	return WithDatabase(dsn, name)
+}
+
+// WithDatabase returns dsn with its database name replaced. Both key=value
+// and URL DSNs are supported.
+func WithDatabase(dsn, database string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			u.Path = "/" + database
+			return u.String()
+		}
+	}
+
+	fields := strings.Fields(dsn)
+	replaced := false
+	for i, field := range fields {
+		if strings.HasPrefix(field, "dbname=") {
+			fields[i] = "dbname=" + database
+			replaced = true
+		}
+	}
+	if !replaced {
+		fields = append(fields, "dbname="+database)
+	}
+	return strings.Join(fields, " ")
+}
+
+// startContainer runs the PostgreSQL image on a random local port, passing
+// args to the server, and waits until it accepts connections
+func startContainer(args ...string) (string, string, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", "", fmt.Errorf("docker not found in PATH")
+	}
+
+	if out, err := exec.Command("docker", "info").CombinedOutput(); err != nil {
+		return "", "", fmt.Errorf("docker daemon not reachable: %s", firstLine(out, err))
+	}
+
+	image := os.Getenv("TENANTSTORETEST_IMAGE")
+	if image == "" {
+		image = DefaultImage
+	}
+
+	run := []string{"run", "-d", "--rm",
+		"-e", "POSTGRES_USER=" + containerUser,
+		"-e", "POSTGRES_PASSWORD=" + containerPassword,
+		"-p", "127.0.0.1::5432",
+		image,
+	}
+	if len(args) > 0 {
+		// Arguments after the image replace the default command
+		run = append(append(run, "postgres"), args...)
+	}
+
+	out, err := exec.Command("docker", run...).CombinedOutput()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to start %s: %s", image, firstLine(out, err))
+	}
+	id := strings.TrimSpace(string(out))
+
+	out, err = exec.Command("docker", "port", id, "5432/tcp").CombinedOutput()
+	if err != nil {
+		exec.Command("docker", "rm", "-f", id).Run()
+		return "", "", fmt.Errorf("failed to read container port: %s", firstLine(out, err))
+	}
+	address := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	port := address[strings.LastIndex(address, ":")+1:]
+
+	dsn := fmt.Sprintf("host=127.0.0.1 port=%s user=%s password=%s dbname=postgres sslmode=disable",
+		port, containerUser, containerPassword)
+
+	if err := waitForPostgres(dsn, StartupTimeout); err != nil {
+		exec.Command("docker", "rm", "-f", id).Run()
+		return "", "", err
+	}
+
+	return id, dsn, nil
+}
+
+// waitForPostgres polls the server until a ping succeeds or the timeout passes
+func waitForPostgres(dsn string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	var lastErr error
+	for time.Now().Before(deadline) {
+		db, err := open(dsn)
+		if err == nil {
+			sqlDB, _ := db.DB()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			err = sqlDB.PingContext(ctx)
+			cancel()
+			sqlDB.Close()
+			if err == nil {
+				return nil
+			}
+		}
+		lastErr = err
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return fmt.Errorf("postgres not ready after %s: %v", timeout, lastErr)
+}
+
+func open(dsn string) (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+}
+
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// redact hides the password in a key=value DSN for error messages
+func redact(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+
+	fields := strings.Fields(dsn)
+	for i, field := range fields {
+		if strings.HasPrefix(field, "password=") {
+			fields[i] = "password=xxxxx"
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+func firstLine(out []byte, err error) string {
+	line := strings.TrimSpace(string(bytes.SplitN(out, []byte("\n"), 2)[0]))
+	if line == "" {
+		return err.Error()
+	}
+	return line
+}
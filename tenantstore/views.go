@@ -0,0 +1,102 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"gorm.io/gorm"
+)
+
+// ViewDefinition describes a view created inside every tenant schema, usually
+// to expose a filtered slice of a shared table in public
+type ViewDefinition struct {
+	// Name of the view inside the tenant schema
+	Name string
+
+	// SQLTemplate is the view's SELECT statement as a text/template.
+	// {{.Schema}} expands to the tenant schema name, for example:
+	//
+	//	SELECT * FROM public.plans WHERE region = (
+	//		SELECT region FROM public.tenants WHERE schema_name = '{{.Schema}}'
+	//	)
+	SQLTemplate string
+}
+
+// viewTemplateData is passed to ViewDefinition.SQLTemplate
+type viewTemplateData struct {
+	Schema string
+}
+
+// RefreshViews drops and recreates Config.TenantViews in the tenant schema so
+// changed definitions take effect. All views are replaced in one transaction.
+func (s *TenantStore) RefreshViews(ctx context.Context, tenantSchema string) error {
+	if tenantSchema == "" {
+		return fmt.Errorf("tenant schema cannot be empty")
+	}
+
+	if s.config().GetMigrationDSN != nil {
+		migrationDB, err := s.openMigrationDB(tenantSchema)
+		if err != nil {
+			return err
+		}
+		defer closeDB(migrationDB)
+
+		return s.createViews(ctx, migrationDB, tenantSchema)
+	}
+
+	return s.createViews(ctx, s.master(), tenantSchema)
+}
+
+// createViews renders Config.TenantViews for the schema and replaces them on db
+func (s *TenantStore) createViews(ctx context.Context, db *gorm.DB, tenantSchema string) error {
+	if len(s.config().TenantViews) == 0 {
+		return nil
+	}
+
+	statements := make([]string, 0, 2*len(s.config().TenantViews))
+	for _, view := range s.config().TenantViews {
+		query, err := renderViewSQL(view, tenantSchema)
+		if err != nil {
+			return err
+		}
+
+		qualified := quoteIdentifier(tenantSchema) + "." + view.Name
+		statements = append(statements,
+			fmt.Sprintf("DROP VIEW IF EXISTS %s", qualified),
+			fmt.Sprintf("CREATE VIEW %s AS %s", qualified, query),
+		)
+	}
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create views for %s: %w", tenantSchema, err)
+	}
+	return nil
+}
+
+// renderViewSQL expands the view template for the schema
+func renderViewSQL(view ViewDefinition, tenantSchema string) (string, error) {
+	if view.Name == "" {
+		return "", fmt.Errorf("view name cannot be empty")
+	}
+
+	tmpl, err := template.New(view.Name).Option("missingkey=error").Parse(view.SQLTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse view %s: %w", view.Name, err)
+	}
+
+	var query strings.Builder
+	if err := tmpl.Execute(&query, viewTemplateData{Schema: tenantSchema}); err != nil {
+		return "", fmt.Errorf("failed to render view %s: %w", view.Name, err)
+	}
+	return query.String(), nil
+}
@@ -0,0 +1,94 @@
+package tenantstore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTenantViewsFilterSharedData(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.TenantViews = []ViewDefinition{{
+		Name:        "plans",
+		SQLTemplate: "SELECT id, name FROM public.plans WHERE tenant = '{{.Schema}}' OR tenant IS NULL",
+	}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	master := store.GetMasterDB()
+	master.Exec("CREATE TABLE public.plans (id serial PRIMARY KEY, name text, tenant text)")
+	master.Exec("INSERT INTO public.plans (name, tenant) VALUES ('free', NULL), ('acme-enterprise', 'tenant_a'), ('globex-custom', 'tenant_b')")
+
+	ctx := context.Background()
+
+	db, err := store.GetTenantDB(ctx, "tenant_a")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	// Unqualified name resolves to the view in the tenant schema
+	var names []string
+	db.Raw("SELECT name FROM plans ORDER BY name").Scan(&names)
+	if len(names) != 2 || names[0] != "acme-enterprise" || names[1] != "free" {
+		t.Fatalf("Expected [acme-enterprise free], got %v", names)
+	}
+
+	// Changed definitions take effect after RefreshViews
+	config.TenantViews[0].SQLTemplate = "SELECT id, name FROM public.plans WHERE tenant = '{{.Schema}}'"
+	if err := store.RefreshViews(ctx, "tenant_a"); err != nil {
+		t.Fatalf("Failed to refresh views: %v", err)
+	}
+
+	names = nil
+	db.Raw("SELECT name FROM plans").Scan(&names)
+	if len(names) != 1 || names[0] != "acme-enterprise" {
+		t.Fatalf("Expected [acme-enterprise] after refresh, got %v", names)
+	}
+}
+
+func TestTenantViewErrorFailsProvisioning(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.TenantViews = []ViewDefinition{{
+		Name:        "broken",
+		SQLTemplate: "SELECT * FROM public.does_not_exist",
+	}}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.GetTenantDB(context.Background(), "tenant_a"); err == nil {
+		t.Fatal("Expected error when a view cannot be created")
+	}
+
+	if len(store.GetAllTenantSchemas()) != 0 {
+		t.Fatal("Expected failed tenant connection not to be cached")
+	}
+}
+
+func TestRenderViewSQL(t *testing.T) {
+	query, err := renderViewSQL(ViewDefinition{
+		Name:        "plans",
+		SQLTemplate: "SELECT * FROM public.plans WHERE tenant = '{{.Schema}}'",
+	}, "acme")
+	if err != nil {
+		t.Fatalf("Failed to render view: %v", err)
+	}
+
+	if query != "SELECT * FROM public.plans WHERE tenant = 'acme'" {
+		t.Fatalf("Unexpected query: %s", query)
+	}
+
+	if _, err := renderViewSQL(ViewDefinition{Name: "bad", SQLTemplate: "{{.Missing}}"}, "acme"); err == nil {
+		t.Fatal("Expected error for unknown template field")
+	}
+}
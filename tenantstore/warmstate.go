@@ -0,0 +1,233 @@
+package tenantstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// DefaultWarmStateTenants is how many tenants ImportWarmState dials when
+// Config.WarmStateTenants is not set
+const DefaultWarmStateTenants = 50
+
+// ErrInvalidWarmState is returned by ImportWarmState for data that is not a
+// state of ExportWarmState
+var ErrInvalidWarmState = errors.New("invalid warm state")
+
+// warmStateVersion is the format version of ExportWarmState
+const warmStateVersion = 1
+
+// warmState is the document exchanged by ExportWarmState and ImportWarmState
+type warmState struct {
+	Version  int          `json:"version"`
+	Exported time.Time    `json:"exported"`
+	Tenants  []warmTenant `json:"tenants"`
+}
+
+// warmTenant is a recently used schema. MigrationHash is empty when the
+// exporting store cannot vouch for the schema's migration.
+type warmTenant struct {
+	Schema        string    `json:"schema"`
+	MigrationHash string    `json:"migration_hash,omitempty"`
+	LastUsed      time.Time `json:"last_used"`
+}
+
+// migrationSchemas caches the models parsed by migrationHash
+var migrationSchemas sync.Map
+
+// migrationHash fingerprints what AutoMigrate creates for the model groups:
+// their tables, columns and indexes, in migration order. Two processes with
+// the same hash migrate a schema to the same layout.
+func migrationHash(groups [][]interface{}) (string, error) {
+	h := sha256.New()
+	for i, group := range groups {
+		fmt.Fprintf(h, "group %d\n", i)
+		for _, model := range group {
+			parsed, err := schema.Parse(model, &migrationSchemas, schema.NamingStrategy{})
+			if err != nil {
+				return "", fmt.Errorf("failed to parse model %T: %w", model, err)
+			}
+
+			fmt.Fprintf(h, "table %s\n", parsed.Table)
+			for _, field := range parsed.Fields {
+				if field.DBName == "" || field.IgnoreMigration {
+					continue
+				}
+				fmt.Fprintf(h, "column %s %s %d %d %d %t %t %t %q\n", field.DBName, field.DataType,
+					field.Size, field.Precision, field.Scale, field.PrimaryKey, field.NotNull, field.Unique, field.DefaultValue)
+			}
+
+			indexes := parsed.ParseIndexes()
+			names := make([]string, 0, len(indexes))
+			for name := range indexes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				index := indexes[name]
+				columns := make([]string, 0, len(index.Fields))
+				for _, field := range index.Fields {
+					columns = append(columns, field.DBName)
+				}
+				fmt.Fprintf(h, "index %s %s %s %s\n", name, index.Class, index.Type, strings.Join(columns, ","))
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+// touch records that the schema was used at t, unless a later use was
+// recorded
+func (s *TenantStore) touch(tenantSchema string, t time.Time) {
+	used, ok := s.lastUsed.Load(tenantSchema)
+	if !ok {
+		// Fiber strings point into reused request buffers
+		used, _ = s.lastUsed.LoadOrStore(strings.Clone(tenantSchema), new(atomic.Int64))
+	}
+	at := used.(*atomic.Int64)
+	for nanos := t.UnixNano(); ; {
+		current := at.Load()
+		if current >= nanos || at.CompareAndSwap(current, nanos) {
+			return
+		}
+	}
+}
+
+// warmMigration reports whether the schema was imported with the migration
+// hash of groups, so its migration can be skipped. The imported hash is
+// only used for the first connection. Callers hold mu.
+func (s *TenantStore) warmMigration(tenantSchema string, groups [][]interface{}) bool {
+	imported, ok := s.warmMigrations[tenantSchema]
+	if !ok {
+		return false
+	}
+	delete(s.warmMigrations, tenantSchema)
+
+	hash, err := migrationHash(groups)
+	return err == nil && hash == imported
+}
+
+// ExportWarmState captures the tenants this store holds connections for, most recently used first, with the hash of the models
+// they were migrated to, as JSON for ImportWarmState on the process that
+// replaces this one. Schemas the store cannot vouch for, because
+// Config.AutoMigrate is off or their inline migration is pending, are
+// exported without a hash.
+func (s *TenantStore) ExportWarmState() ([]byte, error) {
+	state := warmState{Version: warmStateVersion, Exported: time.Now().UTC(), Tenants: []warmTenant{}}
+	vouched := make(map[string]bool)
+
+	s.mu.RLock()
+	for tenantSchema := range s.tenantDBs {
+		used, ok := s.lastUsed.Load(tenantSchema)
+		if !ok {
+			continue
+		}
+		state.Tenants = append(state.Tenants, warmTenant{
+			Schema:   tenantSchema,
+			LastUsed: time.Unix(0, used.(*atomic.Int64).Load()).UTC(),
+		})
+		vouched[tenantSchema] = s.config().AutoMigrate && !s.pendingMigrations[tenantSchema]
+	}
+	s.mu.RUnlock()
+
+	// Config.ModelsFor may query the store, so hash without holding mu
+	ctx := context.Background()
+	for i, tenant := range state.Tenants {
+		if !vouched[tenant.Schema] {
+			continue
+		}
+		groups, err := s.tenantModelGroups(ctx, tenant.Schema)
+		if err != nil {
+			return nil, err
+		}
+		if state.Tenants[i].MigrationHash, err = migrationHash(groups); err != nil {
+			return nil, err
+		}
+	}
+
+	sortWarmTenants(state.Tenants)
+	return json.Marshal(state)
+}
+
+// ImportWarmState reads the state of ExportWarmState from the process this
+// one replaces. The first connection to each schema whose hash matches this
+// store's models skips AutoMigrate and the check for pending migrations;
+// other schemas are migrated as usual. With warm set, the
+// Config.WarmStateTenants most recently used schemas are dialed before it
+// returns. Dial failures are logged, not returned, since the tenants are
+// connected on their next request anyway.
+func (s *TenantStore) ImportWarmState(ctx context.Context, data []byte, warm bool) error {
+	var state warmState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidWarmState, err)
+	}
+	if state.Version != warmStateVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidWarmState, state.Version)
+	}
+	for _, tenant := range state.Tenants {
+		if err := validateSchemaName(tenant.Schema); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidWarmState, err)
+		}
+	}
+
+	s.mu.Lock()
+	if s.warmMigrations == nil {
+		s.warmMigrations = make(map[string]string)
+	}
+	for _, tenant := range state.Tenants {
+		if _, connected := s.tenantDBs[tenant.Schema]; tenant.MigrationHash != "" && !connected {
+			s.warmMigrations[tenant.Schema] = tenant.MigrationHash
+		}
+	}
+	s.mu.Unlock()
+
+	if !warm {
+		return nil
+	}
+
+	limit := s.config().WarmStateTenants
+	if limit <= 0 {
+		limit = DefaultWarmStateTenants
+	}
+	sortWarmTenants(state.Tenants)
+	if len(state.Tenants) > limit {
+		state.Tenants = state.Tenants[:limit]
+	}
+	for _, tenant := range state.Tenants {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if s.closing.Load() {
+			return ErrStoreClosing
+		}
+		if _, err := s.tenantDB(ctx, tenant.Schema); err != nil {
+			s.config().Logger.Warn(ctx, "failed to warm %s from the warm state: %v", tenant.Schema, err)
+			continue
+		}
+		// Keep the order for the next handoff
+		if used, ok := s.lastUsed.Load(tenant.Schema); ok {
+			used.(*atomic.Int64).Store(tenant.LastUsed.UnixNano())
+		}
+	}
+	return nil
+}
+
+// sortWarmTenants orders tenants by last use, most recent first
+func sortWarmTenants(tenants []warmTenant) {
+	sort.SliceStable(tenants, func(i, j int) bool {
+		if !tenants[i].LastUsed.Equal(tenants[j].LastUsed) {
+			return tenants[i].LastUsed.After(tenants[j].LastUsed)
+		}
+		return tenants[i].Schema < tenants[j].Schema
+	})
+}
@@ -0,0 +1,205 @@
+package tenantstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// newWarmStateStore returns a store holding connections for schemas, which
+// are never used
+func newWarmStateStore(models []interface{}, schemas ...string) *TenantStore {
+	config := DefaultConfig("")
+	config.Models = models
+	store := withConfig(&TenantStore{
+		tenantDBs:         make(map[string]*gorm.DB),
+		pendingMigrations: make(map[string]bool),
+	}, config)
+	for _, tenantSchema := range schemas {
+		store.tenantDBs[tenantSchema] = nil
+	}
+	return store
+}
+
+func TestMigrationHash(t *testing.T) {
+	first, err := migrationHash([][]interface{}{{&TestModel{}}})
+	if err != nil {
+		t.Fatalf("Failed to hash: %v", err)
+	}
+	second, _ := migrationHash([][]interface{}{{&TestModel{}}})
+	if first != second {
+		t.Fatalf("Expected a stable hash, got %s and %s", first, second)
+	}
+
+	// A new column and index change the hash
+	changed, _ := migrationHash([][]interface{}{{&inlineModel{}}})
+	if changed == first {
+		t.Fatal("Expected the changed model to hash differently")
+	}
+}
+
+func TestExportWarmState(t *testing.T) {
+	store := newWarmStateStore([]interface{}{&TestModel{}}, "acme", "globex", "idle")
+	store.pendingMigrations["globex"] = true
+
+	now := time.Now()
+	store.touch("acme", now.Add(-time.Minute))
+	store.touch("globex", now)
+	store.touch("acme", now.Add(-time.Hour))
+	store.touch("evicted", now)
+
+	data, err := store.ExportWarmState()
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	var state warmState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("Failed to parse the export: %v", err)
+	}
+
+	// Tenants without a connection or without use are left out, and
+	// earlier uses never move a tenant back
+	if len(state.Tenants) != 2 || state.Tenants[0].Schema != "globex" || state.Tenants[1].Schema != "acme" {
+		t.Fatalf("Expected globex and acme, got %+v", state.Tenants)
+	}
+	if !state.Tenants[1].LastUsed.Equal(now.Add(-time.Minute)) {
+		t.Fatalf("Expected acme's last use, got %v", state.Tenants[1].LastUsed)
+	}
+
+	// Pending migrations are not vouched for
+	hash, _ := migrationHash(store.modelGroups())
+	if state.Tenants[1].MigrationHash != hash || state.Tenants[0].MigrationHash != "" {
+		t.Fatalf("Expected a hash for acme only, got %+v", state.Tenants)
+	}
+}
+
+func TestImportWarmStateSkipsMigration(t *testing.T) {
+	old := newWarmStateStore([]interface{}{&TestModel{}}, "acme", "globex")
+	old.touch("acme", time.Now())
+	old.touch("globex", time.Now())
+	data, err := old.ExportWarmState()
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	ctx := context.Background()
+	store := newWarmStateStore([]interface{}{&TestModel{}})
+	if err := store.ImportWarmState(ctx, data, false); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if migrate, err := store.inlineMigration(ctx, "acme", store.modelGroups()); migrate || err != nil {
+		t.Fatalf("Expected the imported schema to skip migration, got %v, %v", migrate, err)
+	}
+
+	// Only the first connection is skipped
+	if migrate, _ := store.inlineMigration(ctx, "acme", store.modelGroups()); !migrate {
+		t.Fatal("Expected acme to migrate once its imported state was used")
+	}
+	if migrate, _ := store.inlineMigration(ctx, "initech", store.modelGroups()); !migrate {
+		t.Fatal("Expected schemas missing from the state to migrate")
+	}
+
+	// Removed schemas may come back empty
+	store.RemoveTenantDB("globex")
+	if migrate, _ := store.inlineMigration(ctx, "globex", store.modelGroups()); !migrate {
+		t.Fatal("Expected a removed schema to migrate")
+	}
+}
+
+func TestImportWarmStateMigratesChangedModels(t *testing.T) {
+	old := newWarmStateStore([]interface{}{&TestModel{}}, "acme")
+	old.touch("acme", time.Now())
+	data, err := old.ExportWarmState()
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	// The new release added a column and an index
+	ctx := context.Background()
+	store := newWarmStateStore([]interface{}{&inlineModel{}})
+	if err := store.ImportWarmState(ctx, data, false); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if migrate, err := store.inlineMigration(ctx, "acme", store.modelGroups()); !migrate || err != nil {
+		t.Fatalf("Expected a schema with another hash to migrate, got %v, %v", migrate, err)
+	}
+}
+
+func TestImportWarmStateRejectsInvalidState(t *testing.T) {
+	store := newWarmStateStore(nil)
+	ctx := context.Background()
+
+	for _, data := range []string{
+		`not json`,
+		`{"version":2,"tenants":[]}`,
+		`{"version":1,"tenants":[{"schema":""}]}`,
+	} {
+		if err := store.ImportWarmState(ctx, []byte(data), false); !errors.Is(err, ErrInvalidWarmState) {
+			t.Fatalf("Expected %s to be rejected", data)
+		}
+	}
+	if len(store.warmMigrations) != 0 {
+		t.Fatalf("Expected nothing imported, got %v", store.warmMigrations)
+	}
+}
+
+func TestImportWarmStateWarmsTenants(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig(getTestDSN(t))
+	config.Models = []interface{}{&TestModel{}}
+	old, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer old.Close()
+
+	ctx := context.Background()
+	for _, tenantSchema := range []string{"tenant_warm_a", "tenant_warm_b", "tenant_warm_c"} {
+		if _, err := old.GetTenantDB(ctx, tenantSchema); err != nil {
+			t.Fatalf("Failed to get tenant DB: %v", err)
+		}
+	}
+	data, err := old.ExportWarmState()
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	// Without its table, a skipped migration shows
+	if err := old.GetMasterDB().Exec("DROP TABLE tenant_warm_c.test_models").Error; err != nil {
+		t.Fatalf("Failed to drop table: %v", err)
+	}
+
+	newConfig := DefaultConfig(config.MasterDSN)
+	newConfig.Models = []interface{}{&TestModel{}}
+	newConfig.WarmStateTenants = 2
+	store, err := New(newConfig)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.ImportWarmState(ctx, data, true); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if len(store.tenantDBs) != 2 {
+		t.Fatalf("Expected the 2 most recent tenants dialed, got %d", len(store.tenantDBs))
+	}
+	if _, connected := store.tenantDBs["tenant_warm_c"]; !connected {
+		t.Fatal("Expected the most recently used tenant to be dialed")
+	}
+	if store.master().Migrator().HasTable("tenant_warm_c.test_models") {
+		t.Fatal("Expected the imported schema not to be migrated again")
+	}
+
+	// The state travels on to the next deployment
+	next, err := store.ExportWarmState()
+	if err != nil || !strings.Contains(string(next), "tenant_warm_c") {
+		t.Fatalf("Expected the dialed tenants in the next export, got %s (%v)", next, err)
+	}
+}
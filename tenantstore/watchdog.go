@@ -0,0 +1,181 @@
+package tenantstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultApplicationName prefixes the application_name of tenant sessions
+// when the watchdog is on and Config.ApplicationName is empty
+const DefaultApplicationName = "mt"
+
+// maxApplicationNameLength is PostgreSQL's limit; longer names are truncated
+const maxApplicationNameLength = 63
+
+// LongTransaction is a tenant session whose transaction has been open for
+// longer than Config.MaxTransactionAge
+type LongTransaction struct {
+	Schema     string        `json:"schema"`
+	PID        int           `json:"pid"`
+	State      string        `json:"state"`
+	Age        time.Duration `json:"age"`
+	Query      string        `json:"query"`
+	Terminated bool          `json:"terminated"`
+}
+
+// watchdog periodically looks for long transactions
+type watchdog struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	findings []LongTransaction
+}
+
+// applicationName returns the application_name of the tenant's sessions
+func (s *TenantStore) applicationName(tenantSchema string) string {
+	prefix := s.config().ApplicationName
+	if prefix == "" {
+		prefix = DefaultApplicationName
+	}
+
+	name := prefix + ":" + tenantSchema
+	if len(name) > maxApplicationNameLength {
+		name = name[:maxApplicationNameLength]
+	}
+	return name
+}
+
+// startWatchdog starts the background check if MaxTransactionAge is set
+func (s *TenantStore) startWatchdog() {
+	if s.config().MaxTransactionAge <= 0 {
+		return
+	}
+
+	interval := s.config().WatchdogInterval
+	if interval <= 0 {
+		interval = s.config().MaxTransactionAge / 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.watchdog = &watchdog{cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(s.watchdog.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			findings, err := s.CheckTransactions(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.config().Logger.Error(ctx, "transaction watchdog failed: %v", err)
+				}
+				continue
+			}
+			s.watchdog.mu.Lock()
+			s.watchdog.findings = findings
+			s.watchdog.mu.Unlock()
+		}
+	}()
+}
+
+// stopWatchdog stops the background check and waits for it to return
+func (s *TenantStore) stopWatchdog() {
+	if s.watchdog == nil {
+		return
+	}
+	s.watchdog.cancel()
+	<-s.watchdog.done
+}
+
+// longTransactions returns the findings of the last background check
+func (s *TenantStore) longTransactions() []LongTransaction {
+	if s.watchdog == nil {
+		return nil
+	}
+	s.watchdog.mu.Lock()
+	defer s.watchdog.mu.Unlock()
+	return s.watchdog.findings
+}
+
+// CheckTransactions looks in pg_stat_activity for sessions of this store's
+// cached tenant connections whose transaction is older than
+// Config.MaxTransactionAge. Each is logged, passed to
+// Config.OnLongTransaction and, with TerminateLongTransactions, terminated.
+// The watchdog calls it every WatchdogInterval; call it directly to check
+// on demand.
+func (s *TenantStore) CheckTransactions(ctx context.Context) ([]LongTransaction, error) {
+	if s.config().MaxTransactionAge <= 0 {
+		return nil, fmt.Errorf("transaction watchdog requires MaxTransactionAge")
+	}
+
+	s.mu.RLock()
+	schemas := make(map[string]string, len(s.tenantDBs))
+	for tenantSchema := range s.tenantDBs {
+		schemas[s.applicationName(tenantSchema)] = tenantSchema
+	}
+	s.mu.RUnlock()
+	if len(schemas) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+
+	var rows []struct {
+		PID             int
+		ApplicationName string
+		State           string
+		AgeSeconds      float64
+		Query           string
+	}
+	err := s.master().WithContext(ctx).Raw(`
+		SELECT pid, application_name, state,
+			EXTRACT(EPOCH FROM now() - xact_start) AS age_seconds, query
+		FROM pg_stat_activity
+		WHERE application_name IN ?
+		AND xact_start < now() - make_interval(secs => ?)
+		AND pid <> pg_backend_pid()
+		ORDER BY xact_start`, names, s.config().MaxTransactionAge.Seconds()).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect tenant sessions: %w", err)
+	}
+
+	findings := make([]LongTransaction, 0, len(rows))
+	for _, row := range rows {
+		finding := LongTransaction{
+			Schema: schemas[row.ApplicationName],
+			PID:    row.PID,
+			State:  row.State,
+			Age:    time.Duration(row.AgeSeconds * float64(time.Second)),
+			Query:  row.Query,
+		}
+
+		if s.config().TerminateLongTransactions {
+			err := s.master().WithContext(ctx).Raw("SELECT pg_terminate_backend(?)", row.PID).Scan(&finding.Terminated).Error
+			if err != nil {
+				s.config().Logger.Error(ctx, "failed to terminate backend %d of %s: %v", row.PID, finding.Schema, err)
+			}
+		}
+
+		s.config().Logger.Warn(ctx, "tenant %s: transaction open for %v in backend %d (%s, terminated: %v): %s",
+			finding.Schema, finding.Age.Round(time.Second), finding.PID, finding.State, finding.Terminated, finding.Query)
+		if s.config().OnLongTransaction != nil {
+			s.config().OnLongTransaction(ctx, finding)
+		}
+		findings = append(findings, finding)
+	}
+
+	return findings, nil
+}
@@ -0,0 +1,97 @@
+package tenantstore
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestApplicationName(t *testing.T) {
+	store := withConfig(&TenantStore{}, &Config{})
+	if name := store.applicationName("acme"); name != "mt:acme" {
+		t.Fatalf("Expected mt:acme, got %s", name)
+	}
+
+	store = withConfig(&TenantStore{}, &Config{ApplicationName: "billing"})
+	long := strings.Repeat("x", MaxSchemaNameLength)
+	if name := store.applicationName(long); len(name) != maxApplicationNameLength || !strings.HasPrefix(name, "billing:x") {
+		t.Fatalf("Expected a truncated name, got %s", name)
+	}
+
+	if _, err := store.CheckTransactions(context.Background()); err == nil {
+		t.Fatal("Expected an error without MaxTransactionAge")
+	}
+}
+
+func TestTransactionWatchdog(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		findings []LongTransaction
+	)
+	config := DefaultConfig(getTestDSN(t))
+	config.MaxTransactionAge = 200 * time.Millisecond
+	config.WatchdogInterval = 50 * time.Millisecond
+	config.TerminateLongTransactions = true
+	config.OnLongTransaction = func(ctx context.Context, tx LongTransaction) {
+		mu.Lock()
+		findings = append(findings, tx)
+		mu.Unlock()
+	}
+
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	db, err := store.GetTenantDB(ctx, "stuck")
+	if err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+	if _, err := store.GetTenantDB(ctx, "healthy"); err != nil {
+		t.Fatalf("Failed to get tenant DB: %v", err)
+	}
+
+	// Leave a transaction idle past the threshold
+	tx := db.Begin()
+	if err := tx.Exec("SELECT 1").Error; err != nil {
+		t.Fatalf("Failed to start transaction: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	mu.Lock()
+	got := append([]LongTransaction(nil), findings...)
+	mu.Unlock()
+	if len(got) == 0 {
+		t.Fatal("Expected the hook to fire for the idle transaction")
+	}
+	for _, finding := range got {
+		if finding.Schema != "stuck" {
+			t.Fatalf("Expected only the stuck tenant, got %+v", finding)
+		}
+	}
+	if got[0].Age < config.MaxTransactionAge || !strings.HasPrefix(got[0].State, "idle in transaction") || !got[0].Terminated {
+		t.Fatalf("Expected a terminated idle transaction older than the limit, got %+v", got[0])
+	}
+
+	// The terminated session's transaction is gone
+	if err := tx.Exec("SELECT 1").Error; err == nil {
+		t.Fatal("Expected the terminated transaction to fail")
+	}
+	tx.Rollback()
+
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	for _, stat := range stats {
+		if stat.Schema == "stuck" && stat.Settings["application_name"] != "mt:stuck" {
+			t.Fatalf("Expected the session to be named after the tenant, got %v", stat.Settings)
+		}
+	}
+}
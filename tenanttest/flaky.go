@@ -0,0 +1,97 @@
+package tenanttest
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+// TenantStore is the store interface of the multitenant middleware
+type TenantStore interface {
+	GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error)
+	GetMasterDB() *gorm.DB
+}
+
+// Flaky wraps a store and fails a share of GetTenantDB calls with
+// tenantstore.ErrConnectionFailed, which the middleware reports as 503
+type Flaky struct {
+	store    TenantStore
+	rate     float64
+	failures atomic.Int64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// FlakyStore returns a store that fails GetTenantDB with probability rate,
+// between 0 (never) and 1 (always), and otherwise calls store. Only the
+// middleware's TenantStore methods are wrapped, so optional interfaces such
+// as TenantActivityChecker are not available through it.
+func FlakyStore(store TenantStore, rate float64) *Flaky {
+	return &Flaky{
+		store: store,
+		rate:  rate,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// GetTenantDB fails or returns the wrapped store's database
+func (f *Flaky) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	f.mu.Lock()
+	fail := f.rand.Float64() < f.rate
+	f.mu.Unlock()
+
+	if fail {
+		f.failures.Add(1)
+		return nil, tenantstore.ErrConnectionFailed
+	}
+	return f.store.GetTenantDB(ctx, tenantSchema)
+}
+
+// GetMasterDB returns the wrapped store's master database
+func (f *Flaky) GetMasterDB() *gorm.DB {
+	return f.store.GetMasterDB()
+}
+
+// Failures returns how many calls were failed
+func (f *Flaky) Failures() int {
+	return int(f.failures.Load())
+}
+
+// FailTenants returns a tenantstore.Config.FailpointInjector that fails
+// every operation on the given schemas with err
+func FailTenants(err error, schemas ...string) func(op, schema string) error {
+	failing := make(map[string]bool, len(schemas))
+	for _, schema := range schemas {
+		failing[schema] = true
+	}
+
+	return func(op, schema string) error {
+		if failing[schema] {
+			return err
+		}
+		return nil
+	}
+}
+
+// FailEveryNth returns a tenantstore.Config.FailpointInjector that fails
+// every nth call of op with err. An empty op counts every operation.
+func FailEveryNth(n int, op string, err error) func(op, schema string) error {
+	var calls atomic.Int64
+
+	return func(called, schema string) error {
+		if op != "" && called != op {
+			return nil
+		}
+		if n > 0 && calls.Add(1)%int64(n) == 0 {
+			return err
+		}
+		return nil
+	}
+}
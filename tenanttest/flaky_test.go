@@ -0,0 +1,81 @@
+package tenanttest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/1Nelsonel/fiber-multitenant/middleware"
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+func TestFlakyStore(t *testing.T) {
+	for _, tc := range []struct {
+		rate     float64
+		status   int
+		failures int
+	}{
+		{rate: 0, status: fiber.StatusOK, failures: 0},
+		{rate: 1, status: fiber.StatusServiceUnavailable, failures: 3},
+	} {
+		flaky := FlakyStore(NewStore(t), tc.rate)
+
+		app := fiber.New()
+		app.Use(middleware.New(middleware.Config{
+			Store:    flaky,
+			Resolver: middleware.HeaderResolver(TenantHeader),
+		}))
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendString(middleware.GetTenant(c))
+		})
+
+		for i := 0; i < 3; i++ {
+			resp, err := Request(app, "GET", "/", WithTenantHeader("acme"))
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+			if resp.StatusCode != tc.status {
+				t.Fatalf("Expected status %d at rate %v, got %d", tc.status, tc.rate, resp.StatusCode)
+			}
+		}
+
+		if flaky.Failures() != tc.failures {
+			t.Fatalf("Expected %d failures at rate %v, got %d", tc.failures, tc.rate, flaky.Failures())
+		}
+		if flaky.GetMasterDB() == nil {
+			t.Fatal("Expected the master DB to pass through")
+		}
+	}
+}
+
+func TestFailpointInjectors(t *testing.T) {
+	inject := FailTenants(tenantstore.ErrConnectionFailed, "acme")
+	if !errors.Is(inject(tenantstore.FailpointGetTenantDB, "acme"), tenantstore.ErrConnectionFailed) {
+		t.Fatal("Expected acme to fail")
+	}
+	if inject(tenantstore.FailpointGetTenantDB, "globex") != nil {
+		t.Fatal("Expected globex not to fail")
+	}
+
+	inject = FailEveryNth(3, tenantstore.FailpointMigrate, tenantstore.ErrConnectionFailed)
+	var failed []int
+	for i := 1; i <= 6; i++ {
+		// Other operations are not counted
+		if inject(tenantstore.FailpointEnsureSchema, "acme") != nil {
+			t.Fatal("Expected other operations not to fail")
+		}
+		if inject(tenantstore.FailpointMigrate, "acme") != nil {
+			failed = append(failed, i)
+		}
+	}
+	if len(failed) != 2 || failed[0] != 3 || failed[1] != 6 {
+		t.Fatalf("Expected calls 3 and 6 to fail, got %v", failed)
+	}
+
+	// The flaky store's error carries the status the middleware reports
+	var statusErr middleware.StatusError
+	if !errors.As(tenantstore.ErrConnectionFailed, &statusErr) || statusErr.HTTPStatus() != fiber.StatusServiceUnavailable {
+		t.Fatal("Expected ErrConnectionFailed to map to 503")
+	}
+}
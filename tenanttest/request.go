@@ -0,0 +1,65 @@
+package tenanttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TenantHeader is the header set by WithTenantHeader
+const TenantHeader = "X-Tenant-ID"
+
+// RequestOption customizes a request built by Request
+type RequestOption func(*http.Request)
+
+// WithTenantHeader sets TenantHeader to the tenant
+func WithTenantHeader(tenant string) RequestOption {
+	return WithHeader(TenantHeader, tenant)
+}
+
+// WithTenantSubdomain sends the request to tenant.localhost
+func WithTenantSubdomain(tenant string) RequestOption {
+	return func(req *http.Request) {
+		req.Host = tenant + ".localhost"
+	}
+}
+
+// WithHeader sets a request header
+func WithHeader(key, value string) RequestOption {
+	return func(req *http.Request) {
+		req.Header.Set(key, value)
+	}
+}
+
+// WithBody sets the request body
+func WithBody(body io.Reader) RequestOption {
+	return func(req *http.Request) {
+		req.Body = io.NopCloser(body)
+	}
+}
+
+// WithJSON encodes v as the JSON request body
+func WithJSON(v interface{}) RequestOption {
+	return func(req *http.Request) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			panic("tenanttest: failed to encode JSON body: " + err.Error())
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+}
+
+// Request performs a request against the app and returns the response
+func Request(app *fiber.App, method, path string, opts ...RequestOption) (*http.Response, error) {
+	req := httptest.NewRequest(method, path, nil)
+	for _, opt := range opts {
+		opt(req)
+	}
+	return app.Test(req, -1)
+}
@@ -0,0 +1,255 @@
+// Package tenanttest provides test utilities for applications using the
+// multitenant middleware.
+//
+// It offers an in-memory TenantStore backed by one SQLite database per tenant,
+// so handlers that use middleware.GetTenantDB can run real queries without a
+// PostgreSQL server, plus helpers for building tenant-scoped requests.
+//
+// Example usage:
+//
+//	func TestListUsers(t *testing.T) {
+//		store := tenanttest.NewStore(t, &User{})
+//		tenanttest.Seed(store, "acme", &User{Name: "Jane"})
+//
+//		app := fiber.New()
+//		app.Use(middleware.New(middleware.Config{
+//			Store:    store,
+//			Resolver: middleware.HeaderResolver(tenanttest.TenantHeader),
+//		}))
+//		app.Get("/users", listUsers)
+//
+//		resp, err := tenanttest.Request(app, "GET", "/users", tenanttest.WithTenantHeader("acme"))
+//		// ...
+//	}
+package tenanttest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+// databaseCounter keeps in-memory database names unique within the process
+var databaseCounter uint64
+
+// Store is an in-memory tenant store for tests. Each tenant gets its own
+// SQLite database, created and migrated on first access.
+type Store struct {
+	t        testing.TB
+	models   []interface{}
+	masterDB *gorm.DB
+	tenants  map[string]*gorm.DB
+	inactive map[string]bool
+	settings map[string]map[string]string
+	mu       sync.Mutex
+}
+
+// NewStore creates an in-memory store that migrates models into every tenant
+// database. All databases are closed when the test finishes.
+func NewStore(t testing.TB, models ...interface{}) *Store {
+	t.Helper()
+
+	store := &Store{
+		t:        t,
+		models:   models,
+		tenants:  make(map[string]*gorm.DB),
+		inactive: make(map[string]bool),
+		settings: make(map[string]map[string]string),
+	}
+
+	masterDB, err := openDatabase()
+	if err != nil {
+		t.Fatalf("tenanttest: failed to open master database: %v", err)
+	}
+	store.masterDB = masterDB
+
+	t.Cleanup(store.close)
+
+	return store
+}
+
+// GetTenantDB returns the database for the tenant, creating it if needed
+func (s *Store) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	if tenantSchema == "" {
+		return nil, fmt.Errorf("tenant schema cannot be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if db, exists := s.tenants[tenantSchema]; exists {
+		return db, nil
+	}
+
+	// Fiber strings point into reused request buffers
+	tenantSchema = strings.Clone(tenantSchema)
+
+	db, err := openDatabase()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tenant database: %w", err)
+	}
+
+	if len(s.models) > 0 {
+		if err := db.AutoMigrate(s.models...); err != nil {
+			return nil, fmt.Errorf("failed to auto-migrate models: %w", err)
+		}
+	}
+
+	// Hooks read the tenant like they would with tenantstore.TenantStore
+	db = tenantstore.WithSchema(db, tenantSchema)
+
+	s.tenants[tenantSchema] = db
+	return db, nil
+}
+
+// GetMasterDB returns the master database
+func (s *Store) GetMasterDB() *gorm.DB {
+	return s.masterDB
+}
+
+// Tenants returns the tenants that have a database
+func (s *Store) Tenants() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenants := make([]string, 0, len(s.tenants))
+	for tenant := range s.tenants {
+		tenants = append(tenants, tenant)
+	}
+	return tenants
+}
+
+// ListSchemas returns the tenants that have a database, sorted by name
+func (s *Store) ListSchemas(ctx context.Context) ([]string, error) {
+	tenants := s.Tenants()
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// ForEachTenant calls fn for every tenant returned by ListSchemas. Tenants are
+// visited one at a time regardless of opts.Concurrency; failures are returned
+// as tenantstore.TenantErrors like the real store.
+func (s *Store) ForEachTenant(ctx context.Context, fn tenantstore.TenantFunc, opts tenantstore.ForEachOptions) error {
+	tenants, _ := s.ListSchemas(ctx)
+
+	failures := tenantstore.TenantErrors{}
+	for _, tenant := range tenants {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		db, err := s.GetTenantDB(ctx, tenant)
+		if err == nil {
+			err = fn(ctx, tenant, db)
+		}
+		if err != nil {
+			failures[tenant] = err
+			if !opts.ContinueOnError {
+				break
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+// Deactivate marks the tenant inactive for IsTenantActive
+func (s *Store) Deactivate(tenant string) {
+	s.mu.Lock()
+	s.inactive[tenant] = true
+	s.mu.Unlock()
+}
+
+// Activate marks the tenant active again
+func (s *Store) Activate(tenant string) {
+	s.mu.Lock()
+	delete(s.inactive, tenant)
+	s.mu.Unlock()
+}
+
+// IsTenantActive reports whether the tenant was not deactivated. Unlike the
+// registry, unknown tenants are active.
+func (s *Store) IsTenantActive(ctx context.Context, tenantSchema string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.inactive[tenantSchema], nil
+}
+
+// SetSettings replaces the tenant's settings returned by TenantSettings
+func (s *Store) SetSettings(tenant string, settings map[string]string) {
+	s.mu.Lock()
+	s.settings[tenant] = settings
+	s.mu.Unlock()
+}
+
+// TenantSettings returns the settings set with SetSettings
+func (s *Store) TenantSettings(ctx context.Context, tenantSchema string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings[tenantSchema], nil
+}
+
+// Seed inserts records into the tenant's database, failing the test on error
+func Seed(store *Store, tenant string, records ...interface{}) {
+	store.t.Helper()
+
+	db, err := store.GetTenantDB(context.Background(), tenant)
+	if err != nil {
+		store.t.Fatalf("tenanttest: failed to get database for %s: %v", tenant, err)
+	}
+
+	for _, record := range records {
+		if err := db.Create(record).Error; err != nil {
+			store.t.Fatalf("tenanttest: failed to seed %T into %s: %v", record, tenant, err)
+		}
+	}
+}
+
+// close closes every database opened by the store
+func (s *Store) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, db := range s.tenants {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+	if sqlDB, err := s.masterDB.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// openDatabase opens a fresh in-memory SQLite database. A single connection
+// keeps the database alive and avoids SQLite table locking between requests.
+func openDatabase() (*gorm.DB, error) {
+	name := fmt.Sprintf("file:tenanttest_%d?mode=memory&cache=shared", atomic.AddUint64(&databaseCounter, 1))
+
+	db, err := gorm.Open(sqlite.Open(name), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	return db, nil
+}
@@ -0,0 +1,86 @@
+package tenanttest
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type testUser struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func TestStoreIsolatesTenants(t *testing.T) {
+	store := NewStore(t, &testUser{})
+
+	Seed(store, "acme", &testUser{Name: "Jane"}, &testUser{Name: "John"})
+	Seed(store, "globex", &testUser{Name: "Hank"})
+
+	ctx := context.Background()
+
+	acme, err := store.GetTenantDB(ctx, "acme")
+	if err != nil {
+		t.Fatalf("Failed to get acme DB: %v", err)
+	}
+
+	globex, err := store.GetTenantDB(ctx, "globex")
+	if err != nil {
+		t.Fatalf("Failed to get globex DB: %v", err)
+	}
+
+	var acmeCount, globexCount int64
+	acme.Model(&testUser{}).Count(&acmeCount)
+	globex.Model(&testUser{}).Count(&globexCount)
+
+	if acmeCount != 2 || globexCount != 1 {
+		t.Fatalf("Expected 2 acme and 1 globex users, got %d and %d", acmeCount, globexCount)
+	}
+
+	if len(store.Tenants()) != 2 {
+		t.Fatalf("Expected 2 tenants, got %d", len(store.Tenants()))
+	}
+}
+
+func TestStoreCachesTenantDB(t *testing.T) {
+	store := NewStore(t)
+	ctx := context.Background()
+
+	db1, _ := store.GetTenantDB(ctx, "acme")
+	db2, _ := store.GetTenantDB(ctx, "acme")
+
+	if db1 != db2 {
+		t.Fatal("Expected same DB instance for the same tenant")
+	}
+
+	if _, err := store.GetTenantDB(ctx, ""); err == nil {
+		t.Fatal("Expected error when tenant schema is empty")
+	}
+
+	if store.GetMasterDB() == nil {
+		t.Fatal("Expected master DB to be non-nil")
+	}
+}
+
+func TestRequestOptions(t *testing.T) {
+	app := fiber.New()
+	app.Post("/echo", func(c *fiber.Ctx) error {
+		return c.SendString(c.Get(TenantHeader) + "|" + c.Hostname() + "|" + string(c.Body()))
+	})
+
+	resp, err := Request(app, "POST", "/echo",
+		WithTenantHeader("acme"),
+		WithTenantSubdomain("acme"),
+		WithJSON(map[string]string{"name": "Jane"}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to test: %v", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != `acme|acme.localhost|{"name":"Jane"}` {
+		t.Fatalf("Unexpected echo: %s", string(body))
+	}
+}
@@ -0,0 +1,469 @@
+// Package webhooks delivers tenant lifecycle events to external systems,
+// such as billing, as signed HTTP callbacks.
+//
+// A Dispatcher records every event it receives in a deliveries table before
+// attempting delivery, so events survive restarts, and posts them to each
+// configured URL until it accepts them or the attempts run out. Delivery is at
+// least once: receivers should deduplicate by the X-Webhook-ID header.
+//
+// Example usage:
+//
+//	hooks, err := webhooks.New(webhooks.Config{
+//		DB:     store.GetMasterDB(),
+//		URLs:   []string{"https://billing.example.com/hooks/tenants"},
+//		Secret: os.Getenv("WEBHOOK_SECRET"),
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	hooks.Start()
+//	defer hooks.Close()
+//
+//	config.OnTenantEvent = hooks.OnTenantEvent
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+// Headers set on every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	IDHeader        = "X-Webhook-ID"
+)
+
+// Defaults used when the Config fields are zero
+const (
+	DefaultMaxAttempts    = 8
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 10 * time.Minute
+	DefaultPollInterval   = 5 * time.Second
+	DefaultTimeout        = 10 * time.Second
+)
+
+// claimDuration is how long a delivery in flight is hidden from other
+// dispatchers sharing the table
+const claimDuration = time.Minute
+
+// Config configures a Dispatcher
+type Config struct {
+	// DB stores the deliveries, usually the master DB. Required.
+	DB *gorm.DB
+
+	// URLs receive every event. Required.
+	URLs []string
+
+	// Secret signs payloads with HMAC-SHA256. Required.
+	Secret string
+
+	// Optional: Events limits delivery to these event types. Defaults to
+	// every lifecycle event.
+	Events []tenantstore.TenantEventType
+
+	// Optional: Metadata adds fields to the payload of an event, such as the
+	// tenant's plan
+	Metadata func(ctx context.Context, event tenantstore.TenantEvent) map[string]string
+
+	// Optional: Client posts the payloads. Defaults to a client with a
+	// Timeout of DefaultTimeout.
+	Client *http.Client
+
+	// Optional: MaxAttempts is the number of attempts per URL before a
+	// delivery is marked failed (default DefaultMaxAttempts)
+	MaxAttempts int
+
+	// Optional: InitialBackoff is the delay before the first retry; it
+	// doubles after every attempt up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Optional: PollInterval is how often the dispatcher started with Start
+	// looks for due deliveries (default DefaultPollInterval). New events are
+	// sent at once.
+	PollInterval time.Duration
+
+	// Optional: OnFailed is called when a delivery runs out of attempts
+	OnFailed func(delivery Delivery)
+}
+
+// Payload is the JSON body posted for an event
+type Payload struct {
+	ID        string                      `json:"id"`
+	Type      tenantstore.TenantEventType `json:"type"`
+	Tenant    string                      `json:"tenant"`
+	Timestamp time.Time                   `json:"timestamp"`
+	Metadata  map[string]string           `json:"metadata,omitempty"`
+}
+
+// Status is the state of a delivery
+type Status string
+
+// Delivery states
+const (
+	StatusPending   Status = "pending"
+	StatusDelivered Status = "delivered"
+	StatusFailed    Status = "failed"
+)
+
+// Delivery is an event to be posted to one URL
+type Delivery struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	EventID       string     `gorm:"size:32;index;not null" json:"event_id"`
+	EventType     string     `gorm:"size:64;not null" json:"event_type"`
+	Tenant        string     `gorm:"size:63;index;not null" json:"tenant"`
+	URL           string     `gorm:"not null" json:"url"`
+	Payload       string     `gorm:"not null" json:"payload"`
+	Status        Status     `gorm:"size:16;index:idx_tenant_webhook_due;not null" json:"status"`
+	Attempts      int        `gorm:"not null" json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `gorm:"index:idx_tenant_webhook_due" json:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName is the deliveries table
+func (Delivery) TableName() string {
+	return "tenant_webhook_deliveries"
+}
+
+// DeliveryFilter selects deliveries for Deliveries. Zero fields match all.
+type DeliveryFilter struct {
+	EventID string
+	Tenant  string
+	Status  Status
+
+	// Limit caps the result (default 100), newest first
+	Limit int
+}
+
+// Dispatcher records tenant events and delivers them
+type Dispatcher struct {
+	cfg    Config
+	events map[tenantstore.TenantEventType]bool
+
+	// now is the clock, replaced in tests
+	now func() time.Time
+
+	mu     sync.Mutex
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New validates the config and creates the deliveries table if needed
+func New(cfg Config) (*Dispatcher, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("webhooks: DB is required")
+	}
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("webhooks: at least one URL is required")
+	}
+	if cfg.Secret == "" {
+		return nil, errors.New("webhooks: Secret is required")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = DefaultInitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+
+	if err := cfg.DB.AutoMigrate(&Delivery{}); err != nil {
+		return nil, fmt.Errorf("failed to create webhook deliveries table: %w", err)
+	}
+
+	d := &Dispatcher{cfg: cfg, now: time.Now, wake: make(chan struct{}, 1)}
+	if len(cfg.Events) > 0 {
+		d.events = make(map[tenantstore.TenantEventType]bool, len(cfg.Events))
+		for _, eventType := range cfg.Events {
+			d.events[eventType] = true
+		}
+	}
+	return d, nil
+}
+
+// OnTenantEvent records the event for delivery, for use as
+// tenantstore.Config.OnTenantEvent. Failures to record it are lost, since
+// the hook cannot return them; call Enqueue to handle them.
+func (d *Dispatcher) OnTenantEvent(ctx context.Context, event tenantstore.TenantEvent) {
+	d.Enqueue(ctx, event)
+}
+
+// Enqueue records the event for delivery to every URL and wakes the
+// dispatcher. It returns the event ID, or "" for event types not in
+// Config.Events.
+func (d *Dispatcher) Enqueue(ctx context.Context, event tenantstore.TenantEvent) (string, error) {
+	if d.events != nil && !d.events[event.Type] {
+		return "", nil
+	}
+
+	id, err := newEventID()
+	if err != nil {
+		return "", err
+	}
+	payload := Payload{ID: id, Type: event.Type, Tenant: event.Schema, Timestamp: event.Time.UTC()}
+	if payload.Timestamp.IsZero() {
+		payload.Timestamp = d.now().UTC()
+	}
+	if d.cfg.Metadata != nil {
+		payload.Metadata = d.cfg.Metadata(ctx, event)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	now := d.now()
+	deliveries := make([]Delivery, len(d.cfg.URLs))
+	for i, url := range d.cfg.URLs {
+		deliveries[i] = Delivery{
+			EventID:       id,
+			EventType:     string(event.Type),
+			Tenant:        event.Schema,
+			URL:           url,
+			Payload:       string(body),
+			Status:        StatusPending,
+			NextAttemptAt: now,
+		}
+	}
+	if err := d.cfg.DB.WithContext(ctx).Create(&deliveries).Error; err != nil {
+		return "", fmt.Errorf("failed to record webhook deliveries: %w", err)
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return id, nil
+}
+
+// Deliver attempts every delivery that is due, including those recorded
+// before a restart, and returns how many were attempted
+func (d *Dispatcher) Deliver(ctx context.Context) (int, error) {
+	var due []Delivery
+	err := d.cfg.DB.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", StatusPending, d.now()).
+		Order("id").
+		Find(&due).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to load webhook deliveries: %w", err)
+	}
+
+	attempted := 0
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			return attempted, ctx.Err()
+		}
+
+		// Claim the delivery, so a dispatcher sharing the table skips it
+		claim := d.cfg.DB.WithContext(ctx).Model(&Delivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, StatusPending, delivery.NextAttemptAt).
+			Update("next_attempt_at", d.now().Add(claimDuration))
+		if claim.Error != nil {
+			return attempted, fmt.Errorf("failed to claim webhook delivery %d: %w", delivery.ID, claim.Error)
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		attempted++
+		if err := d.attempt(ctx, &delivery); err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, nil
+}
+
+// attempt posts one delivery and records the outcome
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) error {
+	sendErr := d.send(ctx, delivery)
+
+	delivery.Attempts++
+	updates := map[string]interface{}{"attempts": delivery.Attempts}
+	switch {
+	case sendErr == nil:
+		now := d.now()
+		delivery.Status, delivery.DeliveredAt, delivery.LastError = StatusDelivered, &now, ""
+		updates["status"], updates["delivered_at"], updates["last_error"] = StatusDelivered, now, ""
+	case delivery.Attempts >= d.cfg.MaxAttempts:
+		delivery.Status, delivery.LastError = StatusFailed, sendErr.Error()
+		updates["status"], updates["last_error"] = StatusFailed, sendErr.Error()
+	default:
+		delivery.LastError = sendErr.Error()
+		delivery.NextAttemptAt = d.now().Add(d.backoff(delivery.Attempts))
+		updates["last_error"], updates["next_attempt_at"] = sendErr.Error(), delivery.NextAttemptAt
+	}
+
+	if err := d.cfg.DB.WithContext(ctx).Model(&Delivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to record webhook delivery %d: %w", delivery.ID, err)
+	}
+	if delivery.Status == StatusFailed && d.cfg.OnFailed != nil {
+		d.cfg.OnFailed(*delivery)
+	}
+	return nil
+}
+
+// send posts the payload; any status outside 2xx is an error
+func (d *Dispatcher) send(ctx context.Context, delivery *Delivery) error {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, delivery.EventID)
+	req.Header.Set(SignatureHeader, Sign(d.cfg.Secret, body))
+
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook endpoint responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// backoff returns the delay after the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := d.cfg.InitialBackoff
+	for i := 1; i < attempts && backoff < d.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > d.cfg.MaxBackoff {
+		backoff = d.cfg.MaxBackoff
+	}
+	return backoff
+}
+
+// Status returns the deliveries of an event, one per URL
+func (d *Dispatcher) Status(ctx context.Context, eventID string) ([]Delivery, error) {
+	return d.Deliveries(ctx, DeliveryFilter{EventID: eventID})
+}
+
+// Deliveries returns the deliveries matching filter, newest first
+func (d *Dispatcher) Deliveries(ctx context.Context, filter DeliveryFilter) ([]Delivery, error) {
+	query := d.cfg.DB.WithContext(ctx).Order("id DESC")
+	if filter.EventID != "" {
+		query = query.Where("event_id = ?", filter.EventID)
+	}
+	if filter.Tenant != "" {
+		query = query.Where("tenant = ?", filter.Tenant)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var deliveries []Delivery
+	if err := query.Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Start delivers due deliveries in the background every PollInterval and
+// as soon as events are enqueued, until Close
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel, d.done = cancel, make(chan struct{})
+	done := d.done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(d.cfg.PollInterval)
+		defer ticker.Stop()
+		for {
+			d.Deliver(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// Close stops the background delivery started with Start and waits for it
+// to return. Pending deliveries stay recorded for the next Start.
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	cancel, done := d.cancel, d.done
+	d.cancel, d.done = nil, nil
+	d.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	return nil
+}
+
+// Sign returns the signature header value of a payload: "sha256=" and the
+// hex HMAC-SHA256 of body keyed with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature, the X-Webhook-Signature header of a
+// delivery, matches body. Receivers use it to authenticate callbacks.
+func Verify(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+}
+
+// newEventID returns a random 128-bit hex ID
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook event ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
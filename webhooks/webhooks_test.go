@@ -0,0 +1,238 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+const testSecret = "s3cret"
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// receiver fails the first requests with 500, then accepts
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clock is a manually advanced time source
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestDispatcher(t *testing.T, db *gorm.DB, url string, clk *clock, maxAttempts int) *Dispatcher {
+	t.Helper()
+
+	d, err := New(Config{
+		DB:             db,
+		URLs:           []string{url},
+		Secret:         testSecret,
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Metadata: func(ctx context.Context, event tenantstore.TenantEvent) map[string]string {
+			return map[string]string{"plan": "pro"}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+	d.now = clk.Now
+	return d
+}
+
+func TestDeliveryRetriesUntilAccepted(t *testing.T) {
+	recv := &receiver{failures: 2}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	ctx := context.Background()
+	clk := &clock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	d := newTestDispatcher(t, newTestDB(t), server.URL, clk, 5)
+
+	id, err := d.Enqueue(ctx, tenantstore.TenantEvent{Type: tenantstore.EventTenantDeactivated, Schema: "acme", Time: clk.now})
+	if err != nil || id == "" {
+		t.Fatalf("Failed to enqueue: %q (%v)", id, err)
+	}
+
+	// Attempts are spaced by the backoff: 1s, then 2s
+	for i, wait := range []time.Duration{0, time.Second, 2 * time.Second} {
+		clk.now = clk.now.Add(wait - time.Millisecond)
+		if n, _ := d.Deliver(ctx); n != 0 && i > 0 {
+			t.Fatalf("Expected attempt %d to wait for the backoff, got %d attempted", i+1, n)
+		}
+		clk.now = clk.now.Add(time.Millisecond)
+		if n, err := d.Deliver(ctx); err != nil || n != 1 {
+			t.Fatalf("Expected attempt %d, got %d (%v)", i+1, n, err)
+		}
+	}
+
+	deliveries, err := d.Status(ctx, id)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Expected one delivery, got %v (%v)", deliveries, err)
+	}
+	if delivery := deliveries[0]; delivery.Status != StatusDelivered || delivery.Attempts != 3 || delivery.DeliveredAt == nil {
+		t.Fatalf("Expected delivered after 3 attempts, got %+v", delivery)
+	}
+	if n, _ := d.Deliver(ctx); n != 0 {
+		t.Fatalf("Expected nothing left to deliver, got %d", n)
+	}
+
+	if len(recv.requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(recv.requests))
+	}
+	for i, req := range recv.requests {
+		if !Verify(testSecret, recv.bodies[i], req.Header.Get(SignatureHeader)) {
+			t.Fatalf("Expected a valid signature on request %d, got %q", i+1, req.Header.Get(SignatureHeader))
+		}
+		if req.Header.Get(IDHeader) != id {
+			t.Fatalf("Expected %s %s, got %q", IDHeader, id, req.Header.Get(IDHeader))
+		}
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(recv.bodies[2], &payload); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if payload.ID != id || payload.Type != tenantstore.EventTenantDeactivated || payload.Tenant != "acme" ||
+		!payload.Timestamp.Equal(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)) || payload.Metadata["plan"] != "pro" {
+		t.Fatalf("Unexpected payload %+v", payload)
+	}
+}
+
+func TestDeliveryGivesUp(t *testing.T) {
+	recv := &receiver{failures: 10}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	ctx := context.Background()
+	clk := &clock{now: time.Now()}
+	d := newTestDispatcher(t, newTestDB(t), server.URL, clk, 2)
+
+	var failed []Delivery
+	d.cfg.OnFailed = func(delivery Delivery) { failed = append(failed, delivery) }
+
+	d.Enqueue(ctx, tenantstore.TenantEvent{Type: tenantstore.EventSchemaDropped, Schema: "acme"})
+	d.Deliver(ctx)
+	clk.now = clk.now.Add(time.Hour)
+	d.Deliver(ctx)
+	clk.now = clk.now.Add(time.Hour)
+	if n, _ := d.Deliver(ctx); n != 0 {
+		t.Fatalf("Expected no attempts after giving up, got %d", n)
+	}
+
+	deliveries, _ := d.Deliveries(ctx, DeliveryFilter{Tenant: "acme", Status: StatusFailed})
+	if len(deliveries) != 1 || deliveries[0].Attempts != 2 || deliveries[0].LastError == "" {
+		t.Fatalf("Expected one failed delivery after 2 attempts, got %+v", deliveries)
+	}
+	if len(failed) != 1 || failed[0].ID != deliveries[0].ID {
+		t.Fatalf("Expected OnFailed for the delivery, got %+v", failed)
+	}
+}
+
+func TestPendingDeliveriesSurviveRestart(t *testing.T) {
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	ctx := context.Background()
+	db := newTestDB(t)
+	clk := &clock{now: time.Now()}
+
+	// Recorded, but the process stops before delivering
+	before := newTestDispatcher(t, db, server.URL, clk, 3)
+	id, err := before.Enqueue(ctx, tenantstore.TenantEvent{Type: tenantstore.EventSchemaCreated, Schema: "acme"})
+	if err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	after := newTestDispatcher(t, db, server.URL, clk, 3)
+	after.Start()
+	defer after.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, _ := after.Status(ctx, id)
+		if len(deliveries) == 1 && deliveries[0].Status == StatusDelivered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the recorded event to be delivered after restart, got %+v", deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	d, err := New(Config{
+		DB:     newTestDB(t),
+		URLs:   []string{"http://127.0.0.1:1"},
+		Secret: testSecret,
+		Events: []tenantstore.TenantEventType{tenantstore.EventSchemaCreated},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+
+	if id, err := d.Enqueue(context.Background(), tenantstore.TenantEvent{Type: tenantstore.EventTenantUpdated, Schema: "acme"}); id != "" || err != nil {
+		t.Fatalf("Expected filtered events to be skipped, got %q (%v)", id, err)
+	}
+	if deliveries, _ := d.Deliveries(context.Background(), DeliveryFilter{}); len(deliveries) != 0 {
+		t.Fatalf("Expected no deliveries, got %d", len(deliveries))
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	signature := Sign(testSecret, body)
+
+	if !Verify(testSecret, body, signature) {
+		t.Fatal("Expected the signature to verify")
+	}
+	if Verify("other", body, signature) || Verify(testSecret, []byte(`{"id":"2"}`), signature) || Verify(testSecret, body, "") {
+		t.Fatal("Expected wrong secrets, bodies and signatures to fail")
+	}
+}
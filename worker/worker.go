@@ -0,0 +1,215 @@
+// Package worker runs tenant-scoped work outside of an HTTP request, such as
+// queue consumers, webhooks processed asynchronously or scheduled jobs.
+//
+// Run executes a function against a single tenant's database, retrying
+// transient failures with exponential backoff. FanOut executes a function for
+// every tenant using the store's ForEachTenant semantics.
+//
+// Example usage:
+//
+//	err := worker.Run(ctx, store, "acme", func(ctx context.Context, db *gorm.DB) error {
+//		return db.Create(&Invoice{Amount: 100}).Error
+//	})
+//
+//	err = worker.FanOut(ctx, store, func(ctx context.Context, db *gorm.DB) error {
+//		return db.Where("expires_at < ?", time.Now()).Delete(&Session{}).Error
+//	}, worker.FanOutOptions{Concurrency: 4, ContinueOnError: true})
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantctx"
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+)
+
+// Store provides tenant database connections
+type Store interface {
+	GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error)
+}
+
+// TenantIterator visits every tenant, as implemented by tenantstore.TenantStore
+type TenantIterator interface {
+	ForEachTenant(ctx context.Context, fn tenantstore.TenantFunc, opts tenantstore.ForEachOptions) error
+}
+
+// Func is the unit of work executed against a tenant database. The tenant is
+// available from the context via Tenant, and the tenant and database via
+// tenantctx.
+type Func func(ctx context.Context, db *gorm.DB) error
+
+// RetryPolicy controls how failed attempts are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry; it doubles after
+	// every attempt up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy retries three times with backoff starting at 100ms
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+// Option customizes Run
+type Option func(*RetryPolicy)
+
+// WithRetryPolicy replaces the retry policy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(p *RetryPolicy) {
+		*p = policy
+	}
+}
+
+// WithMaxAttempts sets the total number of attempts
+func WithMaxAttempts(attempts int) Option {
+	return func(p *RetryPolicy) {
+		p.MaxAttempts = attempts
+	}
+}
+
+// FanOutOptions controls FanOut
+type FanOutOptions struct {
+	// Concurrency is the number of tenants processed at once (default 1)
+	Concurrency int
+
+	// ContinueOnError keeps processing the remaining tenants after a failure
+	ContinueOnError bool
+
+	// Retry is applied to each tenant; zero value uses DefaultRetryPolicy
+	Retry RetryPolicy
+}
+
+// TenantError reports work that failed for a tenant after all attempts
+type TenantError struct {
+	Tenant   string
+	Attempts int
+	Err      error
+}
+
+func (e *TenantError) Error() string {
+	return fmt.Sprintf("worker: tenant %s failed after %d attempt(s): %v", e.Tenant, e.Attempts, e.Err)
+}
+
+func (e *TenantError) Unwrap() error {
+	return e.Err
+}
+
+// permanentError marks an error that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that Run and FanOut give up without retrying, for
+// example when a payload can never be processed
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+type tenantContextKey struct{}
+
+// Tenant returns the tenant a Func is running for
+func Tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// Run executes fn against the tenant's database. Failures to obtain the
+// connection and errors returned by fn are retried with exponential backoff
+// unless they are Permanent or ctx is done. The final failure is returned as
+// a *TenantError.
+func Run(ctx context.Context, store Store, tenant string, fn Func, opts ...Option) error {
+	if tenant == "" {
+		return fmt.Errorf("worker: tenant cannot be empty")
+	}
+
+	policy := DefaultRetryPolicy
+	for _, opt := range opts {
+		opt(&policy)
+	}
+
+	return retry(ctx, tenant, policy, func(ctx context.Context) error {
+		db, err := store.GetTenantDB(ctx, tenant)
+		if err != nil {
+			return err
+		}
+		return fn(tenantctx.WithDB(ctx, tenant, db), db)
+	})
+}
+
+// FanOut executes fn for every tenant through the store's ForEachTenant,
+// retrying each tenant according to opts.Retry. Failures are returned as
+// tenantstore.TenantErrors holding a *TenantError per failed tenant.
+func FanOut(ctx context.Context, store TenantIterator, fn Func, opts FanOutOptions) error {
+	policy := opts.Retry
+	if policy.MaxAttempts == 0 {
+		policy = DefaultRetryPolicy
+	}
+
+	return store.ForEachTenant(ctx, func(ctx context.Context, tenantSchema string, db *gorm.DB) error {
+		return retry(ctx, tenantSchema, policy, func(ctx context.Context) error {
+			return fn(tenantctx.WithDB(ctx, tenantSchema, db), db)
+		})
+	}, tenantstore.ForEachOptions{
+		Concurrency:     opts.Concurrency,
+		ContinueOnError: opts.ContinueOnError,
+	})
+}
+
+// retry runs attempt until it succeeds, fails permanently, runs out of
+// attempts or ctx is done
+func retry(ctx context.Context, tenant string, policy RetryPolicy, attempt func(ctx context.Context) error) error {
+	ctx = context.WithValue(ctx, tenantContextKey{}, tenant)
+
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	backoff := policy.InitialBackoff
+
+	var err error
+	for attempts := 1; ; attempts++ {
+		if err = attempt(ctx); err == nil {
+			return nil
+		}
+
+		if IsPermanent(err) || attempts >= maxAttempts {
+			return &TenantError{Tenant: tenant, Attempts: attempts, Err: err}
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &TenantError{Tenant: tenant, Attempts: attempts, Err: ctx.Err()}
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/1Nelsonel/fiber-multitenant/tenantctx"
+	"github.com/1Nelsonel/fiber-multitenant/tenantstore"
+	"github.com/1Nelsonel/fiber-multitenant/tenanttest"
+)
+
+type job struct {
+	ID     uint `gorm:"primaryKey"`
+	Tenant string
+}
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+// flakyStore fails the first GetTenantDB calls
+type flakyStore struct {
+	*tenanttest.Store
+	failures int
+}
+
+func (s *flakyStore) GetTenantDB(ctx context.Context, tenantSchema string) (*gorm.DB, error) {
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("connection refused")
+	}
+	return s.Store.GetTenantDB(ctx, tenantSchema)
+}
+
+func TestRunUsesTenantDB(t *testing.T) {
+	store := tenanttest.NewStore(t, &job{})
+
+	err := Run(context.Background(), store, "acme", func(ctx context.Context, db *gorm.DB) error {
+		// Service code written against tenantctx sees the same tenant
+		if tenant, _ := tenantctx.Tenant(ctx); tenant != "acme" {
+			return fmt.Errorf("expected acme from tenantctx, got %q", tenant)
+		}
+		shared, err := tenantctx.DB(ctx, store)
+		if err != nil {
+			return err
+		}
+		return shared.Create(&job{Tenant: Tenant(ctx)}).Error
+	})
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+
+	db, _ := store.GetTenantDB(context.Background(), "acme")
+	var saved job
+	if err := db.First(&saved).Error; err != nil {
+		t.Fatalf("Failed to load job: %v", err)
+	}
+
+	if saved.Tenant != "acme" {
+		t.Fatalf("Expected tenant 'acme' in context, got '%s'", saved.Tenant)
+	}
+}
+
+func TestRunRetriesTransientErrors(t *testing.T) {
+	store := &flakyStore{Store: tenanttest.NewStore(t), failures: 2}
+
+	calls := 0
+	err := Run(context.Background(), store, "acme", func(ctx context.Context, db *gorm.DB) error {
+		calls++
+		return nil
+	}, WithRetryPolicy(fastRetry))
+	if err != nil {
+		t.Fatalf("Expected success after retries, got %v", err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("Expected fn to run once, got %d", calls)
+	}
+}
+
+func TestRunReturnsTenantError(t *testing.T) {
+	store := tenanttest.NewStore(t)
+	boom := errors.New("boom")
+
+	calls := 0
+	err := Run(context.Background(), store, "acme", func(ctx context.Context, db *gorm.DB) error {
+		calls++
+		return boom
+	}, WithRetryPolicy(fastRetry))
+
+	var tenantErr *TenantError
+	if !errors.As(err, &tenantErr) {
+		t.Fatalf("Expected *TenantError, got %v", err)
+	}
+
+	if tenantErr.Tenant != "acme" || tenantErr.Attempts != 3 || calls != 3 {
+		t.Fatalf("Unexpected failure: %+v after %d calls", tenantErr, calls)
+	}
+
+	if !errors.Is(err, boom) {
+		t.Fatal("Expected error to wrap the original failure")
+	}
+}
+
+func TestRunDoesNotRetryPermanentErrors(t *testing.T) {
+	store := tenanttest.NewStore(t)
+
+	calls := 0
+	err := Run(context.Background(), store, "acme", func(ctx context.Context, db *gorm.DB) error {
+		calls++
+		return Permanent(errors.New("invalid payload"))
+	}, WithRetryPolicy(fastRetry))
+
+	if !IsPermanent(err) {
+		t.Fatalf("Expected permanent error, got %v", err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("Expected a single attempt, got %d", calls)
+	}
+}
+
+func TestRunStopsWhenContextDone(t *testing.T) {
+	store := tenanttest.NewStore(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Run(ctx, store, "acme", func(ctx context.Context, db *gorm.DB) error {
+		return errors.New("transient")
+	}, WithRetryPolicy(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}))
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	store := tenanttest.NewStore(t, &job{})
+	for _, tenant := range []string{"acme", "globex", "initech"} {
+		tenanttest.Seed(store, tenant)
+	}
+
+	err := FanOut(context.Background(), store, func(ctx context.Context, db *gorm.DB) error {
+		if Tenant(ctx) == "globex" {
+			return Permanent(errors.New("globex is suspended"))
+		}
+		return db.Create(&job{Tenant: Tenant(ctx)}).Error
+	}, FanOutOptions{ContinueOnError: true, Retry: fastRetry})
+
+	var failures tenantstore.TenantErrors
+	if !errors.As(err, &failures) {
+		t.Fatalf("Expected TenantErrors, got %v", err)
+	}
+
+	if len(failures) != 1 || failures["globex"] == nil {
+		t.Fatalf("Expected only globex to fail, got %v", failures)
+	}
+
+	for _, tenant := range []string{"acme", "initech"} {
+		db, _ := store.GetTenantDB(context.Background(), tenant)
+		var count int64
+		db.Model(&job{}).Count(&count)
+		if count != 1 {
+			t.Fatalf("Expected 1 job for %s, got %d", tenant, count)
+		}
+	}
+}